@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/version"
+)
+
+// buildInfo describes this binary and how the server was configured.
+func buildInfo(cli *CLI, serve *ServeCmd, state *common.State) version.Info {
+	info := version.Get(Version, Commit, BuildDate)
+	for _, name := range common.Resources() {
+		if !state.ResourceDisabled(name) {
+			info.Modules = append(info.Modules, name)
+		}
+	}
+	on := func(feature string, enabled bool) {
+		if enabled {
+			info.Features = append(info.Features, feature)
+		}
+	}
+	on("sync", serve.ClientID != "" && serve.ClientSecret != "" && serve.TailnetName != "")
+	on("sync-window", serve.SyncWindow != "")
+	on("drift-check", serve.DriftPolicy != "overwrite")
+	on("if-match", serve.IfMatch != "off")
+	on("scim", serve.SCIMToken != "" && !state.ResourceDisabled("groups"))
+	on("read-only", serve.ReadOnly)
+	on("standby", serve.Standby)
+	on("enforce-managed-by", serve.EnforceManagedBy)
+	on("approval", serve.RequireApproval != "")
+	on("risk-gate", serve.RiskThreshold > 0)
+	on("validate-writes", serve.ValidateWrites != "off")
+	on("anomaly-detection", serve.AnomalyFraction > 0)
+	on("rate-limit", serve.RateLimit > 0)
+	on("cleanup", serve.CleanupAfter > 0)
+	on("tag-owner-bootstrap", serve.TagOwnerBootstrap != "off")
+	on("audit-sinks", serve.AuditSinks != "")
+	on("state-history", serve.StateHistoryDepth >= 0)
+	on("write-queue", serve.WriteDebounce > 0)
+	on("debug", cli.Debug)
+	return info
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/cap"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/diff"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/lbrlabs/tacl/pkg/validate"
+	"github.com/tailscale/hujson"
+	"tailscale.com/client/tailscale"
+)
+
+// CICmd => tacl ci policy.hujson
+//
+// It exits like tacl push: 1 if the policy is invalid, 2 if Tailscale
+// rejected it, 3 for anything else.
+type CICmd struct {
+	File   string `arg:"" help:"Policy file in the checkout: a TACL state file or a Tailscale policy file (JSON or HuJSON)"`
+	Push   bool   `help:"Push the policy if it is valid and differs from the tailnet's (e.g. on merge to the main branch)"`
+	Strict bool   `help:"Treat validation warnings as errors"`
+	Output string `help:"Output format: auto picks github inside GitHub Actions and gitlab inside GitLab CI" short:"o" enum:"auto,text,json,github,gitlab" default:"auto"`
+
+	ClientID     string        `help:"Tailscale OAuth client ID; without credentials only local checks run" env:"TACL_CLIENT_ID"`
+	ClientSecret string        `help:"Tailscale OAuth client secret" env:"TACL_CLIENT_SECRET" secret:"true"`
+	TailnetName  string        `help:"Tailscale tailnet name" env:"TACL_TAILNET"`
+	Timeout      time.Duration `help:"Timeout for the Tailscale API calls" default:"60s"`
+}
+
+// CIReport is the result of tacl ci, printed with -o json.
+type CIReport struct {
+	File     string           `json:"file"`
+	Issues   []validate.Issue `json:"issues"`
+	Errors   int              `json:"errors"`
+	Warnings int              `json:"warnings"`
+
+	// Remote is set when the policy was checked against the tailnet.
+	Remote  bool                        `json:"remote"`
+	Changed bool                        `json:"changed"`
+	Diff    map[string]diff.SectionDiff `json:"diff,omitempty"`
+
+	Pushed    bool   `json:"pushed"`
+	PushError string `json:"pushError,omitempty"`
+}
+
+func (ci *CICmd) Run(cli *CLI) error {
+	logger := common.InitializeLogger(cli.Debug)
+	defer logger.Sync()
+
+	raw, err := readInput(ci.File)
+	if err != nil {
+		return &pushError{pushExitFailed, err}
+	}
+	data, err := policyfile.Import(raw)
+	if err != nil {
+		return &pushError{pushExitInvalid, fmt.Errorf("%s: %w", ci.File, err)}
+	}
+	state := &common.State{Data: data, Logger: logger}
+	if err := state.DisableResources(cap.ParseList(cli.DisableModules)); err != nil {
+		return &pushError{pushExitFailed, fmt.Errorf("--disable-modules: %w", err)}
+	}
+
+	rep := CIReport{File: ci.File, Issues: validate.State(data).Issues}
+	remote := ci.ClientID != "" && ci.ClientSecret != "" && ci.TailnetName != ""
+	if ci.Push && !remote {
+		return &pushError{pushExitFailed, errors.New("--push needs --client-id, --client-secret and --tailnet-name")}
+	}
+
+	var runErr error
+	if remote {
+		runErr = ci.checkRemote(state, &rep)
+	}
+	report := validate.Report{Issues: rep.Issues}
+	rep.Errors, rep.Warnings = report.Errors(), report.Warnings()
+	invalid := rep.Errors > 0 || (ci.Strict && rep.Warnings > 0)
+
+	if runErr == nil && ci.Push && !invalid && rep.Changed {
+		runErr = ci.push(state, &rep)
+	}
+
+	if err := ci.print(rep); err != nil {
+		return &pushError{pushExitFailed, err}
+	}
+	switch {
+	case runErr != nil:
+		return runErr
+	case invalid:
+		return &pushError{pushExitInvalid, fmt.Errorf("ci: validation failed with %d error(s), %d warning(s)", rep.Errors, rep.Warnings)}
+	}
+	return nil
+}
+
+// checkRemote runs Tailscale's validation and diffs against the live policy.
+func (ci *CICmd) checkRemote(state *common.State, rep *CIReport) error {
+	report := validate.Report{Issues: rep.Issues}
+	v := &ValidateCmd{ClientID: ci.ClientID, ClientSecret: ci.ClientSecret, TailnetName: ci.TailnetName, Timeout: ci.Timeout}
+	if err := v.validateRemote(state.Data, &report); err != nil {
+		return &pushError{pushExitFailed, err}
+	}
+	rep.Issues = report.Issues
+
+	policy, err := sync.PolicyJSON(state)
+	if err != nil {
+		return &pushError{pushExitFailed, fmt.Errorf("building policy: %w", err)}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ci.Timeout)
+	defer cancel()
+	live, err := sync.FetchRemote(ctx, sync.NewClient(sync.DefaultClientOptions, ci.ClientID, ci.ClientSecret), ci.TailnetName)
+	if err != nil {
+		return &pushError{pushExitFailed, fmt.Errorf("fetching the tailnet policy: %w", err)}
+	}
+
+	var before, after map[string]interface{}
+	if std, err := hujson.Standardize(live); err != nil || json.Unmarshal(std, &before) != nil {
+		return &pushError{pushExitFailed, errors.New("the tailnet policy is not a JSON object")}
+	}
+	if err := json.Unmarshal(policy, &after); err != nil {
+		return &pushError{pushExitFailed, err}
+	}
+	rep.Remote = true
+	rep.Diff = diff.State(before, after)
+	rep.Changed = len(rep.Diff) > 0
+	return nil
+}
+
+func (ci *CICmd) push(state *common.State, rep *CIReport) error {
+	adminClient := tailscale.NewClient("-", nil)
+	adminClient.HTTPClient = sync.NewClient(sync.DefaultClientOptions, ci.ClientID, ci.ClientSecret)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ci.Timeout)
+	defer cancel()
+	if err := sync.New(state).Push(ctx, adminClient, ci.TailnetName); err != nil {
+		rep.PushError = err.Error()
+		var apiErr *sync.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest {
+			return &pushError{pushExitRejected, fmt.Errorf("ci: Tailscale rejected the policy: %s", apiErr.Body)}
+		}
+		return &pushError{pushExitFailed, fmt.Errorf("ci: push: %w", err)}
+	}
+	rep.Pushed = true
+	return nil
+}
+
+func (ci *CICmd) print(rep CIReport) error {
+	format := ci.Output
+	if format == "auto" {
+		switch {
+		case os.Getenv("GITHUB_ACTIONS") == "true":
+			format = "github"
+		case os.Getenv("GITLAB_CI") == "true":
+			format = "gitlab"
+		default:
+			format = "text"
+		}
+	}
+
+	switch format {
+	case "json":
+		return printJSON(os.Stdout, rep)
+	case "gitlab":
+		// stdout is the Code Quality report; the summary goes to the job log
+		printCISummary(os.Stderr, rep)
+		return printJSON(os.Stdout, codeQuality(rep))
+	case "github":
+		for _, i := range rep.Issues {
+			level := "warning"
+			if i.Severity == validate.SeverityError {
+				level = "error"
+			}
+			fmt.Printf("::%s file=%s,title=%s::%s\n", level, escapeProperty(rep.File), escapeProperty(i.Path), escapeData(i.Message))
+		}
+		printCISummary(os.Stdout, rep)
+		return writeGitHubOutputs(rep)
+	default:
+		for _, i := range rep.Issues {
+			fmt.Println(i)
+		}
+		printCISummary(os.Stdout, rep)
+		return nil
+	}
+}
+
+// printCISummary prints the counts, the diff against the tailnet and the
+// push outcome.
+func printCISummary(w io.Writer, rep CIReport) {
+	fmt.Fprintf(w, "%d error(s), %d warning(s)\n", rep.Errors, rep.Warnings)
+	if !rep.Remote {
+		fmt.Fprintln(w, "No Tailscale credentials; skipped remote validation and the diff against the tailnet")
+		return
+	}
+	if !rep.Changed {
+		fmt.Fprintln(w, "The tailnet policy already matches")
+		return
+	}
+	fmt.Fprintln(w, "Changes against the tailnet policy:")
+	printPolicyDiff(w, rep.Diff)
+	if rep.Pushed {
+		fmt.Fprintln(w, "Pushed the policy to the tailnet")
+	}
+}
+
+// printPolicyDiff prints +/-/~ lines per entry, by section name.
+func printPolicyDiff(w io.Writer, diffs map[string]diff.SectionDiff) {
+	sections := make([]string, 0, len(diffs))
+	for s := range diffs {
+		sections = append(sections, s)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		d := diffs[section]
+		label := func(key string) string {
+			switch {
+			case key == "":
+				return section
+			case strings.HasPrefix(key, "#"):
+				return section + "[" + key[1:] + "]"
+			}
+			return section + "/" + key
+		}
+		for _, c := range d.Added {
+			fmt.Fprintf(w, "+ %s\n    %s\n", label(c.Key), compact(c.After))
+		}
+		for _, c := range d.Changed {
+			fmt.Fprintf(w, "~ %s\n    - %s\n    + %s\n", label(c.Key), compact(c.Before), compact(c.After))
+		}
+		for _, c := range d.Removed {
+			fmt.Fprintf(w, "- %s\n", label(c.Key))
+		}
+	}
+}
+
+// writeGitHubOutputs sets the step outputs (changed, pushed, errors,
+// warnings) and appends the report to the job summary.
+func writeGitHubOutputs(rep CIReport) error {
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		out := fmt.Sprintf("changed=%t\npushed=%t\nerrors=%d\nwarnings=%d\n", rep.Changed, rep.Pushed, rep.Errors, rep.Warnings)
+		if err := appendFile(path, out); err != nil {
+			return err
+		}
+	}
+	if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+		var b strings.Builder
+		fmt.Fprintf(&b, "### TACL: `%s`\n\n", rep.File)
+		for _, i := range rep.Issues {
+			fmt.Fprintf(&b, "- **%s** `%s`: %s\n", i.Severity, i.Path, i.Message)
+		}
+		b.WriteString("\n```diff\n")
+		printCISummary(&b, rep)
+		b.WriteString("```\n")
+		if err := appendFile(path, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendFile(path, s string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// codeQualityIssue is one entry of a GitLab Code Quality report.
+type codeQualityIssue struct {
+	Description string `json:"description"`
+	CheckName   string `json:"check_name"`
+	Fingerprint string `json:"fingerprint"`
+	Severity    string `json:"severity"`
+	Location    struct {
+		Path  string `json:"path"`
+		Lines struct {
+			Begin int `json:"begin"`
+		} `json:"lines"`
+	} `json:"location"`
+}
+
+func codeQuality(rep CIReport) []codeQualityIssue {
+	out := make([]codeQualityIssue, 0, len(rep.Issues))
+	for _, i := range rep.Issues {
+		q := codeQualityIssue{
+			Description: i.Path + ": " + i.Message,
+			CheckName:   "tacl",
+			Severity:    "minor",
+		}
+		if i.Severity == validate.SeverityError {
+			q.Severity = "major"
+		}
+		sum := sha256.Sum256([]byte(rep.File + "\x00" + i.Path + "\x00" + i.Message))
+		q.Fingerprint = hex.EncodeToString(sum[:16])
+		q.Location.Path = rep.File
+		q.Location.Lines.Begin = 1
+		out = append(out, q)
+	}
+	return out
+}
+
+// escapeData and escapeProperty escape workflow command values the way the
+// GitHub Actions toolkit does.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/client"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/diff"
+)
+
+// ClientCmd groups the subcommands that talk to a running TACL server.
+type ClientCmd struct {
+	Server     string `help:"TACL server URL (e.g. http://tacl:8080), overriding the current context" env:"TACL_SERVER"`
+	Context    string `help:"Client context to use instead of the current one" env:"TACL_CONTEXT"`
+	ConfigFile string `help:"Client config file (defaults to the user config dir)" env:"TACL_CLIENT_CONFIG" name:"config-file"`
+	Output     string `help:"Output format" short:"o" enum:"json,table" default:"table"`
+	ManagedBy  string `help:"Source to make changes as, e.g. 'terraform' (sent as X-Tacl-Managed-By)" env:"TACL_MANAGED_BY"`
+
+	Get    ClientGetCmd    `cmd:"" help:"List a resource, or get one entry by id or name. 'state' returns the whole state."`
+	Create ClientCreateCmd `cmd:"" help:"Create an entry from a JSON file."`
+	Update ClientUpdateCmd `cmd:"" help:"Update an entry from a JSON file."`
+	Delete ClientDeleteCmd `cmd:"" help:"Delete an entry by id or name."`
+	Diff   ClientDiffCmd   `cmd:"" help:"Show how a local state file differs from the server."`
+	Apply  ClientApplyCmd  `cmd:"" help:"Make the server match a local state file."`
+	Config ClientConfigCmd `cmd:"" help:"Manage client contexts for multiple TACL servers."`
+}
+
+func (c *ClientCmd) configPath() string {
+	if c.ConfigFile != "" {
+		return c.ConfigFile
+	}
+	return client.DefaultConfigPath()
+}
+
+func (c *ClientCmd) client() (*client.Client, error) {
+	cfg, err := client.LoadConfig(c.configPath())
+	if err != nil {
+		return nil, err
+	}
+	server, err := cfg.Server(c.Server, c.Context)
+	if err != nil {
+		return nil, err
+	}
+	cl := client.New(server)
+	cl.ManagedBy = c.ManagedBy
+	return cl, nil
+}
+
+// ClientGetCmd => tacl client get <resource> [<key>]
+type ClientGetCmd struct {
+	Resource string   `arg:"" help:"Resource, e.g. acls, groups, settings, or 'state'"`
+	Key      string   `arg:"" optional:"" help:"Entry id or name"`
+	Label    []string `short:"l" help:"Only list entries matching these label selectors (e.g. 'env=prod', 'team!=web')"`
+}
+
+func (g *ClientGetCmd) Run(parent *ClientCmd) error {
+	cl, err := parent.client()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if g.Resource == "state" {
+		st, err := cl.State(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(os.Stdout, st)
+	}
+
+	res, err := client.LookupResource(g.Resource)
+	if err != nil {
+		return err
+	}
+	var out json.RawMessage
+	switch {
+	case g.Key != "":
+		out, err = cl.Get(ctx, res, g.Key)
+	case len(g.Label) > 0:
+		if res.Kind != client.KindList {
+			return fmt.Errorf("%s entries don't have labels", res.Name)
+		}
+		out, err = cl.ListLabeled(ctx, res, g.Label)
+	default:
+		out, err = cl.List(ctx, res)
+	}
+	if err != nil {
+		return err
+	}
+	return printOutput(os.Stdout, parent.Output, out)
+}
+
+// ClientCreateCmd => tacl client create <resource> -f file.json
+type ClientCreateCmd struct {
+	Resource string `arg:"" help:"Resource, e.g. acls"`
+	File     string `short:"f" required:"" help:"JSON body ('-' for stdin)"`
+}
+
+func (cc *ClientCreateCmd) Run(parent *ClientCmd) error {
+	return sendBody(parent, cc.Resource, cc.File, (*client.Client).Create)
+}
+
+// ClientUpdateCmd => tacl client update <resource> -f file.json
+type ClientUpdateCmd struct {
+	Resource string `arg:"" help:"Resource, e.g. acls"`
+	File     string `short:"f" required:"" help:"JSON body ('-' for stdin), in the shape the resource's PUT expects"`
+}
+
+func (u *ClientUpdateCmd) Run(parent *ClientCmd) error {
+	return sendBody(parent, u.Resource, u.File, (*client.Client).Update)
+}
+
+func sendBody(parent *ClientCmd, resource, file string,
+	send func(*client.Client, context.Context, client.Resource, json.RawMessage) (json.RawMessage, error)) error {
+	res, err := client.LookupResource(resource)
+	if err != nil {
+		return err
+	}
+	body, err := readInput(file)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(body) {
+		return fmt.Errorf("%s is not valid JSON", file)
+	}
+	cl, err := parent.client()
+	if err != nil {
+		return err
+	}
+	out, err := send(cl, context.Background(), res, body)
+	if err != nil {
+		return err
+	}
+	return printOutput(os.Stdout, parent.Output, out)
+}
+
+// ClientDeleteCmd => tacl client delete <resource> [<key>]
+type ClientDeleteCmd struct {
+	Resource      string   `arg:"" help:"Resource, e.g. acls"`
+	Key           string   `arg:"" optional:"" help:"Entry id or name (not needed for settings, derpmap, autoapprovers)"`
+	Label         []string `short:"l" help:"Delete every entry matching these label selectors instead of one by key"`
+	Src           string   `help:"Delete every entry with a source matching this pattern, e.g. 'tag:legacy-*'"`
+	Dst           string   `help:"Delete every entry with a destination (or its host) matching this pattern"`
+	Target        string   `help:"Delete every node attribute grant with a target matching this pattern"`
+	CreatedBefore string   `help:"Delete every entry created before this date (YYYY-MM-DD or RFC 3339)"`
+	DryRun        bool     `help:"With a filter, only print what would be deleted"`
+}
+
+func (d *ClientDeleteCmd) Run(parent *ClientCmd) error {
+	res, err := client.LookupResource(d.Resource)
+	if err != nil {
+		return err
+	}
+	if len(d.Label) > 0 || d.filtered() {
+		return d.deleteLabeled(parent, res)
+	}
+	if d.Key == "" && res.Kind != client.KindSingleton {
+		return fmt.Errorf("deleting from %s needs an id or name", res.Name)
+	}
+	cl, err := parent.client()
+	if err != nil {
+		return err
+	}
+	if err := cl.Delete(context.Background(), res, d.Key); err != nil {
+		return err
+	}
+	fmt.Println("Deleted")
+	return nil
+}
+
+func (d *ClientDeleteCmd) deleteLabeled(parent *ClientCmd, res client.Resource) error {
+	if d.Key != "" {
+		return fmt.Errorf("use either a key or a filter, not both")
+	}
+	if res.Kind != client.KindList {
+		return fmt.Errorf("%s entries can't be deleted by filter", res.Name)
+	}
+	cl, err := parent.client()
+	if err != nil {
+		return err
+	}
+	var ids []string
+	if d.filtered() {
+		filter := client.Filter{Label: d.Label, Src: d.Src, Dst: d.Dst, Target: d.Target}
+		if d.CreatedBefore != "" {
+			t, err := parseDate(d.CreatedBefore)
+			if err != nil {
+				return err
+			}
+			filter.CreatedBefore = &t
+		}
+		ids, err = cl.DeleteMatching(context.Background(), res, filter, d.DryRun)
+	} else {
+		ids, err = cl.DeleteLabeled(context.Background(), res, d.Label, d.DryRun)
+	}
+	if err != nil {
+		return err
+	}
+	verb := "Deleted"
+	if d.DryRun {
+		verb = "Would delete"
+	}
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+	fmt.Printf("%s %d %s\n", verb, len(ids), res.Name)
+	return nil
+}
+
+// filtered reports whether a filter beyond labels was given, which needs
+// POST /<resource>/_delete.
+func (d *ClientDeleteCmd) filtered() bool {
+	return d.Src != "" || d.Dst != "" || d.Target != "" || d.CreatedBefore != ""
+}
+
+// parseDate accepts a date or an RFC 3339 timestamp.
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: want YYYY-MM-DD or RFC 3339", s)
+	}
+	return t, nil
+}
+
+// ClientDiffCmd => tacl client diff -f state.json
+type ClientDiffCmd struct {
+	File string `short:"f" required:"" help:"Local state file, as produced by 'tacl client get state' ('-' for stdin)"`
+}
+
+func (d *ClientDiffCmd) Run(parent *ClientCmd) error {
+	actions, diffs, err := planFromFile(parent, d.File)
+	if err != nil {
+		return err
+	}
+	if parent.Output == "json" {
+		return printJSON(os.Stdout, map[string]interface{}{"diff": diffs, "actions": actions})
+	}
+	if len(diffs) == 0 {
+		fmt.Println("No differences")
+		return nil
+	}
+	printDiff(os.Stdout, diffs)
+	return nil
+}
+
+// ClientApplyCmd => tacl client apply -f state.json
+type ClientApplyCmd struct {
+	File   string `short:"f" required:"" help:"Local state file, as produced by 'tacl client get state' ('-' for stdin)"`
+	DryRun bool   `help:"Only print the API calls that would be made"`
+}
+
+func (a *ClientApplyCmd) Run(parent *ClientCmd) error {
+	actions, _, err := planFromFile(parent, a.File)
+	if err != nil {
+		return err
+	}
+	if len(actions) == 0 {
+		fmt.Println("Nothing to apply")
+		return nil
+	}
+	for _, act := range actions {
+		fmt.Printf("%-6s %-14s %s\n", act.Op, act.Resource, act.Key)
+	}
+	if a.DryRun {
+		return nil
+	}
+	cl, err := parent.client()
+	if err != nil {
+		return err
+	}
+	if err := cl.Apply(context.Background(), actions); err != nil {
+		return err
+	}
+	fmt.Printf("Applied %d change(s)\n", len(actions))
+	return nil
+}
+
+func planFromFile(parent *ClientCmd, file string) ([]client.Action, map[string]diff.SectionDiff, error) {
+	b, err := readInput(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var local map[string]interface{}
+	if err := json.Unmarshal(b, &local); err != nil {
+		return nil, nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	cl, err := parent.client()
+	if err != nil {
+		return nil, nil, err
+	}
+	remote, err := cl.State(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	actions, diffs := client.Plan(remote, local)
+	return actions, diffs, nil
+}
+
+// ClientConfigCmd manages named contexts.
+type ClientConfigCmd struct {
+	GetContexts ClientGetContextsCmd `cmd:"" help:"List contexts."`
+	SetContext  ClientSetContextCmd  `cmd:"" help:"Create or update a context."`
+	UseContext  ClientUseContextCmd  `cmd:"" help:"Switch the current context."`
+}
+
+// ClientGetContextsCmd => tacl client config get-contexts
+type ClientGetContextsCmd struct{}
+
+func (g *ClientGetContextsCmd) Run(parent *ClientCmd) error {
+	cfg, err := client.LoadConfig(parent.configPath())
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CURRENT\tNAME\tSERVER")
+	for _, name := range cfg.Names() {
+		current := ""
+		if name == cfg.Current {
+			current = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", current, name, cfg.Contexts[name].Server)
+	}
+	return w.Flush()
+}
+
+// ClientSetContextCmd => tacl client config set-context <name> --server=<url>
+type ClientSetContextCmd struct {
+	Name   string `arg:"" help:"Context name"`
+	URL    string `name:"url" required:"" help:"Server URL, e.g. http://tacl:8080"`
+	Select bool   `help:"Also make it the current context"`
+}
+
+func (s *ClientSetContextCmd) Run(parent *ClientCmd) error {
+	cfg, err := client.LoadConfig(parent.configPath())
+	if err != nil {
+		return err
+	}
+	cfg.Contexts[s.Name] = client.Context{Server: s.URL}
+	if s.Select || cfg.Current == "" {
+		cfg.Current = s.Name
+	}
+	return cfg.Save(parent.configPath())
+}
+
+// ClientUseContextCmd => tacl client config use-context <name>
+type ClientUseContextCmd struct {
+	Name string `arg:"" help:"Context name"`
+}
+
+func (u *ClientUseContextCmd) Run(parent *ClientCmd) error {
+	cfg, err := client.LoadConfig(parent.configPath())
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Contexts[u.Name]; !ok {
+		return fmt.Errorf("context %q not found", u.Name)
+	}
+	cfg.Current = u.Name
+	return cfg.Save(parent.configPath())
+}
+
+func readInput(file string) ([]byte, error) {
+	if file == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(file)
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printOutput renders a response as indented JSON or a table.
+func printOutput(w io.Writer, format string, raw json.RawMessage) error {
+	var v interface{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return err
+		}
+	}
+	if format == "json" {
+		return printJSON(w, v)
+	}
+	return printTable(w, v)
+}
+
+// printTable prints a list of objects as rows, or an object as key/value
+// pairs. Server-managed metadata is left out; use -o json to see it.
+func printTable(w io.Writer, v interface{}) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	defer tw.Flush()
+
+	meta := make(map[string]bool, len(common.MetaFields))
+	for _, f := range common.MetaFields {
+		meta[f] = true
+	}
+
+	switch val := v.(type) {
+	case []interface{}:
+		var cols []string
+		seen := map[string]bool{}
+		for _, item := range val {
+			if m, ok := item.(map[string]interface{}); ok {
+				for k := range m {
+					if !seen[k] && !meta[k] {
+						seen[k] = true
+						cols = append(cols, k)
+					}
+				}
+			}
+		}
+		sort.Slice(cols, func(i, j int) bool {
+			return columnRank(cols[i]) < columnRank(cols[j]) ||
+				(columnRank(cols[i]) == columnRank(cols[j]) && cols[i] < cols[j])
+		})
+		if len(cols) == 0 {
+			for _, item := range val {
+				fmt.Fprintln(tw, cell(item))
+			}
+			return nil
+		}
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(cols, "\t")))
+		for _, item := range val {
+			m, _ := item.(map[string]interface{})
+			row := make([]string, len(cols))
+			for i, c := range cols {
+				row[i] = cell(m[c])
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			if !meta[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		fmt.Fprintln(tw, "KEY\tVALUE")
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%s\t%s\n", k, cell(val[k]))
+		}
+	case nil:
+		fmt.Fprintln(tw, "(none)")
+	default:
+		fmt.Fprintln(tw, cell(val))
+	}
+	return nil
+}
+
+// columnRank puts identifying columns first.
+func columnRank(col string) int {
+	switch col {
+	case "id":
+		return 0
+	case "name":
+		return 1
+	default:
+		return 2
+	}
+}
+
+const maxCellWidth = 60
+
+func cell(v interface{}) string {
+	var s string
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		s = val
+	default:
+		b, _ := json.Marshal(val)
+		s = string(b)
+	}
+	if len(s) > maxCellWidth {
+		s = s[:maxCellWidth-3] + "..."
+	}
+	return s
+}
+
+// printDiff prints +/-/~ lines per entry, in resource order.
+func printDiff(w io.Writer, diffs map[string]diff.SectionDiff) {
+	for _, res := range client.Resources() {
+		d, ok := diffs[res.Section]
+		if !ok {
+			continue
+		}
+		label := func(c diff.Change) string {
+			if c.Key == "" {
+				return res.Name
+			}
+			if c.Slug != "" {
+				return res.Name + "/" + c.Slug
+			}
+			return res.Name + "/" + strings.TrimPrefix(c.Key, res.KeyPrefix)
+		}
+		for _, c := range d.Added {
+			fmt.Fprintf(w, "+ %s\n    %s\n", label(c), compact(c.After))
+		}
+		for _, c := range d.Changed {
+			fmt.Fprintf(w, "~ %s\n    - %s\n    + %s\n", label(c), compact(c.Before), compact(c.After))
+		}
+		for _, c := range d.Removed {
+			fmt.Fprintf(w, "- %s\n", label(c))
+		}
+	}
+}
+
+func compact(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
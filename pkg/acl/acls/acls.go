@@ -2,12 +2,9 @@
 package acls
 
 import (
-	"encoding/json"
-	"net/http"
-
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/resource"
 )
 
 // ErrorResponse can be used in @Failure annotations so we get a more descriptive schema than map[string]string.
@@ -32,6 +29,17 @@ type ACL struct {
 
 	// SourcePosture is for an experimental feature and not yet public or documented as of 2023-08-17.
 	SourcePosture []string `json:"srcPosture,omitempty" hujson:"SrcPosture,omitempty"`
+
+	// ExpiresAt/Disabled make the rule temporary; see common.Expiry.
+	common.Expiry
+	// Labels are TACL-only key/value pairs for filtering.
+	common.Labeled
+	// Slug names the rule in URLs, Terraform IDs and audit output.
+	common.Slugged
+	// Priority orders the rule in the synced policy; see common.Prioritized.
+	common.Prioritized
+	// Description explains the rule in the policy documentation.
+	common.Described
 }
 
 // ExtendedACLEntry is a local storage type with a stable UUID plus ACL fields.
@@ -40,6 +48,7 @@ type ExtendedACLEntry struct {
 	ID string `json:"id"` // stable UUID
 
 	ACL
+	common.EntryMeta
 }
 
 // updateRequest represents the body shape for PUT /acls.
@@ -68,54 +77,96 @@ type deleteRequest struct {
 	ID string `json:"id"`
 }
 
+// aclStore serves the "acls" section.
+type aclStore = resource.Store[ACL, ExtendedACLEntry]
+
+func newStore(state *common.State) *aclStore {
+	return (&aclStore{
+		Section:   "acls",
+		Noun:      "ACL entry",
+		Plural:    "ACLs",
+		BodyField: "entry",
+		Build: func(id string, in ACL, meta common.EntryMeta) ExtendedACLEntry {
+			return ExtendedACLEntry{ID: id, ACL: in, EntryMeta: meta}
+		},
+		ID:       func(e ExtendedACLEntry) string { return e.ID },
+		Meta:     func(e ExtendedACLEntry) common.EntryMeta { return e.EntryMeta },
+		Normalize: normalizeACL,
+		Validate:  func(in *ACL) error { return in.Expiry.Validate() },
+	}).Init(state)
+}
+
+// normalizeACL canonicalizes a rule; the action defaults to "accept", the
+// only one Tailscale supports.
+func normalizeACL(in *ACL) {
+	in.Action = common.NormalizeWord(in.Action)
+	if in.Action == "" {
+		in.Action = "accept"
+	}
+	in.Protocol = common.NormalizeWord(in.Protocol)
+	in.Source = common.NormalizeList(in.Source)
+	in.Destination = common.NormalizeDestinations(in.Destination)
+	in.SourcePosture = common.NormalizeList(in.SourcePosture)
+}
+
 // RegisterRoutes wires up ACL-related routes at /acls:
 //
 //   GET    /acls         => list all (by ID)
 //   GET    /acls/:id     => get one by ID
+//   GET    /acls/by-slug/:slug => get one by slug
 //   POST   /acls         => create (generate a new ID)
 //   PUT    /acls         => update an existing ACL by ID
 //   DELETE /acls         => delete by ID
+//   POST   /acls/_delete => delete every entry matching a filter
 func RegisterRoutes(r *gin.Engine, state *common.State) {
+	store := newStore(state)
+
 	a := r.Group("/acls")
 	{
 		a.GET("", func(c *gin.Context) {
-			listACLs(c, state)
+			listACLs(c, store)
 		})
 
 		a.GET("/:id", func(c *gin.Context) {
-			getACLByID(c, state)
+			getACLByID(c, store)
+		})
+
+		a.GET("/by-slug/:slug", func(c *gin.Context) {
+			getACLBySlug(c, store)
 		})
 
 		a.POST("", func(c *gin.Context) {
-			createACL(c, state)
+			createACL(c, store)
 		})
 
 		a.PUT("", func(c *gin.Context) {
-			updateACL(c, state)
+			updateACL(c, store)
 		})
 
 		a.DELETE("", func(c *gin.Context) {
-			deleteACL(c, state)
+			deleteACL(c, store)
+		})
+
+		a.POST("/_delete", func(c *gin.Context) {
+			deleteMatchingACLs(c, store)
 		})
 	}
 }
 
 // listACLs => GET /acls => returns entire []ExtendedACLEntry
 // @Summary      List all ACL entries
-// @Description  Returns the entire list of ExtendedACLEntry objects.
+// @Description  Returns the entire list of ExtendedACLEntry objects, optionally paginated.
 // @Tags         ACLs
 // @Accept       json
 // @Produce      json
+// @Param        limit  query    int false "Maximum number of entries to return"
+// @Param        offset query    int false "Number of entries to skip"
 // @Success      200 {array}  ExtendedACLEntry "List of ACL entries"
+// @Failure      400 {object} ErrorResponse "Invalid pagination parameters"
 // @Failure      500 {object} ErrorResponse "Failed to parse ACLs"
 // @Router       /acls [get]
-func listACLs(c *gin.Context, state *common.State) {
-	acls, err := getACLsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse ACLs"})
-		return
-	}
-	c.JSON(http.StatusOK, acls)
+func listACLs(c *gin.Context, store *aclStore) {
+	store.List(c)
 }
 
 // getACLByID => GET /acls/:id
@@ -126,25 +177,26 @@ func listACLs(c *gin.Context, state *common.State) {
 // @Produce      json
 // @Param        id   path      string  true  "ACL ID"
 // @Success      200  {object}  ExtendedACLEntry
-// @Failure      404  {object}  ErrorResponse "ACL entry not found"
+// @Failure      404  {object}  ErrorResponse "ACL entry not found with that ID"
 // @Failure      500  {object}  ErrorResponse "Failed to parse ACLs"
 // @Router       /acls/{id} [get]
-func getACLByID(c *gin.Context, state *common.State) {
-	id := c.Param("id")
-
-	acls, err := getACLsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse ACLs"})
-		return
-	}
+func getACLByID(c *gin.Context, store *aclStore) {
+	store.Get(c)
+}
 
-	for _, entry := range acls {
-		if entry.ID == id {
-			c.JSON(http.StatusOK, entry)
-			return
-		}
-	}
-	c.JSON(http.StatusNotFound, ErrorResponse{Error: "ACL entry not found"})
+// getACLBySlug => GET /acls/by-slug/:slug
+// @Summary      Get one ACL by slug
+// @Description  Retrieves a single ACL by its slug, the unique name chosen for it.
+// @Tags         ACLs
+// @Accept       json
+// @Produce      json
+// @Param        slug path      string true "ACL entry slug"
+// @Success      200  {object}  ExtendedACLEntry
+// @Failure      404  {object}  ErrorResponse "ACL entry not found with that slug"
+// @Failure      500  {object}  ErrorResponse "Failed to parse ACLs"
+// @Router       /acls/by-slug/{slug} [get]
+func getACLBySlug(c *gin.Context, store *aclStore) {
+	store.GetBySlug(c)
 }
 
 // createACL => POST /acls
@@ -156,87 +208,33 @@ func getACLByID(c *gin.Context, state *common.State) {
 // @Param        acl  body      ACL  true  "ACL fields"
 // @Success      201  {object}  ExtendedACLEntry
 // @Failure      400  {object}  ErrorResponse "Bad request"
-// @Failure      500  {object}  ErrorResponse "Failed to save new ACL entry"
+// @Failure      500  {object}  ErrorResponse "Failed to save ACL entry"
 // @Router       /acls [post]
-func createACL(c *gin.Context, state *common.State) {
-	var newData ACL
-	if err := c.ShouldBindJSON(&newData); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
-
-	acls, err := getACLsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse ACLs"})
-		return
-	}
-
-	newEntry := ExtendedACLEntry{
-		ID:  uuid.NewString(),
-		ACL: newData,
-	}
-
-	acls = append(acls, newEntry)
-	if err := state.UpdateKeyAndSave("acls", acls); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save new ACL entry"})
-		return
-	}
-	c.JSON(http.StatusCreated, newEntry)
+func createACL(c *gin.Context, store *aclStore) {
+	store.Create(c)
 }
 
 // updateACL => PUT /acls
 // @Summary      Update an existing ACL
-// @Description  Updates the ACL fields for an entry identified by its UUID.
+// @Description  Updates the ACL fields for an entry identified by its UUID. Honors If-Match.
 // @Tags         ACLs
 // @Accept       json
 // @Produce      json
 // @Param        body  body      updateRequest true "Update ACL request"
 // @Success      200   {object}  ExtendedACLEntry
 // @Failure      400   {object}  ErrorResponse "Missing or invalid request data"
-// @Failure      404   {object}  ErrorResponse "ACL entry not found"
+// @Failure      404   {object}  ErrorResponse "ACL entry not found with that ID"
+// @Failure      409   {object}  ErrorResponse "ACL entry is managed by another source"
+// @Failure      412   {object}  ErrorResponse "ACL entry has changed since it was read"
 // @Failure      500   {object}  ErrorResponse "Failed to update ACL entry"
 // @Router       /acls [put]
-func updateACL(c *gin.Context, state *common.State) {
-	var req updateRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
-	if req.ID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing ACL 'id' in request body"})
-		return
-	}
-
-	acls, err := getACLsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse ACLs"})
-		return
-	}
-
-	var updated *ExtendedACLEntry
-	for i := range acls {
-		if acls[i].ID == req.ID {
-			// Found => update the embedded ACL
-			acls[i].ACL = req.Entry
-			updated = &acls[i]
-			break
-		}
-	}
-	if updated == nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "ACL entry not found"})
-		return
-	}
-
-	if err := state.UpdateKeyAndSave("acls", acls); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update ACL entry"})
-		return
-	}
-	c.JSON(http.StatusOK, updated)
+func updateACL(c *gin.Context, store *aclStore) {
+	store.Update(c)
 }
 
 // deleteACL => DELETE /acls => body => { "id": "<uuid>" }
 // @Summary      Delete an ACL
-// @Description  Deletes an ACL entry by specifying its ID in the request body.
+// @Description  Deletes an ACL entry by specifying its ID in the request body. Honors If-Match.
 // @Tags         ACLs
 // @Accept       json
 // @Produce      json
@@ -244,59 +242,25 @@ func updateACL(c *gin.Context, state *common.State) {
 // @Success      200   {object}  map[string]string "ACL entry deleted"
 // @Failure      400   {object}  ErrorResponse "Missing or invalid ID"
 // @Failure      404   {object}  ErrorResponse "ACL entry not found with that ID"
+// @Failure      409   {object}  ErrorResponse "ACL entry is managed by another source"
+// @Failure      412   {object}  ErrorResponse "ACL entry has changed since it was read"
 // @Failure      500   {object}  ErrorResponse "Failed to delete ACL entry"
 // @Router       /acls [delete]
-func deleteACL(c *gin.Context, state *common.State) {
-	var req deleteRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
-	if req.ID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'id' field"})
-		return
-	}
-
-	acls, err := getACLsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse ACLs"})
-		return
-	}
-
-	newList := make([]ExtendedACLEntry, 0, len(acls))
-	deleted := false
-	for _, entry := range acls {
-		if entry.ID == req.ID {
-			deleted = true
-			continue // skip => effectively remove
-		}
-		newList = append(newList, entry)
-	}
-	if !deleted {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "ACL entry not found with that ID"})
-		return
-	}
-
-	if err := state.UpdateKeyAndSave("acls", newList); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete ACL entry"})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "ACL entry deleted"})
+func deleteACL(c *gin.Context, store *aclStore) {
+	store.Delete(c)
 }
 
-// getACLsFromState => read state.Data["acls"] => []ExtendedACLEntry
-func getACLsFromState(state *common.State) ([]ExtendedACLEntry, error) {
-	raw := state.GetValue("acls")
-	if raw == nil {
-		return []ExtendedACLEntry{}, nil
-	}
-	b, err := json.Marshal(raw)
-	if err != nil {
-		return nil, err
-	}
-	var acls []ExtendedACLEntry
-	if err := json.Unmarshal(b, &acls); err != nil {
-		return nil, err
-	}
-	return acls, nil
+// deleteMatchingACLs => POST /acls/_delete
+// @Summary      Delete ACLs matching a filter
+// @Description  Lists the ACL entries matching every given filter and, with "confirm": true, deletes them in one write.
+// @Tags         ACLs
+// @Accept       json
+// @Produce      json
+// @Param        body  body      resource.FilteredDeleteRequest true "Filter"
+// @Success      200   {object}  resource.BulkDeleteResponse
+// @Failure      400   {object}  ErrorResponse "Missing or invalid filter"
+// @Failure      500   {object}  ErrorResponse "Failed to delete ACLs"
+// @Router       /acls/_delete [post]
+func deleteMatchingACLs(c *gin.Context, store *aclStore) {
+	store.DeleteFiltered(c)
 }
@@ -1,12 +1,9 @@
 package acltests
 
 import (
-	"encoding/json"
-	"net/http"
-
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/resource"
 )
 
 // ErrorResponse can be used in @Failure annotations for clearer error messages.
@@ -28,6 +25,11 @@ type ACLTest struct {
 
 	// Accept is a list of rules or addresses to be accepted.
 	Accept []string `json:"accept,omitempty" hujson:"Accept,omitempty"`
+
+	// Labels are TACL-only key/value pairs for filtering.
+	common.Labeled
+	// Slug names the test in URLs, Terraform IDs and audit output.
+	common.Slugged
 }
 
 // ExtendedACLTest represents one test item with a stable UUID-based ID.
@@ -35,6 +37,7 @@ type ACLTest struct {
 type ExtendedACLTest struct {
 	ID string `json:"id"`
 	ACLTest
+	common.EntryMeta
 }
 
 // updateTestRequest is the body shape for PUT /acltests.
@@ -62,54 +65,85 @@ type deleteTestRequest struct {
 	ID string `json:"id"`
 }
 
+// testStore serves the "aclTests" section.
+type testStore = resource.Store[ACLTest, ExtendedACLTest]
+
+func newStore(state *common.State) *testStore {
+	return (&testStore{
+		Section:   "aclTests",
+		Noun:      "ACLTest",
+		Plural:    "ACLTests",
+		BodyField: "test",
+		Build: func(id string, in ACLTest, meta common.EntryMeta) ExtendedACLTest {
+			return ExtendedACLTest{ID: id, ACLTest: in, EntryMeta: meta}
+		},
+		ID:        func(e ExtendedACLTest) string { return e.ID },
+		Meta:      func(e ExtendedACLTest) common.EntryMeta { return e.EntryMeta },
+		Normalize: normalizeTest,
+	}).Init(state)
+}
+
+// normalizeTest canonicalizes the source, protocol and destinations.
+func normalizeTest(t *ACLTest) {
+	t.Source = common.NormalizeAddress(t.Source)
+	t.Proto = common.NormalizeWord(t.Proto)
+	t.Accept = common.NormalizeDestinations(t.Accept)
+	t.Deny = common.NormalizeDestinations(t.Deny)
+}
+
 // RegisterRoutes wires up the ACLTest-related routes at /acltests:
 //
 //   GET    /acltests      => list all ExtendedACLTests
 //   GET    /acltests/:id  => get one by ID
+//   GET    /acltests/by-slug/:slug => get one by slug
 //   POST   /acltests      => create a new test (generates UUID)
 //   PUT    /acltests      => update an existing test by ID
 //   DELETE /acltests      => delete by ID
 func RegisterRoutes(r *gin.Engine, state *common.State) {
+	store := newStore(state)
+
 	t := r.Group("/acltests")
 	{
 		t.GET("", func(c *gin.Context) {
-			listACLTests(c, state)
+			listACLTests(c, store)
 		})
 
 		t.GET("/:id", func(c *gin.Context) {
-			getACLTestByID(c, state)
+			getACLTestByID(c, store)
+		})
+
+		t.GET("/by-slug/:slug", func(c *gin.Context) {
+			getACLTestBySlug(c, store)
 		})
 
 		t.POST("", func(c *gin.Context) {
-			createACLTest(c, state)
+			createACLTest(c, store)
 		})
 
 		t.PUT("", func(c *gin.Context) {
-			updateACLTest(c, state)
+			updateACLTest(c, store)
 		})
 
 		t.DELETE("", func(c *gin.Context) {
-			deleteACLTest(c, state)
+			deleteACLTest(c, store)
 		})
 	}
 }
 
 // listACLTests => GET /acltests => returns entire []ExtendedACLTest
 // @Summary      List all ACL tests
-// @Description  Returns all ExtendedACLTest items from storage.
+// @Description  Returns all ExtendedACLTest items from storage, optionally paginated.
 // @Tags         ACLTests
 // @Accept       json
 // @Produce      json
+// @Param        limit  query int false "Maximum number of entries to return"
+// @Param        offset query int false "Number of entries to skip"
 // @Success      200 {array}  ExtendedACLTest "List of ACL test items"
+// @Failure      400 {object} ErrorResponse   "Invalid pagination parameters"
 // @Failure      500 {object} ErrorResponse   "Failed to parse ACLTests"
 // @Router       /acltests [get]
-func listACLTests(c *gin.Context, state *common.State) {
-	tests, err := getACLTestsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse ACLTests"})
-		return
-	}
-	c.JSON(http.StatusOK, tests)
+func listACLTests(c *gin.Context, store *testStore) {
+	store.List(c)
 }
 
 // getACLTestByID => GET /acltests/:id => find by stable UUID
@@ -123,22 +157,23 @@ func listACLTests(c *gin.Context, state *common.State) {
 // @Failure      404  {object}  ErrorResponse "ACLTest not found with that ID"
 // @Failure      500  {object}  ErrorResponse "Failed to parse ACLTests"
 // @Router       /acltests/{id} [get]
-func getACLTestByID(c *gin.Context, state *common.State) {
-	id := c.Param("id")
-
-	tests, err := getACLTestsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse ACLTests"})
-		return
-	}
+func getACLTestByID(c *gin.Context, store *testStore) {
+	store.Get(c)
+}
 
-	for _, test := range tests {
-		if test.ID == id {
-			c.JSON(http.StatusOK, test)
-			return
-		}
-	}
-	c.JSON(http.StatusNotFound, ErrorResponse{Error: "ACLTest not found with that ID"})
+// getACLTestBySlug => GET /acltests/by-slug/:slug
+// @Summary      Get one ACL test by slug
+// @Description  Retrieves a single ACL test by its slug, the unique name chosen for it.
+// @Tags         ACLTests
+// @Accept       json
+// @Produce      json
+// @Param        slug path      string true "ACLTest slug"
+// @Success      200  {object}  ExtendedACLTest
+// @Failure      404  {object}  ErrorResponse "ACLTest not found with that slug"
+// @Failure      500  {object}  ErrorResponse "Failed to parse ACLTests"
+// @Router       /acltests/by-slug/{slug} [get]
+func getACLTestBySlug(c *gin.Context, store *testStore) {
+	store.GetBySlug(c)
 }
 
 // createACLTest => POST /acltests
@@ -152,35 +187,13 @@ func getACLTestByID(c *gin.Context, state *common.State) {
 // @Failure      400   {object}  ErrorResponse "Bad request"
 // @Failure      500   {object}  ErrorResponse "Failed to parse or save ACLTests"
 // @Router       /acltests [post]
-func createACLTest(c *gin.Context, state *common.State) {
-	var newData ACLTest
-	if err := c.ShouldBindJSON(&newData); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
-
-	tests, err := getACLTestsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse ACLTests"})
-		return
-	}
-
-	newTest := ExtendedACLTest{
-		ID:      uuid.NewString(),
-		ACLTest: newData,
-	}
-
-	tests = append(tests, newTest)
-	if err := state.UpdateKeyAndSave("aclTests", tests); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save new ACLTest"})
-		return
-	}
-	c.JSON(http.StatusCreated, newTest)
+func createACLTest(c *gin.Context, store *testStore) {
+	store.Create(c)
 }
 
 // updateACLTest => PUT /acltests
 // @Summary      Update an ACL test
-// @Description  Updates an existing ACL test by ID with new ACLTest fields.
+// @Description  Updates an existing ACL test by ID with new ACLTest fields. Honors If-Match.
 // @Tags         ACLTests
 // @Accept       json
 // @Produce      json
@@ -188,49 +201,17 @@ func createACLTest(c *gin.Context, state *common.State) {
 // @Success      200   {object}  ExtendedACLTest
 // @Failure      400   {object}  ErrorResponse "Missing or invalid request data"
 // @Failure      404   {object}  ErrorResponse "ACLTest not found with that ID"
+// @Failure      409   {object}  ErrorResponse "ACLTest is managed by another source"
+// @Failure      412   {object}  ErrorResponse "ACLTest has changed since it was read"
 // @Failure      500   {object}  ErrorResponse "Failed to update ACLTest"
 // @Router       /acltests [put]
-func updateACLTest(c *gin.Context, state *common.State) {
-	var req updateTestRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
-	if req.ID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing ACLTest 'id' in request body"})
-		return
-	}
-
-	tests, err := getACLTestsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse ACLTests"})
-		return
-	}
-
-	var updated *ExtendedACLTest
-	for i := range tests {
-		if tests[i].ID == req.ID {
-			// Found => update the embedded ACLTest
-			tests[i].ACLTest = req.Test
-			updated = &tests[i]
-			break
-		}
-	}
-	if updated == nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "ACLTest not found with that ID"})
-		return
-	}
-
-	if err := state.UpdateKeyAndSave("aclTests", tests); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update ACLTest"})
-		return
-	}
-	c.JSON(http.StatusOK, updated)
+func updateACLTest(c *gin.Context, store *testStore) {
+	store.Update(c)
 }
 
 // deleteACLTest => DELETE /acltests
 // @Summary      Delete an ACL test
-// @Description  Deletes an ACLTest by specifying its ID in the request body.
+// @Description  Deletes an ACLTest by specifying its ID in the request body. Honors If-Match.
 // @Tags         ACLTests
 // @Accept       json
 // @Produce      json
@@ -238,60 +219,10 @@ func updateACLTest(c *gin.Context, state *common.State) {
 // @Success      200   {object}  map[string]string "ACLTest deleted"
 // @Failure      400   {object}  ErrorResponse "Missing or invalid ID"
 // @Failure      404   {object}  ErrorResponse "ACLTest not found with that ID"
+// @Failure      409   {object}  ErrorResponse "ACLTest is managed by another source"
+// @Failure      412   {object}  ErrorResponse "ACLTest has changed since it was read"
 // @Failure      500   {object}  ErrorResponse "Failed to delete ACLTest"
 // @Router       /acltests [delete]
-func deleteACLTest(c *gin.Context, state *common.State) {
-	var req deleteTestRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
-	if req.ID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'id' field"})
-		return
-	}
-
-	tests, err := getACLTestsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse ACLTests"})
-		return
-	}
-
-	newList := make([]ExtendedACLTest, 0, len(tests))
-	deleted := false
-	for _, t := range tests {
-		if t.ID == req.ID {
-			deleted = true
-			continue // skip => remove
-		}
-		newList = append(newList, t)
-	}
-	if !deleted {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "ACLTest not found with that ID"})
-		return
-	}
-
-	if err := state.UpdateKeyAndSave("aclTests", newList); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete ACLTest"})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "ACLTest deleted"})
-}
-
-// getACLTestsFromState => read state.Data["aclTests"] => []ExtendedACLTest
-func getACLTestsFromState(state *common.State) ([]ExtendedACLTest, error) {
-	raw := state.GetValue("aclTests")
-	if raw == nil {
-		// If no data has been set yet, return an empty slice
-		return []ExtendedACLTest{}, nil
-	}
-	b, err := json.Marshal(raw)
-	if err != nil {
-		return nil, err
-	}
-	var tests []ExtendedACLTest
-	if err := json.Unmarshal(b, &tests); err != nil {
-		return nil, err
-	}
-	return tests, nil
+func deleteACLTest(c *gin.Context, store *testStore) {
+	store.Delete(c)
 }
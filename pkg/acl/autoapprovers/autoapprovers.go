@@ -24,6 +24,23 @@ type ACLAutoApproversDoc struct {
 	ExitNode []string            `json:"exitNode,omitempty"`
 }
 
+// normalize canonicalizes the route prefixes, merging approvers of
+// prefixes that turn out to be the same, and sorts and dedupes approvers.
+func (d *ACLAutoApproversDoc) normalize() {
+	if d.Routes != nil {
+		routes := make(map[string][]string, len(d.Routes))
+		for prefix, approvers := range d.Routes {
+			prefix = common.NormalizeAddress(prefix)
+			routes[prefix] = append(routes[prefix], approvers...)
+		}
+		for prefix, approvers := range routes {
+			routes[prefix] = common.NormalizeList(approvers)
+		}
+		d.Routes = routes
+	}
+	d.ExitNode = common.NormalizeList(d.ExitNode)
+}
+
 // RegisterRoutes wires up auto-approver routes under /autoapprovers.
 //
 //   GET    /autoapprovers => retrieve the entire ACLAutoApprovers struct
@@ -65,13 +82,13 @@ func getAutoApprovers(c *gin.Context, state *common.State) {
 	}
 	if aap == nil {
 		// Return an empty doc. If you prefer 404, do: c.JSON(http.StatusNotFound, ...)
-		c.JSON(http.StatusOK, ACLAutoApproversDoc{
+		common.RespondETag(c, http.StatusOK, ACLAutoApproversDoc{
 			Routes:   map[string][]string{},
 			ExitNode: []string{},
 		})
 		return
 	}
-	c.JSON(http.StatusOK, convertToDoc(*aap))
+	common.RespondETag(c, http.StatusOK, convertToDoc(*aap))
 }
 
 // createAutoApprovers => POST /autoapprovers
@@ -92,6 +109,7 @@ func createAutoApprovers(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	newAAPDoc.normalize()
 
 	existing, err := getAutoApproversFromState(state)
 	if err != nil {
@@ -105,16 +123,16 @@ func createAutoApprovers(c *gin.Context, state *common.State) {
 	}
 
 	newAAP := convertFromDoc(newAAPDoc)
-	if err := state.UpdateKeyAndSave("autoApprovers", newAAP); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save autoApprovers"})
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), "autoApprovers", newAAP); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save autoApprovers"})
 		return
 	}
-	c.JSON(http.StatusCreated, newAAPDoc)
+	common.RespondETag(c, http.StatusCreated, newAAPDoc)
 }
 
 // updateAutoApprovers => PUT /autoapprovers
 // @Summary      Update auto-approvers
-// @Description  Updates an existing auto-approvers struct. If none exists, returns 404.
+// @Description  Updates an existing auto-approvers struct. If none exists, returns 404. Honors If-Match.
 // @Tags         AutoApprovers
 // @Accept       json
 // @Produce      json
@@ -122,6 +140,7 @@ func createAutoApprovers(c *gin.Context, state *common.State) {
 // @Success      200 {object} ACLAutoApproversDoc
 // @Failure      400 {object} ErrorResponse "Invalid JSON body"
 // @Failure      404 {object} ErrorResponse "No autoApprovers found to update"
+// @Failure      412 {object} ErrorResponse "autoApprovers has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to update autoApprovers"
 // @Router       /autoapprovers [put]
 func updateAutoApprovers(c *gin.Context, state *common.State) {
@@ -130,6 +149,7 @@ func updateAutoApprovers(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	updatedDoc.normalize()
 
 	existing, err := getAutoApproversFromState(state)
 	if err != nil {
@@ -140,23 +160,27 @@ func updateAutoApprovers(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No autoApprovers found to update"})
 		return
 	}
+	if !state.IfMatch(c, "autoApprovers", convertToDoc(*existing)) {
+		return
+	}
 
 	newAAP := convertFromDoc(updatedDoc)
-	if err := state.UpdateKeyAndSave("autoApprovers", newAAP); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update autoApprovers"})
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), "autoApprovers", newAAP); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to update autoApprovers"})
 		return
 	}
-	c.JSON(http.StatusOK, updatedDoc)
+	common.RespondETag(c, http.StatusOK, updatedDoc)
 }
 
 // deleteAutoApprovers => DELETE /autoapprovers
 // @Summary      Delete auto-approvers
-// @Description  Removes the autoApprovers from state. If none exists, returns 404.
+// @Description  Removes the autoApprovers from state. If none exists, returns 404. Honors If-Match.
 // @Tags         AutoApprovers
 // @Accept       json
 // @Produce      json
 // @Success      200 {object} map[string]string "autoApprovers deleted"
 // @Failure      404 {object} ErrorResponse "No autoApprovers found"
+// @Failure      412 {object} ErrorResponse "autoApprovers has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to delete autoApprovers"
 // @Router       /autoapprovers [delete]
 func deleteAutoApprovers(c *gin.Context, state *common.State) {
@@ -169,9 +193,12 @@ func deleteAutoApprovers(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No autoApprovers found"})
 		return
 	}
+	if !state.IfMatch(c, "autoApprovers", convertToDoc(*existing)) {
+		return
+	}
 
-	if err := state.UpdateKeyAndSave("autoApprovers", nil); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete autoApprovers"})
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), "autoApprovers", nil); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to delete autoApprovers"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "autoApprovers deleted"})
@@ -85,7 +85,7 @@ func getDERPMap(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No DERPMap found"})
 		return
 	}
-	c.JSON(http.StatusOK, convertDERPMapToDoc(*dm))
+	common.RespondETag(c, http.StatusOK, convertDERPMapToDoc(*dm))
 }
 
 // createDERPMap => POST /derpmap
@@ -120,16 +120,16 @@ func createDERPMap(c *gin.Context, state *common.State) {
 	}
 
 	newDM := convertDocToDERPMap(newDMDoc)
-	if err := state.UpdateKeyAndSave("derpMap", newDM); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save DERPMap"})
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), "derpMap", newDM); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save DERPMap"})
 		return
 	}
-	c.JSON(http.StatusCreated, newDMDoc)
+	common.RespondETag(c, http.StatusCreated, newDMDoc)
 }
 
 // updateDERPMap => PUT /derpmap
 // @Summary      Update an existing DERPMap
-// @Description  Updates the DERPMap if it exists, or returns 404 if not found.
+// @Description  Updates the DERPMap if it exists, or returns 404 if not found. Honors If-Match.
 // @Tags         DERPMap
 // @Accept       json
 // @Produce      json
@@ -137,6 +137,7 @@ func createDERPMap(c *gin.Context, state *common.State) {
 // @Success      200 {object} ACLDERPMapDoc
 // @Failure      400 {object} ErrorResponse "Invalid JSON body"
 // @Failure      404 {object} ErrorResponse "No DERPMap found to update"
+// @Failure      412 {object} ErrorResponse "DERPMap has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to update DERPMap"
 // @Router       /derpmap [put]
 func updateDERPMap(c *gin.Context, state *common.State) {
@@ -155,23 +156,27 @@ func updateDERPMap(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No DERPMap found to update"})
 		return
 	}
+	if !state.IfMatch(c, "DERPMap", convertDERPMapToDoc(*existing)) {
+		return
+	}
 
 	newDM := convertDocToDERPMap(updatedDoc)
-	if err := state.UpdateKeyAndSave("derpMap", newDM); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update DERPMap"})
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), "derpMap", newDM); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to update DERPMap"})
 		return
 	}
-	c.JSON(http.StatusOK, updatedDoc)
+	common.RespondETag(c, http.StatusOK, updatedDoc)
 }
 
 // deleteDERPMap => DELETE /derpmap
 // @Summary      Delete the DERPMap
-// @Description  Removes the DERPMap from state. Returns 404 if not found.
+// @Description  Removes the DERPMap from state. Returns 404 if not found. Honors If-Match.
 // @Tags         DERPMap
 // @Accept       json
 // @Produce      json
 // @Success      200 {object} map[string]string "DERPMap deleted"
 // @Failure      404 {object} ErrorResponse "No DERPMap found to delete"
+// @Failure      412 {object} ErrorResponse "DERPMap has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to delete DERPMap"
 // @Router       /derpmap [delete]
 func deleteDERPMap(c *gin.Context, state *common.State) {
@@ -184,9 +189,12 @@ func deleteDERPMap(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No DERPMap found to delete"})
 		return
 	}
+	if !state.IfMatch(c, "DERPMap", convertDERPMapToDoc(*existing)) {
+		return
+	}
 
-	if err := state.UpdateKeyAndSave("derpMap", nil); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete DERPMap"})
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), "derpMap", nil); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to delete DERPMap"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "DERPMap deleted"})
@@ -0,0 +1,296 @@
+// pkg/acl/grants/grants.go
+package grants
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/appcap"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/resource"
+)
+
+// ErrorResponse can be used in @Failure annotations so we get a more descriptive schema than map[string]string.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Grant represents the fields of a grant, the next-generation form of an
+// ACL rule.
+// @Description Grant gives sources access to destinations at the network layer (ip), the application layer (app), or both.
+type Grant struct {
+	// Source is a list of users, groups, tags, hosts or CIDRs the grant applies to.
+	Source []string `json:"src" hujson:"Src"`
+
+	// Destination is a list of tags, hosts, CIDRs or autogroups the grant gives access to.
+	Destination []string `json:"dst" hujson:"Dst"`
+
+	// IP lists the network-layer access, e.g. "*", "443" or "tcp:80-90".
+	IP []string `json:"ip,omitempty" hujson:"Ip,omitempty"`
+
+	// App maps app capability names to the capability values granted.
+	App map[string][]interface{} `json:"app,omitempty" hujson:"App,omitempty" swaggertype:"object"`
+
+	// Via routes the access through these tags, e.g. subnet routers or exit nodes.
+	Via []string `json:"via,omitempty" hujson:"Via,omitempty"`
+
+	// SourcePosture lists the postures sources must satisfy.
+	SourcePosture []string `json:"srcPosture,omitempty" hujson:"SrcPosture,omitempty"`
+
+	// ExpiresAt/Disabled make the grant temporary; see common.Expiry.
+	common.Expiry
+	// Labels are TACL-only key/value pairs for filtering.
+	common.Labeled
+	// Slug names the grant in URLs, Terraform IDs and audit output.
+	common.Slugged
+	// Priority orders the grant in the synced policy; see common.Prioritized.
+	common.Prioritized
+	// Description explains the grant in the policy documentation.
+	common.Described
+}
+
+// ExtendedGrant is a local storage type with a stable UUID plus Grant fields.
+// @Description ExtendedGrant wraps a Grant with a unique ID for local storage.
+type ExtendedGrant struct {
+	ID string `json:"id"` // stable UUID
+
+	Grant
+	common.EntryMeta
+}
+
+// updateRequest represents the body shape for PUT /grants.
+//
+// Example JSON:
+//
+//	{
+//	  "id": "some-uuid",
+//	  "grant": {
+//	    "src": ["group:eng"],
+//	    "dst": ["tag:db"],
+//	    "ip": ["tcp:5432"]
+//	  }
+//	}
+type updateRequest struct {
+	ID    string `json:"id"`
+	Grant Grant  `json:"grant"`
+}
+
+// deleteRequest represents the body shape for DELETE /grants.
+//
+// Example JSON:
+//
+//	{ "id": "some-uuid" }
+type deleteRequest struct {
+	ID string `json:"id"`
+}
+
+// grantStore serves the "grants" section.
+type grantStore = resource.Store[Grant, ExtendedGrant]
+
+func newStore(state *common.State) *grantStore {
+	return (&grantStore{
+		Section:   "grants",
+		Noun:      "grant",
+		Plural:    "grants",
+		BodyField: "grant",
+		Build: func(id string, in Grant, meta common.EntryMeta) ExtendedGrant {
+			return ExtendedGrant{ID: id, Grant: in, EntryMeta: meta}
+		},
+		ID:        func(e ExtendedGrant) string { return e.ID },
+		Meta:      func(e ExtendedGrant) common.EntryMeta { return e.EntryMeta },
+		Normalize: normalizeGrant,
+		Validate:  validateGrant,
+	}).Init(state)
+}
+
+// normalizeGrant canonicalizes a grant's lists.
+func normalizeGrant(in *Grant) {
+	in.Source = common.NormalizeList(in.Source)
+	in.Destination = common.NormalizeList(in.Destination)
+	for i, p := range in.IP {
+		in.IP[i] = common.NormalizeWord(p)
+	}
+	in.Via = common.NormalizeList(in.Via)
+	in.SourcePosture = common.NormalizeList(in.SourcePosture)
+}
+
+// validateGrant requires src, dst and at least one of ip or app, and checks
+// app against the known capability schemas. Unknown Tailscale capabilities
+// are accepted, since Tailscale adds new ones.
+func validateGrant(in *Grant) error {
+	if len(in.Source) == 0 || len(in.Destination) == 0 {
+		return errors.New("`src` and `dst` are required")
+	}
+	if len(in.IP) == 0 && len(in.App) == 0 {
+		return errors.New("At least one of `ip` or `app` must be set")
+	}
+	names := make([]string, 0, len(in.App))
+	for name := range in.App {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := appcap.Check(appcap.SectionGrants, name, in.App[name])
+		if err != nil && !errors.Is(err, appcap.ErrUnknown) {
+			return err
+		}
+	}
+	return in.Expiry.Validate()
+}
+
+// RegisterRoutes wires up grant routes at /grants:
+//
+//	GET    /grants         => list all (by ID)
+//	GET    /grants/:id     => get one by ID
+//	GET    /grants/by-slug/:slug => get one by slug
+//	POST   /grants         => create (generate a new ID)
+//	PUT    /grants         => update an existing grant by ID
+//	DELETE /grants         => delete by ID
+//	POST   /grants/_delete => delete every grant matching a filter
+func RegisterRoutes(r *gin.Engine, state *common.State) {
+	store := newStore(state)
+
+	g := r.Group("/grants")
+	{
+		g.GET("", func(c *gin.Context) {
+			listGrants(c, store)
+		})
+
+		g.GET("/:id", func(c *gin.Context) {
+			getGrantByID(c, store)
+		})
+
+		g.GET("/by-slug/:slug", func(c *gin.Context) {
+			getGrantBySlug(c, store)
+		})
+
+		g.POST("", func(c *gin.Context) {
+			createGrant(c, store)
+		})
+
+		g.PUT("", func(c *gin.Context) {
+			updateGrant(c, store)
+		})
+
+		g.DELETE("", func(c *gin.Context) {
+			deleteGrant(c, store)
+		})
+
+		g.POST("/_delete", func(c *gin.Context) {
+			deleteMatchingGrants(c, store)
+		})
+	}
+}
+
+// listGrants => GET /grants => returns entire []ExtendedGrant
+// @Summary      List all grants
+// @Description  Returns the entire list of ExtendedGrant objects, optionally paginated.
+// @Tags         Grants
+// @Accept       json
+// @Produce      json
+// @Param        limit  query    int false "Maximum number of entries to return"
+// @Param        offset query    int false "Number of entries to skip"
+// @Success      200 {array}  ExtendedGrant "List of grants"
+// @Failure      400 {object} ErrorResponse "Invalid pagination parameters"
+// @Failure      500 {object} ErrorResponse "Failed to parse grants"
+// @Router       /grants [get]
+func listGrants(c *gin.Context, store *grantStore) {
+	store.List(c)
+}
+
+// getGrantByID => GET /grants/:id
+// @Summary      Get one grant by ID
+// @Description  Retrieves a single grant by its stable UUID.
+// @Tags         Grants
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Grant ID"
+// @Success      200  {object}  ExtendedGrant
+// @Failure      404  {object}  ErrorResponse "Grant not found with that ID"
+// @Failure      500  {object}  ErrorResponse "Failed to parse grants"
+// @Router       /grants/{id} [get]
+func getGrantByID(c *gin.Context, store *grantStore) {
+	store.Get(c)
+}
+
+// getGrantBySlug => GET /grants/by-slug/:slug
+// @Summary      Get one grant by slug
+// @Description  Retrieves a single grant by its slug, the unique name chosen for it.
+// @Tags         Grants
+// @Accept       json
+// @Produce      json
+// @Param        slug path      string true "Grant slug"
+// @Success      200  {object}  ExtendedGrant
+// @Failure      404  {object}  ErrorResponse "Grant not found with that slug"
+// @Failure      500  {object}  ErrorResponse "Failed to parse grants"
+// @Router       /grants/by-slug/{slug} [get]
+func getGrantBySlug(c *gin.Context, store *grantStore) {
+	store.GetBySlug(c)
+}
+
+// createGrant => POST /grants
+// @Summary      Create a new grant
+// @Description  Creates a new grant by generating a new UUID and storing the provided fields. Either `ip` or `app` (or both) must be set.
+// @Tags         Grants
+// @Accept       json
+// @Produce      json
+// @Param        grant  body      Grant  true  "Grant fields"
+// @Success      201  {object}  ExtendedGrant
+// @Failure      400  {object}  ErrorResponse "Bad request"
+// @Failure      500  {object}  ErrorResponse "Failed to save grant"
+// @Router       /grants [post]
+func createGrant(c *gin.Context, store *grantStore) {
+	store.Create(c)
+}
+
+// updateGrant => PUT /grants
+// @Summary      Update an existing grant
+// @Description  Updates the fields of a grant identified by its UUID. Honors If-Match.
+// @Tags         Grants
+// @Accept       json
+// @Produce      json
+// @Param        body  body      updateRequest true "Update grant request"
+// @Success      200   {object}  ExtendedGrant
+// @Failure      400   {object}  ErrorResponse "Missing or invalid request data"
+// @Failure      404   {object}  ErrorResponse "Grant not found with that ID"
+// @Failure      409   {object}  ErrorResponse "Grant is managed by another source"
+// @Failure      412   {object}  ErrorResponse "Grant has changed since it was read"
+// @Failure      500   {object}  ErrorResponse "Failed to update grant"
+// @Router       /grants [put]
+func updateGrant(c *gin.Context, store *grantStore) {
+	store.Update(c)
+}
+
+// deleteGrant => DELETE /grants => body => { "id": "<uuid>" }
+// @Summary      Delete a grant
+// @Description  Deletes a grant by specifying its ID in the request body. Honors If-Match.
+// @Tags         Grants
+// @Accept       json
+// @Produce      json
+// @Param        body  body      deleteRequest true "Delete grant request"
+// @Success      200   {object}  map[string]string "Grant deleted"
+// @Failure      400   {object}  ErrorResponse "Missing or invalid ID"
+// @Failure      404   {object}  ErrorResponse "Grant not found with that ID"
+// @Failure      409   {object}  ErrorResponse "Grant is managed by another source"
+// @Failure      412   {object}  ErrorResponse "Grant has changed since it was read"
+// @Failure      500   {object}  ErrorResponse "Failed to delete grant"
+// @Router       /grants [delete]
+func deleteGrant(c *gin.Context, store *grantStore) {
+	store.Delete(c)
+}
+
+// deleteMatchingGrants => POST /grants/_delete
+// @Summary      Delete grants matching a filter
+// @Description  Lists the grants matching every given filter and, with "confirm": true, deletes them in one write.
+// @Tags         Grants
+// @Accept       json
+// @Produce      json
+// @Param        body  body      resource.FilteredDeleteRequest true "Filter"
+// @Success      200   {object}  resource.BulkDeleteResponse
+// @Failure      400   {object}  ErrorResponse "Missing or invalid filter"
+// @Failure      500   {object}  ErrorResponse "Failed to delete grants"
+// @Router       /grants/_delete [post]
+func deleteMatchingGrants(c *gin.Context, store *grantStore) {
+	store.DeleteFiltered(c)
+}
@@ -0,0 +1,129 @@
+package groups
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	gosync "sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"go.uber.org/zap"
+)
+
+// Expansion caches the members of every group, so lookups on hot paths
+// (the access list resolves groups on every request) don't decode the
+// groups section each time. It rebuilds after groups change, and warns
+// when a group grows past a size threshold.
+type Expansion struct {
+	state  *common.State
+	warnAt int
+	logger *zap.Logger
+	index  *common.Index[Group]
+
+	mu      gosync.Mutex // guards checked and over
+	checked uint64
+	over    map[string]bool
+}
+
+// Size is one group's member count, as returned by GET /groups/_sizes.
+type Size struct {
+	Name    string `json:"name"`
+	Members int    `json:"members"`
+	// Large is set for groups over the warning threshold.
+	Large bool `json:"large,omitempty"`
+}
+
+// NewExpansion returns an expansion of state's groups that warns about
+// groups with more than warnAt members (0 disables the warning).
+func NewExpansion(state *common.State, warnAt int, logger *zap.Logger) *Expansion {
+	return &Expansion{
+		state:  state,
+		warnAt: warnAt,
+		logger: logger,
+		index:  common.NewIndex(getGroupsFromState, func(e Group) string { return e.Name }, "groups", common.SectionMetaKey("groups")),
+		over:   map[string]bool{},
+	}
+}
+
+// Members returns the members of the named group (with or without the
+// "group:" prefix), or nil if it doesn't exist. The result is shared and
+// must not be modified.
+func (e *Expansion) Members(name string) []string {
+	e.check()
+	g, ok, err := e.index.Get(e.state, strings.TrimPrefix(name, "group:"))
+	if err != nil || !ok {
+		return nil
+	}
+	return g.Members
+}
+
+// Sizes returns every group's member count, largest first.
+func (e *Expansion) Sizes() ([]Size, error) {
+	e.check()
+	list, err := e.index.List(e.state)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Size, 0, len(list))
+	for _, g := range list {
+		out = append(out, Size{Name: g.Name, Members: len(g.Members), Large: e.large(g)})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Members != out[j].Members {
+			return out[i].Members > out[j].Members
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+func (e *Expansion) large(g Group) bool {
+	return e.warnAt > 0 && len(g.Members) > e.warnAt
+}
+
+// check logs a warning the first time a group is seen over the threshold,
+// once per change to the groups.
+func (e *Expansion) check() {
+	if e.warnAt <= 0 {
+		return
+	}
+	v := e.state.KeyVersion("groups")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if v == e.checked {
+		return
+	}
+	list, err := e.index.List(e.state)
+	if err != nil {
+		return
+	}
+	e.checked = v
+	over := make(map[string]bool)
+	for _, g := range list {
+		if !e.large(g) {
+			continue
+		}
+		over[g.Name] = true
+		if !e.over[g.Name] {
+			e.logger.Warn("Group is over the size warning threshold",
+				zap.String("group", g.Name),
+				zap.Int("members", len(g.Members)),
+				zap.Int("threshold", e.warnAt),
+			)
+		}
+	}
+	e.over = over
+}
+
+// RegisterSizeRoutes wires up GET /groups/_sizes.
+func RegisterSizeRoutes(r *gin.Engine, e *Expansion) {
+	r.GET("/groups/_sizes", func(c *gin.Context) {
+		sizes, err := e.Sizes()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse groups"})
+			return
+		}
+		c.JSON(http.StatusOK, sizes)
+	})
+}
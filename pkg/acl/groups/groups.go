@@ -1,6 +1,7 @@
 package groups
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
@@ -20,6 +21,8 @@ type Group struct {
 	Name string `json:"name" binding:"required"`
 	// Members is the list of user identifiers or tags belonging to this group.
 	Members []string `json:"members"`
+	// CreatedBy/CreatedAt/UpdatedBy/UpdatedAt and ManagedBy are set by the server.
+	common.EntryMeta
 }
 
 // DeleteGroupRequest is the shape of the JSON body for deleteGroup.
@@ -28,15 +31,23 @@ type DeleteGroupRequest struct {
 	Name string `json:"name"`
 }
 
+// normalize trims the name and sorts and dedupes the members.
+func (g *Group) normalize() {
+	g.Name = strings.TrimSpace(g.Name)
+	g.Members = common.NormalizeList(g.Members)
+}
+
 // RegisterRoutes wires up the /groups endpoints.
 func RegisterRoutes(r *gin.Engine, state *common.State) {
+	byName := common.NewIndex(getGroupsFromState, func(e Group) string { return e.Name }, "groups", common.SectionMetaKey("groups"))
+
 	g := r.Group("/groups")
 	{
 		g.GET("", func(c *gin.Context) {
-			listGroups(c, state)
+			listGroups(c, state, byName)
 		})
 		g.GET("/:name", func(c *gin.Context) {
-			getGroupByName(c, state)
+			getGroupByName(c, state, byName)
 		})
 		g.POST("", func(c *gin.Context) {
 			createGroup(c, state)
@@ -51,30 +62,28 @@ func RegisterRoutes(r *gin.Engine, state *common.State) {
 }
 
 // listGroups => GET /groups
-func listGroups(c *gin.Context, state *common.State) {
-	groups, err := getGroupsFromState(state)
+func listGroups(c *gin.Context, state *common.State, byName *common.Index[Group]) {
+	groups, err := byName.List(state)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse groups"})
 		return
 	}
-	c.JSON(http.StatusOK, groups)
+	common.RespondETag(c, http.StatusOK, groups)
 }
 
 // getGroupByName => GET /groups/:name
-func getGroupByName(c *gin.Context, state *common.State) {
+func getGroupByName(c *gin.Context, state *common.State, byName *common.Index[Group]) {
 	name := c.Param("name")
 
-	groups, err := getGroupsFromState(state)
+	entry, ok, err := byName.Get(state, name)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse groups"})
 		return
 	}
 
-	for _, g := range groups {
-		if g.Name == name {
-			c.JSON(http.StatusOK, g)
-			return
-		}
+	if ok {
+		common.RespondETag(c, http.StatusOK, entry)
+		return
 	}
 	c.JSON(http.StatusNotFound, ErrorResponse{Error: "Group not found"})
 }
@@ -86,6 +95,7 @@ func createGroup(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	newGroup.normalize()
 	if newGroup.Name == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'name' field"})
 		return
@@ -105,12 +115,13 @@ func createGroup(c *gin.Context, state *common.State) {
 	}
 
 	// Otherwise, append and save
+	newGroup.EntryMeta = common.NewRequestMeta(c)
 	groups = append(groups, newGroup)
-	if err := saveGroups(state, groups); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save new group"})
+	if err := saveGroups(c.Request.Context(), state, groups); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save new group"})
 		return
 	}
-	c.JSON(http.StatusCreated, newGroup)
+	common.RespondETag(c, http.StatusCreated, newGroup)
 }
 
 // updateGroup => PUT /groups
@@ -120,6 +131,7 @@ func updateGroup(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	updated.normalize()
 	if updated.Name == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'name' field"})
 		return
@@ -134,6 +146,14 @@ func updateGroup(c *gin.Context, state *common.State) {
 	found := false
 	for i, g := range groups {
 		if g.Name == updated.Name {
+			if !state.IfMatch(c, "Group", g) {
+				return
+			}
+			if err := state.CheckManaged(c, g.EntryMeta); err != nil {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "Group is " + err.Error()})
+				return
+			}
+			updated.EntryMeta = g.EntryMeta.Touched(common.Actor(c))
 			groups[i] = updated
 			found = true
 			break
@@ -144,11 +164,11 @@ func updateGroup(c *gin.Context, state *common.State) {
 		return
 	}
 
-	if err := saveGroups(state, groups); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update group"})
+	if err := saveGroups(c.Request.Context(), state, groups); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to update group"})
 		return
 	}
-	c.JSON(http.StatusOK, updated)
+	common.RespondETag(c, http.StatusOK, updated)
 }
 
 // deleteGroup => DELETE /groups
@@ -172,6 +192,13 @@ func deleteGroup(c *gin.Context, state *common.State) {
 	found := false
 	for i, g := range groups {
 		if g.Name == req.Name {
+			if !state.IfMatch(c, "Group", g) {
+				return
+			}
+			if err := state.CheckManaged(c, g.EntryMeta); err != nil {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "Group is " + err.Error()})
+				return
+			}
 			groups = append(groups[:i], groups[i+1:]...)
 			found = true
 			break
@@ -182,13 +209,29 @@ func deleteGroup(c *gin.Context, state *common.State) {
 		return
 	}
 
-	if err := saveGroups(state, groups); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save changes"})
+	if err := saveGroups(c.Request.Context(), state, groups); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save changes"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Group deleted"})
 }
 
+// LookupMembers returns the members of the named group (with or without the
+// "group:" prefix), or nil if it doesn't exist.
+func LookupMembers(state *common.State, name string) []string {
+	groups, err := getGroupsFromState(state)
+	if err != nil {
+		return nil
+	}
+	name = strings.TrimPrefix(name, "group:")
+	for _, g := range groups {
+		if g.Name == name {
+			return g.Members
+		}
+	}
+	return nil
+}
+
 // getGroupsFromState => read the map => convert to []Group
 func getGroupsFromState(state *common.State) ([]Group, error) {
 	raw := state.GetValue("groups")
@@ -204,26 +247,45 @@ func getGroupsFromState(state *common.State) ([]Group, error) {
 		return nil, err
 	}
 
+	meta := common.LoadSectionMeta(state, "groups")
 	var out []Group
 	for fullKey, members := range rawMap {
 		name := strings.TrimPrefix(fullKey, "group:")
 		out = append(out, Group{
-			Name:    name,
-			Members: members,
+			Name:      name,
+			Members:   members,
+			EntryMeta: meta[name],
 		})
 	}
 	return out, nil
 }
 
+// Load returns every group, for modules that edit groups alongside their
+// own state (e.g. SCIM provisioning). The result is the caller's own copy.
+func Load(state *common.State) ([]Group, error) {
+	return getGroupsFromState(state)
+}
+
 // saveGroups => convert []Group => map => store
-func saveGroups(state *common.State, groups []Group) error {
+func saveGroups(ctx context.Context, state *common.State, groups []Group) error {
+	return state.UpdateKeysAndSaveContext(ctx, Values(groups))
+}
+
+// Values returns the state keys and values that store groups, so callers
+// can save them in the same write as their own keys.
+func Values(groups []Group) map[string]interface{} {
 	m := make(map[string][]string)
+	meta := make(map[string]common.EntryMeta)
 	for _, g := range groups {
 		key := g.Name
 		if !strings.HasPrefix(key, "group:") {
 			key = "group:" + key
 		}
 		m[key] = g.Members
+		meta[strings.TrimPrefix(key, "group:")] = g.EntryMeta
+	}
+	return map[string]interface{}{
+		"groups":                        m,
+		common.SectionMetaKey("groups"): meta,
 	}
-	return state.UpdateKeyAndSave("groups", m)
 }
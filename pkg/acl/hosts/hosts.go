@@ -2,8 +2,10 @@
 package hosts
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lbrlabs/tacl/pkg/common"
@@ -23,6 +25,8 @@ type Host struct {
 	Name string `json:"name" binding:"required"`
 	// IP is the IP or CIDR address associated with this hostname.
 	IP   string `json:"ip"   binding:"required"`
+	// CreatedBy/CreatedAt/UpdatedBy/UpdatedAt and ManagedBy are set by the server.
+	common.EntryMeta
 }
 
 // DeleteHostRequest is the JSON body for DELETE /hosts.
@@ -31,6 +35,12 @@ type DeleteHostRequest struct {
 	Name string `json:"name"`
 }
 
+// normalize trims the name and canonicalizes the address.
+func (h *Host) normalize() {
+	h.Name = strings.TrimSpace(h.Name)
+	h.IP = common.NormalizeAddress(h.IP)
+}
+
 // RegisterRoutes wires up the /hosts endpoints.
 //
 //   GET    /hosts       => list all hosts
@@ -39,16 +49,18 @@ type DeleteHostRequest struct {
 //   PUT    /hosts       => update an existing host
 //   DELETE /hosts       => delete a host
 func RegisterRoutes(r *gin.Engine, state *common.State) {
+	byName := common.NewIndex(getHostsFromState, func(e Host) string { return e.Name }, "hosts", common.SectionMetaKey("hosts"))
+
 	h := r.Group("/hosts")
 	{
 		// GET /hosts => list all
 		h.GET("", func(c *gin.Context) {
-			listHosts(c, state)
+			listHosts(c, state, byName)
 		})
 
 		// GET /hosts/:name => get one host
 		h.GET("/:name", func(c *gin.Context) {
-			getHostByName(c, state)
+			getHostByName(c, state, byName)
 		})
 
 		// POST /hosts => create
@@ -77,13 +89,13 @@ func RegisterRoutes(r *gin.Engine, state *common.State) {
 // @Success      200 {array}  Host
 // @Failure      500 {object} ErrorResponse "Failed to parse hosts"
 // @Router       /hosts [get]
-func listHosts(c *gin.Context, state *common.State) {
-	hosts, err := getHostsFromState(state)
+func listHosts(c *gin.Context, state *common.State, byName *common.Index[Host]) {
+	hosts, err := byName.List(state)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse hosts"})
 		return
 	}
-	c.JSON(http.StatusOK, hosts)
+	common.RespondETag(c, http.StatusOK, hosts)
 }
 
 // getHostByName => GET /hosts/:name
@@ -97,20 +109,18 @@ func listHosts(c *gin.Context, state *common.State) {
 // @Failure      404  {object} ErrorResponse "Host not found"
 // @Failure      500  {object} ErrorResponse "Failed to parse hosts"
 // @Router       /hosts/{name} [get]
-func getHostByName(c *gin.Context, state *common.State) {
+func getHostByName(c *gin.Context, state *common.State, byName *common.Index[Host]) {
 	name := c.Param("name")
 
-	hosts, err := getHostsFromState(state)
+	entry, ok, err := byName.Get(state, name)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse hosts"})
 		return
 	}
 
-	for _, h := range hosts {
-		if h.Name == name {
-			c.JSON(http.StatusOK, h)
-			return
-		}
+	if ok {
+		common.RespondETag(c, http.StatusOK, entry)
+		return
 	}
 	c.JSON(http.StatusNotFound, ErrorResponse{Error: "Host not found"})
 }
@@ -133,6 +143,7 @@ func createHost(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	newHost.normalize()
 	if newHost.Name == "" || newHost.IP == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'name' or 'ip' field"})
 		return
@@ -151,17 +162,18 @@ func createHost(c *gin.Context, state *common.State) {
 		}
 	}
 
+	newHost.EntryMeta = common.NewRequestMeta(c)
 	hosts = append(hosts, newHost)
-	if err := saveHosts(state, hosts); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save new host"})
+	if err := saveHosts(c.Request.Context(), state, hosts); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save new host"})
 		return
 	}
-	c.JSON(http.StatusCreated, newHost)
+	common.RespondETag(c, http.StatusCreated, newHost)
 }
 
 // updateHost => PUT /hosts
 // @Summary      Update an existing host
-// @Description  Updates the IP for a host by matching the 'name'. Returns 404 if not found.
+// @Description  Updates the IP for a host by matching the 'name'. Returns 404 if not found. Honors If-Match.
 // @Tags         Hosts
 // @Accept       json
 // @Produce      json
@@ -169,6 +181,8 @@ func createHost(c *gin.Context, state *common.State) {
 // @Success      200 {object} Host
 // @Failure      400 {object} ErrorResponse "Bad request or missing fields"
 // @Failure      404 {object} ErrorResponse "Host not found"
+// @Failure      409 {object} ErrorResponse "Host is managed by another source"
+// @Failure      412 {object} ErrorResponse "Host has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to update host"
 // @Router       /hosts [put]
 func updateHost(c *gin.Context, state *common.State) {
@@ -177,6 +191,7 @@ func updateHost(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	updated.normalize()
 	if updated.Name == "" || updated.IP == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'name' or 'ip' field"})
 		return
@@ -191,6 +206,14 @@ func updateHost(c *gin.Context, state *common.State) {
 	found := false
 	for i, h := range hosts {
 		if h.Name == updated.Name {
+			if !state.IfMatch(c, "Host", h) {
+				return
+			}
+			if err := state.CheckManaged(c, h.EntryMeta); err != nil {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "Host is " + err.Error()})
+				return
+			}
+			updated.EntryMeta = h.EntryMeta.Touched(common.Actor(c))
 			hosts[i] = updated
 			found = true
 			break
@@ -201,16 +224,16 @@ func updateHost(c *gin.Context, state *common.State) {
 		return
 	}
 
-	if err := saveHosts(state, hosts); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update host"})
+	if err := saveHosts(c.Request.Context(), state, hosts); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to update host"})
 		return
 	}
-	c.JSON(http.StatusOK, updated)
+	common.RespondETag(c, http.StatusOK, updated)
 }
 
 // deleteHost => DELETE /hosts
 // @Summary      Delete a host
-// @Description  Deletes a host by name, based on JSON input { "name": "..." }.
+// @Description  Deletes a host by name, based on JSON input { "name": "..." }. Honors If-Match.
 // @Tags         Hosts
 // @Accept       json
 // @Produce      json
@@ -218,6 +241,8 @@ func updateHost(c *gin.Context, state *common.State) {
 // @Success      200 {object} map[string]string "Host deleted"
 // @Failure      400 {object} ErrorResponse     "Missing name"
 // @Failure      404 {object} ErrorResponse     "Host not found"
+// @Failure      409 {object} ErrorResponse     "Host is managed by another source"
+// @Failure      412 {object} ErrorResponse     "Host has changed since it was read"
 // @Failure      500 {object} ErrorResponse     "Failed to save changes"
 // @Router       /hosts [delete]
 func deleteHost(c *gin.Context, state *common.State) {
@@ -240,6 +265,13 @@ func deleteHost(c *gin.Context, state *common.State) {
 	found := false
 	for i, h := range hosts {
 		if h.Name == req.Name {
+			if !state.IfMatch(c, "Host", h) {
+				return
+			}
+			if err := state.CheckManaged(c, h.EntryMeta); err != nil {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "Host is " + err.Error()})
+				return
+			}
 			hosts = append(hosts[:i], hosts[i+1:]...)
 			found = true
 			break
@@ -250,8 +282,8 @@ func deleteHost(c *gin.Context, state *common.State) {
 		return
 	}
 
-	if err := saveHosts(state, hosts); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save changes"})
+	if err := saveHosts(c.Request.Context(), state, hosts); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save changes"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Host deleted"})
@@ -279,21 +311,28 @@ func getHostsFromState(state *common.State) ([]Host, error) {
 	}
 
 	// Convert map => array
+	meta := common.LoadSectionMeta(state, "hosts")
 	var out []Host
 	for name, ip := range rawMap {
 		out = append(out, Host{
-			Name: name,
-			IP:   ip,
+			Name:      name,
+			IP:        ip,
+			EntryMeta: meta[name],
 		})
 	}
 	return out, nil
 }
 
 // saveHosts => convert []Host => map => store
-func saveHosts(state *common.State, hosts []Host) error {
+func saveHosts(ctx context.Context, state *common.State, hosts []Host) error {
 	m := make(map[string]string)
+	meta := make(map[string]common.EntryMeta)
 	for _, h := range hosts {
 		m[h.Name] = h.IP
+		meta[h.Name] = h.EntryMeta
 	}
-	return state.UpdateKeyAndSave("hosts", m)
+	return state.UpdateKeysAndSaveContext(ctx, map[string]interface{}{
+		"hosts":                        m,
+		common.SectionMetaKey("hosts"): meta,
+	})
 }
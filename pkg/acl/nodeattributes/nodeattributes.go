@@ -2,12 +2,14 @@
 package nodeattrs
 
 import (
-	"encoding/json"
-	"net/http"
+	"errors"
+	"sort"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/lbrlabs/tacl/pkg/appcap"
 	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/resource"
 	tsclient "github.com/tailscale/tailscale-client-go/v2"
 )
 
@@ -37,6 +39,10 @@ type NodeAttrGrantInputDoc struct {
 	Attr []string `json:"attr,omitempty"`
 	// App is a map of <string> to []AppConnectorInputDoc if not using "attr".
 	App map[string][]AppConnectorInputDoc `json:"app,omitempty"`
+	// Labels are TACL-only key/value pairs for filtering.
+	Labels common.Labels `json:"labels,omitempty"`
+	// Slug names the grant in URLs, Terraform IDs and audit output.
+	Slug string `json:"slug,omitempty"`
 }
 
 // ExtendedNodeAttrGrantDoc is the doc version of ExtendedNodeAttrGrant,
@@ -50,6 +56,12 @@ type ExtendedNodeAttrGrantDoc struct {
 	Attr []string `json:"attr,omitempty"`
 	// App is present if this is an app-based grant.
 	App map[string][]AppConnectorInputDoc `json:"app,omitempty"`
+	// Labels are TACL-only key/value pairs for filtering.
+	Labels common.Labels `json:"labels,omitempty"`
+	// Slug names the grant in URLs, Terraform IDs and audit output.
+	Slug string `json:"slug,omitempty"`
+	// CreatedBy/CreatedAt/UpdatedBy/UpdatedAt record who changed the grant and when.
+	common.EntryMeta
 }
 
 // updateNodeAttrRequestDoc duplicates the PUT request body:
@@ -82,6 +94,8 @@ type NodeAttrGrantInput struct {
 	Target []string                       `json:"target" binding:"required"`
 	Attr   []string                       `json:"attr,omitempty"`
 	App    map[string][]AppConnectorInput `json:"app,omitempty"`
+	common.Labeled
+	common.Slugged
 }
 
 // AppConnectorInput => each item in "app"
@@ -97,37 +111,82 @@ type ExtendedNodeAttrGrant struct {
 
 	tsclient.NodeAttrGrant
 	App map[string][]AppConnectorInput `json:"app,omitempty"`
+	common.Labeled
+	common.Slugged
+	common.EntryMeta
+}
+
+// grantStore serves the "nodeAttrs" section.
+type grantStore = resource.Store[NodeAttrGrantInput, ExtendedNodeAttrGrant]
+
+func newStore(state *common.State) *grantStore {
+	return (&grantStore{
+		Section:   "nodeAttrs",
+		Noun:      "node attribute",
+		Plural:    "node attributes",
+		BodyField: "grant",
+		Build: func(id string, in NodeAttrGrantInput, meta common.EntryMeta) ExtendedNodeAttrGrant {
+			return ExtendedNodeAttrGrant{
+				ID: id,
+				NodeAttrGrant: tsclient.NodeAttrGrant{
+					Target: in.Target,
+					Attr:   in.Attr,
+				},
+				App:       convertAppConnectors(in.App),
+				Labeled:   in.Labeled,
+				Slugged:   in.Slugged,
+				EntryMeta: meta,
+			}
+		},
+		ID:       func(e ExtendedNodeAttrGrant) string { return e.ID },
+		Meta:     func(e ExtendedNodeAttrGrant) common.EntryMeta { return e.EntryMeta },
+		Normalize: normalizeGrant,
+		Validate:  validateGrant,
+		Render:    func(e ExtendedNodeAttrGrant) interface{} { return convertRealGrantToDoc(e) },
+	}).Init(state)
 }
 
 // RegisterRoutes => sets up /nodeattrs endpoints
 //
 //   GET    /nodeattrs        => list all ExtendedNodeAttrGrant
 //   GET    /nodeattrs/:id    => get one by ID
+//   GET    /nodeattrs/by-slug/:slug => get one by slug
 //   POST   /nodeattrs        => create new nodeattr
 //   PUT    /nodeattrs        => update existing by ID
 //   DELETE /nodeattrs        => delete by ID
+//   POST   /nodeattrs/_delete => delete every grant matching a filter
 func RegisterRoutes(r *gin.Engine, state *common.State) {
+	store := newStore(state)
+
 	n := r.Group("/nodeattrs")
 	{
 		// List all
 		n.GET("", func(c *gin.Context) {
-			listNodeAttrs(c, state)
+			listNodeAttrs(c, store)
 		})
 		// Get one by ID
 		n.GET("/:id", func(c *gin.Context) {
-			getNodeAttrByID(c, state)
+			getNodeAttrByID(c, store)
+		})
+		// Get one by slug
+		n.GET("/by-slug/:slug", func(c *gin.Context) {
+			getNodeAttrBySlug(c, store)
 		})
 		// Create
 		n.POST("", func(c *gin.Context) {
-			createNodeAttr(c, state)
+			createNodeAttr(c, store)
 		})
 		// Update
 		n.PUT("", func(c *gin.Context) {
-			updateNodeAttr(c, state)
+			updateNodeAttr(c, store)
 		})
 		// Delete
 		n.DELETE("", func(c *gin.Context) {
-			deleteNodeAttr(c, state)
+			deleteNodeAttr(c, store)
+		})
+		// Delete by filter
+		n.POST("/_delete", func(c *gin.Context) {
+			deleteMatchingNodeAttrs(c, store)
 		})
 	}
 }
@@ -138,26 +197,18 @@ func RegisterRoutes(r *gin.Engine, state *common.State) {
 
 // listNodeAttrs => GET /nodeattrs => returns all ExtendedNodeAttrGrant
 // @Summary      List all node attribute grants
-// @Description  Returns the entire list of ExtendedNodeAttrGrant objects from state.
+// @Description  Returns the entire list of ExtendedNodeAttrGrant objects from state, optionally paginated.
 // @Tags         NodeAttrs
 // @Accept       json
 // @Produce      json
+// @Param        limit  query int false "Maximum number of entries to return"
+// @Param        offset query int false "Number of entries to skip"
 // @Success      200 {array}  ExtendedNodeAttrGrantDoc
+// @Failure      400 {object} ErrorResponse "Invalid pagination parameters"
 // @Failure      500 {object} ErrorResponse "Failed to parse node attributes"
 // @Router       /nodeattrs [get]
-func listNodeAttrs(c *gin.Context, state *common.State) {
-	grants, err := getNodeAttrsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse node attributes"})
-		return
-	}
-
-	// Convert actual ExtendedNodeAttrGrant to doc structs
-	docs := make([]ExtendedNodeAttrGrantDoc, 0, len(grants))
-	for _, realGrant := range grants {
-		docs = append(docs, convertRealGrantToDoc(realGrant))
-	}
-	c.JSON(http.StatusOK, docs)
+func listNodeAttrs(c *gin.Context, store *grantStore) {
+	store.List(c)
 }
 
 // getNodeAttrByID => GET /nodeattrs/:id
@@ -168,25 +219,26 @@ func listNodeAttrs(c *gin.Context, state *common.State) {
 // @Produce      json
 // @Param        id  path string true "NodeAttrGrant ID"
 // @Success      200 {object} ExtendedNodeAttrGrantDoc
-// @Failure      404 {object} ErrorResponse "No nodeattr found with that id"
+// @Failure      404 {object} ErrorResponse "Node attribute not found with that ID"
 // @Failure      500 {object} ErrorResponse "Failed to parse node attributes"
 // @Router       /nodeattrs/{id} [get]
-func getNodeAttrByID(c *gin.Context, state *common.State) {
-	id := c.Param("id")
-
-	grants, err := getNodeAttrsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse node attributes"})
-		return
-	}
+func getNodeAttrByID(c *gin.Context, store *grantStore) {
+	store.Get(c)
+}
 
-	for _, g := range grants {
-		if g.ID == id {
-			c.JSON(http.StatusOK, convertRealGrantToDoc(g))
-			return
-		}
-	}
-	c.JSON(http.StatusNotFound, gin.H{"error": "No nodeattr found with that id"})
+// getNodeAttrBySlug => GET /nodeattrs/by-slug/:slug
+// @Summary      Get one node attribute grant by slug
+// @Description  Retrieves a single node attribute grant by its slug, the unique name chosen for it.
+// @Tags         NodeAttrs
+// @Accept       json
+// @Produce      json
+// @Param        slug path      string true "Node attribute slug"
+// @Success      200  {object}  ExtendedNodeAttrGrantDoc
+// @Failure      404  {object}  ErrorResponse "Node attribute not found with that slug"
+// @Failure      500  {object}  ErrorResponse "Failed to parse node attributes"
+// @Router       /nodeattrs/by-slug/{slug} [get]
+func getNodeAttrBySlug(c *gin.Context, store *grantStore) {
+	store.GetBySlug(c)
 }
 
 // createNodeAttr => POST /nodeattrs
@@ -197,186 +249,101 @@ func getNodeAttrByID(c *gin.Context, state *common.State) {
 // @Produce      json
 // @Param        grant body NodeAttrGrantInputDoc true "NodeAttrGrant input"
 // @Success      201 {object} ExtendedNodeAttrGrantDoc
-// @Failure      400 {object} ErrorResponse "Either 'attr' or 'app' must be set, but not both"
+// @Failure      400 {object} ErrorResponse "Either 'attr' or 'app' must be set, but not both, or 'app' is invalid"
 // @Failure      500 {object} ErrorResponse "Failed to parse node attributes or save new grant"
 // @Router       /nodeattrs [post]
-func createNodeAttr(c *gin.Context, state *common.State) {
-	var input NodeAttrGrantInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// exactly one of attr or app
-	if !exactlyOneOfAttrOrApp(input) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Either `attr` or `app` must be set, but not both"})
-		return
-	}
-
-	// If using app, force target=["*"]
-	if len(input.App) > 0 {
-		input.Target = []string{"*"}
-	}
-
-	grants, err := getNodeAttrsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse node attributes"})
-		return
-	}
-
-	newGrant := ExtendedNodeAttrGrant{
-		ID: uuid.NewString(),
-		NodeAttrGrant: tsclient.NodeAttrGrant{
-			Target: input.Target,
-			Attr:   input.Attr,
-		},
-		App: convertAppConnectors(input.App),
-	}
-
-	grants = append(grants, newGrant)
-	if err := state.UpdateKeyAndSave("nodeAttrs", grants); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save node attribute"})
-		return
-	}
-	c.JSON(http.StatusCreated, convertRealGrantToDoc(newGrant))
+func createNodeAttr(c *gin.Context, store *grantStore) {
+	store.Create(c)
 }
 
 // updateNodeAttr => PUT /nodeattrs
 // @Summary      Update an existing node attribute grant
-// @Description  Updates a grant by ID. If `app` is set, `target` is forced to ["*"].
+// @Description  Updates a grant by ID. If `app` is set, `target` is forced to ["*"]. Honors If-Match.
 // @Tags         NodeAttrs
 // @Accept       json
 // @Produce      json
 // @Param        body body updateNodeAttrRequestDoc true "Update NodeAttr request"
 // @Success      200 {object} ExtendedNodeAttrGrantDoc
 // @Failure      400 {object} ErrorResponse "Invalid JSON or missing fields"
-// @Failure      404 {object} ErrorResponse "NodeAttr not found"
+// @Failure      404 {object} ErrorResponse "Node attribute not found with that ID"
+// @Failure      409 {object} ErrorResponse "Node attribute is managed by another source"
+// @Failure      412 {object} ErrorResponse "Node attribute has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to parse or update node attribute"
 // @Router       /nodeattrs [put]
-func updateNodeAttr(c *gin.Context, state *common.State) {
-	type updateRequest struct {
-		ID    string             `json:"id"`
-		Grant NodeAttrGrantInput `json:"grant"`
-	}
-	var req updateRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	if req.ID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'id' in request body"})
-		return
-	}
-	if !exactlyOneOfAttrOrApp(req.Grant) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Either `attr` or `app` must be set, but not both"})
-		return
-	}
-
-	grants, err := getNodeAttrsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse node attributes"})
-		return
-	}
-
-	// If app present => force target=["*"]
-	if len(req.Grant.App) > 0 {
-		req.Grant.Target = []string{"*"}
-	}
-
-	var updated *ExtendedNodeAttrGrant
-	for i := range grants {
-		if grants[i].ID == req.ID {
-			grants[i].Target = req.Grant.Target
-			grants[i].Attr = req.Grant.Attr
-			grants[i].App = convertAppConnectors(req.Grant.App)
-			updated = &grants[i]
-			break
-		}
-	}
-	if updated == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "NodeAttr not found with that id"})
-		return
-	}
-
-	if err := state.UpdateKeyAndSave("nodeAttrs", grants); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update node attribute"})
-		return
-	}
-	c.JSON(http.StatusOK, convertRealGrantToDoc(*updated))
+func updateNodeAttr(c *gin.Context, store *grantStore) {
+	store.Update(c)
 }
 
 // deleteNodeAttr => DELETE /nodeattrs
 // @Summary      Delete a node attribute grant
-// @Description  Deletes by specifying its ID in the request body.
+// @Description  Deletes by specifying its ID in the request body. Honors If-Match.
 // @Tags         NodeAttrs
 // @Accept       json
 // @Produce      json
 // @Param        body body deleteNodeAttrRequestDoc true "Delete NodeAttr request"
 // @Success      200 {object} map[string]string "Node attribute deleted"
 // @Failure      400 {object} ErrorResponse "Missing or invalid ID"
-// @Failure      404 {object} ErrorResponse "NodeAttr not found with that id"
+// @Failure      404 {object} ErrorResponse "Node attribute not found with that ID"
+// @Failure      409 {object} ErrorResponse "Node attribute is managed by another source"
+// @Failure      412 {object} ErrorResponse "Node attribute has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to delete node attribute"
 // @Router       /nodeattrs [delete]
-func deleteNodeAttr(c *gin.Context, state *common.State) {
-	type deleteRequest struct {
-		ID string `json:"id"`
-	}
-	var req deleteRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if req.ID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'id' field"})
-		return
-	}
-
-	grants, err := getNodeAttrsFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse node attributes"})
-		return
-	}
-
-	newList := make([]ExtendedNodeAttrGrant, 0, len(grants))
-	deleted := false
-	for _, g := range grants {
-		if g.ID == req.ID {
-			deleted = true
-			continue
-		}
-		newList = append(newList, g)
-	}
-	if !deleted {
-		c.JSON(http.StatusNotFound, gin.H{"error": "NodeAttr not found with that id"})
-		return
-	}
+func deleteNodeAttr(c *gin.Context, store *grantStore) {
+	store.Delete(c)
+}
 
-	if err := state.UpdateKeyAndSave("nodeAttrs", newList); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete node attribute"})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Node attribute deleted"})
+// deleteMatchingNodeAttrs => POST /nodeattrs/_delete
+// @Summary      Delete node attribute grants matching a filter
+// @Description  Lists the grants matching every given filter (usually "target") and, with "confirm": true, deletes them in one write.
+// @Tags         NodeAttrs
+// @Accept       json
+// @Produce      json
+// @Param        body body resource.FilteredDeleteRequest true "Filter"
+// @Success      200 {object} resource.BulkDeleteResponse
+// @Failure      400 {object} ErrorResponse "Missing or invalid filter"
+// @Failure      500 {object} ErrorResponse "Failed to delete node attributes"
+// @Router       /nodeattrs/_delete [post]
+func deleteMatchingNodeAttrs(c *gin.Context, store *grantStore) {
+	store.DeleteFiltered(c)
 }
 
 // -----------------------------------------------------------------------------
 // 4) Helper / Conversion Functions
 // -----------------------------------------------------------------------------
 
-func getNodeAttrsFromState(state *common.State) ([]ExtendedNodeAttrGrant, error) {
-	raw := state.GetValue("nodeAttrs")
-	if raw == nil {
-		return []ExtendedNodeAttrGrant{}, nil
+// normalizeGrant sorts and dedupes targets, attributes and app connectors.
+func normalizeGrant(in *NodeAttrGrantInput) {
+	in.Target = common.NormalizeList(in.Target)
+	in.Attr = common.NormalizeList(in.Attr)
+	for _, connectors := range in.App {
+		for i := range connectors {
+			connectors[i].Name = strings.TrimSpace(connectors[i].Name)
+			connectors[i].Connectors = common.NormalizeList(connectors[i].Connectors)
+			connectors[i].Domains = common.NormalizeList(connectors[i].Domains)
+		}
+	}
+}
+
+// validateGrant requires exactly one of attr or app, checks app against the
+// known capability schemas, and forces target to ["*"] for app grants.
+func validateGrant(in *NodeAttrGrantInput) error {
+	if !exactlyOneOfAttrOrApp(*in) {
+		return errors.New("Either `attr` or `app` must be set, but not both")
 	}
-	b, err := json.Marshal(raw)
-	if err != nil {
-		return nil, err
+	names := make([]string, 0, len(in.App))
+	for name := range in.App {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := appcap.Check(appcap.SectionNodeAttrs, name, in.App[name]); err != nil {
+			return err
+		}
 	}
-	var grants []ExtendedNodeAttrGrant
-	if err := json.Unmarshal(b, &grants); err != nil {
-		return nil, err
+	if len(in.App) > 0 {
+		in.Target = []string{"*"}
 	}
-	return grants, nil
+	return nil
 }
 
 func convertAppConnectors(in map[string][]AppConnectorInput) map[string][]AppConnectorInput {
@@ -409,10 +376,13 @@ func convertRealGrantToDoc(real ExtendedNodeAttrGrant) ExtendedNodeAttrGrantDoc
 	}
 
 	return ExtendedNodeAttrGrantDoc{
-		ID:     real.ID,
-		Target: real.Target,
-		Attr:   real.Attr,
-		App:    docApp,
+		ID:        real.ID,
+		Target:    real.Target,
+		Attr:      real.Attr,
+		App:       docApp,
+		Labels:    real.Labels,
+		Slug:      real.Slug,
+		EntryMeta: real.EntryMeta,
 	}
 }
 
@@ -1,6 +1,7 @@
 package postures
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
@@ -32,6 +33,8 @@ type Posture struct {
 	Name string `json:"name" binding:"required"`
 	// Rules is a list of string expressions describing posture requirements.
 	Rules []string `json:"rules"`
+	// CreatedBy/CreatedAt/UpdatedBy/UpdatedAt and ManagedBy are set by the server.
+	common.EntryMeta
 }
 
 // DeletePostureRequest is the shape of the JSON body for DELETE /postures.
@@ -55,6 +58,12 @@ type listAllResponse struct {
 	Items                []Posture `json:"items"`
 }
 
+// normalize trims the name and sorts and dedupes the rules.
+func (p *Posture) normalize() {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Rules = common.NormalizeList(p.Rules)
+}
+
 // RegisterRoutes wires up /postures, including:
 //   - Named posture CRUD
 //   - Default posture GET/PUT/DELETE at /postures/default
@@ -63,6 +72,8 @@ type listAllResponse struct {
 //   - "posture:<NAME>" => []string (the named posture rules)
 //   - "defaultSourcePosture" => []string (the global default posture rules)
 func RegisterRoutes(r *gin.Engine, state *common.State) {
+	byName := common.NewIndex(getPostures, func(e Posture) string { return e.Name }, "postures", common.SectionMetaKey("postures"))
+
 	p := r.Group("/postures")
 	{
 		// GET /postures => list all
@@ -76,7 +87,7 @@ func RegisterRoutes(r *gin.Engine, state *common.State) {
 			if name == "default" {
 				getDefaultPosture(c, state)
 			} else {
-				getPostureByName(c, state, name)
+				getPostureByName(c, state, byName, name)
 			}
 		})
 
@@ -128,7 +139,7 @@ func listAllPostures(c *gin.Context, state *common.State) {
 		return
 	}
 
-	c.JSON(http.StatusOK, listAllResponse{
+	common.RespondETag(c, http.StatusOK, listAllResponse{
 		DefaultSourcePosture: defaultPosture,
 		Items:                postures,
 	})
@@ -145,18 +156,16 @@ func listAllPostures(c *gin.Context, state *common.State) {
 // @Failure      404 {object} ErrorResponse "Posture not found"
 // @Failure      500 {object} ErrorResponse "Failed to parse or load postures"
 // @Router       /postures/{name} [get]
-func getPostureByName(c *gin.Context, state *common.State, name string) {
-	postures, _, err := getPosturesAndDefault(state)
+func getPostureByName(c *gin.Context, state *common.State, byName *common.Index[Posture], name string) {
+	entry, ok, err := byName.Get(state, name)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	for _, p := range postures {
-		if p.Name == name {
-			c.JSON(http.StatusOK, p)
-			return
-		}
+	if ok {
+		common.RespondETag(c, http.StatusOK, entry)
+		return
 	}
 	c.JSON(http.StatusNotFound, ErrorResponse{Error: "Posture not found"})
 }
@@ -179,6 +188,7 @@ func createPosture(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	newPosture.normalize()
 	if newPosture.Name == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'name' field"})
 		return
@@ -199,17 +209,18 @@ func createPosture(c *gin.Context, state *common.State) {
 	}
 
 	// Append & save
+	newPosture.EntryMeta = common.NewRequestMeta(c)
 	postures = append(postures, newPosture)
-	if err := savePosturesAndDefault(state, postures, defaultPosture); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save new posture"})
+	if err := savePosturesAndDefault(c.Request.Context(), state, postures, defaultPosture); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save new posture"})
 		return
 	}
-	c.JSON(http.StatusCreated, newPosture)
+	common.RespondETag(c, http.StatusCreated, newPosture)
 }
 
 // updatePosture => PUT /postures
 // @Summary      Update a posture
-// @Description  Updates the posture by matching on its name. Returns 404 if not found.
+// @Description  Updates the posture by matching on its name. Returns 404 if not found. Honors If-Match.
 // @Tags         Postures
 // @Accept       json
 // @Produce      json
@@ -217,6 +228,8 @@ func createPosture(c *gin.Context, state *common.State) {
 // @Success      200 {object} Posture
 // @Failure      400 {object} ErrorResponse "Missing fields"
 // @Failure      404 {object} ErrorResponse "Posture not found"
+// @Failure      409 {object} ErrorResponse "Posture is managed by another source"
+// @Failure      412 {object} ErrorResponse "Posture has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to update posture"
 // @Router       /postures [put]
 func updatePosture(c *gin.Context, state *common.State) {
@@ -225,6 +238,7 @@ func updatePosture(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	updated.normalize()
 	if updated.Name == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'name' field"})
 		return
@@ -239,6 +253,14 @@ func updatePosture(c *gin.Context, state *common.State) {
 	found := false
 	for i, p := range postures {
 		if p.Name == updated.Name {
+			if !state.IfMatch(c, "Posture", p) {
+				return
+			}
+			if err := state.CheckManaged(c, p.EntryMeta); err != nil {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "Posture is " + err.Error()})
+				return
+			}
+			updated.EntryMeta = p.EntryMeta.Touched(common.Actor(c))
 			postures[i] = updated
 			found = true
 			break
@@ -249,16 +271,16 @@ func updatePosture(c *gin.Context, state *common.State) {
 		return
 	}
 
-	if err := savePosturesAndDefault(state, postures, defaultPosture); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update posture"})
+	if err := savePosturesAndDefault(c.Request.Context(), state, postures, defaultPosture); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to update posture"})
 		return
 	}
-	c.JSON(http.StatusOK, updated)
+	common.RespondETag(c, http.StatusOK, updated)
 }
 
 // deletePosture => DELETE /postures
 // @Summary      Delete a posture
-// @Description  Deletes a named posture by JSON body. Expects { "name": "<postureName>" }.
+// @Description  Deletes a named posture by JSON body. Expects { "name": "<postureName>" }. Honors If-Match.
 // @Tags         Postures
 // @Accept       json
 // @Produce      json
@@ -266,6 +288,8 @@ func updatePosture(c *gin.Context, state *common.State) {
 // @Success      200 {object} map[string]string "Posture deleted"
 // @Failure      400 {object} ErrorResponse "Bad request or missing name"
 // @Failure      404 {object} ErrorResponse "Posture not found"
+// @Failure      409 {object} ErrorResponse "Posture is managed by another source"
+// @Failure      412 {object} ErrorResponse "Posture has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to save changes"
 // @Router       /postures [delete]
 func deletePosture(c *gin.Context, state *common.State) {
@@ -288,6 +312,13 @@ func deletePosture(c *gin.Context, state *common.State) {
 	found := false
 	for i, p := range postures {
 		if p.Name == req.Name {
+			if !state.IfMatch(c, "Posture", p) {
+				return
+			}
+			if err := state.CheckManaged(c, p.EntryMeta); err != nil {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "Posture is " + err.Error()})
+				return
+			}
 			postures = append(postures[:i], postures[i+1:]...)
 			found = true
 			break
@@ -298,8 +329,8 @@ func deletePosture(c *gin.Context, state *common.State) {
 		return
 	}
 
-	if err := savePosturesAndDefault(state, postures, defaultPosture); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save changes"})
+	if err := savePosturesAndDefault(c.Request.Context(), state, postures, defaultPosture); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save changes"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Posture deleted"})
@@ -320,18 +351,19 @@ func getDefaultPosture(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"defaultSourcePosture": defaultPosture})
+	common.RespondETag(c, http.StatusOK, gin.H{"defaultSourcePosture": defaultPosture})
 }
 
 // setDefaultPosture => PUT /postures/default
 // @Summary      Set the default posture
-// @Description  Overwrites the default posture with the given array of rules.
+// @Description  Overwrites the default posture with the given array of rules. Honors If-Match.
 // @Tags         Postures
 // @Accept       json
 // @Produce      json
 // @Param        body body DefaultPostureBody true "Default posture array"
 // @Success      200 {object} map[string][]string "defaultSourcePosture: updated array"
 // @Failure      400 {object} ErrorResponse "Bad request"
+// @Failure      412 {object} ErrorResponse "Default posture has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to set default posture"
 // @Router       /postures/default [put]
 func setDefaultPosture(c *gin.Context, state *common.State) {
@@ -340,38 +372,46 @@ func setDefaultPosture(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	body.DefaultSourcePosture = common.NormalizeList(body.DefaultSourcePosture)
 	dsp := body.DefaultSourcePosture
 
-	postures, _, err := getPosturesAndDefault(state)
+	postures, current, err := getPosturesAndDefault(state)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if !state.IfMatch(c, "Default posture", gin.H{"defaultSourcePosture": current}) {
+		return
+	}
 
-	if err := savePosturesAndDefault(state, postures, dsp); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to set default posture"})
+	if err := savePosturesAndDefault(c.Request.Context(), state, postures, dsp); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to set default posture"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"defaultSourcePosture": dsp})
+	common.RespondETag(c, http.StatusOK, gin.H{"defaultSourcePosture": dsp})
 }
 
 // deleteDefaultPosture => DELETE /postures/default
 // @Summary      Delete the default posture
-// @Description  Removes any default posture rules by setting them to nil.
+// @Description  Removes any default posture rules by setting them to nil. Honors If-Match.
 // @Tags         Postures
 // @Accept       json
 // @Produce      json
 // @Success      200 {object} map[string]string "defaultSourcePosture removed"
+// @Failure      412 {object} ErrorResponse "Default posture has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to delete default posture"
 // @Router       /postures/default [delete]
 func deleteDefaultPosture(c *gin.Context, state *common.State) {
-	postures, _, err := getPosturesAndDefault(state)
+	postures, current, err := getPosturesAndDefault(state)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if err := savePosturesAndDefault(state, postures, nil); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete default posture"})
+	if !state.IfMatch(c, "Default posture", gin.H{"defaultSourcePosture": current}) {
+		return
+	}
+	if err := savePosturesAndDefault(c.Request.Context(), state, postures, nil); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to delete default posture"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "defaultSourcePosture removed"})
@@ -399,6 +439,7 @@ func getPosturesAndDefault(state *common.State) (postureList []Posture, defaultP
 	}
 
 	// Convert map => postureList
+	meta := common.LoadSectionMeta(state, "postures")
 	var out []Posture
 	var dsp []string
 	for k, v := range rawMap {
@@ -409,16 +450,24 @@ func getPosturesAndDefault(state *common.State) (postureList []Posture, defaultP
 		// strip leading "posture:" if present
 		name := strings.TrimPrefix(k, "posture:")
 		out = append(out, Posture{
-			Name:  name,
-			Rules: v,
+			Name:      name,
+			Rules:     v,
+			EntryMeta: meta[name],
 		})
 	}
 	return out, dsp, nil
 }
 
+// getPostures => the named postures only, for the index
+func getPostures(state *common.State) ([]Posture, error) {
+	postures, _, err := getPosturesAndDefault(state)
+	return postures, err
+}
+
 // savePosturesAndDefault => convert postureList + default => map => write to state
-func savePosturesAndDefault(state *common.State, postures []Posture, defaultPosture []string) error {
+func savePosturesAndDefault(ctx context.Context, state *common.State, postures []Posture, defaultPosture []string) error {
 	m := make(map[string][]string)
+	meta := make(map[string]common.EntryMeta)
 
 	// Insert named postures
 	for _, p := range postures {
@@ -427,6 +476,7 @@ func savePosturesAndDefault(state *common.State, postures []Posture, defaultPost
 			key = "posture:" + key
 		}
 		m[key] = p.Rules
+		meta[strings.TrimPrefix(key, "posture:")] = p.EntryMeta
 	}
 
 	// Insert default posture if set
@@ -434,5 +484,8 @@ func savePosturesAndDefault(state *common.State, postures []Posture, defaultPost
 		m["defaultSourcePosture"] = defaultPosture
 	}
 
-	return state.UpdateKeyAndSave("postures", m)
+	return state.UpdateKeysAndSaveContext(ctx, map[string]interface{}{
+		"postures":                        m,
+		common.SectionMetaKey("postures"): meta,
+	})
 }
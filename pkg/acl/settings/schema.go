@@ -0,0 +1,125 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Field describes a setting TACL knows about.
+type Field struct {
+	// Name is the key in the policy file.
+	Name string `json:"name"`
+	// Type is the JSON type of the value: "bool" or "string".
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// Schema lists the settings TACL validates. Anything else Tailscale adds
+// to the top level of the policy file can still be set: it's kept in
+// Settings.Extra and passed through with a warning.
+var Schema = []Field{
+	{Name: "disableIPv4", Type: "bool", Description: "Stop assigning IPv4 addresses to devices"},
+	{Name: "oneCGNATRoute", Type: "string", Description: "How clients route the CGNAT range (100.64.0.0/10)"},
+	{Name: "randomizeClientPort", Type: "bool", Description: "Use a random UDP port for WireGuard instead of 41641"},
+}
+
+// policySections are top-level policy keys that hold sections rather than
+// settings, so they can't be set through /settings.
+var policySections = []string{
+	"acls", "aclTests", "autoApprovers", "derpMap", "grants", "groups", "hosts",
+	"ipsets", "nodeAttrs", "postures", "settings", "ssh", "sshTests", "tagOwners", "tests",
+}
+
+var extraName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// Known returns the schema of the named setting. Names are matched without
+// regard to case, as Tailscale does.
+func Known(name string) (Field, bool) {
+	for _, f := range Schema {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Validate checks the settings outside the schema. They must be plain
+// identifiers that don't name a policy section. Each one is accepted with
+// a warning, since TACL can't check its value.
+func (s Settings) Validate() (warnings []string, err error) {
+	names := make([]string, 0, len(s.Extra))
+	for k := range s.Extra {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		if err := CheckExtra(k); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, fmt.Sprintf("unknown setting %q is passed through to Tailscale unchecked", k))
+	}
+	return warnings, nil
+}
+
+// CheckExtra rejects a name that can't be a setting outside the schema.
+func CheckExtra(name string) error {
+	if !extraName.MatchString(name) {
+		return fmt.Errorf("invalid setting name %q", name)
+	}
+	for _, sec := range policySections {
+		if strings.EqualFold(name, sec) {
+			return fmt.Errorf("%q is a policy section, not a setting", name)
+		}
+	}
+	return nil
+}
+
+// settingsFields is Settings without its methods, for the default encoding.
+type settingsFields Settings
+
+// MarshalJSON writes the known settings and the extra ones side by side.
+func (s Settings) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(settingsFields(s))
+	if err != nil || len(s.Extra) == 0 {
+		return b, err
+	}
+	out := make(map[string]interface{}, len(s.Extra)+len(Schema))
+	for k, v := range s.Extra {
+		out[k] = v
+	}
+	var known map[string]interface{}
+	if err := json.Unmarshal(b, &known); err != nil {
+		return nil, err
+	}
+	for k, v := range known {
+		out[k] = v
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON reads the known settings into their fields and keeps the
+// rest in Extra.
+func (s *Settings) UnmarshalJSON(b []byte) error {
+	var fields settingsFields
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+	for k := range all {
+		if _, ok := Known(k); ok {
+			delete(all, k)
+		}
+	}
+	fields.Extra = nil
+	if len(all) > 0 {
+		fields.Extra = all
+	}
+	*s = Settings(fields)
+	return nil
+}
@@ -2,6 +2,7 @@ package settings
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -23,6 +24,9 @@ type Settings struct {
 	OneCGNATRoute string `json:"oneCGNATRoute,omitempty" hujson:"OneCGNATRoute,omitempty"`
 	// RandomizeClientPort indicates whether to use a random local port instead of a fixed one.
 	RandomizeClientPort bool `json:"randomizeClientPort,omitempty" hujson:"RandomizeClientPort,omitempty"`
+	// Extra holds settings outside the Schema, which are passed through to
+	// the policy file as they are. They're written next to the fields above.
+	Extra map[string]interface{} `json:"-" swaggerignore:"true"`
 }
 
 // RegisterRoutes wires up the single-resource Settings at /settings.
@@ -31,12 +35,16 @@ type Settings struct {
 //   POST   /settings => create new settings if none exist
 //   PUT    /settings => update existing settings
 //   DELETE /settings => remove the settings entirely
+//   GET    /settings/_schema => the settings TACL validates
 func RegisterRoutes(r *gin.Engine, state *common.State) {
 	s := r.Group("/settings")
 	{
 		s.GET("", func(c *gin.Context) {
 			getSettings(c, state)
 		})
+		s.GET("/_schema", func(c *gin.Context) {
+			c.JSON(http.StatusOK, Schema)
+		})
 		s.POST("", func(c *gin.Context) {
 			createSettings(c, state)
 		})
@@ -66,10 +74,10 @@ func getSettings(c *gin.Context, state *common.State) {
 	}
 	if cfg == nil {
 		// Return an empty struct if you prefer. Or 404 if you'd rather.
-		c.JSON(http.StatusOK, Settings{})
+		common.RespondETag(c, http.StatusOK, Settings{})
 		return
 	}
-	c.JSON(http.StatusOK, cfg)
+	common.RespondETag(c, http.StatusOK, cfg)
 }
 
 // createSettings => POST /settings
@@ -80,7 +88,7 @@ func getSettings(c *gin.Context, state *common.State) {
 // @Produce      json
 // @Param        settings body Settings true "Settings to create"
 // @Success      201 {object} Settings
-// @Failure      400 {object} ErrorResponse "Invalid JSON body"
+// @Failure      400 {object} ErrorResponse "Invalid JSON body or setting name"
 // @Failure      409 {object} ErrorResponse "Settings already exist"
 // @Failure      500 {object} ErrorResponse "Failed to check or save settings"
 // @Router       /settings [post]
@@ -90,6 +98,11 @@ func createSettings(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	warnings, err := newCfg.Validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 
 	existing, err := getSettingsFromState(state)
 	if err != nil {
@@ -101,23 +114,25 @@ func createSettings(c *gin.Context, state *common.State) {
 		return
 	}
 
-	if err := state.UpdateKeyAndSave("settings", newCfg); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save new settings"})
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), "settings", newCfg); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save new settings"})
 		return
 	}
-	c.JSON(http.StatusCreated, newCfg)
+	warn(c, warnings)
+	common.RespondETag(c, http.StatusCreated, newCfg)
 }
 
 // updateSettings => PUT /settings
 // @Summary      Update existing settings
-// @Description  Updates the current settings. Returns 404 if none exist.
+// @Description  Updates the current settings. Returns 404 if none exist. Honors If-Match.
 // @Tags         Settings
 // @Accept       json
 // @Produce      json
 // @Param        settings body Settings true "Updated settings"
 // @Success      200 {object} Settings
-// @Failure      400 {object} ErrorResponse "Invalid JSON body"
+// @Failure      400 {object} ErrorResponse "Invalid JSON body or setting name"
 // @Failure      404 {object} ErrorResponse "No existing settings to update"
+// @Failure      412 {object} ErrorResponse "Settings has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to update settings"
 // @Router       /settings [put]
 func updateSettings(c *gin.Context, state *common.State) {
@@ -126,6 +141,11 @@ func updateSettings(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	warnings, err := updated.Validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 
 	existing, err := getSettingsFromState(state)
 	if err != nil {
@@ -136,22 +156,27 @@ func updateSettings(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No existing settings to update"})
 		return
 	}
+	if !state.IfMatch(c, "Settings", existing) {
+		return
+	}
 
-	if err := state.UpdateKeyAndSave("settings", updated); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update settings"})
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), "settings", updated); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to update settings"})
 		return
 	}
-	c.JSON(http.StatusOK, updated)
+	warn(c, warnings)
+	common.RespondETag(c, http.StatusOK, updated)
 }
 
 // deleteSettings => DELETE /settings
 // @Summary      Delete settings
-// @Description  Removes the current settings if present; returns 404 if none exist.
+// @Description  Removes the current settings if present; returns 404 if none exist. Honors If-Match.
 // @Tags         Settings
 // @Accept       json
 // @Produce      json
 // @Success      200 {object} map[string]string "Settings deleted"
 // @Failure      404 {object} ErrorResponse "No existing settings found to delete"
+// @Failure      412 {object} ErrorResponse "Settings has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to delete settings"
 // @Router       /settings [delete]
 func deleteSettings(c *gin.Context, state *common.State) {
@@ -164,14 +189,24 @@ func deleteSettings(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No existing settings found to delete"})
 		return
 	}
+	if !state.IfMatch(c, "Settings", existing) {
+		return
+	}
 
-	if err := state.UpdateKeyAndSave("settings", nil); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete settings"})
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), "settings", nil); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to delete settings"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Settings deleted"})
 }
 
+// warn reports accepted-but-unchecked settings in Warning headers.
+func warn(c *gin.Context, warnings []string) {
+	for _, w := range warnings {
+		c.Writer.Header().Add("Warning", fmt.Sprintf("299 tacl %q", w))
+	}
+}
+
 // getSettingsFromState => re-marshal state.Data["settings"] to *Settings
 func getSettingsFromState(state *common.State) (*Settings, error) {
 	raw := state.GetValue("settings")
@@ -1,13 +1,13 @@
 package ssh
 
 import (
-	"encoding/json"
-	"net/http"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/resource"
 )
 
 // ErrorResponse helps standardize error JSON in swagger docs.
@@ -29,7 +29,18 @@ type ACLSSH struct {
 	// CheckPeriod is only meaningful if Action == "check" (e.g. "12h", "30m").
 	CheckPeriod string `json:"checkPeriod,omitempty"`
 	// AcceptEnv is a list of environment variables allowed to pass through the SSH session.
+	// Entries are variable names, optionally with "*" and "?" wildcards.
 	AcceptEnv []string `json:"acceptEnv,omitempty"`
+	// ExpiresAt/Disabled make the rule temporary; see common.Expiry.
+	common.Expiry
+	// Labels are TACL-only key/value pairs for filtering.
+	common.Labeled
+	// Slug names the rule in URLs, Terraform IDs and audit output.
+	common.Slugged
+	// Priority orders the rule in the synced policy; see common.Prioritized.
+	common.Prioritized
+	// Description explains the rule in the policy documentation.
+	common.Described
 }
 
 // ExtendedSSHEntry wraps ACLSSH with a stable unique ID.
@@ -38,6 +49,7 @@ type ExtendedSSHEntry struct {
 	// ID is a stable UUID for each SSH rule.
 	ID string `json:"id"`
 	ACLSSH
+	common.EntryMeta
 }
 
 // UpdateRequest represents the JSON body for PUT /ssh:
@@ -56,50 +68,112 @@ type DeleteRequest struct {
 	ID string `json:"id"`
 }
 
+// sshStore serves the "ssh" section.
+type sshStore = resource.Store[ACLSSH, ExtendedSSHEntry]
+
+func newStore(state *common.State, cfg Config) *sshStore {
+	return (&sshStore{
+		Section:   "ssh",
+		Noun:      "SSH rule",
+		Plural:    "SSH rules",
+		BodyField: "rule",
+		Build: func(id string, in ACLSSH, meta common.EntryMeta) ExtendedSSHEntry {
+			return ExtendedSSHEntry{ID: id, ACLSSH: in, EntryMeta: meta}
+		},
+		ID:       func(e ExtendedSSHEntry) string { return e.ID },
+		Meta:     func(e ExtendedSSHEntry) common.EntryMeta { return e.EntryMeta },
+		Normalize: normalizeRule,
+		Validate: func(rule *ACLSSH) error {
+			if err := validateRule(rule); err != nil {
+				return err
+			}
+			return cfg.checkUsers(rule)
+		},
+	}).Init(state)
+}
+
+// normalizeRule lowercases the action and sorts and dedupes the lists.
+func normalizeRule(rule *ACLSSH) {
+	rule.Action = common.NormalizeWord(rule.Action)
+	rule.CheckPeriod = strings.TrimSpace(rule.CheckPeriod)
+	rule.Src = common.NormalizeList(rule.Src)
+	rule.Dst = common.NormalizeList(rule.Dst)
+	rule.Users = common.NormalizeList(rule.Users)
+	rule.AcceptEnv = common.NormalizeList(rule.AcceptEnv)
+}
+
+// validateRule checks the action and, for "check" rules, the check period,
+// defaulting it to 12h like Tailscale does, and the expiry.
+func validateRule(rule *ACLSSH) error {
+	if rule.Action != "accept" && rule.Action != "check" {
+		return errors.New("Invalid action. Must be 'accept' or 'check'.")
+	}
+	if rule.Action == "check" {
+		if rule.CheckPeriod == "" {
+			rule.CheckPeriod = "12h"
+		}
+		if _, err := time.ParseDuration(rule.CheckPeriod); err != nil {
+			return errors.New("Invalid checkPeriod. Must be a valid duration (e.g. '12h', '30m').")
+		}
+	}
+	return rule.Expiry.Validate()
+}
+
 // RegisterRoutes wires up the SSH rules routes at /ssh.
 //
 //   GET     /ssh        => list all ExtendedSSHEntry
 //   GET     /ssh/:id    => get by ID
+//   GET     /ssh/by-slug/:slug => get by slug
 //   POST    /ssh        => create (auto-generate ID)
 //   PUT     /ssh        => update by ID in JSON
 //   DELETE  /ssh        => delete by ID in JSON
-func RegisterRoutes(r *gin.Engine, state *common.State) {
+//   POST    /ssh/_delete => delete every rule matching a filter
+//
+// Writes are checked against cfg, e.g. whether rules may log in as root.
+func RegisterRoutes(r *gin.Engine, state *common.State, cfg Config) {
+	store := newStore(state, cfg)
+
 	s := r.Group("/ssh")
 	{
 		s.GET("", func(c *gin.Context) {
-			listSSH(c, state)
+			listSSH(c, store)
 		})
 		s.GET("/:id", func(c *gin.Context) {
-			getSSHByID(c, state)
+			getSSHByID(c, store)
+		})
+
+		s.GET("/by-slug/:slug", func(c *gin.Context) {
+			getSSHBySlug(c, store)
 		})
 		s.POST("", func(c *gin.Context) {
-			createSSH(c, state)
+			createSSH(c, store)
 		})
 		s.PUT("", func(c *gin.Context) {
-			updateSSH(c, state)
+			updateSSH(c, store)
 		})
 		s.DELETE("", func(c *gin.Context) {
-			deleteSSH(c, state)
+			deleteSSH(c, store)
+		})
+		s.POST("/_delete", func(c *gin.Context) {
+			deleteMatchingSSH(c, store)
 		})
 	}
 }
 
 // listSSH => GET /ssh
 // @Summary      List all SSH rules
-// @Description  Returns the entire slice of ExtendedSSHEntry from state.
+// @Description  Returns the entire slice of ExtendedSSHEntry from state, optionally paginated.
 // @Tags         SSH
 // @Accept       json
 // @Produce      json
+// @Param        limit  query int false "Maximum number of entries to return"
+// @Param        offset query int false "Number of entries to skip"
 // @Success      200 {array}  ExtendedSSHEntry "List of SSH rules"
+// @Failure      400 {object} ErrorResponse    "Invalid pagination parameters"
 // @Failure      500 {object} ErrorResponse    "Failed to parse SSH rules"
 // @Router       /ssh [get]
-func listSSH(c *gin.Context, state *common.State) {
-	entries, err := getSSHFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse SSH rules"})
-		return
-	}
-	c.JSON(http.StatusOK, entries)
+func listSSH(c *gin.Context, store *sshStore) {
+	store.List(c)
 }
 
 // getSSHByID => GET /ssh/:id
@@ -113,22 +187,23 @@ func listSSH(c *gin.Context, state *common.State) {
 // @Failure      404 {object} ErrorResponse "SSH rule not found with that ID"
 // @Failure      500 {object} ErrorResponse "Failed to parse SSH rules"
 // @Router       /ssh/{id} [get]
-func getSSHByID(c *gin.Context, state *common.State) {
-	id := c.Param("id")
-
-	entries, err := getSSHFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse SSH rules"})
-		return
-	}
+func getSSHByID(c *gin.Context, store *sshStore) {
+	store.Get(c)
+}
 
-	for _, entry := range entries {
-		if entry.ID == id {
-			c.JSON(http.StatusOK, entry)
-			return
-		}
-	}
-	c.JSON(http.StatusNotFound, ErrorResponse{Error: "SSH rule not found with that ID"})
+// getSSHBySlug => GET /ssh/by-slug/:slug
+// @Summary      Get one SSH rule by slug
+// @Description  Retrieves a single SSH rule by its slug, the unique name chosen for it.
+// @Tags         SSH
+// @Accept       json
+// @Produce      json
+// @Param        slug path      string true "SSH rule slug"
+// @Success      200  {object}  ExtendedSSHEntry
+// @Failure      404  {object}  ErrorResponse "SSH rule not found with that slug"
+// @Failure      500  {object}  ErrorResponse "Failed to parse SSH rules"
+// @Router       /ssh/by-slug/{slug} [get]
+func getSSHBySlug(c *gin.Context, store *sshStore) {
+	store.GetBySlug(c)
 }
 
 // createSSH => POST /ssh
@@ -139,52 +214,16 @@ func getSSHByID(c *gin.Context, state *common.State) {
 // @Produce      json
 // @Param        rule body ACLSSH true "SSH rule fields"
 // @Success      201 {object} ExtendedSSHEntry
-// @Failure      400 {object} ErrorResponse "Invalid JSON or fields"
+// @Failure      400 {object} ErrorResponse "Invalid JSON or fields, e.g. an invalid user or acceptEnv pattern, or root without --ssh-allow-root"
 // @Failure      500 {object} ErrorResponse "Failed to parse or save SSH rules"
 // @Router       /ssh [post]
-func createSSH(c *gin.Context, state *common.State) {
-	var newRule ACLSSH
-	if err := c.ShouldBindJSON(&newRule); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
-
-	// Basic validation
-	if newRule.Action != "accept" && newRule.Action != "check" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid action. Must be 'accept' or 'check'."})
-		return
-	}
-	if newRule.Action == "check" && newRule.CheckPeriod != "" {
-		if _, err := time.ParseDuration(newRule.CheckPeriod); err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid checkPeriod. Must be a valid duration (e.g. '12h', '30m')."})
-			return
-		}
-	}
-
-	entries, err := getSSHFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse SSH rules"})
-		return
-	}
-
-	newEntry := ExtendedSSHEntry{
-		ID:     uuid.NewString(),
-		ACLSSH: newRule,
-	}
-
-	// Append to the "ssh" array
-	entries = append(entries, newEntry)
-
-	if err := state.UpdateKeyAndSave("ssh", entries); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save new SSH rule"})
-		return
-	}
-	c.JSON(http.StatusCreated, newEntry)
+func createSSH(c *gin.Context, store *sshStore) {
+	store.Create(c)
 }
 
 // updateSSH => PUT /ssh
 // @Summary      Update an existing SSH rule
-// @Description  User must provide JSON like { "id":"<uuid>", "rule": {...} } to replace the rule with matching ID.
+// @Description  User must provide JSON like { "id":"<uuid>", "rule": {...} } to replace the rule with matching ID. Honors If-Match.
 // @Tags         SSH
 // @Accept       json
 // @Produce      json
@@ -192,64 +231,17 @@ func createSSH(c *gin.Context, state *common.State) {
 // @Success      200 {object} ExtendedSSHEntry
 // @Failure      400 {object} ErrorResponse "Bad request or missing fields"
 // @Failure      404 {object} ErrorResponse "SSH rule not found with that ID"
+// @Failure      409 {object} ErrorResponse "SSH rule is managed by another source"
+// @Failure      412 {object} ErrorResponse "SSH rule has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to parse or update SSH rule"
 // @Router       /ssh [put]
-func updateSSH(c *gin.Context, state *common.State) {
-	var req UpdateRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
-	if req.ID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'id' field"})
-		return
-	}
-
-	// Basic validation on the new rule
-	if req.Rule.Action != "accept" && req.Rule.Action != "check" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid action. Must be 'accept' or 'check'."})
-		return
-	}
-	if req.Rule.Action == "check" {
-		// If no CheckPeriod is set, default to "12h"
-		if req.Rule.CheckPeriod == "" {
-			req.Rule.CheckPeriod = "12h"
-		}
-		if _, err := time.ParseDuration(req.Rule.CheckPeriod); err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid checkPeriod. Must be a valid duration."})
-			return
-		}
-	}
-
-	entries, err := getSSHFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse SSH rules"})
-		return
-	}
-
-	var updated *ExtendedSSHEntry
-	for i := range entries {
-		if entries[i].ID == req.ID {
-			entries[i].ACLSSH = req.Rule
-			updated = &entries[i]
-			break
-		}
-	}
-	if updated == nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "SSH rule not found with that ID"})
-		return
-	}
-
-	if err := state.UpdateKeyAndSave("ssh", entries); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update SSH rule"})
-		return
-	}
-	c.JSON(http.StatusOK, updated)
+func updateSSH(c *gin.Context, store *sshStore) {
+	store.Update(c)
 }
 
 // deleteSSH => DELETE /ssh
 // @Summary      Delete an SSH rule
-// @Description  User must provide JSON like { "id":"<uuid>" } to remove the rule with matching ID.
+// @Description  User must provide JSON like { "id":"<uuid>" } to remove the rule with matching ID. Honors If-Match.
 // @Tags         SSH
 // @Accept       json
 // @Produce      json
@@ -257,59 +249,25 @@ func updateSSH(c *gin.Context, state *common.State) {
 // @Success      200 {object} map[string]string "SSH rule deleted"
 // @Failure      400 {object} ErrorResponse "Missing or invalid ID"
 // @Failure      404 {object} ErrorResponse "SSH rule not found with that ID"
+// @Failure      409 {object} ErrorResponse "SSH rule is managed by another source"
+// @Failure      412 {object} ErrorResponse "SSH rule has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to delete SSH rule"
 // @Router       /ssh [delete]
-func deleteSSH(c *gin.Context, state *common.State) {
-	var req DeleteRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
-	if req.ID == "" {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'id' field"})
-		return
-	}
-
-	entries, err := getSSHFromState(state)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse SSH rules"})
-		return
-	}
-
-	newList := make([]ExtendedSSHEntry, 0, len(entries))
-	deleted := false
-	for _, e := range entries {
-		if e.ID == req.ID {
-			deleted = true
-			continue
-		}
-		newList = append(newList, e)
-	}
-	if !deleted {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "SSH rule not found with that ID"})
-		return
-	}
-
-	if err := state.UpdateKeyAndSave("ssh", newList); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete SSH rule"})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "SSH rule deleted"})
+func deleteSSH(c *gin.Context, store *sshStore) {
+	store.Delete(c)
 }
 
-// getSSHFromState => re-marshal state.Data["ssh"] into []ExtendedSSHEntry
-func getSSHFromState(state *common.State) ([]ExtendedSSHEntry, error) {
-	raw := state.GetValue("ssh")
-	if raw == nil {
-		return []ExtendedSSHEntry{}, nil
-	}
-	b, err := json.Marshal(raw)
-	if err != nil {
-		return nil, err
-	}
-	var entries []ExtendedSSHEntry
-	if err := json.Unmarshal(b, &entries); err != nil {
-		return nil, err
-	}
-	return entries, nil
+// deleteMatchingSSH => POST /ssh/_delete
+// @Summary      Delete SSH rules matching a filter
+// @Description  Lists the SSH rules matching every given filter and, with "confirm": true, deletes them in one write.
+// @Tags         SSH
+// @Accept       json
+// @Produce      json
+// @Param        body body resource.FilteredDeleteRequest true "Filter"
+// @Success      200 {object} resource.BulkDeleteResponse
+// @Failure      400 {object} ErrorResponse "Missing or invalid filter"
+// @Failure      500 {object} ErrorResponse "Failed to delete SSH rules"
+// @Router       /ssh/_delete [post]
+func deleteMatchingSSH(c *gin.Context, store *sshStore) {
+	store.DeleteFiltered(c)
 }
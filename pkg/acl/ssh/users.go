@@ -0,0 +1,103 @@
+package ssh
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Config holds server-side policy for SSH rules.
+type Config struct {
+	// AllowRoot lets rules list "root" (or "*", which includes it) in users.
+	AllowRoot bool
+}
+
+// NonRoot is the user autogroup for every local user except root.
+const NonRoot = "autogroup:nonroot"
+
+var (
+	// Environment variable names, with Tailscale's "*" and "?" wildcards
+	envPattern = regexp.MustCompile(`^[A-Za-z_*?][A-Za-z0-9_*?]*$`)
+	// Local user names as most Unix systems accept them
+	userName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,31}\$?$`)
+)
+
+// CheckAcceptEnv rejects an acceptEnv entry that isn't an environment
+// variable name or a pattern of one.
+func CheckAcceptEnv(pattern string) error {
+	if !envPattern.MatchString(pattern) {
+		return fmt.Errorf("invalid acceptEnv pattern %q: must be a variable name, optionally with '*' or '?' wildcards", pattern)
+	}
+	return nil
+}
+
+// CheckUser rejects an entry of users Tailscale wouldn't accept: anything
+// but a local user name, "*", autogroup:nonroot or "localpart:*@<domain>".
+func CheckUser(user string) error {
+	switch {
+	case user == "*" || user == NonRoot:
+		return nil
+	case strings.HasPrefix(user, "autogroup:"):
+		return fmt.Errorf("invalid user %q: the only user autogroup is %s", user, NonRoot)
+	case strings.HasPrefix(user, "localpart:"):
+		if domain, ok := strings.CutPrefix(user, "localpart:*@"); !ok || domain == "" || strings.ContainsAny(domain, "@*") {
+			return fmt.Errorf("invalid user %q: must be localpart:*@<domain>", user)
+		}
+		return nil
+	case !userName.MatchString(user):
+		return fmt.Errorf("invalid user %q", user)
+	}
+	return nil
+}
+
+// LogsInAsRoot reports whether users lets a rule log in as root. Neither
+// autogroup:nonroot nor localpart:* ever maps to root.
+func LogsInAsRoot(users []string) bool {
+	for _, u := range users {
+		if u == "root" || u == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Redundant returns the named users that autogroup:nonroot already covers,
+// if users includes it.
+func Redundant(users []string) []string {
+	nonRoot := false
+	for _, u := range users {
+		if u == NonRoot {
+			nonRoot = true
+		}
+	}
+	if !nonRoot {
+		return nil
+	}
+	var out []string
+	for _, u := range users {
+		if u != NonRoot && u != "root" && u != "*" && !strings.HasPrefix(u, "localpart:") {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// checkUsers validates a rule's users and acceptEnv against cfg. Disabled
+// rules grant nothing, so they may keep root: that's how rules written
+// before root was disallowed are turned off.
+func (cfg Config) checkUsers(rule *ACLSSH) error {
+	for _, u := range rule.Users {
+		if err := CheckUser(u); err != nil {
+			return err
+		}
+	}
+	if !cfg.AllowRoot && !rule.Disabled && LogsInAsRoot(rule.Users) {
+		return fmt.Errorf("SSH as root is not allowed on this server; use %s or named users", NonRoot)
+	}
+	for _, e := range rule.AcceptEnv {
+		if err := CheckAcceptEnv(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package tagowners
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
@@ -23,6 +24,8 @@ type TagOwner struct {
 	Name string `json:"name" binding:"required"`
 	// Owners is a list of owners for this tag.
 	Owners []string `json:"owners"`
+	// CreatedBy/CreatedAt/UpdatedBy/UpdatedAt and ManagedBy are set by the server.
+	common.EntryMeta
 }
 
 // deleteTagOwnerRequest is the body shape for DELETE /tagowners.
@@ -32,6 +35,12 @@ type deleteTagOwnerRequest struct {
 	Name string `json:"name"`
 }
 
+// normalize trims the name and sorts and dedupes the owners.
+func (t *TagOwner) normalize() {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Owners = common.NormalizeList(t.Owners)
+}
+
 // RegisterRoutes wires up /tagowners:
 //
 //   GET    /tagowners          => list all
@@ -40,13 +49,15 @@ type deleteTagOwnerRequest struct {
 //   PUT    /tagowners          => update
 //   DELETE /tagowners          => delete
 func RegisterRoutes(r *gin.Engine, state *common.State) {
+	byName := common.NewIndex(getTagOwnersFromState, func(e TagOwner) string { return e.Name }, "tagOwners", common.SectionMetaKey("tagOwners"))
+
 	t := r.Group("/tagowners")
 	{
 		t.GET("", func(c *gin.Context) {
-			listTagOwners(c, state)
+			listTagOwners(c, state, byName)
 		})
 		t.GET("/:name", func(c *gin.Context) {
-			getTagOwnerByName(c, state)
+			getTagOwnerByName(c, state, byName)
 		})
 		t.POST("", func(c *gin.Context) {
 			createTagOwner(c, state)
@@ -69,13 +80,13 @@ func RegisterRoutes(r *gin.Engine, state *common.State) {
 // @Success      200 {array}  TagOwner
 // @Failure      500 {object} ErrorResponse "Failed to parse tagOwners"
 // @Router       /tagOwners [get]
-func listTagOwners(c *gin.Context, state *common.State) {
-	tagOwners, err := getTagOwnersFromState(state)
+func listTagOwners(c *gin.Context, state *common.State, byName *common.Index[TagOwner]) {
+	tagOwners, err := byName.List(state)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse tagOwners"})
 		return
 	}
-	c.JSON(http.StatusOK, tagOwners)
+	common.RespondETag(c, http.StatusOK, tagOwners)
 }
 
 // getTagOwnerByName => GET /tagOwners/:name
@@ -89,20 +100,18 @@ func listTagOwners(c *gin.Context, state *common.State) {
 // @Failure      404 {object} ErrorResponse "TagOwner not found"
 // @Failure      500 {object} ErrorResponse "Failed to parse tagOwners"
 // @Router       /tagOwners/{name} [get]
-func getTagOwnerByName(c *gin.Context, state *common.State) {
+func getTagOwnerByName(c *gin.Context, state *common.State, byName *common.Index[TagOwner]) {
 	name := c.Param("name")
 
-	tagOwners, err := getTagOwnersFromState(state)
+	entry, ok, err := byName.Get(state, name)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse tagOwners"})
 		return
 	}
 
-	for _, t := range tagOwners {
-		if t.Name == name {
-			c.JSON(http.StatusOK, t)
-			return
-		}
+	if ok {
+		common.RespondETag(c, http.StatusOK, entry)
+		return
 	}
 	c.JSON(http.StatusNotFound, ErrorResponse{Error: "TagOwner not found"})
 }
@@ -125,6 +134,7 @@ func createTagOwner(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	newTag.normalize()
 	if newTag.Name == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'name' field"})
 		return
@@ -144,17 +154,18 @@ func createTagOwner(c *gin.Context, state *common.State) {
 		}
 	}
 
+	newTag.EntryMeta = common.NewRequestMeta(c)
 	tagOwners = append(tagOwners, newTag)
-	if err := saveTagOwners(state, tagOwners); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save new TagOwner"})
+	if err := saveTagOwners(c.Request.Context(), state, tagOwners); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save new TagOwner"})
 		return
 	}
-	c.JSON(http.StatusCreated, newTag)
+	common.RespondETag(c, http.StatusCreated, newTag)
 }
 
 // updateTagOwner => PUT /tagOwners
 // @Summary      Update a tag owner
-// @Description  Updates the TagOwner with a matching name. Expects JSON: { "name": "...", "owners": [...] }.
+// @Description  Updates the TagOwner with a matching name. Expects JSON: { "name": "...", "owners": [...] }. Honors If-Match.
 // @Tags         TagOwners
 // @Accept       json
 // @Produce      json
@@ -162,6 +173,8 @@ func createTagOwner(c *gin.Context, state *common.State) {
 // @Success      200 {object} TagOwner
 // @Failure      400 {object} ErrorResponse "Bad request or missing name"
 // @Failure      404 {object} ErrorResponse "TagOwner not found"
+// @Failure      409 {object} ErrorResponse "TagOwner is managed by another source"
+// @Failure      412 {object} ErrorResponse "TagOwner has changed since it was read"
 // @Failure      500 {object} ErrorResponse "Failed to parse or save changes"
 // @Router       /tagOwners [put]
 func updateTagOwner(c *gin.Context, state *common.State) {
@@ -170,6 +183,7 @@ func updateTagOwner(c *gin.Context, state *common.State) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	updated.normalize()
 	if updated.Name == "" {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'name' field"})
 		return
@@ -184,6 +198,14 @@ func updateTagOwner(c *gin.Context, state *common.State) {
 	found := false
 	for i, t := range tagOwners {
 		if t.Name == updated.Name {
+			if !state.IfMatch(c, "TagOwner", t) {
+				return
+			}
+			if err := state.CheckManaged(c, t.EntryMeta); err != nil {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "Tag owner is " + err.Error()})
+				return
+			}
+			updated.EntryMeta = t.EntryMeta.Touched(common.Actor(c))
 			tagOwners[i] = updated
 			found = true
 			break
@@ -194,16 +216,16 @@ func updateTagOwner(c *gin.Context, state *common.State) {
 		return
 	}
 
-	if err := saveTagOwners(state, tagOwners); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update TagOwner"})
+	if err := saveTagOwners(c.Request.Context(), state, tagOwners); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to update TagOwner"})
 		return
 	}
-	c.JSON(http.StatusOK, updated)
+	common.RespondETag(c, http.StatusOK, updated)
 }
 
 // deleteTagOwner => DELETE /tagowners
 // @Summary      Delete a tag owner
-// @Description  Expects JSON: { "name": "webserver" } to remove the matching TagOwner.
+// @Description  Expects JSON: { "name": "webserver" } to remove the matching TagOwner. Honors If-Match.
 // @Tags         TagOwners
 // @Accept       json
 // @Produce      json
@@ -211,6 +233,8 @@ func updateTagOwner(c *gin.Context, state *common.State) {
 // @Success      200 {object} map[string]string "TagOwner deleted"
 // @Failure      400 {object} ErrorResponse      "Bad request or missing name"
 // @Failure      404 {object} ErrorResponse      "TagOwner not found"
+// @Failure      409 {object} ErrorResponse      "TagOwner is managed by another source"
+// @Failure      412 {object} ErrorResponse      "TagOwner has changed since it was read"
 // @Failure      500 {object} ErrorResponse      "Failed to save changes"
 // @Router       /tagowners [delete]
 func deleteTagOwner(c *gin.Context, state *common.State) {
@@ -233,6 +257,13 @@ func deleteTagOwner(c *gin.Context, state *common.State) {
 	found := false
 	for i, t := range tagOwners {
 		if t.Name == req.Name {
+			if !state.IfMatch(c, "TagOwner", t) {
+				return
+			}
+			if err := state.CheckManaged(c, t.EntryMeta); err != nil {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "Tag owner is " + err.Error()})
+				return
+			}
 			tagOwners = append(tagOwners[:i], tagOwners[i+1:]...)
 			found = true
 			break
@@ -243,8 +274,8 @@ func deleteTagOwner(c *gin.Context, state *common.State) {
 		return
 	}
 
-	if err := saveTagOwners(state, tagOwners); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save changes"})
+	if err := saveTagOwners(c.Request.Context(), state, tagOwners); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save changes"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "TagOwner deleted"})
@@ -270,25 +301,32 @@ func getTagOwnersFromState(state *common.State) ([]TagOwner, error) {
 		return nil, err
 	}
 
+	meta := common.LoadSectionMeta(state, "tagOwners")
 	var out []TagOwner
 	for fullKey, owners := range rawMap {
 		name := strings.TrimPrefix(fullKey, "tag:")
 		out = append(out, TagOwner{
-			Name:   name,
-			Owners: owners,
+			Name:      name,
+			Owners:    owners,
+			EntryMeta: meta[name],
 		})
 	}
 	return out, nil
 }
 
-func saveTagOwners(state *common.State, tagOwners []TagOwner) error {
+func saveTagOwners(ctx context.Context, state *common.State, tagOwners []TagOwner) error {
 	m := make(map[string][]string)
+	meta := make(map[string]common.EntryMeta)
 	for _, t := range tagOwners {
 		fullKey := t.Name
 		if !strings.HasPrefix(fullKey, "tag:") {
 			fullKey = "tag:" + fullKey
 		}
 		m[fullKey] = t.Owners
+		meta[strings.TrimPrefix(fullKey, "tag:")] = t.EntryMeta
 	}
-	return state.UpdateKeyAndSave("tagOwners", m)
+	return state.UpdateKeysAndSaveContext(ctx, map[string]interface{}{
+		"tagOwners":                        m,
+		common.SectionMetaKey("tagOwners"): meta,
+	})
 }
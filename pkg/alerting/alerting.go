@@ -0,0 +1,148 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	gosync "sync"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// Alert statuses.
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Alert is a sync problem notification. Key is stable for the lifetime of
+// an incident so receivers can deduplicate and resolve it.
+type Alert struct {
+	Key     string    `json:"key"`
+	Status  string    `json:"status"`
+	Summary string    `json:"summary"`
+	Details string    `json:"details,omitempty"`
+	Tailnet string    `json:"tailnet,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Notifier delivers alerts to an external system.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, a Alert) error
+}
+
+// notifyTimeout bounds a single delivery.
+const notifyTimeout = 10 * time.Second
+
+// Manager turns sync results into alerts. It fires once when sync has failed
+// `threshold` times in a row, or immediately when Tailscale rejects the
+// policy, and sends a single resolve once a push succeeds again.
+type Manager struct {
+	notifiers []Notifier
+	threshold int
+	tailnet   string
+	logger    *zap.Logger
+
+	mu       gosync.Mutex
+	failures int // consecutive failed pushes
+	firing   *Alert
+	queue    chan Alert
+}
+
+// NewManager starts the delivery worker. Pass its SyncResult to sync.Syncer.Subscribe.
+func NewManager(notifiers []Notifier, threshold int, tailnet string, logger *zap.Logger) *Manager {
+	m := &Manager{
+		notifiers: notifiers,
+		threshold: threshold,
+		tailnet:   tailnet,
+		logger:    logger,
+		queue:     make(chan Alert, 16),
+	}
+	go m.run()
+	return m
+}
+
+// SyncResult updates the alert state for one push attempt.
+func (m *Manager) SyncResult(r sync.Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r.OK() {
+		m.failures = 0
+		if m.firing != nil {
+			resolved := *m.firing
+			resolved.Status = StatusResolved
+			resolved.Summary = "TACL sync to Tailscale recovered"
+			resolved.Details = ""
+			resolved.Time = r.Time
+			m.firing = nil
+			m.enqueue(resolved)
+		}
+		return
+	}
+
+	m.failures++
+	if m.firing != nil || (!r.Rejected && m.failures < m.threshold) {
+		return
+	}
+	summary := fmt.Sprintf("TACL sync to Tailscale failed %d times in a row", m.failures)
+	if r.Rejected {
+		summary = "Tailscale rejected the policy pushed by TACL"
+	}
+	a := Alert{
+		Key:     fmt.Sprintf("tacl-sync-%s-%d", m.tailnet, r.Time.Unix()),
+		Status:  StatusFiring,
+		Summary: summary,
+		Details: r.Error,
+		Tailnet: m.tailnet,
+		Time:    r.Time,
+	}
+	m.firing = &a
+	m.enqueue(a)
+}
+
+// Configure replaces the notifiers and failure threshold, e.g. on a config
+// reload. An alert that is already firing still gets its resolve.
+func (m *Manager) Configure(notifiers []Notifier, threshold int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifiers = notifiers
+	m.threshold = threshold
+}
+
+// Send delivers a one-off alert, such as an anomaly, that never resolves.
+func (m *Manager) Send(a Alert) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enqueue(a)
+}
+
+func (m *Manager) enqueue(a Alert) {
+	select {
+	case m.queue <- a:
+	default:
+		m.logger.Error("Alert queue full, dropping alert", zap.String("key", a.Key), zap.String("status", a.Status))
+	}
+}
+
+func (m *Manager) run() {
+	for a := range m.queue {
+		m.mu.Lock()
+		notifiers := m.notifiers
+		m.mu.Unlock()
+		for _, n := range notifiers {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			if err := n.Notify(ctx, a); err != nil {
+				m.logger.Error("Failed to send alert",
+					zap.String("notifier", n.Name()),
+					zap.String("key", a.Key),
+					zap.String("status", a.Status),
+					zap.Error(err),
+				)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Slack posts alerts to a Slack incoming webhook.
+type Slack struct {
+	WebhookURL string
+}
+
+// Name implements Notifier.
+func (s Slack) Name() string { return "slack" }
+
+// Notify implements Notifier.
+func (s Slack) Notify(ctx context.Context, a Alert) error {
+	icon := ":rotating_light:"
+	if a.Status == StatusResolved {
+		icon = ":white_check_mark:"
+	}
+	text := fmt.Sprintf("%s *%s*", icon, a.Summary)
+	if a.Tailnet != "" {
+		text += fmt.Sprintf(" (tailnet `%s`)", a.Tailnet)
+	}
+	if a.Details != "" {
+		text += "\n```" + a.Details + "```"
+	}
+	return postJSON(ctx, s.WebhookURL, map[string]string{"text": text})
+}
+
+// PagerDuty sends trigger and resolve events to the PagerDuty Events API v2,
+// using the alert key as dedup_key.
+type PagerDuty struct {
+	RoutingKey string
+}
+
+// Name implements Notifier.
+func (p PagerDuty) Name() string { return "pagerduty" }
+
+// Notify implements Notifier.
+func (p PagerDuty) Notify(ctx context.Context, a Alert) error {
+	event := map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    a.Key,
+	}
+	if a.Status == StatusResolved {
+		event["event_action"] = "resolve"
+	} else {
+		event["payload"] = map[string]interface{}{
+			"summary":   a.Summary,
+			"source":    "tacl",
+			"severity":  "error",
+			"timestamp": a.Time,
+			"custom_details": map[string]string{
+				"tailnet": a.Tailnet,
+				"error":   a.Details,
+			},
+		}
+	}
+	return postJSON(ctx, pagerDutyEventsURL, event)
+}
+
+// Webhook POSTs the Alert as JSON to an arbitrary URL.
+type Webhook struct {
+	URL string
+}
+
+// Name implements Notifier.
+func (w Webhook) Name() string { return "webhook" }
+
+// Notify implements Notifier.
+func (w Webhook) Notify(ctx context.Context, a Alert) error {
+	return postJSON(ctx, w.URL, a)
+}
+
+func postJSON(ctx context.Context, url string, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, msg)
+	}
+	return nil
+}
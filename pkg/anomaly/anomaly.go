@@ -0,0 +1,277 @@
+// Package anomaly watches how fast each identity changes the policy. When
+// one suddenly modifies or deletes a large part of it, as leaked automation
+// credentials might, the change is logged and alerted on and, optionally,
+// has to be confirmed.
+package anomaly
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/diff"
+	"go.uber.org/zap"
+)
+
+// ConfirmHeader confirms a change the detector would otherwise hold back,
+// when Config.Confirm is set. Its value must be "true".
+const ConfirmHeader = "X-Tacl-Confirm-Bulk"
+
+// Config tunes the detector.
+type Config struct {
+	// Fraction of the policy's entries one identity may change within
+	// Window before it's flagged; 0 turns detection off.
+	Fraction float64
+	Window   time.Duration
+	// MinEntries keeps small policies from being flagged for a handful of
+	// changes.
+	MinEntries int
+	// Confirm rejects flagged changes with 428 unless they carry
+	// ConfirmHeader.
+	Confirm bool
+}
+
+// Anomaly is a flagged burst of changes.
+type Anomaly struct {
+	Actor string `json:"actor"`
+	// Changed entries in the window, including the flagged request, out of
+	// Total entries in the policy.
+	Changed   int       `json:"changed"`
+	Total     int       `json:"total"`
+	Window    string    `json:"window"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Confirmed bool      `json:"confirmed,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+func (a Anomaly) String() string {
+	return fmt.Sprintf("%s changed %d of %d policy entries in %s", a.Actor, a.Changed, a.Total, a.Window)
+}
+
+// ConfirmResponse is returned with 428 for a change that needs confirming.
+type ConfirmResponse struct {
+	Error string `json:"error"`
+	Anomaly
+}
+
+// change is one recorded mutation.
+type change struct {
+	at      time.Time
+	changed int
+	total   int
+}
+
+// Detector keeps each identity's recent changes.
+type Detector struct {
+	cfg    Config
+	logger *zap.Logger
+
+	mu       gosync.Mutex
+	changes  map[string][]change
+	alerted  map[string]time.Time
+	handlers []func(Anomaly)
+
+	// Cached policy size, see total
+	totalCount   int
+	totalVersion uint64
+	totalCounted bool
+}
+
+// New returns a detector for cfg.
+func New(cfg Config, logger *zap.Logger) *Detector {
+	return &Detector{
+		cfg:     cfg,
+		logger:  logger,
+		changes: make(map[string][]change),
+		alerted: make(map[string]time.Time),
+	}
+}
+
+// OnAnomaly calls fn for each flagged burst, once per identity and window.
+// Call it before serving.
+func (d *Detector) OnAnomaly(fn func(Anomaly)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers = append(d.handlers, fn)
+}
+
+// Middleware measures every mutation by an authenticated identity. A
+// request that takes its identity over the threshold gets a Warning header,
+// or with Config.Confirm is reverted and answered with 428 unless it
+// carries ConfirmHeader. It must run inside common.SerializeMutations.
+// The server's own jobs aren't measured.
+func Middleware(state *common.State, d *Detector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d.cfg.Fraction <= 0 || !common.IsMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if _, internal := common.InternalIdentity(c.Request); internal {
+			c.Next()
+			return
+		}
+		keys := policyKeys()
+		if section, ok := common.SectionForResource(common.FirstPathSegment(c.Request.URL.Path)); ok {
+			keys = []string{section, common.SectionMetaKey(section)}
+		}
+		before := make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			before[key] = snapshot(state.GetValue(key))
+		}
+		total := d.total(state)
+
+		common.Hold(c, state, keys, d.logger, func() *common.Rejection {
+			after := make(map[string]interface{}, len(keys))
+			for _, key := range keys {
+				after[key] = state.GetValue(key)
+			}
+			changed := countChanges(diff.State(before, after))
+			if changed == 0 {
+				return nil
+			}
+			id, _ := common.GetIdentity(c)
+			confirmed := strings.EqualFold(c.GetHeader(ConfirmHeader), "true")
+			a, flagged := d.record(id.Caller(), changed, total, time.Now().UTC())
+			if !flagged {
+				return nil
+			}
+			a.Method, a.Path = c.Request.Method, c.Request.URL.Path
+			if d.cfg.Confirm && !confirmed {
+				d.forget(a.Actor)
+				d.logger.Warn("Held back an unusually large burst of changes", zap.String("anomaly", a.String()), zap.String("path", a.Path))
+				return &common.Rejection{
+					Status: http.StatusPreconditionRequired,
+					Body:   ConfirmResponse{Error: a.String() + "; resend with " + ConfirmHeader + ": true to confirm", Anomaly: a},
+					Reason: "needed confirming",
+				}
+			}
+			a.Confirmed = confirmed
+			c.Writer.Header().Add("Warning", fmt.Sprintf("299 tacl %q", a.String()))
+			d.flag(a)
+			return nil
+		})
+	}
+}
+
+// record adds a change by actor and reports whether its window is now over
+// the threshold.
+func (d *Detector) record(actor string, changed, total int, now time.Time) (Anomaly, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff := now.Add(-d.cfg.Window)
+	kept := d.changes[actor][:0]
+	for _, ch := range d.changes[actor] {
+		if ch.at.After(cutoff) {
+			kept = append(kept, ch)
+		}
+	}
+	kept = append(kept, change{at: now, changed: changed, total: total})
+	d.changes[actor] = kept
+
+	// Measure against the policy at its largest in the window, so deletions
+	// don't shrink the denominator
+	a := Anomaly{Actor: actor, Window: d.cfg.Window.String(), Time: now}
+	for _, ch := range kept {
+		a.Changed += ch.changed
+		if ch.total > a.Total {
+			a.Total = ch.total
+		}
+	}
+	if a.Changed < d.cfg.MinEntries || float64(a.Changed) < d.cfg.Fraction*float64(a.Total) {
+		return a, false
+	}
+	return a, true
+}
+
+// forget drops the last change recorded for actor, once it was reverted.
+func (d *Detector) forget(actor string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if n := len(d.changes[actor]); n > 0 {
+		d.changes[actor] = d.changes[actor][:n-1]
+	}
+}
+
+// flag logs a and, once per window and identity, notifies the handlers.
+func (d *Detector) flag(a Anomaly) {
+	d.logger.Warn("Unusually large burst of changes", zap.String("anomaly", a.String()),
+		zap.String("path", a.Path), zap.Bool("confirmed", a.Confirmed))
+
+	d.mu.Lock()
+	last, seen := d.alerted[a.Actor]
+	if seen && a.Time.Sub(last) < d.cfg.Window {
+		d.mu.Unlock()
+		return
+	}
+	d.alerted[a.Actor] = a.Time
+	handlers := d.handlers
+	d.mu.Unlock()
+	for _, fn := range handlers {
+		fn(a)
+	}
+}
+
+// policyKeys are the state keys of every resource module, with their
+// metadata.
+func policyKeys() []string {
+	var keys []string
+	for _, r := range common.Resources() {
+		section, _ := common.SectionForResource(r)
+		keys = append(keys, section, common.SectionMetaKey(section))
+	}
+	return keys
+}
+
+// total returns how many entries the policy holds: list items, map keys,
+// and one for any other value. It's only recounted after a write.
+func (d *Detector) total(state *common.State) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sections := make([]string, 0, len(common.Resources()))
+	for _, r := range common.Resources() {
+		section, _ := common.SectionForResource(r)
+		sections = append(sections, section)
+	}
+	if v := state.KeyVersion(sections...); v != d.totalVersion || !d.totalCounted {
+		d.totalCount = 0
+		for _, section := range sections {
+			d.totalCount += len(diff.Section(nil, state.GetValue(section)).Added)
+		}
+		d.totalVersion, d.totalCounted = v, true
+	}
+	return d.totalCount
+}
+
+// countChanges counts the entries a change added, removed or modified.
+// Metadata sections are left out: they change along with their entries.
+func countChanges(d map[string]diff.SectionDiff) int {
+	n := 0
+	for key, sd := range d {
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		n += len(sd.Added) + len(sd.Removed) + len(sd.Changed)
+	}
+	return n
+}
+
+// snapshot deep-copies a state value so later in-place edits don't affect it.
+func snapshot(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	_ = json.Unmarshal(b, &out)
+	return out
+}
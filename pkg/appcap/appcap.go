@@ -0,0 +1,222 @@
+// Package appcap validates Tailscale app capabilities: the "app" values of
+// grants and node attributes. Capabilities in the namespaces Tailscale
+// defines have a known payload, which is decoded strictly and checked,
+// rather than passed through as arbitrary JSON.
+package appcap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Sections an app capability can appear in.
+const (
+	SectionGrants    = "grants"
+	SectionNodeAttrs = "nodeAttrs"
+)
+
+// AppConnectors is the node attribute configuring app connectors.
+const AppConnectors = "tailscale.com/app-connectors"
+
+// ErrUnknown is returned for a capability in a Tailscale namespace that
+// isn't known here. It may be new, or misspelled.
+var ErrUnknown = errors.New("unknown Tailscale capability")
+
+// tailscaleDomains are the namespaces whose capabilities Tailscale defines.
+var tailscaleDomains = []string{"tailscale.com"}
+
+// schema describes one known capability.
+type schema struct {
+	sections []string
+	// check validates the JSON list of values granted.
+	check func(raw []byte) error
+}
+
+var schemas = map[string]schema{
+	AppConnectors: {
+		sections: []string{SectionNodeAttrs},
+		check:    strict(checkAppConnector),
+	},
+	"tailscale.com/cap/kubernetes": {
+		sections: []string{SectionGrants},
+		check:    strict(checkKubernetes),
+	},
+	"tailscale.com/cap/drive": {
+		sections: []string{SectionGrants},
+		check:    strict(checkDrive),
+	},
+}
+
+// Check validates the values granted for capability name in section. Known
+// capabilities must be valid there, and their values are checked against
+// the schema. A capability in a Tailscale namespace that isn't known
+// returns an error wrapping ErrUnknown; others are only checked for
+// the "<domain>/<name>" form.
+func Check(section, name string, values interface{}) error {
+	if err := CheckName(name); err != nil {
+		return err
+	}
+	s, ok := schemas[name]
+	if !ok {
+		if isTailscale(name) {
+			return fmt.Errorf("%w %q", ErrUnknown, name)
+		}
+		return nil
+	}
+	allowed := false
+	for _, sec := range s.sections {
+		allowed = allowed || sec == section
+	}
+	if !allowed {
+		return fmt.Errorf("%s can only be used in %s", name, strings.Join(s.sections, ", "))
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if err := s.check(raw); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+var domainLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// CheckName requires a capability name of the form "<domain>/<name>", e.g.
+// "example.com/cap/monitoring".
+func CheckName(name string) error {
+	domain, path, ok := strings.Cut(name, "/")
+	if !ok || path == "" || strings.ContainsAny(name, " \t\n") || !validDomain(domain, false) {
+		return fmt.Errorf("invalid capability name %q: must be <domain>/<name>, e.g. example.com/cap/monitoring", name)
+	}
+	return nil
+}
+
+func isTailscale(name string) bool {
+	domain, _, _ := strings.Cut(name, "/")
+	for _, d := range tailscaleDomains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// validDomain reports whether s is a domain name with at least two labels.
+// A leading "*." is allowed with wildcard.
+func validDomain(s string, wildcard bool) bool {
+	if wildcard {
+		s = strings.TrimPrefix(s, "*.")
+	}
+	labels := strings.Split(strings.ToLower(s), ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, l := range labels {
+		if len(l) > 63 || !domainLabel.MatchString(l) {
+			return false
+		}
+	}
+	return true
+}
+
+// strict decodes a list of values, rejecting unknown fields, and checks
+// each one.
+func strict[T any](check func(v T) error) func([]byte) error {
+	return func(raw []byte) error {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		var values []T
+		if err := dec.Decode(&values); err != nil {
+			return fmt.Errorf("unexpected shape: %v", err)
+		}
+		if len(values) == 0 {
+			return errors.New("at least one value is required")
+		}
+		for i, v := range values {
+			if err := check(v); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		return nil
+	}
+}
+
+// appConnector is a value of AppConnectors.
+type appConnector struct {
+	Name       string   `json:"name"`
+	Connectors []string `json:"connectors"`
+	Domains    []string `json:"domains"`
+}
+
+func checkAppConnector(v appConnector) error {
+	if strings.TrimSpace(v.Name) == "" {
+		return errors.New("name is required")
+	}
+	if len(v.Connectors) == 0 {
+		return errors.New("connectors is required")
+	}
+	for _, c := range v.Connectors {
+		if c != "*" && !strings.HasPrefix(c, "tag:") {
+			return fmt.Errorf("connector %q must be a tag or \"*\"", c)
+		}
+	}
+	if len(v.Domains) == 0 {
+		return errors.New("domains is required")
+	}
+	for _, d := range v.Domains {
+		if !validDomain(d, true) {
+			return fmt.Errorf("invalid domain %q", d)
+		}
+	}
+	return nil
+}
+
+// kubernetes is a value of tailscale.com/cap/kubernetes, read by the
+// Kubernetes operator's API server proxy.
+type kubernetes struct {
+	Impersonate *struct {
+		Groups []string `json:"groups,omitempty"`
+		Users  []string `json:"users,omitempty"`
+	} `json:"impersonate,omitempty"`
+	Recorder        []string `json:"recorder,omitempty"`
+	EnforceRecorder bool     `json:"enforceRecorder,omitempty"`
+}
+
+func checkKubernetes(v kubernetes) error {
+	if v.Impersonate == nil && len(v.Recorder) == 0 {
+		return errors.New("impersonate or recorder is required")
+	}
+	if v.Impersonate != nil && len(v.Impersonate.Groups) == 0 && len(v.Impersonate.Users) == 0 {
+		return errors.New("impersonate needs groups or users")
+	}
+	for _, r := range v.Recorder {
+		if !strings.HasPrefix(r, "tag:") {
+			return fmt.Errorf("recorder %q must be a tag", r)
+		}
+	}
+	if v.EnforceRecorder && len(v.Recorder) == 0 {
+		return errors.New("enforceRecorder needs a recorder")
+	}
+	return nil
+}
+
+// drive is a value of tailscale.com/cap/drive, for Taildrive shares.
+type drive struct {
+	Shares []string `json:"shares"`
+	Access string   `json:"access"`
+}
+
+func checkDrive(v drive) error {
+	if len(v.Shares) == 0 {
+		return errors.New("shares is required")
+	}
+	if v.Access != "ro" && v.Access != "rw" {
+		return fmt.Errorf("access must be \"ro\" or \"rw\", not %q", v.Access)
+	}
+	return nil
+}
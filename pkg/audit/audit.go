@@ -0,0 +1,330 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/diff"
+	"go.uber.org/zap"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Outcomes recorded on events.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomePending = "pending" // e.g. held for approval
+)
+
+// Event is a single audited mutation.
+type Event struct {
+	ID       string            `json:"id"`
+	Time     time.Time         `json:"time"`
+	Actor    string            `json:"actor"`
+	IP       string            `json:"ip,omitempty"`
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Resource string            `json:"resource"`
+	Status   int               `json:"status"`
+	Outcome  string            `json:"outcome"`
+	Diff     *diff.SectionDiff `json:"diff,omitempty"`
+	// Sections holds the diffs of a request outside the resource modules
+	// that changed policy sections, e.g. POST /import, by section.
+	Sections map[string]diff.SectionDiff `json:"sections,omitempty"`
+	// Via is the authenticated caller when it acted on behalf of Actor.
+	Via string `json:"via,omitempty"`
+}
+
+// Sink is an append-only destination for audit events.
+type Sink interface {
+	Write(e Event) error
+}
+
+// Log fans events out to its sinks and keeps the most recent ones in memory
+// for GET /audit.
+type Log struct {
+	mu     sync.RWMutex
+	events []Event
+	max    int
+
+	sinks  []Sink
+	logger *zap.Logger
+}
+
+// closer is implemented by sinks that buffer events, so shutdown can drain them.
+type closer interface {
+	Close(ctx context.Context) error
+}
+
+// reader is implemented by sinks that can replay previously written events.
+type reader interface {
+	ReadAll() ([]Event, error)
+}
+
+// New creates a Log retaining up to `max` events in memory. Sinks that can
+// be read back (e.g. files) are replayed so queries survive restarts.
+func New(max int, sinks []Sink, logger *zap.Logger) *Log {
+	l := &Log{max: max, sinks: sinks, logger: logger}
+	for _, s := range sinks {
+		r, ok := s.(reader)
+		if !ok {
+			continue
+		}
+		events, err := r.ReadAll()
+		if err != nil {
+			logger.Warn("Could not replay audit events", zap.Error(err))
+			continue
+		}
+		l.append(events...)
+	}
+	return l
+}
+
+// Close drains every sink that buffers events, returning the first error.
+func (l *Log) Close(ctx context.Context) error {
+	var first error
+	for _, s := range l.sinks {
+		if c, ok := s.(closer); ok {
+			if err := c.Close(ctx); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Record stores an event and writes it to every sink.
+func (l *Log) Record(e Event) {
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	l.append(e)
+	for _, s := range l.sinks {
+		if err := s.Write(e); err != nil {
+			l.logger.Error("Failed to write audit event", zap.String("id", e.ID), zap.Error(err))
+		}
+	}
+}
+
+func (l *Log) append(events ...Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, events...)
+	if l.max > 0 && len(l.events) > l.max {
+		l.events = append([]Event(nil), l.events[len(l.events)-l.max:]...)
+	}
+}
+
+// Query filters retained events. Zero-valued fields don't filter.
+type Query struct {
+	Since    time.Time
+	Until    time.Time
+	Actor    string
+	Resource string
+	Method   string
+	Outcome  string
+	// Key matches events whose diff has an entry with this key or slug,
+	// e.g. an ACL id or "group:eng".
+	Key   string
+	Limit int
+}
+
+// Query returns matching events, oldest first. With a Limit, the newest
+// `Limit` matches are returned.
+func (l *Log) Query(q Query) []Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	out := make([]Event, 0)
+	for _, e := range l.events {
+		if !q.Since.IsZero() && e.Time.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && e.Time.After(q.Until) {
+			continue
+		}
+		if q.Actor != "" && e.Actor != q.Actor {
+			continue
+		}
+		if q.Resource != "" && e.Resource != q.Resource {
+			continue
+		}
+		if q.Method != "" && !strings.EqualFold(e.Method, q.Method) {
+			continue
+		}
+		if q.Outcome != "" && e.Outcome != q.Outcome {
+			continue
+		}
+		if q.Key != "" && !e.touches(q.Key) {
+			continue
+		}
+		out = append(out, e)
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out
+}
+
+// touches reports whether the event's diffs have an entry with the given
+// key or slug.
+func (e Event) touches(key string) bool {
+	diffs := make([]diff.SectionDiff, 0, len(e.Sections)+1)
+	if e.Diff != nil {
+		diffs = append(diffs, *e.Diff)
+	}
+	for _, d := range e.Sections {
+		diffs = append(diffs, d)
+	}
+	for _, d := range diffs {
+		for _, changes := range [][]diff.Change{d.Added, d.Removed, d.Changed} {
+			for _, c := range changes {
+				if c.Key == key || c.Slug != "" && c.Slug == key {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Middleware records every mutating request with a before/after diff of the
+// section it touched, or of every policy section for requests outside the
+// resource modules. It must run inside common.SerializeMutations so the
+// snapshots aren't interleaved with other writes.
+func Middleware(l *Log, state *common.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !common.IsMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		resource := common.FirstPathSegment(c.Request.URL.Path)
+		section, isSection := common.SectionForResource(resource)
+		if resource == "scim" {
+			// SCIM provisioning writes the groups section
+			section, isSection = "groups", true
+		}
+		var before interface{}
+		var beforeAll map[string]interface{}
+		if isSection {
+			before = snapshot(state.GetValue(section))
+		} else {
+			beforeAll = policySnapshot(state)
+		}
+
+		c.Next()
+
+		id, _ := common.GetIdentity(c)
+		e := Event{
+			Actor:    id.Actor(),
+			IP:       id.IP,
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.RequestURI(),
+			Resource: resource,
+			Status:   c.Writer.Status(),
+			Outcome:  OutcomeSuccess,
+		}
+		switch {
+		case e.Status == http.StatusAccepted:
+			e.Outcome = OutcomePending
+		case e.Status >= 400:
+			e.Outcome = OutcomeFailure
+		}
+		if id.OnBehalfOf != "" {
+			e.Via = id.Caller()
+		}
+		switch {
+		case e.Outcome != OutcomeSuccess:
+		case isSection:
+			if d := diff.Section(before, state.GetValue(section)); !d.Empty() {
+				e.Diff = &d
+			}
+		default:
+			if d := diff.State(beforeAll, policySnapshot(state)); len(d) > 0 {
+				e.Sections = d
+			}
+		}
+		// An operation of a batch only happened if the whole batch is saved
+		common.AfterCommit(c.Request, func() { l.Record(e) })
+	}
+}
+
+// policySnapshot deep-copies the state without internal keys.
+func policySnapshot(state *common.State) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, v := range state.Snapshot() {
+		if !strings.HasPrefix(k, "_") {
+			out[k] = snapshot(v)
+		}
+	}
+	return out
+}
+
+// snapshot deep-copies a state value so later in-place edits don't affect it.
+func snapshot(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	_ = json.Unmarshal(b, &out)
+	return out
+}
+
+// RegisterRoutes wires up GET /audit.
+//
+//	GET /audit?since=<RFC3339>&until=<RFC3339>&actor=<name>&resource=<acls>&method=<DELETE>&outcome=<failure>&key=<group:eng>&limit=<n>
+func RegisterRoutes(r *gin.Engine, l *Log) {
+	r.GET("/audit", func(c *gin.Context) {
+		queryAudit(c, l)
+	})
+}
+
+// queryAudit => GET /audit
+func queryAudit(c *gin.Context, l *Log) {
+	var q Query
+	var err error
+	if v := c.Query("since"); v != "" {
+		if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid 'since', must be RFC3339"})
+			return
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if q.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid 'until', must be RFC3339"})
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid 'limit'"})
+			return
+		}
+	}
+	q.Actor = c.Query("actor")
+	q.Resource = c.Query("resource")
+	q.Method = c.Query("method")
+	q.Outcome = c.Query("outcome")
+	q.Key = c.Query("key")
+	c.JSON(http.StatusOK, l.Query(q))
+}
@@ -0,0 +1,198 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ParseSinks builds sinks from specs like "stdout", "file:///var/log/tacl-audit.jsonl"
+// or "https://audit.example.com/ingest".
+func ParseSinks(specs []string, logger *zap.Logger) ([]Sink, error) {
+	var sinks []Sink
+	for _, spec := range specs {
+		switch {
+		case spec == "stdout":
+			sinks = append(sinks, &writerSink{w: os.Stdout})
+		case strings.HasPrefix(spec, "file://"):
+			sinks = append(sinks, &FileSink{Path: strings.TrimPrefix(spec, "file://")})
+		case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+			sinks = append(sinks, NewWebhookSink(spec, logger))
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q (must be stdout, file:// or http(s)://)", spec)
+		}
+	}
+	return sinks, nil
+}
+
+// writerSink writes one JSON object per line.
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *writerSink) Write(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// FileSink appends events as JSON lines to a file, which is also replayed on startup.
+type FileSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// Write appends e to the file, creating it if needed.
+func (s *FileSink) Write(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// ReadAll returns every event in the file. A missing file is not an error.
+func (s *FileSink) ReadAll() ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []Event
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue // skip a torn final line
+		}
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
+
+// WebhookSink POSTs each event as JSON from a background worker, so a slow
+// receiver never blocks API requests.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+	queue  chan Event
+	logger *zap.Logger
+
+	pending sync.WaitGroup
+}
+
+// webhookQueueSize bounds how many events may wait for delivery.
+const webhookQueueSize = 1000
+
+// NewWebhookSink starts a delivery worker for url.
+func NewWebhookSink(url string, logger *zap.Logger) *WebhookSink {
+	s := &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan Event, webhookQueueSize),
+		logger: logger,
+	}
+	go s.run()
+	return s
+}
+
+// Write enqueues e for delivery, failing if the queue is full.
+func (s *WebhookSink) Write(e Event) error {
+	s.pending.Add(1)
+	select {
+	case s.queue <- e:
+		return nil
+	default:
+		s.pending.Done()
+		return fmt.Errorf("audit webhook queue full, dropping event")
+	}
+}
+
+// Close waits for queued events to be delivered, or for ctx to be done.
+func (s *WebhookSink) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("audit webhook %s: events still pending: %w", s.url, ctx.Err())
+	}
+}
+
+func (s *WebhookSink) run() {
+	for e := range s.queue {
+		s.deliver(e)
+		s.pending.Done()
+	}
+}
+
+func (s *WebhookSink) deliver(e Event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		if err = s.post(b); err == nil {
+			return
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+	s.logger.Error("Failed to deliver audit event to webhook",
+		zap.String("id", e.ID), zap.String("url", s.url), zap.Error(err))
+}
+
+func (s *WebhookSink) post(body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
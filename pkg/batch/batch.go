@@ -0,0 +1,175 @@
+// Package batch applies several changes, to any resources, as one. POST
+// /batch runs its operations in order through the API, with the same
+// capability checks, validation and audit as when they're sent one by
+// one, and saves them together in one write. If any of them fails, none
+// of them are applied.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Operation is one API call of a batch, as it would be sent on its own.
+//
+// Example JSON: { "method": "DELETE", "path": "/hosts", "body": { "name": "old-db" } }
+type Operation struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	// IfMatch, if set, is sent as the operation's If-Match header.
+	IfMatch string `json:"ifMatch,omitempty"`
+}
+
+// Request is the body of POST /batch.
+type Request struct {
+	Operations []Operation `json:"operations"`
+}
+
+// Result is what one operation answered.
+type Result struct {
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Response is the body of POST /batch: the results of the operations, in
+// order. If one fails, Failed is its index, Error says why, and the
+// results stop there.
+type Response struct {
+	Error   string   `json:"error,omitempty"`
+	Failed  *int     `json:"failed,omitempty"`
+	Results []Result `json:"results"`
+}
+
+// errOperationFailed abandons a batch whose operation failed.
+var errOperationFailed = errors.New("operation failed")
+
+// RegisterRoutes wires up POST /batch. Operations are dispatched to r, so
+// it must have every route registered before the first batch arrives.
+func RegisterRoutes(r *gin.Engine, state *common.State) {
+	handler := sync.OnceValue(func() http.Handler { return common.CanonicalPaths(r) })
+	r.POST("/batch", func(c *gin.Context) {
+		applyBatch(c, handler(), state)
+	})
+}
+
+// applyBatch => POST /batch
+func applyBatch(c *gin.Context, handler http.Handler, state *common.State) {
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if len(req.Operations) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "'operations' must list at least one operation"})
+		return
+	}
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		op.Method = strings.ToUpper(op.Method)
+		if !common.IsMutatingMethod(op.Method) || !strings.HasPrefix(op.Path, "/") {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Operation %d: 'method' (POST, PUT, PATCH or DELETE) and 'path' are required", i)})
+			return
+		}
+		if common.FirstPathSegment(op.Path) == "batch" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Operation %d: batches can't be nested", i)})
+			return
+		}
+	}
+
+	// SerializeMutations holds the mutation lock for the whole batch, since
+	// /batch isn't a resource module
+	ctx, commit := common.BatchContext(c.Request.Context())
+	res := Response{Results: make([]Result, 0, len(req.Operations))}
+	status := http.StatusOK
+	err := state.Batch(func() error {
+		for i, op := range req.Operations {
+			opReq, err := operationRequest(ctx, c.Request, op)
+			if err != nil {
+				status = http.StatusBadRequest
+				res.Failed, res.Error = &i, fmt.Sprintf("Operation %d: invalid 'path'", i)
+				return errOperationFailed
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, opReq)
+
+			result := Result{Status: rec.Code}
+			if b := bytes.TrimSpace(rec.Body.Bytes()); json.Valid(b) {
+				result.Response = json.RawMessage(b)
+			}
+			res.Results = append(res.Results, result)
+			if rec.Code < 200 || rec.Code > 299 {
+				status = rec.Code
+				res.Failed, res.Error = &i, failure(i, op, rec.Code, result.Response)
+				return errOperationFailed
+			}
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errOperationFailed):
+		c.JSON(status, res)
+		return
+	case err != nil:
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save batch"})
+		return
+	}
+
+	// The operations' audit events, and the history they feed, go out
+	// together too
+	_ = state.Batch(func() error {
+		commit()
+		return nil
+	})
+	c.JSON(http.StatusOK, res)
+}
+
+// operationRequest builds the request for op. It's a copy of the batch
+// request with op's method, path and body, so the operation is
+// authenticated and authorized as if the caller had sent it on its own.
+func operationRequest(ctx context.Context, batch *http.Request, op Operation) (*http.Request, error) {
+	u, err := url.ParseRequestURI(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	req := batch.Clone(ctx)
+	req.Method = op.Method
+	req.URL = u
+	req.RequestURI = u.RequestURI()
+	req.Body = io.NopCloser(bytes.NewReader(op.Body))
+	req.ContentLength = int64(len(op.Body))
+	req.Header.Del("Content-Length")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Del("If-Match")
+	if op.IfMatch != "" {
+		req.Header.Set("If-Match", op.IfMatch)
+	}
+	return req, nil
+}
+
+// failure describes why operation i failed, with the error it answered.
+func failure(i int, op Operation, status int, response json.RawMessage) string {
+	msg := fmt.Sprintf("Operation %d (%s %s) failed with %d, so none were applied", i, op.Method, op.Path, status)
+	var e ErrorResponse
+	if json.Unmarshal(response, &e) == nil && e.Error != "" {
+		msg += ": " + e.Error
+	}
+	return msg
+}
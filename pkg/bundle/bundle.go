@@ -0,0 +1,259 @@
+// Package bundle packages a TACL state into a signed, optionally encrypted
+// file, for moving policies between environments that can't reach each
+// other (e.g. into an air-gapped network). The receiving side verifies the
+// signature against a trusted public key before anything is imported.
+package bundle
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Format identifies the bundle layout.
+const Format = "tacl-bundle/v1"
+
+// EncryptionAES256GCM is the only encryption supported: AES-256-GCM with
+// a key derived from a passphrase by scrypt.
+const EncryptionAES256GCM = "aes-256-gcm+scrypt"
+
+// Bundle is the file written by Seal. Manifest is kept as written rather
+// than decoded, so fields added by newer versions still verify. The
+// signature covers its compact form, so reformatting the file is harmless.
+type Bundle struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Payload   []byte          `json:"payload"`
+	Signature []byte          `json:"signature"`
+}
+
+// Manifest describes the state in a bundle.
+type Manifest struct {
+	Format string `json:"format"`
+	// Version of TACL that wrote the bundle.
+	Version   string    `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// SHA256 and Size are of the state JSON, before any encryption.
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+	// KeyID is the fingerprint of the signing key, see KeyID.
+	KeyID      string      `json:"keyId"`
+	Encryption *Encryption `json:"encryption,omitempty"`
+}
+
+// Encryption holds the parameters needed to decrypt the payload.
+type Encryption struct {
+	Algorithm string `json:"algorithm"`
+	Salt      []byte `json:"salt"`
+	Nonce     []byte `json:"nonce"`
+}
+
+// Errors returned by Open.
+var (
+	ErrUntrusted   = errors.New("bundle is not signed by a trusted key")
+	ErrPassphrase  = errors.New("bundle is encrypted and no passphrase was given")
+	ErrCorrupt     = errors.New("bundle contents don't match its manifest")
+	ErrWrongFormat = errors.New("not a " + Format + " bundle")
+)
+
+// scrypt parameters for deriving the AES key
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Seal bundles state, a JSON document, signed with key. A non-empty
+// passphrase encrypts the state.
+func Seal(state []byte, version string, key ed25519.PrivateKey, passphrase string) ([]byte, error) {
+	sum := sha256.Sum256(state)
+	m := Manifest{
+		Format:    Format,
+		Version:   version,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      len(state),
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+	}
+	payload := state
+	if passphrase != "" {
+		enc := &Encryption{Algorithm: EncryptionAES256GCM, Salt: make([]byte, 16)}
+		if _, err := rand.Read(enc.Salt); err != nil {
+			return nil, err
+		}
+		aead, err := newAEAD(passphrase, enc.Salt)
+		if err != nil {
+			return nil, err
+		}
+		enc.Nonce = make([]byte, aead.NonceSize())
+		if _, err := rand.Read(enc.Nonce); err != nil {
+			return nil, err
+		}
+		payload = aead.Seal(nil, enc.Nonce, state, []byte(Format))
+		m.Encryption = enc
+	}
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	b := Bundle{Manifest: manifest, Payload: payload, Signature: ed25519.Sign(key, signedBytes(manifest, payload))}
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// Open verifies a bundle against the trusted keys and returns its manifest
+// and state. The passphrase is needed for encrypted bundles.
+func Open(raw []byte, trusted []ed25519.PublicKey, passphrase string) (Manifest, []byte, error) {
+	var b Bundle
+	if err := json.Unmarshal(raw, &b); err != nil || len(b.Manifest) == 0 {
+		return Manifest{}, nil, ErrWrongFormat
+	}
+	var m Manifest
+	if err := json.Unmarshal(b.Manifest, &m); err != nil || m.Format != Format {
+		return Manifest{}, nil, ErrWrongFormat
+	}
+	var manifest bytes.Buffer
+	if err := json.Compact(&manifest, b.Manifest); err != nil {
+		return Manifest{}, nil, ErrWrongFormat
+	}
+	signed := signedBytes(manifest.Bytes(), b.Payload)
+	verified := false
+	for _, pub := range trusted {
+		if ed25519.Verify(pub, signed, b.Signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return m, nil, ErrUntrusted
+	}
+
+	state := b.Payload
+	if m.Encryption != nil {
+		if m.Encryption.Algorithm != EncryptionAES256GCM {
+			return m, nil, fmt.Errorf("unsupported bundle encryption %q", m.Encryption.Algorithm)
+		}
+		if passphrase == "" {
+			return m, nil, ErrPassphrase
+		}
+		aead, err := newAEAD(passphrase, m.Encryption.Salt)
+		if err != nil {
+			return m, nil, err
+		}
+		if len(m.Encryption.Nonce) != aead.NonceSize() {
+			return m, nil, ErrCorrupt
+		}
+		state, err = aead.Open(nil, m.Encryption.Nonce, b.Payload, []byte(Format))
+		if err != nil {
+			return m, nil, errors.New("can't decrypt bundle: wrong passphrase")
+		}
+	}
+	sum := sha256.Sum256(state)
+	if hex.EncodeToString(sum[:]) != m.SHA256 || len(state) != m.Size {
+		return m, nil, ErrCorrupt
+	}
+	return m, state, nil
+}
+
+// signedBytes is what the signature covers: the compact manifest and
+// the payload, each length-prefixed so neither can bleed into the other.
+func signedBytes(manifest, payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(Format)
+	fmt.Fprintf(&buf, "\n%d\n", len(manifest))
+	buf.Write(manifest)
+	fmt.Fprintf(&buf, "\n%d\n", len(payload))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// KeyID returns a short fingerprint of a public key: the first 16 hex
+// digits of its SHA-256.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// GenerateKey returns a new signing key pair, PEM-encoded: the private
+// key as PKCS #8 and the public key as PKIX.
+func GenerateKey() (private, public []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), nil
+}
+
+// ParsePrivateKey parses a PEM-encoded Ed25519 private key, as written by
+// GenerateKey or openssl genpkey -algorithm ed25519.
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 private key")
+	}
+	return priv, nil
+}
+
+// ParsePublicKeys parses one or more PEM-encoded Ed25519 public keys.
+func ParsePublicKeys(data []byte) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("not an Ed25519 public key")
+		}
+		keys = append(keys, pub)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM public keys found")
+	}
+	return keys, nil
+}
@@ -0,0 +1,96 @@
+package cap
+
+import (
+	"strings"
+	"sync"
+
+	"tailscale.com/client/tailscale/apitype"
+)
+
+// AccessList is a server-side backstop applied after the WhoIs lookup and
+// before capability checks. It lets operators restrict the API to specific
+// identities regardless of how broad the capability grants in the policy are.
+//
+// Entries may be:
+//   - a user login name, e.g. "alice@example.com"
+//   - a node tag, e.g. "tag:ci"
+//   - a TACL group, e.g. "group:netops", expanded via GroupMembers
+//
+// Deny always wins. If Allow is non-empty, callers must match at least one entry.
+type AccessList struct {
+	Allow []string
+	Deny  []string
+
+	// GroupMembers resolves "group:<name>" entries. It may be nil, in which
+	// case group entries never match.
+	GroupMembers func(name string) []string
+
+	mu sync.RWMutex
+}
+
+// Set replaces the allow and deny entries, e.g. on a config reload.
+func (a *AccessList) Set(allow, deny []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Allow, a.Deny = allow, deny
+}
+
+// Permits reports whether the caller described by `who` passes the list.
+// A nil AccessList permits everyone.
+func (a *AccessList) Permits(who *apitype.WhoIsResponse) bool {
+	if a == nil {
+		return true
+	}
+	a.mu.RLock()
+	allow, deny := a.Allow, a.Deny
+	a.mu.RUnlock()
+
+	login, tags := identityOf(who)
+	if a.matchesAny(deny, login, tags) {
+		return false
+	}
+	if len(allow) == 0 {
+		return true
+	}
+	return a.matchesAny(allow, login, tags)
+}
+
+func (a *AccessList) matchesAny(entries []string, login string, tags []string) bool {
+	for _, e := range entries {
+		switch {
+		case strings.HasPrefix(e, "tag:"):
+			if stringInSlice(e, tags) {
+				return true
+			}
+		case strings.HasPrefix(e, "group:"):
+			if a.GroupMembers == nil {
+				continue
+			}
+			for _, m := range a.GroupMembers(strings.TrimPrefix(e, "group:")) {
+				if (login != "" && strings.EqualFold(m, login)) || stringInSlice(m, tags) {
+					return true
+				}
+			}
+		default:
+			if login != "" && strings.EqualFold(e, login) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// identityOf extracts the login name and node tags from a WhoIs response.
+// Tagged nodes don't act as a user, so login is empty for them.
+func identityOf(who *apitype.WhoIsResponse) (login string, tags []string) {
+	if who == nil {
+		return "", nil
+	}
+	if who.Node != nil {
+		tags = who.Node.Tags
+	}
+	if who.UserProfile != nil && len(tags) == 0 {
+		login = who.UserProfile.LoginName
+	}
+	return login, tags
+}
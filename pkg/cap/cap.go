@@ -1,26 +1,75 @@
 package cap
 
 import (
-	"context"
 	"encoding/json"
 	"net"
 	"net/http"
 	"strings"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
 	"go.uber.org/zap"
 	"tailscale.com/tsnet"
 )
 
 // TACLManagerCapability is our sub-capability shape:
 //
-//	"manager": { "methods": [...], "endpoints": [...] }
+//	"manager": { "methods": [...], "endpoints": [...], "scopes": [...], "role": "...", "deny": [...] }
 //
 // If "methods" is ["*"], it means all methods are allowed.
 // If "endpoints" is ["*"], it means all endpoints are allowed.
+//
+// "scopes" is the finer-grained alternative, a list of "<resource>:<verb>"
+// patterns such as "acls:write", "groups:read" or "*:read". The verb is
+// "read" for GET/HEAD/OPTIONS and "write" for everything else; "write"
+// implies "read". Either side may be "*", and a bare "*" grants everything.
+//
+// "role" is a shortcut for a common set of scopes: "reader", "editor" or
+// "admin" (see the Role constants). An unknown role grants nothing.
+//
+// "deny" uses the same pattern syntax and always wins: a request matching a
+// deny pattern in any sub-capability is rejected even if another grants it.
+//
+// The "impersonate" scope lets the caller name the actor of its requests
+// with common.OnBehalfOfHeader. Neither "*" nor any role grants it; it must
+// be listed itself.
 type TACLManagerCapability struct {
 	Methods   []string `json:"methods"`
 	Endpoints []string `json:"endpoints"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	Deny      []string `json:"deny,omitempty"`
+}
+
+// Roles a sub-capability can grant.
+const (
+	// RoleReader reads every resource except the admin ones.
+	RoleReader = "reader"
+	// RoleEditor reads and changes every resource except the admin ones.
+	RoleEditor = "editor"
+	// RoleAdmin may do anything, like "*".
+	RoleAdmin = "admin"
+)
+
+// AdminResources are only granted by RoleAdmin or explicit scopes. They
+// expose secrets or change how TACL itself behaves, rather than the policy.
+var AdminResources = []string{"audit", "debug", "readonly", "scim", "standby", "webhooks"}
+
+// ScopeImpersonate allows setting common.OnBehalfOfHeader.
+const ScopeImpersonate = "impersonate"
+
+const (
+	// ScopeRead is the verb required by non-mutating requests.
+	ScopeRead = "read"
+	// ScopeWrite is the verb required by mutating requests. It implies ScopeRead.
+	ScopeWrite = "write"
+)
+
+// actionScopes maps "METHOD /path" to a dedicated scope for endpoints whose
+// effect isn't a plain read or write of their resource.
+var actionScopes = map[string]string{
+	"POST /sync": "sync:trigger",
 }
 
 // TACLAppCapabilities represents the JSON shape in "lbrlabs.com/cap/tacl", e.g.:
@@ -36,8 +85,36 @@ type TACLAppCapabilities []map[string]TACLManagerCapability
 // the "lbrlabs.com/cap/tacl" -> "manager" capability with the
 // correct Method + Endpoint. Otherwise, we return JSON with a
 // "permission denied" error message.
-func TailscaleAuthMiddleware(tsServer *tsnet.Server, logger *zap.Logger) gin.HandlerFunc {
+//
+// If access is non-nil, callers must also pass its allow/deny lists.
+func TailscaleAuthMiddleware(tsServer *tsnet.Server, access *AccessList, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Requests on the local or Funnel listeners were already filtered by
+		// LocalListenerMiddleware / FunnelMiddleware and carry no tailnet identity.
+		// Token-authenticated requests already carry their identity
+		if tokenAuthenticated(c) {
+			id, _ := common.GetIdentity(c)
+			if setOnBehalfOf(c, &id, false, logger) {
+				c.Next()
+			}
+			return
+		}
+		// Requests the server dispatches to itself carry a trusted identity
+		if id, ok := common.InternalIdentity(c.Request); ok {
+			common.SetIdentity(c, id)
+			c.Next()
+			return
+		}
+
+		if kind := listenerKind(c.Request); kind != "" {
+			ip, _, _ := net.SplitHostPort(c.Request.RemoteAddr)
+			id := common.Identity{NodeName: kind, IP: ip}
+			if setOnBehalfOf(c, &id, false, logger) {
+				c.Next()
+			}
+			return
+		}
+
 		ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
 		if err != nil {
 			logger.Warn("Failed to parse IP from RemoteAddr", zap.String("RemoteAddr", c.Request.RemoteAddr))
@@ -52,7 +129,7 @@ func TailscaleAuthMiddleware(tsServer *tsnet.Server, logger *zap.Logger) gin.Han
 			return
 		}
 
-		st, err := lc.WhoIs(context.Background(), ip)
+		st, err := lc.WhoIs(c.Request.Context(), ip)
 		if err != nil {
 			logger.Warn("WhoIs lookup failed", zap.String("ip", ip), zap.Error(err))
 			abortWithJSON(c, http.StatusUnauthorized, "permission denied, whois lookup failed")
@@ -74,6 +151,16 @@ func TailscaleAuthMiddleware(tsServer *tsnet.Server, logger *zap.Logger) gin.Han
 			zap.String("url", c.Request.URL.Path),
 		)
 
+		// Server-side allow/deny lists apply before any capability grant
+		if !access.Permits(st) {
+			logger.Warn("Rejected by server access list",
+				zap.String("ip", ip),
+				zap.String("userLoginName", userLoginName),
+			)
+			abortWithJSON(c, http.StatusForbidden, "permission denied by server access list")
+			return
+		}
+
 		// We expect "lbrlabs.com/cap/tacl"
 		rawCap, ok := st.CapMap["lbrlabs.com/cap/tacl"]
 		if !ok {
@@ -104,34 +191,190 @@ func TailscaleAuthMiddleware(tsServer *tsnet.Server, logger *zap.Logger) gin.Han
 		// Check for manager sub-cap
 		method := c.Request.Method
 		endpointFirstSegment := firstPathSegment(c.Request.URL.Path)
-		allowed := false
-
-		for _, subcapMap := range appCaps {
-			if managerCap, haveManager := subcapMap["manager"]; haveManager {
-				// If managerCap.Methods includes "*", all methods are allowed.
-				// If managerCap.Endpoints includes "*", all endpoints are allowed.
-				if matchStringListOrWildcard(method, managerCap.Methods) &&
-					matchStringListOrWildcard(endpointFirstSegment, managerCap.Endpoints) {
-					allowed = true
-					break
-				}
-			}
-		}
+		scope := RequiredScope(method, c.Request.URL.Path)
 
+		allowed := appCaps.Allows(method, c.Request.URL.Path)
+		if fromMethod, fromPath, ok := common.Delegation(c.Request); ok && !allowed {
+			// Dispatched by a handler the caller may use, e.g. an access request
+			allowed = appCaps.Allows(fromMethod, fromPath) && !appCaps.Denies(scope)
+		}
 		if !allowed {
 			logger.Warn("Not authorized by TACL 'manager' capability",
 				zap.String("ip", ip),
 				zap.String("userLoginName", userLoginName),
 				zap.String("method", method),
 				zap.String("endpoint", endpointFirstSegment),
+				zap.String("scope", scope),
 			)
 			abortWithJSON(c, http.StatusUnauthorized, "permission denied, please check tailscale capabilities")
 			return
 		}
 
-		// Success!
-		c.Next()
+		// Success! Make the caller available to downstream handlers
+		id := common.Identity{LoginName: userLoginName, IP: ip}
+		if st.Node != nil {
+			id.NodeName = st.Node.ComputedName
+			if id.NodeName == "" {
+				id.NodeName = strings.TrimSuffix(st.Node.Name, ".")
+			}
+			id.Tags = st.Node.Tags
+			if len(id.Tags) > 0 {
+				// Tagged nodes don't act on behalf of the user who created them
+				id.LoginName = ""
+			}
+		}
+		common.SetAuthorizer(c, appCaps.Allows)
+		if setOnBehalfOf(c, &id, appCaps.MayImpersonate(), logger) {
+			c.Next()
+		}
+	}
+}
+
+// setOnBehalfOf records id for the request, with the actor it names in
+// common.OnBehalfOfHeader if it has one. It aborts the request and returns
+// false if the header is set but the caller may not impersonate, or its
+// value is invalid.
+func setOnBehalfOf(c *gin.Context, id *common.Identity, allowed bool, logger *zap.Logger) bool {
+	actor := strings.TrimSpace(c.GetHeader(common.OnBehalfOfHeader))
+	if actor != "" {
+		if !allowed {
+			logger.Warn("Rejected impersonation without the impersonate scope",
+				zap.String("caller", id.Caller()),
+				zap.String("onBehalfOf", actor),
+			)
+			abortWithJSON(c, http.StatusForbidden, "permission denied, "+common.OnBehalfOfHeader+" needs the "+ScopeImpersonate+" scope")
+			return false
+		}
+		if len(actor) > maxActorLength || strings.IndexFunc(actor, unicode.IsControl) >= 0 {
+			abortWithJSON(c, http.StatusBadRequest, "invalid "+common.OnBehalfOfHeader+" header")
+			return false
+		}
+		logger.Info("Request on behalf of another actor",
+			zap.String("caller", id.Caller()),
+			zap.String("onBehalfOf", actor),
+		)
+		id.OnBehalfOf = actor
 	}
+	common.SetIdentity(c, *id)
+	return true
+}
+
+// maxActorLength is the longest actor common.OnBehalfOfHeader may name.
+const maxActorLength = 256
+
+// MayImpersonate reports whether any "manager" sub-capability lists
+// ScopeImpersonate and none denies it.
+func (caps TACLAppCapabilities) MayImpersonate() bool {
+	allowed := false
+	for _, subcapMap := range caps {
+		managerCap, haveManager := subcapMap["manager"]
+		if !haveManager {
+			continue
+		}
+		for _, d := range managerCap.Deny {
+			if d == "*" || strings.EqualFold(d, ScopeImpersonate) {
+				return false
+			}
+		}
+		for _, s := range managerCap.Scopes {
+			if strings.EqualFold(s, ScopeImpersonate) {
+				allowed = true
+			}
+		}
+	}
+	return allowed
+}
+
+// Allows reports whether any "manager" sub-capability grants the request and
+// none of them denies it.
+func (caps TACLAppCapabilities) Allows(method, path string) bool {
+	endpoint := firstPathSegment(path)
+	scope := RequiredScope(method, path)
+
+	if caps.Denies(scope) {
+		return false
+	}
+	allowed := false
+	for _, subcapMap := range caps {
+		managerCap, haveManager := subcapMap["manager"]
+		if !haveManager {
+			continue
+		}
+		// If managerCap.Methods includes "*", all methods are allowed.
+		// If managerCap.Endpoints includes "*", all endpoints are allowed.
+		if matchStringListOrWildcard(method, managerCap.Methods) &&
+			matchStringListOrWildcard(endpoint, managerCap.Endpoints) {
+			allowed = true
+		}
+		if matchAnyScope(scope, managerCap.Scopes) || roleAllows(managerCap.Role, scope) {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// Denies reports whether any "manager" sub-capability denies scope.
+func (caps TACLAppCapabilities) Denies(scope string) bool {
+	for _, subcapMap := range caps {
+		if managerCap, ok := subcapMap["manager"]; ok && matchAnyScope(scope, managerCap.Deny) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiredScope returns the "<resource>:<verb>" scope a request needs.
+func RequiredScope(method, path string) string {
+	if s, ok := actionScopes[method+" "+strings.TrimSuffix(path, "/")]; ok {
+		return s
+	}
+	verb := ScopeWrite
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		verb = ScopeRead
+	}
+	return strings.ToLower(firstPathSegment(path)) + ":" + verb
+}
+
+// roleAllows reports whether role grants scope.
+func roleAllows(role, scope string) bool {
+	res, verb, _ := strings.Cut(scope, ":")
+	switch strings.ToLower(role) {
+	case RoleAdmin:
+		return true
+	case RoleEditor:
+		return !stringInSlice(res, AdminResources)
+	case RoleReader:
+		return verb == ScopeRead && !stringInSlice(res, AdminResources)
+	}
+	return false
+}
+
+// matchAnyScope returns true if any pattern in `patterns` covers `scope`.
+func matchAnyScope(scope string, patterns []string) bool {
+	for _, p := range patterns {
+		if matchScope(scope, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchScope checks a single "<resource>:<verb>" pattern against a scope.
+// A "write" pattern also covers the corresponding "read" scope.
+func matchScope(scope, pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	wantRes, wantVerb, _ := strings.Cut(scope, ":")
+	res, verb, ok := strings.Cut(strings.ToLower(pattern), ":")
+	if !ok {
+		return false
+	}
+	if res != "*" && res != wantRes {
+		return false
+	}
+	return verb == "*" || verb == wantVerb || (verb == ScopeWrite && wantVerb == ScopeRead)
 }
 
 // matchStringListOrWildcard returns true if `list` has "*"
@@ -162,10 +405,5 @@ func stringInSlice(needle string, haystack []string) bool {
 }
 
 func firstPathSegment(path string) string {
-	path = strings.TrimPrefix(path, "/")
-	if path == "" {
-		return "" // e.g. root "/"
-	}
-	parts := strings.Split(path, "/")
-	return parts[0]
+	return common.FirstPathSegment(path)
 }
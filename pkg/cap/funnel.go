@@ -0,0 +1,67 @@
+package cap
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// FunnelListenerContext marks ctx as belonging to the public Funnel
+// listener. It's meant for http.Server.BaseContext.
+func FunnelListenerContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, listenerKindKey{}, listenerFunnel)
+}
+
+// IsFunnelRequest reports whether the request arrived over Tailscale Funnel.
+func IsFunnelRequest(r *http.Request) bool {
+	return listenerKind(r) == listenerFunnel
+}
+
+// FunnelMiddleware guards requests arriving over Funnel (i.e. from the public
+// internet). Only GET/HEAD requests to the given first path segments are
+// served, and every endpoint except "healthz" requires
+// "Authorization: Bearer <token>". Mutating endpoints are never reachable
+// this way. Tailnet requests pass through untouched.
+func FunnelMiddleware(endpoints []string, token string, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsFunnelRequest(c.Request) || tokenAuthenticated(c) {
+			c.Next()
+			return
+		}
+
+		segment := firstPathSegment(c.Request.URL.Path)
+		method := c.Request.Method
+		if (method != http.MethodGet && method != http.MethodHead) ||
+			!matchStringListOrWildcard(segment, endpoints) {
+			abortWithJSON(c, http.StatusNotFound, "not found")
+			return
+		}
+
+		if segment != "healthz" && !validBearerToken(c.GetHeader("Authorization"), token) {
+			logger.Warn("Rejected Funnel request with missing or invalid token",
+				zap.String("remoteAddr", c.Request.RemoteAddr),
+				zap.String("url", c.Request.URL.Path),
+			)
+			abortWithJSON(c, http.StatusUnauthorized, "permission denied, invalid token")
+			return
+		}
+		c.Next()
+	}
+}
+
+// validBearerToken compares an Authorization header against the expected token
+// in constant time. An empty expected token never matches.
+func validBearerToken(header, token string) bool {
+	if token == "" {
+		return false
+	}
+	got, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
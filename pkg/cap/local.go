@@ -0,0 +1,71 @@
+package cap
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type listenerKindKey struct{}
+
+const (
+	listenerLocal  = "local"
+	listenerFunnel = "funnel"
+)
+
+// LocalListenerContext marks ctx as belonging to the plain TCP (non-tsnet)
+// listener. It's meant for http.Server.BaseContext.
+func LocalListenerContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, listenerKindKey{}, listenerLocal)
+}
+
+// IsLocalRequest reports whether the request arrived on the local listener.
+func IsLocalRequest(r *http.Request) bool {
+	return listenerKind(r) == listenerLocal
+}
+
+// listenerKind returns which non-tailnet listener served r, or "" for the
+// regular tsnet listeners.
+func listenerKind(r *http.Request) string {
+	v, _ := r.Context().Value(listenerKindKey{}).(string)
+	return v
+}
+
+// LocalListenerMiddleware restricts requests on the local listener to the
+// given first path segments (e.g. ["healthz", "metrics"]); "*" exposes the
+// whole API. Local callers have no Tailscale identity, so anything allowed
+// here bypasses the capability check. Tailnet requests pass through untouched.
+func LocalListenerMiddleware(endpoints []string, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsLocalRequest(c.Request) || tokenAuthenticated(c) {
+			c.Next()
+			return
+		}
+		segment := firstPathSegment(c.Request.URL.Path)
+		if !matchStringListOrWildcard(segment, endpoints) {
+			logger.Debug("Endpoint not exposed on local listener",
+				zap.String("remoteAddr", c.Request.RemoteAddr),
+				zap.String("url", c.Request.URL.Path),
+			)
+			abortWithJSON(c, http.StatusNotFound, "not found")
+			return
+		}
+		c.Next()
+	}
+}
+
+// ParseList splits a comma-separated flag value into trimmed, non-empty
+// items. Surrounding slashes are dropped so "/healthz" and "healthz" match.
+func ParseList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.Trim(strings.TrimSpace(part), "/")
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
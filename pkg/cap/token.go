@@ -0,0 +1,46 @@
+package cap
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"go.uber.org/zap"
+)
+
+// tokenAuthKey marks a request authenticated by TokenMiddleware. Gin context
+// keys can't be set by clients.
+const tokenAuthKey = "tacl.tokenAuth"
+
+// TokenMiddleware authenticates every request under the given first path
+// segment with "Authorization: Bearer <token>" instead of a Tailscale
+// identity, on any listener including Funnel. It's for machine clients that
+// can't join the tailnet, e.g. an IdP provisioning over SCIM. Callers are
+// recorded as node `name`. Register it before the other auth middlewares,
+// which let the requests it authenticated through.
+func TokenMiddleware(segment, token, name string, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if firstPathSegment(c.Request.URL.Path) != segment {
+			c.Next()
+			return
+		}
+		if !validBearerToken(c.GetHeader("Authorization"), token) {
+			logger.Warn("Rejected request with missing or invalid token",
+				zap.String("remoteAddr", c.Request.RemoteAddr),
+				zap.String("url", c.Request.URL.Path),
+			)
+			abortWithJSON(c, http.StatusUnauthorized, "permission denied, invalid token")
+			return
+		}
+		ip, _, _ := net.SplitHostPort(c.Request.RemoteAddr)
+		common.SetIdentity(c, common.Identity{NodeName: name, IP: ip})
+		c.Set(tokenAuthKey, true)
+		c.Next()
+	}
+}
+
+// tokenAuthenticated reports whether TokenMiddleware accepted the request.
+func tokenAuthenticated(c *gin.Context) bool {
+	return c.GetBool(tokenAuthKey)
+}
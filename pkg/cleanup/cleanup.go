@@ -0,0 +1,292 @@
+// Package cleanup finds stale policy entries: ones nobody has changed for a
+// long time and nothing refers to. A scheduled job reports them, labels
+// them for review or disables them, and GET /cleanup/preview lists them.
+package cleanup
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/eval"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Candidate is a stale entry.
+type Candidate struct {
+	Section string `json:"section"`
+	// ID identifies list entries (ACL and SSH rules), Name map entries
+	// (groups, hosts, tag owners and postures), without their prefix.
+	ID        string        `json:"id,omitempty"`
+	Name      string        `json:"name,omitempty"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+	UpdatedBy string        `json:"updatedBy,omitempty"`
+	Disabled  bool          `json:"disabled,omitempty"`
+	Labels    common.Labels `json:"labels,omitempty"`
+}
+
+// Preview is the response of GET /cleanup/preview.
+type Preview struct {
+	OlderThan  string      `json:"olderThan"`
+	Candidates []Candidate `json:"candidates"`
+}
+
+// listSection is a list section the job can label and disable.
+type listSection struct {
+	key       string // state key
+	path      string // route prefix
+	bodyField string // key holding the entry in PUT bodies
+}
+
+var listSections = []listSection{
+	{key: "acls", path: "/acls", bodyField: "entry"},
+	{key: "ssh", path: "/ssh", bodyField: "rule"},
+}
+
+// mapSection is a map section whose entries are referenced by name.
+type mapSection struct {
+	key    string // state key
+	prefix string // prefix of names in policy, e.g. "group:"
+}
+
+var mapSections = []mapSection{
+	{key: "groups", prefix: "group:"},
+	{key: "hosts"},
+	{key: "tagOwners", prefix: "tag:"},
+	{key: "postures", prefix: "posture:"},
+}
+
+// ignoredFields hold TACL bookkeeping, not references.
+var ignoredFields = append([]string{"id", "labels", "slug"}, common.MetaFields...)
+
+// DefaultAge is how long GET /cleanup/preview looks back when neither the
+// request nor the server sets a period.
+const DefaultAge = 365 * 24 * time.Hour
+
+// RegisterRoutes wires up GET /cleanup/preview, which lists entries the
+// cleanup job would act on. ?olderThan= (a duration such as "2160h")
+// overrides the server's period, defaultAge.
+func RegisterRoutes(r *gin.Engine, state *common.State, defaultAge time.Duration) {
+	if defaultAge <= 0 {
+		defaultAge = DefaultAge
+	}
+	r.GET("/cleanup/preview", func(c *gin.Context) {
+		age := defaultAge
+		if s := c.Query("olderThan"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "olderThan must be a positive duration, e.g. '2160h'"})
+				return
+			}
+			age = d
+		}
+		candidates := Find(state, time.Now().Add(-age))
+		if candidates == nil {
+			candidates = []Candidate{}
+		}
+		c.JSON(http.StatusOK, Preview{OlderThan: age.String(), Candidates: candidates})
+	})
+}
+
+// Find returns the entries last changed before cutoff that nothing
+// references, sorted by section and then age.
+//
+// Groups, hosts, tag owners and postures are referenced when any rule,
+// test or other entry names them. ACL rules are referenced when an ACL
+// test's accept assertion is granted by them. SSH rules aren't referenced
+// by anything, so only their age counts. Entries without timestamps (e.g.
+// imported from a policy file) are never stale, since their age is unknown.
+func Find(state *common.State, cutoff time.Time) []Candidate {
+	// Round-trip through JSON: modules store typed values
+	var data map[string]interface{}
+	b, err := json.Marshal(state.Snapshot())
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil
+	}
+	refs := references(data)
+
+	var out []Candidate
+	for _, sec := range listSections {
+		if state.SectionDisabled(sec.key) {
+			continue
+		}
+		var tested map[int]bool
+		if sec.key == "acls" {
+			tested = testedACLs(data)
+		}
+		entries, _ := data[sec.key].([]interface{})
+		for i, item := range entries {
+			entry, ok := item.(map[string]interface{})
+			if !ok || tested[i] {
+				continue
+			}
+			id, _ := entry["id"].(string)
+			meta := entryMeta(entry)
+			at := lastChanged(meta)
+			if id == "" || at == nil || !at.Before(cutoff) {
+				continue
+			}
+			disabled, _ := entry["disabled"].(bool)
+			out = append(out, Candidate{
+				Section:   sec.key,
+				ID:        id,
+				UpdatedAt: *at,
+				UpdatedBy: lastChangedBy(meta),
+				Disabled:  disabled,
+				Labels:    entryLabels(entry),
+			})
+		}
+	}
+
+	for _, sec := range mapSections {
+		if state.SectionDisabled(sec.key) {
+			continue
+		}
+		entries, _ := data[sec.key].(map[string]interface{})
+		meta := common.LoadSectionMeta(state, sec.key)
+		for key := range entries {
+			if key == "defaultSourcePosture" {
+				continue
+			}
+			name := strings.TrimPrefix(key, sec.prefix)
+			if refs[sec.prefix+name] {
+				continue
+			}
+			m := meta[name]
+			at := lastChanged(m)
+			if at == nil || !at.Before(cutoff) {
+				continue
+			}
+			out = append(out, Candidate{
+				Section:   sec.key,
+				Name:      name,
+				UpdatedAt: *at,
+				UpdatedBy: lastChangedBy(m),
+			})
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Section != out[j].Section {
+			return out[i].Section < out[j].Section
+		}
+		return out[i].UpdatedAt.Before(out[j].UpdatedAt)
+	})
+	return out
+}
+
+// references collects every name the policy refers to: each string value
+// outside TACL's own bookkeeping, and for "name:ports" destinations the
+// name as well.
+func references(data map[string]interface{}) map[string]bool {
+	refs := make(map[string]bool)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case string:
+			refs[t] = true
+			if i := strings.LastIndex(t, ":"); i > 0 {
+				refs[t[:i]] = true
+			}
+		case []interface{}:
+			for _, item := range t {
+				walk(item)
+			}
+		case map[string]interface{}:
+			for k, item := range t {
+				if !ignored(k) {
+					walk(item)
+				}
+			}
+		}
+	}
+	for k, v := range data {
+		if !strings.HasPrefix(k, "_") {
+			walk(v)
+		}
+	}
+	return refs
+}
+
+func ignored(field string) bool {
+	for _, f := range ignoredFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// testedACLs returns the indexes of the ACL rules that grant some ACL
+// test's accept assertion.
+func testedACLs(data map[string]interface{}) map[int]bool {
+	out := make(map[int]bool)
+	p, err := eval.FromState(data)
+	if err != nil {
+		return out
+	}
+	for _, t := range p.AllACLTests() {
+		for _, dst := range t.Accept {
+			if ok, i, _ := p.Allowed(t.Src, dst, t.Proto); ok {
+				out[i] = true
+			}
+		}
+	}
+	return out
+}
+
+func entryMeta(entry map[string]interface{}) common.EntryMeta {
+	var m common.EntryMeta
+	m.CreatedBy, _ = entry["createdBy"].(string)
+	m.UpdatedBy, _ = entry["updatedBy"].(string)
+	m.CreatedAt = parseTime(entry["createdAt"])
+	m.UpdatedAt = parseTime(entry["updatedAt"])
+	return m
+}
+
+func parseTime(v interface{}) *time.Time {
+	s, _ := v.(string)
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func entryLabels(entry map[string]interface{}) common.Labels {
+	raw, _ := entry["labels"].(map[string]interface{})
+	if len(raw) == 0 {
+		return nil
+	}
+	out := make(common.Labels, len(raw))
+	for k, v := range raw {
+		out[k], _ = v.(string)
+	}
+	return out
+}
+
+// lastChanged is when the entry was last updated, or created if never.
+func lastChanged(m common.EntryMeta) *time.Time {
+	if m.UpdatedAt != nil {
+		return m.UpdatedAt
+	}
+	return m.CreatedAt
+}
+
+func lastChangedBy(m common.EntryMeta) string {
+	if m.UpdatedBy != "" {
+		return m.UpdatedBy
+	}
+	return m.CreatedBy
+}
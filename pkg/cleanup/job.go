@@ -0,0 +1,186 @@
+package cleanup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// Job actions.
+const (
+	ActionReport  = "report"  // stale entries are only logged
+	ActionLabel   = "label"   // stale ACL and SSH rules get the review label
+	ActionDisable = "disable" // stale ACL and SSH rules are labelled and disabled
+)
+
+// Actor attributes the job's changes.
+const Actor = "tacl-cleanup"
+
+// Job periodically looks for stale entries. Like the expiry reaper, its
+// changes go through the router as internal requests, so they're audited,
+// versioned and delivered to webhooks. Groups, hosts, tag owners and
+// postures can't carry labels or be disabled, so they're only reported.
+type Job struct {
+	state   *common.State
+	syncer  *sync.Syncer
+	handler http.Handler
+	age     time.Duration
+	action  string
+	label   string
+	logger  *zap.Logger
+}
+
+// NewJob returns a job that acts on entries unchanged for age, marking
+// them with the label key. Rules it disables are pushed by syncer.
+func NewJob(state *common.State, syncer *sync.Syncer, handler http.Handler, age time.Duration, action, label string, logger *zap.Logger) (*Job, error) {
+	switch action {
+	case ActionReport, ActionLabel, ActionDisable:
+	default:
+		return nil, fmt.Errorf("unknown action %q (want %s, %s or %s)", action, ActionReport, ActionLabel, ActionDisable)
+	}
+	if err := (common.Labels{label: "x"}).Validate(); err != nil {
+		return nil, err
+	}
+	return &Job{state: state, syncer: syncer, handler: handler, age: age, action: action, label: label, logger: logger}, nil
+}
+
+// Start runs the job every interval until ctx is cancelled, except while
+// the server is a standby.
+func (j *Job) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !j.state.IsStandby() {
+					j.Run(ctx)
+				}
+			}
+		}
+	}()
+}
+
+// Run looks for stale entries once, acts on them and returns how many it
+// changed. Labelling or disabling a rule counts as a change to it, so it
+// isn't flagged again until another period has passed.
+func (j *Job) Run(ctx context.Context) int {
+	now := time.Now()
+	candidates := Find(j.state, now.Add(-j.age))
+	if len(candidates) == 0 {
+		return 0
+	}
+	j.logger.Info("Found stale policy entries", zap.Int("count", len(candidates)), zap.Duration("olderThan", j.age))
+	for _, c := range candidates {
+		j.logger.Debug("Stale policy entry",
+			zap.String("section", c.Section), zap.String("id", c.ID), zap.String("name", c.Name),
+			zap.Time("updatedAt", c.UpdatedAt))
+	}
+	if j.action == ActionReport {
+		return 0
+	}
+
+	n := 0
+	for _, sec := range listSections {
+		n += j.markSection(ctx, sec, candidates, now)
+	}
+	if n > 0 {
+		j.logger.Info("Marked stale rules", zap.Int("count", n), zap.String("action", j.action))
+		if j.action == ActionDisable {
+			j.syncer.Trigger()
+		}
+	}
+	return n
+}
+
+func (j *Job) markSection(ctx context.Context, sec listSection, candidates []Candidate, now time.Time) int {
+	stale := make(map[string]bool)
+	for _, c := range candidates {
+		if c.Section == sec.key {
+			stale[c.ID] = true
+		}
+	}
+	if len(stale) == 0 {
+		return 0
+	}
+
+	unlock := j.state.LockSection(sec.key)
+	defer unlock()
+
+	raw := j.state.GetValue(sec.key)
+	if raw == nil {
+		return 0
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return 0
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		j.logger.Error("Failed to parse section for cleanup", zap.String("section", sec.key), zap.Error(err))
+		return 0
+	}
+
+	n := 0
+	for _, entry := range entries {
+		id, _ := entry["id"].(string)
+		if !stale[id] {
+			continue
+		}
+		labels, _ := entry["labels"].(map[string]interface{})
+		disabled, _ := entry["disabled"].(bool)
+		_, labelled := labels[j.label]
+		if (j.action == ActionLabel && labelled) || (j.action == ActionDisable && disabled) {
+			continue
+		}
+		if err := j.mark(ctx, sec, id, entry, now); err != nil {
+			j.logger.Error("Failed to mark stale rule",
+				zap.String("section", sec.key), zap.String("id", id), zap.Error(err))
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// mark sets the review label to the date the entry was flagged, and with
+// ActionDisable disables it.
+func (j *Job) mark(ctx context.Context, sec listSection, id string, entry map[string]interface{}, now time.Time) error {
+	delete(entry, "id")
+	for _, f := range common.MetaFields {
+		delete(entry, f)
+	}
+	labels, _ := entry["labels"].(map[string]interface{})
+	if labels == nil {
+		labels = make(map[string]interface{})
+	}
+	labels[j.label] = now.UTC().Format("2006-01-02")
+	entry["labels"] = labels
+	if j.action == ActionDisable {
+		entry["disabled"] = true
+	}
+
+	b, err := json.Marshal(map[string]interface{}{"id": id, sec.bodyField: entry})
+	if err != nil {
+		return err
+	}
+	req, err := common.NewInternalRequest(ctx, http.MethodPut, sec.path, b, common.Identity{NodeName: Actor})
+	if err != nil {
+		return err
+	}
+	rec := httptest.NewRecorder()
+	j.handler.ServeHTTP(rec, req)
+	if rec.Code >= 300 {
+		return fmt.Errorf("PUT %s: %d %s", sec.path, rec.Code, rec.Body.String())
+	}
+	return nil
+}
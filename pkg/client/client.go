@@ -0,0 +1,317 @@
+// Package client is a Go client for the TACL HTTP API.
+//
+// Typed accessors such as ACLs and Groups cover the policy resources; Do
+// reaches any other endpoint. Use NewTailscale to connect over an embedded
+// tsnet node. The API is also described by the OpenAPI (Swagger 2.0) spec
+// in the swagger package, served at /swagger/doc.json, for generating
+// clients in other languages.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to a single TACL server.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+
+	// Retries is how many times an idempotent request (GET, HEAD, PUT or
+	// DELETE) is retried after a network error or a 429, 502, 503 or 504.
+	Retries int
+	// RetryWait is the delay before the first retry. It doubles after each
+	// one, unless the server sends Retry-After.
+	RetryWait time.Duration
+
+	// ManagedBy, if set, is sent as X-Tacl-Managed-By: the source that owns
+	// the entries this client creates, e.g. "terraform".
+	ManagedBy string
+	// DefaultLabels and DefaultDescription, if set, are sent as
+	// X-Tacl-Default-Labels and X-Tacl-Default-Description, and stamped
+	// onto the ACL and SSH rules this client creates.
+	DefaultLabels      map[string]string
+	DefaultDescription string
+	// OnBehalfOf, if set, is sent as X-TACL-On-Behalf-Of, so changes are
+	// attributed to that actor. The caller needs the impersonate scope.
+	OnBehalfOf string
+}
+
+// New returns a client for a server URL such as "http://tacl:8080".
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		HTTP:      &http.Client{Timeout: 30 * time.Second},
+		Retries:   2,
+		RetryWait: 500 * time.Millisecond,
+	}
+}
+
+// APIError is a non-2xx response from the server.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+type ifMatchKey struct{}
+
+type etagKey struct{}
+
+// WithIfMatch returns a context whose requests send If-Match: etag, so a
+// PUT or DELETE only applies if the entry hasn't changed since the GET
+// that returned etag. The server otherwise answers 412.
+func WithIfMatch(ctx context.Context, etag string) context.Context {
+	return context.WithValue(ctx, ifMatchKey{}, etag)
+}
+
+// WithETag returns a context that stores the ETag of each successful
+// response made with it in *etag.
+func WithETag(ctx context.Context, etag *string) context.Context {
+	return context.WithValue(ctx, etagKey{}, etag)
+}
+
+// Do sends a request with an optional JSON body and decodes a JSON response
+// into out (if non-nil). body may be a json.RawMessage or any marshalable value.
+func (c *Client) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = b
+	}
+
+	wait := c.RetryWait
+	var resp *http.Response
+	var respBody []byte
+	for attempt := 0; ; attempt++ {
+		var err error
+		resp, respBody, err = c.send(ctx, method, path, payload)
+		if !retryable(method, resp, err) || attempt >= c.Retries {
+			if err != nil {
+				return err
+			}
+			break
+		}
+		if d := retryAfter(resp); d > 0 {
+			wait = d
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &e) == nil && e.Error != "" {
+			apiErr.Message = e.Error
+		}
+		return apiErr
+	}
+	if etag, ok := ctx.Value(etagKey{}).(*string); ok {
+		*etag = resp.Header.Get("ETag")
+	}
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	if raw, ok := out.(*json.RawMessage); ok {
+		*raw = append((*raw)[:0], respBody...)
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (c *Client) send(ctx context.Context, method, path string, payload []byte) (*http.Response, []byte, error) {
+	var r io.Reader
+	if payload != nil {
+		r = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.ManagedBy != "" {
+		req.Header.Set("X-Tacl-Managed-By", c.ManagedBy)
+	}
+	if len(c.DefaultLabels) > 0 {
+		pairs := make([]string, 0, len(c.DefaultLabels))
+		for k, v := range c.DefaultLabels {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		req.Header.Set("X-Tacl-Default-Labels", strings.Join(pairs, ","))
+	}
+	if c.DefaultDescription != "" {
+		req.Header.Set("X-Tacl-Default-Description", c.DefaultDescription)
+	}
+	if c.OnBehalfOf != "" {
+		req.Header.Set("X-TACL-On-Behalf-Of", c.OnBehalfOf)
+	}
+	if etag, ok := ctx.Value(ifMatchKey{}).(string); ok && etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	return resp, respBody, err
+}
+
+// retryable reports whether a request may be sent again. POST isn't
+// idempotent, so it's never retried.
+func retryable(method string, resp *http.Response, err error) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if err != nil {
+		return resp == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter is the delay a Retry-After header (in seconds) asks for.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// List returns every entry of a resource (or the whole object for singletons).
+func (c *Client) List(ctx context.Context, res Resource) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.Do(ctx, http.MethodGet, "/"+res.Name, nil, &out)
+	return out, err
+}
+
+// ListLabeled returns the entries of a list section matching every label
+// selector, e.g. "env=prod".
+func (c *Client) ListLabeled(ctx context.Context, res Resource, selectors []string) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.Do(ctx, http.MethodGet, "/"+res.Name+labelQuery(selectors, false), nil, &out)
+	return out, err
+}
+
+// DeleteLabeled deletes the entries of a list section matching every label
+// selector and returns their ids. With dryRun nothing is deleted.
+func (c *Client) DeleteLabeled(ctx context.Context, res Resource, selectors []string, dryRun bool) ([]string, error) {
+	var out struct {
+		Deleted []string `json:"deleted"`
+	}
+	err := c.Do(ctx, http.MethodDelete, "/"+res.Name+labelQuery(selectors, dryRun), nil, &out)
+	return out.Deleted, err
+}
+
+// Filter selects list entries for DeleteMatching. Set fields must all
+// match; Src, Dst and Target are glob patterns like "tag:legacy-*".
+type Filter struct {
+	Label         []string   `json:"label,omitempty"`
+	Src           string     `json:"src,omitempty"`
+	Dst           string     `json:"dst,omitempty"`
+	Target        string     `json:"target,omitempty"`
+	CreatedBefore *time.Time `json:"createdBefore,omitempty"`
+}
+
+// DeleteMatching deletes the entries of a list section matching filter, in
+// one write, and returns their ids. With dryRun nothing is deleted.
+func (c *Client) DeleteMatching(ctx context.Context, res Resource, filter Filter, dryRun bool) ([]string, error) {
+	body := struct {
+		Filter
+		Confirm bool `json:"confirm,omitempty"`
+	}{filter, !dryRun}
+	var out struct {
+		Deleted []string `json:"deleted"`
+	}
+	err := c.Do(ctx, http.MethodPost, "/"+res.Name+"/_delete", body, &out)
+	return out.Deleted, err
+}
+
+func labelQuery(selectors []string, dryRun bool) string {
+	q := url.Values{"label": selectors}
+	if dryRun {
+		q.Set("dryRun", "true")
+	}
+	return "?" + q.Encode()
+}
+
+// Get returns one entry by id or name.
+func (c *Client) Get(ctx context.Context, res Resource, key string) (json.RawMessage, error) {
+	if res.Kind == KindSingleton {
+		return c.List(ctx, res)
+	}
+	var out json.RawMessage
+	err := c.Do(ctx, http.MethodGet, "/"+res.Name+"/"+url.PathEscape(key), nil, &out)
+	return out, err
+}
+
+// Create POSTs body to the resource.
+func (c *Client) Create(ctx context.Context, res Resource, body json.RawMessage) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.Do(ctx, http.MethodPost, "/"+res.Name, body, &out)
+	return out, err
+}
+
+// Update PUTs body to the resource.
+func (c *Client) Update(ctx context.Context, res Resource, body json.RawMessage) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.Do(ctx, http.MethodPut, "/"+res.Name, body, &out)
+	return out, err
+}
+
+// Delete removes one entry by id or name (singletons ignore key).
+func (c *Client) Delete(ctx context.Context, res Resource, key string) error {
+	var body interface{}
+	switch res.Kind {
+	case KindList:
+		body = map[string]string{"id": key}
+	case KindMap:
+		body = map[string]string{"name": key}
+	}
+	return c.Do(ctx, http.MethodDelete, "/"+res.Name, body, nil)
+}
+
+// State returns the server's full state document (GET /state).
+func (c *Client) State(ctx context.Context) (map[string]interface{}, error) {
+	var out map[string]interface{}
+	err := c.Do(ctx, http.MethodGet, "/state", nil, &out)
+	return out, err
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Context is a named TACL server.
+type Context struct {
+	Server string `json:"server"`
+}
+
+// Config holds client contexts, like a kubeconfig for TACL servers.
+type Config struct {
+	Current  string             `json:"current,omitempty"`
+	Contexts map[string]Context `json:"contexts"`
+}
+
+// DefaultConfigPath is $XDG_CONFIG_HOME/tacl/client.json (or the OS equivalent).
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "tacl-client.json"
+	}
+	return filepath.Join(dir, "tacl", "client.json")
+}
+
+// LoadConfig reads a config file. A missing file yields an empty config.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{Contexts: map[string]Context{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if cfg.Contexts == nil {
+		cfg.Contexts = map[string]Context{}
+	}
+	return cfg, nil
+}
+
+// Save writes the config, creating its directory if needed.
+func (c *Config) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// Server resolves which server to use: an explicit URL wins, then a named
+// context, then the current context.
+func (c *Config) Server(explicit, context string) (string, error) {
+	if explicit != "" {
+		return explicit, nil
+	}
+	name := context
+	if name == "" {
+		name = c.Current
+	}
+	if name == "" {
+		return "", errors.New("no server configured: pass --server or create a context with 'tacl client config set-context'")
+	}
+	ctx, ok := c.Contexts[name]
+	if !ok {
+		return "", fmt.Errorf("context %q not found", name)
+	}
+	return ctx.Server, nil
+}
+
+// Names returns context names, sorted.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Contexts))
+	for n := range c.Contexts {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
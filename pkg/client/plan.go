@@ -0,0 +1,260 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/diff"
+)
+
+// Operations planned by Plan.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Action is one API call needed to make the server match a local file.
+type Action struct {
+	Op       string      `json:"op"`
+	Resource string      `json:"resource"`
+	Key      string      `json:"key,omitempty"`
+	Method   string      `json:"method"`
+	Path     string      `json:"path"`
+	Body     interface{} `json:"body,omitempty"`
+}
+
+// applyOrder creates referenced things (groups, tags, hosts) before the
+// rules that use them; deletes run in reverse.
+var applyOrder = []string{
+	"groups", "hosts", "tagowners", "postures",
+	"autoapprovers", "derpmap", "settings",
+	"acls", "grants", "ssh", "nodeattrs", "acltests",
+}
+
+// Plan compares a local state document (as returned by GET /state) with the
+// server's and returns the calls that reconcile them, plus a per-section diff.
+// Only sections present in local are considered, and server-managed metadata
+// (createdBy, updatedAt, ...) is ignored.
+func Plan(remote, local map[string]interface{}) ([]Action, map[string]diff.SectionDiff) {
+	var actions []Action
+	diffs := make(map[string]diff.SectionDiff)
+
+	for _, res := range resources {
+		want, ok := local[res.Section]
+		if !ok {
+			continue
+		}
+		have := normalize(remote[res.Section])
+		want = normalize(want)
+
+		if res.Kind == KindSingleton {
+			if reflect.DeepEqual(have, want) {
+				continue
+			}
+			d := diff.SectionDiff{Changed: []diff.Change{{Before: have, After: want}}}
+			switch {
+			case want == nil:
+				d = diff.SectionDiff{Removed: []diff.Change{{Before: have}}}
+				actions = append(actions, Action{Op: OpDelete, Resource: res.Name, Method: http.MethodDelete, Path: "/" + res.Name})
+			case have == nil:
+				d = diff.SectionDiff{Added: []diff.Change{{After: want}}}
+				actions = append(actions, Action{Op: OpCreate, Resource: res.Name, Method: http.MethodPost, Path: "/" + res.Name, Body: want})
+			default:
+				actions = append(actions, Action{Op: OpUpdate, Resource: res.Name, Method: http.MethodPut, Path: "/" + res.Name, Body: want})
+			}
+			diffs[res.Section] = d
+			continue
+		}
+
+		if res.Kind == KindList {
+			stripMeta(have)
+			stripMeta(want)
+			adoptIDs(have, want)
+		}
+		d := diff.Section(have, want)
+		if d.Empty() {
+			continue
+		}
+		diffs[res.Section] = d
+		for _, c := range d.Added {
+			actions = append(actions, entryAction(res, OpCreate, c))
+		}
+		for _, c := range d.Changed {
+			actions = append(actions, entryAction(res, OpUpdate, c))
+		}
+		for _, c := range d.Removed {
+			actions = append(actions, entryAction(res, OpDelete, c))
+		}
+	}
+
+	sortActions(actions)
+	return actions, diffs
+}
+
+// BatchResult is what one call of a batch answered.
+type BatchResult struct {
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Batch sends actions as one POST /batch. They're made in order and saved
+// together; if one fails, none of them are applied and the error says
+// which.
+func (c *Client) Batch(ctx context.Context, actions []Action) ([]BatchResult, error) {
+	var out struct {
+		Results []BatchResult `json:"results"`
+	}
+	err := c.Do(ctx, http.MethodPost, "/batch", map[string]interface{}{"operations": actions}, &out)
+	return out.Results, err
+}
+
+// Apply makes actions in order as one batch, so either all of them take
+// effect or none do.
+func (c *Client) Apply(ctx context.Context, actions []Action) error {
+	if len(actions) == 0 {
+		return nil
+	}
+	_, err := c.Batch(ctx, actions)
+	return err
+}
+
+func entryAction(res Resource, op string, c diff.Change) Action {
+	a := Action{Op: op, Resource: res.Name, Key: c.Key, Path: "/" + res.Name}
+	switch op {
+	case OpCreate:
+		a.Method = http.MethodPost
+	case OpUpdate:
+		a.Method = http.MethodPut
+	default:
+		a.Method = http.MethodDelete
+	}
+
+	if res.Kind == KindList {
+		switch op {
+		case OpCreate:
+			a.Body = withoutID(c.After)
+		case OpUpdate:
+			a.Body = map[string]interface{}{"id": c.Key, res.UpdateField: withoutID(c.After)}
+		default:
+			a.Body = map[string]interface{}{"id": c.Key}
+		}
+		if strings.HasPrefix(c.Key, "#") {
+			a.Key = "" // positional key of an entry without an id
+		}
+		return a
+	}
+
+	// The default posture lives in the postures map under its own endpoint
+	if res.Name == "postures" && c.Key == defaultPostureKey {
+		a.Path = "/postures/default"
+		if op == OpDelete {
+			return a
+		}
+		a.Method = http.MethodPut
+		a.Body = map[string]interface{}{defaultPostureKey: c.After}
+		return a
+	}
+
+	name := strings.TrimPrefix(c.Key, res.KeyPrefix)
+	a.Key = name
+	if op == OpDelete {
+		a.Body = map[string]interface{}{"name": name}
+	} else {
+		a.Body = map[string]interface{}{"name": name, res.ValueField: c.After}
+	}
+	return a
+}
+
+func sortActions(actions []Action) {
+	rank := make(map[string]int, len(applyOrder))
+	for i, r := range applyOrder {
+		rank[r] = i
+	}
+	key := func(a Action) int {
+		if a.Op == OpDelete {
+			return 2*len(applyOrder) - rank[a.Resource]
+		}
+		return rank[a.Resource]
+	}
+	sort.SliceStable(actions, func(i, j int) bool {
+		return key(actions[i]) < key(actions[j])
+	})
+}
+
+func normalize(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func stripMeta(section interface{}) {
+	list, _ := section.([]interface{})
+	for _, item := range list {
+		if entry, ok := item.(map[string]interface{}); ok {
+			for _, f := range common.MetaFields {
+				delete(entry, f)
+			}
+		}
+	}
+}
+
+// adoptIDs gives local entries without an id the id of an identical server
+// entry that no other local entry claims, so re-applying a hand-written file
+// doesn't create duplicates.
+func adoptIDs(have, want interface{}) {
+	remote, _ := have.([]interface{})
+	local, _ := want.([]interface{})
+
+	claimed := map[interface{}]bool{}
+	for _, item := range local {
+		if entry, ok := item.(map[string]interface{}); ok && entry["id"] != nil {
+			claimed[entry["id"]] = true
+		}
+	}
+	for _, item := range local {
+		entry, ok := item.(map[string]interface{})
+		if !ok || entry["id"] != nil {
+			continue
+		}
+		for _, r := range remote {
+			candidate, ok := r.(map[string]interface{})
+			if !ok || candidate["id"] == nil || claimed[candidate["id"]] {
+				continue
+			}
+			if reflect.DeepEqual(withoutID(candidate), withoutID(entry)) {
+				entry["id"] = candidate["id"]
+				claimed[candidate["id"]] = true
+				break
+			}
+		}
+	}
+}
+
+func withoutID(v interface{}) interface{} {
+	entry, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	out := make(map[string]interface{}, len(entry))
+	for k, val := range entry {
+		if k != "id" {
+			out[k] = val
+		}
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kind is how a resource is shaped in state.
+type Kind int
+
+const (
+	// KindList is an array of entries addressed by "id" (acls, ssh, ...).
+	KindList Kind = iota
+	// KindMap is an object of named entries (groups, hosts, ...).
+	KindMap
+	// KindSingleton is a single object (settings, derpmap, autoapprovers).
+	KindSingleton
+)
+
+// Resource describes one API resource and how it maps to a state section.
+type Resource struct {
+	// Name is the route prefix, e.g. "acls".
+	Name string
+	// Section is the top-level state key, e.g. "aclTests".
+	Section string
+	Kind    Kind
+
+	// UpdateField is the field wrapping the entry in a list resource's PUT
+	// body, e.g. {"id": "...", "entry": {...}}.
+	UpdateField string
+
+	// KeyPrefix is prepended to names to form map keys, e.g. "group:".
+	KeyPrefix string
+	// ValueField is the field holding a map entry's value, e.g. "members".
+	ValueField string
+}
+
+var resources = []Resource{
+	{Name: "acls", Section: "acls", Kind: KindList, UpdateField: "entry"},
+	{Name: "acltests", Section: "aclTests", Kind: KindList, UpdateField: "test"},
+	{Name: "grants", Section: "grants", Kind: KindList, UpdateField: "grant"},
+	{Name: "nodeattrs", Section: "nodeAttrs", Kind: KindList, UpdateField: "grant"},
+	{Name: "ssh", Section: "ssh", Kind: KindList, UpdateField: "rule"},
+	{Name: "groups", Section: "groups", Kind: KindMap, KeyPrefix: "group:", ValueField: "members"},
+	{Name: "hosts", Section: "hosts", Kind: KindMap, ValueField: "ip"},
+	{Name: "postures", Section: "postures", Kind: KindMap, KeyPrefix: "posture:", ValueField: "rules"},
+	{Name: "tagowners", Section: "tagOwners", Kind: KindMap, KeyPrefix: "tag:", ValueField: "owners"},
+	{Name: "autoapprovers", Section: "autoApprovers", Kind: KindSingleton},
+	{Name: "derpmap", Section: "derpMap", Kind: KindSingleton},
+	{Name: "settings", Section: "settings", Kind: KindSingleton},
+}
+
+// defaultPostureKey is stored inside the postures map but managed through
+// /postures/default.
+const defaultPostureKey = "defaultSourcePosture"
+
+// Resources returns all known resources.
+func Resources() []Resource {
+	return append([]Resource(nil), resources...)
+}
+
+// LookupResource finds a resource by route prefix or state key, case-insensitively.
+func LookupResource(name string) (Resource, error) {
+	for _, r := range resources {
+		if strings.EqualFold(r.Name, name) || strings.EqualFold(r.Section, name) {
+			return r, nil
+		}
+	}
+	names := make([]string, 0, len(resources))
+	for _, r := range resources {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	return Resource{}, fmt.Errorf("unknown resource %q (one of %s)", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"tailscale.com/tsnet"
+)
+
+// NewTailscale returns a client that reaches the server over srv's tailnet
+// connection, for programs that embed tsnet instead of running tailscaled.
+// TACL authorizes callers by their Tailscale identity, so requests carry
+// srv's node identity and tags.
+func NewTailscale(baseURL string, srv *tsnet.Server) *Client {
+	c := New(baseURL)
+	c.HTTP = srv.HTTPClient()
+	c.HTTP.Timeout = 30 * time.Second
+	return c
+}
+
+// StartTailscale brings up srv (see tsnet.Server.Up) and returns a client
+// for the server at baseURL, e.g. "http://tacl".
+func StartTailscale(ctx context.Context, baseURL string, srv *tsnet.Server) (*Client, error) {
+	if _, err := srv.Up(ctx); err != nil {
+		return nil, err
+	}
+	return NewTailscale(baseURL, srv), nil
+}
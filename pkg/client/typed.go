@@ -0,0 +1,373 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Meta records who changed an entry and when. The server sets it.
+type Meta struct {
+	CreatedBy string     `json:"createdBy,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedBy string     `json:"updatedBy,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// ACL is an entry of /acls.
+type ACL struct {
+	ID         string            `json:"id,omitempty"`
+	Action     string            `json:"action,omitempty"`
+	Src        []string          `json:"src,omitempty"`
+	Dst        []string          `json:"dst,omitempty"`
+	Proto      string            `json:"proto,omitempty"`
+	SrcPosture []string          `json:"srcPosture,omitempty"`
+	ExpiresAt  *time.Time        `json:"expiresAt,omitempty"`
+	Disabled   bool              `json:"disabled,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Meta
+}
+
+// Grant is an entry of /grants.
+type Grant struct {
+	ID         string                   `json:"id,omitempty"`
+	Src        []string                 `json:"src"`
+	Dst        []string                 `json:"dst"`
+	IP         []string                 `json:"ip,omitempty"`
+	App        map[string][]interface{} `json:"app,omitempty"`
+	Via        []string                 `json:"via,omitempty"`
+	SrcPosture []string                 `json:"srcPosture,omitempty"`
+	ExpiresAt  *time.Time               `json:"expiresAt,omitempty"`
+	Disabled   bool                     `json:"disabled,omitempty"`
+	Labels     map[string]string        `json:"labels,omitempty"`
+	Meta
+}
+
+// SSHRule is an entry of /ssh.
+type SSHRule struct {
+	ID          string            `json:"id,omitempty"`
+	Action      string            `json:"action"`
+	Src         []string          `json:"src,omitempty"`
+	Dst         []string          `json:"dst,omitempty"`
+	Users       []string          `json:"users,omitempty"`
+	CheckPeriod string            `json:"checkPeriod,omitempty"`
+	AcceptEnv   []string          `json:"acceptEnv,omitempty"`
+	ExpiresAt   *time.Time        `json:"expiresAt,omitempty"`
+	Disabled    bool              `json:"disabled,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Meta
+}
+
+// ACLTest is an entry of /acltests.
+type ACLTest struct {
+	ID     string            `json:"id,omitempty"`
+	Src    string            `json:"src,omitempty"`
+	Proto  string            `json:"proto,omitempty"`
+	Accept []string          `json:"accept,omitempty"`
+	Deny   []string          `json:"deny,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Meta
+}
+
+// AppConnector is one app connector of a node attribute grant.
+type AppConnector struct {
+	Name       string   `json:"name,omitempty"`
+	Connectors []string `json:"connectors,omitempty"`
+	Domains    []string `json:"domains,omitempty"`
+}
+
+// NodeAttr is an entry of /nodeattrs: either attributes or an app.
+type NodeAttr struct {
+	ID     string                    `json:"id,omitempty"`
+	Target []string                  `json:"target"`
+	Attr   []string                  `json:"attr,omitempty"`
+	App    map[string][]AppConnector `json:"app,omitempty"`
+	Labels map[string]string         `json:"labels,omitempty"`
+	Meta
+}
+
+// Group is an entry of /groups. Name leaves out the "group:" prefix.
+type Group struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+	Meta
+}
+
+// Host is an entry of /hosts.
+type Host struct {
+	Name string `json:"name"`
+	IP   string `json:"ip"`
+	Meta
+}
+
+// Posture is an entry of /postures. Name leaves out the "posture:" prefix.
+type Posture struct {
+	Name  string   `json:"name"`
+	Rules []string `json:"rules"`
+	Meta
+}
+
+// TagOwner is an entry of /tagowners. Name leaves out the "tag:" prefix.
+type TagOwner struct {
+	Name   string   `json:"name"`
+	Owners []string `json:"owners"`
+	Meta
+}
+
+// AutoApprovers is /autoapprovers.
+type AutoApprovers struct {
+	Routes   map[string][]string `json:"routes,omitempty"`
+	ExitNode []string            `json:"exitNode,omitempty"`
+}
+
+// Settings is /settings.
+type Settings struct {
+	DisableIPv4         bool   `json:"disableIPv4,omitempty"`
+	OneCGNATRoute       string `json:"oneCGNATRoute,omitempty"`
+	RandomizeClientPort bool   `json:"randomizeClientPort,omitempty"`
+	// Extra holds the settings the server has no schema for, so they
+	// survive a read-modify-write.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type settingsFields Settings
+
+// MarshalJSON writes Extra next to the other fields.
+func (s Settings) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(settingsFields(s))
+	if err != nil || len(s.Extra) == 0 {
+		return b, err
+	}
+	var out map[string]json.RawMessage
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	for k, v := range s.Extra {
+		if _, ok := out[k]; !ok {
+			out[k] = v
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON keeps the keys that aren't fields in Extra.
+func (s *Settings) UnmarshalJSON(b []byte) error {
+	var fields settingsFields
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+	for k := range all {
+		switch strings.ToLower(k) {
+		case "disableipv4", "onecgnatroute", "randomizeclientport":
+			delete(all, k)
+		}
+	}
+	fields.Extra = nil
+	if len(all) > 0 {
+		fields.Extra = all
+	}
+	*s = Settings(fields)
+	return nil
+}
+
+// ListAPI is a typed list resource, whose entries are addressed by id.
+type ListAPI[T any] struct {
+	c   *Client
+	res Resource
+}
+
+// List returns every entry.
+func (a ListAPI[T]) List(ctx context.Context) ([]T, error) {
+	var out []T
+	err := a.c.Do(ctx, http.MethodGet, "/"+a.res.Name, nil, &out)
+	return out, err
+}
+
+// Get returns the entry with id.
+func (a ListAPI[T]) Get(ctx context.Context, id string) (T, error) {
+	var out T
+	err := a.c.Do(ctx, http.MethodGet, "/"+a.res.Name+"/"+url.PathEscape(id), nil, &out)
+	return out, err
+}
+
+// Create adds an entry and returns it with its new id.
+func (a ListAPI[T]) Create(ctx context.Context, entry T) (T, error) {
+	var out T
+	err := a.c.Do(ctx, http.MethodPost, "/"+a.res.Name, entry, &out)
+	return out, err
+}
+
+// Update replaces the entry with id.
+func (a ListAPI[T]) Update(ctx context.Context, id string, entry T) (T, error) {
+	var out T
+	body := map[string]interface{}{"id": id, a.res.UpdateField: entry}
+	err := a.c.Do(ctx, http.MethodPut, "/"+a.res.Name, body, &out)
+	return out, err
+}
+
+// Delete removes the entry with id.
+func (a ListAPI[T]) Delete(ctx context.Context, id string) error {
+	return a.c.Do(ctx, http.MethodDelete, "/"+a.res.Name, map[string]string{"id": id}, nil)
+}
+
+// MapAPI is a typed map resource, whose entries are addressed by name.
+type MapAPI[T any] struct {
+	c   *Client
+	res Resource
+	// items is the field holding the entries in list responses that
+	// aren't a bare array (GET /postures).
+	items string
+}
+
+// List returns every entry.
+func (a MapAPI[T]) List(ctx context.Context) ([]T, error) {
+	var out []T
+	if a.items == "" {
+		err := a.c.Do(ctx, http.MethodGet, "/"+a.res.Name, nil, &out)
+		return out, err
+	}
+	var wrapped map[string]json.RawMessage
+	if err := a.c.Do(ctx, http.MethodGet, "/"+a.res.Name, nil, &wrapped); err != nil {
+		return nil, err
+	}
+	if raw, ok := wrapped[a.items]; ok {
+		if err := json.Unmarshal(raw, &out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Get returns the entry called name.
+func (a MapAPI[T]) Get(ctx context.Context, name string) (T, error) {
+	var out T
+	err := a.c.Do(ctx, http.MethodGet, "/"+a.res.Name+"/"+url.PathEscape(name), nil, &out)
+	return out, err
+}
+
+// Create adds an entry.
+func (a MapAPI[T]) Create(ctx context.Context, entry T) (T, error) {
+	var out T
+	err := a.c.Do(ctx, http.MethodPost, "/"+a.res.Name, entry, &out)
+	return out, err
+}
+
+// Update replaces the entry with entry's name.
+func (a MapAPI[T]) Update(ctx context.Context, entry T) (T, error) {
+	var out T
+	err := a.c.Do(ctx, http.MethodPut, "/"+a.res.Name, entry, &out)
+	return out, err
+}
+
+// Delete removes the entry called name.
+func (a MapAPI[T]) Delete(ctx context.Context, name string) error {
+	return a.c.Do(ctx, http.MethodDelete, "/"+a.res.Name, map[string]string{"name": name}, nil)
+}
+
+// SingletonAPI is a typed singleton resource.
+type SingletonAPI[T any] struct {
+	c   *Client
+	res Resource
+}
+
+// Get returns the resource.
+func (a SingletonAPI[T]) Get(ctx context.Context) (T, error) {
+	var out T
+	err := a.c.Do(ctx, http.MethodGet, "/"+a.res.Name, nil, &out)
+	return out, err
+}
+
+// Create sets the resource, which must not exist yet.
+func (a SingletonAPI[T]) Create(ctx context.Context, v T) (T, error) {
+	var out T
+	err := a.c.Do(ctx, http.MethodPost, "/"+a.res.Name, v, &out)
+	return out, err
+}
+
+// Update replaces the resource.
+func (a SingletonAPI[T]) Update(ctx context.Context, v T) (T, error) {
+	var out T
+	err := a.c.Do(ctx, http.MethodPut, "/"+a.res.Name, v, &out)
+	return out, err
+}
+
+// Delete removes the resource.
+func (a SingletonAPI[T]) Delete(ctx context.Context) error {
+	return a.c.Do(ctx, http.MethodDelete, "/"+a.res.Name, nil, nil)
+}
+
+func (c *Client) resource(name string) Resource {
+	res, err := LookupResource(name)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// ACLs is /acls.
+func (c *Client) ACLs() ListAPI[ACL] { return ListAPI[ACL]{c, c.resource("acls")} }
+
+// Grants is /grants.
+func (c *Client) Grants() ListAPI[Grant] { return ListAPI[Grant]{c, c.resource("grants")} }
+
+// SSH is /ssh.
+func (c *Client) SSH() ListAPI[SSHRule] { return ListAPI[SSHRule]{c, c.resource("ssh")} }
+
+// ACLTests is /acltests.
+func (c *Client) ACLTests() ListAPI[ACLTest] { return ListAPI[ACLTest]{c, c.resource("acltests")} }
+
+// NodeAttrs is /nodeattrs.
+func (c *Client) NodeAttrs() ListAPI[NodeAttr] { return ListAPI[NodeAttr]{c, c.resource("nodeattrs")} }
+
+// Groups is /groups.
+func (c *Client) Groups() MapAPI[Group] { return MapAPI[Group]{c: c, res: c.resource("groups")} }
+
+// Hosts is /hosts.
+func (c *Client) Hosts() MapAPI[Host] { return MapAPI[Host]{c: c, res: c.resource("hosts")} }
+
+// Postures is /postures. The default posture is DefaultPosture.
+func (c *Client) Postures() MapAPI[Posture] {
+	return MapAPI[Posture]{c: c, res: c.resource("postures"), items: "items"}
+}
+
+// TagOwners is /tagowners.
+func (c *Client) TagOwners() MapAPI[TagOwner] {
+	return MapAPI[TagOwner]{c: c, res: c.resource("tagowners")}
+}
+
+// AutoApprovers is /autoapprovers.
+func (c *Client) AutoApprovers() SingletonAPI[AutoApprovers] {
+	return SingletonAPI[AutoApprovers]{c, c.resource("autoapprovers")}
+}
+
+// Settings is /settings.
+func (c *Client) Settings() SingletonAPI[Settings] {
+	return SingletonAPI[Settings]{c, c.resource("settings")}
+}
+
+// DERPMap is /derpmap. The map is kept as raw JSON, as in the policy.
+func (c *Client) DERPMap() SingletonAPI[map[string]interface{}] {
+	return SingletonAPI[map[string]interface{}]{c, c.resource("derpmap")}
+}
+
+// DefaultPosture returns the default source posture (GET /postures/default).
+func (c *Client) DefaultPosture(ctx context.Context) ([]string, error) {
+	var out struct {
+		DefaultSourcePosture []string `json:"defaultSourcePosture"`
+	}
+	err := c.Do(ctx, http.MethodGet, "/postures/default", nil, &out)
+	return out.DefaultSourcePosture, err
+}
+
+// SetDefaultPosture replaces the default source posture (PUT /postures/default).
+func (c *Client) SetDefaultPosture(ctx context.Context, rules []string) error {
+	body := map[string][]string{"defaultSourcePosture": rules}
+	return c.Do(ctx, http.MethodPut, "/postures/default", body, nil)
+}
@@ -0,0 +1,85 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorizerKey is the gin context key the auth middleware stores the
+// caller's grants under.
+const authorizerKey = "tacl.authorizer"
+
+// Authorizer reports whether the caller may make a request with the given
+// method and path.
+type Authorizer func(method, path string) bool
+
+// SetAuthorizer records what the caller of the request is allowed to do, for
+// handlers that make changes beyond their own resource.
+func SetAuthorizer(c *gin.Context, fn Authorizer) {
+	c.Set(authorizerKey, fn)
+}
+
+// Authorized reports whether the caller of c's request may also send a
+// `method` request to `path`. Callers the auth middleware doesn't check
+// against capabilities (on the local listener, with a token, or dispatched
+// internally) record no Authorizer and may.
+func Authorized(c *gin.Context, method, path string) bool {
+	v, ok := c.Get(authorizerKey)
+	if !ok {
+		return true
+	}
+	fn, _ := v.(Authorizer)
+	return fn != nil && fn(method, path)
+}
+
+// UnauthorizedSection returns the module (route prefix) of the first policy
+// section in sections, by name, that the caller of c may not change with a
+// `method` request to that module. Handlers writing sections other than
+// their own resource's check them with it. Internal keys (starting with
+// "_") aren't checked.
+func UnauthorizedSection(c *gin.Context, method string, sections map[string]interface{}) (string, bool) {
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		if !strings.HasPrefix(name, "_") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		resource, ok := ResourceForSection(name)
+		if !ok {
+			resource = strings.ToLower(name)
+		}
+		if !Authorized(c, method, "/"+resource) {
+			return resource, true
+		}
+	}
+	return "", false
+}
+
+type delegatedKey struct{}
+
+type delegation struct {
+	method, path string
+}
+
+// DelegatedContext marks ctx for a request a handler dispatches to the
+// router on behalf of its own caller, e.g. the rule an access request
+// creates. Unlike NewInternalRequest's, the request is authenticated as
+// usual, but the auth middleware also lets it through if the caller may
+// make the `method` request to `path` it came from, unless a deny rule
+// covers it.
+func DelegatedContext(ctx context.Context, method, path string) context.Context {
+	return context.WithValue(ctx, delegatedKey{}, delegation{method, path})
+}
+
+// Delegation returns the request r was dispatched on behalf of, if it was
+// built with DelegatedContext.
+func Delegation(r *http.Request) (method, path string, ok bool) {
+	d, ok := r.Context().Value(delegatedKey{}).(delegation)
+	return d.method, d.path, ok
+}
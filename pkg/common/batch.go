@@ -0,0 +1,46 @@
+package common
+
+import (
+	"context"
+	"net/http"
+)
+
+type batchKey struct{}
+
+// batchOps holds what the operations of one batch put off until it's
+// saved. They run one at a time, so it needs no lock.
+type batchOps struct {
+	after []func()
+}
+
+// BatchContext returns a context for dispatching the operations of a batch
+// (POST /batch) to the router. SerializeMutations lets them through, since
+// the handler running the batch already holds the mutation lock. commit
+// runs what they put off with AfterCommit: call it once the batch is saved,
+// and not at all if it's abandoned.
+func BatchContext(ctx context.Context) (_ context.Context, commit func()) {
+	b := &batchOps{}
+	return context.WithValue(ctx, batchKey{}, b), func() {
+		after := b.after
+		b.after = nil
+		for _, fn := range after {
+			fn()
+		}
+	}
+}
+
+// InBatch reports whether r is an operation of a batch.
+func InBatch(r *http.Request) bool {
+	_, ok := r.Context().Value(batchKey{}).(*batchOps)
+	return ok
+}
+
+// AfterCommit runs fn once r's changes are saved: now, or when the batch r
+// is part of commits.
+func AfterCommit(r *http.Request, fn func()) {
+	if b, ok := r.Context().Value(batchKey{}).(*batchOps); ok {
+		b.after = append(b.after, fn)
+		return
+	}
+	fn()
+}
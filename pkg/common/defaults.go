@@ -0,0 +1,97 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request headers adding to the server's EntryDefaults, so a client such as
+// the Terraform provider can mark what it creates.
+const (
+	// DefaultLabelsHeader holds comma-separated key=value labels, e.g.
+	// "source=terraform,repo=infra".
+	DefaultLabelsHeader      = "X-Tacl-Default-Labels"
+	DefaultDescriptionHeader = "X-Tacl-Default-Description"
+)
+
+// EntryDefaults are stamped onto every list entry created through the API,
+// to record where it came from. An entry's own labels win over default ones
+// with the same key, and its own description over the default description.
+type EntryDefaults struct {
+	Labels      Labels
+	Description string
+}
+
+// DefaultedSections are the list sections whose entries have labels and a
+// description.
+var DefaultedSections = []string{"acls", "grants", "ssh"}
+
+// ParseLabels parses comma-separated key=value pairs, as in
+// DefaultLabelsHeader.
+func ParseLabels(s string) (Labels, error) {
+	out := Labels{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: must be key=value", pair)
+		}
+		out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetEntryDefaults sets the defaults for entries created on this server.
+// Call it once, before serving.
+func (s *State) SetEntryDefaults(d EntryDefaults) {
+	s.defaults = d
+}
+
+// RequestDefaults returns the defaults for entries created by the request:
+// the server's, with the request's headers added (and overriding them).
+func (s *State) RequestDefaults(c *gin.Context) (EntryDefaults, error) {
+	d := EntryDefaults{Labels: Labels{}, Description: s.defaults.Description}
+	for k, v := range s.defaults.Labels {
+		d.Labels[k] = v
+	}
+	if h := c.GetHeader(DefaultLabelsHeader); h != "" {
+		labels, err := ParseLabels(h)
+		if err != nil {
+			return EntryDefaults{}, fmt.Errorf("%s: %w", DefaultLabelsHeader, err)
+		}
+		for k, v := range labels {
+			d.Labels[k] = v
+		}
+	}
+	if h := strings.TrimSpace(c.GetHeader(DefaultDescriptionHeader)); h != "" {
+		d.Description = h
+	}
+	return d, nil
+}
+
+// Apply stamps d onto a decoded list entry.
+func (d EntryDefaults) Apply(entry map[string]interface{}) {
+	if len(d.Labels) > 0 {
+		labels := make(map[string]interface{}, len(d.Labels))
+		for k, v := range d.Labels {
+			labels[k] = v
+		}
+		if own, ok := entry["labels"].(map[string]interface{}); ok {
+			for k, v := range own {
+				labels[k] = v
+			}
+		}
+		entry["labels"] = labels
+	}
+	if desc, _ := entry["description"].(string); desc == "" && d.Description != "" {
+		entry["description"] = d.Description
+	}
+}
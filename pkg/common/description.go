@@ -0,0 +1,13 @@
+package common
+
+// Described gives a list entry a human-readable explanation. It's embedded
+// in the ACL and SSH input types, shown in the policy documentation and
+// never reaches the synced policy.
+type Described struct {
+	// Description says what the entry is for, e.g. "on-call access to
+	// production databases".
+	Description string `json:"description,omitempty"`
+}
+
+// DescriptionFields are the JSON keys of Described.
+var DescriptionFields = []string{"description"}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Durability headers. Responses to mutating requests that saved anything
+// carry X-Tacl-Write-Seq and X-Tacl-Durability ("persisted", "queued" or
+// "failed"). Sending "X-Tacl-Durability: wait" holds the response until the
+// write is in storage.
+const (
+	HeaderWriteSeq   = "X-Tacl-Write-Seq"
+	HeaderDurability = "X-Tacl-Durability"
+)
+
+// DurabilityMiddleware reports, per mutation, whether its save has reached
+// storage yet. It matters once StartWriteQueue is in use.
+func DurabilityMiddleware(state *State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		dw := &durabilityWriter{
+			ResponseWriter: c.Writer,
+			c:              c,
+			state:          state,
+			start:          state.WriteSeq(),
+			wait:           c.GetHeader(HeaderDurability) == "wait",
+		}
+		c.Writer = dw
+		c.Next()
+	}
+}
+
+// durabilityWriter adds the durability headers just before the response
+// headers go out, when the handler's saves are done.
+type durabilityWriter struct {
+	gin.ResponseWriter
+	c     *gin.Context
+	state *State
+	start uint64
+	wait  bool
+	once  sync.Once
+}
+
+func (w *durabilityWriter) annotate() {
+	w.once.Do(func() {
+		seq := w.state.WriteSeq()
+		if seq <= w.start {
+			return
+		}
+		h := w.ResponseWriter.Header()
+		h.Set(HeaderWriteSeq, strconv.FormatUint(seq, 10))
+		switch {
+		case w.wait:
+			if err := w.state.WaitPersisted(w.c.Request.Context(), seq); err != nil {
+				h.Set(HeaderDurability, "failed")
+				return
+			}
+			h.Set(HeaderDurability, "persisted")
+		case w.state.WriteStatus().Persisted >= seq:
+			h.Set(HeaderDurability, "persisted")
+		default:
+			h.Set(HeaderDurability, "queued")
+		}
+	})
+}
+
+func (w *durabilityWriter) WriteHeaderNow() {
+	w.annotate()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *durabilityWriter) Write(b []byte) (int, error) {
+	w.annotate()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *durabilityWriter) WriteString(s string) (int, error) {
+	w.annotate()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *durabilityWriter) Flush() {
+	w.annotate()
+	w.ResponseWriter.Flush()
+}
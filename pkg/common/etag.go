@@ -0,0 +1,81 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag returns a strong ETag for a JSON representation.
+func ETag(b []byte) string {
+	sum := sha256.Sum256(bytes.TrimSpace(b))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// MatchesETag reports whether an If-Match / If-None-Match header value
+// names tag. Weak validators compare equal to their strong form.
+func MatchesETag(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// RespondETag writes v as JSON with its ETag, or 304 if a GET's
+// If-None-Match shows the client already has it.
+func RespondETag(c *gin.Context, status int, v interface{}) {
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode response"})
+		return
+	}
+	b := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	tag := ETag(b)
+	c.Header("ETag", tag)
+	if status == http.StatusOK && c.Request.Method == http.MethodGet && MatchesETag(c.GetHeader("If-None-Match"), tag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(status, "application/json; charset=utf-8", b)
+}
+
+// SetRequireIfMatch makes IfMatch refuse changes that don't send If-Match,
+// for --require-if-match.
+func (s *State) SetRequireIfMatch(v bool) {
+	s.requireIfMatch.Store(v)
+}
+
+// RequireIfMatch reports whether updates and deletes must send If-Match.
+func (s *State) RequireIfMatch() bool {
+	return s.requireIfMatch.Load()
+}
+
+// IfMatch enforces an If-Match precondition on an update or delete of the
+// entry noun (e.g. "Group"), where current is the entry as GET returns it.
+// It answers 412 if the header names another version, or 428 if there is
+// none and RequireIfMatch is set, and reports whether to go ahead.
+func (s *State) IfMatch(c *gin.Context, noun string, current interface{}) bool {
+	want := c.GetHeader("If-Match")
+	if want == "" {
+		if s.RequireIfMatch() {
+			c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match is required: send the ETag from a GET of the " + strings.ToLower(noun)})
+			return false
+		}
+		return true
+	}
+	b, err := json.Marshal(current)
+	if err != nil || !MatchesETag(want, ETag(b)) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": noun + " has changed since it was read"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"errors"
+	"time"
+)
+
+// Expiry makes a list entry temporary. It's embedded in the ACL and SSH
+// input types, so clients set it, and it never reaches the synced policy.
+type Expiry struct {
+	// ExpiresAt is when the entry stops applying. Expired entries are left
+	// out of the policy and then removed (or disabled) by the reaper.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Disabled keeps the entry in TACL but out of the policy.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// ExpiryFields are the JSON keys of Expiry.
+var ExpiryFields = []string{"expiresAt", "disabled"}
+
+// Validate rejects an enabled entry that has already expired.
+func (e Expiry) Validate() error {
+	if e.ExpiresAt != nil && !e.Disabled && !e.ExpiresAt.After(time.Now()) {
+		return errors.New("'expiresAt' must be in the future")
+	}
+	return nil
+}
+
+// Expired reports whether the entry has an expiry at or before now.
+func (e Expiry) Expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !e.ExpiresAt.After(now)
+}
+
+// InactiveEntry reports whether a decoded list entry is disabled or expired
+// at now, i.e. must not be part of the policy.
+func InactiveEntry(entry map[string]interface{}, now time.Time) bool {
+	if disabled, _ := entry["disabled"].(bool); disabled {
+		return true
+	}
+	return ExpiredEntry(entry, now)
+}
+
+// ExpiredEntry reports whether a decoded list entry has expired at now.
+func ExpiredEntry(entry map[string]interface{}, now time.Time) bool {
+	raw, _ := entry["expiresAt"].(string)
+	if raw == "" {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	return err == nil && Expiry{ExpiresAt: &t}.Expired(now)
+}
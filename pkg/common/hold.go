@@ -0,0 +1,137 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Rejection replaces the response of a change a Hold check turned down.
+type Rejection struct {
+	Status int
+	Body   interface{}
+	// Reason completes "Change ..." in the error returned if the change
+	// can't be reverted, e.g. "exceeded the risk threshold".
+	Reason string
+}
+
+func (r *Rejection) Error() string {
+	return "change " + r.Reason
+}
+
+// Hold runs the rest of the chain with the response held back, so a
+// middleware can inspect a change after the handler saved it and undo it.
+// Handlers save before they respond, so check runs when a 2xx response
+// starts. If it returns a Rejection, keys are restored to their values from
+// before the handler ran and the rejection is written instead. It must run
+// inside SerializeMutations.
+func Hold(c *gin.Context, state *State, keys []string, logger *zap.Logger, check func() *Rejection) {
+	hw := &holdWriter{
+		ResponseWriter: c.Writer,
+		state:          state,
+		logger:         logger,
+		check:          check,
+		saved:          make(map[string]json.RawMessage, len(keys)),
+	}
+	for _, key := range keys {
+		b, _ := json.Marshal(state.GetValue(key))
+		hw.saved[key] = b
+	}
+	c.Writer = hw
+	c.Next()
+	// Responses without a body are only written out after this
+	hw.run()
+}
+
+// holdWriter holds back the response until the change is checked.
+type holdWriter struct {
+	gin.ResponseWriter
+	state   *State
+	logger  *zap.Logger
+	check   func() *Rejection
+	saved   map[string]json.RawMessage
+	checked bool
+	blocked bool
+}
+
+// run checks once, before anything is written.
+func (w *holdWriter) run() {
+	if w.checked {
+		return
+	}
+	w.checked = true
+	if w.ResponseWriter.Status() >= 300 {
+		return
+	}
+	rej := w.check()
+	if rej == nil {
+		return
+	}
+	w.blocked = true
+
+	if err := w.revert(); err != nil {
+		w.logger.Error("Failed to revert a rejected change", zap.String("reason", rej.Reason), zap.Error(err))
+		w.reply(http.StatusInternalServerError, gin.H{"error": "Change " + rej.Reason + " and could not be reverted"})
+		return
+	}
+	w.reply(rej.Status, rej.Body)
+}
+
+// revert restores the keys the change touched.
+func (w *holdWriter) revert() error {
+	restore := make(map[string]interface{})
+	for key, prev := range w.saved {
+		now, _ := json.Marshal(w.state.GetValue(key))
+		if string(now) == string(prev) {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(prev, &v); err != nil {
+			return err
+		}
+		restore[key] = v
+	}
+	if len(restore) == 0 {
+		return nil
+	}
+	return w.state.UpdateKeysAndSaveContext(SkipSaveCheck(context.Background()), restore)
+}
+
+// reply replaces the handler's response.
+func (w *holdWriter) reply(code int, body interface{}) {
+	b, _ := json.Marshal(body)
+	w.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.WriteHeader(code)
+	_, _ = w.ResponseWriter.Write(b)
+}
+
+func (w *holdWriter) WriteHeaderNow() {
+	w.run()
+	if !w.blocked {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *holdWriter) Write(b []byte) (int, error) {
+	w.run()
+	if w.blocked {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *holdWriter) WriteString(s string) (int, error) {
+	w.run()
+	if w.blocked {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *holdWriter) Flush() {
+	w.run()
+	w.ResponseWriter.Flush()
+}
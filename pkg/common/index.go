@@ -0,0 +1,113 @@
+package common
+
+import "sync"
+
+// KeyVersion returns a counter that changes whenever any of the given
+// top-level keys is written or the whole state is replaced. Values only
+// increase, so callers can cache anything derived from those keys and
+// compare versions to know when to rebuild.
+func (s *State) KeyVersion(keys ...string) uint64 {
+	s.RWLock.RLock()
+	defer s.RWLock.RUnlock()
+
+	v := s.epoch
+	for _, k := range keys {
+		if kv := s.versions[k]; kv > v {
+			v = kv
+		}
+	}
+	return v
+}
+
+// bumpLocked records a write to keys. The caller holds RWLock.
+func (s *State) bumpLocked(keys []string) {
+	if s.versions == nil {
+		s.versions = make(map[string]uint64)
+	}
+	s.generation++
+	for _, k := range keys {
+		s.versions[k] = s.generation
+	}
+}
+
+// replacedLocked records that Data was swapped wholesale. The caller holds
+// RWLock.
+func (s *State) replacedLocked() {
+	s.generation++
+	s.epoch = s.generation
+	s.versions = nil
+}
+
+// Index keeps the decoded entries of a section along with a lookup by
+// ID or name, so single-entry reads don't re-decode and scan the section
+// on every request. It rebuilds itself lazily after the section's keys
+// change.
+//
+// Entries returned by an Index are shared between callers and must be
+// treated as read-only; read-modify-write cycles should keep decoding
+// their own copy.
+type Index[T any] struct {
+	keys  []string
+	load  func(*State) ([]T, error)
+	keyOf func(T) string
+
+	mu      sync.Mutex
+	built   bool
+	version uint64
+	list    []T
+	byKey   map[string]int
+}
+
+// NewIndex returns an Index over the entries load decodes from state,
+// keyed by keyOf. keys are the top-level state keys load reads from.
+func NewIndex[T any](load func(*State) ([]T, error), keyOf func(T) string, keys ...string) *Index[T] {
+	return &Index[T]{keys: keys, load: load, keyOf: keyOf}
+}
+
+// List returns every entry, in the order load returned them.
+func (ix *Index[T]) List(state *State) ([]T, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if err := ix.refreshLocked(state); err != nil {
+		return nil, err
+	}
+	return ix.list, nil
+}
+
+// Get returns the entry with the given key, if any.
+func (ix *Index[T]) Get(state *State, key string) (T, bool, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	var zero T
+	if err := ix.refreshLocked(state); err != nil {
+		return zero, false, err
+	}
+	i, ok := ix.byKey[key]
+	if !ok {
+		return zero, false, nil
+	}
+	return ix.list[i], true, nil
+}
+
+func (ix *Index[T]) refreshLocked(state *State) error {
+	// Read the version first: if the section changes while we decode it,
+	// the next lookup sees a newer version and rebuilds again.
+	v := state.KeyVersion(ix.keys...)
+	if ix.built && ix.version == v {
+		return nil
+	}
+	list, err := ix.load(state)
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string]int, len(list))
+	for i, e := range list {
+		if _, dup := byKey[ix.keyOf(e)]; !dup {
+			byKey[ix.keyOf(e)] = i
+		}
+	}
+	ix.list, ix.byKey, ix.version, ix.built = list, byKey, v, true
+	return nil
+}
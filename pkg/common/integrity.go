@@ -0,0 +1,301 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// Every stored state object gets a "<name>.sha256" sidecar in sha256sum
+// format, and the previous version of both is kept as "<name>.bak" and
+// "<name>.bak.sha256". Loading verifies the checksum and falls back to the
+// backup when the object is corrupt.
+const (
+	checksumSuffix = ".sha256"
+	backupSuffix   = ".bak"
+)
+
+// Integrity statuses.
+const (
+	IntegrityOK         = "ok"         // checksums matched
+	IntegrityUnverified = "unverified" // no checksum stored yet; one is written with the next save
+	IntegrityRecovered  = "recovered"  // stored state was corrupt and the backup was loaded
+	IntegrityCorrupt    = "corrupt"    // stored state was corrupt and no usable backup exists
+)
+
+// ErrCorrupt is returned when stored state fails its checksum or doesn't parse.
+var ErrCorrupt = errors.New("state is corrupt")
+
+// Integrity is the result of verifying the state when it was last loaded.
+type Integrity struct {
+	Status    string    `json:"status"`
+	Checksum  string    `json:"checksum,omitempty"` // sha256 of the loaded document, for whole-file storage
+	Error     string    `json:"error,omitempty"`    // what was wrong with the primary copy
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Integrity reports the result of the last load.
+func (s *State) Integrity() Integrity {
+	if in := s.integrity.Load(); in != nil {
+		return *in
+	}
+	return Integrity{}
+}
+
+func (s *State) setIntegrity(in Integrity) {
+	in.CheckedAt = time.Now().UTC()
+	s.integrity.Store(&in)
+	if s.Logger == nil {
+		return
+	}
+	switch in.Status {
+	case IntegrityRecovered:
+		s.Logger.Warn("Stored state failed its integrity check; loaded the backup instead",
+			zap.String("storage", s.Storage), zap.String("error", in.Error))
+	case IntegrityUnverified:
+		s.Logger.Info("No state checksum found; one will be written with the next save",
+			zap.String("storage", s.Storage))
+	}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeVerified stores data at loc (a file path or S3 object key) with its
+// checksum, keeping the previous version as the backup.
+func (s *State) writeVerified(ctx context.Context, loc string, data []byte) error {
+	for _, suffix := range []string{"", checksumSuffix} {
+		if err := s.rotateObject(ctx, loc+suffix, loc+backupSuffix+suffix); err != nil {
+			return fmt.Errorf("keeping backup: %w", err)
+		}
+	}
+	return s.writeChecked(ctx, loc, data)
+}
+
+func (s *State) writeChecked(ctx context.Context, loc string, data []byte) error {
+	if err := s.writeObject(ctx, loc, data); err != nil {
+		return err
+	}
+	line := checksum(data) + "  " + path.Base(loc) + "\n"
+	return s.writeObject(ctx, loc+checksumSuffix, []byte(line))
+}
+
+// readVerified reads loc and passes it to decode. If it is missing, fails
+// its checksum or doesn't decode, the backup is decoded instead and
+// restored as the primary copy. Storage errors are returned as they are.
+func (s *State) readVerified(ctx context.Context, loc string, decode func([]byte) error) (Integrity, error) {
+	in, _, err := s.readChecked(ctx, loc, decode)
+	if err == nil {
+		return in, nil
+	}
+	if !errors.Is(err, ErrCorrupt) && !errors.Is(err, fs.ErrNotExist) {
+		return Integrity{}, err
+	}
+	primaryErr := err
+
+	_, backup, err := s.readChecked(ctx, loc+backupSuffix, decode)
+	if err != nil {
+		if errors.Is(primaryErr, fs.ErrNotExist) {
+			return Integrity{}, primaryErr
+		}
+		return Integrity{Status: IntegrityCorrupt, Error: primaryErr.Error()}, primaryErr
+	}
+	// Put the good copy back, so the next save doesn't rotate the corrupt
+	// one over the backup
+	if err := s.writeChecked(ctx, loc, backup); err != nil && s.Logger != nil {
+		s.Logger.Error("Failed to restore state from backup", zap.String("location", loc), zap.Error(err))
+	}
+	return Integrity{Status: IntegrityRecovered, Checksum: checksum(backup), Error: primaryErr.Error()}, nil
+}
+
+// readChecked reads loc, verifies it against its sidecar if there is one,
+// and decodes it.
+func (s *State) readChecked(ctx context.Context, loc string, decode func([]byte) error) (Integrity, []byte, error) {
+	data, err := s.readObject(ctx, loc)
+	if err != nil {
+		return Integrity{}, nil, err
+	}
+	in := Integrity{Status: IntegrityUnverified, Checksum: checksum(data)}
+
+	line, err := s.readObject(ctx, loc+checksumSuffix)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return Integrity{}, nil, err
+	default:
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 || fields[0] != in.Checksum {
+			return Integrity{}, nil, fmt.Errorf("%w: %s does not match its checksum", ErrCorrupt, path.Base(loc))
+		}
+		in.Status = IntegrityOK
+	}
+
+	if err := decode(data); err != nil {
+		return Integrity{}, nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, path.Base(loc), err)
+	}
+	return in, data, nil
+}
+
+// decodeObject returns a decode func for readVerified that unmarshals into
+// a fresh map each time.
+func decodeObject(out *map[string]interface{}) func([]byte) error {
+	return func(b []byte) error {
+		m := make(map[string]interface{})
+		if err := json.Unmarshal(b, &m); err != nil {
+			return err
+		}
+		if m == nil {
+			m = make(map[string]interface{})
+		}
+		*out = m
+		return nil
+	}
+}
+
+// mergeIntegrity combines per-key results into one.
+func mergeIntegrity(all map[string]Integrity) Integrity {
+	out := Integrity{Status: IntegrityOK}
+	var problems []string
+	for key, in := range all {
+		switch in.Status {
+		case IntegrityRecovered:
+			out.Status = IntegrityRecovered
+			problems = append(problems, key+": "+in.Error)
+		case IntegrityUnverified:
+			if out.Status == IntegrityOK {
+				out.Status = IntegrityUnverified
+			}
+		}
+	}
+	out.Error = strings.Join(problems, "; ")
+	return out
+}
+
+func (s *State) readObject(ctx context.Context, loc string) ([]byte, error) {
+	if s.Objects != nil {
+		return s.objects(ctx).Get(ctx, loc)
+	}
+	if strings.HasPrefix(s.Storage, "file://") {
+		return os.ReadFile(loc)
+	}
+	obj, err := s.S3Client.GetObject(ctx, s.Bucket, loc, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, fmt.Errorf("%s: %w", loc, fs.ErrNotExist)
+	}
+	return data, err
+}
+
+func (s *State) writeObject(ctx context.Context, loc string, data []byte) error {
+	if s.Objects != nil {
+		return s.objects(ctx).Put(ctx, loc, data)
+	}
+	if strings.HasPrefix(s.Storage, "file://") {
+		return writeFileAtomic(loc, data, 0644)
+	}
+	var opts minio.PutObjectOptions
+	if strings.HasSuffix(loc, keyObjectSuffix) {
+		opts.ContentType = "application/json"
+	}
+	_, err := s.S3Client.PutObject(ctx, s.Bucket, loc, bytes.NewReader(data), int64(len(data)), opts)
+	return err
+}
+
+// writeFileAtomic writes data to a temporary file next to name, syncs it
+// and renames it over name, so a crash leaves either the old file or the
+// new one, never a truncated mix.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(name)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // no-op once renamed
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	// Make the rename (and the backup rotated before it) durable too. Not
+	// every platform can sync a directory, so this is best effort.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// rotateObject moves from to to. If from doesn't exist, to is removed so a
+// stale backup checksum is never paired with a newer backup.
+func (s *State) rotateObject(ctx context.Context, from, to string) error {
+	if s.Objects != nil {
+		err := s.objects(ctx).Rename(ctx, from, to)
+		if errors.Is(err, fs.ErrNotExist) {
+			return s.removeObject(ctx, to)
+		}
+		return err
+	}
+	if strings.HasPrefix(s.Storage, "file://") {
+		err := os.Rename(from, to)
+		if errors.Is(err, fs.ErrNotExist) {
+			return s.removeObject(ctx, to)
+		}
+		return err
+	}
+	_, err := s.S3Client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.Bucket, Object: to},
+		minio.CopySrcOptions{Bucket: s.Bucket, Object: from})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return s.removeObject(ctx, to)
+	}
+	return err
+}
+
+// removeObject deletes loc. A missing object is not an error.
+func (s *State) removeObject(ctx context.Context, loc string) error {
+	if s.Objects != nil {
+		return s.objects(ctx).Remove(ctx, loc)
+	}
+	if strings.HasPrefix(s.Storage, "file://") {
+		if err := os.Remove(loc); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return s.S3Client.RemoveObject(ctx, s.Bucket, loc, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+)
+
+// maxPooledBuffer is the largest buffer put back in the pool, so one huge
+// response doesn't pin its memory forever.
+const maxPooledBuffer = 4 << 20
+
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// GetBuffer returns an empty buffer from a shared pool. Return it with
+// PutBuffer once nothing references its bytes.
+func GetBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// PutBuffer returns a buffer obtained from GetBuffer.
+func PutBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	b.Reset()
+	bufferPool.Put(b)
+}
+
+// WriteJSONObject writes m as a JSON object one top-level key at a time, so
+// only the largest section is ever held encoded in memory. Keys are sorted
+// and the output matches json.Marshal, or json.MarshalIndent with two-space
+// indentation when indent is set.
+func WriteJSONObject(w io.Writer, m map[string]interface{}, indent bool) error {
+	if len(m) == 0 {
+		_, err := io.WriteString(w, "{}")
+		return err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	enc := json.NewEncoder(buf)
+	if indent {
+		enc.SetIndent("  ", "  ")
+	}
+
+	open, sep, colon, end := "{", ",", ":", "}"
+	if indent {
+		open, sep, colon, end = "{\n  ", ",\n  ", ": ", "\n}"
+	}
+	if _, err := io.WriteString(w, open); err != nil {
+		return err
+	}
+	for i, k := range keys {
+		buf.Reset()
+		if i > 0 {
+			buf.WriteString(sep)
+		}
+		if err := enc.Encode(k); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1) // Encode's trailing newline
+		buf.WriteString(colon)
+		if err := enc.Encode(m[k]); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1)
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, end)
+	return err
+}
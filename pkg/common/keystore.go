@@ -0,0 +1,172 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// A storage URL ending in "/" (file:///var/lib/tacl/ or s3://bucket/tacl/)
+// keeps each top-level key in its own "<key>.json" object, so a mutation
+// rewrites only the keys it changed instead of the whole document.
+
+const keyObjectSuffix = ".json"
+
+// PerKey reports whether the storage keeps one object per top-level key.
+func (s *State) PerKey() bool {
+	return strings.HasSuffix(s.Storage, "/")
+}
+
+func keyObjectName(key string) string {
+	return url.PathEscape(key) + keyObjectSuffix
+}
+
+func keyFromObjectName(name string) (string, bool) {
+	if !strings.HasSuffix(name, keyObjectSuffix) || strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	key, err := url.PathUnescape(strings.TrimSuffix(name, keyObjectSuffix))
+	return key, err == nil
+}
+
+// saveKeys writes the given keys, each as its own object with its own
+// checksum and backup.
+func (s *State) saveKeys(ctx context.Context, values map[string]json.RawMessage) error {
+	for key, raw := range values {
+		switch {
+		case s.Objects != nil:
+		case strings.HasPrefix(s.Storage, "file://"):
+			raw = append(raw, '\n')
+		case s.S3Client != nil:
+		default:
+			return fmt.Errorf("unrecognized storage %q", s.Storage)
+		}
+		if err := s.writeVerified(ctx, s.keyLocation(key), raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyLocation is the file path, S3 object key or object name holding key.
+func (s *State) keyLocation(key string) string {
+	if s.Objects != nil {
+		return s.objectPath() + keyObjectName(key)
+	}
+	if strings.HasPrefix(s.Storage, "file://") {
+		return filepath.Join(s.filePath(), keyObjectName(key))
+	}
+	return s.ObjectKey + keyObjectName(key)
+}
+
+// listKeys returns the keys currently stored.
+func (s *State) listKeys(ctx context.Context) ([]string, error) {
+	var names []string
+	switch {
+	case s.Objects != nil:
+		all, err := s.objects(ctx).List(ctx, s.objectPath())
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range all {
+			// only the keys themselves, not revisions below them
+			if n = strings.TrimPrefix(n, s.objectPath()); !strings.Contains(n, "/") {
+				names = append(names, n)
+			}
+		}
+	case strings.HasPrefix(s.Storage, "file://"):
+		entries, err := os.ReadDir(s.filePath())
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				names = append(names, e.Name())
+			}
+		}
+	case s.S3Client != nil:
+		for obj := range s.S3Client.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Prefix: s.ObjectKey}) {
+			if obj.Err != nil {
+				return nil, obj.Err
+			}
+			names = append(names, strings.TrimPrefix(obj.Key, s.ObjectKey))
+		}
+	default:
+		return nil, fmt.Errorf("unrecognized storage %q", s.Storage)
+	}
+
+	var keys []string
+	for _, n := range names {
+		if key, ok := keyFromObjectName(n); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// loadKeys reads and verifies every stored key into a new map.
+func (s *State) loadKeys(ctx context.Context) (map[string]interface{}, Integrity, error) {
+	keys, err := s.listKeys(ctx)
+	if err != nil {
+		return nil, Integrity{}, err
+	}
+	data := make(map[string]interface{}, len(keys))
+	checked := make(map[string]Integrity, len(keys))
+	for _, key := range keys {
+		var v interface{}
+		in, err := s.readVerified(ctx, s.keyLocation(key), func(b []byte) error {
+			v = nil
+			return json.Unmarshal(b, &v)
+		})
+		if err != nil {
+			if in.Status == IntegrityCorrupt {
+				in.Error = key + ": " + in.Error
+			}
+			return nil, in, fmt.Errorf("reading %s: %w", key, err)
+		}
+		data[key] = v
+		checked[key] = in
+	}
+	return data, mergeIntegrity(checked), nil
+}
+
+// replaceKeys stores data as the complete state: every key is written and
+// stored keys missing from data are removed.
+func (s *State) replaceKeys(ctx context.Context, data map[string]interface{}) error {
+	values := make(map[string]json.RawMessage, len(data))
+	for k, v := range data {
+		raw, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		values[k] = raw
+	}
+	if err := s.saveKeys(ctx, values); err != nil {
+		return err
+	}
+	existing, err := s.listKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, key := range existing {
+		if _, keep := data[key]; keep {
+			continue
+		}
+		for _, suffix := range []string{"", checksumSuffix} {
+			if err := s.removeObject(ctx, s.keyLocation(key)+suffix); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *State) filePath() string {
+	return strings.TrimPrefix(s.Storage, "file://")
+}
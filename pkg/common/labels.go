@@ -0,0 +1,114 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Labels are arbitrary key/value pairs on an entry (team=payments,
+// env=prod), for filtering and bulk operations. They're TACL-only and
+// stripped before sync.
+type Labels map[string]string
+
+// Labeled is embedded in the input types of list sections.
+type Labeled struct {
+	Labels Labels `json:"labels,omitempty"`
+}
+
+// LabelFields are the JSON keys of Labeled.
+var LabelFields = []string{"labels"}
+
+var (
+	labelKey   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+	labelValue = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// Validate checks label keys and values: up to 63 alphanumerics, '.', '_'
+// or '-' (and '/' in keys), starting and ending with an alphanumeric.
+func (l Labels) Validate() error {
+	for _, k := range l.keys() {
+		if !labelKey.MatchString(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if !labelValue.MatchString(l[k]) {
+			return fmt.Errorf("invalid value %q for label %q", l[k], k)
+		}
+	}
+	return nil
+}
+
+func (l Labels) keys() []string {
+	out := make([]string, 0, len(l))
+	for k := range l {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// labelRequirement is one term of a Selector.
+type labelRequirement struct {
+	key, op, value string // op is "=", "!=", "" (key exists) or "!" (key absent)
+}
+
+// Selector matches entries by label. All of its terms must match.
+type Selector []labelRequirement
+
+// ParseSelector parses label selectors like "env=prod", "team!=payments",
+// "owner" (has the label) or "!temporary" (doesn't). Each expression may
+// hold several comma-separated terms.
+func ParseSelector(exprs []string) (Selector, error) {
+	var sel Selector
+	for _, expr := range exprs {
+		for _, term := range strings.Split(expr, ",") {
+			term = strings.TrimSpace(term)
+			if term == "" {
+				continue
+			}
+			var req labelRequirement
+			if k, v, ok := strings.Cut(term, "!="); ok {
+				req = labelRequirement{key: k, op: "!=", value: v}
+			} else if k, v, ok := strings.Cut(term, "="); ok {
+				req = labelRequirement{key: k, op: "=", value: strings.TrimPrefix(v, "=")}
+			} else if k, ok := strings.CutPrefix(term, "!"); ok {
+				req = labelRequirement{key: k, op: "!"}
+			} else {
+				req = labelRequirement{key: term}
+			}
+			req.key, req.value = strings.TrimSpace(req.key), strings.TrimSpace(req.value)
+			if !labelKey.MatchString(req.key) {
+				return nil, fmt.Errorf("invalid label selector %q", term)
+			}
+			sel = append(sel, req)
+		}
+	}
+	return sel, nil
+}
+
+// Matches reports whether l satisfies every term.
+func (s Selector) Matches(l Labels) bool {
+	for _, req := range s {
+		v, has := l[req.key]
+		switch req.op {
+		case "=":
+			if !has || v != req.value {
+				return false
+			}
+		case "!=":
+			if has && v == req.value {
+				return false
+			}
+		case "!":
+			if has {
+				return false
+			}
+		default:
+			if !has {
+				return false
+			}
+		}
+	}
+	return true
+}
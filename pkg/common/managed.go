@@ -0,0 +1,56 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ManagedByHeader names the source of a request, e.g. "terraform" or
+// "idp-sync". Entries record the source that created them as their owner.
+const ManagedByHeader = "X-Tacl-Managed-By"
+
+// ManagedManual is the source of requests without ManagedByHeader.
+const ManagedManual = "manual"
+
+// ManagedBy returns the source of the request, lowercased.
+func ManagedBy(c *gin.Context) string {
+	if v := strings.ToLower(strings.TrimSpace(c.GetHeader(ManagedByHeader))); v != "" {
+		return v
+	}
+	return ManagedManual
+}
+
+// ManagedError is returned by CheckManaged for an entry another source owns.
+// Its message completes "<entry> is ...".
+type ManagedError struct {
+	Owner  string
+	Source string
+}
+
+func (e *ManagedError) Error() string {
+	return fmt.Sprintf("managed by %s, not %s (send %s: %s to override)", e.Owner, e.Source, ManagedByHeader, e.Owner)
+}
+
+// EnforceManagedBy turns on CheckManaged. Call it once, before serving.
+func (s *State) EnforceManagedBy(v bool) {
+	s.enforceManaged = v
+}
+
+// CheckManaged returns a *ManagedError if ownership is enforced and the
+// entry described by m is owned by a source other than the request's.
+// Entries without an owner (created before ownership was recorded) may be
+// changed by anyone, as may any entry by the server's own background jobs.
+func (s *State) CheckManaged(c *gin.Context, m EntryMeta) error {
+	if !s.enforceManaged || m.ManagedBy == "" {
+		return nil
+	}
+	if _, internal := InternalIdentity(c.Request); internal && c.GetHeader(ManagedByHeader) == "" {
+		return nil
+	}
+	if source := ManagedBy(c); source != m.ManagedBy {
+		return &ManagedError{Owner: m.ManagedBy, Source: source}
+	}
+	return nil
+}
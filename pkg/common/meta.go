@@ -0,0 +1,80 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EntryMeta records who created and last changed an entry. It's embedded in
+// the stored entry types and stripped from the policy before sync.
+type EntryMeta struct {
+	CreatedBy string     `json:"createdBy,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedBy string     `json:"updatedBy,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// ManagedBy is the source that owns the entry, e.g. "terraform" or
+	// "manual" (see ManagedByHeader).
+	ManagedBy string `json:"managedBy,omitempty"`
+}
+
+// MetaFields are the JSON keys of EntryMeta.
+var MetaFields = []string{"createdBy", "createdAt", "updatedBy", "updatedAt", "managedBy"}
+
+// NewEntryMeta stamps a freshly created entry.
+func NewEntryMeta(actor string) EntryMeta {
+	now := time.Now().UTC()
+	return EntryMeta{
+		CreatedBy: actor,
+		CreatedAt: &now,
+		UpdatedBy: actor,
+		UpdatedAt: &now,
+	}
+}
+
+// NewRequestMeta stamps an entry created by the request's caller, owned by
+// the request's source.
+func NewRequestMeta(c *gin.Context) EntryMeta {
+	m := NewEntryMeta(Actor(c))
+	m.ManagedBy = ManagedBy(c)
+	return m
+}
+
+// Touched returns a copy of m marking an update by actor, keeping the
+// creation fields and the owner.
+func (m EntryMeta) Touched(actor string) EntryMeta {
+	now := time.Now().UTC()
+	m.UpdatedBy = actor
+	m.UpdatedAt = &now
+	return m
+}
+
+// Actor returns the name of the authenticated caller for attribution.
+func Actor(c *gin.Context) string {
+	id, _ := GetIdentity(c)
+	return id.Actor()
+}
+
+// SectionMetaKey returns the internal state key holding EntryMeta for a
+// map-shaped section (e.g. "groups" => "_groupsMeta"). Map-shaped sections
+// store plain values, so their metadata has to live alongside.
+func SectionMetaKey(section string) string {
+	return "_" + section + "Meta"
+}
+
+// LoadSectionMeta returns the per-entry metadata for a map-shaped section,
+// keyed by entry name. It never returns nil.
+func LoadSectionMeta(s *State, section string) map[string]EntryMeta {
+	out := make(map[string]EntryMeta)
+	raw := s.GetValue(SectionMetaKey(section))
+	if raw == nil {
+		return out
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return out
+	}
+	_ = json.Unmarshal(b, &out)
+	return out
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IsMutatingMethod reports whether the HTTP method changes state.
+func IsMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// FirstPathSegment returns the first segment of a URL path, e.g. "acls" for
+// "/acls/1234". It's how TACL maps requests to resource modules.
+func FirstPathSegment(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return "" // e.g. root "/"
+	}
+	first, _, _ := strings.Cut(path, "/")
+	return first
+}
+
+// SerializeMutations runs every mutating request under the state's mutation
+// locks, so handlers that load a section, modify it and save it back can't
+// interleave. Requests to a resource module only lock that module's section,
+// so e.g. an SSH rule update doesn't wait for a group edit; everything else
+// locks the whole state. Reads are left alone and keep using the RWLock.
+//
+// This is what makes parallel clients (e.g. `terraform apply -parallelism=10`)
+// safe against lost updates on the array-backed endpoints.
+func SerializeMutations(state *State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		// Internal requests and the operations of a batch are dispatched by a
+		// handler that already holds the lock
+		if _, internal := InternalIdentity(c.Request); internal || InBatch(c.Request) {
+			c.Next()
+			return
+		}
+		if section, ok := SectionForResource(FirstPathSegment(c.Request.URL.Path)); ok {
+			unlock := state.LockSection(section)
+			defer unlock()
+			c.Next()
+			return
+		}
+		state.LockMutations()
+		defer state.UnlockMutations()
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package common
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Normalization puts input in one canonical form on write, so logically
+// identical submissions are stored identically and don't show up as diffs
+// in storage, Terraform plans or syncs.
+
+// NormalizeWord trims and lowercases a keyword such as a protocol or action.
+func NormalizeWord(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// NormalizeAddress canonicalizes an IP address or CIDR ("10.0.0.5/24"
+// becomes "10.0.0.0/24", IPv6 is compressed). Anything else, such as a
+// tag or user, is only trimmed.
+func NormalizeAddress(s string) string {
+	s = strings.TrimSpace(s)
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked().String()
+	}
+	if a, err := netip.ParseAddr(s); err == nil {
+		return a.String()
+	}
+	return s
+}
+
+// NormalizeDestination canonicalizes the address part of a "host:ports"
+// destination, e.g. "10.0.0.5/24:22".
+func NormalizeDestination(s string) string {
+	s = strings.TrimSpace(s)
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return s
+	}
+	return NormalizeAddress(s[:i]) + s[i:]
+}
+
+// NormalizeList trims and canonicalizes (with NormalizeAddress) each
+// entry, drops empty ones, and sorts and dedupes the rest. For lists whose
+// order doesn't matter: sources, destinations, members, owners, rules.
+func NormalizeList(list []string) []string {
+	return normalizeList(list, NormalizeAddress)
+}
+
+// NormalizeDestinations is NormalizeList for "host:ports" destinations.
+func NormalizeDestinations(list []string) []string {
+	return normalizeList(list, NormalizeDestination)
+}
+
+func normalizeList(list []string, canonical func(string) string) []string {
+	if list == nil {
+		return nil
+	}
+	out := make([]string, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, s := range list {
+		s = canonical(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrConflict is wrapped by the error of an ObjectStore write that found
+// an object changed by another server since it was last read. The write
+// is dropped rather than retried and the state reloaded.
+var ErrConflict = errors.New("state was changed by another server")
+
+// ObjectStore is a storage backend other than files and S3, set as
+// State.Objects: a flat namespace of named objects, e.g. an in-memory map
+// for tests. Object names are what follows "<scheme>://" in State.Storage,
+// plus the suffixes the file and S3 backends use ("state.json.sha256",
+// "tacl/acls.json", ...), so checksums, backups, per-key storage and
+// revisions all work the same on it.
+type ObjectStore interface {
+	// Get returns the object's contents, or an error wrapping
+	// fs.ErrNotExist if there is none.
+	Get(ctx context.Context, name string) ([]byte, error)
+	// Put creates or replaces an object.
+	Put(ctx context.Context, name string, data []byte) error
+	// Rename moves from over to, returning an error wrapping
+	// fs.ErrNotExist if from doesn't exist.
+	Rename(ctx context.Context, from, to string) error
+	// Remove deletes an object. A missing object is not an error.
+	Remove(ctx context.Context, name string) error
+	// List returns the names of the objects starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// objectPath is State.Storage without its scheme, the name of the state
+// object (or the prefix of per-key objects) in an ObjectStore.
+func (s *State) objectPath() string {
+	if _, p, ok := strings.Cut(s.Storage, "://"); ok {
+		return p
+	}
+	return s.Storage
+}
+
+// TxObjectStore is an ObjectStore that can apply several changes at once,
+// such as a database. A write to State (the object, its checksum and
+// backup, or every key of a per-key mutation) then commits as a whole or
+// not at all.
+type TxObjectStore interface {
+	ObjectStore
+	// Tx runs fn with a view of the store whose changes are committed
+	// together if fn returns nil, and discarded otherwise.
+	Tx(ctx context.Context, fn func(ObjectStore) error) error
+}
+
+type txObjectsKey struct{}
+
+type loadingKey struct{}
+
+// loading marks ctx as that of reads loading the state into memory.
+func loading(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadingKey{}, true)
+}
+
+// Loading reports whether an ObjectStore read is loading the state into
+// memory, rather than checking or listing storage. A store that detects
+// conflicting writes (see ErrConflict) records what it saw from these
+// reads only.
+func Loading(ctx context.Context) bool {
+	v, _ := ctx.Value(loadingKey{}).(bool)
+	return v
+}
+
+// objects is the ObjectStore to use under ctx: the transaction inTx
+// opened, if any, and otherwise s.Objects.
+func (s *State) objects(ctx context.Context) ObjectStore {
+	if tx, ok := ctx.Value(txObjectsKey{}).(ObjectStore); ok {
+		return tx
+	}
+	return s.Objects
+}
+
+// inTx runs fn in a transaction if s.Objects supports them, and as is
+// otherwise.
+func (s *State) inTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	txs, ok := s.Objects.(TxObjectStore)
+	if !ok {
+		return fn(ctx)
+	}
+	return txs.Tx(ctx, func(tx ObjectStore) error {
+		return fn(context.WithValue(ctx, txObjectsKey{}, tx))
+	})
+}
@@ -0,0 +1,42 @@
+package common
+
+import "sort"
+
+// Prioritized orders a list entry in the synced policy. It's embedded in
+// the ACL and SSH input types and never reaches the synced policy itself.
+type Prioritized struct {
+	// Priority sorts the entry among the others of its section, lowest
+	// first. Entries of the same priority are ordered by ID.
+	Priority int `json:"priority,omitempty"`
+}
+
+// PriorityFields are the JSON keys of Prioritized.
+var PriorityFields = []string{"priority"}
+
+// SortEntries stable-sorts the decoded entries of a list section by
+// priority, then ID, so the same entries always come out in the same order
+// however they were stored. Entries that aren't objects keep their place
+// relative to each other, after the rest.
+func SortEntries(list []interface{}) {
+	rank := func(v interface{}) (ok bool, priority float64, id string) {
+		entry, ok := v.(map[string]interface{})
+		if !ok {
+			return false, 0, ""
+		}
+		priority, _ = entry["priority"].(float64)
+		id, _ = entry["id"].(string)
+		return true, priority, id
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		oi, pi, ii := rank(list[i])
+		oj, pj, ij := rank(list[j])
+		switch {
+		case oi != oj:
+			return oi
+		case pi != pj:
+			return pi < pj
+		default:
+			return ii < ij
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+var (
+	redactorsMu sync.RWMutex
+	redactors   = map[string]func(interface{}) interface{}{}
+)
+
+// RegisterRedactor registers fn to hide the secrets held under the state
+// key key (an internal one, like "_webhooks") wherever the state is shown
+// rather than stored: GET /state and debug logs. fn must not modify
+// its argument.
+func RegisterRedactor(key string, fn func(interface{}) interface{}) {
+	redactorsMu.Lock()
+	defer redactorsMu.Unlock()
+	redactors[key] = fn
+}
+
+// RedactedSnapshot is Snapshot with the registered redactors applied.
+func (s *State) RedactedSnapshot() map[string]interface{} {
+	snap := s.Snapshot()
+	redact(snap)
+	return snap
+}
+
+// redact applies the registered redactors to the state document data in
+// place.
+func redact(data map[string]interface{}) {
+	redactorsMu.RLock()
+	defer redactorsMu.RUnlock()
+	for k, fn := range redactors {
+		if v, ok := data[k]; ok && v != nil {
+			data[k] = fn(v)
+		}
+	}
+}
+
+// redactedJSON returns the encoded state document with the registered
+// redactors applied, for logging a write.
+func redactedJSON(encoded []byte) string {
+	var data map[string]interface{}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return "(unparsable state)"
+	}
+	redact(data)
+	var buf bytes.Buffer
+	if err := WriteJSONObject(&buf, data, true); err != nil {
+		return "(unencodable state)"
+	}
+	return buf.String()
+}
+
+// WriteRedactedJSON is WriteJSON with the registered redactors applied,
+// for showing the state to API clients.
+func (s *State) WriteRedactedJSON(w io.Writer) error {
+	return WriteJSONObject(w, s.RedactedSnapshot(), true)
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Whole-state snapshots are stored next to the state as
+// "<state>.revisions/<rev>.json" (or "<dir>/.revisions/<rev>.json" for
+// per-key storage), each with its own checksum.
+
+const revisionsDir = ".revisions"
+
+// revisionLocation is the file path, S3 object key or object name holding
+// rev.
+func (s *State) revisionLocation(rev int) string {
+	name := strconv.Itoa(rev) + keyObjectSuffix
+	if s.Objects != nil {
+		return s.objectPath() + revisionsDir + "/" + name
+	}
+	if strings.HasPrefix(s.Storage, "file://") {
+		if s.PerKey() {
+			return filepath.Join(s.filePath(), revisionsDir, name)
+		}
+		return s.filePath() + revisionsDir + "/" + name
+	}
+	return s.ObjectKey + revisionsDir + "/" + name
+}
+
+// SaveRevision stores data as snapshot rev.
+func (s *State) SaveRevision(ctx context.Context, rev int, data []byte) error {
+	loc := s.revisionLocation(rev)
+	if s.Objects == nil && strings.HasPrefix(s.Storage, "file://") {
+		if err := os.MkdirAll(filepath.Dir(loc), 0755); err != nil {
+			return err
+		}
+	}
+	return s.writeChecked(ctx, loc, data)
+}
+
+// LoadRevision reads and verifies snapshot rev. A missing snapshot is
+// reported with fs.ErrNotExist.
+func (s *State) LoadRevision(ctx context.Context, rev int) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	_, _, err := s.readChecked(ctx, s.revisionLocation(rev), func(b []byte) error {
+		data = make(map[string]interface{})
+		return json.Unmarshal(b, &data)
+	})
+	return data, err
+}
+
+// RemoveRevision deletes snapshot rev and its checksum.
+func (s *State) RemoveRevision(ctx context.Context, rev int) error {
+	loc := s.revisionLocation(rev)
+	for _, suffix := range []string{"", checksumSuffix} {
+		if err := s.removeObject(ctx, loc+suffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
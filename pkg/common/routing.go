@@ -0,0 +1,94 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigureRouting makes unmatched requests behave the same for every
+// module: a path no route serves gets a JSON 404, a method the path doesn't
+// support a JSON 405 with an Allow header, and OPTIONS a 204 with the
+// Allow header. Call it before registering routes.
+func ConfigureRouting(r *gin.Engine) {
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	})
+	r.NoMethod(func(c *gin.Context) {
+		// The router has set Allow to the path's other methods
+		allowed := strings.Split(c.Writer.Header().Get("Allow"), ", ")
+		for _, m := range allowed {
+			if m == http.MethodGet {
+				allowed = append(allowed, http.MethodHead)
+				break
+			}
+		}
+		allowed = append(allowed, http.MethodOptions)
+		c.Header("Allow", strings.Join(allowed, ", "))
+		if c.Request.Method == http.MethodOptions {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Method " + c.Request.Method + " not allowed"})
+	})
+}
+
+// CanonicalPaths wraps r so every module accepts the same spellings of its
+// paths. Call it once all routes are registered.
+//
+//   - The first segment is case-insensitive, so "/tagOwners" (the state
+//     key) reaches "/tagowners". Later segments, e.g. IDs, keep their case.
+//   - A trailing slash is ignored, "/acls/" is "/acls", except for routes
+//     registered with one (e.g. "/debug/pprof/").
+//   - HEAD is served by the GET handler, without the body.
+func CanonicalPaths(r *gin.Engine) http.Handler {
+	var exact, prefixes []string
+	for _, route := range r.Routes() {
+		switch {
+		case strings.Contains(route.Path, "/*"):
+			prefixes = append(prefixes, route.Path[:strings.Index(route.Path, "/*")+1])
+		case strings.HasSuffix(route.Path, "/") && route.Path != "/":
+			exact = append(exact, route.Path)
+		}
+	}
+	keepSlash := func(p string) bool {
+		for _, e := range exact {
+			if p == e {
+				return true
+			}
+		}
+		for _, pre := range prefixes {
+			if strings.HasPrefix(p, pre) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p := canonicalPath(req.URL.Path)
+		if len(p) > 1 && strings.HasSuffix(p, "/") && !keepSlash(p) {
+			p = strings.TrimSuffix(p, "/")
+		}
+		if p != req.URL.Path || req.Method == http.MethodHead {
+			// net/http discards the body for the original HEAD request
+			req = req.Clone(req.Context())
+			req.URL.Path, req.URL.RawPath = p, ""
+			if req.Method == http.MethodHead {
+				req.Method = http.MethodGet
+			}
+		}
+		r.ServeHTTP(w, req)
+	})
+}
+
+// canonicalPath lowercases the first segment of p.
+func canonicalPath(p string) string {
+	first := FirstPathSegment(p)
+	if lower := strings.ToLower(first); lower != first {
+		return "/" + lower + strings.TrimPrefix(p, "/"+first)
+	}
+	return p
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type skipSaveCheckKey struct{}
+
+// SkipSaveCheck returns a context whose saves bypass State.SaveCheck, for
+// writes that restore an earlier state rather than make a new change.
+func SkipSaveCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipSaveCheckKey{}, true)
+}
+
+// checkSave runs s.SaveCheck on a change to values. Changes to internal
+// keys only are never checked. Callers hold saveMu.
+func (s *State) checkSave(ctx context.Context, values map[string]interface{}) error {
+	if s.SaveCheck == nil || ctx.Value(skipSaveCheckKey{}) != nil {
+		return nil
+	}
+	policy := false
+	for k := range values {
+		if !strings.HasPrefix(k, "_") {
+			policy = true
+			break
+		}
+	}
+	if !policy {
+		return nil
+	}
+
+	s.RWLock.RLock()
+	before := make(map[string]interface{}, len(s.Data))
+	after := make(map[string]interface{}, len(s.Data)+len(values))
+	for k, v := range s.Data {
+		before[k], after[k] = v, v
+	}
+	s.RWLock.RUnlock()
+	for k, v := range values {
+		after[k] = v
+	}
+	return s.SaveCheck(before, after)
+}
+
+// RespondSaveError answers a request whose save failed: with the
+// Rejection if State.SaveCheck turned the change down, 409 if another
+// server changed the state first (ErrConflict), otherwise with 500 and
+// body.
+func RespondSaveError(c *gin.Context, err error, body interface{}) {
+	var rej *Rejection
+	switch {
+	case errors.As(err, &rej):
+		c.JSON(rej.Status, rej.Body)
+	case errors.Is(err, ErrConflict):
+		c.JSON(http.StatusConflict, body)
+	default:
+		c.JSON(http.StatusInternalServerError, body)
+	}
+}
@@ -0,0 +1,29 @@
+package common
+
+import "encoding/json"
+
+// Scratch returns a copy of the state that lives only in memory: handlers
+// can change it as usual, but nothing is ever saved. It shares the
+// settings made before serving (disabled modules, ownership enforcement,
+// entry defaults, the save check) and is for trying out a change without
+// applying it.
+func (s *State) Scratch() (*State, error) {
+	b, err := json.Marshal(s.Snapshot())
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	return &State{
+		Data:           data,
+		Storage:        s.Storage,
+		Logger:         s.Logger,
+		disabled:       s.disabled,
+		enforceManaged: s.enforceManaged,
+		defaults:       s.defaults,
+		SaveCheck:      s.SaveCheck,
+		scratch:        true,
+	}, nil
+}
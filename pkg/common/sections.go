@@ -0,0 +1,101 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resourceSections maps each resource module's route prefix to the top-level
+// state key it manages.
+var resourceSections = map[string]string{
+	"acls":          "acls",
+	"acltests":      "aclTests",
+	"autoapprovers": "autoApprovers",
+	"derpmap":       "derpMap",
+	"grants":        "grants",
+	"groups":        "groups",
+	"hosts":         "hosts",
+	"nodeattrs":     "nodeAttrs",
+	"postures":      "postures",
+	"settings":      "settings",
+	"ssh":           "ssh",
+	"tagowners":     "tagOwners",
+}
+
+// SectionForResource returns the state key managed by the module mounted at
+// the given first path segment (case-insensitive), e.g. "nodeattrs" => "nodeAttrs".
+func SectionForResource(resource string) (string, bool) {
+	key, ok := resourceSections[strings.ToLower(resource)]
+	return key, ok
+}
+
+// ResourceForSection returns the route prefix of the module managing the
+// state key, e.g. "nodeAttrs" => "nodeattrs".
+func ResourceForSection(section string) (string, bool) {
+	for r, key := range resourceSections {
+		if key == section {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+// Resources returns the route prefixes of all resource modules, sorted.
+func Resources() []string {
+	out := make([]string, 0, len(resourceSections))
+	for r := range resourceSections {
+		out = append(out, r)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// DisableResources turns off the given resource modules (route prefixes,
+// e.g. "derpmap"). Their sections are left out of the synced policy. Call
+// it once, before serving or syncing.
+func (s *State) DisableResources(resources []string) error {
+	disabled := make(map[string]bool, len(resources))
+	for _, r := range resources {
+		key, ok := SectionForResource(r)
+		if !ok {
+			return fmt.Errorf("unknown module %q (known: %s)", r, strings.Join(Resources(), ", "))
+		}
+		disabled[key] = true
+	}
+	s.disabled = disabled
+	return nil
+}
+
+// ResourceDisabled reports whether the module mounted at resource is turned off.
+func (s *State) ResourceDisabled(resource string) bool {
+	key, ok := SectionForResource(resource)
+	return ok && s.disabled[key]
+}
+
+// SectionDisabled reports whether the top-level key belongs to a disabled module.
+func (s *State) SectionDisabled(key string) bool {
+	return s.disabled[key]
+}
+
+// policyRoutes holds the routes, as "METHOD /pattern", whose handlers may
+// change any policy section rather than just their own resource's.
+var policyRoutes sync.Map
+
+// RegisterPolicyRoute declares that the handler for `method` on the route
+// pattern `path` (as registered with gin, e.g. "/rollback/:rev") may change
+// any policy section. Middleware guarding particular sections treats such
+// requests as touching all of them. Call it where the route is registered.
+func RegisterPolicyRoute(method, path string) {
+	policyRoutes.Store(method+" "+path, true)
+}
+
+// WritesPolicy reports whether c's route was declared with
+// RegisterPolicyRoute.
+func WritesPolicy(c *gin.Context) bool {
+	_, ok := policyRoutes.Load(c.Request.Method + " " + c.FullPath())
+	return ok
+}
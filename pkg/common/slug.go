@@ -0,0 +1,45 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// Slugged gives a list entry a human-chosen name, unique within its
+// section, that can stand in for its ID, e.g. in GET /acls/by-slug/:slug,
+// Terraform import IDs and audit diffs. It's embedded in the input types
+// of list sections and never reaches the synced policy.
+type Slugged struct {
+	// Slug is e.g. "web-to-db".
+	Slug string `json:"slug,omitempty"`
+}
+
+// SlugFields are the JSON keys of Slugged.
+var SlugFields = []string{"slug"}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidateSlug checks a slug: up to 63 lowercase alphanumerics or '-',
+// starting and ending with an alphanumeric. Slugs that parse as a UUID are
+// rejected, since they'd be ambiguous with IDs.
+func ValidateSlug(slug string) error {
+	if slug == "" {
+		return nil
+	}
+	if !slugPattern.MatchString(slug) {
+		return fmt.Errorf("invalid slug %q: must be up to 63 lowercase letters, digits or '-', starting and ending with a letter or digit", slug)
+	}
+	if _, err := uuid.Parse(slug); err == nil {
+		return fmt.Errorf("invalid slug %q: must not be a UUID", slug)
+	}
+	return nil
+}
+
+// EntrySlug returns the slug of a decoded list entry, if it has one.
+func EntrySlug(entry interface{}) string {
+	m, _ := entry.(map[string]interface{})
+	slug, _ := m["slug"].(string)
+	return slug
+}
@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -30,20 +35,202 @@ type State struct {
 	Bucket    string
 	ObjectKey string // e.g. "state.json"
 
+	// Objects, if set, stores the state instead of files or S3.
+	Objects ObjectStore
+
+	// SaveCheck, if set, vets every change to the policy before it's made:
+	// before and after are the whole state without and with the change. A
+	// non-nil error rejects it and is returned by the save, so a *Rejection
+	// reaches the client through RespondSaveError.
+	SaveCheck func(before, after map[string]interface{}) error
+
 	Logger *zap.Logger
 	Debug  bool
+
+	// mutationMu and keyLocks serialize whole read-modify-write cycles.
+	// RWLock only protects individual reads and writes of Data, so without
+	// them two concurrent POSTs to the same array endpoint could both read
+	// the old list and the second save would silently drop the first entry.
+	// A request editing one section holds mutationMu shared plus that
+	// section's key lock (LockKey); anything else holds mutationMu
+	// exclusively (LockMutations).
+	mutationMu sync.RWMutex
+	keyLocksMu sync.Mutex
+	keyLocks   map[string]*sync.Mutex
+
+	// saveMu orders saves, so snapshots reach storage in the order they
+	// were taken. It's held while marshaling instead of RWLock, so reads
+	// aren't blocked by large writes.
+	saveMu sync.Mutex
+
+	// readOnly, when set, makes the API reject every mutating request.
+	readOnly atomic.Bool
+	// standby, when set, additionally stops the server pushing to Tailscale
+	// or running background jobs, so another server can be active.
+	standby atomic.Bool
+	// degraded, when set, makes the API reject mutations because storage
+	// can't be written (see pkg/degraded).
+	degraded atomic.Bool
+	// requireIfMatch, when set, makes updates and deletes without If-Match
+	// fail (see IfMatch).
+	requireIfMatch atomic.Bool
+
+	// While batchDepth > 0 saves only mark keys dirty; Batch writes them
+	// once at the end, restoring batchPrev if that fails. All are guarded
+	// by RWLock.
+	batchDepth int
+	dirty      map[string]struct{}
+	batchPrev  map[string]previousValue // what the dirty keys held before the batch
+
+	// writes, when set, persists saves in the background (see
+	// StartWriteQueue). Without it saves are synchronous and tracked by the
+	// sync* counters.
+	writes        *writeQueue
+	syncSeq       atomic.Uint64
+	syncPersisted atomic.Uint64
+	syncErr       atomic.Pointer[writeFailure]
+	syncConflict  atomic.Pointer[writeFailure]
+
+	// versions records the generation at which each key was last written,
+	// and epoch the generation at which Data was last replaced. Both are
+	// guarded by RWLock and feed KeyVersion.
+	generation uint64
+	epoch      uint64
+	versions   map[string]uint64
+
+	// integrity is the result of verifying the last load.
+	integrity atomic.Pointer[Integrity]
+
+	// disabled holds the sections of modules turned off with
+	// DisableResources. It's set before serving and read-only afterwards.
+	disabled map[string]bool
+
+	// enforceManaged makes CheckManaged reject changes to entries owned by
+	// another source. Like disabled, it's set before serving.
+	enforceManaged bool
+
+	// defaults are stamped onto created entries; see SetEntryDefaults.
+	defaults EntryDefaults
+
+	// scratch makes saves no-ops; see Scratch.
+	scratch bool
 }
 
-// ToJSON returns the entire `Data` as pretty JSON. (Acquires an RLock.)
-func (s *State) ToJSON() string {
+// SetReadOnly toggles read-only mode at runtime.
+func (s *State) SetReadOnly(v bool) {
+	s.readOnly.Store(v)
+}
+
+// IsReadOnly reports whether the API currently rejects mutations.
+func (s *State) IsReadOnly() bool {
+	return s.readOnly.Load()
+}
+
+// SetStandby switches between standby and active at runtime.
+func (s *State) SetStandby(v bool) {
+	s.standby.Store(v)
+}
+
+// IsStandby reports whether this server is a standby: it serves reads but
+// doesn't accept writes, push or run background jobs.
+func (s *State) IsStandby() bool {
+	return s.standby.Load()
+}
+
+// SetDegraded records whether storage is currently unusable.
+func (s *State) SetDegraded(v bool) {
+	s.degraded.Store(v)
+}
+
+// IsDegraded reports whether storage is unusable, so mutations, which
+// couldn't be persisted, are rejected.
+func (s *State) IsDegraded() bool {
+	return s.degraded.Load()
+}
+
+// LockMutations blocks until no other mutation is in flight, on any key.
+// Callers must pair it with UnlockMutations once their read-modify-write
+// cycle is done.
+func (s *State) LockMutations() {
+	s.mutationMu.Lock()
+}
+
+// UnlockMutations releases the lock taken by LockMutations.
+func (s *State) UnlockMutations() {
+	s.mutationMu.Unlock()
+}
+
+// LockSection blocks until no other mutation of the given top-level key
+// (or of the whole state) is in flight, and returns the unlock function.
+// Mutations of other sections proceed concurrently.
+func (s *State) LockSection(key string) (unlock func()) {
+	s.mutationMu.RLock()
+	unlockKey := s.LockKey(key)
+	return func() {
+		unlockKey()
+		s.mutationMu.RUnlock()
+	}
+}
+
+// LockKey takes just the lock for one top-level key. It's for shared
+// internal keys (e.g. "_history") written while a section or mutation lock
+// is already held; take it after that lock, never before.
+func (s *State) LockKey(key string) (unlock func()) {
+	s.keyLocksMu.Lock()
+	if s.keyLocks == nil {
+		s.keyLocks = make(map[string]*sync.Mutex)
+	}
+	mu, ok := s.keyLocks[key]
+	if !ok {
+		mu = new(sync.Mutex)
+		s.keyLocks[key] = mu
+	}
+	s.keyLocksMu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Snapshot returns a shallow copy of Data. Values in Data are replaced by
+// saves, never modified in place, so the copy can be read (e.g. marshaled)
+// without holding any lock.
+func (s *State) Snapshot() map[string]interface{} {
 	s.RWLock.RLock()
 	defer s.RWLock.RUnlock()
+	return s.snapshotLocked(nil)
+}
 
-	result, err := json.MarshalIndent(s.Data, "", "  ")
-	if err != nil {
+// snapshotLocked copies the given keys of Data, or all of it for nil keys.
+// The caller holds RWLock.
+func (s *State) snapshotLocked(keys []string) map[string]interface{} {
+	if keys == nil {
+		out := make(map[string]interface{}, len(s.Data))
+		for k, v := range s.Data {
+			out[k] = v
+		}
+		return out
+	}
+	out := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		out[k] = s.Data[k]
+	}
+	return out
+}
+
+// ToJSON returns the entire `Data` as pretty JSON.
+func (s *State) ToJSON() string {
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	if err := s.WriteJSON(buf); err != nil {
 		return "{}"
 	}
-	return string(result)
+	return buf.String()
+}
+
+// WriteJSON streams the entire `Data` to w as pretty JSON, section by
+// section, without building the whole document in memory.
+func (s *State) WriteJSON(w io.Writer) error {
+	return WriteJSONObject(w, s.Snapshot(), true)
 }
 
 // GetValue safely returns whatever is at s.Data[key], using RLock.
@@ -54,66 +241,312 @@ func (s *State) GetValue(key string) interface{} {
 	return s.Data[key]
 }
 
-// UpdateKeyAndSave locks exclusively, updates s.Data[key],
-// marshals the entire state, then writes it out.
+// UpdateKeyAndSave locks exclusively, updates s.Data[key], then writes it
+// out: just that key for per-key storage, the whole state otherwise.
 func (s *State) UpdateKeyAndSave(key string, value interface{}) error {
+	return s.UpdateKeysAndSaveContext(context.Background(), map[string]interface{}{key: value})
+}
+
+// UpdateKeyAndSaveContext is UpdateKeyAndSave for a request's context; see
+// UpdateKeysAndSaveContext.
+func (s *State) UpdateKeyAndSaveContext(ctx context.Context, key string, value interface{}) error {
+	return s.UpdateKeysAndSaveContext(ctx, map[string]interface{}{key: value})
+}
+
+// UpdateKeysAndSave is like UpdateKeyAndSave but sets several keys in a
+// single write. A nil value stores JSON null, like UpdateKeyAndSave.
+func (s *State) UpdateKeysAndSave(values map[string]interface{}) error {
+	return s.UpdateKeysAndSaveContext(context.Background(), values)
+}
+
+// UpdateKeysAndSaveContext is UpdateKeysAndSave, giving up with ctx's
+// error if ctx is done before the change is made, e.g. because the client
+// disconnected while waiting behind other saves. Once the in-memory state
+// has changed the write runs to completion with ctx's values but not its
+// cancellation, so storage doesn't fall behind memory because a client
+// went away. If a synchronous write fails the keys are put back as they
+// were and the storage error returned, so memory never holds a change
+// that isn't stored.
+func (s *State) UpdateKeysAndSaveContext(ctx context.Context, values map[string]interface{}) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.checkSave(ctx, values); err != nil {
+		return err
+	}
+
 	s.RWLock.Lock()
-	s.Data[key] = value
-	data, err := json.MarshalIndent(s.Data, "", "  ")
+	keys := make([]string, 0, len(values))
+	prev := s.previousLocked(values)
+	for k, v := range values {
+		s.Data[k] = v
+		keys = append(keys, k)
+	}
+	s.bumpLocked(keys)
+	if s.batchDepth > 0 {
+		for _, k := range keys {
+			s.dirty[k] = struct{}{}
+			if _, ok := s.batchPrev[k]; !ok {
+				s.batchPrev[k] = prev[k]
+			}
+		}
+		s.RWLock.Unlock()
+		return nil
+	}
+	snap := s.snapshotForWriteLocked(keys)
 	s.RWLock.Unlock()
 
+	w, err := s.marshalWrite(snap)
+	if err == nil {
+		err = s.write(context.WithoutCancel(ctx), w)
+	} else if s.Logger != nil {
+		s.Logger.Error("Failed to marshal state JSON", zap.Error(err))
+	}
 	if err != nil {
-		if s.Logger != nil {
-			s.Logger.Error("Failed to marshal state JSON", zap.Error(err))
+		s.rollback(prev, err)
+		return err
+	}
+	return nil
+}
+
+// previousValue is a key's value before a save, to put back if the save
+// fails.
+type previousValue struct {
+	value   interface{}
+	present bool
+}
+
+// previousLocked records the current values of the keys about to be set.
+// The caller holds RWLock.
+func (s *State) previousLocked(values map[string]interface{}) map[string]previousValue {
+	prev := make(map[string]previousValue, len(values))
+	for k := range values {
+		v, ok := s.Data[k]
+		prev[k] = previousValue{value: v, present: ok}
+	}
+	return prev
+}
+
+// rollback undoes the in-memory side of a save that failed with err. After
+// a conflict the state has been reloaded from storage instead, and is left
+// alone.
+func (s *State) rollback(prev map[string]previousValue, err error) {
+	if errors.Is(err, ErrConflict) {
+		return
+	}
+	s.RWLock.Lock()
+	defer s.RWLock.Unlock()
+	keys := make([]string, 0, len(prev))
+	for k, p := range prev {
+		if p.present {
+			s.Data[k] = p.value
+		} else {
+			delete(s.Data, k)
 		}
+		keys = append(keys, k)
+	}
+	s.bumpLocked(keys)
+}
+
+// Batch runs fn with saves deferred, then writes every key fn changed in
+// one go, so bulk operations don't rewrite the state once per entry. If fn
+// fails, its changes are undone instead and nothing is written. Batches
+// nest; only the outermost one writes. Callers must hold LockMutations, not
+// just a section lock, since other writers' saves are deferred too.
+func (s *State) Batch(fn func() error) error {
+	s.RWLock.Lock()
+	if s.dirty == nil {
+		s.dirty = make(map[string]struct{})
+		s.batchPrev = make(map[string]previousValue)
+	}
+	s.batchDepth++
+	s.RWLock.Unlock()
+
+	fnErr := fn()
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.RWLock.Lock()
+	s.batchDepth--
+	if s.batchDepth > 0 || len(s.dirty) == 0 {
+		s.RWLock.Unlock()
+		return fnErr
+	}
+	keys := make([]string, 0, len(s.dirty))
+	for k := range s.dirty {
+		keys = append(keys, k)
+	}
+	prev := s.batchPrev
+	s.dirty = make(map[string]struct{})
+	s.batchPrev = make(map[string]previousValue)
+	if fnErr != nil {
+		s.RWLock.Unlock()
+		s.rollback(prev, fnErr)
+		return fnErr
+	}
+	snap := s.snapshotForWriteLocked(keys)
+	s.RWLock.Unlock()
+
+	w, err := s.marshalWrite(snap)
+	if err == nil {
+		err = s.write(context.Background(), w)
+	} else if s.Logger != nil {
+		s.Logger.Error("Failed to marshal state JSON", zap.Error(err))
+	}
+	if err != nil {
+		s.rollback(prev, err)
 		return err
 	}
+	return nil
+}
+
+// pendingWrite is what one save puts in storage: the whole document, or
+// just the changed keys for per-key storage.
+type pendingWrite struct {
+	whole []byte
+	keys  map[string]json.RawMessage
+}
+
+// snapshotForWriteLocked copies what a save of the changed keys has to
+// write: all of Data, or just those keys for per-key storage. The caller
+// holds RWLock.
+func (s *State) snapshotForWriteLocked(keys []string) map[string]interface{} {
+	if !s.PerKey() {
+		return s.snapshotLocked(nil)
+	}
+	return s.snapshotLocked(keys)
+}
+
+// marshalWrite prepares the write for a snapshot taken by
+// snapshotForWriteLocked. It needs no lock.
+func (s *State) marshalWrite(snap map[string]interface{}) (pendingWrite, error) {
+	if !s.PerKey() {
+		var b bytes.Buffer
+		err := WriteJSONObject(&b, snap, true)
+		return pendingWrite{whole: b.Bytes()}, err
+	}
+	w := pendingWrite{keys: make(map[string]json.RawMessage, len(snap))}
+	for k, v := range snap {
+		raw, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return w, err
+		}
+		w.keys[k] = raw
+	}
+	return w, nil
+}
+
+// write persists w, returning the storage error of a synchronous write.
+// With a write queue it only enqueues w, and failures are retried (and
+// reported by WriteStatus) in the background.
+func (s *State) write(ctx context.Context, w pendingWrite) error {
+	if s.scratch {
+		return nil
+	}
+	if q := s.writes; q != nil {
+		q.enqueue(w)
+		return nil
+	}
+	seq := s.syncSeq.Add(1)
+	if err := s.persist(ctx, w); err != nil {
+		f := &writeFailure{Err: err.Error(), Time: time.Now().UTC()}
+		if errors.Is(err, ErrConflict) {
+			s.syncConflict.Store(f)
+			s.resolveConflict(ctx, err)
+			return err
+		}
+		s.syncErr.Store(f)
+		return err
+	}
+	s.syncPersisted.Store(seq)
+	return nil
+}
+
+// resolveConflict handles a write another server beat to storage: the
+// change is dropped and the state reloaded, so memory matches what it
+// wrote rather than overwriting it.
+func (s *State) resolveConflict(ctx context.Context, err error) {
+	if s.Logger != nil {
+		s.Logger.Warn("State was changed by another server; dropping this write and reloading", zap.Error(err))
+	}
+	if err := s.Reload(ctx); err != nil && s.Logger != nil {
+		s.Logger.Error("Failed to reload state after a write conflict", zap.Error(err))
+	}
+}
 
-	s.saveToStorage(data)
+// persist performs one write, returning the error after logging it.
+func (s *State) persist(ctx context.Context, w pendingWrite) error {
+	if w.keys == nil {
+		return s.inTx(ctx, func(ctx context.Context) error {
+			return s.writeWhole(ctx, w.whole)
+		})
+	}
+	if err := s.inTx(ctx, func(ctx context.Context) error { return s.saveKeys(ctx, w.keys) }); err != nil {
+		if s.Logger != nil {
+			s.Logger.Error("Failed to save state keys", zap.String("storage", s.Storage), zap.Error(err))
+		}
+		return err
+	}
+	if s.Debug && s.Logger != nil {
+		s.Logger.Info("Saved updated state keys", zap.String("storage", s.Storage), zap.Int("keys", len(w.keys)))
+	}
 	return nil
 }
 
 // saveToStorage writes the given JSON to file or S3. (No lock needed to write bytes.)
-func (s *State) saveToStorage(jsonData []byte) {
+func (s *State) saveToStorage(jsonData []byte) error {
+	return s.writeWhole(context.TODO(), jsonData)
+}
+
+// writeWhole is saveToStorage for a context, returning the error after
+// logging it.
+func (s *State) writeWhole(ctx context.Context, jsonData []byte) error {
 	switch {
-	case strings.HasPrefix(s.Storage, "file://"):
-		path := strings.TrimPrefix(s.Storage, "file://")
-		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-		if err != nil {
+	case s.Objects != nil:
+		if err := s.writeVerified(ctx, s.objectPath(), jsonData); err != nil {
 			if s.Logger != nil {
-				s.Logger.Error("Error opening file for writing",
-					zap.String("path", path), zap.Error(err))
+				s.Logger.Error("Error writing state object",
+					zap.String("storage", s.Storage), zap.Error(err))
 			}
-			return
+			return err
 		}
-		defer f.Close()
+		return nil
 
+	case strings.HasPrefix(s.Storage, "file://"):
+		path := strings.TrimPrefix(s.Storage, "file://")
 		if s.Debug && s.Logger != nil {
 			s.Logger.Info("Writing updated state to file", zap.String("path", path))
-			s.Logger.Debug("New state JSON", zap.String("state", string(jsonData)))
+			s.Logger.Debug("New state JSON", zap.String("state", redactedJSON(jsonData)))
 		}
-		_, _ = f.Write(jsonData)
-		_, _ = f.Write([]byte("\n"))
+		if err := s.writeVerified(ctx, path, append(jsonData, '\n')); err != nil {
+			if s.Logger != nil {
+				s.Logger.Error("Error writing state file",
+					zap.String("path", path), zap.Error(err))
+			}
+			return err
+		}
+		return nil
 
 	case strings.HasPrefix(s.Storage, "s3://") && s.S3Client != nil && s.Bucket != "" && s.ObjectKey != "":
-		reader := bytes.NewReader(jsonData)
-		_, err := s.S3Client.PutObject(context.TODO(), s.Bucket, s.ObjectKey,
-			reader, int64(reader.Len()), minio.PutObjectOptions{})
-		if err != nil {
+		if err := s.writeVerified(ctx, s.ObjectKey, jsonData); err != nil {
 			if s.Logger != nil {
 				s.Logger.Error("Failed to put object to S3",
 					zap.String("bucket", s.Bucket),
 					zap.String("objectKey", s.ObjectKey),
 					zap.Error(err))
 			}
-			return
+			return err
 		}
 		if s.Debug && s.Logger != nil {
 			s.Logger.Info("Uploaded updated state to S3",
 				zap.String("bucket", s.Bucket),
 				zap.String("objectKey", s.ObjectKey))
-			s.Logger.Debug("New state JSON", zap.String("state", string(jsonData)))
+			s.Logger.Debug("New state JSON", zap.String("state", redactedJSON(jsonData)))
 		}
+		return nil
 
 	default:
 		if s.Logger != nil {
@@ -122,16 +555,35 @@ func (s *State) saveToStorage(jsonData []byte) {
 				zap.String("bucket", s.Bucket),
 				zap.String("objectKey", s.ObjectKey))
 		}
+		return fmt.Errorf("unrecognized storage %q", s.Storage)
 	}
 }
 
 // LoadFromStorage loads existing JSON from file or S3 into s.Data. (Locks for writing.)
+// Stored state that fails its integrity check is replaced by its backup; if
+// there is no usable backup the process exits rather than serve it.
 func (s *State) LoadFromStorage() {
 	if s.Logger != nil && s.Debug {
 		s.Logger.Info("Attempting to load existing state", zap.String("storage", s.Storage))
 	}
 
 	switch {
+	case s.PerKey():
+		data, in, err := s.loadKeys(loading(context.TODO()))
+		if err != nil {
+			s.corrupt(in)
+			if s.Logger != nil {
+				s.Logger.Fatal("Could not load state keys", zap.String("storage", s.Storage), zap.Error(err))
+			}
+			return
+		}
+		s.setIntegrity(in)
+		s.RWLock.Lock()
+		s.Data = data
+		s.replacedLocked()
+		s.RWLock.Unlock()
+	case s.Objects != nil:
+		s.loadFromObjects()
 	case strings.HasPrefix(s.Storage, "file://"):
 		s.loadFromFile()
 	case strings.HasPrefix(s.Storage, "s3://") && s.S3Client != nil && s.Bucket != "" && s.ObjectKey != "":
@@ -147,38 +599,64 @@ func (s *State) LoadFromStorage() {
 	return
 }
 
+// corrupt records a failed integrity check, so it's visible even if the
+// caller keeps running.
+func (s *State) corrupt(in Integrity) {
+	if in.Status == IntegrityCorrupt {
+		s.setIntegrity(in)
+	}
+}
+
 func (s *State) loadFromFile() {
 	path := strings.TrimPrefix(s.Storage, "file://")
 	if s.Logger != nil && s.Debug {
 		s.Logger.Info("Reading state file", zap.String("path", path))
 	}
 
-	data, err := os.ReadFile(path)
+	var data map[string]interface{}
+	in, err := s.readVerified(context.TODO(), path, decodeObject(&data))
 	if err != nil {
+		s.corrupt(in)
 		if s.Logger != nil {
+			if errors.Is(err, ErrCorrupt) {
+				s.Logger.Fatal("State file is corrupt and no usable backup exists; refusing to start. Delete "+path+checksumSuffix+" to accept it as is",
+					zap.String("path", path), zap.Error(err))
+			}
 			s.Logger.Fatal("Could not read state file",
 				zap.String("path", path), zap.Error(err))
 		}
 		return
 	}
-	if s.Logger != nil && s.Debug {
-		s.Logger.Info("Successfully read file bytes", zap.Int("byteCount", len(data)))
-	}
+	s.setIntegrity(in)
 
 	s.RWLock.Lock()
-	defer s.RWLock.Unlock()
+	s.Data = data
+	s.replacedLocked()
+	s.RWLock.Unlock()
+	if s.Logger != nil && s.Debug {
+		s.Logger.Info("Loaded state from file", zap.String("path", path), zap.String("integrity", in.Status))
+	}
+}
 
-	if err := json.Unmarshal(data, &s.Data); err != nil {
+// loadFromObjects reads the state from s.Objects. Unlike a state file,
+// which the CLI creates before loading, a missing object is an empty state.
+func (s *State) loadFromObjects() {
+	data := make(map[string]interface{})
+	in, err := s.readVerified(loading(context.TODO()), s.objectPath(), decodeObject(&data))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.corrupt(in)
 		if s.Logger != nil {
-			s.Logger.Fatal("Could not unmarshal state data from file",
-				zap.String("path", path),
-				zap.Error(err))
-		}
-	} else {
-		if s.Logger != nil && s.Debug {
-			s.Logger.Info("Loaded state from file", zap.String("path", path))
+			s.Logger.Fatal("Could not read state object",
+				zap.String("storage", s.Storage), zap.Error(err))
 		}
+		return
 	}
+	s.setIntegrity(in)
+
+	s.RWLock.Lock()
+	s.Data = data
+	s.replacedLocked()
+	s.RWLock.Unlock()
 }
 
 func (s *State) loadFromS3() {
@@ -188,46 +666,35 @@ func (s *State) loadFromS3() {
 			zap.String("objectKey", s.ObjectKey))
 	}
 
-	reader, err := s.S3Client.GetObject(context.TODO(), s.Bucket, s.ObjectKey, minio.GetObjectOptions{})
+	var data map[string]interface{}
+	in, err := s.readVerified(context.TODO(), s.ObjectKey, decodeObject(&data))
 	if err != nil {
+		s.corrupt(in)
 		if s.Logger != nil {
+			if errors.Is(err, ErrCorrupt) {
+				s.Logger.Fatal("State object is corrupt and no usable backup exists; refusing to start. Delete "+s.ObjectKey+checksumSuffix+" to accept it as is",
+					zap.String("bucket", s.Bucket),
+					zap.String("objectKey", s.ObjectKey),
+					zap.Error(err))
+			}
 			s.Logger.Fatal("Could not get object from S3",
 				zap.String("bucket", s.Bucket),
 				zap.String("objectKey", s.ObjectKey),
 				zap.Error(err))
 		}
+		return
 	}
-	defer reader.Close()
-
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		if s.Logger != nil {
-			s.Logger.Fatal("Failed to read data from S3 object",
-				zap.String("bucket", s.Bucket),
-				zap.String("objectKey", s.ObjectKey),
-				zap.Error(err))
-		}
-	}
-	if s.Logger != nil && s.Debug {
-		s.Logger.Info("Successfully read S3 object bytes", zap.Int("byteCount", len(data)))
-	}
+	s.setIntegrity(in)
 
 	s.RWLock.Lock()
-	defer s.RWLock.Unlock()
-
-	if err := json.Unmarshal(data, &s.Data); err != nil {
-		if s.Logger != nil {
-			s.Logger.Fatal("Could not unmarshal state data from S3",
-				zap.String("bucket", s.Bucket),
-				zap.String("objectKey", s.ObjectKey),
-				zap.Error(err))
-		}
-	} else {
-		if s.Logger != nil && s.Debug {
-			s.Logger.Info("Loaded state from S3",
-				zap.String("bucket", s.Bucket),
-				zap.String("objectKey", s.ObjectKey))
-		}
+	s.Data = data
+	s.replacedLocked()
+	s.RWLock.Unlock()
+	if s.Logger != nil && s.Debug {
+		s.Logger.Info("Loaded state from S3",
+			zap.String("bucket", s.Bucket),
+			zap.String("objectKey", s.ObjectKey),
+			zap.String("integrity", in.Status))
 	}
 }
 
@@ -245,7 +712,9 @@ func (s *State) loadFromS3() {
 //
 //	TACL_S3_ENDPOINT=s3.us-west-2.amazonaws.com
 //	TACL_S3_REGION=us-west-2
-func InitializeS3Client(storageURL, s3Endpoint, s3Region string, logger *zap.Logger) (*minio.Client, string, string, error) {
+//
+// keys, if non-nil, replaces the default AWS credential chain.
+func InitializeS3Client(storageURL, s3Endpoint, s3Region string, keys *credentials.Credentials, logger *zap.Logger) (*minio.Client, string, string, error) {
 	u, err := url.Parse(storageURL)
 	if err != nil {
 		return nil, "", "", fmt.Errorf("invalid S3 URL: %w", err)
@@ -292,6 +761,10 @@ func InitializeS3Client(storageURL, s3Endpoint, s3Region string, logger *zap.Log
 		token := os.Getenv("AWS_SESSION_TOKEN")
 		creds = credentials.NewStaticV4(accessKey, secretKey, token)
 	}
+	// Explicitly configured keys win
+	if keys != nil {
+		creds = keys
+	}
 
 	// Create the MinIO client with explicit options
 	s3Client, err := minio.New(s3Endpoint, &minio.Options{
@@ -308,6 +781,90 @@ func InitializeS3Client(storageURL, s3Endpoint, s3Region string, logger *zap.Log
 }
 
 // SaveBytesToStorage provides a convenient helper...
-func (s *State) SaveBytesToStorage(jsonData []byte) {
-    s.saveToStorage(jsonData)
-}
\ No newline at end of file
+func (s *State) SaveBytesToStorage(jsonData []byte) error {
+	if s.PerKey() {
+		var data map[string]interface{}
+		err := json.Unmarshal(jsonData, &data)
+		if err == nil {
+			err = s.inTx(context.TODO(), func(ctx context.Context) error { return s.replaceKeys(ctx, data) })
+		}
+		if err != nil && s.Logger != nil {
+			s.Logger.Error("Failed to save state keys", zap.String("storage", s.Storage), zap.Error(err))
+		}
+		return err
+	}
+	return s.saveToStorage(jsonData)
+}
+
+// CheckStorage verifies the storage backend is reachable and writable
+// without touching the state itself.
+func (s *State) CheckStorage(ctx context.Context) error {
+	switch {
+	case s.Objects != nil:
+		probe := s.objectPath() + ".readyz"
+		if err := s.Objects.Put(ctx, probe, nil); err != nil {
+			return fmt.Errorf("storage not writable: %w", err)
+		}
+		return s.Objects.Remove(ctx, probe)
+
+	case strings.HasPrefix(s.Storage, "file://"):
+		path := strings.TrimPrefix(s.Storage, "file://")
+		f, err := os.CreateTemp(filepath.Dir(path), ".tacl-readyz-*")
+		if err != nil {
+			return fmt.Errorf("state directory not writable: %w", err)
+		}
+		name := f.Name()
+		f.Close()
+		return os.Remove(name)
+
+	case strings.HasPrefix(s.Storage, "s3://") && s.S3Client != nil && s.Bucket != "":
+		ok, err := s.S3Client.BucketExists(ctx, s.Bucket)
+		if err != nil {
+			return fmt.Errorf("S3 unreachable: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("S3 bucket %q does not exist", s.Bucket)
+		}
+		probe := s.ObjectKey + ".readyz"
+		if _, err := s.S3Client.PutObject(ctx, s.Bucket, probe, bytes.NewReader(nil), 0, minio.PutObjectOptions{}); err != nil {
+			return fmt.Errorf("S3 bucket not writable: %w", err)
+		}
+		return s.S3Client.RemoveObject(ctx, s.Bucket, probe, minio.RemoveObjectOptions{})
+
+	default:
+		return fmt.Errorf("unrecognized storage %q", s.Storage)
+	}
+}
+
+// Reload re-reads the state from storage and replaces Data with it. Unlike
+// LoadFromStorage it reports errors instead of exiting, and leaves Data
+// untouched if anything goes wrong. Callers should hold LockMutations.
+func (s *State) Reload(ctx context.Context) error {
+	ctx = loading(ctx)
+	var data map[string]interface{}
+	var in Integrity
+	var err error
+	switch {
+	case s.PerKey():
+		data, in, err = s.loadKeys(ctx)
+	case s.Objects != nil:
+		in, err = s.readVerified(ctx, s.objectPath(), decodeObject(&data))
+	case strings.HasPrefix(s.Storage, "file://"):
+		in, err = s.readVerified(ctx, strings.TrimPrefix(s.Storage, "file://"), decodeObject(&data))
+	case strings.HasPrefix(s.Storage, "s3://") && s.S3Client != nil && s.Bucket != "":
+		in, err = s.readVerified(ctx, s.ObjectKey, decodeObject(&data))
+	default:
+		return fmt.Errorf("unrecognized storage %q", s.Storage)
+	}
+	if err != nil {
+		s.corrupt(in)
+		return err
+	}
+	s.setIntegrity(in)
+
+	s.RWLock.Lock()
+	s.Data = data
+	s.replacedLocked()
+	s.RWLock.Unlock()
+	return nil
+}
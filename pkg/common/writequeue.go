@@ -0,0 +1,278 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Write queue backoff bounds.
+const (
+	writeRetryMin = 200 * time.Millisecond
+	writeRetryMax = 10 * time.Second
+)
+
+// writeFailure is the most recent failed write.
+type writeFailure struct {
+	Err  string    `json:"error"`
+	Time time.Time `json:"time"`
+}
+
+// WriteStatus reports how far storage is behind the in-memory state. Every
+// save gets a sequence number; Persisted is the highest one in storage.
+type WriteStatus struct {
+	Queued     bool       `json:"queued"`
+	Seq        uint64     `json:"seq"`
+	Persisted  uint64     `json:"persisted"`
+	Pending    bool       `json:"pending"`
+	Failures   int        `json:"consecutiveFailures,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+	LastFailed *time.Time `json:"lastFailedAt,omitempty"`
+	// LastConflict is the last write dropped because another server
+	// changed the state first. Storage itself is fine.
+	LastConflict   string     `json:"lastConflict,omitempty"`
+	LastConflictAt *time.Time `json:"lastConflictAt,omitempty"`
+}
+
+// writeQueue coalesces saves: while one is waiting out the debounce or
+// being retried, later saves merge into it, so a burst of mutations turns
+// into a single write.
+type writeQueue struct {
+	state    *State
+	debounce time.Duration
+
+	mu        sync.Mutex
+	changed   *sync.Cond // signalled when pending or persisted changes
+	pending   *pendingWrite
+	seq       uint64 // highest sequence enqueued
+	persisted uint64 // highest sequence written
+	dropped   uint64 // highest sequence given up on after a conflict
+	failures  int
+	lastErr   *writeFailure
+	conflict  *writeFailure // last write dropped after ErrConflict
+	wake      chan struct{}
+}
+
+// StartWriteQueue makes saves return as soon as the in-memory state is
+// updated, persisting them in the background at most once per debounce
+// interval. Failed writes are retried with backoff until they succeed;
+// only a write that lost to another server (ErrConflict) is dropped, along
+// with anything queued behind it, and the state reloaded. Call it before
+// serving requests.
+func (s *State) StartWriteQueue(debounce time.Duration) {
+	q := &writeQueue{state: s, debounce: debounce, wake: make(chan struct{}, 1)}
+	q.changed = sync.NewCond(&q.mu)
+	s.writes = q
+	go q.run()
+}
+
+// WriteSeq returns the sequence number of the latest save.
+func (s *State) WriteSeq() uint64 {
+	if q := s.writes; q != nil {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.seq
+	}
+	return s.syncSeq.Load()
+}
+
+// WriteStatus reports queued and persisted saves.
+func (s *State) WriteStatus() WriteStatus {
+	q := s.writes
+	if q == nil {
+		st := WriteStatus{Seq: s.syncSeq.Load(), Persisted: s.syncPersisted.Load()}
+		if f := s.syncErr.Load(); f != nil && st.Persisted < st.Seq {
+			st.LastError, st.LastFailed = f.Err, &f.Time
+		}
+		if f := s.syncConflict.Load(); f != nil {
+			st.LastConflict, st.LastConflictAt = f.Err, &f.Time
+		}
+		return st
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := WriteStatus{Queued: true, Seq: q.seq, Persisted: q.persisted, Pending: q.pending != nil, Failures: q.failures}
+	if q.lastErr != nil {
+		t := q.lastErr.Time
+		st.LastError, st.LastFailed = q.lastErr.Err, &t
+	}
+	if q.conflict != nil {
+		t := q.conflict.Time
+		st.LastConflict, st.LastConflictAt = q.conflict.Err, &t
+	}
+	return st
+}
+
+// WaitPersisted blocks until the save with sequence seq is in storage, or
+// ctx is done. Without a write queue saves are already synchronous.
+func (s *State) WaitPersisted(ctx context.Context, seq uint64) error {
+	q := s.writes
+	if q == nil {
+		if s.syncPersisted.Load() >= seq {
+			return nil
+		}
+		if f := s.syncErr.Load(); f != nil {
+			return errWriteFailed(f.Err)
+		}
+		if f := s.syncConflict.Load(); f != nil {
+			return errWriteFailed(f.Err)
+		}
+		return nil
+	}
+
+	// Wake the waiter below when ctx ends
+	stop := context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		q.changed.Broadcast()
+		q.mu.Unlock()
+	})
+	defer stop()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.persisted < seq && q.dropped < seq {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		q.changed.Wait()
+	}
+	if q.persisted < seq {
+		return errWriteFailed(q.conflict.Err)
+	}
+	return nil
+}
+
+// FlushWrites waits for every queued save to reach storage, e.g. on shutdown.
+func (s *State) FlushWrites(ctx context.Context) error {
+	if q := s.writes; q != nil {
+		q.kick()
+	}
+	return s.WaitPersisted(ctx, s.WriteSeq())
+}
+
+// Resave writes the whole in-memory state to storage again, so saves that
+// failed while storage was unreachable catch up. A write queue retries its
+// failed saves by itself, so with one Resave only waits for them.
+func (s *State) Resave(ctx context.Context) error {
+	if s.writes != nil {
+		return s.FlushWrites(ctx)
+	}
+	s.saveMu.Lock()
+	s.RWLock.RLock()
+	snap := s.snapshotLocked(nil)
+	s.RWLock.RUnlock()
+	w, err := s.marshalWrite(snap)
+	if err == nil {
+		s.write(ctx, w) // a failure is reported by WaitPersisted below
+	}
+	s.saveMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.WaitPersisted(ctx, s.WriteSeq())
+}
+
+type errWriteFailed string
+
+func (e errWriteFailed) Error() string { return "state write failed: " + string(e) }
+
+func (q *writeQueue) enqueue(w pendingWrite) {
+	q.mu.Lock()
+	q.seq++
+	switch {
+	case q.pending == nil:
+		q.pending = &w
+	case w.keys == nil:
+		q.pending.whole = w.whole
+	default:
+		for k, v := range w.keys {
+			q.pending.keys[k] = v
+		}
+	}
+	q.mu.Unlock()
+	q.kick()
+}
+
+func (q *writeQueue) kick() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *writeQueue) run() {
+	backoff := writeRetryMin
+	for range q.wake {
+		time.Sleep(q.debounce)
+		for {
+			q.mu.Lock()
+			w, seq := q.pending, q.seq
+			q.pending = nil
+			q.mu.Unlock()
+			if w == nil {
+				break
+			}
+
+			err := q.state.persist(context.Background(), *w)
+
+			q.mu.Lock()
+			if err == nil {
+				q.persisted = seq
+				q.failures = 0
+				q.lastErr = nil
+				backoff = writeRetryMin
+				q.changed.Broadcast()
+				q.mu.Unlock()
+				continue
+			}
+			if errors.Is(err, ErrConflict) {
+				// Retrying would overwrite the other server's change, and
+				// anything queued since was made on top of what it replaced
+				q.conflict = &writeFailure{Err: err.Error(), Time: time.Now().UTC()}
+				q.pending = nil
+				q.dropped = q.seq
+				q.changed.Broadcast()
+				q.mu.Unlock()
+				q.state.resolveConflict(context.Background(), err)
+				continue
+			}
+			// Put it back underneath anything newer and retry
+			q.failures++
+			q.lastErr = &writeFailure{Err: err.Error(), Time: time.Now().UTC()}
+			q.pending = merge(*w, q.pending)
+			failures := q.failures
+			q.mu.Unlock()
+
+			if q.state.Logger != nil {
+				q.state.Logger.Warn("State write failed; retrying",
+					zap.Int("failures", failures), zap.Duration("backoff", backoff), zap.Error(err))
+			}
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > writeRetryMax {
+				backoff = writeRetryMax
+			}
+		}
+	}
+}
+
+// merge layers newer (which may be nil) on top of older.
+func merge(older pendingWrite, newer *pendingWrite) *pendingWrite {
+	if newer == nil {
+		return &older
+	}
+	if newer.keys == nil {
+		return newer
+	}
+	keys := make(map[string]json.RawMessage, len(older.keys)+len(newer.keys))
+	for k, v := range older.keys {
+		keys[k] = v
+	}
+	for k, v := range newer.keys {
+		keys[k] = v
+	}
+	return &pendingWrite{keys: keys}
+}
@@ -0,0 +1,153 @@
+// Package config loads CLI flags from a YAML or TOML file.
+//
+// Keys are flag names, in kebab-case ("sync-interval"), snake_case or
+// camelCase. Flags of a subcommand can also be nested under its name:
+//
+//	storage: s3://my-bucket
+//	serve:
+//	  sync-interval: 1m
+//	  tags: [tag:tacl, tag:prod]
+//
+// Precedence is flag, then environment variable, then file, then default.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Loader is a kong.ConfigurationLoader for YAML (and so JSON) or TOML files.
+func Loader(r io.Reader) (kong.Resolver, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	values, err := decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &resolver{values: values}, nil
+}
+
+// decode tries YAML first, since it covers JSON too. A TOML file won't
+// decode to a YAML mapping, so it falls through.
+func decode(raw []byte) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return values, nil
+	}
+	yamlErr := yaml.Unmarshal(raw, &values)
+	if yamlErr == nil {
+		return values, nil
+	}
+	values = map[string]interface{}{}
+	if err := toml.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("config is neither YAML (%v) nor TOML (%v)", yamlErr, err)
+	}
+	return values, nil
+}
+
+type resolver struct {
+	values map[string]interface{}
+}
+
+// Validate rejects keys that don't match any flag, so typos don't go unnoticed.
+func (r *resolver) Validate(app *kong.Application) error {
+	flags := map[string]bool{}
+	commands := map[string]*kong.Node{}
+	var walk func(n *kong.Node)
+	walk = func(n *kong.Node) {
+		for _, f := range n.Flags {
+			flags[normalize(f.Name)] = true
+		}
+		for _, c := range n.Children {
+			commands[normalize(c.Name)] = c
+			walk(c)
+		}
+	}
+	walk(app.Node)
+
+	var unknown []string
+	for k, v := range r.values {
+		if flags[normalize(k)] {
+			continue
+		}
+		if _, ok := commands[normalize(k)]; ok {
+			if _, nested := v.(map[string]interface{}); nested {
+				for sub := range v.(map[string]interface{}) {
+					if !flags[normalize(sub)] {
+						unknown = append(unknown, k+"."+sub)
+					}
+				}
+				continue
+			}
+		}
+		unknown = append(unknown, k)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown config keys: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func (r *resolver) Resolve(_ *kong.Context, parent *kong.Path, flag *kong.Flag) (interface{}, error) {
+	// Environment variables win over the file
+	for _, env := range flag.Tag.Envs {
+		if _, ok := os.LookupEnv(env); ok {
+			return nil, nil
+		}
+	}
+
+	if parent != nil && parent.Command != nil {
+		if section, ok := lookup(r.values, parent.Command.Name).(map[string]interface{}); ok {
+			if v := lookup(section, flag.Name); v != nil {
+				return flatten(v), nil
+			}
+		}
+	}
+	if v := lookup(r.values, flag.Name); v != nil {
+		return flatten(v), nil
+	}
+	return nil, nil
+}
+
+// lookup finds name in m regardless of kebab, snake or camel case.
+func lookup(m map[string]interface{}, name string) interface{} {
+	want := normalize(name)
+	for k, v := range m {
+		if normalize(k) == want {
+			return v
+		}
+	}
+	return nil
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+}
+
+// flatten turns lists into the comma-separated strings our flags take, and
+// everything else but booleans into strings for kong's mappers.
+func flatten(v interface{}) interface{} {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case []interface{}:
+		parts := make([]string, len(val))
+		for i, p := range val {
+			parts[i] = fmt.Sprint(p)
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -0,0 +1,132 @@
+// Package degraded guards against accepting changes that can't be saved.
+// While the storage backend is unreachable, or writes to it fail, the
+// server is degraded: mutations are rejected with 503 instead of living
+// only in memory, while reads and the sync of what's already in storage
+// carry on.
+package degraded
+
+import (
+	"context"
+	"net/http"
+	gosync "sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"go.uber.org/zap"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// checkTimeout bounds one storage probe.
+const checkTimeout = 10 * time.Second
+
+// Status describes the last check.
+type Status struct {
+	Degraded bool       `json:"degraded"`
+	Since    *time.Time `json:"since,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+}
+
+// Monitor probes storage and switches the state in and out of degraded
+// mode.
+type Monitor struct {
+	state  *common.State
+	logger *zap.Logger
+
+	mu     gosync.Mutex // guards status
+	status Status
+}
+
+// New returns a monitor for state's storage.
+func New(state *common.State, logger *zap.Logger) *Monitor {
+	return &Monitor{state: state, logger: logger}
+}
+
+// Start checks storage every interval until ctx is cancelled.
+func (m *Monitor) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.Check(ctx)
+			}
+		}
+	}()
+}
+
+// Check probes storage once. Storage is degraded if it can't be written or
+// the last save failed. On recovery, saves that failed are written again
+// before mutations are accepted.
+func (m *Monitor) Check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	reason := ""
+	if err := m.state.CheckStorage(ctx); err != nil {
+		reason = err.Error()
+	} else if ws := m.state.WriteStatus(); ws.LastError != "" {
+		// Storage is back, so catch up on what it missed
+		if err := m.state.Resave(ctx); err != nil {
+			reason = "state writes failing: " + err.Error()
+		}
+	}
+	m.set(reason)
+}
+
+func (m *Monitor) set(reason string) {
+	degraded := reason != ""
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case degraded && !m.status.Degraded:
+		now := time.Now().UTC()
+		m.status = Status{Degraded: true, Since: &now, Reason: reason}
+		m.logger.Error("Storage degraded; rejecting changes until it recovers", zap.String("reason", reason))
+	case degraded:
+		m.status.Reason = reason
+	case m.status.Degraded:
+		m.logger.Info("Storage recovered; accepting changes again", zap.Duration("after", time.Since(*m.status.Since)))
+		m.status = Status{}
+	}
+	m.state.SetDegraded(degraded)
+}
+
+// Status returns the result of the last check.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Err is a health.Check function reporting degraded mode as an error.
+func (m *Monitor) Err(context.Context) error {
+	if st := m.Status(); st.Degraded {
+		return errDegraded(st.Reason)
+	}
+	return nil
+}
+
+type errDegraded string
+
+func (e errDegraded) Error() string { return "storage degraded: " + string(e) }
+
+// Middleware rejects mutating requests with 503 while degraded or while a
+// save is failing, so a change is never acknowledged without being stored.
+func Middleware(state *common.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if common.IsMutatingMethod(c.Request.Method) && (state.IsDegraded() || state.WriteStatus().LastError != "") {
+			c.Header("Retry-After", "30")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage is unavailable; changes are rejected until it recovers"})
+			return
+		}
+		c.Next()
+	}
+}
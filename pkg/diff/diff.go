@@ -0,0 +1,161 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Change is a single modified item within a section.
+type Change struct {
+	Key    string      `json:"key"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+	// Slug is the entry's slug, if it has one, so readers don't have to
+	// look up what Key refers to.
+	Slug string `json:"slug,omitempty"`
+}
+
+// SectionDiff describes how one top-level section changed.
+//
+// List sections are compared entry-by-entry, keyed by each entry's "id" if it
+// has one (otherwise by position). Map sections are compared key-by-key.
+// Anything else (e.g. settings) is reported as a single Change with key "".
+type SectionDiff struct {
+	Added   []Change `json:"added,omitempty"`
+	Removed []Change `json:"removed,omitempty"`
+	Changed []Change `json:"changed,omitempty"`
+}
+
+// Empty reports whether nothing changed.
+func (d SectionDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Section compares two values of the same section. Inputs are normalized
+// through JSON first, so typed structs and decoded maps compare equal.
+func Section(before, after interface{}) SectionDiff {
+	before, after = normalize(before), normalize(after)
+
+	bm, bok := keyed(before)
+	am, aok := keyed(after)
+	if !bok || !aok {
+		if before == nil && aok {
+			bm, bok = map[string]interface{}{}, true
+		}
+		if after == nil && bok {
+			am, aok = map[string]interface{}{}, true
+		}
+	}
+	if !bok || !aok {
+		if reflect.DeepEqual(before, after) {
+			return SectionDiff{}
+		}
+		switch {
+		case before == nil:
+			return SectionDiff{Added: []Change{{After: after}}}
+		case after == nil:
+			return SectionDiff{Removed: []Change{{Before: before}}}
+		default:
+			return SectionDiff{Changed: []Change{{Before: before, After: after}}}
+		}
+	}
+
+	var d SectionDiff
+	for _, k := range sortedKeys(bm, am) {
+		b, inB := bm[k]
+		a, inA := am[k]
+		slug := slugOf(a)
+		if slug == "" {
+			slug = slugOf(b)
+		}
+		switch {
+		case inB && !inA:
+			d.Removed = append(d.Removed, Change{Key: k, Before: b, Slug: slug})
+		case !inB && inA:
+			d.Added = append(d.Added, Change{Key: k, After: a, Slug: slug})
+		case !reflect.DeepEqual(b, a):
+			d.Changed = append(d.Changed, Change{Key: k, Before: b, After: a, Slug: slug})
+		}
+	}
+	return d
+}
+
+// State compares two whole documents, returning only the sections that changed.
+func State(before, after map[string]interface{}) map[string]SectionDiff {
+	out := make(map[string]SectionDiff)
+	seen := make(map[string]bool)
+	for k := range before {
+		seen[k] = true
+	}
+	for k := range after {
+		seen[k] = true
+	}
+	for k := range seen {
+		if d := Section(before[k], after[k]); !d.Empty() {
+			out[k] = d
+		}
+	}
+	return out
+}
+
+// normalize round-trips v through JSON so all inputs share one representation.
+func normalize(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// slugOf returns the "slug" of a list entry, if it has one.
+func slugOf(v interface{}) string {
+	m, _ := v.(map[string]interface{})
+	slug, _ := m["slug"].(string)
+	return slug
+}
+
+// keyed turns a list or map into a map of comparable items.
+func keyed(v interface{}) (map[string]interface{}, bool) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return val, true
+	case []interface{}:
+		out := make(map[string]interface{}, len(val))
+		for i, item := range val {
+			key := fmt.Sprintf("#%d", i)
+			if m, ok := item.(map[string]interface{}); ok {
+				if id, ok := m["id"].(string); ok && id != "" {
+					key = id
+				}
+			}
+			out[key] = item
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func sortedKeys(a, b map[string]interface{}) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
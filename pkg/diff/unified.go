@@ -0,0 +1,182 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// contextLines is how many unchanged lines surround each hunk.
+const contextLines = 3
+
+// maxLCSCells bounds the line-matching table. Past it, the differing middle
+// of a section is shown as one removal followed by one addition.
+const maxLCSCells = 4 << 20
+
+// Unified renders the sections that differ between before and after as a
+// unified diff of their indented JSON, one file header per section.
+func Unified(fromLabel, toLabel string, before, after map[string]interface{}) string {
+	var b strings.Builder
+	for _, section := range sortedKeys(before, after) {
+		a, z := jsonLines(before[section]), jsonLines(after[section])
+		hunks := unifiedHunks(a, z)
+		if hunks == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "--- %s/%s\n+++ %s/%s\n%s", fromLabel, section, toLabel, section, hunks)
+	}
+	return b.String()
+}
+
+func jsonLines(v interface{}) []string {
+	if v == nil {
+		return nil
+	}
+	out, err := json.MarshalIndent(normalize(v), "", "  ")
+	if err != nil {
+		return []string{fmt.Sprint(v)}
+	}
+	return strings.Split(string(out), "\n")
+}
+
+// op is one line of an edit script: ' ' kept, '-' removed, '+' added.
+type op struct {
+	kind byte
+	line string
+}
+
+func unifiedHunks(a, b []string) string {
+	ops := editScript(a, b)
+
+	var out strings.Builder
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while changes are within 2*contextLines of each other
+		start := max(i-contextLines, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*contextLines {
+				break
+			}
+		}
+		end = min(end+contextLines, len(ops))
+
+		aStart, bStart := lineNumbers(ops, start)
+		var aLen, bLen int
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				aLen++
+			}
+			if o.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, o := range ops[start:end] {
+			out.WriteByte(o.kind)
+			out.WriteString(o.line)
+			out.WriteByte('\n')
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// lineNumbers returns the 1-based lines in a and b at which ops[i] falls.
+func lineNumbers(ops []op, i int) (int, int) {
+	a, b := 1, 1
+	for _, o := range ops[:i] {
+		if o.kind != '+' {
+			a++
+		}
+		if o.kind != '-' {
+			b++
+		}
+	}
+	return a, b
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		start--
+	}
+	if n == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
+
+// editScript turns a into b, keeping a longest common subsequence of lines.
+func editScript(a, b []string) []op {
+	var prefix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	var suffix int
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []op
+	for _, l := range a[:prefix] {
+		ops = append(ops, op{' ', l})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(ma)*len(mb) > maxLCSCells {
+		for _, l := range ma {
+			ops = append(ops, op{'-', l})
+		}
+		for _, l := range mb {
+			ops = append(ops, op{'+', l})
+		}
+	} else {
+		ops = append(ops, lcsScript(ma, mb)...)
+	}
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, op{' ', l})
+	}
+	return ops
+}
+
+func lcsScript(a, b []string) []op {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	w := len(b) + 1
+	lcs := make([]int, (len(a)+1)*w)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			} else {
+				lcs[i*w+j] = max(lcs[(i+1)*w+j], lcs[i*w+j+1])
+			}
+		}
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case lcs[(i+1)*w+j] >= lcs[i*w+j+1]:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, op{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, op{'+', b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,71 @@
+package errreport
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// flushTimeout bounds how long Flush waits for queued events on shutdown.
+const flushTimeout = 2 * time.Second
+
+// Init configures the Sentry client. Any Sentry-compatible DSN works
+// (e.g. GlitchTip).
+func Init(dsn, environment, release string) error {
+	return sentry.Init(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+		Release:     release,
+		ServerName:  "tacl",
+	})
+}
+
+// Flush waits for buffered events to be sent.
+func Flush() {
+	sentry.Flush(flushTimeout)
+}
+
+// Middleware reports panics and 5xx responses with request context. It
+// must run after ginzap.RecoveryWithZap: panics are reported and then
+// re-raised so the recovery middleware still logs them and answers 500.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hub := sentry.CurrentHub().Clone()
+		hub.Scope().SetRequest(c.Request)
+
+		defer func() {
+			if err := recover(); err != nil {
+				withContext(hub, c)
+				hub.RecoverWithContext(c.Request.Context(), err)
+				panic(err)
+			}
+		}()
+
+		c.Next()
+
+		if c.Writer.Status() < http.StatusInternalServerError {
+			return
+		}
+		withContext(hub, c)
+		if len(c.Errors) > 0 {
+			hub.CaptureException(c.Errors.Last().Err)
+			return
+		}
+		hub.CaptureMessage(fmt.Sprintf("%s %s returned %d", c.Request.Method, c.FullPath(), c.Writer.Status()))
+	}
+}
+
+// withContext tags the event with the route, status and caller.
+func withContext(hub *sentry.Hub, c *gin.Context) {
+	scope := hub.Scope()
+	scope.SetTag("route", c.FullPath())
+	scope.SetTag("method", c.Request.Method)
+	scope.SetTag("status", fmt.Sprint(c.Writer.Status()))
+	if id, ok := common.GetIdentity(c); ok {
+		scope.SetUser(sentry.User{Username: id.Actor(), IPAddress: id.IP})
+	}
+}
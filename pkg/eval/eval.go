@@ -0,0 +1,354 @@
+// Package eval is a small, local evaluator for Tailscale policies. It
+// answers "would src reach dst" and "may src SSH to dst as user" from the
+// ACLs, groups, hosts and SSH rules alone, so tests can run without
+// Tailscale. Anything that needs live tailnet data (most autogroups,
+// whether an IP belongs to someone's own device, device posture) is
+// reported as unsupported rather than guessed.
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupported is wrapped by errors for selectors the evaluator can't resolve offline.
+var ErrUnsupported = fmt.Errorf("not supported by the local evaluator")
+
+// Policy is the subset of a policy the evaluator understands.
+type Policy struct {
+	ACLs   []ACL               `json:"acls"`
+	SSH    []SSHRule           `json:"ssh"`
+	Groups map[string][]string `json:"groups"`
+	Hosts  map[string]string   `json:"hosts"`
+	// TagOwners is only read for the tags it defines.
+	TagOwners map[string][]string `json:"tagOwners"`
+
+	ACLTests []ACLTest `json:"aclTests"`
+	Tests    []ACLTest `json:"tests"`
+	SSHTests []SSHTest `json:"sshTests"`
+
+	// members holds each group's members as a set, built on first use so
+	// large groups aren't scanned for every rule and test. It makes a
+	// Policy unsafe for concurrent use.
+	members map[string]map[string]bool
+}
+
+// ACL is one network rule.
+type ACL struct {
+	Action string   `json:"action"`
+	Src    []string `json:"src"`
+	Dst    []string `json:"dst"`
+	Proto  string   `json:"proto,omitempty"`
+}
+
+// SSHRule is one Tailscale SSH rule.
+type SSHRule struct {
+	Action string   `json:"action"`
+	Src    []string `json:"src"`
+	Dst    []string `json:"dst"`
+	Users  []string `json:"users"`
+}
+
+// ACLTest asserts which destinations src may and may not reach.
+type ACLTest struct {
+	Src    string   `json:"src"`
+	Proto  string   `json:"proto,omitempty"`
+	Accept []string `json:"accept,omitempty"`
+	Deny   []string `json:"deny,omitempty"`
+}
+
+// SSHTest asserts which users src may SSH as on each dst.
+type SSHTest struct {
+	Src    string   `json:"src"`
+	Dst    []string `json:"dst"`
+	Accept []string `json:"accept,omitempty"`
+	Check  []string `json:"check,omitempty"`
+	Deny   []string `json:"deny,omitempty"`
+}
+
+// FromState decodes a policy out of a state (or policy file) document.
+func FromState(data map[string]interface{}) (*Policy, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// AllACLTests returns the network tests, whether stored as "aclTests" (TACL) or "tests".
+func (p *Policy) AllACLTests() []ACLTest {
+	return append(append([]ACLTest(nil), p.ACLTests...), p.Tests...)
+}
+
+// Allowed reports whether src may reach dst ("host:port") over proto
+// (empty for any), and the index of the first ACL that allows it. If no
+// rule allows it but some rule couldn't be evaluated, the error wraps
+// ErrUnsupported.
+func (p *Policy) Allowed(src, dst, proto string) (bool, int, error) {
+	host, port, err := splitDst(dst)
+	if err != nil {
+		return false, -1, err
+	}
+	var unknown error
+	for i, a := range p.ACLs {
+		if a.Action != "accept" || !protoMatches(a.Proto, proto) {
+			continue
+		}
+		ok, err := p.anyMatches(a.Src, src)
+		if err != nil {
+			unknown = fmt.Errorf("acls[%d]: %w", i, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		for _, d := range a.Dst {
+			rh, rports, err := splitDst(d)
+			if err != nil {
+				return false, -1, fmt.Errorf("acls[%d]: %w", i, err)
+			}
+			if !portMatches(rports, port) {
+				continue
+			}
+			ok, err := p.matchesDst(rh, host, src)
+			if err != nil {
+				unknown = fmt.Errorf("acls[%d]: %w", i, err)
+				continue
+			}
+			if ok {
+				return true, i, nil
+			}
+		}
+	}
+	return false, -1, unknown
+}
+
+// SSHAction returns "accept", "check" or "" (denied) for src logging in to
+// dst as user, from the first matching SSH rule. Like Allowed, a denial
+// that depends on a rule it couldn't evaluate wraps ErrUnsupported.
+func (p *Policy) SSHAction(src, dst, user string) (string, error) {
+	var unknown error
+	for i, r := range p.SSH {
+		if !userMatches(r.Users, user) {
+			continue
+		}
+		srcOK, err := p.anyMatches(r.Src, src)
+		if err != nil {
+			unknown = fmt.Errorf("ssh[%d]: %w", i, err)
+			continue
+		}
+		dstOK, err := p.anyMatchesDst(r.Dst, dst, src)
+		if err != nil {
+			unknown = fmt.Errorf("ssh[%d]: %w", i, err)
+			continue
+		}
+		if srcOK && dstOK {
+			return r.Action, nil
+		}
+	}
+	return "", unknown
+}
+
+// anyMatches reports whether any selector covers subject. Selectors that
+// can't be evaluated only matter if nothing else matches.
+func (p *Policy) anyMatches(selectors []string, subject string) (bool, error) {
+	var unknown error
+	for _, s := range selectors {
+		ok, err := p.matches(s, subject)
+		if err != nil {
+			unknown = err
+			continue
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, unknown
+}
+
+// anyMatchesDst is anyMatches for destination selectors.
+func (p *Policy) anyMatchesDst(selectors []string, subject, src string) (bool, error) {
+	var unknown error
+	for _, s := range selectors {
+		ok, err := p.matchesDst(s, subject, src)
+		if err != nil {
+			unknown = err
+			continue
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, unknown
+}
+
+// matchesDst is matches for destination selectors, which may also be
+// autogroup:self: the source user's own, untagged devices. A test can name
+// those by the user's login; tagged devices never match.
+func (p *Policy) matchesDst(selector, subject, src string) (bool, error) {
+	if selector != "autogroup:self" {
+		return p.matches(selector, subject)
+	}
+	switch {
+	case strings.HasPrefix(subject, "tag:"):
+		return false, nil
+	case strings.Contains(subject, "@"):
+		return subject == src, nil
+	default:
+		return false, fmt.Errorf("%s: %w", selector, ErrUnsupported)
+	}
+}
+
+// matches reports whether selector (a rule's src or dst host) covers subject
+// (a test's src or dst host): a user, group, tag, host alias or IP.
+func (p *Policy) matches(selector, subject string) (bool, error) {
+	// autogroup:danger-all also covers devices shared in from other
+	// tailnets, which can't be told apart offline
+	if selector == "*" || selector == "autogroup:danger-all" || selector == subject {
+		return true, nil
+	}
+	switch {
+	case selector == "autogroup:member":
+		// Any user, or a group of them
+		return strings.Contains(subject, "@") || strings.HasPrefix(subject, "group:"), nil
+	case selector == "autogroup:tagged":
+		return strings.HasPrefix(subject, "tag:"), nil
+	case strings.HasPrefix(selector, "autogroup:"):
+		return false, fmt.Errorf("%s: %w", selector, ErrUnsupported)
+	case strings.HasPrefix(selector, "group:"):
+		members, ok := p.groupMembers(selector)
+		if !ok {
+			return false, nil
+		}
+		if members[subject] {
+			return true, nil
+		}
+		// A test naming a group matches a rule for a group containing all its members
+		if sub, ok := p.Groups[subject]; ok && len(sub) > 0 {
+			for _, m := range sub {
+				if !members[m] {
+					return false, nil
+				}
+			}
+			return true, nil
+		}
+		return false, nil
+	}
+
+	// Addresses: host aliases, IPs and CIDRs
+	sel, selOK := p.prefix(selector)
+	subAddr, subOK := p.prefix(subject)
+	if selOK && subOK {
+		return sel.Contains(subAddr.Addr()) && sel.Bits() <= subAddr.Bits(), nil
+	}
+	return false, nil
+}
+
+// groupMembers returns the members of a group as a set.
+func (p *Policy) groupMembers(group string) (map[string]bool, bool) {
+	if p.members == nil {
+		p.members = make(map[string]map[string]bool, len(p.Groups))
+		for name, list := range p.Groups {
+			set := make(map[string]bool, len(list))
+			for _, m := range list {
+				set[m] = true
+			}
+			p.members[name] = set
+		}
+	}
+	set, ok := p.members[group]
+	return set, ok
+}
+
+// prefix resolves a host alias, IP or CIDR to a prefix.
+func (p *Policy) prefix(s string) (netip.Prefix, bool) {
+	if v, ok := p.Hosts[s]; ok {
+		s = v
+	}
+	if pfx, err := netip.ParsePrefix(s); err == nil {
+		return pfx, true
+	}
+	if a, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(a, a.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+func userMatches(users []string, user string) bool {
+	for _, u := range users {
+		switch {
+		case u == user, u == "*":
+			return true
+		case u == "autogroup:nonroot" && user != "root":
+			return true
+		}
+	}
+	return false
+}
+
+func protoMatches(rule, test string) bool {
+	if rule == "" || test == "" {
+		return true
+	}
+	return strings.EqualFold(rule, test)
+}
+
+// splitDst splits "host:ports", allowing IPv6 hosts like "[::1]:22".
+func splitDst(dst string) (host, ports string, err error) {
+	i := strings.LastIndex(dst, ":")
+	if i <= 0 || i == len(dst)-1 {
+		return "", "", fmt.Errorf("destination %q must be host:port", dst)
+	}
+	return strings.Trim(dst[:i], "[]"), dst[i+1:], nil
+}
+
+// portMatches reports whether the port expression (e.g. "*", "22", "80,443",
+// "8000-8100") covers every port of the test's port expression.
+func portMatches(rule, test string) bool {
+	if rule == "*" {
+		return true
+	}
+	if test == "*" {
+		return false
+	}
+	for _, tp := range strings.Split(test, ",") {
+		tlo, thi, ok := portRange(tp)
+		if !ok {
+			return false
+		}
+		covered := false
+		for _, rp := range strings.Split(rule, ",") {
+			if lo, hi, ok := portRange(rp); ok && lo <= tlo && thi <= hi {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func portRange(s string) (lo, hi int, ok bool) {
+	a, b, isRange := strings.Cut(s, "-")
+	lo, err := strconv.Atoi(a)
+	if err != nil {
+		return 0, 0, false
+	}
+	if !isRange {
+		return lo, lo, true
+	}
+	hi, err = strconv.Atoi(b)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
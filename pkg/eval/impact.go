@@ -0,0 +1,140 @@
+package eval
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Pair is a source that can reach a destination ("host:port").
+type Pair struct {
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+}
+
+// SSHChange is a change to what src may do when logging in to dst as user:
+// "accept", "check" or "" (denied).
+type SSHChange struct {
+	Src    string `json:"src"`
+	Dst    string `json:"dst"`
+	User   string `json:"user"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// Impact is how access differs between two policies.
+type Impact struct {
+	// Gained and Lost are the pairs only the new or only the old policy
+	// allows.
+	Gained []Pair `json:"gained"`
+	Lost   []Pair `json:"lost"`
+	// SSH lists the logins whose outcome changed.
+	SSH []SSHChange `json:"ssh"`
+	// Undetermined counts the pairs that may have changed, but depend on
+	// rules the local evaluator can't resolve (see ErrUnsupported).
+	Undetermined int `json:"undetermined"`
+}
+
+// Compare reports which access before and after disagree on. Both are
+// checked over the same subjects: the users in groups and rules, tags,
+// host aliases and the addresses rules name, each as a source and, on
+// every port expression the rules use, as a destination.
+func Compare(before, after *Policy) Impact {
+	imp := Impact{Gained: []Pair{}, Lost: []Pair{}, SSH: []SSHChange{}}
+	subjects := make(map[string]bool)
+	ports := make(map[string]bool)
+	users := make(map[string]bool)
+	for _, p := range []*Policy{before, after} {
+		p.collect(subjects, ports, users)
+	}
+	subs, portList, userList := sortedSet(subjects), sortedSet(ports), sortedSet(users)
+
+	for _, src := range subs {
+		for _, host := range subs {
+			for _, port := range portList {
+				dst := host + ":" + port
+				if strings.Count(host, ":") > 1 {
+					// An IPv6 address
+					dst = "[" + host + "]:" + port
+				}
+				was, _, errBefore := before.Allowed(src, dst, "")
+				is, _, errAfter := after.Allowed(src, dst, "")
+				switch {
+				case was == is:
+				case errBefore != nil || errAfter != nil:
+					imp.Undetermined++
+				case is:
+					imp.Gained = append(imp.Gained, Pair{Src: src, Dst: dst})
+				default:
+					imp.Lost = append(imp.Lost, Pair{Src: src, Dst: dst})
+				}
+			}
+			for _, user := range userList {
+				was, errBefore := before.SSHAction(src, host, user)
+				is, errAfter := after.SSHAction(src, host, user)
+				switch {
+				case was == is:
+				case errors.Is(errBefore, ErrUnsupported) || errors.Is(errAfter, ErrUnsupported):
+					imp.Undetermined++
+				default:
+					imp.SSH = append(imp.SSH, SSHChange{Src: src, Dst: host, User: user, Before: was, After: is})
+				}
+			}
+		}
+	}
+	return imp
+}
+
+// collect adds the subjects, destination port expressions and SSH users
+// the policy mentions.
+func (p *Policy) collect(subjects, ports, users map[string]bool) {
+	add := func(s string) {
+		if s != "*" && !strings.HasPrefix(s, "autogroup:") && !strings.HasPrefix(s, "group:") {
+			subjects[s] = true
+		}
+	}
+	for _, members := range p.Groups {
+		for _, m := range members {
+			add(m)
+		}
+	}
+	for tag := range p.TagOwners {
+		add(tag)
+	}
+	for host := range p.Hosts {
+		add(host)
+	}
+	for _, a := range p.ACLs {
+		for _, s := range a.Src {
+			add(s)
+		}
+		for _, d := range a.Dst {
+			host, port, err := splitDst(d)
+			if err != nil {
+				continue
+			}
+			add(host)
+			ports[port] = true
+		}
+	}
+	for _, r := range p.SSH {
+		for _, s := range append(append([]string(nil), r.Src...), r.Dst...) {
+			add(s)
+		}
+		for _, u := range r.Users {
+			if u == "*" {
+				u = "root"
+			}
+			users[u] = true
+		}
+	}
+}
+
+func sortedSet(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
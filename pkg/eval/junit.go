@@ -0,0 +1,73 @@
+package eval
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes results as JUnit XML, one testsuite per policy test.
+func WriteJUnit(w io.Writer, results []Result) error {
+	var doc junitSuites
+	index := map[string]int{}
+	for _, r := range results {
+		i, ok := index[r.Suite]
+		if !ok {
+			i = len(doc.Suites)
+			index[r.Suite] = i
+			doc.Suites = append(doc.Suites, junitSuite{Name: r.Suite})
+		}
+		s := &doc.Suites[i]
+		c := junitCase{Name: r.Name, ClassName: r.Suite}
+		switch r.Outcome {
+		case OutcomeFail:
+			c.Failure = &junitMessage{Message: r.Message}
+			s.Failures++
+			doc.Failures++
+		case OutcomeSkipped:
+			c.Skipped = &junitMessage{Message: r.Message}
+			s.Skipped++
+			doc.Skipped++
+		}
+		s.Tests++
+		doc.Tests++
+		s.Cases = append(s.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
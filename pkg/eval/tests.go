@@ -0,0 +1,102 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Test outcomes.
+const (
+	OutcomePass    = "pass"
+	OutcomeFail    = "fail"
+	OutcomeSkipped = "skipped"
+)
+
+// Result is the outcome of one assertion in a test.
+type Result struct {
+	Name    string `json:"name"`
+	Suite   string `json:"suite"`
+	Outcome string `json:"outcome"`
+	Message string `json:"message,omitempty"`
+}
+
+// RunTests evaluates every ACL and SSH test in the policy.
+func (p *Policy) RunTests() []Result {
+	var out []Result
+	for i, t := range p.AllACLTests() {
+		suite := fmt.Sprintf("aclTests[%d]", i)
+		for _, dst := range t.Accept {
+			out = append(out, p.aclAssertion(suite, t, dst, true))
+		}
+		for _, dst := range t.Deny {
+			out = append(out, p.aclAssertion(suite, t, dst, false))
+		}
+	}
+	for i, t := range p.SSHTests {
+		suite := fmt.Sprintf("sshTests[%d]", i)
+		for _, dst := range t.Dst {
+			for _, u := range t.Accept {
+				out = append(out, p.sshAssertion(suite, t.Src, dst, u, "accept"))
+			}
+			for _, u := range t.Check {
+				out = append(out, p.sshAssertion(suite, t.Src, dst, u, "check"))
+			}
+			for _, u := range t.Deny {
+				out = append(out, p.sshAssertion(suite, t.Src, dst, u, ""))
+			}
+		}
+	}
+	return out
+}
+
+func (p *Policy) aclAssertion(suite string, t ACLTest, dst string, want bool) Result {
+	verb := "accept"
+	if !want {
+		verb = "deny"
+	}
+	r := Result{Suite: suite, Name: fmt.Sprintf("%s %s %s", t.Src, verb, dst)}
+	if t.Proto != "" {
+		r.Name += " (" + t.Proto + ")"
+	}
+	got, rule, err := p.Allowed(t.Src, dst, t.Proto)
+	switch {
+	case errors.Is(err, ErrUnsupported):
+		r.Outcome, r.Message = OutcomeSkipped, err.Error()
+	case err != nil:
+		r.Outcome, r.Message = OutcomeFail, err.Error()
+	case got == want:
+		r.Outcome = OutcomePass
+	case got:
+		r.Outcome, r.Message = OutcomeFail, fmt.Sprintf("allowed by acls[%d]", rule)
+	default:
+		r.Outcome, r.Message = OutcomeFail, "no ACL allows it"
+	}
+	return r
+}
+
+func (p *Policy) sshAssertion(suite, src, dst, user, want string) Result {
+	verb := want
+	if verb == "" {
+		verb = "deny"
+	}
+	r := Result{Suite: suite, Name: fmt.Sprintf("%s ssh %s@%s %s", src, user, dst, verb)}
+	got, err := p.SSHAction(src, dst, user)
+	switch {
+	case errors.Is(err, ErrUnsupported):
+		r.Outcome, r.Message = OutcomeSkipped, err.Error()
+	case err != nil:
+		r.Outcome, r.Message = OutcomeFail, err.Error()
+	case got == want:
+		r.Outcome = OutcomePass
+	default:
+		r.Outcome, r.Message = OutcomeFail, "got "+orDeny(got)
+	}
+	return r
+}
+
+func orDeny(action string) string {
+	if action == "" {
+		return "deny"
+	}
+	return action
+}
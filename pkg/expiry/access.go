@@ -0,0 +1,190 @@
+package expiry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Access request kinds.
+const (
+	KindACL = "acl"
+	KindSSH = "ssh"
+)
+
+// AccessRequest is the JSON body for POST /access-requests: a rule that
+// lasts for Duration (or until ExpiresAt).
+//
+// Example JSON:
+//
+//	{ "dst": ["tag:prod-db:5432"], "duration": "2h" }
+type AccessRequest struct {
+	// Kind is "acl" (the default) or "ssh".
+	Kind string `json:"kind"`
+	// Src defaults to the caller's login.
+	Src []string `json:"src"`
+	Dst []string `json:"dst" binding:"required"`
+	// Proto applies to ACL requests.
+	Proto string `json:"proto,omitempty"`
+	// Users and Action apply to SSH requests. Action defaults to "accept".
+	Users  []string `json:"users,omitempty"`
+	Action string   `json:"action,omitempty"`
+	// Duration (e.g. "4h") or ExpiresAt bounds the rule; one is required.
+	Duration  string     `json:"duration,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// RegisterRoutes wires up POST /access-requests, which creates a temporary
+// ACL or SSH rule lasting at most maxDuration.
+//
+// The rule is sent through the router as the caller's own request, so it's
+// authenticated, checked against deny rules and held for approval like any
+// other. The access-requests:write scope stands in for acls:write or
+// ssh:write only when the rule's src is the caller's own login; other
+// sources need the rule's own scope as well.
+func RegisterRoutes(r *gin.Engine, state *common.State, maxDuration time.Duration) {
+	r.POST("/access-requests", func(c *gin.Context) {
+		createAccessRequest(c, r, state, maxDuration)
+	})
+}
+
+// createAccessRequest => POST /access-requests
+func createAccessRequest(c *gin.Context, r *gin.Engine, state *common.State, maxDuration time.Duration) {
+	var req AccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	caller, _ := common.GetIdentity(c)
+	if len(req.Src) == 0 {
+		if caller.LoginName == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'src' field (the caller has no login to default to)"})
+			return
+		}
+		req.Src = []string{caller.LoginName}
+	}
+	ownAccess := caller.LoginName != "" && len(req.Src) == 1 && req.Src[0] == caller.LoginName
+	expiresAt, err := expiryOf(req, time.Now().UTC(), maxDuration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	expiry := common.Expiry{ExpiresAt: &expiresAt}
+
+	var path string
+	var rule interface{}
+	switch req.Kind {
+	case "", KindACL:
+		path = "/acls"
+		rule = struct {
+			Action string   `json:"action"`
+			Src    []string `json:"src"`
+			Dst    []string `json:"dst"`
+			Proto  string   `json:"proto,omitempty"`
+			common.Expiry
+		}{"accept", req.Src, req.Dst, req.Proto, expiry}
+	case KindSSH:
+		if len(req.Users) == 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'users' field for an SSH access request"})
+			return
+		}
+		action := req.Action
+		if action == "" {
+			action = "accept"
+		}
+		path = "/ssh"
+		rule = struct {
+			Action string   `json:"action"`
+			Src    []string `json:"src"`
+			Dst    []string `json:"dst"`
+			Users  []string `json:"users"`
+			common.Expiry
+		}{action, req.Src, req.Dst, req.Users, expiry}
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid 'kind'. Must be 'acl' or 'ssh'."})
+		return
+	}
+	if section, _ := common.SectionForResource(path[1:]); state.SectionDisabled(section) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("The %s module is disabled", path[1:])})
+		return
+	}
+	if !ownAccess && !common.Authorized(c, http.MethodPost, path) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: fmt.Sprintf("Requesting access for a 'src' other than your own login needs the %s:write scope", path[1:])})
+		return
+	}
+
+	// Create the rule through the router as the caller. We hold the
+	// mutation lock already, which the batch context accounts for.
+	body, err := json.Marshal(rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to encode rule"})
+		return
+	}
+	ctx, commit := common.BatchContext(c.Request.Context())
+	if ownAccess {
+		ctx = common.DelegatedContext(ctx, c.Request.Method, c.Request.URL.Path)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, ruleRequest(ctx, c.Request, path, body))
+	if rec.Code >= 200 && rec.Code <= 299 {
+		commit()
+	}
+	c.Data(rec.Code, "application/json; charset=utf-8", bytes.TrimSpace(rec.Body.Bytes()))
+}
+
+// ruleRequest builds the POST of body to path that creates an access
+// request's rule. It's a copy of the access request, so the rule is
+// authenticated and authorized as the caller.
+func ruleRequest(ctx context.Context, from *http.Request, path string, body []byte) *http.Request {
+	req := from.Clone(ctx)
+	req.Method = http.MethodPost
+	req.URL = &url.URL{Path: path}
+	req.RequestURI = path
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Del("Content-Length")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Del("If-Match")
+	return req
+}
+
+// expiryOf works out when the requested rule expires, capped at maxDuration.
+func expiryOf(req AccessRequest, now time.Time, maxDuration time.Duration) (time.Time, error) {
+	var expiresAt time.Time
+	switch {
+	case req.Duration != "" && req.ExpiresAt != nil:
+		return time.Time{}, errors.New("Set only one of 'duration' and 'expiresAt'")
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return time.Time{}, errors.New("Invalid duration. Must be a positive duration (e.g. '2h', '30m').")
+		}
+		expiresAt = now.Add(d)
+	case req.ExpiresAt != nil:
+		expiresAt = req.ExpiresAt.UTC()
+	default:
+		return time.Time{}, errors.New("Missing 'duration' or 'expiresAt' field")
+	}
+	if !expiresAt.After(now) {
+		return time.Time{}, errors.New("'expiresAt' must be in the future")
+	}
+	if maxDuration > 0 && expiresAt.Sub(now) > maxDuration {
+		return time.Time{}, fmt.Errorf("Access can be requested for at most %s", maxDuration)
+	}
+	return expiresAt, nil
+}
@@ -0,0 +1,162 @@
+// Package expiry retires temporary rules: a reaper that removes (or
+// disables) ACL and SSH entries past their expiresAt, and the
+// /access-requests endpoint that creates such rules.
+package expiry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// Reaper modes.
+const (
+	ModeDelete  = "delete"  // expired entries are deleted
+	ModeDisable = "disable" // expired entries are kept with "disabled": true
+)
+
+// Actor attributes the reaper's changes.
+const Actor = "tacl-expiry"
+
+// section is a list section with temporary entries, and how its module
+// takes updates.
+type section struct {
+	key       string // state key
+	path      string // route prefix
+	bodyField string // key holding the entry in PUT bodies
+}
+
+var sections = []section{
+	{key: "acls", path: "/acls", bodyField: "entry"},
+	{key: "ssh", path: "/ssh", bodyField: "rule"},
+}
+
+// Reaper retires expired entries. Changes go through the router as
+// internal requests, so they're audited, versioned and delivered to
+// webhooks like any other.
+type Reaper struct {
+	state   *common.State
+	syncer  *sync.Syncer
+	handler http.Handler
+	mode    string
+	logger  *zap.Logger
+}
+
+// NewReaper returns a reaper that dispatches its changes to handler and
+// has syncer push them.
+func NewReaper(state *common.State, syncer *sync.Syncer, handler http.Handler, mode string, logger *zap.Logger) (*Reaper, error) {
+	if mode != ModeDelete && mode != ModeDisable {
+		return nil, fmt.Errorf("unknown mode %q (want %s or %s)", mode, ModeDelete, ModeDisable)
+	}
+	return &Reaper{state: state, syncer: syncer, handler: handler, mode: mode, logger: logger}, nil
+}
+
+// Start reaps every interval until ctx is cancelled. A standby doesn't
+// reap; the active server does.
+func (rp *Reaper) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !rp.state.IsStandby() {
+					rp.Reap(ctx)
+				}
+			}
+		}
+	}()
+}
+
+// Reap retires every entry expired by now and returns how many it changed.
+// If any changed, a sync is triggered. Expired entries are already left out
+// of the synced policy, so this is cleanup, but it makes the change visible
+// in the audit log and on the tailnet right away.
+func (rp *Reaper) Reap(ctx context.Context) int {
+	n := 0
+	for _, sec := range sections {
+		if rp.state.SectionDisabled(sec.key) {
+			continue
+		}
+		n += rp.reapSection(ctx, sec, time.Now())
+	}
+	if n > 0 {
+		rp.logger.Info("Retired expired rules", zap.Int("count", n), zap.String("mode", rp.mode))
+		rp.syncer.Trigger()
+	}
+	return n
+}
+
+func (rp *Reaper) reapSection(ctx context.Context, sec section, now time.Time) int {
+	unlock := rp.state.LockSection(sec.key)
+	defer unlock()
+
+	raw := rp.state.GetValue(sec.key)
+	if raw == nil {
+		return 0
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return 0
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		rp.logger.Error("Failed to parse section for expiry", zap.String("section", sec.key), zap.Error(err))
+		return 0
+	}
+
+	n := 0
+	for _, entry := range entries {
+		id, _ := entry["id"].(string)
+		if id == "" || !common.ExpiredEntry(entry, now) {
+			continue
+		}
+		if disabled, _ := entry["disabled"].(bool); disabled && rp.mode == ModeDisable {
+			continue
+		}
+		if err := rp.retire(ctx, sec, id, entry); err != nil {
+			rp.logger.Error("Failed to retire expired rule",
+				zap.String("section", sec.key), zap.String("id", id), zap.Error(err))
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func (rp *Reaper) retire(ctx context.Context, sec section, id string, entry map[string]interface{}) error {
+	method := http.MethodDelete
+	body := map[string]interface{}{"id": id}
+	if rp.mode == ModeDisable {
+		method = http.MethodPut
+		delete(entry, "id")
+		for _, f := range common.MetaFields {
+			delete(entry, f)
+		}
+		entry["disabled"] = true
+		body[sec.bodyField] = entry
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := common.NewInternalRequest(ctx, method, sec.path, b, common.Identity{NodeName: Actor})
+	if err != nil {
+		return err
+	}
+	rec := httptest.NewRecorder()
+	rp.handler.ServeHTTP(rec, req)
+	if rec.Code >= 300 {
+		return fmt.Errorf("%s %s: %d %s", method, sec.path, rec.Code, rec.Body.String())
+	}
+	return nil
+}
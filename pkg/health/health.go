@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	gosync "sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkTimeout bounds how long a single readiness check may take.
+const checkTimeout = 5 * time.Second
+
+// Check is a named readiness dependency check. Fn returns nil when healthy.
+type Check struct {
+	Name string
+	Fn   func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the body returned by /readyz.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Run executes every check concurrently and reports whether all passed.
+func Run(ctx context.Context, checks []Check) Report {
+	rep := Report{Status: "ok", Checks: make(map[string]CheckResult, len(checks))}
+	var mu gosync.Mutex
+	var wg gosync.WaitGroup
+	for _, chk := range checks {
+		wg.Add(1)
+		go func(chk Check) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := chk.Fn(cctx)
+			res := CheckResult{Status: "ok", Duration: time.Since(start).Round(time.Millisecond).String()}
+			if err != nil {
+				res.Status = "fail"
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			rep.Checks[chk.Name] = res
+			if err != nil {
+				rep.Status = "fail"
+			}
+		}(chk)
+	}
+	wg.Wait()
+	return rep
+}
+
+// Cached wraps a check so it runs at most once per ttl, answering from
+// the last result in between. It's for checks that are too costly to run
+// on every probe, such as writing to storage while Kubernetes polls every
+// few seconds.
+func Cached(fn func(ctx context.Context) error, ttl time.Duration) func(ctx context.Context) error {
+	var mu gosync.Mutex
+	var last error
+	var at time.Time
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !at.IsZero() && time.Since(at) < ttl {
+			return last
+		}
+		last, at = fn(ctx), time.Now()
+		return last
+	}
+}
+
+// ReadyHandler serves /readyz: 200 when every check passes, 503 otherwise,
+// with per-check detail either way.
+func ReadyHandler(checks []Check) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rep := Run(c.Request.Context(), checks)
+		code := http.StatusOK
+		if rep.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, rep)
+	}
+}
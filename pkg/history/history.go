@@ -0,0 +1,277 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/audit"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"go.uber.org/zap"
+)
+
+// stateKey is where versions are kept. The leading underscore keeps it out of the synced policy.
+const stateKey = "_history"
+
+// Operations recorded on versions.
+const (
+	OpCreated = "created"
+	OpUpdated = "updated"
+	OpDeleted = "deleted"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Version is one stored revision of an entry. Value is the entry as stored
+// in state, or null for a deletion.
+type Version struct {
+	Rev   int         `json:"rev"`
+	Time  time.Time   `json:"time"`
+	Actor string      `json:"actor,omitempty"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// resource describes how a route prefix maps onto a state section.
+type resource struct {
+	section string
+	param   string // path parameter naming the entry, matching the module's GET route
+	prefix  string // prefix added to the param to form the state key, e.g. "group:"
+	list    bool   // section is an array of entries with an "id"
+}
+
+// resources with per-entry history.
+var resources = map[string]resource{
+	"acls":      {section: "acls", param: "id", list: true},
+	"acltests":  {section: "aclTests", param: "id", list: true},
+	"grants":    {section: "grants", param: "id", list: true},
+	"nodeattrs": {section: "nodeAttrs", param: "id", list: true},
+	"ssh":       {section: "ssh", param: "id", list: true},
+	"groups":    {section: "groups", param: "name", prefix: "group:"},
+	"hosts":     {section: "hosts", param: "name"},
+}
+
+// Recorder stores entry versions from audited mutations. It is an audit.Sink
+// and runs inside the request's section or mutation lock.
+type Recorder struct {
+	state *common.State
+	depth int
+}
+
+// NewRecorder keeps up to depth versions per entry.
+func NewRecorder(state *common.State, depth int) *Recorder {
+	return &Recorder{state: state, depth: depth}
+}
+
+// Write records a version for every entry a successful mutation changed.
+func (h *Recorder) Write(e audit.Event) error {
+	res, ok := resources[e.Resource]
+	if !ok || e.Outcome != audit.OutcomeSuccess || e.Diff == nil {
+		return nil
+	}
+
+	// Requests to different sections can record concurrently
+	unlock := h.state.LockKey(stateKey)
+	defer unlock()
+
+	all, err := loadHistory(h.state)
+	if err != nil {
+		return err
+	}
+	entries := all[res.section]
+	if entries == nil {
+		entries = make(map[string][]Version)
+		all[res.section] = entries
+	}
+	add := func(key, op string, value interface{}) {
+		if strings.HasPrefix(key, "#") {
+			return // entry without an id, nothing to address it by
+		}
+		versions := entries[key]
+		rev := 1
+		if n := len(versions); n > 0 {
+			rev = versions[n-1].Rev + 1
+		}
+		versions = append(versions, Version{Rev: rev, Time: e.Time, Actor: e.Actor, Op: op, Value: value})
+		if h.depth > 0 && len(versions) > h.depth {
+			versions = versions[len(versions)-h.depth:]
+		}
+		entries[key] = versions
+	}
+	for _, c := range e.Diff.Added {
+		add(c.Key, OpCreated, c.After)
+	}
+	for _, c := range e.Diff.Changed {
+		add(c.Key, OpUpdated, c.After)
+	}
+	for _, c := range e.Diff.Removed {
+		add(c.Key, OpDeleted, nil)
+	}
+	return h.state.UpdateKeyAndSave(stateKey, all)
+}
+
+// RegisterRoutes wires up history and revert endpoints for each tracked resource.
+//
+//	GET  /acls/:id/history      => versions of one ACL, oldest first
+//	POST /acls/:id/revert/:rev  => restore the ACL to a stored version
+//
+// and likewise for /acltests/:id, /nodeattrs/:id, /ssh/:id, /groups/:name
+// and /hosts/:name.
+func RegisterRoutes(r *gin.Engine, state *common.State) {
+	for prefix, res := range resources {
+		res := res
+		r.GET("/"+prefix+"/:"+res.param+"/history", func(c *gin.Context) {
+			getHistory(c, state, res)
+		})
+		r.POST("/"+prefix+"/:"+res.param+"/revert/:rev", func(c *gin.Context) {
+			revertEntry(c, state, res)
+		})
+	}
+}
+
+// getHistory => GET /<resource>/:key/history
+func getHistory(c *gin.Context, state *common.State, res resource) {
+	all, err := loadHistory(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse history"})
+		return
+	}
+	versions, ok := all[res.section][res.prefix+c.Param(res.param)]
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No history for entry"})
+		return
+	}
+	c.JSON(http.StatusOK, versions)
+}
+
+// revertEntry => POST /<resource>/:key/revert/:rev
+func revertEntry(c *gin.Context, state *common.State, res resource) {
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid revision"})
+		return
+	}
+	all, err := loadHistory(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse history"})
+		return
+	}
+	key := res.prefix + c.Param(res.param)
+	var target *Version
+	for i, v := range all[res.section][key] {
+		if v.Rev == rev {
+			target = &all[res.section][key][i]
+			break
+		}
+	}
+	if target == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Revision not found"})
+		return
+	}
+
+	actor := common.Actor(c)
+	var saveErr error
+	if res.list {
+		saveErr = revertListEntry(c.Request.Context(), state, res.section, key, target.Value, actor)
+	} else {
+		saveErr = revertMapEntry(c.Request.Context(), state, res, key, target.Value, actor)
+	}
+	if saveErr != nil {
+		if state.Logger != nil {
+			state.Logger.Error("Failed to revert entry", zap.String("section", res.section), zap.String("key", key), zap.Error(saveErr))
+		}
+		common.RespondSaveError(c, saveErr, ErrorResponse{Error: "Failed to revert entry"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rev": target.Rev, "value": target.Value})
+}
+
+// revertListEntry replaces, re-inserts or (for a deletion version) removes
+// the entry with the given id.
+func revertListEntry(ctx context.Context, state *common.State, section, id string, value interface{}, actor string) error {
+	var list []map[string]interface{}
+	if err := roundTrip(state.GetValue(section), &list); err != nil {
+		return err
+	}
+
+	idx := -1
+	for i, entry := range list {
+		if entry["id"] == id {
+			idx = i
+			break
+		}
+	}
+
+	switch entry, _ := value.(map[string]interface{}); {
+	case entry == nil && idx >= 0:
+		list = append(list[:idx], list[idx+1:]...)
+	case entry == nil:
+		return nil // already deleted
+	default:
+		now := time.Now().UTC()
+		entry["updatedBy"] = actor
+		entry["updatedAt"] = now
+		if idx >= 0 {
+			list[idx] = entry
+		} else {
+			list = append(list, entry)
+		}
+	}
+	return state.UpdateKeyAndSaveContext(ctx, section, list)
+}
+
+// revertMapEntry sets or (for a deletion version) removes a key of a
+// map-shaped section, touching its metadata sidecar.
+func revertMapEntry(ctx context.Context, state *common.State, res resource, key string, value interface{}, actor string) error {
+	m := map[string]interface{}{}
+	if raw := state.GetValue(res.section); raw != nil {
+		if err := roundTrip(raw, &m); err != nil {
+			return err
+		}
+	}
+	meta := common.LoadSectionMeta(state, res.section)
+	name := strings.TrimPrefix(key, res.prefix)
+	if value == nil {
+		delete(m, key)
+		delete(meta, name)
+	} else {
+		m[key] = value
+		if existing, ok := meta[name]; ok {
+			meta[name] = existing.Touched(actor)
+		} else {
+			meta[name] = common.NewEntryMeta(actor)
+		}
+	}
+	return state.UpdateKeysAndSaveContext(ctx, map[string]interface{}{
+		res.section:                        m,
+		common.SectionMetaKey(res.section): meta,
+	})
+}
+
+// loadHistory => read state.Data["_history"] => section => key => versions
+func loadHistory(state *common.State) (map[string]map[string][]Version, error) {
+	all := make(map[string]map[string][]Version)
+	raw := state.GetValue(stateKey)
+	if raw == nil {
+		return all, nil
+	}
+	if err := roundTrip(raw, &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+func roundTrip(in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,271 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/audit"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/diff"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"go.uber.org/zap"
+)
+
+// revisionsKey indexes the stored whole-state snapshots. The snapshots
+// themselves live in storage next to the state (see common.SaveRevision).
+const revisionsKey = "_revisions"
+
+// current names the live state in place of a revision number.
+const current = "current"
+
+// Revision describes one stored snapshot of the policy sections.
+type Revision struct {
+	Rev      int       `json:"rev"`
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor,omitempty"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Checksum string    `json:"checksum"`
+}
+
+// StateDiff is the response of GET /state/diff.
+type StateDiff struct {
+	From     string                      `json:"from"`
+	To       string                      `json:"to"`
+	Sections map[string]diff.SectionDiff `json:"sections"`
+	Unified  string                      `json:"unified"`
+}
+
+// Snapshotter stores a snapshot of the policy sections after every
+// successful mutation that changed them. It is an audit.Sink.
+type Snapshotter struct {
+	state *common.State
+	depth int
+}
+
+// NewSnapshotter keeps up to depth snapshots (0 keeps all).
+func NewSnapshotter(state *common.State, depth int) *Snapshotter {
+	return &Snapshotter{state: state, depth: depth}
+}
+
+// Write snapshots the state if it differs from the latest snapshot.
+func (s *Snapshotter) Write(e audit.Event) error {
+	if e.Outcome != audit.OutcomeSuccess {
+		return nil
+	}
+
+	unlock := s.state.LockKey(revisionsKey)
+	defer unlock()
+
+	var b bytes.Buffer
+	if err := common.WriteJSONObject(&b, policySections(s.state), true); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b.Bytes())
+	checksum := hex.EncodeToString(sum[:])
+
+	revs, err := loadRevisions(s.state)
+	if err != nil {
+		return err
+	}
+	rev := 1
+	if n := len(revs); n > 0 {
+		if revs[n-1].Checksum == checksum {
+			return nil // e.g. a change to internal keys only
+		}
+		rev = revs[n-1].Rev + 1
+	}
+
+	ctx := context.TODO()
+	if err := s.state.SaveRevision(ctx, rev, b.Bytes()); err != nil {
+		return err
+	}
+	revs = append(revs, Revision{Rev: rev, Time: e.Time, Actor: e.Actor, Method: e.Method, Path: e.Path, Checksum: checksum})
+	if s.depth > 0 && len(revs) > s.depth {
+		for _, old := range revs[:len(revs)-s.depth] {
+			if err := s.state.RemoveRevision(ctx, old.Rev); err != nil {
+				return err
+			}
+		}
+		revs = revs[len(revs)-s.depth:]
+	}
+	return s.state.UpdateKeyAndSave(revisionsKey, revs)
+}
+
+// RollbackResponse is the body of a successful POST /rollback/:rev.
+type RollbackResponse struct {
+	Rev int `json:"rev"`
+	// Sections is what the rollback changed.
+	Sections map[string]diff.SectionDiff `json:"sections"`
+}
+
+// RegisterStateRoutes wires up the whole-state snapshot endpoints.
+//
+//	GET  /state/revisions           => stored snapshots, oldest first
+//	GET  /history                   => the same
+//	GET  /state/diff?from=3&to=7    => what changed between two snapshots
+//	POST /rollback/:rev             => restore the policy sections of a snapshot
+//
+// Either revision of a diff may be "current" for the live state; to
+// defaults to it. With format=text the unified diff is returned as plain
+// text.
+func RegisterStateRoutes(r *gin.Engine, state *common.State) {
+	listRevisions := func(c *gin.Context) {
+		revs, err := loadRevisions(state)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse revisions"})
+			return
+		}
+		c.JSON(http.StatusOK, revs)
+	}
+	r.GET("/state/revisions", listRevisions)
+	r.GET("/history", listRevisions)
+	r.GET("/state/diff", func(c *gin.Context) {
+		diffRevisions(c, state)
+	})
+	r.POST("/rollback/:rev", func(c *gin.Context) {
+		rollback(c, state)
+	})
+	common.RegisterPolicyRoute(http.MethodPost, "/rollback/:rev")
+}
+
+// rollback => POST /rollback/:rev
+//
+// Sections the snapshot doesn't have are emptied, and sections of disabled
+// modules are left alone. The rollback is a change like any other: it must
+// pass the save check, and it's snapshotted itself, so it can be undone.
+func rollback(c *gin.Context, state *common.State) {
+	version := c.Param("rev")
+	if version == current {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid revision " + strconv.Quote(version)})
+		return
+	}
+	target, ok := loadVersion(c, state, version)
+	if !ok {
+		return
+	}
+	before := policySections(state)
+	updates := make(map[string]interface{})
+	for k, v := range target {
+		if !state.SectionDisabled(k) {
+			updates[k] = v
+		}
+	}
+	for k := range before {
+		if _, ok := target[k]; !ok && !state.SectionDisabled(k) {
+			updates[k] = emptySection(k)
+		}
+	}
+
+	if err := state.UpdateKeysAndSaveContext(c.Request.Context(), updates); err != nil {
+		if state.Logger != nil {
+			state.Logger.Error("Failed to roll back state", zap.String("rev", version), zap.Error(err))
+		}
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to roll back to revision " + version})
+		return
+	}
+	rev, _ := strconv.Atoi(version)
+	c.JSON(http.StatusOK, RollbackResponse{Rev: rev, Sections: diff.State(before, policySections(state))})
+}
+
+// emptySection is what a rollback leaves in a section the snapshot doesn't
+// have: no entries, rather than a JSON null. Other sections are nil, which
+// the sync leaves out of the policy.
+func emptySection(section string) interface{} {
+	switch policyfile.Sections[section].Kind {
+	case policyfile.KindList:
+		return []interface{}{}
+	case policyfile.KindMap:
+		return map[string]interface{}{}
+	}
+	return nil
+}
+
+// diffRevisions => GET /state/diff?from=&to=
+func diffRevisions(c *gin.Context, state *common.State) {
+	from, to := c.Query("from"), c.DefaultQuery("to", current)
+	if from == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from is required"})
+		return
+	}
+	before, ok := loadVersion(c, state, from)
+	if !ok {
+		return
+	}
+	after, ok := loadVersion(c, state, to)
+	if !ok {
+		return
+	}
+
+	fromLabel, toLabel := "rev"+from, "rev"+to
+	if from == current {
+		fromLabel = current
+	}
+	if to == current {
+		toLabel = current
+	}
+	unified := diff.Unified(fromLabel, toLabel, before, after)
+	if c.Query("format") == "text" {
+		c.String(http.StatusOK, unified)
+		return
+	}
+	c.JSON(http.StatusOK, StateDiff{
+		From:     from,
+		To:       to,
+		Sections: diff.State(before, after),
+		Unified:  unified,
+	})
+}
+
+// loadVersion returns the policy sections of a stored revision, or of the
+// live state for "current". On failure it writes the error response.
+func loadVersion(c *gin.Context, state *common.State, version string) (map[string]interface{}, bool) {
+	if version == current {
+		return policySections(state), true
+	}
+	rev, err := strconv.Atoi(version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid revision " + strconv.Quote(version)})
+		return nil, false
+	}
+	data, err := state.LoadRevision(c.Request.Context(), rev)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Revision " + version + " not found"})
+		return nil, false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read revision " + version})
+		return nil, false
+	}
+	return data, true
+}
+
+// policySections is the state without internal keys.
+func policySections(state *common.State) map[string]interface{} {
+	snap := state.Snapshot()
+	for k := range snap {
+		if strings.HasPrefix(k, "_") {
+			delete(snap, k)
+		}
+	}
+	return snap
+}
+
+func loadRevisions(state *common.State) ([]Revision, error) {
+	var revs []Revision
+	if raw := state.GetValue(revisionsKey); raw != nil {
+		if err := roundTrip(raw, &revs); err != nil {
+			return nil, err
+		}
+	}
+	return revs, nil
+}
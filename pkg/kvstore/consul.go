@@ -0,0 +1,165 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// consulTxnLimit is the most operations Consul accepts in one transaction.
+// Larger commits are split, and are then only atomic chunk by chunk.
+const consulTxnLimit = 64
+
+// consul talks to Consul's KV and transaction HTTP API.
+type consul struct {
+	base   string
+	client *http.Client
+	token  string
+}
+
+func (c *consul) do(ctx context.Context, method, path, query string, in interface{}) (*http.Response, []byte, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	u := (&url.URL{Path: path, RawQuery: query}).String()
+	req, err := http.NewRequestWithContext(ctx, method, c.base+u, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp, data, err
+}
+
+func consulError(path string, resp *http.Response, body []byte) error {
+	if msg := bytes.TrimSpace(body); len(msg) > 0 {
+		return fmt.Errorf("consul %s: %s: %s", path, resp.Status, msg)
+	}
+	return fmt.Errorf("consul %s: %s", path, resp.Status)
+}
+
+func (c *consul) get(ctx context.Context, name string) ([]byte, int64, error) {
+	resp, body, err := c.do(ctx, http.MethodGet, "/v1/kv/"+name, "", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, 0, notExist(name)
+	default:
+		return nil, 0, consulError("/v1/kv/"+name, resp, body)
+	}
+	var kvs []struct {
+		Value       []byte
+		ModifyIndex int64
+	}
+	if err := json.Unmarshal(body, &kvs); err != nil {
+		return nil, 0, err
+	}
+	if len(kvs) == 0 {
+		return nil, 0, notExist(name)
+	}
+	data := kvs[0].Value
+	if data == nil {
+		data = []byte{}
+	}
+	return data, kvs[0].ModifyIndex, nil
+}
+
+func (c *consul) list(ctx context.Context, prefix string) ([]string, error) {
+	resp, body, err := c.do(ctx, http.MethodGet, "/v1/kv/"+prefix, "keys", nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, consulError("/v1/kv/"+prefix, resp, body)
+	}
+	var names []string
+	err = json.Unmarshal(body, &names)
+	return names, err
+}
+
+func (c *consul) commit(ctx context.Context, ops []op) (map[string]int64, error) {
+	revs := make(map[string]int64, len(ops))
+	for start := 0; start < len(ops); start += consulTxnLimit {
+		end := min(start+consulTxnLimit, len(ops))
+		if err := c.commitChunk(ctx, ops[start:end], revs); err != nil {
+			return nil, err
+		}
+	}
+	return revs, nil
+}
+
+func (c *consul) commitChunk(ctx context.Context, ops []op, revs map[string]int64) error {
+	type kvOp struct {
+		Verb  string
+		Key   string
+		Value []byte `json:",omitempty"`
+		Index int64  `json:",omitempty"`
+	}
+	txn := make([]map[string]kvOp, 0, len(ops))
+	for _, o := range ops {
+		k := kvOp{Key: o.Name, Index: o.Expect}
+		switch {
+		case !o.Delete:
+			// cas with index 0 only creates
+			k.Verb = "cas"
+			k.Value = o.Data
+			if k.Value == nil {
+				k.Value = []byte{}
+			}
+		case o.Expect == 0:
+			k.Verb = "check-not-exists"
+		default:
+			k.Verb = "delete-cas"
+		}
+		txn = append(txn, map[string]kvOp{"KV": k})
+	}
+	resp, body, err := c.do(ctx, http.MethodPut, "/v1/txn", "", txn)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return conflict("consul")
+	default:
+		return consulError("/v1/txn", resp, body)
+	}
+	var out struct {
+		Results []struct {
+			KV struct {
+				Key         string
+				ModifyIndex int64
+			}
+		}
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return err
+	}
+	for _, r := range out.Results {
+		revs[r.KV.Key] = r.KV.ModifyIndex
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	gosync "sync"
+)
+
+// etcd talks to etcd's v3 JSON gateway, where keys and values are base64
+// and 64-bit integers are strings.
+type etcd struct {
+	base   string
+	client *http.Client
+
+	user, password string
+	mu             gosync.Mutex
+	token          string
+}
+
+type etcdKV struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	ModRevision int64  `json:"mod_revision,string"`
+}
+
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// call POSTs in to path and decodes the response into out. An expired
+// auth token is renewed once.
+func (e *etcd) call(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := e.post(ctx, path, body)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && e.user != "" {
+		resp.Body.Close()
+		if err := e.authenticate(ctx); err != nil {
+			return err
+		}
+		resp, err = e.post(ctx, path, body)
+	}
+	if err != nil {
+		return err
+	}
+	return decode(path, resp, out)
+}
+
+// decode reads a gateway response into out, or its error.
+func decode(path string, resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var gwErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &gwErr) == nil && gwErr.Message != "" {
+			return fmt.Errorf("etcd %s: %s", path, gwErr.Message)
+		}
+		return fmt.Errorf("etcd %s: %s", path, resp.Status)
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (e *etcd) post(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.base+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	e.mu.Lock()
+	if e.token != "" {
+		req.Header.Set("Authorization", e.token)
+	}
+	e.mu.Unlock()
+	return e.client.Do(req)
+}
+
+// authenticate gets a token for e.user.
+func (e *etcd) authenticate(ctx context.Context) error {
+	e.mu.Lock()
+	e.token = ""
+	e.mu.Unlock()
+	body, err := json.Marshal(map[string]string{"name": e.user, "password": e.password})
+	if err != nil {
+		return err
+	}
+	var out struct {
+		Token string `json:"token"`
+	}
+	resp, err := e.post(ctx, "/v3/auth/authenticate", body)
+	if err != nil {
+		return err
+	}
+	if err := decode("/v3/auth/authenticate", resp, &out); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.token = out.Token
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *etcd) get(ctx context.Context, name string) ([]byte, int64, error) {
+	var out struct {
+		Kvs []etcdKV `json:"kvs"`
+	}
+	if err := e.call(ctx, "/v3/kv/range", map[string]string{"key": b64(name)}, &out); err != nil {
+		return nil, 0, err
+	}
+	if len(out.Kvs) == 0 {
+		return nil, 0, notExist(name)
+	}
+	data, err := base64.StdEncoding.DecodeString(out.Kvs[0].Value)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return data, out.Kvs[0].ModRevision, nil
+}
+
+func (e *etcd) list(ctx context.Context, prefix string) ([]string, error) {
+	in := map[string]interface{}{"key": b64(prefix), "range_end": b64(prefixEnd(prefix)), "keys_only": true}
+	if prefix == "" {
+		in["key"] = b64("\x00")
+	}
+	var out struct {
+		Kvs []etcdKV `json:"kvs"`
+	}
+	if err := e.call(ctx, "/v3/kv/range", in, &out); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(out.Kvs))
+	for _, kv := range out.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, string(key))
+	}
+	return names, nil
+}
+
+// prefixEnd is the range_end covering every key starting with prefix: the
+// prefix with its last byte incremented, or "\x00" (the end of the
+// keyspace) for an empty prefix or one of only 0xff bytes.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "\x00"
+}
+
+func (e *etcd) commit(ctx context.Context, ops []op) (map[string]int64, error) {
+	type compare struct {
+		Key         string `json:"key"`
+		Target      string `json:"target"`
+		Result      string `json:"result"`
+		ModRevision int64  `json:"mod_revision,string"`
+	}
+	var in struct {
+		Compare []compare                `json:"compare"`
+		Success []map[string]interface{} `json:"success"`
+	}
+	for _, o := range ops {
+		in.Compare = append(in.Compare, compare{Key: b64(o.Name), Target: "MOD", Result: "EQUAL", ModRevision: o.Expect})
+		if o.Delete {
+			in.Success = append(in.Success, map[string]interface{}{"request_delete_range": map[string]string{"key": b64(o.Name)}})
+		} else {
+			in.Success = append(in.Success, map[string]interface{}{"request_put": map[string]string{
+				"key":   b64(o.Name),
+				"value": base64.StdEncoding.EncodeToString(o.Data),
+			}})
+		}
+	}
+	var out struct {
+		Header    etcdHeader `json:"header"`
+		Succeeded bool       `json:"succeeded"`
+	}
+	if err := e.call(ctx, "/v3/kv/txn", in, &out); err != nil {
+		return nil, err
+	}
+	if !out.Succeeded {
+		return nil, conflict("etcd")
+	}
+	// Every put of a txn gets the txn's revision
+	revs := make(map[string]int64, len(ops))
+	for _, o := range ops {
+		if !o.Delete {
+			revs[o.Name] = out.Header.Revision
+		}
+	}
+	return revs, nil
+}
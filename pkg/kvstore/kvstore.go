@@ -0,0 +1,328 @@
+// Package kvstore keeps the state in etcd or Consul, for etcd:// and
+// consul:// storage URLs, so several servers can share it. Each store
+// remembers the revisions of the objects the state was loaded from, and
+// each write to the state is one compare-and-swap transaction over the
+// objects it touches: if another server changed any of them meanwhile,
+// nothing is written and the write fails with common.ErrConflict.
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// DefaultPath is the key prefix of a URL without a path: per-key storage,
+// one key per top-level state key.
+const DefaultPath = "tacl/"
+
+// requestTimeout bounds each call to the etcd or Consul API.
+const requestTimeout = 10 * time.Second
+
+// op is one change of a transaction. Expect is the revision the object
+// must still have, 0 for one that must not exist.
+type op struct {
+	Name   string
+	Data   []byte
+	Delete bool
+	Expect int64
+}
+
+// backend is what a Store needs of etcd or Consul.
+type backend interface {
+	// get returns an object and its revision, or an error wrapping
+	// fs.ErrNotExist.
+	get(ctx context.Context, name string) ([]byte, int64, error)
+	// list returns the names starting with prefix.
+	list(ctx context.Context, prefix string) ([]string, error)
+	// commit applies ops if every object still has its expected revision,
+	// returning the new revision of each object put, and otherwise fails
+	// with common.ErrConflict.
+	commit(ctx context.Context, ops []op) (map[string]int64, error)
+}
+
+// Store is a common.TxObjectStore in etcd or Consul.
+//
+// Loading the state (see common.Loading) records the revision of each
+// object read, and of each listed prefix which objects were there. A
+// transaction's writes expect those: an object loaded still has the
+// revision it was loaded at, and one that wasn't there when its prefix was
+// listed still doesn't exist. So a server can't overwrite a change it
+// hasn't loaded. Other objects, such as backups it never read, are
+// expected to be as they were when the transaction first touched them.
+type Store struct {
+	b backend
+
+	mu     gosync.Mutex
+	revs   map[string]int64           // revision of each object loaded, 0 if absent
+	listed map[string]map[string]bool // the objects under each prefix listed while loading
+}
+
+var _ common.TxObjectStore = (*Store)(nil)
+
+// IsURL reports whether storage is an etcd:// or consul:// URL.
+func IsURL(storage string) bool {
+	scheme, _, _ := strings.Cut(storage, "://")
+	switch scheme {
+	case "etcd", "etcd+https", "consul", "consul+https":
+		return true
+	}
+	return false
+}
+
+// OpenURL connects to the etcd or Consul of a storage URL like
+// etcd://host:2379/tacl/ or consul+https://host:8501/tacl/. The URL's path
+// is the key prefix: ending in "/" (the default) stores each top-level key
+// on its own, otherwise the whole state is one key of that name. etcd
+// credentials go in the URL's userinfo; Consul's ACL token is read from
+// CONSUL_HTTP_TOKEN. It returns the store to set as State.Objects and the
+// State.Storage to go with it, "<scheme>://<path>".
+func OpenURL(ctx context.Context, raw string) (*Store, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid storage URL: %w", err)
+	}
+	kind, secure := strings.CutSuffix(u.Scheme, "+https")
+	if u.Host == "" {
+		return nil, "", fmt.Errorf("storage URL %q has no host", u.Redacted())
+	}
+	base := "http://" + u.Host
+	if secure {
+		base = "https://" + u.Host
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	if path == "" {
+		path = DefaultPath
+	}
+	client := &http.Client{Timeout: requestTimeout}
+
+	var b backend
+	switch kind {
+	case "etcd":
+		e := &etcd{base: base, client: client}
+		if u.User != nil {
+			e.user = u.User.Username()
+			e.password, _ = u.User.Password()
+			if err := e.authenticate(ctx); err != nil {
+				return nil, "", fmt.Errorf("authenticating to etcd: %w", err)
+			}
+		}
+		b = e
+	case "consul":
+		b = &consul{base: base, client: client, token: os.Getenv("CONSUL_HTTP_TOKEN")}
+	default:
+		return nil, "", fmt.Errorf("storage URL must begin with etcd:// or consul://, got %q", u.Redacted())
+	}
+	s := &Store{b: b, revs: make(map[string]int64), listed: make(map[string]map[string]bool)}
+	// Fail now rather than on the first load if the store is unreachable
+	if _, err := b.list(ctx, path); err != nil {
+		return nil, "", fmt.Errorf("connecting to %s: %w", kind, err)
+	}
+	return s, kind + "://" + path, nil
+}
+
+func (s *Store) Get(ctx context.Context, name string) ([]byte, error) {
+	data, rev, err := s.b.get(ctx, name)
+	if common.Loading(ctx) && (err == nil || errors.Is(err, fs.ErrNotExist)) {
+		s.mu.Lock()
+		s.revs[name] = rev
+		s.mu.Unlock()
+	}
+	return data, err
+}
+
+func (s *Store) List(ctx context.Context, prefix string) ([]string, error) {
+	names, err := s.b.list(ctx, prefix)
+	if err != nil || !common.Loading(ctx) {
+		return names, err
+	}
+	listed := make(map[string]bool, len(names))
+	for _, name := range names {
+		listed[name] = true
+	}
+	s.mu.Lock()
+	s.listed[prefix] = listed
+	for name := range s.revs {
+		if strings.HasPrefix(name, prefix) && !listed[name] {
+			s.revs[name] = 0 // deleted by another server
+		}
+	}
+	s.mu.Unlock()
+	return names, nil
+}
+
+func (s *Store) Put(ctx context.Context, name string, data []byte) error {
+	return s.Tx(ctx, func(tx common.ObjectStore) error { return tx.Put(ctx, name, data) })
+}
+
+func (s *Store) Rename(ctx context.Context, from, to string) error {
+	return s.Tx(ctx, func(tx common.ObjectStore) error { return tx.Rename(ctx, from, to) })
+}
+
+func (s *Store) Remove(ctx context.Context, name string) error {
+	return s.Tx(ctx, func(tx common.ObjectStore) error { return tx.Remove(ctx, name) })
+}
+
+// Tx buffers fn's changes and commits them in one compare-and-swap
+// transaction.
+func (s *Store) Tx(ctx context.Context, fn func(common.ObjectStore) error) error {
+	tx := &txView{s: s, pending: make(map[string]*[]byte), read: make(map[string]int64)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.pending) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(tx.pending))
+	for name := range tx.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ops := make([]op, 0, len(names))
+	tracked := make(map[string]bool, len(names))
+	for _, name := range names {
+		expect, track, err := tx.expect(ctx, name)
+		if err != nil {
+			return err
+		}
+		tracked[name] = track
+		o := op{Name: name, Expect: expect}
+		if data := tx.pending[name]; data == nil {
+			o.Delete = true
+		} else {
+			o.Data = *data
+		}
+		ops = append(ops, o)
+	}
+
+	revs, err := s.b.commit(ctx, ops)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range ops {
+		switch {
+		case !tracked[o.Name]:
+		case errors.Is(err, common.ErrConflict):
+			// Stale; the reload that follows records them again
+			delete(s.revs, o.Name)
+		case err == nil:
+			s.revs[o.Name] = revs[o.Name] // 0 for a delete
+		}
+	}
+	return err
+}
+
+// txView is the common.ObjectStore a transaction's fn sees: the store with
+// its buffered changes on top.
+type txView struct {
+	s       *Store
+	pending map[string]*[]byte // nil for a removed object
+	read    map[string]int64   // revisions of objects first read in this transaction
+}
+
+// expect is the revision an object must still have for the transaction to
+// commit, and whether loading recorded it.
+func (t *txView) expect(ctx context.Context, name string) (int64, bool, error) {
+	t.s.mu.Lock()
+	rev, ok := t.s.revs[name]
+	if !ok {
+		for prefix, listed := range t.s.listed {
+			if strings.HasPrefix(name, prefix) && !listed[name] {
+				rev, ok = 0, true
+				break
+			}
+		}
+	}
+	t.s.mu.Unlock()
+	if ok {
+		return rev, true, nil
+	}
+	if rev, ok := t.read[name]; ok {
+		return rev, false, nil
+	}
+	_, rev, err := t.s.b.get(ctx, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, false, err
+	}
+	return rev, false, nil
+}
+
+func (t *txView) Get(ctx context.Context, name string) ([]byte, error) {
+	if data, ok := t.pending[name]; ok {
+		if data == nil {
+			return nil, notExist(name)
+		}
+		return append([]byte(nil), *data...), nil
+	}
+	data, rev, err := t.s.b.get(ctx, name)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		if _, ok := t.read[name]; !ok {
+			t.read[name] = rev
+		}
+	}
+	return data, err
+}
+
+func (t *txView) Put(_ context.Context, name string, data []byte) error {
+	data = append([]byte{}, data...)
+	t.pending[name] = &data
+	return nil
+}
+
+func (t *txView) Rename(ctx context.Context, from, to string) error {
+	data, err := t.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	t.pending[to] = &data
+	t.pending[from] = nil
+	return nil
+}
+
+func (t *txView) Remove(_ context.Context, name string) error {
+	t.pending[name] = nil
+	return nil
+}
+
+func (t *txView) List(ctx context.Context, prefix string) ([]string, error) {
+	stored, err := t.s.b.list(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(stored))
+	for _, name := range stored {
+		names[name] = true
+	}
+	for name, data := range t.pending {
+		if strings.HasPrefix(name, prefix) {
+			names[name] = data != nil
+		}
+	}
+	out := make([]string, 0, len(names))
+	for name, ok := range names {
+		if ok {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func notExist(name string) error {
+	return fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+}
+
+// conflict is the error of a compare-and-swap that failed.
+func conflict(kind string) error {
+	return fmt.Errorf("%w (%s compare-and-swap failed)", common.ErrConflict, kind)
+}
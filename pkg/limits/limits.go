@@ -0,0 +1,125 @@
+// Package limits bounds the size of request bodies and of the JSON in them,
+// so one malformed or malicious request can't balloon the state past what
+// Tailscale accepts and break sync for everyone.
+package limits
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Limits are the bounds applied to request bodies. A zero field disables
+// its check.
+type Limits struct {
+	// MaxBodyBytes bounds the raw body.
+	MaxBodyBytes int64
+	// MaxItems bounds every JSON array and object in it, e.g. a group's
+	// members or a posture's rules.
+	MaxItems int
+	// MaxString bounds every JSON string, including object keys, in bytes.
+	MaxString int
+}
+
+// Middleware rejects bodies over l.MaxBodyBytes with 413, and JSON bodies
+// with an oversized array, object or string with 400. Bodies that aren't
+// JSON are left to the handler to reject.
+func Middleware(l Limits, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		body := c.Request.Body
+		if l.MaxBodyBytes > 0 {
+			body = http.MaxBytesReader(c.Writer, body, l.MaxBodyBytes)
+		}
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				logger.Warn("Rejected oversized request body",
+					zap.String("method", c.Request.Method), zap.String("path", c.Request.URL.Path))
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+					Error: fmt.Sprintf("request body is larger than %d bytes", l.MaxBodyBytes),
+				})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+
+		if l.MaxItems > 0 || l.MaxString > 0 {
+			var doc interface{}
+			if json.Unmarshal(raw, &doc) == nil {
+				if err := l.Check(doc); err != nil {
+					c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+					return
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// Check walks a decoded JSON value and returns an error naming an
+// array, object or string over the limits.
+func (l Limits) Check(v interface{}) error {
+	return l.check("", v)
+}
+
+func (l Limits) check(path string, v interface{}) error {
+	switch t := v.(type) {
+	case string:
+		if l.MaxString > 0 && len(t) > l.MaxString {
+			return fmt.Errorf("%s is longer than %d bytes", describe(path, "string"), l.MaxString)
+		}
+	case []interface{}:
+		if l.MaxItems > 0 && len(t) > l.MaxItems {
+			return fmt.Errorf("%s has %d items, more than the limit of %d", describe(path, "list"), len(t), l.MaxItems)
+		}
+		for i, item := range t {
+			if err := l.check(path+"["+strconv.Itoa(i)+"]", item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if l.MaxItems > 0 && len(t) > l.MaxItems {
+			return fmt.Errorf("%s has %d keys, more than the limit of %d", describe(path, "object"), len(t), l.MaxItems)
+		}
+		for k, item := range t {
+			if l.MaxString > 0 && len(k) > l.MaxString {
+				return fmt.Errorf("a key in %s is longer than %d bytes", describe(path, "the body"), l.MaxString)
+			}
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			if err := l.check(p, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// describe names a value by its path, or by what it is at the top level.
+func describe(path, what string) string {
+	if path == "" {
+		return what
+	}
+	return path
+}
@@ -0,0 +1,319 @@
+// Package lint compares the policy with the devices in the tailnet, to
+// find entries that no longer match anything: host aliases for addresses
+// no device or subnet route has, and rules naming tags no device carries.
+// GET /lint reports them and metrics count them, so dead entries can be
+// cleaned up with confidence.
+package lint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/tailnet"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Kinds of Finding.
+const (
+	// KindDeadHost: a host alias whose address no device has and no subnet
+	// route covers.
+	KindDeadHost = "dead-host"
+	// KindUnmatchedTag: a rule names a tag no device carries.
+	KindUnmatchedTag = "unmatched-tag"
+	// KindDeadRule: every source, or every destination, of a rule is a tag
+	// no device carries, so the rule matches no traffic.
+	KindDeadRule = "dead-rule"
+)
+
+// Kinds lists every kind of Finding.
+var Kinds = []string{KindDeadHost, KindUnmatchedTag, KindDeadRule}
+
+// Finding is one entry that matches no device.
+type Finding struct {
+	Kind    string `json:"kind"`
+	Section string `json:"section"`
+	// ID identifies rules, Name host aliases.
+	ID      string   `json:"id,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Message string   `json:"message"`
+}
+
+// Report is the result of one check.
+type Report struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Devices   int       `json:"devices"`
+	Findings  []Finding `json:"findings"`
+}
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ruleSections are the rule sections checked for tags.
+var ruleSections = []string{"acls", "ssh"}
+
+// Check compares state data with the tailnet's devices.
+func Check(data map[string]interface{}, devices []tailnet.Device) []Finding {
+	tags := make(map[string]bool)
+	var addrs []netip.Addr
+	var routes []netip.Prefix
+	for _, d := range devices {
+		for _, t := range d.Tags {
+			tags[t] = true
+		}
+		for _, a := range d.Addresses {
+			if addr, err := netip.ParseAddr(a); err == nil {
+				addrs = append(addrs, addr)
+			}
+		}
+		for _, r := range d.EnabledRoutes {
+			if p, err := netip.ParsePrefix(r); err == nil {
+				routes = append(routes, p)
+			}
+		}
+	}
+
+	findings := []Finding{}
+	hosts := map[string]string{}
+	_ = roundTrip(data["hosts"], &hosts)
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, ok := parsePrefix(hosts[name])
+		if !ok || covered(p, addrs, routes) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Kind:    KindDeadHost,
+			Section: "hosts",
+			Name:    name,
+			Message: fmt.Sprintf("no device has an address in %s and no subnet route covers it", hosts[name]),
+		})
+	}
+
+	for _, section := range ruleSections {
+		var rules []struct {
+			ID  string   `json:"id"`
+			Src []string `json:"src"`
+			Dst []string `json:"dst"`
+		}
+		_ = roundTrip(data[section], &rules)
+		for _, r := range rules {
+			srcs, srcDead := unmatched(r.Src, tags, false)
+			dsts, dstDead := unmatched(r.Dst, tags, section == "acls")
+			missing := append(srcs, dsts...)
+			if len(missing) == 0 {
+				continue
+			}
+			missing = dedupe(missing)
+			f := Finding{Kind: KindUnmatchedTag, Section: section, ID: r.ID, Tags: missing,
+				Message: fmt.Sprintf("no device is tagged %s", strings.Join(missing, ", "))}
+			if srcDead || dstDead {
+				f.Kind = KindDeadRule
+				f.Message += ", so the rule matches no traffic"
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// unmatched returns the tags among principals no device carries, and
+// whether that is all of them. ACL destinations carry a port.
+func unmatched(principals []string, tags map[string]bool, withPort bool) ([]string, bool) {
+	var out []string
+	for _, p := range principals {
+		if withPort {
+			if i := strings.LastIndex(p, ":"); i > 0 {
+				p = p[:i]
+			}
+		}
+		if strings.HasPrefix(p, "tag:") && !tags[p] {
+			out = append(out, p)
+		}
+	}
+	return out, len(principals) > 0 && len(out) == len(principals)
+}
+
+// parsePrefix reads a host alias value: an address or a CIDR.
+func parsePrefix(s string) (netip.Prefix, bool) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked(), true
+	}
+	if a, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(a, a.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+func covered(p netip.Prefix, addrs []netip.Addr, routes []netip.Prefix) bool {
+	for _, a := range addrs {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	for _, r := range routes {
+		if r.Overlaps(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupe(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	out := in[:0]
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func roundTrip(in, out interface{}) error {
+	if in == nil {
+		return nil
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// errNoAPI is returned without Tailscale API credentials.
+var errNoAPI = errors.New("no Tailscale API credentials or tailnet configured")
+
+// Linter checks the policy against the live device list, keeping the last
+// report for metrics. httpClient is authenticated for the Tailscale API.
+type Linter struct {
+	state       *common.State
+	httpClient  *http.Client
+	tailnetName string
+	logger      *zap.Logger
+
+	mu   gosync.Mutex
+	last *Report
+}
+
+// New returns a linter for state and the named tailnet.
+func New(state *common.State, httpClient *http.Client, tailnetName string, logger *zap.Logger) *Linter {
+	return &Linter{state: state, httpClient: httpClient, tailnetName: tailnetName, logger: logger}
+}
+
+// Run fetches the devices and checks the policy against them once.
+func (l *Linter) Run(ctx context.Context) (Report, error) {
+	if l.httpClient == nil || l.tailnetName == "" {
+		return Report{}, errNoAPI
+	}
+	devices, err := tailnet.FetchDevices(ctx, l.httpClient, l.tailnetName)
+	if err != nil {
+		return Report{}, err
+	}
+	rep := Report{CheckedAt: time.Now().UTC(), Devices: len(devices), Findings: Check(l.state.Snapshot(), devices)}
+	l.mu.Lock()
+	l.last = &rep
+	l.mu.Unlock()
+	return rep, nil
+}
+
+// Start runs the check every interval until ctx is done, logging the
+// findings. Standbys skip it.
+func (l *Linter) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if !l.state.IsStandby() {
+				l.runLogged(ctx)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (l *Linter) runLogged(ctx context.Context) {
+	rep, err := l.Run(ctx)
+	if err != nil {
+		l.logger.Warn("Failed to check the policy against the device list", zap.Error(err))
+		return
+	}
+	if len(rep.Findings) > 0 {
+		l.logger.Info("Found policy entries that match no device", zap.Int("count", len(rep.Findings)), zap.Int("devices", rep.Devices))
+	}
+}
+
+// RegisterRoutes wires up GET /lint, which runs the check and returns the
+// Report: 503 without Tailscale API credentials, 502 if the device list
+// can't be fetched.
+func RegisterRoutes(r *gin.Engine, l *Linter) {
+	r.GET("/lint", func(c *gin.Context) {
+		rep, err := l.Run(c.Request.Context())
+		switch {
+		case errors.Is(err, errNoAPI):
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "No Tailscale API credentials or tailnet configured"})
+		case err != nil:
+			c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Failed to fetch the device list: " + err.Error()})
+		default:
+			c.JSON(http.StatusOK, rep)
+		}
+	})
+}
+
+var (
+	findingsDesc = prometheus.NewDesc("tacl_lint_findings",
+		"Policy entries that matched no device at the last check, by kind.", []string{"kind"}, nil)
+	devicesDesc = prometheus.NewDesc("tacl_lint_devices",
+		"Devices in the tailnet at the last check.", nil, nil)
+	checkedDesc = prometheus.NewDesc("tacl_lint_last_check_timestamp_seconds",
+		"Time of the last check against the device list.", nil, nil)
+)
+
+// Describe implements prometheus.Collector.
+func (l *Linter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- findingsDesc
+	ch <- devicesDesc
+	ch <- checkedDesc
+}
+
+// Collect implements prometheus.Collector, reporting the last check. It
+// reports nothing until a check has run.
+func (l *Linter) Collect(ch chan<- prometheus.Metric) {
+	l.mu.Lock()
+	rep := l.last
+	l.mu.Unlock()
+	if rep == nil {
+		return
+	}
+	counts := make(map[string]int, len(Kinds))
+	for _, f := range rep.Findings {
+		counts[f.Kind]++
+	}
+	for _, k := range Kinds {
+		ch <- prometheus.MustNewConstMetric(findingsDesc, prometheus.GaugeValue, float64(counts[k]), k)
+	}
+	ch <- prometheus.MustNewConstMetric(devicesDesc, prometheus.GaugeValue, float64(rep.Devices))
+	ch <- prometheus.MustNewConstMetric(checkedDesc, prometheus.GaugeValue, float64(rep.CheckedAt.Unix()))
+}
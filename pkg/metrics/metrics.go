@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	gosync "sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+var (
+	policyBytesDesc = prometheus.NewDesc("tacl_policy_bytes",
+		"Size of the policy pushed to Tailscale, in bytes.", nil, nil)
+	policySectionBytesDesc = prometheus.NewDesc("tacl_policy_section_bytes",
+		"Size of each top-level policy section, in bytes.", []string{"section"}, nil)
+	policyLimitBytesDesc = prometheus.NewDesc("tacl_policy_limit_bytes",
+		"Configured Tailscale policy size limit, in bytes.", nil, nil)
+	policyLimitRatioDesc = prometheus.NewDesc("tacl_policy_limit_ratio",
+		"Fraction of the Tailscale policy size limit consumed.", nil, nil)
+)
+
+// StorageDegraded is a gauge that's 1 while state is in degraded mode (see
+// pkg/degraded) and 0 otherwise.
+func StorageDegraded(state *common.State) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "tacl_storage_degraded",
+		Help: "Whether storage is unavailable and changes are being rejected (1) or not (0).",
+	}, func() float64 {
+		if state.IsDegraded() {
+			return 1
+		}
+		return 0
+	})
+}
+
+// Handler serves all registered metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// PolicyMonitor measures the policy size and warns when it crosses a
+// threshold fraction of the limit. It is a prometheus.Collector, measuring
+// on every scrape.
+type PolicyMonitor struct {
+	state  *common.State
+	limit  int
+	warnAt float64
+	logger *zap.Logger
+
+	mu    gosync.Mutex
+	above bool
+}
+
+// NewPolicyMonitor creates a monitor for a limit in bytes, warning once
+// usage reaches warnAt (e.g. 0.8 for 80%).
+func NewPolicyMonitor(state *common.State, limit int, warnAt float64, logger *zap.Logger) *PolicyMonitor {
+	return &PolicyMonitor{state: state, limit: limit, warnAt: warnAt, logger: logger}
+}
+
+// Check measures the policy, logging a warning when usage first crosses the
+// threshold and an info line when it drops back below.
+func (m *PolicyMonitor) Check() (sync.PolicySize, error) {
+	size, err := sync.MeasurePolicy(m.state, m.limit)
+	if err != nil {
+		return size, err
+	}
+	if m.limit <= 0 || m.warnAt <= 0 {
+		return size, nil
+	}
+
+	above := size.PercentOfLimit >= m.warnAt*100
+	m.mu.Lock()
+	crossed := above != m.above
+	m.above = above
+	m.mu.Unlock()
+
+	switch {
+	case crossed && above:
+		m.logger.Warn("Policy size is approaching the Tailscale limit",
+			zap.Int("bytes", size.Bytes),
+			zap.Int("limit", m.limit),
+			zap.Float64("percent", size.PercentOfLimit),
+		)
+	case crossed:
+		m.logger.Info("Policy size is back under the warning threshold",
+			zap.Int("bytes", size.Bytes),
+			zap.Float64("percent", size.PercentOfLimit),
+		)
+	}
+	return size, nil
+}
+
+// Describe implements prometheus.Collector.
+func (m *PolicyMonitor) Describe(ch chan<- *prometheus.Desc) {
+	ch <- policyBytesDesc
+	ch <- policySectionBytesDesc
+	ch <- policyLimitBytesDesc
+	ch <- policyLimitRatioDesc
+}
+
+// Collect implements prometheus.Collector.
+func (m *PolicyMonitor) Collect(ch chan<- prometheus.Metric) {
+	size, err := m.Check()
+	if err != nil {
+		m.logger.Error("Failed to measure policy size", zap.Error(err))
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(policyBytesDesc, prometheus.GaugeValue, float64(size.Bytes))
+	for section, n := range size.Sections {
+		ch <- prometheus.MustNewConstMetric(policySectionBytesDesc, prometheus.GaugeValue, float64(n), section)
+	}
+	if m.limit > 0 {
+		ch <- prometheus.MustNewConstMetric(policyLimitBytesDesc, prometheus.GaugeValue, float64(m.limit))
+		ch <- prometheus.MustNewConstMetric(policyLimitRatioDesc, prometheus.GaugeValue, size.PercentOfLimit/100)
+	}
+}
+
+// SectionPushes counts, per section, the successful pushes that changed
+// it. Pass its SyncResult to sync.Syncer.Subscribe.
+type SectionPushes struct {
+	changes *prometheus.CounterVec
+	pushes  *prometheus.CounterVec
+}
+
+// NewSectionPushes returns an empty SectionPushes.
+func NewSectionPushes() *SectionPushes {
+	return &SectionPushes{
+		changes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tacl_sync_section_changes_total",
+			Help: "Successful pushes that changed or removed each policy section.",
+		}, []string{"section"}),
+		pushes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tacl_sync_pushes_total",
+			Help: "Successful pushes, by whether only changed sections were sent (partial) or the whole policy (full).",
+		}, []string{"mode"}),
+	}
+}
+
+// SyncResult records a push attempt.
+func (p *SectionPushes) SyncResult(r sync.Result) {
+	if !r.OK() || r.Delta == nil {
+		return
+	}
+	mode := "full"
+	if r.Partial {
+		mode = "partial"
+	}
+	p.pushes.WithLabelValues(mode).Inc()
+	for _, section := range r.Delta.Sections() {
+		p.changes.WithLabelValues(section).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (p *SectionPushes) Describe(ch chan<- *prometheus.Desc) {
+	p.changes.Describe(ch)
+	p.pushes.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (p *SectionPushes) Collect(ch chan<- prometheus.Metric) {
+	p.changes.Collect(ch)
+	p.pushes.Collect(ch)
+}
@@ -0,0 +1,252 @@
+package policyfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// Formats accepted by Docs.
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// docSection is one table of the policy documentation.
+type docSection struct {
+	Title  string
+	Intro  string
+	Header []string
+	Rows   [][]string
+}
+
+// policyDoc is the documentation of a policy, before rendering.
+type policyDoc struct {
+	Generated string
+	Sections  []docSection
+}
+
+// Docs renders a human-readable report of state, for audits and
+// onboarding: groups and their members, tag owners, the ACL and SSH rules
+// with their descriptions, postures and hosts. Disabled and expired rules
+// are left out, as they are from the synced policy.
+func Docs(data map[string]interface{}, format string) ([]byte, error) {
+	// Sections may hold typed entries; work on their JSON form
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var policy map[string]interface{}
+	if err := json.Unmarshal(b, &policy); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	doc := policyDoc{
+		Generated: now.Format(time.RFC3339),
+		Sections: []docSection{
+			mapSection(policy, "groups", "Groups", "group:", []string{"Group", "Members", "Count"}),
+			mapSection(policy, "tagOwners", "Tag Owners", "", []string{"Tag", "Owners"}),
+			ruleSection(policy, "acls", "ACL Rules", now, []string{"#", "Action", "Source", "Destination", "Protocol", "Description"},
+				func(e map[string]interface{}) []string {
+					return []string{stringField(e, "action"), listField(e, "src"), listField(e, "dst"), stringField(e, "proto"), stringField(e, "description")}
+				}),
+			ruleSection(policy, "ssh", "SSH Rules", now, []string{"#", "Action", "Source", "Destination", "Users", "Description"},
+				func(e map[string]interface{}) []string {
+					return []string{stringField(e, "action"), listField(e, "src"), listField(e, "dst"), listField(e, "users"), stringField(e, "description")}
+				}),
+			postureSection(policy),
+			mapSection(policy, "hosts", "Hosts", "", []string{"Host", "Address"}),
+		},
+	}
+
+	switch format {
+	case FormatMarkdown, "":
+		return renderMarkdown(doc), nil
+	case FormatHTML:
+		var out bytes.Buffer
+		if err := docsHTML.Execute(&out, doc); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (markdown or html)", format)
+	}
+}
+
+// mapSection lists a map section by key. Keys starting with "_" hold TACL
+// metadata and are skipped. Values that are lists are joined, and counted
+// if header has a third column.
+func mapSection(policy map[string]interface{}, key, title, prefix string, header []string) docSection {
+	sec := docSection{Title: title, Header: header}
+	m, _ := policy[key].(map[string]interface{})
+	for _, k := range sortedKeys(m) {
+		if strings.HasPrefix(k, "_") {
+			continue
+		}
+		row := []string{strings.TrimPrefix(k, prefix), joinValue(m[k])}
+		if len(header) > 2 {
+			list, _ := m[k].([]interface{})
+			row = append(row, strconv.Itoa(len(list)))
+		}
+		sec.Rows = append(sec.Rows, row)
+	}
+	return sec
+}
+
+// ruleSection lists the active entries of a list section in the order
+// they're synced, numbered from 1.
+func ruleSection(policy map[string]interface{}, key, title string, now time.Time, header []string, row func(map[string]interface{}) []string) docSection {
+	sec := docSection{Title: title, Header: header}
+	list, _ := policy[key].([]interface{})
+	common.SortEntries(list)
+	inactive := 0
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if common.InactiveEntry(entry, now) {
+			inactive++
+			continue
+		}
+		sec.Rows = append(sec.Rows, append([]string{strconv.Itoa(len(sec.Rows) + 1)}, row(entry)...))
+	}
+	if inactive > 0 {
+		sec.Intro = fmt.Sprintf("%d disabled or expired rule(s) not shown.", inactive)
+	}
+	return sec
+}
+
+// postureSection lists the posture definitions, with the default source
+// posture as the section's intro.
+func postureSection(policy map[string]interface{}) docSection {
+	sec := mapSection(policy, "postures", "Postures", "posture:", []string{"Posture", "Rules"})
+	m, _ := policy["postures"].(map[string]interface{})
+	rows := sec.Rows[:0]
+	for _, r := range sec.Rows {
+		if r[0] != defaultPostureKey {
+			rows = append(rows, r)
+		}
+	}
+	sec.Rows = rows
+	if def, ok := m[defaultPostureKey]; ok {
+		sec.Intro = "Default source posture: " + joinValue(def)
+	}
+	return sec
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringField(entry map[string]interface{}, key string) string {
+	s, _ := entry[key].(string)
+	return s
+}
+
+func listField(entry map[string]interface{}, key string) string {
+	return joinValue(entry[key])
+}
+
+// joinValue renders a string or list of strings as one cell.
+func joinValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []interface{}:
+		parts := make([]string, 0, len(val))
+		for _, item := range val {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ", ")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func renderMarkdown(doc policyDoc) []byte {
+	var out bytes.Buffer
+	out.WriteString("# Tailnet Policy\n\n")
+	fmt.Fprintf(&out, "Generated by TACL at %s.\n", doc.Generated)
+	for _, sec := range doc.Sections {
+		fmt.Fprintf(&out, "\n## %s\n\n", sec.Title)
+		if sec.Intro != "" {
+			out.WriteString(markdownCell(sec.Intro) + "\n\n")
+		}
+		if len(sec.Rows) == 0 {
+			out.WriteString("_None._\n")
+			continue
+		}
+		writeMarkdownRow(&out, sec.Header)
+		out.WriteString("|" + strings.Repeat(" --- |", len(sec.Header)) + "\n")
+		for _, row := range sec.Rows {
+			writeMarkdownRow(&out, row)
+		}
+	}
+	return out.Bytes()
+}
+
+func writeMarkdownRow(out *bytes.Buffer, cells []string) {
+	out.WriteString("|")
+	for _, c := range cells {
+		out.WriteString(" " + markdownCell(c) + " |")
+	}
+	out.WriteByte('\n')
+}
+
+// markdownCell keeps text from breaking out of a table cell or being read
+// as markup.
+var markdownCell = strings.NewReplacer(
+	"\\", "\\\\", "|", "\\|", "*", "\\*", "_", "\\_", "`", "\\`",
+	"<", "&lt;", ">", "&gt;", "\r\n", " ", "\n", " ",
+).Replace
+
+var docsHTML = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Tailnet Policy</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>Tailnet Policy</h1>
+<p>Generated by TACL at {{.Generated}}.</p>
+{{- range .Sections}}
+<h2>{{.Title}}</h2>
+{{- if .Intro}}
+<p>{{.Intro}}</p>
+{{- end}}
+{{- if .Rows}}
+<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- else}}
+<p><em>None.</em></p>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,248 @@
+package policyfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/tailscale/hujson"
+)
+
+// headscaleSections maps lowercased top-level keys to Tailscale's names.
+// Headscale decodes policies case-insensitively, so "ACLs" and "TagOwners"
+// are common.
+var headscaleSections = map[string]string{
+	"acls":          "acls",
+	"groups":        "groups",
+	"hosts":         "hosts",
+	"tagowners":     "tagOwners",
+	"autoapprovers": "autoApprovers",
+	"ssh":           "ssh",
+	"tests":         "tests",
+	"sshtests":      "sshTests",
+	"nodeattrs":     "nodeAttrs",
+	"grants":        "grants",
+	"derpmap":       "derpMap",
+	"postures":      "postures",
+}
+
+// headscaleFields maps lowercased ACL and SSH rule keys to Tailscale's.
+// "users" and "ports" are the legacy names of src and dst in ACL rules.
+var headscaleFields = map[string]string{
+	"action":      "action",
+	"src":         "src",
+	"dst":         "dst",
+	"proto":       "proto",
+	"srcposture":  "srcPosture",
+	"users":       "users",
+	"ports":       "dst",
+	"checkperiod": "checkPeriod",
+	"acceptenv":   "acceptEnv",
+}
+
+// headscaleAutogroups are Headscale spellings of Tailscale autogroups.
+var headscaleAutogroups = map[string]string{
+	"autogroup:members": "autogroup:member",
+}
+
+// ImportHeadscale converts a Headscale ACL policy (JSON or HuJSON) into TACL
+// state. Headscale identifies users by bare names ("alice") or names with
+// a trailing "@" ("alice@"); with domain set they become "alice@domain".
+// The warnings list what couldn't be converted and is left as it was.
+func ImportHeadscale(policy []byte, domain string) (map[string]interface{}, []string, error) {
+	std, err := hujson.Standardize(policy)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing policy: %w", err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(std, &raw); err != nil {
+		return nil, nil, fmt.Errorf("policy must be a JSON object: %w", err)
+	}
+
+	data := make(map[string]interface{}, len(raw))
+	for k, v := range raw {
+		if canonical, ok := headscaleSections[strings.ToLower(k)]; ok {
+			k = canonical
+		}
+		data[k] = v
+	}
+
+	c := &headscaleConverter{domain: domain, hosts: map[string]bool{}, warned: map[string]bool{}}
+	if hosts, ok := data["hosts"].(map[string]interface{}); ok {
+		for name := range hosts {
+			c.hosts[name] = true
+		}
+	}
+
+	if groups, ok := data["groups"].(map[string]interface{}); ok {
+		for name, members := range groups {
+			groups[name] = c.principals(members)
+		}
+	}
+	if owners, ok := data["tagOwners"].(map[string]interface{}); ok {
+		for tag, list := range owners {
+			owners[tag] = c.principals(list)
+		}
+	}
+	if aa, ok := data["autoApprovers"].(map[string]interface{}); ok {
+		data["autoApprovers"] = c.autoApprovers(aa)
+	}
+	for _, section := range []string{"acls", "ssh"} {
+		list, ok := data[section].([]interface{})
+		if !ok {
+			continue
+		}
+		for i, item := range list {
+			rule, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			list[i] = c.rule(rule, section == "acls")
+		}
+	}
+	if grants, ok := data["grants"].([]interface{}); ok {
+		for _, item := range grants {
+			grant, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, k := range []string{"src", "dst"} {
+				if list, ok := grant[k]; ok {
+					grant[k] = c.principals(list)
+				}
+			}
+		}
+	}
+
+	assignIDs(data)
+	sort.Strings(c.warnings)
+	return data, c.warnings, nil
+}
+
+type headscaleConverter struct {
+	domain   string
+	hosts    map[string]bool
+	warned   map[string]bool
+	warnings []string
+}
+
+func (c *headscaleConverter) warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if !c.warned[msg] {
+		c.warned[msg] = true
+		c.warnings = append(c.warnings, msg)
+	}
+}
+
+// rule canonicalizes the keys of an ACL or SSH rule and converts its
+// principals. SSH "users" are local accounts and are left alone.
+func (c *headscaleConverter) rule(in map[string]interface{}, acl bool) map[string]interface{} {
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		if canonical, ok := headscaleFields[strings.ToLower(k)]; ok {
+			k = canonical
+		}
+		if acl && k == "users" {
+			k = "src"
+		}
+		out[k] = v
+	}
+	if s, ok := out["action"].(string); ok {
+		out["action"] = strings.ToLower(s)
+	}
+	if src, ok := out["src"]; ok {
+		out["src"] = c.principals(src)
+	}
+	if dst, ok := out["dst"]; ok && acl {
+		out["dst"] = c.destinations(dst)
+	} else if ok {
+		out["dst"] = c.principals(dst)
+	}
+	return out
+}
+
+func (c *headscaleConverter) autoApprovers(in map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		switch strings.ToLower(k) {
+		case "routes":
+			if routes, ok := v.(map[string]interface{}); ok {
+				for prefix, approvers := range routes {
+					routes[prefix] = c.principals(approvers)
+				}
+			}
+			out["routes"] = v
+		case "exitnode":
+			out["exitNode"] = c.principals(v)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// destinations converts "principal:ports" entries of an ACL's dst.
+func (c *headscaleConverter) destinations(v interface{}) interface{} {
+	list, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	for i, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			continue
+		}
+		idx := strings.LastIndex(s, ":")
+		if idx <= 0 || strings.HasPrefix(s, "[") {
+			continue
+		}
+		list[i] = c.principal(s[:idx]) + s[idx:]
+	}
+	return list
+}
+
+func (c *headscaleConverter) principals(v interface{}) interface{} {
+	list, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	for i, item := range list {
+		if s, ok := item.(string); ok {
+			list[i] = c.principal(s)
+		}
+	}
+	return list
+}
+
+// principal converts one user, group, tag, autogroup, host or address.
+func (c *headscaleConverter) principal(s string) string {
+	switch {
+	case s == "*" || c.hosts[s]:
+		return s
+	case strings.HasPrefix(s, "autogroup:"):
+		if alias, ok := headscaleAutogroups[s]; ok {
+			return alias
+		}
+		return s
+	case strings.HasPrefix(s, "group:") || strings.HasPrefix(s, "tag:"):
+		return s
+	}
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return s
+	}
+	if _, err := netip.ParseAddr(s); err == nil {
+		return s
+	}
+
+	name, at := strings.CutSuffix(s, "@")
+	if !at && strings.Contains(s, "@") {
+		return s // already a login
+	}
+	if c.domain == "" {
+		c.warn("user %q has no domain to make it a Tailscale login", s)
+		return s
+	}
+	return name + "@" + c.domain
+}
@@ -0,0 +1,116 @@
+// Package policyfile converts between TACL state and Tailscale policy files.
+package policyfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/lbrlabs/tacl/pkg/acl/settings"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/tailscale/hujson"
+)
+
+// Formats accepted by Export.
+const (
+	FormatJSON   = "json"
+	FormatHuJSON = "hujson"
+)
+
+// idSections are the list sections whose entries TACL addresses by "id".
+var idSections = []string{"acls", "aclTests", "grants", "nodeAttrs", "ssh"}
+
+// Export renders state as the policy file TACL would push to Tailscale:
+// internal keys, entry metadata and ids are dropped.
+func Export(data map[string]interface{}, format string) ([]byte, error) {
+	policy, err := sync.PolicyJSON(&common.State{Data: data})
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatJSON, "":
+		var out bytes.Buffer
+		if err := json.Indent(&out, policy, "", "  "); err != nil {
+			return nil, err
+		}
+		out.WriteByte('\n')
+		return out.Bytes(), nil
+	case FormatHuJSON:
+		v, err := hujson.Parse(policy)
+		if err != nil {
+			return nil, err
+		}
+		v.Format()
+		return v.Pack(), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (json or hujson)", format)
+	}
+}
+
+// Import parses a Tailscale policy file (JSON or HuJSON) into TACL state,
+// giving every entry of an id-addressed list section a stable id.
+func Import(policy []byte) (map[string]interface{}, error) {
+	std, err := hujson.Standardize(policy)
+	if err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(std, &data); err != nil {
+		return nil, fmt.Errorf("policy must be a JSON object: %w", err)
+	}
+	assignIDs(data)
+	collectSettings(data)
+	return data, nil
+}
+
+// collectSettings moves the top-level settings of a policy file into the
+// settings section, where the settings module keeps them. Keys outside
+// settings.Schema stay where they are, and are pushed back unchanged.
+func collectSettings(data map[string]interface{}) {
+	collected, _ := data["settings"].(map[string]interface{})
+	for k, v := range data {
+		if _, ok := settings.Known(k); ok {
+			if collected == nil {
+				collected = make(map[string]interface{})
+			}
+			collected[k] = v
+			delete(data, k)
+		}
+	}
+	if collected != nil {
+		data["settings"] = collected
+	}
+}
+
+// idNamespace is the UUID namespace of the ids assignIDs derives.
+var idNamespace = uuid.MustParse("6f1b8a52-2f7e-4c1e-9a8e-3d5b0c7e4a19")
+
+// assignIDs gives every entry of an id-addressed list section that lacks
+// one an id derived from its section and contents, so importing the same
+// policy again gives the same ids. Identical entries are told apart by how
+// many came before them.
+func assignIDs(data map[string]interface{}) {
+	for _, section := range idSections {
+		list, ok := data[section].([]interface{})
+		if !ok {
+			continue
+		}
+		seen := make(map[string]int)
+		for _, item := range list {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, has := entry["id"]; has {
+				continue
+			}
+			b, _ := json.Marshal(entry)
+			name := section + "\n" + string(b)
+			entry["id"] = uuid.NewSHA1(idNamespace, []byte(name+"\n"+strconv.Itoa(seen[name]))).String()
+			seen[name]++
+		}
+	}
+}
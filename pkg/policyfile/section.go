@@ -0,0 +1,102 @@
+package policyfile
+
+import (
+	"fmt"
+
+	"github.com/lbrlabs/tacl/pkg/acl/settings"
+)
+
+// Section shapes.
+const (
+	KindList   = "list"   // entries addressed by id
+	KindMap    = "map"    // entries addressed by key
+	KindObject = "object" // one object for the whole section
+)
+
+// SectionInfo describes how a state section is laid out.
+type SectionInfo struct {
+	Kind string
+	// Prefix is stripped from map keys to form entry names, e.g. "group:".
+	Prefix string
+}
+
+// Sections are the state sections the resource modules manage.
+var Sections = map[string]SectionInfo{
+	"acls":          {Kind: KindList},
+	"aclTests":      {Kind: KindList},
+	"grants":        {Kind: KindList},
+	"nodeAttrs":     {Kind: KindList},
+	"ssh":           {Kind: KindList},
+	"groups":        {Kind: KindMap, Prefix: "group:"},
+	"tagOwners":     {Kind: KindMap, Prefix: "tag:"},
+	"hosts":         {Kind: KindMap},
+	"postures":      {Kind: KindMap, Prefix: "posture:"},
+	"autoApprovers": {Kind: KindObject},
+	"derpMap":       {Kind: KindObject},
+	"settings":      {Kind: KindObject},
+}
+
+// ExportSection renders one section of state the way Export renders the
+// whole policy: a policy file holding just that section.
+func ExportSection(data map[string]interface{}, section, format string) ([]byte, error) {
+	part := map[string]interface{}{}
+	if v := data[section]; v != nil {
+		part[section] = v
+	}
+	return Export(part, format)
+}
+
+// ImportSection parses a policy file (JSON or HuJSON) holding just one
+// section, as written by ExportSection, and returns the section's value.
+// Entries of list sections get ids as with Import. Settings are top-level
+// keys of the policy file, so for "settings" every key is one.
+func ImportSection(policy []byte, section string) (interface{}, error) {
+	info, ok := Sections[section]
+	if !ok {
+		return nil, fmt.Errorf("unknown section %q", section)
+	}
+	data, err := Import(policy)
+	if err != nil {
+		return nil, err
+	}
+	if section == "settings" {
+		out, _ := data["settings"].(map[string]interface{})
+		if out == nil {
+			out = make(map[string]interface{})
+		}
+		for k, v := range data {
+			if k == "settings" {
+				continue
+			}
+			if err := settings.CheckExtra(k); err != nil {
+				return nil, err
+			}
+			out[k] = v
+		}
+		return out, nil
+	}
+
+	for k := range data {
+		if k != section {
+			return nil, fmt.Errorf("unexpected key %q: only %q can be imported here", k, section)
+		}
+	}
+	value, ok := data[section]
+	if !ok {
+		return nil, fmt.Errorf("the policy has no %q section", section)
+	}
+	switch value.(type) {
+	case []interface{}:
+		if info.Kind == KindList {
+			return value, nil
+		}
+	case map[string]interface{}:
+		if info.Kind != KindList {
+			return value, nil
+		}
+	}
+	if info.Kind == KindList {
+		return nil, fmt.Errorf("%q must be a list", section)
+	}
+	return nil, fmt.Errorf("%q must be an object", section)
+}
@@ -0,0 +1,302 @@
+package policyfile
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// TerraformImport is one resource for terraform to adopt: its address in
+// the generated configuration and the id the provider imports it by.
+type TerraformImport struct {
+	Address string `json:"address"`
+	ID      string `json:"id"`
+}
+
+// tfResource describes how a state section maps onto provider resources.
+type tfResource struct {
+	typ    string // resource type, e.g. "tacl_acl"
+	kind   string // list: one resource per entry; map: one per key; single: one for the section
+	prefix string // for map sections, stripped from keys to form the name
+	value  string // for map sections, the attribute holding each key's value
+}
+
+// tfResources are the sections the Terraform provider manages.
+var tfResources = map[string]tfResource{
+	"acls":          {typ: "tacl_acl", kind: "list"},
+	"aclTests":      {typ: "tacl_acl_test", kind: "list"},
+	"grants":        {typ: "tacl_grant", kind: "list"},
+	"nodeAttrs":     {typ: "tacl_node_attr", kind: "list"},
+	"ssh":           {typ: "tacl_ssh", kind: "list"},
+	"groups":        {typ: "tacl_group", kind: "map", prefix: "group:", value: "members"},
+	"tagOwners":     {typ: "tacl_tag_owner", kind: "map", prefix: "tag:", value: "owners"},
+	"hosts":         {typ: "tacl_host", kind: "map", value: "ip"},
+	"postures":      {typ: "tacl_posture", kind: "map", prefix: "posture:", value: "rules"},
+	"autoApprovers": {typ: "tacl_auto_approvers", kind: "single"},
+	"derpMap":       {typ: "tacl_derp_map", kind: "single"},
+	"settings":      {typ: "tacl_settings", kind: "single"},
+}
+
+// defaultPostureKey is the postures key holding the default source posture,
+// which has a resource of its own.
+const defaultPostureKey = "defaultSourcePosture"
+
+// freeformAttrs hold user data, so their keys are written as they are
+// rather than converted to attribute names.
+var freeformAttrs = map[string]bool{"labels": true, "routes": true, "app": true}
+
+var (
+	hclIdent       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+	camelAttr      = regexp.MustCompile(`^[a-z][A-Za-z0-9]*$`)
+	invalidLabel   = regexp.MustCompile(`[^a-z0-9_]+`)
+	uppercaseInner = regexp.MustCompile(`([a-z0-9])([A-Z])|([A-Z])([A-Z][a-z])`)
+)
+
+// Terraform renders state as terraform-provider-tacl resource blocks
+// followed by import blocks (Terraform 1.5+), and returns the imports so
+// they can also be written as terraform import commands.
+func Terraform(data map[string]interface{}) ([]byte, []TerraformImport) {
+	sections := make([]string, 0, len(data))
+	for k := range data {
+		if !strings.HasPrefix(k, "_") {
+			sections = append(sections, k)
+		}
+	}
+	sort.Strings(sections)
+
+	var out bytes.Buffer
+	var imports []TerraformImport
+	used := make(map[string]bool)
+	emit := func(typ, label, id string, attrs map[string]interface{}) {
+		label = uniqueLabel(used, typ, label)
+		if out.Len() > 0 {
+			out.WriteByte('\n')
+		}
+		fmt.Fprintf(&out, "resource %q %q {\n", typ, label)
+		writeBody(&out, attrs, "  ", false)
+		out.WriteString("}\n")
+		imports = append(imports, TerraformImport{Address: typ + "." + label, ID: id})
+	}
+
+	for _, section := range sections {
+		res, ok := tfResources[section]
+		if !ok {
+			continue
+		}
+		switch res.kind {
+		case "list":
+			list, _ := data[section].([]interface{})
+			for i, item := range list {
+				entry, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				id, _ := entry["id"].(string)
+				label := strings.TrimPrefix(res.typ, "tacl_") + "_" + strconv.Itoa(i+1)
+				if slug := common.EntrySlug(entry); slug != "" {
+					// TACL resolves a slug wherever it takes an id
+					label, id = slug, slug
+				} else if id != "" {
+					label = strings.TrimPrefix(res.typ, "tacl_") + "_" + strings.SplitN(id, "-", 2)[0]
+				}
+				emit(res.typ, label, id, resourceAttrs(entry))
+			}
+		case "map":
+			m, _ := data[section].(map[string]interface{})
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if section == "postures" && k == defaultPostureKey {
+					emit("tacl_default_posture", "default", "default", map[string]interface{}{defaultPostureKey: m[k]})
+					continue
+				}
+				name := strings.TrimPrefix(k, res.prefix)
+				emit(res.typ, name, name, map[string]interface{}{"name": name, res.value: m[k]})
+			}
+		case "single":
+			m, ok := data[section].(map[string]interface{})
+			if !ok || len(m) == 0 {
+				continue
+			}
+			emit(res.typ, "main", section, resourceAttrs(m))
+		}
+	}
+
+	for _, imp := range imports {
+		fmt.Fprintf(&out, "\nimport {\n  to = %s\n  id = %s\n}\n", imp.Address, hclString(imp.ID))
+	}
+	return out.Bytes(), imports
+}
+
+// TerraformImportCommands renders imports as a shell script of terraform
+// import commands, for Terraform versions without import blocks.
+func TerraformImportCommands(imports []TerraformImport) []byte {
+	var out bytes.Buffer
+	out.WriteString("#!/bin/sh\nset -e\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&out, "terraform import %s %s\n", shellQuote(imp.Address), shellQuote(imp.ID))
+	}
+	return out.Bytes()
+}
+
+// resourceAttrs is entry without the fields TACL manages itself.
+func resourceAttrs(entry map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(entry))
+	for k, v := range entry {
+		out[k] = v
+	}
+	delete(out, "id")
+	for _, f := range common.MetaFields {
+		delete(out, f)
+	}
+	return out
+}
+
+// uniqueLabel turns name into a valid resource name, unique within typ.
+func uniqueLabel(used map[string]bool, typ, name string) string {
+	label := strings.Trim(invalidLabel.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if label == "" || (label[0] >= '0' && label[0] <= '9') {
+		label = "_" + label
+	}
+	candidate := label
+	for n := 2; used[typ+"."+candidate]; n++ {
+		candidate = label + "_" + strconv.Itoa(n)
+	}
+	used[typ+"."+candidate] = true
+	return candidate
+}
+
+// attrName converts a JSON field name to the provider's snake_case, e.g.
+// "exitNode" => "exit_node", "disableIPv4" => "disable_ipv4".
+func attrName(key string) string {
+	key = strings.NewReplacer("IPv4", "Ipv4", "IPv6", "Ipv6").Replace(key)
+	return strings.ToLower(uppercaseInner.ReplaceAllString(key, "${1}${3}_${2}${4}"))
+}
+
+// writeBody writes m's attributes sorted, "name" first, aligning the "="
+// of consecutive single-line values like terraform fmt.
+func writeBody(out *bytes.Buffer, m map[string]interface{}, indent string, freeform bool) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == "name") != (keys[j] == "name") {
+			return keys[i] == "name"
+		}
+		return keys[i] < keys[j]
+	})
+
+	type attr struct{ name, value string }
+	attrs := make([]attr, len(keys))
+	for i, k := range keys {
+		name, childFreeform := k, freeform
+		switch {
+		case !freeform && camelAttr.MatchString(k):
+			name = attrName(k)
+			childFreeform = freeformAttrs[k]
+		case !hclIdent.MatchString(k):
+			name = hclString(k)
+		}
+		attrs[i] = attr{name: name, value: hclValue(m[k], indent, childFreeform)}
+	}
+
+	for start := 0; start < len(attrs); {
+		end, width := start, 0
+		for end < len(attrs) && !strings.Contains(attrs[end].value, "\n") {
+			width = max(width, len(attrs[end].name))
+			end++
+		}
+		if end == start {
+			fmt.Fprintf(out, "%s%s = %s\n", indent, attrs[start].name, attrs[start].value)
+			start++
+			continue
+		}
+		for _, a := range attrs[start:end] {
+			fmt.Fprintf(out, "%s%-*s = %s\n", indent, width, a.name, a.value)
+		}
+		start = end
+	}
+}
+
+// hclValue renders a JSON value as an HCL expression. Lists of scalars stay
+// on one line; objects are written one attribute per line.
+func hclValue(v interface{}, indent string, freeform bool) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return hclString(val)
+	case bool:
+		return strconv.FormatBool(val)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case []interface{}:
+		if len(val) == 0 {
+			return "[]"
+		}
+		items := make([]string, len(val))
+		inline := true
+		for i, item := range val {
+			items[i] = hclValue(item, indent+"  ", freeform)
+			if _, ok := item.(map[string]interface{}); ok {
+				inline = false
+			}
+		}
+		if inline {
+			return "[" + strings.Join(items, ", ") + "]"
+		}
+		return "[\n" + indent + "  " + strings.Join(items, ",\n"+indent+"  ") + ",\n" + indent + "]"
+	case map[string]interface{}:
+		if len(val) == 0 {
+			return "{}"
+		}
+		var b bytes.Buffer
+		b.WriteString("{\n")
+		writeBody(&b, val, indent+"  ", freeform)
+		b.WriteString(indent + "}")
+		return b.String()
+	default:
+		return hclString(fmt.Sprint(val))
+	}
+}
+
+// hclString quotes s, escaping template sequences so they stay literal.
+func hclString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteRune(r)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
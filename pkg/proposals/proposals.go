@@ -0,0 +1,326 @@
+package proposals
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/tailscale/hujson"
+	"go.uber.org/zap"
+)
+
+// stateKey is where proposals are kept. The leading underscore keeps it out of the synced policy.
+const stateKey = "_proposals"
+
+// Proposal statuses.
+const (
+	StatusPending  = "pending"
+	StatusApplied  = "applied"
+	StatusFailed   = "failed"
+	StatusRejected = "rejected"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Result is the outcome of replaying an approved proposal.
+type Result struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Proposal is a mutation held back until a second identity approves it.
+type Proposal struct {
+	ID        string          `json:"id"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Status    string          `json:"status"`
+	CreatedBy common.Identity `json:"createdBy"`
+	CreatedAt time.Time       `json:"createdAt"`
+	// ManagedBy is the source the change came from (see
+	// common.ManagedByHeader), which it's applied as.
+	ManagedBy string `json:"managedBy,omitempty"`
+
+	DecidedBy string     `json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+	Result    *Result    `json:"result,omitempty"`
+}
+
+// Middleware intercepts mutating requests to the given resources (first path
+// segments, e.g. "acls", "ssh") and turns them into pending proposals,
+// answering 202 Accepted instead of applying them. Requests to routes that
+// may change any section (see common.RegisterPolicyRoute), such as PUT
+// /state, are held too. It must run after the auth middleware and inside
+// common.SerializeMutations.
+func Middleware(state *common.State, resources []string) gin.HandlerFunc {
+	guarded := make(map[string]bool, len(resources))
+	for _, r := range resources {
+		guarded[r] = true
+	}
+	return func(c *gin.Context) {
+		if !common.IsMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if !guarded[common.FirstPathSegment(c.Request.URL.Path)] && (len(guarded) == 0 || !common.WritesPolicy(c)) {
+			c.Next()
+			return
+		}
+		// Approved proposals are replayed internally and must go through
+		if _, internal := common.InternalIdentity(c.Request); internal {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read request body"})
+			return
+		}
+		if len(body) > 0 && !json.Valid(body) {
+			// Policy files, as PUT /state takes, may use HuJSON
+			std, err := hujson.Standardize(body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "Request body must be valid JSON"})
+				return
+			}
+			body = std
+		}
+
+		id, _ := common.GetIdentity(c)
+		p := Proposal{
+			ID:        uuid.NewString(),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.RequestURI(),
+			Status:    StatusPending,
+			CreatedBy: id,
+			CreatedAt: time.Now().UTC(),
+			ManagedBy: common.ManagedBy(c),
+		}
+		if len(body) > 0 {
+			p.Body = json.RawMessage(body)
+		}
+
+		// Proposals for different sections can arrive concurrently
+		unlock := state.LockKey(stateKey)
+		defer unlock()
+
+		list, err := getProposalsFromState(state)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse proposals"})
+			return
+		}
+		list = append(list, p)
+		if err := state.UpdateKeyAndSaveContext(c.Request.Context(), stateKey, list); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save proposal"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusAccepted, p)
+	}
+}
+
+// RegisterRoutes wires up the /proposals endpoints.
+//
+//	GET  /proposals             => list all proposals
+//	GET  /proposals/:id         => get one proposal
+//	POST /proposals/:id/approve => apply a pending proposal (by a different identity)
+//	POST /proposals/:id/reject  => discard a pending proposal
+func RegisterRoutes(r *gin.Engine, state *common.State) {
+	p := r.Group("/proposals")
+	{
+		p.GET("", func(c *gin.Context) {
+			listProposals(c, state)
+		})
+		p.GET("/:id", func(c *gin.Context) {
+			getProposalByID(c, state)
+		})
+		p.POST("/:id/approve", func(c *gin.Context) {
+			approveProposal(c, r, state)
+		})
+		p.POST("/:id/reject", func(c *gin.Context) {
+			rejectProposal(c, state)
+		})
+	}
+}
+
+// listProposals => GET /proposals
+func listProposals(c *gin.Context, state *common.State) {
+	list, err := getProposalsFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse proposals"})
+		return
+	}
+	if status := c.Query("status"); status != "" {
+		filtered := make([]Proposal, 0, len(list))
+		for _, p := range list {
+			if p.Status == status {
+				filtered = append(filtered, p)
+			}
+		}
+		list = filtered
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// getProposalByID => GET /proposals/:id
+func getProposalByID(c *gin.Context, state *common.State) {
+	list, err := getProposalsFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse proposals"})
+		return
+	}
+	for _, p := range list {
+		if p.ID == c.Param("id") {
+			c.JSON(http.StatusOK, p)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, ErrorResponse{Error: "Proposal not found"})
+}
+
+// approveProposal => POST /proposals/:id/approve
+func approveProposal(c *gin.Context, r *gin.Engine, state *common.State) {
+	list, err := getProposalsFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse proposals"})
+		return
+	}
+	idx := indexOf(list, c.Param("id"))
+	if idx < 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Proposal not found"})
+		return
+	}
+	p := &list[idx]
+	if p.Status != StatusPending {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Proposal is not pending"})
+		return
+	}
+
+	approver, _ := common.GetIdentity(c)
+	// An automation impersonating someone else still can't approve its own
+	// proposals
+	if approver.Actor() == "" || approver.Actor() == p.CreatedBy.Actor() || approver.Caller() == p.CreatedBy.Caller() {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Proposal must be approved by a different identity"})
+		return
+	}
+
+	// Replay the original request through the router as its author. We hold
+	// the mutation lock already, which the internal request accounts for.
+	req, err := common.NewInternalRequest(c.Request.Context(), p.Method, p.Path, p.Body, p.CreatedBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build request for proposal"})
+		return
+	}
+	if p.ManagedBy != "" {
+		req.Header.Set(common.ManagedByHeader, p.ManagedBy)
+	}
+	// The change, its history and the decided proposal go out in one write
+	err = state.Batch(func() error {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		now := time.Now().UTC()
+		p.DecidedBy = approver.Actor()
+		p.DecidedAt = &now
+		p.Result = &Result{Status: rec.Code}
+		if b := bytes.TrimSpace(rec.Body.Bytes()); json.Valid(b) {
+			p.Result.Body = json.RawMessage(b)
+		}
+		p.Status = StatusApplied
+		if rec.Code < 200 || rec.Code > 299 {
+			p.Status = StatusFailed
+		}
+		return state.UpdateKeyAndSaveContext(c.Request.Context(), stateKey, list)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save proposal"})
+		return
+	}
+	if state.Logger != nil {
+		state.Logger.Info("Proposal decided",
+			zap.String("id", p.ID),
+			zap.String("status", p.Status),
+			zap.String("createdBy", p.CreatedBy.Actor()),
+			zap.String("approvedBy", p.DecidedBy),
+		)
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// rejectProposal => POST /proposals/:id/reject
+func rejectProposal(c *gin.Context, state *common.State) {
+	list, err := getProposalsFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse proposals"})
+		return
+	}
+	idx := indexOf(list, c.Param("id"))
+	if idx < 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Proposal not found"})
+		return
+	}
+	p := &list[idx]
+	if p.Status != StatusPending {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Proposal is not pending"})
+		return
+	}
+
+	who, _ := common.GetIdentity(c)
+	now := time.Now().UTC()
+	p.Status = StatusRejected
+	p.DecidedBy = who.Actor()
+	p.DecidedAt = &now
+
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), stateKey, list); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save proposal"})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func indexOf(list []Proposal, id string) int {
+	for i := range list {
+		if list[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the proposal with the given id, if there is one.
+func Get(state *common.State, id string) (Proposal, bool, error) {
+	list, err := getProposalsFromState(state)
+	if err != nil {
+		return Proposal{}, false, err
+	}
+	if idx := indexOf(list, id); idx >= 0 {
+		return list[idx], true, nil
+	}
+	return Proposal{}, false, nil
+}
+
+// getProposalsFromState => read state.Data["_proposals"] => []Proposal
+func getProposalsFromState(state *common.State) ([]Proposal, error) {
+	raw := state.GetValue(stateKey)
+	if raw == nil {
+		return []Proposal{}, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var list []Proposal
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,52 @@
+package proposals_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/proposals"
+	"github.com/lbrlabs/tacl/pkg/taclitest"
+	"github.com/lbrlabs/tacl/pkg/transfer"
+	"go.uber.org/zap"
+)
+
+func TestStateReplaceNeedsApproval(t *testing.T) {
+	state := &common.State{
+		Data:    make(map[string]interface{}),
+		Storage: "mem://state.json",
+		Objects: taclitest.NewMemStore(),
+		Logger:  zap.NewNop(),
+	}
+	state.LoadFromStorage()
+	before := []interface{}{map[string]interface{}{"id": "1", "action": "accept", "src": []interface{}{"group:eng"}, "dst": []interface{}{"db:5432"}}}
+	if err := state.UpdateKeyAndSave("acls", before); err != nil {
+		t.Fatalf("saving acls: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		common.SetIdentity(c, taclitest.DefaultIdentity)
+	})
+	r.Use(common.SerializeMutations(state))
+	r.Use(proposals.Middleware(state, []string{"acls"}))
+	transfer.RegisterStateRoutes(r, state)
+
+	body := `{
+		// Anyone may reach anything
+		"acls": [{"action": "accept", "src": ["*"], "dst": ["*:*"]}],
+	}`
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/state", strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("PUT /state = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body.String())
+	}
+	if got := state.GetValue("acls"); !reflect.DeepEqual(got, before) {
+		t.Errorf("acls changed without approval: %#v", got)
+	}
+}
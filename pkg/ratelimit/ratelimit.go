@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/cap"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// idleTimeout is how long a caller's bucket is kept after its last request.
+const idleTimeout = 10 * time.Minute
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter hands out one token bucket per caller.
+type Limiter struct {
+	rps   rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	lastGC  time.Time
+}
+
+// New returns a Limiter allowing `rps` requests per second per caller, with
+// bursts of up to `burst` requests.
+func New(rps float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rps:     rate.Limit(rps),
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+		lastGC:  time.Now(),
+	}
+}
+
+// Allow consumes a token for `key`, reporting whether the request may proceed.
+func (l *Limiter) Allow(key string) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastGC) > idleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > idleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastGC = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter.AllowN(now, 1)
+}
+
+// Middleware rejects requests with 429 once a caller's bucket is empty.
+// Callers are keyed by the identity the auth middleware recorded, so it must
+// run after cap.TailscaleAuthMiddleware. Requests without one, and those on
+// the local and Funnel listeners (whose identity just names the listener),
+// are keyed by their remote address instead.
+func Middleware(l *Limiter, logger *zap.Logger) gin.HandlerFunc {
+	retryAfter := "1"
+	if l.rps > 0 && l.rps < 1 {
+		retryAfter = strconv.Itoa(int(1/float64(l.rps)) + 1)
+	}
+	return func(c *gin.Context) {
+		key := remoteAddr(c.Request)
+		if id, ok := common.GetIdentity(c); ok && id.Caller() != "" && !cap.IsLocalRequest(c.Request) && !cap.IsFunnelRequest(c.Request) {
+			key = id.Caller()
+		}
+		if !l.Allow(key) {
+			logger.Warn("Rate limit exceeded",
+				zap.String("caller", key),
+				zap.String("method", c.Request.Method),
+				zap.String("url", c.Request.URL.Path),
+			)
+			c.Header("Retry-After", retryAfter)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{Error: "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// remoteAddr returns the host part of r.RemoteAddr. It deliberately ignores
+// forwarding headers, which any caller can set.
+func remoteAddr(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,63 @@
+package readonly
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"go.uber.org/zap"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Mode is the body shape for GET/PUT /readonly.
+//
+// Example JSON: { "readOnly": true }
+type Mode struct {
+	ReadOnly bool `json:"readOnly"`
+}
+
+// togglePath is exempt from the guard, otherwise read-only mode could never be turned off.
+const togglePath = "/readonly"
+
+// Middleware rejects mutating requests with 403 while the state is read-only.
+// Reads and the background sync are unaffected.
+func Middleware(state *common.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if state.IsReadOnly() && common.IsMutatingMethod(c.Request.Method) && c.Request.URL.Path != togglePath {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: "server is in read-only mode"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RegisterRoutes wires up the runtime toggle at /readonly.
+//
+//	GET /readonly => { "readOnly": bool }
+//	PUT /readonly => set the mode, body { "readOnly": bool }
+func RegisterRoutes(r *gin.Engine, state *common.State) {
+	r.GET(togglePath, func(c *gin.Context) {
+		c.JSON(http.StatusOK, Mode{ReadOnly: state.IsReadOnly()})
+	})
+	r.PUT(togglePath, func(c *gin.Context) {
+		setMode(c, state)
+	})
+}
+
+// setMode => PUT /readonly
+func setMode(c *gin.Context, state *common.State) {
+	var req Mode
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	state.SetReadOnly(req.ReadOnly)
+	if state.Logger != nil {
+		state.Logger.Info("Read-only mode changed", zap.Bool("readOnly", req.ReadOnly))
+	}
+	c.JSON(http.StatusOK, req)
+}
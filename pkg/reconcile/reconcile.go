@@ -0,0 +1,196 @@
+// Package reconcile compares the three copies of the policy a server
+// knows about: the state it loaded, the policy it last pushed (by the hash
+// recorded in "_meta") and the policy live on the tailnet. It runs once at
+// startup, before the first push, so a restart that left them
+// inconsistent is noticed before sync papers over it.
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	gosync "sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/diff"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/tailscale/hujson"
+	"go.uber.org/zap"
+)
+
+// Statuses of a Report.
+const (
+	// StatusInSync: the state and the live policy match.
+	StatusInSync = "in-sync"
+	// StatusLocalAhead: the state changed since the last push, and the
+	// live policy didn't. The next push brings the tailnet up to date.
+	StatusLocalAhead = "local-ahead"
+	// StatusRemoteAhead: the live policy changed since the last push, e.g.
+	// in the admin console, and the state didn't. The next push reverts it.
+	StatusRemoteAhead = "remote-ahead"
+	// StatusDiverged: both changed since the last push, or nothing was
+	// pushed from this state yet.
+	StatusDiverged = "diverged"
+	// StatusUnknown: the live policy couldn't be fetched.
+	StatusUnknown = "unknown"
+)
+
+// Report is the result of one comparison. Hashes are of the policy JSON
+// as TACL pushes it.
+type Report struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Local     string    `json:"local,omitempty"`
+	// LastPushed is from "_meta"; it's empty if nothing was pushed yet.
+	LastPushed   string     `json:"lastPushed,omitempty"`
+	LastPushedAt *time.Time `json:"lastPushedAt,omitempty"`
+	Remote       string     `json:"remote,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	// Diff is what the next push would change on the tailnet.
+	Diff map[string]diff.SectionDiff `json:"diff,omitempty"`
+}
+
+// Response is the body of GET /reconcile/report.
+type Response struct {
+	Report
+	// Startup is the report from when the server started.
+	Startup *Report `json:"startup,omitempty"`
+}
+
+// Reconciler compares state with the tailnet. httpClient is authenticated
+// for the Tailscale API; without it, or a tailnet name, reports are always
+// StatusUnknown.
+type Reconciler struct {
+	state       *common.State
+	httpClient  *http.Client
+	tailnetName string
+	logger      *zap.Logger
+
+	mu      gosync.Mutex // guards startup
+	startup *Report
+}
+
+// New returns a reconciler for state and the named tailnet.
+func New(state *common.State, httpClient *http.Client, tailnetName string, logger *zap.Logger) *Reconciler {
+	return &Reconciler{state: state, httpClient: httpClient, tailnetName: tailnetName, logger: logger}
+}
+
+// Startup compares once and logs the result. Call it before sync starts.
+func (rc *Reconciler) Startup(ctx context.Context) Report {
+	rep := rc.Check(ctx)
+	rc.mu.Lock()
+	rc.startup = &rep
+	rc.mu.Unlock()
+
+	fields := []zap.Field{
+		zap.String("status", rep.Status),
+		zap.String("local", rep.Local),
+		zap.String("lastPushed", rep.LastPushed),
+		zap.String("remote", rep.Remote),
+		zap.Int("changedSections", len(rep.Diff)),
+	}
+	switch rep.Status {
+	case StatusInSync, StatusLocalAhead:
+		rc.logger.Info("Reconciled state with the tailnet policy", fields...)
+	case StatusUnknown:
+		rc.logger.Warn("Could not reconcile state with the tailnet policy", append(fields, zap.String("error", rep.Error))...)
+	default:
+		rc.logger.Warn("State and the tailnet policy are inconsistent; the next push overwrites the tailnet policy", fields...)
+	}
+	return rep
+}
+
+// Check compares the state, the last push and the live policy.
+func (rc *Reconciler) Check(ctx context.Context) Report {
+	rep := Report{CheckedAt: time.Now().UTC()}
+	if applied := sync.LoadMeta(rc.state).LastApplied; applied != nil {
+		rep.LastPushed = applied.SHA256
+		t := applied.Time
+		rep.LastPushedAt = &t
+	}
+	local, err := sync.PolicyJSON(rc.state)
+	if err != nil {
+		rep.Status, rep.Error = StatusUnknown, "building the policy: "+err.Error()
+		return rep
+	}
+	rep.Local = hash(local)
+
+	if rc.httpClient == nil || rc.tailnetName == "" {
+		rep.Status, rep.Error = StatusUnknown, "no Tailscale API credentials or tailnet configured"
+		return rep
+	}
+	live, err := sync.FetchRemote(ctx, rc.httpClient, rc.tailnetName)
+	if err != nil {
+		rep.Status, rep.Error = StatusUnknown, err.Error()
+		return rep
+	}
+	remote, canonical, err := canonicalize(live)
+	if err != nil {
+		rep.Status, rep.Error = StatusUnknown, err.Error()
+		return rep
+	}
+	rep.Remote = hash(canonical)
+
+	switch {
+	case rep.Local == rep.Remote:
+		rep.Status = StatusInSync
+	case rep.LastPushed != "" && rep.Remote == rep.LastPushed:
+		rep.Status = StatusLocalAhead
+	case rep.LastPushed != "" && rep.Local == rep.LastPushed:
+		rep.Status = StatusRemoteAhead
+	default:
+		rep.Status = StatusDiverged
+	}
+	if rep.Status != StatusInSync {
+		var after map[string]interface{}
+		if err := json.Unmarshal(local, &after); err == nil {
+			rep.Diff = diff.State(remote, after)
+		}
+	}
+	return rep
+}
+
+// StartupReport returns the report made by Startup, if it ran.
+func (rc *Reconciler) StartupReport() *Report {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.startup
+}
+
+// RegisterRoutes wires up GET /reconcile/report.
+//
+//	GET /reconcile/report => a fresh Report, with the one from startup
+func RegisterRoutes(r *gin.Engine, rc *Reconciler) {
+	r.GET("/reconcile/report", func(c *gin.Context) {
+		c.JSON(http.StatusOK, Response{Report: rc.Check(c.Request.Context()), Startup: rc.StartupReport()})
+	})
+}
+
+// canonicalize decodes a policy file and encodes it the way TACL encodes
+// the policies it pushes, so equal policies hash the same.
+func canonicalize(policy []byte) (map[string]interface{}, []byte, error) {
+	std, err := hujson.Standardize(policy)
+	if err != nil {
+		return nil, nil, errors.New("the tailnet policy does not parse: " + err.Error())
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(std, &data); err != nil {
+		return nil, nil, errors.New("the tailnet policy is not a JSON object")
+	}
+	var out bytes.Buffer
+	if err := common.WriteJSONObject(&out, data, false); err != nil {
+		return nil, nil, err
+	}
+	return data, out.Bytes(), nil
+}
+
+func hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,174 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// Filter selects entries for POST /<section>/_delete. Every field that is
+// set must match. Src, Dst and Target are path.Match patterns compared
+// with each of the entry's sources, destinations or targets; destinations
+// also match on their host alone, so "tag:web" covers "tag:web:443".
+type Filter struct {
+	Label         []string   `json:"label,omitempty"`
+	Src           string     `json:"src,omitempty"`
+	Dst           string     `json:"dst,omitempty"`
+	Target        string     `json:"target,omitempty"`
+	CreatedBefore *time.Time `json:"createdBefore,omitempty"`
+}
+
+// FilteredDeleteRequest is the body of POST /<section>/_delete. Without
+// Confirm, nothing is deleted and the matches are only returned.
+//
+// Example JSON: { "dst": "tag:legacy-*", "createdBefore": "2025-01-01T00:00:00Z", "confirm": true }
+type FilteredDeleteRequest struct {
+	Filter
+	Confirm bool `json:"confirm,omitempty"`
+}
+
+// matcher is a parsed Filter.
+type matcher struct {
+	Filter
+	sel common.Selector
+}
+
+func (f Filter) parse() (*matcher, error) {
+	if len(f.Label) == 0 && f.Src == "" && f.Dst == "" && f.Target == "" && f.CreatedBefore == nil {
+		return nil, errors.New("at least one of 'label', 'src', 'dst', 'target' or 'createdBefore' is required")
+	}
+	for _, pat := range []string{f.Src, f.Dst, f.Target} {
+		if _, err := path.Match(pat, ""); err != nil {
+			return nil, errors.New("invalid pattern " + pat)
+		}
+	}
+	sel, err := common.ParseSelector(f.Label)
+	if err != nil {
+		return nil, err
+	}
+	if len(sel) == 0 && f.Src == "" && f.Dst == "" && f.Target == "" && f.CreatedBefore == nil {
+		return nil, errors.New("'label' must select at least one label")
+	}
+	return &matcher{Filter: f, sel: sel}, nil
+}
+
+// fields are the list fields of an entry the patterns are matched against.
+type fields struct {
+	Src    []string `json:"src"`
+	Dst    []string `json:"dst"`
+	Target []string `json:"target"`
+}
+
+func (m *matcher) matches(entry interface{}, meta common.EntryMeta) bool {
+	if m.CreatedBefore != nil && (meta.CreatedAt == nil || !meta.CreatedAt.Before(*m.CreatedBefore)) {
+		return false
+	}
+	if len(m.sel) > 0 && !m.sel.Matches(labelsOf(entry)) {
+		return false
+	}
+	var f fields
+	if b, err := json.Marshal(entry); err != nil || json.Unmarshal(b, &f) != nil {
+		return false
+	}
+	return anyMatches(m.Src, f.Src, false) && anyMatches(m.Dst, f.Dst, true) && anyMatches(m.Target, f.Target, false)
+}
+
+// anyMatches reports whether pattern matches an item of list. An empty
+// pattern matches anything.
+func anyMatches(pattern string, list []string, hostPorts bool) bool {
+	if pattern == "" {
+		return true
+	}
+	for _, item := range list {
+		if ok, _ := path.Match(pattern, item); ok {
+			return true
+		}
+		if i := strings.LastIndex(item, ":"); hostPorts && i > 0 {
+			if ok, _ := path.Match(pattern, item[:i]); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeleteFiltered => POST /<section>/_delete. It returns the matching
+// entries and, with "confirm": true, deletes them all in one write. The
+// response without "confirm" carries the ETag of the matching entries,
+// which the confirmed request's If-Match must match.
+func (s *Store[I, E]) DeleteFiltered(c *gin.Context) {
+	var req FilteredDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	m, err := req.Filter.parse()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	entries, err := s.Load(s.state)
+	if err != nil {
+		s.parseFailed(c)
+		return
+	}
+	resp := BulkDeleteResponse{Deleted: []string{}, Entries: []interface{}{}, DryRun: !req.Confirm}
+	kept := entries[:0:0]
+	var matched []E
+	for _, e := range entries {
+		if m.matches(e, s.Meta(e)) {
+			resp.Deleted = append(resp.Deleted, s.ID(e))
+			resp.Entries = append(resp.Entries, s.render(e))
+			matched = append(matched, e)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if !s.checkManaged(c, matched...) {
+		return
+	}
+	if resp.DryRun || len(resp.Deleted) == 0 {
+		s.respondMatched(c, resp, matched)
+		return
+	}
+	if !s.ifMatchAll(c, matched) {
+		return
+	}
+	if err := s.state.UpdateKeyAndSaveContext(c.Request.Context(), s.Section, kept); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to delete " + s.Plural})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// respondMatched answers a bulk delete that deletes nothing (a dry run, or
+// no matches) with the ETag of the matching entries, to send back in
+// If-Match when confirming it.
+func (s *Store[I, E]) respondMatched(c *gin.Context, resp BulkDeleteResponse, matched []E) {
+	if b, err := json.Marshal(s.renderAll(matched)); err == nil {
+		c.Header("ETag", common.ETag(b))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ifMatchAll enforces a bulk delete's If-Match precondition against the
+// entries it matched, as single-entry deletes do (see
+// common.State.IfMatch).
+func (s *Store[I, E]) ifMatchAll(c *gin.Context, matched []E) bool {
+	return s.state.IfMatch(c, "Set of matching "+s.Plural, s.renderAll(matched))
+}
+
+func (s *Store[I, E]) renderAll(entries []E) []interface{} {
+	out := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, s.render(e))
+	}
+	return out
+}
@@ -0,0 +1,557 @@
+// Package resource implements CRUD handlers for the list-shaped policy
+// sections (acls, ssh, acltests, nodeattrs): entries with a stable UUID and
+// an optional slug, stored as a JSON array under one top-level state key.
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// TotalCountHeader carries the unpaginated number of entries on list responses.
+const TotalCountHeader = "X-Total-Count"
+
+// Store serves one list section. I is the user-facing input type accepted
+// by POST and PUT, E the stored entry type (an ID plus I's fields plus
+// common.EntryMeta).
+type Store[I, E any] struct {
+	// Section is the top-level state key, e.g. "acls".
+	Section string
+	// Noun names one entry in messages, e.g. "ACL entry".
+	Noun string
+	// Plural names the section in messages, e.g. "ACLs".
+	Plural string
+	// BodyField is the key holding the entry in PUT bodies, e.g. "entry".
+	BodyField string
+
+	// Build makes the stored entry for an input, keeping id and meta.
+	Build func(id string, in I, meta common.EntryMeta) E
+	// NewID, if set, generates the ID of a created entry instead of a
+	// random UUID. IDs must be unique within the section and never change.
+	NewID func(in I) string
+	// ID and Meta read those fields back from a stored entry.
+	ID   func(E) string
+	Meta func(E) common.EntryMeta
+
+	// Normalize, if set, puts input in canonical form before it's validated
+	// and stored (see common.NormalizeList).
+	Normalize func(in *I)
+	// Validate, if set, checks (and may normalize) input before it's stored.
+	// Its error is returned to the client as a 400.
+	Validate func(in *I) error
+	// Render, if set, converts a stored entry to its response shape.
+	Render func(E) interface{}
+
+	state *common.State
+	index *common.Index[E]
+}
+
+// Init binds the store to state and prepares its read index. Call it once,
+// from the module's RegisterRoutes.
+func (s *Store[I, E]) Init(state *common.State) *Store[I, E] {
+	s.state = state
+	s.index = common.NewIndex(s.Load, s.ID, s.Section)
+	return s
+}
+
+// Load decodes the section from state. The result is the caller's own copy.
+func (s *Store[I, E]) Load(state *common.State) ([]E, error) {
+	raw := state.GetValue(s.Section)
+	if raw == nil {
+		return []E{}, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var entries []E
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// List => GET /<section>, optionally filtered with ?label= selectors and
+// paginated with ?limit= and ?offset=. Paginated responses carry the total
+// in X-Total-Count.
+func (s *Store[I, E]) List(c *gin.Context) {
+	sel, ok := s.selector(c)
+	if !ok {
+		return
+	}
+	entries, err := s.index.List(s.state)
+	if err != nil {
+		s.parseFailed(c)
+		return
+	}
+	if len(sel) > 0 {
+		entries = s.matching(entries, sel)
+	}
+
+	if c.Query("limit") != "" || c.Query("offset") != "" {
+		start, end, err := pageBounds(c, len(entries))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Header(TotalCountHeader, strconv.Itoa(len(entries)))
+		entries = entries[start:end]
+	}
+
+	out := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, s.render(e))
+	}
+	s.respond(c, http.StatusOK, out)
+}
+
+// Get => GET /<section>/:id. The ID may also be an entry's slug.
+func (s *Store[I, E]) Get(c *gin.Context) {
+	entry, ok, err := s.index.Get(s.state, c.Param("id"))
+	if err == nil && !ok {
+		entry, ok, err = s.bySlug(c.Param("id"))
+	}
+	if err != nil {
+		s.parseFailed(c)
+		return
+	}
+	if !ok {
+		s.notFound(c)
+		return
+	}
+	s.respond(c, http.StatusOK, s.render(entry))
+}
+
+// GetBySlug => GET /<section>/by-slug/:slug
+func (s *Store[I, E]) GetBySlug(c *gin.Context) {
+	entry, ok, err := s.bySlug(c.Param("slug"))
+	if err != nil {
+		s.parseFailed(c)
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: capitalize(s.Noun) + " not found with that slug"})
+		return
+	}
+	s.respond(c, http.StatusOK, s.render(entry))
+}
+
+func (s *Store[I, E]) bySlug(slug string) (E, bool, error) {
+	var zero E
+	if slug == "" {
+		return zero, false, nil
+	}
+	entries, err := s.index.List(s.state)
+	if err != nil {
+		return zero, false, err
+	}
+	for _, e := range entries {
+		if slugOf(e) == slug {
+			return e, true, nil
+		}
+	}
+	return zero, false, nil
+}
+
+// Create => POST /<section>. The body is the bare input; a new ID is generated.
+func (s *Store[I, E]) Create(c *gin.Context) {
+	var in I
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !s.applyDefaults(c, &in) || !s.validate(c, &in) {
+		return
+	}
+
+	entries, err := s.Load(s.state)
+	if err != nil {
+		s.parseFailed(c)
+		return
+	}
+	if !s.slugFree(c, entries, in, "") {
+		return
+	}
+	id := uuid.NewString()
+	if s.NewID != nil {
+		id = s.NewID(in)
+		if s.indexOf(entries, id) >= 0 {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: capitalize(s.Noun) + " " + id + " already exists"})
+			return
+		}
+	}
+	entry := s.Build(id, in, common.NewRequestMeta(c))
+	entries = append(entries, entry)
+	if err := s.state.UpdateKeyAndSaveContext(c.Request.Context(), s.Section, entries); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save " + s.Noun})
+		return
+	}
+	s.respond(c, http.StatusCreated, s.render(entry))
+}
+
+// Update => PUT /<section> with { "id": "<uuid>", "<BodyField>": {...} }.
+// The id may also be the entry's slug. An If-Match header must match the
+// entry's current ETag.
+func (s *Store[I, E]) Update(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read request body"})
+		return
+	}
+	var req map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	var id string
+	if raw, ok := req["id"]; ok {
+		if err := json.Unmarshal(raw, &id); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "'id' must be a string"})
+			return
+		}
+	}
+	if id == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'id' field"})
+		return
+	}
+	raw, ok := req[s.BodyField]
+	if !ok {
+		raw = json.RawMessage("{}")
+	}
+	var in I
+	if err := binding.JSON.BindBody(raw, &in); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !s.validate(c, &in) {
+		return
+	}
+
+	entries, err := s.Load(s.state)
+	if err != nil {
+		s.parseFailed(c)
+		return
+	}
+	i := s.indexOf(entries, id)
+	if i < 0 {
+		s.notFound(c)
+		return
+	}
+	if !s.ifMatch(c, entries[i]) || !s.checkManaged(c, entries[i]) || !s.slugFree(c, entries, in, s.ID(entries[i])) {
+		return
+	}
+	id = s.ID(entries[i])
+	entries[i] = s.Build(id, in, s.Meta(entries[i]).Touched(common.Actor(c)))
+	if err := s.state.UpdateKeyAndSaveContext(c.Request.Context(), s.Section, entries); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to update " + s.Noun})
+		return
+	}
+	s.respond(c, http.StatusOK, s.render(entries[i]))
+}
+
+// Delete => DELETE /<section> with { "id": "<uuid>" }, or the entry's slug.
+// An If-Match header must match the entry's current ETag.
+//
+// With ?label= selectors instead of a body, every matching entry is
+// deleted in one write; add ?dryRun=true to only list them. Its If-Match
+// must then match the ETag of the matching entries, as GET /<section> with
+// the same selectors returns them.
+func (s *Store[I, E]) Delete(c *gin.Context) {
+	if len(c.QueryArray("label")) > 0 {
+		s.deleteMatching(c)
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.ID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'id' field"})
+		return
+	}
+
+	entries, err := s.Load(s.state)
+	if err != nil {
+		s.parseFailed(c)
+		return
+	}
+	i := s.indexOf(entries, req.ID)
+	if i < 0 {
+		s.notFound(c)
+		return
+	}
+	if !s.ifMatch(c, entries[i]) || !s.checkManaged(c, entries[i]) {
+		return
+	}
+	entries = append(entries[:i], entries[i+1:]...)
+	if err := s.state.UpdateKeyAndSaveContext(c.Request.Context(), s.Section, entries); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to delete " + s.Noun})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": capitalize(s.Noun) + " deleted"})
+}
+
+// BulkDeleteResponse is returned by a label-selected DELETE and by POST
+// /<section>/_delete, which also returns the matching entries.
+type BulkDeleteResponse struct {
+	Deleted []string      `json:"deleted"`
+	Entries []interface{} `json:"entries,omitempty"`
+	DryRun  bool          `json:"dryRun,omitempty"`
+}
+
+func (s *Store[I, E]) deleteMatching(c *gin.Context) {
+	sel, ok := s.selector(c)
+	if !ok {
+		return
+	}
+	if len(sel) == 0 {
+		// An empty selector matches everything
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "'label' must select at least one label"})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+
+	entries, err := s.Load(s.state)
+	if err != nil {
+		s.parseFailed(c)
+		return
+	}
+	resp := BulkDeleteResponse{Deleted: []string{}, DryRun: dryRun}
+	kept := entries[:0:0]
+	var matched []E
+	for _, e := range entries {
+		if sel.Matches(labelsOf(e)) {
+			resp.Deleted = append(resp.Deleted, s.ID(e))
+			matched = append(matched, e)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if !s.checkManaged(c, matched...) {
+		return
+	}
+	if dryRun || len(resp.Deleted) == 0 {
+		s.respondMatched(c, resp, matched)
+		return
+	}
+	if !s.ifMatchAll(c, matched) {
+		return
+	}
+	if err := s.state.UpdateKeyAndSaveContext(c.Request.Context(), s.Section, kept); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to delete " + s.Plural})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// selector parses the ?label= query parameters.
+func (s *Store[I, E]) selector(c *gin.Context) (common.Selector, bool) {
+	sel, err := common.ParseSelector(c.QueryArray("label"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return nil, false
+	}
+	return sel, true
+}
+
+func (s *Store[I, E]) matching(entries []E, sel common.Selector) []E {
+	out := make([]E, 0, len(entries))
+	for _, e := range entries {
+		if sel.Matches(labelsOf(e)) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// slugOf reads the "slug" field of an input or entry, which carry it by
+// embedding common.Slugged.
+func slugOf(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	var sl common.Slugged
+	_ = json.Unmarshal(b, &sl)
+	return sl.Slug
+}
+
+// slugFree answers 409 if another entry than the one with ID self already
+// has in's slug.
+func (s *Store[I, E]) slugFree(c *gin.Context, entries []E, in I, self string) bool {
+	slug := slugOf(in)
+	if slug == "" {
+		return true
+	}
+	for _, e := range entries {
+		if s.ID(e) != self && slugOf(e) == slug {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: capitalize(s.Noun) + " " + s.ID(e) + " already has slug " + slug})
+			return false
+		}
+	}
+	return true
+}
+
+// labelsOf reads the "labels" field of an input or entry, which carry it
+// by embedding common.Labeled.
+func labelsOf(v interface{}) common.Labels {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var l common.Labeled
+	_ = json.Unmarshal(b, &l)
+	return l.Labels
+}
+
+// indexOf finds the entry with ID id or, failing that, with slug id.
+func (s *Store[I, E]) indexOf(entries []E, id string) int {
+	for i := range entries {
+		if s.ID(entries[i]) == id {
+			return i
+		}
+	}
+	for i := range entries {
+		if slug := slugOf(entries[i]); slug != "" && slug == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyDefaults stamps the request's common.EntryDefaults onto new input.
+// Input types without labels or a description are left as they are.
+func (s *Store[I, E]) applyDefaults(c *gin.Context, in *I) bool {
+	d, err := s.state.RequestDefaults(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if len(d.Labels) == 0 && d.Description == "" {
+		return true
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return true
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return true
+	}
+	d.Apply(entry)
+	if b, err = json.Marshal(entry); err == nil {
+		_ = json.Unmarshal(b, in)
+	}
+	return true
+}
+
+func (s *Store[I, E]) validate(c *gin.Context, in *I) bool {
+	if s.Normalize != nil {
+		s.Normalize(in)
+	}
+	if err := labelsOf(in).Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if err := common.ValidateSlug(slugOf(in)); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if s.Validate == nil {
+		return true
+	}
+	if err := s.Validate(in); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return false
+	}
+	return true
+}
+
+func (s *Store[I, E]) render(e E) interface{} {
+	if s.Render == nil {
+		return e
+	}
+	return s.Render(e)
+}
+
+// respond writes v with its ETag, or 304 if the client already has it.
+func (s *Store[I, E]) respond(c *gin.Context, status int, v interface{}) {
+	common.RespondETag(c, status, v)
+}
+
+// ifMatch enforces an If-Match precondition against the entry's current
+// representation (see common.State.IfMatch).
+func (s *Store[I, E]) ifMatch(c *gin.Context, current E) bool {
+	return s.state.IfMatch(c, capitalize(s.Noun), s.render(current))
+}
+
+// checkManaged answers 409 if any of entries is owned by a source other
+// than the request's (see common.State.CheckManaged).
+func (s *Store[I, E]) checkManaged(c *gin.Context, entries ...E) bool {
+	for _, e := range entries {
+		if err := s.state.CheckManaged(c, s.Meta(e)); err != nil {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: capitalize(s.Noun) + " " + s.ID(e) + " is " + err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Store[I, E]) parseFailed(c *gin.Context) {
+	c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse " + s.Plural})
+}
+
+func (s *Store[I, E]) notFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, ErrorResponse{Error: capitalize(s.Noun) + " not found with that ID"})
+}
+
+// pageBounds turns ?offset= and ?limit= into slice bounds for n entries.
+func pageBounds(c *gin.Context, n int) (int, int, error) {
+	offset, limit := 0, n
+	if v := c.Query("offset"); v != "" {
+		o, err := strconv.Atoi(v)
+		if err != nil || o < 0 {
+			return 0, 0, errors.New("'offset' must be a non-negative integer")
+		}
+		offset = o
+	}
+	if v := c.Query("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 {
+			return 0, 0, errors.New("'limit' must be a positive integer")
+		}
+		limit = l
+	}
+	if offset > n {
+		offset = n
+	}
+	end := offset + limit
+	if end > n || end < offset {
+		end = n
+	}
+	return offset, end, nil
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
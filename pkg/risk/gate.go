@@ -0,0 +1,72 @@
+package risk
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"go.uber.org/zap"
+)
+
+// BlockedResponse is returned with 422 for a mutation the gate rejected.
+type BlockedResponse struct {
+	Error     string `json:"error"`
+	Score     int    `json:"score"`
+	Threshold int    `json:"threshold"`
+	// Findings are the ones the mutation would have introduced.
+	Findings []Finding `json:"findings"`
+}
+
+// RegisterRoutes wires up GET /risk.
+//
+//	GET /risk => Report for the current policy
+func RegisterRoutes(r *gin.Engine, state *common.State, cfg Config) {
+	r.GET("/risk", func(c *gin.Context) {
+		c.JSON(http.StatusOK, Analyze(state, cfg))
+	})
+}
+
+// Middleware rejects mutations that would raise the score above
+// cfg.Threshold with 422. Changes that lower the score, or leave it as it
+// was, always go through, so an already risky policy can be fixed. It must
+// run inside common.SerializeMutations, after proposals.Middleware so held
+// changes are checked when they're approved.
+//
+// The change is checked through common.Hold: a rejected change is reverted
+// and the handler's response replaced.
+func Middleware(state *common.State, cfg Config, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Threshold <= 0 || !common.IsMutatingMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		// Sections the analysis doesn't read can't change the score
+		if section, ok := common.SectionForResource(common.FirstPathSegment(c.Request.URL.Path)); ok && !slices.Contains(Sections, section) {
+			c.Next()
+			return
+		}
+		before := Analyze(state, cfg)
+		common.Hold(c, state, Sections, logger, func() *common.Rejection {
+			after := Analyze(state, cfg)
+			if after.Score <= cfg.Threshold || after.Score <= before.Score {
+				return nil
+			}
+			logger.Warn("Rejected a change over the risk threshold",
+				zap.String("method", c.Request.Method), zap.String("path", c.Request.URL.Path),
+				zap.Int("score", after.Score), zap.Int("threshold", cfg.Threshold))
+			return &common.Rejection{
+				Status: http.StatusUnprocessableEntity,
+				Body: BlockedResponse{
+					Error: fmt.Sprintf("change would raise the policy risk score from %d to %d, above the threshold of %d",
+						before.Score, after.Score, cfg.Threshold),
+					Score:     after.Score,
+					Threshold: cfg.Threshold,
+					Findings:  Introduced(before, after),
+				},
+				Reason: "exceeded the risk threshold",
+			}
+		})
+	}
+}
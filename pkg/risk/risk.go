@@ -0,0 +1,258 @@
+// Package risk scores how permissive the policy is. Each risky pattern
+// (wildcard sources, "*:*" destinations, SSH to production without a
+// check, tags only one identity can assign) is a finding with a weight, and
+// the policy's score is their sum. Optionally, mutations that would push
+// the score over a threshold are rejected.
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// Severities, from most to least severe.
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+)
+
+// weights are what a finding of each severity adds to the score.
+var weights = map[string]int{
+	SeverityCritical: 40,
+	SeverityHigh:     20,
+	SeverityMedium:   8,
+	SeverityLow:      2,
+}
+
+// DangerAll matches every device, including ones shared in from other
+// tailnets, so it's riskier than "*".
+const DangerAll = "autogroup:danger-all"
+
+// DefaultProdTags match the tags treated as production.
+var DefaultProdTags = []string{"tag:prod*"}
+
+// Config tunes the analysis.
+type Config struct {
+	// ProdTags are path.Match patterns for production tags, e.g. "tag:prod*".
+	ProdTags []string
+	// Threshold is the score mutations may not push the policy above.
+	// 0 disables the check.
+	Threshold int
+}
+
+// Finding is one risky pattern. Path points at the entry, e.g. "acls[2]"
+// or "tagOwners.tag:prod"; list entries also carry their ID.
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Score    int    `json:"score"`
+	Path     string `json:"path"`
+	ID       string `json:"id,omitempty"`
+	Message  string `json:"message"`
+}
+
+// key identifies a finding across changes that shift list indexes.
+func (f Finding) key() string {
+	if f.ID != "" {
+		return f.Rule + "|" + f.ID
+	}
+	return f.Rule + "|" + f.Path
+}
+
+// Report is the body returned by GET /risk. Findings are ordered by score,
+// highest first.
+type Report struct {
+	Score     int       `json:"score"`
+	Threshold int       `json:"threshold,omitempty"`
+	Findings  []Finding `json:"findings"`
+}
+
+// Sections are the state keys the analysis reads.
+var Sections = []string{"acls", "ssh", "tagOwners"}
+
+type aclEntry struct {
+	ID  string   `json:"id"`
+	Src []string `json:"src"`
+	Dst []string `json:"dst"`
+}
+
+type sshEntry struct {
+	ID     string   `json:"id"`
+	Action string   `json:"action"`
+	Src    []string `json:"src"`
+	Dst    []string `json:"dst"`
+	Users  []string `json:"users"`
+}
+
+// Analyze scores the current state.
+func Analyze(state *common.State, cfg Config) Report {
+	data := make(map[string]interface{}, len(Sections))
+	for _, key := range Sections {
+		data[key] = state.GetValue(key)
+	}
+	return AnalyzeData(data, cfg)
+}
+
+// AnalyzeData scores a state (or policy file) document. Disabled and
+// expired entries don't apply, so they're skipped.
+func AnalyzeData(data map[string]interface{}, cfg Config) Report {
+	if cfg.ProdTags == nil {
+		cfg.ProdTags = DefaultProdTags
+	}
+	rep := Report{Threshold: cfg.Threshold, Findings: []Finding{}}
+	add := func(rule, severity, where, id, format string, args ...interface{}) {
+		rep.Findings = append(rep.Findings, Finding{
+			Rule:     rule,
+			Severity: severity,
+			Score:    weights[severity],
+			Path:     where,
+			ID:       id,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+	now := time.Now()
+
+	for i, raw := range entries(data["acls"]) {
+		var a aclEntry
+		if common.InactiveEntry(raw, now) || decode(raw, &a) != nil {
+			continue
+		}
+		p := fmt.Sprintf("acls[%d]", i)
+		wildSrc := contains(a.Src, "*") || contains(a.Src, DangerAll)
+		allPorts, anyHost := false, false
+		for _, d := range a.Dst {
+			host, ports := splitDst(d)
+			if host == "*" {
+				anyHost = true
+				allPorts = allPorts || ports == "*"
+			}
+		}
+		if contains(a.Src, DangerAll) {
+			add("danger-all-src", SeverityCritical, p, a.ID, "%s includes devices shared in from other tailnets", DangerAll)
+		}
+		switch {
+		case wildSrc && allPorts:
+			add("allow-all", SeverityCritical, p, a.ID, "every source may reach every port on every device")
+		case wildSrc:
+			add("wildcard-src", SeverityHigh, p, a.ID, "every source may reach %s", strings.Join(a.Dst, ", "))
+		case allPorts:
+			add("wildcard-dst", SeverityHigh, p, a.ID, "%s may reach every port on every device", strings.Join(a.Src, ", "))
+		case anyHost:
+			add("wildcard-dst-host", SeverityMedium, p, a.ID, "%s may reach every device", strings.Join(a.Src, ", "))
+		}
+	}
+
+	for i, raw := range entries(data["ssh"]) {
+		var s sshEntry
+		if common.InactiveEntry(raw, now) || decode(raw, &s) != nil {
+			continue
+		}
+		p := fmt.Sprintf("ssh[%d]", i)
+		if contains(s.Src, "*") || contains(s.Src, DangerAll) {
+			add("ssh-wildcard-src", SeverityHigh, p, s.ID, "every source may SSH to %s", strings.Join(s.Dst, ", "))
+		}
+		if s.Action == "check" {
+			continue
+		}
+		if prod := matching(s.Dst, cfg.ProdTags); len(prod) > 0 {
+			add("ssh-prod-no-check", SeverityHigh, p, s.ID, "SSH to %s is accepted without a check", strings.Join(prod, ", "))
+		}
+		if contains(s.Users, "root") {
+			add("ssh-root", SeverityMedium, p, s.ID, "SSH as root is accepted without a check")
+		}
+	}
+
+	var owners map[string][]string
+	if raw := data["tagOwners"]; raw != nil && decode(raw, &owners) == nil {
+		for tag, o := range owners {
+			if len(o) == 1 {
+				add("single-owner-tag", SeverityLow, "tagOwners."+tag, "", "only %s can assign %s", o[0], tag)
+			}
+		}
+	}
+
+	sort.SliceStable(rep.Findings, func(i, j int) bool {
+		a, b := rep.Findings[i], rep.Findings[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Path < b.Path
+	})
+	for _, f := range rep.Findings {
+		rep.Score += f.Score
+	}
+	return rep
+}
+
+// Introduced returns the findings in after that aren't in before.
+func Introduced(before, after Report) []Finding {
+	seen := make(map[string]bool, len(before.Findings))
+	for _, f := range before.Findings {
+		seen[f.key()] = true
+	}
+	out := []Finding{}
+	for _, f := range after.Findings {
+		if !seen[f.key()] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// entries decodes a list section.
+func entries(section interface{}) []map[string]interface{} {
+	var list []map[string]interface{}
+	if section == nil || decode(section, &list) != nil {
+		return nil
+	}
+	return list
+}
+
+// decode converts a state value, which may hold module types, via JSON.
+func decode(v interface{}, out interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// splitDst splits "host:ports"; a destination without ports is all host.
+func splitDst(dst string) (host, ports string) {
+	i := strings.LastIndex(dst, ":")
+	if i <= 0 {
+		return dst, ""
+	}
+	return dst[:i], dst[i+1:]
+}
+
+// matching returns the entries of list matching any of patterns.
+func matching(list, patterns []string) []string {
+	var out []string
+	for _, s := range list {
+		for _, pat := range patterns {
+			if ok, _ := path.Match(pat, s); ok {
+				out = append(out, s)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package scim
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lbrlabs/tacl/pkg/acl/groups"
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// Rule maps IdP group display names onto TACL group names. Pattern matches
+// a display name case-insensitively; a trailing "*" matches any suffix,
+// which a "*" in Target is replaced with. "tailscale-*=*" maps
+// "tailscale-eng" to "eng"; "Admins=admins" maps one group.
+type Rule struct {
+	Pattern string
+	Target  string
+}
+
+// ParseRules parses "pattern=target" pairs, e.g. from --scim-group-map.
+func ParseRules(pairs []string) ([]Rule, error) {
+	var rules []Rule
+	for _, p := range pairs {
+		pattern, target, ok := strings.Cut(p, "=")
+		pattern, target = strings.TrimSpace(pattern), strings.TrimSpace(target)
+		if !ok || pattern == "" || target == "" {
+			return nil, fmt.Errorf("invalid group mapping %q (want pattern=target)", p)
+		}
+		if strings.Contains(strings.TrimSuffix(pattern, "*"), "*") {
+			return nil, fmt.Errorf("invalid group mapping %q: '*' is only allowed at the end of the pattern", p)
+		}
+		rules = append(rules, Rule{Pattern: pattern, Target: target})
+	}
+	return rules, nil
+}
+
+// invalidNameChars are replaced when turning a display name into a group name.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// normalizeName lowercases s and replaces anything not allowed in a
+// Tailscale group name with "-".
+func normalizeName(s string) string {
+	s = invalidNameChars.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), "-")
+	return strings.Trim(s, "-")
+}
+
+// mapGroup returns the TACL group an IdP group is provisioned into. With no
+// rules every group maps to its normalized display name; otherwise the
+// first matching rule wins and unmatched groups aren't provisioned.
+func mapGroup(rules []Rule, displayName string) (string, bool) {
+	if len(rules) == 0 {
+		name := normalizeName(displayName)
+		return name, name != ""
+	}
+	lower := strings.ToLower(displayName)
+	for _, r := range rules {
+		pattern := strings.ToLower(r.Pattern)
+		var capture string
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if !strings.HasPrefix(lower, prefix) {
+				continue
+			}
+			capture = displayName[len(prefix):]
+		} else if lower != pattern {
+			continue
+		}
+		name := normalizeName(strings.ReplaceAll(r.Target, "*", capture))
+		return name, name != ""
+	}
+	return "", false
+}
+
+// apply recomputes the SCIM-managed TACL groups from st. Groups that several
+// IdP groups map to get the union of their members. Groups another source
+// owns (see common.CheckManaged) are left alone, and only groups SCIM
+// created are removed once nothing maps to them. It updates st.Managed.
+func apply(st *store, rules []Rule, existing []groups.Group) []groups.Group {
+	desired := make(map[string]map[string]bool)
+	for id, g := range st.Groups {
+		name, ok := mapGroup(rules, g.DisplayName)
+		if !ok {
+			g.TACLGroup = ""
+			st.Groups[id] = g
+			continue
+		}
+		g.TACLGroup = name
+		st.Groups[id] = g
+		if desired[name] == nil {
+			desired[name] = make(map[string]bool)
+		}
+		for _, m := range g.Members {
+			if login := st.memberLogin(m.Value); login != "" {
+				desired[name][login] = true
+			}
+		}
+	}
+
+	wasManaged := make(map[string]bool, len(st.Managed))
+	for _, name := range st.Managed {
+		wasManaged[name] = true
+	}
+
+	var out []groups.Group
+	seen := make(map[string]bool)
+	for _, g := range existing {
+		members, want := desired[g.Name]
+		switch {
+		case g.ManagedBy != "" && g.ManagedBy != Actor:
+			// Owned by e.g. terraform or edited by hand: not SCIM's to change
+			seen[g.Name] = true
+			delete(desired, g.Name)
+			out = append(out, g)
+		case want:
+			seen[g.Name] = true
+			if next := sortedSet(members); !equalMembers(g.Members, next) {
+				g.Members = next
+				g.EntryMeta = g.EntryMeta.Touched(Actor)
+			}
+			out = append(out, g)
+		case wasManaged[g.Name] && g.ManagedBy == Actor:
+			// No longer provisioned by any IdP group
+		default:
+			out = append(out, g)
+		}
+	}
+	for name, members := range desired {
+		if !seen[name] {
+			// Provisioned groups are owned by SCIM, see common.CheckManaged
+			meta := common.NewEntryMeta(Actor)
+			meta.ManagedBy = Actor
+			out = append(out, groups.Group{
+				Name:      name,
+				Members:   sortedSet(members),
+				EntryMeta: meta,
+			})
+		}
+	}
+
+	st.Managed = sortedSet(setOf(desired))
+	return out
+}
+
+func setOf[V any](m map[string]V) map[string]bool {
+	out := make(map[string]bool, len(m))
+	for k := range m {
+		out[k] = true
+	}
+	return out
+}
+
+func sortedSet(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func equalMembers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	sort.Strings(a)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
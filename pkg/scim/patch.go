@@ -0,0 +1,239 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// patchOp is one PATCH operation (RFC 7644 section 3.5.2). IdPs differ in
+// the details: Entra capitalizes ops and sends booleans as strings, Okta
+// sends path-less replaces with a value object.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+func bindPatch(c *gin.Context) ([]patchOp, bool) {
+	var req struct {
+		Schemas    []string  `json:"schemas"`
+		Operations []patchOp `json:"Operations"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		fail(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return nil, false
+	}
+	for i := range req.Operations {
+		op := strings.ToLower(req.Operations[i].Op)
+		if op != "add" && op != "remove" && op != "replace" {
+			fail(c, http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("Unsupported op %q", req.Operations[i].Op))
+			return nil, false
+		}
+		req.Operations[i].Op = op
+	}
+	return req.Operations, true
+}
+
+func invalidValue(format string, args ...interface{}) error {
+	return &scimError{scimType: "invalidValue", msg: fmt.Sprintf(format, args...)}
+}
+
+func invalidPath(path string) error {
+	return &scimError{scimType: "invalidPath", msg: fmt.Sprintf("Unsupported path %q", path)}
+}
+
+// patchUser applies op to u. Attributes TACL doesn't store are ignored.
+func patchUser(u *User, op patchOp) error {
+	if op.Path == "" {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return invalidValue("value must be an object when no path is given")
+		}
+		for attr, v := range values {
+			if err := setUserAttr(u, op.Op, attr, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setUserAttr(u, op.Op, op.Path, op.Value)
+}
+
+func setUserAttr(u *User, op, attr string, v json.RawMessage) error {
+	remove := op == "remove"
+	switch strings.ToLower(attr) {
+	case "active":
+		if remove {
+			return invalidValue("active can't be removed")
+		}
+		b, err := parseBool(v)
+		if err != nil {
+			return err
+		}
+		u.Active = b
+	case "username":
+		if remove {
+			return invalidValue("userName can't be removed")
+		}
+		s, err := parseString(v)
+		if err != nil || strings.TrimSpace(s) == "" {
+			return invalidValue("userName must be a non-empty string")
+		}
+		u.UserName = strings.TrimSpace(s)
+	case "displayname":
+		return setString(&u.DisplayName, remove, v)
+	case "externalid":
+		return setString(&u.ExternalID, remove, v)
+	case "emails":
+		if remove {
+			u.Emails = nil
+			return nil
+		}
+		var emails []Email
+		if err := json.Unmarshal(v, &emails); err != nil {
+			return invalidValue("emails must be a list")
+		}
+		if op == "add" {
+			u.Emails = append(u.Emails, emails...)
+		} else {
+			u.Emails = emails
+		}
+	}
+	return nil
+}
+
+// memberFilter matches a path selecting members by value, e.g.
+// members[value eq "2819c223"].
+var memberFilter = regexp.MustCompile(`^(?i:members)\[\s*(?i:value)\s+(?i:eq)\s+"([^"]*)"\s*\]$`)
+
+// patchGroup applies op to g.
+func patchGroup(g *Group, op patchOp) error {
+	if m := memberFilter.FindStringSubmatch(op.Path); m != nil {
+		if op.Op != "remove" {
+			return invalidPath(op.Path)
+		}
+		g.Members = removeMembers(g.Members, map[string]bool{m[1]: true})
+		return nil
+	}
+	if op.Path == "" {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return invalidValue("value must be an object when no path is given")
+		}
+		for attr, v := range values {
+			if err := setGroupAttr(g, op.Op, attr, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setGroupAttr(g, op.Op, op.Path, op.Value)
+}
+
+func setGroupAttr(g *Group, op, attr string, v json.RawMessage) error {
+	remove := op == "remove"
+	switch strings.ToLower(attr) {
+	case "members":
+		var members []Member
+		if len(v) > 0 && string(v) != "null" {
+			if err := json.Unmarshal(v, &members); err != nil {
+				return invalidValue("members must be a list of {\"value\": id}")
+			}
+		}
+		switch {
+		case remove && len(members) == 0:
+			g.Members = nil
+		case remove:
+			ids := make(map[string]bool, len(members))
+			for _, m := range members {
+				ids[m.Value] = true
+			}
+			g.Members = removeMembers(g.Members, ids)
+		case op == "add":
+			g.Members = addMembers(g.Members, members)
+		default:
+			g.Members = addMembers(nil, members)
+		}
+	case "displayname":
+		if remove {
+			return invalidValue("displayName can't be removed")
+		}
+		s, err := parseString(v)
+		if err != nil || strings.TrimSpace(s) == "" {
+			return invalidValue("displayName must be a non-empty string")
+		}
+		g.DisplayName = strings.TrimSpace(s)
+	case "externalid":
+		return setString(&g.ExternalID, remove, v)
+	default:
+		return invalidPath(attr)
+	}
+	return nil
+}
+
+// addMembers appends members not already present.
+func addMembers(have, add []Member) []Member {
+	seen := make(map[string]bool, len(have))
+	for _, m := range have {
+		seen[m.Value] = true
+	}
+	for _, m := range add {
+		if m.Value != "" && !seen[m.Value] {
+			seen[m.Value] = true
+			have = append(have, m)
+		}
+	}
+	return have
+}
+
+func removeMembers(have []Member, ids map[string]bool) []Member {
+	out := have[:0:0]
+	for _, m := range have {
+		if !ids[m.Value] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func setString(dst *string, remove bool, v json.RawMessage) error {
+	if remove {
+		*dst = ""
+		return nil
+	}
+	s, err := parseString(v)
+	if err != nil {
+		return err
+	}
+	*dst = s
+	return nil
+}
+
+func parseString(v json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return "", invalidValue("expected a string, got %s", v)
+	}
+	return s, nil
+}
+
+// parseBool accepts true/false and their string forms ("False" from Entra).
+func parseBool(v json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(v, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, invalidValue("expected a boolean, got %s", v)
+}
@@ -0,0 +1,632 @@
+// Package scim implements a SCIM 2.0 (RFC 7643/7644) service provider for
+// Users and Groups, so an IdP such as Okta or Entra ID can push group
+// membership into the groups module. IdP groups are mapped onto TACL groups
+// by Rule; members are written as the users' logins.
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// Schema URNs.
+const (
+	schemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	schemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	schemaList         = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaPatch        = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	schemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaConfig       = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	schemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// maxResults caps one page of a list response.
+const maxResults = 200
+
+// Prefix is where the endpoints are mounted.
+const Prefix = "/scim/v2"
+
+// RegisterRoutes wires up the SCIM endpoints. Callers authenticate with a
+// bearer token (see cap.TokenMiddleware), not a Tailscale identity.
+//
+//	GET                  /scim/v2/ServiceProviderConfig
+//	GET                  /scim/v2/ResourceTypes
+//	GET, POST            /scim/v2/Users, /scim/v2/Groups
+//	GET, PUT, PATCH, DEL /scim/v2/Users/:id, /scim/v2/Groups/:id
+func RegisterRoutes(r *gin.Engine, state *common.State, rules []Rule) {
+	h := &handler{state: state, rules: rules}
+	g := r.Group(Prefix)
+	{
+		g.GET("/ServiceProviderConfig", serviceProviderConfig)
+		g.GET("/ResourceTypes", resourceTypes)
+
+		g.GET("/Users", h.listUsers)
+		g.GET("/Users/:id", h.getUser)
+		g.POST("/Users", h.createUser)
+		g.PUT("/Users/:id", h.replaceUser)
+		g.PATCH("/Users/:id", h.patchUser)
+		g.DELETE("/Users/:id", h.deleteUser)
+
+		g.GET("/Groups", h.listGroups)
+		g.GET("/Groups/:id", h.getGroup)
+		g.POST("/Groups", h.createGroup)
+		g.PUT("/Groups/:id", h.replaceGroup)
+		g.PATCH("/Groups/:id", h.patchGroup)
+		g.DELETE("/Groups/:id", h.deleteGroup)
+	}
+}
+
+type handler struct {
+	state *common.State
+	rules []Rule
+}
+
+// errorResponse is the SCIM error body (RFC 7644 section 3.12).
+type errorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+func fail(c *gin.Context, status int, scimType, detail string) {
+	respond(c, status, errorResponse{
+		Schemas:  []string{schemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+func respond(c *gin.Context, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "application/scim+json", b)
+}
+
+// meta is the "meta" attribute of a resource.
+type meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+func location(c *gin.Context, kind, id string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + Prefix + "/" + kind + "/" + id
+}
+
+// ---- Users ----
+
+// userResource is the wire form of a User.
+type userResource struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Meta        *meta    `json:"meta,omitempty"`
+}
+
+func renderUser(c *gin.Context, u User) userResource {
+	active := u.Active
+	return userResource{
+		Schemas:     []string{schemaUser},
+		ID:          u.ID,
+		ExternalID:  u.ExternalID,
+		UserName:    u.UserName,
+		DisplayName: u.DisplayName,
+		Emails:      u.Emails,
+		Active:      &active,
+		Meta: &meta{
+			ResourceType: "User",
+			Created:      u.Created,
+			LastModified: u.LastModified,
+			Location:     location(c, "Users", u.ID),
+		},
+	}
+}
+
+// bindUser decodes a User body. Attributes TACL doesn't use are ignored.
+func bindUser(c *gin.Context) (userResource, bool) {
+	var in userResource
+	if err := json.NewDecoder(c.Request.Body).Decode(&in); err != nil {
+		fail(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return in, false
+	}
+	if strings.TrimSpace(in.UserName) == "" {
+		fail(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return in, false
+	}
+	return in, true
+}
+
+func (h *handler) listUsers(c *gin.Context) {
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	match, ok := parseFilter(c, map[string]func(User) string{
+		"username":    func(u User) string { return u.UserName },
+		"externalid":  func(u User) string { return u.ExternalID },
+		"id":          func(u User) string { return u.ID },
+		"displayname": func(u User) string { return u.DisplayName },
+	})
+	if !ok {
+		return
+	}
+	var users []User
+	for _, u := range st.Users {
+		if match(u) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserName < users[j].UserName })
+	list(c, users, func(u User) interface{} { return renderUser(c, u) })
+}
+
+func (h *handler) getUser(c *gin.Context) {
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	u, ok := st.Users[c.Param("id")]
+	if !ok {
+		fail(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	respond(c, http.StatusOK, renderUser(c, u))
+}
+
+func (h *handler) createUser(c *gin.Context) {
+	in, ok := bindUser(c)
+	if !ok {
+		return
+	}
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	for _, u := range st.Users {
+		if strings.EqualFold(u.UserName, in.UserName) {
+			fail(c, http.StatusConflict, "uniqueness", "User with that userName already exists")
+			return
+		}
+	}
+	now := time.Now().UTC()
+	u := User{ID: uuid.NewString(), Created: now}
+	setUser(&u, in, now)
+	st.Users[u.ID] = u
+	if !h.save(c, st) {
+		return
+	}
+	respond(c, http.StatusCreated, renderUser(c, u))
+}
+
+func (h *handler) replaceUser(c *gin.Context) {
+	in, ok := bindUser(c)
+	if !ok {
+		return
+	}
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	u, ok := st.Users[c.Param("id")]
+	if !ok {
+		fail(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	setUser(&u, in, time.Now().UTC())
+	st.Users[u.ID] = u
+	if !h.save(c, st) {
+		return
+	}
+	respond(c, http.StatusOK, renderUser(c, u))
+}
+
+func setUser(u *User, in userResource, now time.Time) {
+	u.ExternalID = in.ExternalID
+	u.UserName = strings.TrimSpace(in.UserName)
+	u.DisplayName = in.DisplayName
+	u.Emails = in.Emails
+	u.Active = in.Active == nil || *in.Active
+	u.LastModified = now
+}
+
+func (h *handler) patchUser(c *gin.Context) {
+	ops, ok := bindPatch(c)
+	if !ok {
+		return
+	}
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	u, ok := st.Users[c.Param("id")]
+	if !ok {
+		fail(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	for _, op := range ops {
+		if err := patchUser(&u, op); err != nil {
+			fail(c, http.StatusBadRequest, scimTypeOf(err), err.Error())
+			return
+		}
+	}
+	u.LastModified = time.Now().UTC()
+	st.Users[u.ID] = u
+	if !h.save(c, st) {
+		return
+	}
+	respond(c, http.StatusOK, renderUser(c, u))
+}
+
+func (h *handler) deleteUser(c *gin.Context) {
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+	if _, ok := st.Users[id]; !ok {
+		fail(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	delete(st.Users, id)
+	for gid, g := range st.Groups {
+		g.Members = removeMembers(g.Members, map[string]bool{id: true})
+		st.Groups[gid] = g
+	}
+	if !h.save(c, st) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ---- Groups ----
+
+// groupResource is the wire form of a Group.
+type groupResource struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members,omitempty"`
+	Meta        *meta    `json:"meta,omitempty"`
+}
+
+func renderGroup(c *gin.Context, g Group) groupResource {
+	out := groupResource{
+		Schemas:     []string{schemaGroup},
+		ID:          g.ID,
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Members:     g.Members,
+		Meta: &meta{
+			ResourceType: "Group",
+			Created:      g.Created,
+			LastModified: g.LastModified,
+			Location:     location(c, "Groups", g.ID),
+		},
+	}
+	// IdPs ask to leave members out when they only need the group
+	if strings.Contains(strings.ToLower(c.Query("excludedAttributes")), "members") {
+		out.Members = nil
+	}
+	return out
+}
+
+func bindGroup(c *gin.Context) (groupResource, bool) {
+	var in groupResource
+	if err := json.NewDecoder(c.Request.Body).Decode(&in); err != nil {
+		fail(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return in, false
+	}
+	if strings.TrimSpace(in.DisplayName) == "" {
+		fail(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return in, false
+	}
+	return in, true
+}
+
+func (h *handler) listGroups(c *gin.Context) {
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	match, ok := parseFilter(c, map[string]func(Group) string{
+		"displayname": func(g Group) string { return g.DisplayName },
+		"externalid":  func(g Group) string { return g.ExternalID },
+		"id":          func(g Group) string { return g.ID },
+	})
+	if !ok {
+		return
+	}
+	var out []Group
+	for _, g := range st.Groups {
+		if match(g) {
+			out = append(out, g)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DisplayName < out[j].DisplayName })
+	list(c, out, func(g Group) interface{} { return renderGroup(c, g) })
+}
+
+func (h *handler) getGroup(c *gin.Context) {
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	g, ok := st.Groups[c.Param("id")]
+	if !ok {
+		fail(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	respond(c, http.StatusOK, renderGroup(c, g))
+}
+
+func (h *handler) createGroup(c *gin.Context) {
+	in, ok := bindGroup(c)
+	if !ok {
+		return
+	}
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	for _, g := range st.Groups {
+		if strings.EqualFold(g.DisplayName, in.DisplayName) {
+			fail(c, http.StatusConflict, "uniqueness", "Group with that displayName already exists")
+			return
+		}
+	}
+	now := time.Now().UTC()
+	g := Group{ID: uuid.NewString(), Created: now}
+	setGroup(&g, in, now)
+	st.Groups[g.ID] = g
+	if !h.save(c, st) {
+		return
+	}
+	respond(c, http.StatusCreated, renderGroup(c, st.Groups[g.ID]))
+}
+
+func (h *handler) replaceGroup(c *gin.Context) {
+	in, ok := bindGroup(c)
+	if !ok {
+		return
+	}
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	g, ok := st.Groups[c.Param("id")]
+	if !ok {
+		fail(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	setGroup(&g, in, time.Now().UTC())
+	st.Groups[g.ID] = g
+	if !h.save(c, st) {
+		return
+	}
+	respond(c, http.StatusOK, renderGroup(c, st.Groups[g.ID]))
+}
+
+func setGroup(g *Group, in groupResource, now time.Time) {
+	g.ExternalID = in.ExternalID
+	g.DisplayName = strings.TrimSpace(in.DisplayName)
+	g.Members = addMembers(nil, in.Members)
+	g.LastModified = now
+}
+
+func (h *handler) patchGroup(c *gin.Context) {
+	ops, ok := bindPatch(c)
+	if !ok {
+		return
+	}
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	g, ok := st.Groups[c.Param("id")]
+	if !ok {
+		fail(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	for _, op := range ops {
+		if err := patchGroup(&g, op); err != nil {
+			fail(c, http.StatusBadRequest, scimTypeOf(err), err.Error())
+			return
+		}
+	}
+	g.LastModified = time.Now().UTC()
+	st.Groups[g.ID] = g
+	if !h.save(c, st) {
+		return
+	}
+	// Okta and Entra don't need the group back; RFC 7644 allows 204
+	c.Status(http.StatusNoContent)
+}
+
+func (h *handler) deleteGroup(c *gin.Context) {
+	st, ok := h.load(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+	if _, ok := st.Groups[id]; !ok {
+		fail(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	delete(st.Groups, id)
+	if !h.save(c, st) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ---- shared ----
+
+func (h *handler) load(c *gin.Context) (*store, bool) {
+	st, err := loadStore(h.state)
+	if err != nil {
+		fail(c, http.StatusInternalServerError, "", "Failed to parse SCIM state")
+		return nil, false
+	}
+	return st, true
+}
+
+func (h *handler) save(c *gin.Context, st *store) bool {
+	if err := save(c.Request.Context(), h.state, h.rules, st); err != nil {
+		var rej *common.Rejection
+		if errors.As(err, &rej) {
+			fail(c, rej.Status, "invalidValue", rej.Error())
+			return false
+		}
+		fail(c, http.StatusInternalServerError, "", "Failed to save SCIM changes")
+		return false
+	}
+	return true
+}
+
+// listResponse is the body of a query response (RFC 7644 section 3.4.2).
+type listResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// list writes one page of items, honoring startIndex (1-based) and count.
+func list[T any](c *gin.Context, items []T, render func(T) interface{}) {
+	start, count := 1, maxResults
+	if v := c.Query("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			fail(c, http.StatusBadRequest, "invalidValue", "startIndex must be an integer")
+			return
+		}
+		if n > 1 {
+			start = n
+		}
+	}
+	if v := c.Query("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			fail(c, http.StatusBadRequest, "invalidValue", "count must be an integer")
+			return
+		}
+		count = min(max(n, 0), maxResults)
+	}
+	from := min(start-1, len(items))
+	to := min(from+count, len(items))
+
+	out := listResponse{
+		Schemas:      []string{schemaList},
+		TotalResults: len(items),
+		StartIndex:   start,
+		Resources:    make([]interface{}, 0, to-from),
+	}
+	for _, it := range items[from:to] {
+		out.Resources = append(out.Resources, render(it))
+	}
+	out.ItemsPerPage = len(out.Resources)
+	respond(c, http.StatusOK, out)
+}
+
+// eqFilter is the one filter form IdPs use for lookups: attr eq "value".
+var eqFilter = regexp.MustCompile(`^\s*([A-Za-z.]+)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// parseFilter turns ?filter= into a predicate over attrs (keyed by
+// lowercased attribute name). Values compare case-insensitively.
+func parseFilter[T any](c *gin.Context, attrs map[string]func(T) string) (func(T) bool, bool) {
+	raw := c.Query("filter")
+	if raw == "" {
+		return func(T) bool { return true }, true
+	}
+	m := eqFilter.FindStringSubmatch(raw)
+	if m == nil {
+		fail(c, http.StatusBadRequest, "invalidFilter", "Only 'attribute eq \"value\"' filters are supported")
+		return nil, false
+	}
+	get, ok := attrs[strings.ToLower(m[1])]
+	if !ok {
+		fail(c, http.StatusBadRequest, "invalidFilter", fmt.Sprintf("Filtering on %q is not supported", m[1]))
+		return nil, false
+	}
+	var want string
+	if err := json.Unmarshal([]byte(`"`+m[2]+`"`), &want); err != nil {
+		want = m[2]
+	}
+	return func(v T) bool { return strings.EqualFold(get(v), want) }, true
+}
+
+func serviceProviderConfig(c *gin.Context) {
+	supported := func(ok bool) gin.H { return gin.H{"supported": ok} }
+	respond(c, http.StatusOK, gin.H{
+		"schemas":        []string{schemaConfig},
+		"patch":          supported(true),
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": maxResults},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Authentication with the token set by --scim-token",
+			"primary":     true,
+		}},
+	})
+}
+
+func resourceTypes(c *gin.Context) {
+	rt := func(name, endpoint, schema string) gin.H {
+		return gin.H{
+			"schemas":  []string{schemaResourceType},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+		}
+	}
+	items := []gin.H{rt("User", "/Users", schemaUser), rt("Group", "/Groups", schemaGroup)}
+	list(c, items, func(v gin.H) interface{} { return v })
+}
+
+// scimError is a patch error with its SCIM error type.
+type scimError struct {
+	scimType string
+	msg      string
+}
+
+func (e *scimError) Error() string { return e.msg }
+
+func scimTypeOf(err error) string {
+	var se *scimError
+	if errors.As(err, &se) {
+		return se.scimType
+	}
+	return ""
+}
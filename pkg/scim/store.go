@@ -0,0 +1,124 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/acl/groups"
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// stateKey holds the provisioned users and groups. The leading underscore
+// keeps it out of the synced policy.
+const stateKey = "_scim"
+
+// Actor attributes SCIM-driven changes in entry metadata and the audit log.
+const Actor = "scim"
+
+// User is a provisioned IdP user. Only the fields TACL uses are kept.
+type User struct {
+	ID           string    `json:"id"`
+	ExternalID   string    `json:"externalId,omitempty"`
+	UserName     string    `json:"userName"`
+	DisplayName  string    `json:"displayName,omitempty"`
+	Emails       []Email   `json:"emails,omitempty"`
+	Active       bool      `json:"active"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Email is one of a user's addresses.
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Login returns the Tailscale login the user appears as in group members:
+// the userName if it looks like one, else the primary (or first) email.
+func (u User) Login() string {
+	if strings.Contains(u.UserName, "@") || len(u.Emails) == 0 {
+		return u.UserName
+	}
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	return u.Emails[0].Value
+}
+
+// Group is a provisioned IdP group.
+type Group struct {
+	ID           string    `json:"id"`
+	ExternalID   string    `json:"externalId,omitempty"`
+	DisplayName  string    `json:"displayName"`
+	Members      []Member  `json:"members,omitempty"`
+	TACLGroup    string    `json:"taclGroup,omitempty"` // the TACL group it maps to, if any
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Member references a user by SCIM id.
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+// store is everything kept under stateKey.
+type store struct {
+	Users  map[string]User  `json:"users"`
+	Groups map[string]Group `json:"groups"`
+	// Managed lists the TACL groups SCIM wrote last, so groups that stop
+	// being mapped are removed.
+	Managed []string `json:"managed,omitempty"`
+}
+
+// memberLogin resolves a member value to a login: an active user's login,
+// or the value itself if it's already an email address.
+func (st *store) memberLogin(value string) string {
+	if u, ok := st.Users[value]; ok {
+		if u.Active {
+			return u.Login()
+		}
+		return ""
+	}
+	if strings.Contains(value, "@") {
+		return value
+	}
+	return ""
+}
+
+func loadStore(state *common.State) (*store, error) {
+	st := &store{}
+	if raw := state.GetValue(stateKey); raw != nil {
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, st); err != nil {
+			return nil, err
+		}
+	}
+	if st.Users == nil {
+		st.Users = make(map[string]User)
+	}
+	if st.Groups == nil {
+		st.Groups = make(map[string]Group)
+	}
+	return st, nil
+}
+
+// save recomputes the mapped TACL groups and stores them together with st,
+// in one write.
+func save(ctx context.Context, state *common.State, rules []Rule, st *store) error {
+	existing, err := groups.Load(state)
+	if err != nil {
+		return err
+	}
+	values := groups.Values(apply(st, rules, existing))
+	values[stateKey] = st
+	return state.UpdateKeysAndSaveContext(ctx, values)
+}
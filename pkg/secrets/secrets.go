@@ -0,0 +1,167 @@
+// Package secrets resolves credential references, so secrets can live in
+// HashiCorp Vault, AWS Secrets Manager or files instead of flags and env vars.
+//
+// A reference is a value with one of these schemes; anything else is a
+// literal secret and is returned unchanged:
+//
+//	file:///run/secrets/tacl                  the file's contents, trimmed
+//	vault://secret/data/tacl#client_secret    a field of a Vault secret
+//	awssm://prod/tacl#client_secret           an AWS Secrets Manager secret, or one JSON field of it
+//
+// The part after "#" selects a field. It may be left out if the secret has
+// a single field (Vault) or is a plain string (files, Secrets Manager).
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schemes of secret references.
+const (
+	SchemeFile  = "file://"
+	SchemeVault = "vault://"
+	SchemeAWSSM = "awssm://"
+)
+
+// IsRef reports whether v is a secret reference rather than a literal.
+func IsRef(v string) bool {
+	return strings.HasPrefix(v, SchemeFile) || strings.HasPrefix(v, SchemeVault) || strings.HasPrefix(v, SchemeAWSSM)
+}
+
+// Fetch resolves v, bypassing the cache. Literals are returned unchanged.
+func Fetch(ctx context.Context, v string) (string, error) {
+	location, field, _ := strings.Cut(v, "#")
+	var out string
+	var err error
+	switch {
+	case strings.HasPrefix(v, SchemeFile):
+		out, err = fetchFile(strings.TrimPrefix(location, SchemeFile), field)
+	case strings.HasPrefix(v, SchemeVault):
+		out, err = fetchVault(ctx, strings.TrimPrefix(location, SchemeVault), field)
+	case strings.HasPrefix(v, SchemeAWSSM):
+		out, err = fetchAWSSM(ctx, strings.TrimPrefix(location, SchemeAWSSM), field)
+	default:
+		return v, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", location, err)
+	}
+	return out, nil
+}
+
+type cached struct {
+	value   string
+	fetched time.Time
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]cached)
+	ttl     = 5 * time.Minute
+)
+
+// SetTTL sets how long Resolve reuses a fetched secret before fetching it
+// again, so rotated secrets are picked up. With 0 they're kept for good.
+func SetTTL(d time.Duration) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	ttl = d
+}
+
+// Resolve is Fetch with caching, for secrets read on every use (e.g. when
+// signing each webhook delivery). If a refetch fails, the last value is
+// kept and the error is returned with it.
+func Resolve(ctx context.Context, v string) (string, error) {
+	if !IsRef(v) {
+		return v, nil
+	}
+	cacheMu.Lock()
+	c, ok := cache[v]
+	fresh := ok && (ttl == 0 || time.Since(c.fetched) < ttl)
+	cacheMu.Unlock()
+	if fresh {
+		return c.value, nil
+	}
+
+	out, err := Fetch(ctx, v)
+	if err != nil {
+		return c.value, err
+	}
+	cacheMu.Lock()
+	cache[v] = cached{value: out, fetched: time.Now()}
+	cacheMu.Unlock()
+	return out, nil
+}
+
+// ResolveFields replaces every reference in the string fields of the
+// struct s points to that are tagged `secret:"true"` with the secret. It
+// reports whether there were any references.
+func ResolveFields(ctx context.Context, s interface{}) (bool, error) {
+	v := reflect.ValueOf(s).Elem()
+	var refs bool
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.Tag.Get("secret") != "true" || f.Type.Kind() != reflect.String {
+			continue
+		}
+		raw := v.Field(i).String()
+		if !IsRef(raw) {
+			continue
+		}
+		refs = true
+		out, err := Fetch(ctx, raw)
+		if err != nil {
+			return refs, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		v.Field(i).SetString(out)
+	}
+	return refs, nil
+}
+
+func fetchFile(path, field string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if field == "" {
+		return strings.TrimSpace(string(b)), nil
+	}
+	return jsonField(b, field)
+}
+
+// jsonField returns one field of a JSON object, as a string.
+func jsonField(b []byte, field string) (string, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", fmt.Errorf("selecting %q: secret is not a JSON object", field)
+	}
+	return pick(m, field)
+}
+
+// pick returns m[field], or the only value of m when field is empty.
+func pick(m map[string]interface{}, field string) (string, error) {
+	if field == "" {
+		if len(m) != 1 {
+			return "", fmt.Errorf("secret has %d fields; select one with #field", len(m))
+		}
+		for k := range m {
+			field = k
+		}
+	}
+	v, ok := m[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", field)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -0,0 +1,248 @@
+// Package server wires up the TACL API: the middleware every request goes
+// through once it's authenticated, in order, and the routes of the enabled
+// modules. tacl serve and pkg/taclitest both build their routers with it,
+// so tests run the same stack as production.
+package server
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/acl/acls"
+	"github.com/lbrlabs/tacl/pkg/acl/acltests"
+	"github.com/lbrlabs/tacl/pkg/acl/autoapprovers"
+	"github.com/lbrlabs/tacl/pkg/acl/derpmap"
+	"github.com/lbrlabs/tacl/pkg/acl/grants"
+	"github.com/lbrlabs/tacl/pkg/acl/groups"
+	"github.com/lbrlabs/tacl/pkg/acl/hosts"
+	nodeattrs "github.com/lbrlabs/tacl/pkg/acl/nodeattributes"
+	"github.com/lbrlabs/tacl/pkg/acl/postures"
+	"github.com/lbrlabs/tacl/pkg/acl/settings"
+	"github.com/lbrlabs/tacl/pkg/acl/ssh"
+	"github.com/lbrlabs/tacl/pkg/acl/tagowners"
+	"github.com/lbrlabs/tacl/pkg/anomaly"
+	"github.com/lbrlabs/tacl/pkg/audit"
+	"github.com/lbrlabs/tacl/pkg/batch"
+	"github.com/lbrlabs/tacl/pkg/cleanup"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/degraded"
+	"github.com/lbrlabs/tacl/pkg/expiry"
+	"github.com/lbrlabs/tacl/pkg/history"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"github.com/lbrlabs/tacl/pkg/proposals"
+	"github.com/lbrlabs/tacl/pkg/readonly"
+	"github.com/lbrlabs/tacl/pkg/risk"
+	"github.com/lbrlabs/tacl/pkg/simulate"
+	"github.com/lbrlabs/tacl/pkg/standby"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/lbrlabs/tacl/pkg/tailnet"
+	"github.com/lbrlabs/tacl/pkg/templates"
+	"github.com/lbrlabs/tacl/pkg/transfer"
+	"github.com/lbrlabs/tacl/pkg/validate"
+	"github.com/lbrlabs/tacl/pkg/webhooks"
+	"go.uber.org/zap"
+)
+
+// Config configures the middleware and modules. The zero value is a
+// server with default history, no approvals and no risk or anomaly checks.
+type Config struct {
+	// SSH configures the ssh module.
+	SSH ssh.Config
+	// Groups caches group expansion for the groups module. Authentication
+	// resolves groups through it too, so callers may create it first.
+	// Defaults to a new one.
+	Groups *groups.Expansion
+	// RejectDegraded rejects writes while storage can't take them, see
+	// pkg/degraded.
+	RejectDegraded bool
+
+	// AuditSinks receive every event, after the webhook, history and sync
+	// sinks. AuditBuffer events are kept in memory for GET /audit.
+	AuditSinks  []audit.Sink
+	AuditBuffer int
+	// HistoryDepth bounds per-entry versions and StateHistoryDepth
+	// whole-state snapshots; 0 keeps all, and a negative StateHistoryDepth
+	// disables snapshots.
+	HistoryDepth      int
+	StateHistoryDepth int
+
+	// RequireApproval lists the resources whose changes are held until a
+	// second identity approves them.
+	RequireApproval []string
+	Risk            risk.Config
+	Anomaly         anomaly.Config
+
+	AccessRequestMaxDuration time.Duration
+	CleanupAfter             time.Duration
+
+	// HTTPClient reaches the Tailscale API for TailnetName, for the routes
+	// that read the live policy. It's nil without credentials.
+	HTTPClient  *http.Client
+	TailnetName string
+}
+
+// Server is what New wired up. Its parts are exposed for the caller's own
+// routes and background jobs.
+type Server struct {
+	Router    *gin.Engine
+	Sync      *sync.Syncer
+	Audit     *audit.Log
+	Webhooks  *webhooks.Dispatcher
+	Groups    *groups.Expansion
+	Degraded  *degraded.Monitor
+	Anomalies *anomaly.Detector
+}
+
+// New adds the middleware to r, after what the caller already installed
+// (authentication, logging and request limits), and registers the API's
+// routes. Modules disabled in state get no routes, so their endpoints 404.
+func New(r *gin.Engine, state *common.State, cfg Config) *Server {
+	s := &Server{
+		Router:    r,
+		Sync:      sync.New(state),
+		Webhooks:  webhooks.NewDispatcher(state, state.Logger),
+		Groups:    cfg.Groups,
+		Degraded:  degraded.New(state, state.Logger),
+		Anomalies: anomaly.New(cfg.Anomaly, state.Logger),
+	}
+	if s.Groups == nil {
+		s.Groups = groups.NewExpansion(state, 0, state.Logger)
+	}
+
+	// Reject mutations while in read-only mode
+	r.Use(readonly.Middleware(state))
+	// and on a standby, until it's promoted
+	r.Use(standby.Middleware(state))
+	// and while storage can't take them
+	if cfg.RejectDegraded {
+		r.Use(degraded.Middleware(state))
+	}
+
+	// Serialize read-modify-write cycles so concurrent clients can't lose updates
+	r.Use(common.SerializeMutations(state))
+	r.Use(common.DurabilityMiddleware(state))
+
+	// Record every mutation, including ones held for approval. Webhook
+	// subscriptions receive change events via the audit log, and sync events.
+	s.Sync.Subscribe(s.Webhooks.SyncResult)
+	sinks := []audit.Sink{
+		s.Webhooks,
+		// Per-entry version history is also fed by the audit log
+		history.NewRecorder(state, cfg.HistoryDepth),
+		sync.ChangeRecorder{Syncer: s.Sync},
+	}
+	// and so are the whole-state snapshots behind GET /state/diff
+	if cfg.StateHistoryDepth >= 0 {
+		sinks = append(sinks, history.NewSnapshotter(state, cfg.StateHistoryDepth))
+	}
+	s.Audit = audit.New(cfg.AuditBuffer, append(slices.Clone(cfg.AuditSinks), sinks...), state.Logger)
+	r.Use(audit.Middleware(s.Audit, state))
+
+	// Hold changes to sensitive resources until a second identity approves them.
+	// Access requests create ACL and SSH rules, so they're held with them.
+	if len(cfg.RequireApproval) > 0 {
+		approval := slices.Clone(cfg.RequireApproval)
+		if slices.Contains(approval, "acls") || slices.Contains(approval, "ssh") {
+			approval = append(approval, "access-requests")
+		}
+		r.Use(proposals.Middleware(state, approval))
+	}
+
+	// Keep the policy from getting more permissive than allowed, including
+	// when held changes are approved
+	r.Use(risk.Middleware(state, cfg.Risk, state.Logger))
+
+	// Flag identities that suddenly rewrite a large part of the policy
+	r.Use(anomaly.Middleware(state, s.Anomalies))
+
+	registerSSH := func(r *gin.Engine, st *common.State) {
+		ssh.RegisterRoutes(r, st, cfg.SSH)
+	}
+	modules := map[string]func(*gin.Engine, *common.State){
+		"groups":        groups.RegisterRoutes,
+		"acls":          acls.RegisterRoutes,
+		"autoapprovers": autoapprovers.RegisterRoutes,
+		"derpmap":       derpmap.RegisterRoutes,
+		"acltests":      acltests.RegisterRoutes,
+		"grants":        grants.RegisterRoutes,
+		"ssh":           registerSSH,
+		"settings":      settings.RegisterRoutes,
+		"nodeattrs":     nodeattrs.RegisterRoutes,
+		"hosts":         hosts.RegisterRoutes,
+		"postures":      postures.RegisterRoutes,
+		"tagowners":     tagowners.RegisterRoutes,
+	}
+	registerModules := func(r *gin.Engine, st *common.State) {
+		for _, name := range common.Resources() {
+			if !state.ResourceDisabled(name) {
+				modules[name](r, st)
+				transfer.RegisterRoutes(r, st, name)
+			}
+		}
+	}
+	registerModules(r, state)
+	if !state.ResourceDisabled("groups") {
+		groups.RegisterSizeRoutes(r, s.Groups)
+	}
+	expiry.RegisterRoutes(r, state, cfg.AccessRequestMaxDuration)
+	cleanup.RegisterRoutes(r, state, cfg.CleanupAfter)
+	simulate.RegisterRoutes(r, state, registerModules)
+	batch.RegisterRoutes(r, state)
+	risk.RegisterRoutes(r, state, cfg.Risk)
+	readonly.RegisterRoutes(r, state)
+	proposals.RegisterRoutes(r, state)
+	audit.RegisterRoutes(r, s.Audit)
+	webhooks.RegisterRoutes(r, state)
+	templates.RegisterRoutes(r, state)
+	history.RegisterRoutes(r, state)
+	history.RegisterStateRoutes(r, state)
+	registerStateRoutes(r, state)
+
+	// Serve the live policy, and check policies and changes against it,
+	// through the caller's credentials
+	tailnet.RegisterRoutes(r, cfg.HTTPClient, cfg.TailnetName)
+	tailnet.RegisterDiffRoutes(r, state, cfg.HTTPClient, cfg.TailnetName)
+	validate.RegisterRoutes(r, state, cfg.HTTPClient, cfg.TailnetName)
+	// Pull the live policy into state
+	transfer.RegisterTailnetRoutes(r, state, cfg.HTTPClient, cfg.TailnetName)
+	return s
+}
+
+// registerStateRoutes wires up the whole-state endpoints: GET and PUT
+// /state, and the exports generated from it.
+func registerStateRoutes(r *gin.Engine, state *common.State) {
+	r.GET("/state", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := state.WriteRedactedJSON(c.Writer); err != nil {
+			state.Logger.Error("Failed to write state", zap.Error(err))
+		}
+	})
+	// Replace the policy with a whole document, e.g. pushed from CI
+	transfer.RegisterStateRoutes(r, state)
+	// Terraform configuration for adopting the current state with the provider
+	r.GET("/export/terraform", func(c *gin.Context) {
+		hcl, _ := policyfile.Terraform(state.Snapshot())
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", hcl)
+	})
+	r.GET("/export/terraform/imports", func(c *gin.Context) {
+		_, imports := policyfile.Terraform(state.Snapshot())
+		c.Data(http.StatusOK, "text/x-shellscript; charset=utf-8", policyfile.TerraformImportCommands(imports))
+	})
+	// Human-readable policy report: ?format=markdown (default) or html
+	r.GET("/export/docs", func(c *gin.Context) {
+		format := c.DefaultQuery("format", policyfile.FormatMarkdown)
+		doc, err := policyfile.Docs(state.Snapshot(), format)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		contentType := "text/markdown; charset=utf-8"
+		if format == policyfile.FormatHTML {
+			contentType = "text/html; charset=utf-8"
+		}
+		c.Data(http.StatusOK, contentType, doc)
+	})
+}
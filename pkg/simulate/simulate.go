@@ -0,0 +1,150 @@
+// Package simulate shows what a change would do before it's made. A
+// proposed mutation is replayed against a scratch copy of the state, and
+// the local evaluator compares who can reach what before and after, so
+// reviewers see the effect of a change rather than a JSON diff.
+package simulate
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/eval"
+	"github.com/lbrlabs/tacl/pkg/proposals"
+	"github.com/lbrlabs/tacl/pkg/sync"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Request is the body of POST /simulate: either a mutation, as it would be
+// sent to the API, or the ID of a pending proposal.
+//
+// Example JSON: { "method": "POST", "path": "/acls", "body": { "action": "accept", "src": ["group:dev"], "dst": ["tag:db:5432"] } }
+type Request struct {
+	Method   string          `json:"method,omitempty"`
+	Path     string          `json:"path,omitempty"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Proposal string          `json:"proposal,omitempty"`
+}
+
+// Result is the response of POST /simulate.
+type Result struct {
+	// Error is set, with 422, if the API would reject the change.
+	Error string `json:"error,omitempty"`
+	// Status and Response are what the API would answer.
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+	// The access the change would grant and revoke, if it's accepted
+	*eval.Impact
+}
+
+// RegisterRoutes wires up POST /simulate. register adds the module routes
+// to an engine for a state, the same way the server's own are added, so a
+// simulated change is handled exactly like a real one.
+func RegisterRoutes(r *gin.Engine, state *common.State, register func(*gin.Engine, *common.State)) {
+	r.POST("/simulate", func(c *gin.Context) {
+		simulate(c, state, register)
+	})
+}
+
+// simulate => POST /simulate
+func simulate(c *gin.Context, state *common.State, register func(*gin.Engine, *common.State)) {
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	id, _ := common.GetIdentity(c)
+	managedBy := common.ManagedBy(c)
+	if req.Proposal != "" {
+		p, ok, err := proposals.Get(state, req.Proposal)
+		switch {
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse proposals"})
+			return
+		case !ok:
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Proposal not found"})
+			return
+		case p.Status != proposals.StatusPending:
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "Proposal is not pending"})
+			return
+		}
+		req.Method, req.Path, req.Body = p.Method, p.Path, p.Body
+		id, managedBy = p.CreatedBy, p.ManagedBy
+	}
+	req.Method = strings.ToUpper(req.Method)
+	if !common.IsMutatingMethod(req.Method) || !strings.HasPrefix(req.Path, "/") {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "'method' (POST, PUT, PATCH or DELETE) and 'path' are required, or 'proposal'"})
+		return
+	}
+
+	scratch, err := state.Scratch()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to copy state"})
+		return
+	}
+	engine := gin.New()
+	common.ConfigureRouting(engine)
+	engine.Use(func(c *gin.Context) {
+		common.SetIdentity(c, id)
+		c.Next()
+	})
+	register(engine, scratch)
+
+	httpReq, err := http.NewRequestWithContext(c.Request.Context(), req.Method, req.Path, bytes.NewReader(req.Body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid 'path'"})
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if managedBy != "" {
+		httpReq.Header.Set(common.ManagedByHeader, managedBy)
+	}
+	rec := httptest.NewRecorder()
+	common.CanonicalPaths(engine).ServeHTTP(rec, httpReq)
+
+	res := Result{Status: rec.Code}
+	if b := bytes.TrimSpace(rec.Body.Bytes()); json.Valid(b) {
+		res.Response = json.RawMessage(b)
+	}
+	if rec.Code < 200 || rec.Code > 299 {
+		res.Error = "the change would be rejected"
+		c.JSON(http.StatusUnprocessableEntity, res)
+		return
+	}
+
+	before, err := policyOf(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build current policy"})
+		return
+	}
+	after, err := policyOf(scratch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build simulated policy"})
+		return
+	}
+	impact := eval.Compare(before, after)
+	res.Impact = &impact
+	c.JSON(http.StatusOK, res)
+}
+
+// policyOf evaluates state as it would be pushed, without disabled and
+// expired rules.
+func policyOf(state *common.State) (*eval.Policy, error) {
+	b, err := sync.PolicyJSON(state)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	return eval.FromState(data)
+}
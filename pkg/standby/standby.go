@@ -0,0 +1,217 @@
+// Package standby runs a server as a warm standby: it serves reads from a
+// copy of the state it keeps refreshing from storage, and keeps checking it
+// could take over, but doesn't accept writes, push to Tailscale or run
+// background jobs until it's promoted.
+package standby
+
+import (
+	"context"
+	"net/http"
+	gosync "sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/health"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Mode is the body shape for PUT /standby.
+//
+// Example JSON: { "standby": false }
+type Mode struct {
+	Standby bool `json:"standby"`
+}
+
+// Status is the body returned by GET /standby.
+type Status struct {
+	Standby bool      `json:"standby"`
+	Since   time.Time `json:"since"`
+	// LastRefresh is when the state was last re-read from storage.
+	LastRefresh  *time.Time `json:"lastRefresh,omitempty"`
+	RefreshError string     `json:"refreshError,omitempty"`
+	// Checks is the last run of the checks a promotion depends on.
+	Checks *health.Report `json:"checks,omitempty"`
+}
+
+// togglePath is exempt from the guard, otherwise a standby could never be promoted.
+const togglePath = "/standby"
+
+// Monitor refreshes a standby's state and checks its dependencies.
+type Monitor struct {
+	state  *common.State
+	syncer *sync.Syncer
+	checks []health.Check
+	logger *zap.Logger
+
+	mu     gosync.Mutex // guards status
+	status Status
+}
+
+// New returns a monitor for state, which runs checks while on standby and
+// has syncer push once promoted. Whether the server starts as a standby is
+// set with state.SetStandby.
+func New(state *common.State, syncer *sync.Syncer, checks []health.Check, logger *zap.Logger) *Monitor {
+	return &Monitor{
+		state:  state,
+		syncer: syncer,
+		checks: checks,
+		logger: logger,
+		status: Status{Standby: state.IsStandby(), Since: time.Now().UTC()},
+	}
+}
+
+// Start refreshes the state and runs the checks now and every interval
+// while on standby, until ctx is cancelled.
+func (m *Monitor) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		if m.state.IsStandby() {
+			m.Refresh(ctx)
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if m.state.IsStandby() {
+					m.Refresh(ctx)
+				}
+			}
+		}
+	}()
+}
+
+// Refresh re-reads the state from storage and runs the checks once. A
+// failed read keeps the state already in memory.
+func (m *Monitor) Refresh(ctx context.Context) {
+	ok, err := m.reload(ctx)
+	if !ok {
+		return
+	}
+	if err != nil {
+		m.logger.Error("Standby failed to refresh state from storage", zap.Error(err))
+	}
+	rep := health.Run(ctx, m.checks)
+	for name, res := range rep.Checks {
+		if res.Status != "ok" {
+			m.logger.Warn("Standby check failed", zap.String("check", name), zap.String("error", res.Error))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	m.status.LastRefresh = &now
+	m.status.RefreshError = ""
+	if err != nil {
+		m.status.RefreshError = err.Error()
+	}
+	m.status.Checks = &rep
+}
+
+// reload re-reads the state unless the server was promoted meanwhile, in
+// which case it may hold writes not yet in storage.
+func (m *Monitor) reload(ctx context.Context) (ok bool, err error) {
+	m.state.LockMutations()
+	defer m.state.UnlockMutations()
+	if !m.state.IsStandby() {
+		return false, nil
+	}
+	return true, m.state.Reload(ctx)
+}
+
+// Promote makes the server active. The state is re-read first so nothing
+// the previous active server saved is lost; if it can't be read, the
+// server stays on standby. A push follows right away. Callers must hold
+// LockMutations, as PUT /standby does through common.SerializeMutations.
+func (m *Monitor) Promote(ctx context.Context) error {
+	if !m.state.IsStandby() {
+		return nil
+	}
+	if err := m.state.Reload(ctx); err != nil {
+		return err
+	}
+	m.state.SetStandby(false)
+
+	m.mu.Lock()
+	m.status = Status{Standby: false, Since: time.Now().UTC()}
+	m.mu.Unlock()
+	m.logger.Info("Promoted from standby to active")
+	m.syncer.Trigger()
+	return nil
+}
+
+// Demote puts the server back on standby, e.g. when another server takes
+// over. Callers must hold LockMutations, like for Promote.
+func (m *Monitor) Demote(ctx context.Context) {
+	if m.state.IsStandby() {
+		return
+	}
+	// Writes saved in the background must reach storage before the next
+	// refresh replaces them
+	if err := m.state.FlushWrites(ctx); err != nil {
+		m.logger.Error("Failed to flush state before standby", zap.Error(err))
+	}
+	m.state.SetStandby(true)
+
+	m.mu.Lock()
+	m.status = Status{Standby: true, Since: time.Now().UTC()}
+	m.mu.Unlock()
+	m.logger.Info("Demoted to standby")
+}
+
+// Status returns the current mode and, on standby, the last refresh.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Middleware rejects mutating requests with 503 while the server is a
+// standby, so clients can retry against the active server.
+func Middleware(state *common.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if state.IsStandby() && common.IsMutatingMethod(c.Request.Method) && c.Request.URL.Path != togglePath {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, ErrorResponse{Error: "server is a standby; promote it with PUT /standby to accept writes"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RegisterRoutes wires up /standby.
+//
+//	GET /standby => Status
+//	PUT /standby => promote or demote, body { "standby": bool }
+func RegisterRoutes(r *gin.Engine, m *Monitor) {
+	r.GET(togglePath, func(c *gin.Context) {
+		c.JSON(http.StatusOK, m.Status())
+	})
+	r.PUT(togglePath, func(c *gin.Context) {
+		setMode(c, m)
+	})
+}
+
+// setMode => PUT /standby
+func setMode(c *gin.Context, m *Monitor) {
+	var req Mode
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Standby {
+		m.Demote(c.Request.Context())
+	} else if err := m.Promote(c.Request.Context()); err != nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Failed to refresh state before promotion: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, m.Status())
+}
@@ -0,0 +1,35 @@
+// Package starters holds the curated policies `tacl init` can start from.
+package starters
+
+import (
+	"embed"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Default is used when no template is chosen.
+const Default = "allow-all"
+
+//go:embed *.hujson
+var files embed.FS
+
+// Names returns the available templates, sorted.
+func Names() []string {
+	entries, _ := files.ReadDir(".")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".hujson"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the HuJSON source of the named template.
+func Get(name string) ([]byte, error) {
+	b, err := files.ReadFile(name + ".hujson")
+	if err != nil {
+		return nil, fmt.Errorf("unknown template %q (one of %s)", name, strings.Join(Names(), ", "))
+	}
+	return b, nil
+}
@@ -0,0 +1,224 @@
+package status
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/lbrlabs/tacl/pkg/version"
+	"tailscale.com/tsnet"
+)
+
+// Config describes the running server for the report.
+type Config struct {
+	Version      string
+	TS           *tsnet.Server
+	TailnetName  string
+	OAuth        bool // client ID and secret were provided
+	SyncInterval time.Duration
+	Sync         *sync.Syncer // reports pushes; POST /sync triggers one
+	PolicySize   func() (sync.PolicySize, error)
+	// CheckStorage probes the state backend. Defaults to State.CheckStorage,
+	// which writes to it every time.
+	CheckStorage func(ctx context.Context) error
+}
+
+// Build is what the Go toolchain recorded about this binary.
+type Build struct {
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// Storage reports the state backend.
+type Storage struct {
+	Backend  string `json:"backend"`
+	Location string `json:"location"`
+	Healthy  bool   `json:"healthy"`
+	Error    string `json:"error,omitempty"`
+
+	Writes    common.WriteStatus `json:"writes"`
+	Integrity common.Integrity   `json:"integrity"`
+}
+
+// Tailscale reports the tsnet node.
+type Tailscale struct {
+	BackendState string   `json:"backendState,omitempty"`
+	NodeName     string   `json:"nodeName,omitempty"`
+	DNSName      string   `json:"dnsName,omitempty"`
+	IPs          []string `json:"ips,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// Sync reports sync configuration and recent results.
+type Sync struct {
+	Enabled     bool   `json:"enabled"`
+	OAuth       bool   `json:"oauthConfigured"`
+	TailnetName string `json:"tailnet,omitempty"`
+	Interval    string `json:"interval"`
+	sync.Status
+}
+
+// Policy reports the size of the policy TACL pushes.
+type Policy struct {
+	sync.PolicySize
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the body returned by GET /status.
+type Report struct {
+	Version   string    `json:"version"`
+	Build     Build     `json:"build"`
+	StartedAt time.Time `json:"startedAt"`
+	Uptime    string    `json:"uptime"`
+	// Standby is set while this server is a standby (see GET /standby).
+	Standby   bool           `json:"standby"`
+	Storage   Storage        `json:"storage"`
+	Tailscale Tailscale      `json:"tailscale"`
+	Sync      Sync           `json:"sync"`
+	Policy    Policy         `json:"policy"`
+	Resources map[string]int `json:"resources"`
+	// Meta describes what is live on the tailnet, as in /state.
+	Meta sync.Meta `json:"_meta"`
+}
+
+var startedAt = time.Now().UTC()
+
+// RegisterRoutes wires up GET /status, GET /sync/status with just its
+// sync part, and POST /sync, which asks the sync loop to push now. POST
+// /sync needs the sync:trigger scope, and answers 503 if sync isn't
+// enabled.
+func RegisterRoutes(r *gin.Engine, state *common.State, cfg Config) {
+	r.GET("/status", func(c *gin.Context) {
+		c.JSON(http.StatusOK, Collect(c.Request.Context(), state, cfg))
+	})
+	r.GET("/sync/status", func(c *gin.Context) {
+		c.JSON(http.StatusOK, syncStatus(cfg))
+	})
+	r.POST("/sync", func(c *gin.Context) {
+		if !syncStatus(cfg).Enabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Sync is not enabled: no OAuth client or tailnet configured"})
+			return
+		}
+		cfg.Sync.Trigger()
+		c.JSON(http.StatusAccepted, gin.H{"message": "Sync triggered; see GET /sync/status for the result"})
+	})
+}
+
+func syncStatus(cfg Config) Sync {
+	return Sync{
+		Enabled:     cfg.OAuth && cfg.TailnetName != "",
+		OAuth:       cfg.OAuth,
+		TailnetName: cfg.TailnetName,
+		Interval:    cfg.SyncInterval.String(),
+		Status:      cfg.Sync.CurrentStatus(),
+	}
+}
+
+// Collect builds a status report. Failing checks are reported inline rather
+// than failing the whole report.
+func Collect(ctx context.Context, state *common.State, cfg Config) Report {
+	rep := Report{
+		Version:   cfg.Version,
+		Build:     buildInfo(),
+		StartedAt: startedAt,
+		Uptime:    time.Since(startedAt).Round(time.Second).String(),
+		Standby:   state.IsStandby(),
+		Resources: ResourceCounts(state),
+		Meta:      sync.LoadMeta(state),
+		Sync:      syncStatus(cfg),
+	}
+
+	rep.Storage = Storage{Location: state.Storage, Healthy: true, Writes: state.WriteStatus(), Integrity: state.Integrity()}
+	if i := strings.Index(state.Storage, "://"); i > 0 {
+		rep.Storage.Backend = state.Storage[:i]
+	}
+	checkStorage := cfg.CheckStorage
+	if checkStorage == nil {
+		checkStorage = state.CheckStorage
+	}
+	if err := checkStorage(ctx); err != nil {
+		rep.Storage.Healthy = false
+		rep.Storage.Error = err.Error()
+	}
+
+	rep.Tailscale = tailscaleStatus(ctx, cfg.TS)
+
+	measure := cfg.PolicySize
+	if measure == nil {
+		measure = func() (sync.PolicySize, error) { return sync.MeasurePolicy(state, 0) }
+	}
+	if size, err := measure(); err != nil {
+		rep.Policy.Error = err.Error()
+	} else {
+		rep.Policy.PolicySize = size
+	}
+	return rep
+}
+
+// ResourceCounts returns the number of entries in each section. Singleton
+// sections (settings, derpMap, autoApprovers) count as 1 when set.
+func ResourceCounts(state *common.State) map[string]int {
+	counts := make(map[string]int)
+	for _, res := range common.Resources() {
+		section, _ := common.SectionForResource(res)
+		switch v := state.GetValue(section).(type) {
+		case nil:
+			counts[section] = 0
+		case []interface{}:
+			counts[section] = len(v)
+		case map[string]interface{}:
+			if singletons[section] {
+				counts[section] = 1
+			} else {
+				counts[section] = len(v)
+			}
+		default:
+			counts[section] = 1
+		}
+	}
+	return counts
+}
+
+var singletons = map[string]bool{
+	"settings":      true,
+	"derpMap":       true,
+	"autoApprovers": true,
+}
+
+func buildInfo() Build {
+	v := version.Get("", "", "")
+	return Build{GoVersion: v.GoVersion, Revision: v.Commit, Time: v.BuildDate, Modified: v.Modified}
+}
+
+func tailscaleStatus(ctx context.Context, ts *tsnet.Server) Tailscale {
+	var out Tailscale
+	if ts == nil {
+		out.Error = "tsnet server not started"
+		return out
+	}
+	lc, err := ts.LocalClient()
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	st, err := lc.StatusWithoutPeers(ctx)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.BackendState = st.BackendState
+	if st.Self != nil {
+		out.NodeName = st.Self.HostName
+		out.DNSName = strings.TrimSuffix(st.Self.DNSName, ".")
+		for _, ip := range st.Self.TailscaleIPs {
+			out.IPs = append(out.IPs, ip.String())
+		}
+	}
+	return out
+}
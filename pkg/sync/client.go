@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// TokenURL is the Tailscale OAuth token endpoint.
+const TokenURL = "https://login.tailscale.com/api/v2/oauth/token"
+
+// ClientOptions bound outbound calls to the Tailscale admin API, so a hung
+// connection fails the call instead of stalling the caller.
+type ClientOptions struct {
+	// ConnectTimeout limits dialing and the TLS handshake.
+	ConnectTimeout time.Duration
+	// RequestTimeout limits a whole request, including reading the response.
+	RequestTimeout time.Duration
+	// MaxConnsPerHost caps concurrent connections to the API (0 = unlimited).
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an idle pooled connection is kept.
+	IdleConnTimeout time.Duration
+}
+
+// DefaultClientOptions are used by commands that don't expose the settings.
+var DefaultClientOptions = ClientOptions{
+	ConnectTimeout:  10 * time.Second,
+	RequestTimeout:  30 * time.Second,
+	MaxConnsPerHost: 4,
+	IdleConnTimeout: 90 * time.Second,
+}
+
+// NewTransport returns a pooled transport with o's timeouts applied.
+func NewTransport(o ClientOptions) *http.Transport {
+	dialer := &net.Dialer{Timeout: o.ConnectTimeout, KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   o.ConnectTimeout,
+		ResponseHeaderTimeout: o.RequestTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          o.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   o.MaxConnsPerHost,
+		MaxConnsPerHost:       o.MaxConnsPerHost,
+		IdleConnTimeout:       o.IdleConnTimeout,
+	}
+}
+
+// OAuthTransport returns a transport that authenticates with OAuth client
+// credentials. API calls and token fetches share base, so both are bounded
+// by its timeouts.
+func OAuthTransport(base http.RoundTripper, o ClientOptions, clientID, clientSecret string) http.RoundTripper {
+	creds := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     TokenURL,
+	}
+	tokenClient := &http.Client{Transport: base, Timeout: o.RequestTimeout}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, tokenClient)
+	return creds.Client(ctx).Transport
+}
+
+// NewClient returns an admin API client authenticated with OAuth client
+// credentials and bounded by o.
+func NewClient(o ClientOptions, clientID, clientSecret string) *http.Client {
+	return &http.Client{
+		Transport: OAuthTransport(NewTransport(o), o, clientID, clientSecret),
+		Timeout:   o.RequestTimeout,
+	}
+}
@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"tailscale.com/client/tailscale"
+)
+
+// Target is where policies are pushed. The Tailscale API can only replace
+// the whole policy; a target that can update sections one at a time also
+// implements SectionTarget, and is then sent only what changed.
+type Target interface {
+	// PutPolicy replaces the live policy, returning its new ETag if the
+	// target has one.
+	PutPolicy(ctx context.Context, policy []byte) (etag string, err error)
+}
+
+// SectionTarget is a Target that can update individual top-level
+// sections, e.g. a Headscale server.
+type SectionTarget interface {
+	Target
+	// PutSections sets the given sections and deletes the removed ones,
+	// leaving every other section as it is.
+	PutSections(ctx context.Context, sections map[string]json.RawMessage, removed []string) (etag string, err error)
+}
+
+// ConditionalTarget is a Target that can replace the policy only if it's
+// still the one last pushed, like the Tailscale API with If-Match.
+type ConditionalTarget interface {
+	Target
+	// PutPolicyIfMatch is PutPolicy failing with a *StaleError if the
+	// live policy's ETag isn't etag.
+	PutPolicyIfMatch(ctx context.Context, policy []byte, etag string) (string, error)
+	// GetPolicy returns the live policy, as JSON, and its ETag.
+	GetPolicy(ctx context.Context) (policy []byte, etag string, err error)
+}
+
+// TailscaleTarget pushes to a tailnet through the Tailscale API, which
+// replaces the whole policy on every push.
+func TailscaleTarget(client *tailscale.Client, tailnetName string) Target {
+	return tailscaleTarget{client: client, tailnet: tailnetName}
+}
+
+type tailscaleTarget struct {
+	client  *tailscale.Client
+	tailnet string
+}
+
+func (t tailscaleTarget) PutPolicy(ctx context.Context, policy []byte) (string, error) {
+	return putACL(ctx, t.client, t.tailnet, policy, "")
+}
+
+func (t tailscaleTarget) PutPolicyIfMatch(ctx context.Context, policy []byte, etag string) (string, error) {
+	tag, err := putACL(ctx, t.client, t.tailnet, policy, etag)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusPreconditionFailed {
+		return "", &StaleError{}
+	}
+	return tag, err
+}
+
+func (t tailscaleTarget) GetPolicy(ctx context.Context) ([]byte, string, error) {
+	if t.client.HTTPClient == nil {
+		return nil, "", errors.New("tsAdminClient.HTTPClient is nil; cannot make admin API requests")
+	}
+	return fetchRemote(ctx, t.client.HTTPClient, t.tailnet)
+}
+
+// SectionDelta is how a policy differs, section by section, from the one
+// last pushed.
+type SectionDelta struct {
+	// Changed are the sections added or modified, Removed those no longer
+	// in the policy. Both are sorted.
+	Changed []string `json:"changed,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Empty reports whether no section changed.
+func (d SectionDelta) Empty() bool { return len(d.Changed) == 0 && len(d.Removed) == 0 }
+
+// Sections returns every section that changed or was removed, sorted.
+func (d SectionDelta) Sections() []string {
+	out := append(append([]string{}, d.Changed...), d.Removed...)
+	sort.Strings(out)
+	return out
+}
+
+// sectionHashes splits a policy into its top-level sections, returning
+// each one's JSON and SHA-256.
+func sectionHashes(policy map[string]interface{}) (map[string]json.RawMessage, map[string]string, error) {
+	raw := make(map[string]json.RawMessage, len(policy))
+	sums := make(map[string]string, len(policy))
+	for k, v := range policy {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		sum := sha256.Sum256(b)
+		raw[k], sums[k] = b, hex.EncodeToString(sum[:])
+	}
+	return raw, sums, nil
+}
+
+// compareSections returns the delta from the prev section hashes to cur.
+// Without prev every section counts as changed.
+func compareSections(prev, cur map[string]string) SectionDelta {
+	var d SectionDelta
+	for k, sum := range cur {
+		if prev[k] != sum {
+			d.Changed = append(d.Changed, k)
+		}
+	}
+	for k := range prev {
+		if _, ok := cur[k]; !ok {
+			d.Removed = append(d.Removed, k)
+		}
+	}
+	sort.Strings(d.Changed)
+	sort.Strings(d.Removed)
+	return d
+}
+
+func (s *Syncer) setBaseline(sums map[string]string, etag string) {
+	s.baselineMu.Lock()
+	defer s.baselineMu.Unlock()
+	s.baseline, s.baselineETag = sums, etag
+}
+
+func (s *Syncer) currentBaseline(stored *Applied) (map[string]string, string) {
+	s.baselineMu.Lock()
+	defer s.baselineMu.Unlock()
+	if s.baseline == nil && stored != nil {
+		return stored.Sections, stored.ETag
+	}
+	return s.baseline, s.baselineETag
+}
@@ -0,0 +1,229 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tailscale/hujson"
+	"go.uber.org/zap"
+)
+
+// Drift modes: what the sync loop does when the live policy was changed
+// since its last push, e.g. in the admin console.
+const (
+	DriftOverwrite = "overwrite" // push without checking, reverting the change
+	DriftWarn      = "warn"      // log the drift, then push anyway
+	DriftRefuse    = "refuse"    // don't push until the drift is resolved
+	DriftMerge     = "merge"     // pull the changed sections into state, refusing on conflicts
+)
+
+// Drift is how the live policy differs from the one last pushed.
+type Drift struct {
+	DetectedAt time.Time `json:"detectedAt"`
+	// Remote and LastPushed are the SHA-256 of the live policy and of the
+	// one last pushed, as TACL encodes policies.
+	Remote     string `json:"remote"`
+	LastPushed string `json:"lastPushed,omitempty"`
+	// ETag is the live policy's.
+	ETag string `json:"etag,omitempty"`
+	// Sections are the top-level policy keys changed on the tailnet that
+	// the next push would revert, sorted.
+	Sections []string `json:"sections"`
+	// Conflicts are those of Sections that changed in state too, or all of
+	// them if the last push didn't record its sections.
+	Conflicts []string `json:"conflicts,omitempty"`
+
+	// Policy is the live policy, as JSON.
+	Policy []byte `json:"-"`
+}
+
+// DriftPolicy configures the drift check of the sync loop.
+type DriftPolicy struct {
+	Mode string
+	// Merge pulls the sections of d from its Policy into state, for
+	// DriftMerge. It's only called for drift without conflicts.
+	Merge func(ctx context.Context, d *Drift) error
+}
+
+// SetDriftPolicy sets what the sync loop does about drift. Call it once,
+// before Start.
+func (s *Syncer) SetDriftPolicy(p DriftPolicy) error {
+	switch p.Mode {
+	case DriftOverwrite, DriftWarn, DriftRefuse:
+	case DriftMerge:
+		if p.Merge == nil {
+			return errors.New("drift mode merge needs a Merge func")
+		}
+	default:
+		return fmt.Errorf("unknown drift mode %q", p.Mode)
+	}
+	s.driftMu.Lock()
+	defer s.driftMu.Unlock()
+	s.driftPolicy = p
+	return nil
+}
+
+func (s *Syncer) currentDriftPolicy() DriftPolicy {
+	s.driftMu.Lock()
+	defer s.driftMu.Unlock()
+	return s.driftPolicy
+}
+
+// DetectDrift fetches the live policy and compares it, section by section,
+// with the one last pushed and with state. It returns nil if nothing was
+// pushed yet, or if no section changed on the tailnet that the next push
+// would revert.
+func (s *Syncer) DetectDrift(ctx context.Context, httpClient *http.Client, tailnetName string) (*Drift, error) {
+	if LoadMeta(s.state).LastApplied == nil {
+		return nil, nil
+	}
+	live, etag, err := fetchRemote(ctx, httpClient, tailnetName)
+	if err != nil {
+		return nil, err
+	}
+	return s.detectDrift(live, etag)
+}
+
+// detectDrift is DetectDrift for a live policy already fetched.
+func (s *Syncer) detectDrift(live []byte, etag string) (*Drift, error) {
+	applied := LoadMeta(s.state).LastApplied
+	if applied == nil {
+		return nil, nil
+	}
+	base, _ := s.currentBaseline(applied)
+
+	std, err := hujson.Standardize(live)
+	if err != nil {
+		return nil, fmt.Errorf("the tailnet policy does not parse: %w", err)
+	}
+	var remote map[string]interface{}
+	if err := json.Unmarshal(std, &remote); err != nil {
+		return nil, errors.New("the tailnet policy is not a JSON object")
+	}
+	_, remoteSums, err := sectionHashes(remote)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := buildPolicy(s.state)
+	if err != nil {
+		return nil, fmt.Errorf("building the policy: %w", err)
+	}
+	_, localSums, err := sectionHashes(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Drift{DetectedAt: time.Now().UTC(), LastPushed: applied.SHA256, ETag: etag, Policy: std}
+	keys := make(map[string]bool)
+	for k := range remoteSums {
+		keys[k] = true
+	}
+	for k := range base {
+		keys[k] = true
+	}
+	for k := range keys {
+		if base != nil && remoteSums[k] == base[k] || sameEntries(remote[k], policy[k]) {
+			continue
+		}
+		d.Sections = append(d.Sections, k)
+		if base == nil || localSums[k] != base[k] {
+			d.Conflicts = append(d.Conflicts, k)
+		}
+	}
+	if len(d.Sections) == 0 {
+		return nil, nil
+	}
+	sort.Strings(d.Sections)
+	sort.Strings(d.Conflicts)
+	encoded, err := encodePolicy(remote)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(encoded))
+	d.Remote = hex.EncodeToString(sum[:])
+	return d, nil
+}
+
+// sameEntries reports whether two policy sections are equal, ignoring the
+// order of list entries, which TACL sets by priority itself.
+func sameEntries(a, b interface{}) bool {
+	la, okA := a.([]interface{})
+	lb, okB := b.([]interface{})
+	if !okA || !okB {
+		return reflect.DeepEqual(a, b)
+	}
+	if len(la) != len(lb) {
+		return false
+	}
+	encode := func(list []interface{}) []string {
+		out := make([]string, len(list))
+		for i, v := range list {
+			b, _ := json.Marshal(v)
+			out[i] = string(b)
+		}
+		sort.Strings(out)
+		return out
+	}
+	return slices.Equal(encode(la), encode(lb))
+}
+
+// checkDrift applies the drift policy before a push by the sync loop, and
+// reports whether to go ahead with it. A refused push is recorded as a
+// failed one, with the drift.
+func (s *Syncer) checkDrift(ctx context.Context, httpClient *http.Client, tailnetName string) bool {
+	p := s.currentDriftPolicy()
+	if p.Mode == DriftOverwrite {
+		return true
+	}
+	d, err := s.DetectDrift(ctx, httpClient, tailnetName)
+	if err != nil {
+		if p.Mode == DriftWarn {
+			s.state.Logger.Warn("Could not check the tailnet policy for drift; pushing anyway", zap.Error(err))
+			return true
+		}
+		s.state.Logger.Error("Could not check the tailnet policy for drift; skipping ACL push", zap.Error(err))
+		s.record(Result{Time: time.Now().UTC(), Error: "checking for drift: " + err.Error()})
+		return false
+	}
+	if d == nil {
+		return true
+	}
+
+	fields := []zap.Field{zap.Strings("sections", d.Sections), zap.Strings("conflicts", d.Conflicts), zap.String("remote", d.Remote)}
+	switch {
+	case p.Mode == DriftWarn:
+		s.state.Logger.Warn("The tailnet policy changed since the last push; overwriting it", fields...)
+		return true
+	case p.Mode == DriftMerge && len(d.Conflicts) == 0:
+		// Merge's imports are internal requests, which skip
+		// SerializeMutations, so hold API writes back until it's done
+		s.state.LockMutations()
+		err := p.Merge(ctx, d)
+		s.state.UnlockMutations()
+		if err != nil {
+			s.state.Logger.Error("Failed to merge the tailnet policy into state; skipping ACL push", append(fields, zap.Error(err))...)
+			s.record(Result{Time: time.Now().UTC(), Error: "merging drift: " + err.Error(), Drift: d})
+			return false
+		}
+		s.state.Logger.Info("Merged changes to the tailnet policy into state", fields...)
+		return true
+	}
+
+	msg := "the tailnet policy changed since the last push: " + strings.Join(d.Sections, ", ")
+	if p.Mode == DriftMerge {
+		msg += "; conflicting with state: " + strings.Join(d.Conflicts, ", ")
+	}
+	s.state.Logger.Warn("The tailnet policy changed since the last push; skipping ACL push", fields...)
+	s.record(Result{Time: time.Now().UTC(), Error: msg, Drift: d})
+	return false
+}
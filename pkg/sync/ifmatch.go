@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// If-Match modes: whether a push is conditional on the live policy still
+// having the ETag of the last push, and what happens when it doesn't.
+const (
+	IfMatchOff       = "off"       // pushes are unconditional
+	IfMatchRefuse    = "refuse"    // the push fails if it would revert a change
+	IfMatchOverwrite = "overwrite" // the push is retried unconditionally
+)
+
+// StaleError is returned by a push that failed If-Match: the live policy
+// changed since the last push.
+type StaleError struct {
+	// Drift is what the push would have reverted, if it was checked.
+	Drift *Drift
+}
+
+func (e *StaleError) Error() string {
+	if e.Drift == nil {
+		return "the tailnet policy changed since the last push"
+	}
+	return "the tailnet policy changed since the last push: " + strings.Join(e.Drift.Sections, ", ")
+}
+
+// SetIfMatch sets whether pushes that replace the whole policy send the
+// ETag of the last push with If-Match. Call it once, before pushing.
+func (s *Syncer) SetIfMatch(mode string) error {
+	switch mode {
+	case IfMatchOff, IfMatchRefuse, IfMatchOverwrite:
+	default:
+		return fmt.Errorf("unknown If-Match mode %q", mode)
+	}
+	s.ifMatchMu.Lock()
+	defer s.ifMatchMu.Unlock()
+	s.ifMatchMode = mode
+	return nil
+}
+
+func (s *Syncer) currentIfMatch() string {
+	s.ifMatchMu.Lock()
+	defer s.ifMatchMu.Unlock()
+	return s.ifMatchMode
+}
+
+// putPolicy replaces the live policy, on a ConditionalTarget only if its
+// ETag is still etag. In IfMatchRefuse a mismatch is looked into: if state
+// already has every change made on the tailnet, the push is retried with
+// the live ETag, and otherwise it fails with a *StaleError.
+func (s *Syncer) putPolicy(ctx context.Context, target Target, policy []byte, etag string) (string, error) {
+	mode := s.currentIfMatch()
+	ct, ok := target.(ConditionalTarget)
+	if mode == IfMatchOff || !ok || etag == "" {
+		return target.PutPolicy(ctx, policy)
+	}
+	tag, err := ct.PutPolicyIfMatch(ctx, policy, etag)
+	var stale *StaleError
+	if !errors.As(err, &stale) {
+		return tag, err
+	}
+	if mode == IfMatchOverwrite {
+		s.state.Logger.Warn("The tailnet policy changed since the last push; overwriting it", zap.String("etag", etag))
+		return target.PutPolicy(ctx, policy)
+	}
+
+	live, liveTag, err := ct.GetPolicy(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%w (and fetching it failed: %v)", stale, err)
+	}
+	d, err := s.detectDrift(live, liveTag)
+	if err != nil {
+		return "", fmt.Errorf("%w (and comparing it failed: %v)", stale, err)
+	}
+	if d != nil {
+		return "", &StaleError{Drift: d}
+	}
+	s.state.Logger.Info("The tailnet policy changed since the last push, but state has the changes; pushing", zap.String("etag", liveTag))
+	return ct.PutPolicyIfMatch(ctx, policy, liveTag)
+}
@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/audit"
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// MetaKey is the state key holding metadata about what is live on the
+// tailnet. Like every "_" key, it's never pushed.
+const MetaKey = "_meta"
+
+// Meta is the "_meta" section, also reported by GET /status.
+type Meta struct {
+	LastApplied *Applied `json:"lastApplied,omitempty"`
+}
+
+// Applied describes the policy last pushed successfully by the sync loop.
+type Applied struct {
+	// Time is when this policy was first pushed. Later pushes of the same
+	// policy don't change it; see the sync status for the latest push.
+	Time time.Time `json:"time"`
+	// ETag is Tailscale's ETag for the policy, as used with If-Match on
+	// its ACL API.
+	ETag string `json:"etag,omitempty"`
+	// SHA256 is the hash of the policy JSON as pushed.
+	SHA256 string `json:"sha256"`
+	Bytes  int    `json:"bytes"`
+	// Actor made the last change included in the policy, at ChangedAt.
+	// It's unknown for changes made before the server last started.
+	Actor     string     `json:"actor,omitempty"`
+	ChangedAt *time.Time `json:"changedAt,omitempty"`
+	// Sections holds the SHA-256 of each top-level section, to tell which
+	// sections the next push changes.
+	Sections map[string]string `json:"sections,omitempty"`
+}
+
+// ChangeRecorder is an audit sink noting who made the latest change, so
+// it can be credited in "_meta" once the change is pushed.
+type ChangeRecorder struct {
+	Syncer *Syncer
+}
+
+// Write implements audit.Sink.
+func (r ChangeRecorder) Write(e audit.Event) error {
+	if e.Outcome != audit.OutcomeSuccess || e.Diff == nil && len(e.Sections) == 0 {
+		return nil
+	}
+	t := e.Time
+	r.Syncer.changeMu.Lock()
+	r.Syncer.lastActor, r.Syncer.lastAt = e.Actor, &t
+	r.Syncer.changeMu.Unlock()
+	return nil
+}
+
+// LoadMeta returns the "_meta" section.
+func LoadMeta(state *common.State) Meta {
+	var m Meta
+	raw := state.GetValue(MetaKey)
+	if raw == nil {
+		return m
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return m
+	}
+	_ = json.Unmarshal(b, &m)
+	return m
+}
+
+// lastChange returns who made the latest change, and when.
+func (s *Syncer) lastChange() (string, *time.Time) {
+	s.changeMu.Lock()
+	defer s.changeMu.Unlock()
+	return s.lastActor, s.lastAt
+}
+
+// saveApplied records a successful push in "_meta", crediting the change
+// to actor. State is only written when the policy or its ETag changed.
+func saveApplied(state *common.State, r Result, actor string, changedAt *time.Time) error {
+	unlock := state.LockSection(MetaKey)
+	defer unlock()
+
+	m := LoadMeta(state)
+	if prev := m.LastApplied; prev != nil && prev.SHA256 == r.SHA256 && prev.ETag == r.ETag && (prev.Sections != nil || r.sections == nil) {
+		return nil
+	}
+	m.LastApplied = &Applied{
+		Time:      r.Time,
+		ETag:      r.ETag,
+		SHA256:    r.SHA256,
+		Bytes:     r.Bytes,
+		Actor:     actor,
+		ChangedAt: changedAt,
+		Sections:  r.sections,
+	}
+	return state.UpdateKeyAndSave(MetaKey, m)
+}
@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// FetchRemote returns the policy currently applied to the tailnet, as JSON.
+func FetchRemote(ctx context.Context, httpClient *http.Client, tailnetName string) ([]byte, error) {
+	policy, _, err := fetchRemote(ctx, httpClient, tailnetName)
+	return policy, err
+}
+
+// fetchRemote is FetchRemote, also returning the policy's ETag.
+func fetchRemote(ctx context.Context, httpClient *http.Client, tailnetName string) ([]byte, string, error) {
+	path := fmt.Sprintf("https://api.tailscale.com/api/v2/tailnet/%s/acl", tailnetName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("creating GET request for %s: %w", path, err)
+	}
+	// Without this Tailscale answers with the HuJSON as written, comments and all
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("GET %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", &APIError{Method: http.MethodGet, Path: path, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, resp.Header.Get("ETag"), nil
+}
@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"encoding/json"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// PolicySize describes how large the pushed policy is, overall and per
+// top-level section, relative to the Tailscale policy size limit.
+type PolicySize struct {
+	Bytes          int            `json:"bytes"`
+	Sections       map[string]int `json:"sections"`
+	Limit          int            `json:"limit,omitempty"`
+	PercentOfLimit float64        `json:"percentOfLimit,omitempty"`
+}
+
+// MeasurePolicy measures the policy as it would be pushed. A limit of 0
+// leaves the percentage unset.
+func MeasurePolicy(state *common.State, limit int) (PolicySize, error) {
+	cleaned, err := buildPolicy(state)
+	if err != nil {
+		return PolicySize{}, err
+	}
+	// Sizes are of the compact JSON that is pushed. The whole document is
+	// its sections plus braces, quoted keys, colons and commas.
+	size := PolicySize{Bytes: 2, Sections: make(map[string]int), Limit: limit}
+	for k, v := range cleaned {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return PolicySize{}, err
+		}
+		key, _ := json.Marshal(k)
+		size.Sections[k] = len(b)
+		size.Bytes += len(key) + 1 + len(b)
+	}
+	if n := len(cleaned); n > 1 {
+		size.Bytes += n - 1
+	}
+	if limit > 0 {
+		size.PercentOfLimit = float64(size.Bytes) * 100 / float64(limit)
+	}
+	return size, nil
+}
@@ -0,0 +1,76 @@
+package sync
+
+import "time"
+
+// Result is the outcome of a single push attempt. Rejected is set when
+// Tailscale refused the policy itself rather than the push failing.
+type Result struct {
+	Time     time.Time `json:"time"`
+	Bytes    int       `json:"bytes,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Rejected bool      `json:"rejected,omitempty"`
+	// ETag and SHA256 identify the policy after a successful push.
+	ETag   string `json:"etag,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Delta lists the sections that differ from the last policy pushed,
+	// all of them for the first push. Partial is set when only those were
+	// sent, to a SectionTarget.
+	Delta   *SectionDelta `json:"delta,omitempty"`
+	Partial bool          `json:"partial,omitempty"`
+	// Drift is set when the push was held back because the live policy
+	// changed since the last one, see SetDriftPolicy. Stale is set when
+	// it failed If-Match for that reason, see SetIfMatch.
+	Drift *Drift `json:"drift,omitempty"`
+	Stale bool   `json:"stale,omitempty"`
+
+	// sections are the section hashes of the policy pushed, for "_meta"
+	sections map[string]string
+}
+
+// OK reports whether the push succeeded.
+func (r Result) OK() bool { return r.Error == "" }
+
+// Status summarizes recent push attempts.
+type Status struct {
+	LastAttempt         *Result    `json:"lastAttempt,omitempty"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	// Window is set when pushes are limited to a schedule, see
+	// SetSchedule.
+	Window *WindowStatus `json:"window,omitempty"`
+}
+
+// Subscribe registers fn to be called after every push attempt.
+func (s *Syncer) Subscribe(fn func(Result)) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// CurrentStatus returns a copy of the current sync status.
+func (s *Syncer) CurrentStatus() Status {
+	s.statusMu.RLock()
+	st := s.status
+	s.statusMu.RUnlock()
+	st.Window = s.windowStatus(time.Now().UTC())
+	return st
+}
+
+func (s *Syncer) record(r Result) {
+	s.statusMu.Lock()
+	s.status.LastAttempt = &r
+	if r.OK() {
+		t := r.Time
+		s.status.LastSuccess = &t
+		s.status.ConsecutiveFailures = 0
+	} else {
+		s.status.ConsecutiveFailures++
+	}
+	subs := make([]func(Result), len(s.subscribers))
+	copy(subs, s.subscribers)
+	s.statusMu.Unlock()
+
+	for _, fn := range subs {
+		fn(r)
+	}
+}
@@ -3,10 +3,15 @@ package sync
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	gosync "sync"
 	"time"
 
 	"github.com/lbrlabs/tacl/pkg/common"
@@ -14,77 +19,344 @@ import (
 	"tailscale.com/client/tailscale"
 )
 
+// Syncer pushes one server's state to Tailscale. It keeps what the sync
+// loop needs between pushes: the status and its subscribers, the sections
+// last pushed, the drift, If-Match and window settings, and who made the
+// latest change.
+type Syncer struct {
+	state *common.State
+	// trigger requests a push ahead of the next tick. It holds at most one
+	// request, so triggers during a push coalesce into one more push.
+	trigger chan struct{}
+
+	statusMu    gosync.RWMutex
+	status      Status
+	subscribers []func(Result)
+
+	baselineMu gosync.Mutex
+	// baseline holds the section hashes and ETag of the policy last pushed
+	// by this Syncer; until the first push they're read from "_meta".
+	baseline     map[string]string
+	baselineETag string
+
+	driftMu     gosync.Mutex
+	driftPolicy DriftPolicy
+
+	ifMatchMu   gosync.Mutex
+	ifMatchMode string
+
+	changeMu  gosync.Mutex
+	lastActor string
+	lastAt    *time.Time
+
+	windowMu     gosync.Mutex
+	schedule     Schedule
+	pendingSince *time.Time
+}
+
+// New returns a Syncer for state. Until configured it overwrites drift,
+// doesn't send If-Match and may push at any time.
+func New(state *common.State) *Syncer {
+	return &Syncer{
+		state:       state,
+		trigger:     make(chan struct{}, 1),
+		driftPolicy: DriftPolicy{Mode: DriftOverwrite},
+		ifMatchMode: IfMatchOff,
+	}
+}
+
 // Start sets up a background goroutine that periodically pushes
-// local ACL data to Tailscale.
-func Start(state *common.State, tsAdminClient *tailscale.Client, tailnetName string, interval time.Duration) {
+// local ACL data to Tailscale until ctx is cancelled. Cancelling ctx also
+// aborts a push in flight.
+func (s *Syncer) Start(ctx context.Context, tsAdminClient *tailscale.Client, tailnetName string, interval time.Duration) {
 	if tsAdminClient == nil {
-		state.Logger.Warn("tsAdminClient is nil, skipping ACL sync")
+		s.state.Logger.Warn("tsAdminClient is nil, skipping ACL sync")
 		return
 	}
 	if tailnetName == "" {
-		state.Logger.Warn("tailnetName is empty, skipping ACL sync")
+		s.state.Logger.Warn("tailnetName is empty, skipping ACL sync")
 		return
 	}
 
+	// Every push that succeeds is recorded in "_meta". A standby doesn't
+	// push until it's promoted, and while storage is degraded only what's
+	// already in storage is pushed. Outside the sync window changes are
+	// held back until it opens. Changes made on the tailnet since the last
+	// push are handled by the drift policy first.
+	push := func() {
+		if s.state.IsStandby() {
+			return
+		}
+		if now := time.Now().UTC(); !s.InWindow(now) {
+			policyJSON, err := buildTailscaleACLJSON(s.state)
+			sum := sha256.Sum256([]byte(policyJSON))
+			applied := LoadMeta(s.state).LastApplied
+			pending := err == nil && policyJSON != "{}" && (applied == nil || applied.SHA256 != hex.EncodeToString(sum[:]))
+			if s.deferPush(now, pending) {
+				s.state.Logger.Info("Outside the sync window; holding back changes until it opens",
+					zap.Time("nextOpen", s.NextWindow(now)))
+			}
+			return
+		}
+		if ws := s.state.WriteStatus(); s.state.IsDegraded() && ws.Persisted < ws.Seq {
+			s.state.Logger.Warn("Storage is degraded and behind memory; skipping ACL push")
+			return
+		}
+		if !s.checkDrift(ctx, tsAdminClient.HTTPClient, tailnetName) {
+			return
+		}
+		actor, changedAt := s.lastChange()
+		if s.Push(ctx, tsAdminClient, tailnetName) != nil {
+			return
+		}
+		s.clearPending()
+		if r := s.CurrentStatus().LastAttempt; r != nil && r.OK() {
+			if err := saveApplied(s.state, *r, actor, changedAt); err != nil {
+				s.state.Logger.Error("Failed to record applied policy", zap.Error(err))
+			}
+		}
+	}
+
 	// do one immediate push
-	Push(state, tsAdminClient, tailnetName)
+	push()
 
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			Push(state, tsAdminClient, tailnetName)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				push()
+			case <-s.trigger:
+				push()
+				ticker.Reset(interval)
+			}
 		}
 	}()
 }
 
-// Push => build a Tailscale-friendly JSON, then post it to Tailscale
-func Push(state *common.State, tsAdminClient *tailscale.Client, tailnetName string) {
-	policyJSON, err := buildTailscaleACLJSON(state)
+// Trigger asks the sync loop started by Start to push now, e.g. after a
+// change that must take effect promptly. It never blocks, and does nothing
+// if sync isn't running.
+func (s *Syncer) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// ErrEmptyState is returned by Push when there is nothing to push.
+var ErrEmptyState = errors.New("local state is empty")
+
+// Push => build a Tailscale-friendly JSON, then post it to Tailscale.
+// The returned error is also recorded in the sync status, unless ctx was
+// cancelled (e.g. at shutdown).
+func (s *Syncer) Push(ctx context.Context, tsAdminClient *tailscale.Client, tailnetName string) error {
+	return s.PushTo(ctx, TailscaleTarget(tsAdminClient, tailnetName))
+}
+
+// PushTo is Push to any target. The sections that changed since the last
+// successful push are reported in the result; a SectionTarget is sent
+// only those, or nothing if none changed.
+func (s *Syncer) PushTo(ctx context.Context, target Target) error {
+	policy, err := buildPolicy(s.state)
+	var policyJSON string
+	if err == nil {
+		policyJSON, err = encodePolicy(policy)
+	}
+	var sections map[string]json.RawMessage
+	var sums map[string]string
+	if err == nil {
+		sections, sums, err = sectionHashes(policy)
+	}
 	if err != nil {
-		state.Logger.Error("Failed to build Tailscale ACL JSON", zap.Error(err))
-		return
+		s.state.Logger.Error("Failed to build Tailscale ACL JSON", zap.Error(err))
+		s.record(Result{Time: time.Now().UTC(), Error: err.Error()})
+		return err
 	}
 	if policyJSON == "{}" {
-		state.Logger.Info("Local state is empty; skipping ACL push.")
-		return
+		s.state.Logger.Info("Local state is empty; skipping ACL push.")
+		return ErrEmptyState
 	}
 
-	err = putACL(tsAdminClient, tailnetName, []byte(policyJSON))
+	prev, prevETag := s.currentBaseline(LoadMeta(s.state).LastApplied)
+	delta := compareSections(prev, sums)
+	st, partial := target.(SectionTarget)
+	partial = partial && prev != nil
+
+	var etag string
+	switch {
+	case partial && delta.Empty():
+		etag = prevETag
+	case partial:
+		changed := make(map[string]json.RawMessage, len(delta.Changed))
+		for _, k := range delta.Changed {
+			changed[k] = sections[k]
+		}
+		etag, err = st.PutSections(ctx, changed, delta.Removed)
+	default:
+		etag, err = s.putPolicy(ctx, target, []byte(policyJSON), prevETag)
+	}
+	if err != nil && ctx.Err() != nil {
+		s.state.Logger.Warn("ACL push cancelled", zap.Error(err))
+		return err
+	}
 	if err != nil {
-		state.Logger.Error("Failed to push local ACL to Tailscale", zap.Error(err))
-		return
+		s.state.Logger.Error("Failed to push local ACL to Tailscale", zap.Error(err), zap.Strings("sections", delta.Sections()))
+		var apiErr *APIError
+		var stale *StaleError
+		r := Result{
+			Time:     time.Now().UTC(),
+			Bytes:    len(policyJSON),
+			Error:    err.Error(),
+			Rejected: errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest,
+			Delta:    &delta,
+		}
+		if errors.As(err, &stale) {
+			r.Stale, r.Drift = true, stale.Drift
+		}
+		s.record(r)
+		return err
 	}
 
-	state.Logger.Info("Pushed local ACL to Tailscale",
-		zap.Int("bytes", len(policyJSON)))
+	s.state.Logger.Info("Pushed local ACL to Tailscale",
+		zap.Int("bytes", len(policyJSON)), zap.Strings("changedSections", delta.Sections()), zap.Bool("partial", partial))
+	s.setBaseline(sums, etag)
+	sum := sha256.Sum256([]byte(policyJSON))
+	s.record(Result{
+		Time:     time.Now().UTC(),
+		Bytes:    len(policyJSON),
+		ETag:     etag,
+		SHA256:   hex.EncodeToString(sum[:]),
+		Delta:    &delta,
+		Partial:  partial,
+		sections: sums,
+	})
+	return nil
 }
 
-// buildTailscaleACLJSON => deep-clone state.Data, remove "id" fields, return JSON
+// buildTailscaleACLJSON => deep-clone state.Data, remove "id" fields, return compact JSON
 func buildTailscaleACLJSON(state *common.State) (string, error) {
-	state.RWLock.RLock()
-	defer state.RWLock.RUnlock()
-
-	// Deep-copy the entire data
-	rawBytes, err := json.Marshal(state.Data)
+	cleaned, err := buildPolicy(state)
 	if err != nil {
 		return "", err
 	}
-	var clone interface{}
-	if err := json.Unmarshal(rawBytes, &clone); err != nil {
+	return encodePolicy(cleaned)
+}
+
+// encodePolicy returns a policy built by buildPolicy as compact JSON.
+func encodePolicy(cleaned map[string]interface{}) (string, error) {
+	buf := common.GetBuffer()
+	defer common.PutBuffer(buf)
+	if err := common.WriteJSONObject(buf, cleaned, false); err != nil {
 		return "", err
 	}
+	return buf.String(), nil
+}
 
-	// Recursively strip out "id"
-	cleaned := removeIDFields(clone)
+// buildPolicy => deep-clone state.Data and strip everything Tailscale doesn't accept
+func buildPolicy(state *common.State) (map[string]interface{}, error) {
+	buf := common.GetBuffer()
+	defer common.PutBuffer(buf)
 
-	// Marshal
-	filteredBytes, err := json.MarshalIndent(cleaned, "", "  ")
-	if err != nil {
-		return "", err
+	// Deep-copy section by section. Top-level keys starting with "_"
+	// (e.g. "_proposals") are TACL-internal and never copied at all, and
+	// neither are sections of disabled modules, which are managed elsewhere.
+	policy := make(map[string]interface{})
+	now := time.Now()
+	for k, v := range state.Snapshot() {
+		// A null section, e.g. an emptied derpMap, is left out rather
+		// than pushed as null
+		if strings.HasPrefix(k, "_") || state.SectionDisabled(k) || v == nil {
+			continue
+		}
+		buf.Reset()
+		if err := json.NewEncoder(buf).Encode(v); err != nil {
+			return nil, err
+		}
+		var clone interface{}
+		if err := json.Unmarshal(buf.Bytes(), &clone); err != nil {
+			return nil, err
+		}
+		// List entries carry createdBy/updatedAt style metadata, and
+		// "id" is ours too. Expired and disabled entries don't apply.
+		// Entries are ordered by priority and ID, so identical state always
+		// builds identical JSON.
+		clone = dropInactive(clone, now)
+		if list, ok := clone.([]interface{}); ok {
+			common.SortEntries(list)
+		}
+		stripEntryMeta(clone)
+		policy[k] = removeIDFields(clone)
+	}
+	// Settings are stored as one section but are top-level keys of the
+	// policy file
+	if settings, ok := policy["settings"]; ok {
+		delete(policy, "settings")
+		m, _ := settings.(map[string]interface{})
+		for k, v := range m {
+			policy[k] = v
+		}
+	}
+	return policy, nil
+}
+
+// dropInactive removes the disabled and expired entries of a list section.
+func dropInactive(section interface{}, now time.Time) interface{} {
+	list, ok := section.([]interface{})
+	if !ok {
+		return section
+	}
+	out := list[:0]
+	for _, item := range list {
+		if entry, ok := item.(map[string]interface{}); ok && common.InactiveEntry(entry, now) {
+			continue
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// stripEntryMeta removes TACL's own fields from each entry of a list
+// section, as StripEntry does.
+func stripEntryMeta(section interface{}) {
+	list, ok := section.([]interface{})
+	if !ok {
+		return
+	}
+	for _, item := range list {
+		if entry, ok := item.(map[string]interface{}); ok {
+			StripEntry(entry)
+		}
+	}
+}
+
+// StripEntry removes common.MetaFields, common.ExpiryFields,
+// common.LabelFields, common.SlugFields, common.PriorityFields and
+// common.DescriptionFields from a list entry, leaving what's pushed to
+// Tailscale (plus its "id").
+func StripEntry(entry map[string]interface{}) {
+	for _, f := range common.MetaFields {
+		delete(entry, f)
+	}
+	for _, f := range common.ExpiryFields {
+		delete(entry, f)
+	}
+	for _, f := range common.LabelFields {
+		delete(entry, f)
+	}
+	for _, f := range common.SlugFields {
+		delete(entry, f)
+	}
+	for _, f := range common.PriorityFields {
+		delete(entry, f)
+	}
+	for _, f := range common.DescriptionFields {
+		delete(entry, f)
 	}
-	return string(filteredBytes), nil
 }
 
 // removeIDFields => recursively remove "id" from any map
@@ -106,29 +378,50 @@ func removeIDFields(obj interface{}) interface{} {
 	}
 }
 
-// putACL => do an HTTP POST to Tailscale's admin API
-func putACL(tsAdminClient *tailscale.Client, tailnetName string, aclJSON []byte) error {
+// putACL => do an HTTP POST to Tailscale's admin API, with If-Match unless
+// ifMatch is empty
+func putACL(ctx context.Context, tsAdminClient *tailscale.Client, tailnetName string, aclJSON []byte, ifMatch string) (etag string, err error) {
 	httpClient := tsAdminClient.HTTPClient
 	if httpClient == nil {
-		return fmt.Errorf("tsAdminClient.HTTPClient is nil; cannot make admin API requests")
+		return "", fmt.Errorf("tsAdminClient.HTTPClient is nil; cannot make admin API requests")
 	}
 
 	path := fmt.Sprintf("https://api.tailscale.com/api/v2/tailnet/%s/acl", tailnetName)
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, path, bytes.NewReader(aclJSON))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(aclJSON))
 	if err != nil {
-		return fmt.Errorf("creating POST request for %s: %w", path, err)
+		return "", fmt.Errorf("creating POST request for %s: %w", path, err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("POST %s failed: %w", path, err)
+		return "", fmt.Errorf("POST %s failed: %w", path, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("POST %s returned %d: %s", path, resp.StatusCode, string(body))
+		return "", &APIError{Path: path, StatusCode: resp.StatusCode, Body: string(body)}
 	}
-	return nil
+	return resp.Header.Get("ETag"), nil
+}
+
+// APIError is a non-2xx response from the Tailscale API. A 400 on the ACL
+// endpoint means Tailscale rejected the policy (invalid, or failing tests).
+type APIError struct {
+	Method     string // POST if empty
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	method := e.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	return fmt.Sprintf("%s %s returned %d: %s", method, e.Path, e.StatusCode, e.Body)
 }
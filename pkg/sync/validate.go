@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+)
+
+// PolicyJSON returns the policy TACL would push for state, as compact JSON.
+func PolicyJSON(state *common.State) ([]byte, error) {
+	s, err := buildTailscaleACLJSON(state)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// ValidationError is what Tailscale's validate endpoint reports for a policy
+// it would reject, including failing ACL tests.
+type ValidationError struct {
+	Message string            `json:"message"`
+	Data    []json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Data) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (%d details)", e.Message, len(e.Data))
+}
+
+// ValidateRemote asks Tailscale to validate policyJSON (and run its tests)
+// without applying it. It returns a *ValidationError if the policy is rejected.
+func ValidateRemote(ctx context.Context, httpClient *http.Client, tailnetName string, policyJSON []byte) error {
+	path := fmt.Sprintf("https://api.tailscale.com/api/v2/tailnet/%s/acl/validate", tailnetName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(policyJSON))
+	if err != nil {
+		return fmt.Errorf("creating POST request for %s: %w", path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("POST %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &APIError{Path: path, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// A valid policy comes back as an empty object; problems come back as
+	// 200 with a message.
+	var verr ValidationError
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &verr); err != nil {
+			return fmt.Errorf("decoding validate response: %w", err)
+		}
+	}
+	if verr.Message != "" {
+		return &verr
+	}
+	return nil
+}
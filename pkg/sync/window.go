@@ -0,0 +1,250 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a weekly period in which the sync loop may push, e.g. weekdays
+// from 09:00 to 17:00. A window whose end is before its start runs past
+// midnight, into the next day.
+type Window struct {
+	// Days the window starts on; all days when empty.
+	Days []time.Weekday
+	// Start and End are minutes since midnight.
+	Start, End int
+}
+
+// Schedule is the set of windows automatic pushes are limited to, in a
+// time zone. The zero Schedule allows pushes at any time.
+type Schedule struct {
+	Windows  []Window
+	Location *time.Location
+	spec     string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses windows separated by ";", each an optional list of
+// days and a time range, e.g. "Mon-Fri 09:00-17:00; Sat 10:00-12:00".
+// Days are names, ranges of names or "*", separated by ",". An empty spec
+// allows pushes at any time.
+func ParseSchedule(spec string, loc *time.Location) (Schedule, error) {
+	s := Schedule{Location: loc, spec: strings.TrimSpace(spec)}
+	if loc == nil {
+		s.Location = time.UTC
+	}
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Fields(part)
+		if len(fields) > 2 {
+			return Schedule{}, fmt.Errorf("invalid sync window %q: want [days] HH:MM-HH:MM", part)
+		}
+		var w Window
+		if len(fields) == 2 {
+			days, err := parseDays(fields[0])
+			if err != nil {
+				return Schedule{}, fmt.Errorf("invalid sync window %q: %w", part, err)
+			}
+			w.Days = days
+		}
+		from, to, ok := strings.Cut(fields[len(fields)-1], "-")
+		if !ok {
+			return Schedule{}, fmt.Errorf("invalid sync window %q: want [days] HH:MM-HH:MM", part)
+		}
+		var err error
+		if w.Start, err = parseClock(from); err == nil {
+			w.End, err = parseClock(to)
+		}
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid sync window %q: %w", part, err)
+		}
+		if w.Start == w.End {
+			return Schedule{}, fmt.Errorf("invalid sync window %q: start and end are the same", part)
+		}
+		s.Windows = append(s.Windows, w)
+	}
+	return s, nil
+}
+
+func parseDays(s string) ([]time.Weekday, error) {
+	if s == "*" {
+		return nil, nil
+	}
+	var days []time.Weekday
+	for _, item := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.ToLower(item), "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return nil, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days = append(days, d)
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		if s == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, fmt.Errorf("invalid time %q: want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w Window) on(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Open reports whether t falls in one of the windows.
+func (s Schedule) Open(t time.Time) bool {
+	if len(s.Windows) == 0 {
+		return true
+	}
+	t = t.In(s.Location)
+	m := t.Hour()*60 + t.Minute()
+	for _, w := range s.Windows {
+		if w.Start < w.End {
+			if w.on(t.Weekday()) && m >= w.Start && m < w.End {
+				return true
+			}
+			continue
+		}
+		if (w.on(t.Weekday()) && m >= w.Start) || (w.on((t.Weekday()+6)%7) && m < w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen returns when the next window after t opens, or t itself if a
+// window is open.
+func (s Schedule) NextOpen(t time.Time) time.Time {
+	if s.Open(t) {
+		return t
+	}
+	local := t.In(s.Location)
+	var next time.Time
+	for i := 0; i <= 7; i++ {
+		for _, w := range s.Windows {
+			// time.Date normalizes the day and minute overflow, and lands on
+			// the wall clock time across DST changes
+			start := time.Date(local.Year(), local.Month(), local.Day()+i, 0, w.Start, 0, 0, s.Location)
+			if w.on(start.Weekday()) && start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+	return next
+}
+
+// String returns the spec the schedule was parsed from.
+func (s Schedule) String() string { return s.spec }
+
+// WindowStatus reports the sync window in the sync status.
+type WindowStatus struct {
+	Schedule string `json:"schedule"`
+	Timezone string `json:"timezone"`
+	Open     bool   `json:"open"`
+	// NextOpen is set while the window is closed.
+	NextOpen *time.Time `json:"nextOpen,omitempty"`
+	// Pending is set while changes are held back until the window opens,
+	// since PendingSince.
+	Pending      bool       `json:"pending"`
+	PendingSince *time.Time `json:"pendingSince,omitempty"`
+}
+
+// SetSchedule limits automatic pushes by the loop started by Start to the
+// schedule's windows. API writes are still accepted at any time; they're
+// pushed once a window opens. Call it before Start.
+func (s *Syncer) SetSchedule(schedule Schedule) {
+	s.windowMu.Lock()
+	defer s.windowMu.Unlock()
+	s.schedule = schedule
+}
+
+// InWindow reports whether the schedule allows a push at t.
+func (s *Syncer) InWindow(t time.Time) bool {
+	s.windowMu.Lock()
+	defer s.windowMu.Unlock()
+	return s.schedule.Open(t)
+}
+
+// NextWindow returns when the schedule next allows a push after t.
+func (s *Syncer) NextWindow(t time.Time) time.Time {
+	s.windowMu.Lock()
+	defer s.windowMu.Unlock()
+	return s.schedule.NextOpen(t)
+}
+
+// deferPush records that a push was held back because the window is closed;
+// pending says whether the policy differs from what is live. It reports
+// whether the hold just started.
+func (s *Syncer) deferPush(now time.Time, pending bool) bool {
+	s.windowMu.Lock()
+	defer s.windowMu.Unlock()
+	if !pending {
+		s.pendingSince = nil
+		return false
+	}
+	if s.pendingSince != nil {
+		return false
+	}
+	s.pendingSince = &now
+	return true
+}
+
+// clearPending records that nothing is held back any more.
+func (s *Syncer) clearPending() {
+	s.windowMu.Lock()
+	defer s.windowMu.Unlock()
+	s.pendingSince = nil
+}
+
+// windowStatus returns the window's status at now, or nil without a
+// schedule.
+func (s *Syncer) windowStatus(now time.Time) *WindowStatus {
+	s.windowMu.Lock()
+	defer s.windowMu.Unlock()
+	if len(s.schedule.Windows) == 0 {
+		return nil
+	}
+	ws := &WindowStatus{Schedule: s.schedule.String(), Timezone: s.schedule.Location.String(), Open: s.schedule.Open(now)}
+	if !ws.Open {
+		next := s.schedule.NextOpen(now)
+		ws.NextOpen = &next
+	}
+	if s.pendingSince != nil {
+		since := *s.pendingSince
+		ws.Pending, ws.PendingSince = true, &since
+	}
+	return ws
+}
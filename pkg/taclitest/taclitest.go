@@ -0,0 +1,180 @@
+// Package taclitest runs a TACL server in-process for integration tests:
+// the full API on an in-memory state, in front of a fake Tailscale API the
+// policy is pushed to. Tests (here and in programs embedding TACL) drive it
+// with Do and Push, then check what the fake received.
+//
+// The middleware and routes are wired up by pkg/server, as for tacl serve;
+// only authentication is replaced, by Identity. Servers sharing a process
+// are independent of each other.
+package taclitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/acl/ssh"
+	"github.com/lbrlabs/tacl/pkg/audit"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/server"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/lbrlabs/tacl/pkg/validate"
+	"go.uber.org/zap"
+)
+
+// TailnetName is the tailnet the fake Tailscale API serves.
+const TailnetName = "example.com"
+
+// DefaultIdentity is who every request made to a Server comes from, unless
+// Server.Identity is changed.
+var DefaultIdentity = common.Identity{
+	LoginName: "taclitest@example.com",
+	NodeName:  "taclitest",
+	IP:        "100.64.0.1",
+}
+
+// Server is a TACL API server on in-memory storage.
+type Server struct {
+	State     *common.State
+	Store     *MemStore
+	Tailscale *Tailscale
+	Router    *gin.Engine
+	Audit     *audit.Log
+	Sync      *sync.Syncer
+	// URL is where the server listens, for HTTP clients such as
+	// pkg/client.
+	URL string
+	// Identity is the caller every request is authenticated as.
+	Identity common.Identity
+
+	srv *httptest.Server
+}
+
+// Options customize NewServer.
+type Options struct {
+	// Storage is the state's storage URL; a trailing slash stores each key
+	// as its own object. Defaults to "mem://state.json".
+	Storage string
+	// Data is the initial state, as if loaded from storage.
+	Data map[string]interface{}
+	// Logger defaults to a no-op logger.
+	Logger *zap.Logger
+	// SSH configures the ssh module.
+	SSH ssh.Config
+	// ValidateWrites is what to do with changes that fail validation, as
+	// with --validate-writes: "off", "warn" or (the default) "reject".
+	ValidateWrites string
+}
+
+// NewServer starts a server and a fake Tailscale API for it. Close it when
+// done.
+func NewServer(opts Options) (*Server, error) {
+	if opts.Storage == "" {
+		opts.Storage = "mem://state.json"
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+	if opts.ValidateWrites == "" {
+		opts.ValidateWrites = validate.ModeReject
+	}
+	s := &Server{
+		Store:     NewMemStore(),
+		Tailscale: NewTailscale(TailnetName),
+		Identity:  DefaultIdentity,
+	}
+	s.State = &common.State{
+		Data:    make(map[string]interface{}),
+		Storage: opts.Storage,
+		Objects: s.Store,
+		Logger:  opts.Logger,
+	}
+	if opts.Data != nil {
+		raw, err := json.Marshal(opts.Data)
+		if err != nil {
+			s.Tailscale.Close()
+			return nil, err
+		}
+		if err := s.State.SaveBytesToStorage(raw); err != nil {
+			s.Tailscale.Close()
+			return nil, err
+		}
+	}
+	s.State.LoadFromStorage()
+	if opts.ValidateWrites != "off" {
+		check, err := validate.SaveCheck(opts.ValidateWrites, opts.Logger)
+		if err != nil {
+			s.Tailscale.Close()
+			return nil, err
+		}
+		s.State.SaveCheck = check
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	common.ConfigureRouting(r)
+	r.Use(func(c *gin.Context) {
+		if id, ok := common.InternalIdentity(c.Request); ok {
+			common.SetIdentity(c, id)
+			return
+		}
+		common.SetIdentity(c, s.Identity)
+	})
+	api := server.New(r, s.State, server.Config{
+		SSH:         opts.SSH,
+		AuditBuffer: 1000,
+		HTTPClient:  s.Tailscale.Client(),
+		TailnetName: TailnetName,
+	})
+	s.Router, s.Audit, s.Sync = r, api.Audit, api.Sync
+
+	s.srv = httptest.NewServer(common.CanonicalPaths(r))
+	s.URL = s.srv.URL
+	return s, nil
+}
+
+// Close stops the server and the fake Tailscale API.
+func (s *Server) Close() {
+	s.srv.Close()
+	s.Tailscale.Close()
+}
+
+// Do sends a request to the server as s.Identity. body, if not nil, is
+// sent as JSON: a []byte or string as is, anything else marshaled.
+func (s *Server) Do(method, path string, body interface{}) *httptest.ResponseRecorder {
+	var raw []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		raw = b
+	case string:
+		raw = []byte(b)
+	default:
+		var err error
+		if raw, err = json.Marshal(b); err != nil {
+			panic("taclitest: marshaling request body: " + err.Error())
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+	if raw != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	common.CanonicalPaths(s.Router).ServeHTTP(w, req)
+	return w
+}
+
+// Push syncs the state to the fake Tailscale API, as the periodic sync
+// does.
+func (s *Server) Push(ctx context.Context) error {
+	return s.Sync.Push(ctx, s.Tailscale.AdminClient(), TailnetName)
+}
+
+// Live returns the policy the fake Tailscale API currently has, decoded.
+func (s *Server) Live() (map[string]interface{}, error) {
+	var policy map[string]interface{}
+	err := json.Unmarshal(s.Tailscale.Policy(), &policy)
+	return policy, err
+}
@@ -0,0 +1,91 @@
+package taclitest
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func newServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := NewServer(Options{})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func mustDo(t *testing.T, s *Server, method, path string, body interface{}, want int) {
+	t.Helper()
+	if rec := s.Do(method, path, body); rec.Code != want {
+		t.Fatalf("%s %s = %d, want %d: %s", method, path, rec.Code, want, rec.Body.String())
+	}
+}
+
+func TestWritesArePushed(t *testing.T) {
+	s := newServer(t)
+	mustDo(t, s, http.MethodPost, "/groups", map[string]interface{}{"name": "eng", "members": []string{"alice@example.com"}}, http.StatusCreated)
+	mustDo(t, s, http.MethodPost, "/hosts", map[string]string{"name": "db", "ip": "10.0.0.5"}, http.StatusCreated)
+	mustDo(t, s, http.MethodPost, "/acls", map[string]interface{}{"action": "accept", "src": []string{"group:eng"}, "dst": []string{"db:5432"}}, http.StatusCreated)
+
+	if err := s.Push(context.Background()); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	live, err := s.Live()
+	if err != nil {
+		t.Fatalf("Live: %v", err)
+	}
+
+	// Ids and entry metadata are TACL's own and never pushed
+	want := map[string]interface{}{
+		"groups": map[string]interface{}{"group:eng": []interface{}{"alice@example.com"}},
+		"hosts":  map[string]interface{}{"db": "10.0.0.5"},
+		"acls": []interface{}{map[string]interface{}{
+			"action": "accept",
+			"src":    []interface{}{"group:eng"},
+			"dst":    []interface{}{"db:5432"},
+		}},
+	}
+	for section, v := range want {
+		if !reflect.DeepEqual(live[section], v) {
+			t.Errorf("pushed %s = %#v, want %#v", section, live[section], v)
+		}
+	}
+	if n := len(s.Tailscale.Pushes()); n != 1 {
+		t.Errorf("got %d pushes, want 1", n)
+	}
+}
+
+func TestRejectedPushLeavesLivePolicy(t *testing.T) {
+	s := newServer(t)
+	mustDo(t, s, http.MethodPost, "/hosts", map[string]string{"name": "db", "ip": "10.0.0.5"}, http.StatusCreated)
+	if err := s.Push(context.Background()); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	before := s.Tailscale.Policy()
+
+	s.Tailscale.Reject("test failed")
+	mustDo(t, s, http.MethodPost, "/hosts", map[string]string{"name": "web", "ip": "10.0.0.6"}, http.StatusCreated)
+	if err := s.Push(context.Background()); err == nil {
+		t.Fatal("Push succeeded, want Tailscale's rejection")
+	}
+	if after := s.Tailscale.Policy(); string(after) != string(before) {
+		t.Errorf("live policy changed after a rejected push:\n%s", after)
+	}
+}
+
+func TestServersHaveTheirOwnSyncStatus(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+	mustDo(t, a, http.MethodPost, "/hosts", map[string]string{"name": "db", "ip": "10.0.0.5"}, http.StatusCreated)
+	if err := a.Push(context.Background()); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if st := a.Sync.CurrentStatus(); st.LastSuccess == nil {
+		t.Errorf("pushing server has no successful push: %+v", st)
+	}
+	if st := b.Sync.CurrentStatus(); st.LastAttempt != nil {
+		t.Errorf("other server saw the push: %+v", st.LastAttempt)
+	}
+}
@@ -0,0 +1,209 @@
+package taclitest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	gosync "sync"
+
+	"github.com/lbrlabs/tacl/pkg/tailnet"
+	"tailscale.com/client/tailscale"
+)
+
+// apiHost is where TACL sends its Tailscale API requests.
+const apiHost = "api.tailscale.com"
+
+// Tailscale is a fake of the parts of the Tailscale API TACL uses: the
+// tailnet policy (with ETags and If-Match), policy validation and the device
+// list. Requests for any tailnet other than Tailnet get 404.
+type Tailscale struct {
+	// Tailnet is the tailnet the fake serves.
+	Tailnet string
+	// URL is the base URL of the fake, e.g. "http://127.0.0.1:1234".
+	URL string
+
+	srv *httptest.Server
+
+	mu      gosync.Mutex
+	policy  []byte
+	pushes  [][]byte
+	reject  string
+	devices []tailnet.Device
+}
+
+// NewTailscale starts a fake serving tailnetName, whose policy is initially
+// empty. Close it when done.
+func NewTailscale(tailnetName string) *Tailscale {
+	f := &Tailscale{Tailnet: tailnetName, policy: []byte("{}")}
+	mux := http.NewServeMux()
+	prefix := "/api/v2/tailnet/" + tailnetName
+	mux.HandleFunc(prefix+"/acl", f.handleACL)
+	mux.HandleFunc(prefix+"/acl/validate", f.handleValidate)
+	mux.HandleFunc(prefix+"/devices", f.handleDevices)
+	f.srv = httptest.NewServer(mux)
+	f.URL = f.srv.URL
+	return f
+}
+
+// Close shuts the fake down.
+func (f *Tailscale) Close() { f.srv.Close() }
+
+// Client returns an HTTP client that sends requests for the Tailscale API
+// to the fake, for the packages that take one (tailnet, reconcile, lint).
+func (f *Tailscale) Client() *http.Client {
+	return &http.Client{Transport: redirect{to: f.srv.Listener.Addr().String(), next: f.srv.Client().Transport}}
+}
+
+// AdminClient returns a Tailscale client talking to the fake, as
+// Syncer.Push and Syncer.Start take.
+func (f *Tailscale) AdminClient() *tailscale.Client {
+	c := tailscale.NewClient(f.Tailnet, nil)
+	c.HTTPClient = f.Client()
+	return c
+}
+
+// Policy returns the policy currently applied.
+func (f *Tailscale) Policy() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]byte(nil), f.policy...)
+}
+
+// SetPolicy replaces the applied policy, as a change made outside TACL
+// would.
+func (f *Tailscale) SetPolicy(policy []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.policy = append([]byte(nil), policy...)
+}
+
+// Pushes returns every policy accepted so far, oldest first.
+func (f *Tailscale) Pushes() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]byte(nil), f.pushes...)
+}
+
+// Reject makes the fake refuse every policy pushed or validated from now
+// on with the given message, as Tailscale does for invalid policies and
+// failing tests. An empty message accepts them again.
+func (f *Tailscale) Reject(message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reject = message
+}
+
+// SetDevices sets the devices the tailnet lists.
+func (f *Tailscale) SetDevices(devices ...tailnet.Device) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devices = devices
+}
+
+func (f *Tailscale) handleACL(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(f.policy))
+		w.Write(f.policy)
+	case http.MethodPost:
+		if m := r.Header.Get("If-Match"); m != "" && m != "*" && m != etag(f.policy) {
+			writeMessage(w, http.StatusPreconditionFailed, "precondition failed, invalid old hash")
+			return
+		}
+		body, ok := f.check(w, r)
+		if !ok {
+			return
+		}
+		f.policy = body
+		f.pushes = append(f.pushes, body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(body))
+		w.Write(body)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *Tailscale) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	f.mu.Lock()
+	reject := f.reject
+	f.mu.Unlock()
+	body, err := io.ReadAll(r.Body)
+	switch {
+	case err != nil || !json.Valid(body):
+		writeMessage(w, http.StatusOK, "invalid policy JSON")
+	case reject != "":
+		writeMessage(w, http.StatusOK, reject)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}
+}
+
+func (f *Tailscale) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	f.mu.Lock()
+	devices := append([]tailnet.Device{}, f.devices...)
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"devices": devices})
+}
+
+// check reads a pushed policy, answering 400 if it's rejected. Callers
+// hold f.mu.
+func (f *Tailscale) check(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || !json.Valid(body) {
+		writeMessage(w, http.StatusBadRequest, "invalid policy JSON")
+		return nil, false
+	}
+	if f.reject != "" {
+		writeMessage(w, http.StatusBadRequest, f.reject)
+		return nil, false
+	}
+	var compact bytes.Buffer
+	json.Compact(&compact, body)
+	return compact.Bytes(), true
+}
+
+func writeMessage(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func etag(policy []byte) string {
+	sum := sha256.Sum256(policy)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// redirect sends requests for the Tailscale API, over any scheme, to the
+// fake instead.
+type redirect struct {
+	to   string
+	next http.RoundTripper
+}
+
+func (t redirect) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.EqualFold(r.URL.Hostname(), apiHost) {
+		return t.next.RoundTrip(r)
+	}
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host, r.Host = "http", t.to, t.to
+	return t.next.RoundTrip(r)
+}
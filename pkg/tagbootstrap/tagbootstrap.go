@@ -0,0 +1,227 @@
+// Package tagbootstrap finds tags that rules reference but tagOwners
+// doesn't define, a frequent reason for Tailscale to reject a policy, and
+// warns about them or creates a tagOwners stub for each.
+package tagbootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// Job modes.
+const (
+	ModeWarn   = "warn"   // missing tag owners are logged
+	ModeCreate = "create" // a tagOwners stub is created for each
+)
+
+// Actor attributes the job's changes.
+const Actor = "tacl-tag-bootstrap"
+
+// Missing is a tag referenced without a tagOwners entry.
+type Missing struct {
+	Tag string `json:"tag"`
+	// Sections referencing it, e.g. ["acls", "ssh"].
+	Sections []string `json:"sections"`
+}
+
+// Find returns the tags referenced in acls, ssh and autoApprovers that
+// have no tagOwners entry, sorted.
+func Find(data map[string]interface{}) []Missing {
+	owned := map[string]bool{}
+	var tagOwners map[string]interface{}
+	_ = roundTrip(data["tagOwners"], &tagOwners)
+	for tag := range tagOwners {
+		owned[tag] = true
+	}
+
+	refs := map[string]map[string]bool{}
+	add := func(section string, principals []string, withPort bool) {
+		for _, p := range principals {
+			if withPort {
+				if i := strings.LastIndex(p, ":"); i > 0 {
+					p = p[:i]
+				}
+			}
+			if !strings.HasPrefix(p, "tag:") || owned[p] {
+				continue
+			}
+			if refs[p] == nil {
+				refs[p] = map[string]bool{}
+			}
+			refs[p][section] = true
+		}
+	}
+
+	var rules []struct {
+		Src []string `json:"src"`
+		Dst []string `json:"dst"`
+	}
+	_ = roundTrip(data["acls"], &rules)
+	for _, r := range rules {
+		add("acls", r.Src, false)
+		add("acls", r.Dst, true)
+	}
+	rules = nil
+	_ = roundTrip(data["ssh"], &rules)
+	for _, r := range rules {
+		add("ssh", r.Src, false)
+		add("ssh", r.Dst, false)
+	}
+	var approvers struct {
+		Routes   map[string][]string `json:"routes"`
+		ExitNode []string            `json:"exitNode"`
+	}
+	_ = roundTrip(data["autoApprovers"], &approvers)
+	for _, a := range approvers.Routes {
+		add("autoApprovers", a, false)
+	}
+	add("autoApprovers", approvers.ExitNode, false)
+
+	out := make([]Missing, 0, len(refs))
+	for tag, sections := range refs {
+		m := Missing{Tag: tag}
+		for s := range sections {
+			m.Sections = append(m.Sections, s)
+		}
+		sort.Strings(m.Sections)
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tag < out[j].Tag })
+	return out
+}
+
+// Job looks for missing tag owners. Like the cleanup job, the stubs it
+// creates go through the router as internal requests, so they're audited,
+// versioned and delivered to webhooks.
+type Job struct {
+	state   *common.State
+	syncer  *sync.Syncer
+	handler http.Handler
+	mode    string
+	owners  []string
+	logger  *zap.Logger
+
+	mu     gosync.Mutex
+	warned map[string]bool
+}
+
+// NewJob returns a job in mode. With ModeCreate, stubs are owned by owners
+// and pushed by syncer.
+func NewJob(state *common.State, syncer *sync.Syncer, handler http.Handler, mode string, owners []string, logger *zap.Logger) (*Job, error) {
+	switch mode {
+	case ModeWarn:
+	case ModeCreate:
+		if len(owners) == 0 {
+			return nil, fmt.Errorf("mode %s needs at least one default owner", ModeCreate)
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode %q (want %s or %s)", mode, ModeWarn, ModeCreate)
+	}
+	return &Job{state: state, syncer: syncer, handler: handler, mode: mode, owners: owners, logger: logger, warned: map[string]bool{}}, nil
+}
+
+// Start runs the job now and then every interval until ctx is cancelled,
+// except while the server is a standby.
+func (j *Job) Start(ctx context.Context, interval time.Duration) {
+	if !j.state.IsStandby() {
+		j.Run(ctx)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !j.state.IsStandby() {
+					j.Run(ctx)
+				}
+			}
+		}
+	}()
+}
+
+// Run looks for missing tag owners once and returns how many stubs it
+// created. In ModeWarn each missing tag is logged once, until it's fixed.
+func (j *Job) Run(ctx context.Context) int {
+	missing := Find(j.state.Snapshot())
+	if j.mode == ModeWarn {
+		j.warn(missing)
+		return 0
+	}
+
+	n := 0
+	for _, m := range missing {
+		if err := j.create(ctx, m.Tag); err != nil {
+			j.logger.Error("Failed to create tag owner stub", zap.String("tag", m.Tag), zap.Error(err))
+			continue
+		}
+		j.logger.Info("Created tag owner stub for a referenced tag",
+			zap.String("tag", m.Tag), zap.Strings("referencedBy", m.Sections), zap.Strings("owners", j.owners))
+		n++
+	}
+	if n > 0 {
+		j.syncer.Trigger()
+	}
+	return n
+}
+
+func (j *Job) warn(missing []Missing) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	current := make(map[string]bool, len(missing))
+	for _, m := range missing {
+		current[m.Tag] = true
+		if j.warned[m.Tag] {
+			continue
+		}
+		j.logger.Warn("Tag is referenced but has no tagOwners entry; Tailscale will reject the policy",
+			zap.String("tag", m.Tag), zap.Strings("referencedBy", m.Sections))
+	}
+	j.warned = current
+}
+
+// create adds a tagOwners entry for tag, owned by the default owners.
+func (j *Job) create(ctx context.Context, tag string) error {
+	b, err := json.Marshal(map[string]interface{}{"name": strings.TrimPrefix(tag, "tag:"), "owners": j.owners})
+	if err != nil {
+		return err
+	}
+	req, err := common.NewInternalRequest(ctx, http.MethodPost, "/tagowners", b, common.Identity{NodeName: Actor})
+	if err != nil {
+		return err
+	}
+	// Internal requests skip SerializeMutations, so serialize with API
+	// writes to tagOwners here
+	unlock := j.state.LockSection("tagOwners")
+	defer unlock()
+	rec := httptest.NewRecorder()
+	j.handler.ServeHTTP(rec, req)
+	if rec.Code >= 300 {
+		return fmt.Errorf("POST /tagowners: %d %s", rec.Code, rec.Body.String())
+	}
+	return nil
+}
+
+func roundTrip(in, out interface{}) error {
+	if in == nil {
+		return nil
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,52 @@
+package tailnet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/lbrlabs/tacl/pkg/sync"
+)
+
+// Device is a node in the tailnet, as the Tailscale API lists it.
+type Device struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Hostname  string   `json:"hostname"`
+	Addresses []string `json:"addresses"`
+	Tags      []string `json:"tags,omitempty"`
+	// EnabledRoutes are the subnet routes (and exit routes) the device
+	// serves.
+	EnabledRoutes []string `json:"enabledRoutes,omitempty"`
+}
+
+// FetchDevices lists the devices in the named tailnet.
+func FetchDevices(ctx context.Context, httpClient *http.Client, tailnetName string) ([]Device, error) {
+	path := fmt.Sprintf("https://api.tailscale.com/api/v2/tailnet/%s/devices?fields=all", tailnetName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating GET request for %s: %w", path, err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &sync.APIError{Method: http.MethodGet, Path: path, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	var out struct {
+		Devices []Device `json:"devices"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return out.Devices, nil
+}
@@ -0,0 +1,87 @@
+package tailnet
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/diff"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/tailscale/hujson"
+)
+
+// Diff is the response of GET /diff: what the next push would change on
+// the tailnet.
+type Diff struct {
+	// Changed is set if the policy TACL would push differs from the live
+	// one.
+	Changed bool `json:"changed"`
+	// Sections are the top-level sections that differ, from the live
+	// policy to TACL's.
+	Sections map[string]diff.SectionDiff `json:"sections"`
+	Unified  string                      `json:"unified"`
+}
+
+// RegisterDiffRoutes wires up GET /diff, which compares the policy live on
+// the tailnet with the one TACL assembles from state. Like GET
+// /tailnet/acl, it answers 503 without API credentials or a tailnet name,
+// and 502 if the live policy can't be fetched.
+//
+//	GET /diff             => the per-section diff, and a unified one
+//	GET /diff?format=text => only the unified diff, as plain text
+func RegisterDiffRoutes(r *gin.Engine, state *common.State, httpClient *http.Client, tailnetName string) {
+	r.GET("/diff", func(c *gin.Context) {
+		diffLive(c, state, httpClient, tailnetName)
+	})
+}
+
+// diffLive => GET /diff
+func diffLive(c *gin.Context, state *common.State, httpClient *http.Client, tailnetName string) {
+	if httpClient == nil || tailnetName == "" {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "No Tailscale API credentials or tailnet configured"})
+		return
+	}
+	policy, err := sync.PolicyJSON(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build the policy: " + err.Error()})
+		return
+	}
+	var local map[string]interface{}
+	if err := json.Unmarshal(policy, &local); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to build the policy: " + err.Error()})
+		return
+	}
+	raw, err := sync.FetchRemote(c.Request.Context(), httpClient, tailnetName)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Failed to fetch the tailnet policy: " + err.Error()})
+		return
+	}
+	live, err := decode(raw)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	unified := diff.Unified("tailnet", "tacl", live, local)
+	if c.Query("format") == "text" {
+		c.String(http.StatusOK, unified)
+		return
+	}
+	sections := diff.State(live, local)
+	c.JSON(http.StatusOK, Diff{Changed: len(sections) > 0, Sections: sections, Unified: unified})
+}
+
+// decode parses a policy file (JSON or HuJSON) into its top-level sections.
+func decode(policy []byte) (map[string]interface{}, error) {
+	std, err := hujson.Standardize(policy)
+	if err != nil {
+		return nil, errors.New("the tailnet policy does not parse: " + err.Error())
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(std, &data); err != nil {
+		return nil, errors.New("the tailnet policy is not a JSON object")
+	}
+	return data, nil
+}
@@ -0,0 +1,59 @@
+// Package tailnet serves what is live on the tailnet, read through TACL's
+// Tailscale API credentials, so clients can compare it with TACL without
+// credentials of their own.
+package tailnet
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/sync"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// RegisterRoutes wires up GET /tailnet/acl. httpClient is authenticated
+// for the Tailscale API; without it, or a tailnet name, the route answers
+// 503.
+//
+//	GET /tailnet/acl => the policy live on the tailnet, normalized
+func RegisterRoutes(r *gin.Engine, httpClient *http.Client, tailnetName string) {
+	r.GET("/tailnet/acl", func(c *gin.Context) {
+		if httpClient == nil || tailnetName == "" {
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "No Tailscale API credentials or tailnet configured"})
+			return
+		}
+		live, err := sync.FetchRemote(c.Request.Context(), httpClient, tailnetName)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Failed to fetch the tailnet policy: " + err.Error()})
+			return
+		}
+		policy, err := Normalize(live)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", policy)
+	})
+}
+
+// Normalize turns a policy file (JSON or HuJSON) into the JSON TACL
+// itself writes: no comments or trailing commas, sorted keys, two-space
+// indentation. Entries keep their order.
+func Normalize(policy []byte) ([]byte, error) {
+	data, err := decode(policy)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := common.WriteJSONObject(&out, data, true); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
@@ -0,0 +1,597 @@
+// Package templates stores parameterized policy bundles, e.g. a "standard
+// web service" made of a tag owner, ACLs and an SSH rule, and instantiates
+// them into concrete resources in one write.
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/validate"
+)
+
+// stateKey holds the templates. The leading underscore keeps it out of the synced policy.
+const stateKey = "_templates"
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Template is a policy fragment with ${name} placeholders.
+//
+// Example JSON:
+//
+//	{
+//	  "name": "web-service",
+//	  "parameters": [{ "name": "tag" }, { "name": "port", "default": "443" }],
+//	  "body": {
+//	    "tagOwners": { "tag:${tag}": ["group:sre"] },
+//	    "acls": [{ "action": "accept", "src": ["group:eng"], "dst": ["tag:${tag}:${port}"] }],
+//	    "ssh": [{ "action": "check", "src": ["group:sre"], "dst": ["tag:${tag}"], "users": ["root"] }]
+//	  }
+//	}
+type Template struct {
+	Name        string      `json:"name" binding:"required"`
+	Description string      `json:"description,omitempty"`
+	Parameters  []Parameter `json:"parameters,omitempty"`
+	// Body holds sections in policy shape. List sections (acls, ssh,
+	// nodeAttrs, aclTests) are appended to; map sections (groups,
+	// tagOwners, hosts, postures) get new keys.
+	Body map[string]interface{} `json:"body" binding:"required"`
+	common.EntryMeta
+}
+
+// Parameter is a placeholder a template's body may reference.
+type Parameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Default is used when instantiating without a value. Parameters
+	// without one are required.
+	Default *string `json:"default,omitempty"`
+}
+
+// DeleteRequest is the JSON body for DELETE /templates.
+type DeleteRequest struct {
+	Name string `json:"name"`
+}
+
+// InstantiateRequest is the JSON body for POST /templates/:name/instantiate.
+type InstantiateRequest struct {
+	Params map[string]string `json:"params"`
+	// DryRun renders and validates the template without saving anything.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// InstantiateResponse lists what was (or, for a dry run, would be) created:
+// the ids of new list entries and the keys of new map entries, by section.
+type InstantiateResponse struct {
+	Template string                 `json:"template"`
+	DryRun   bool                   `json:"dryRun,omitempty"`
+	Created  map[string][]string    `json:"created"`
+	Rendered map[string]interface{} `json:"rendered"`
+}
+
+// section describes how a template section is merged into state.
+type section struct {
+	list   bool   // array of entries with an "id"
+	prefix string // key prefix of map sections, e.g. "group:"
+}
+
+var sections = map[string]section{
+	"acls":      {list: true},
+	"aclTests":  {list: true},
+	"grants":    {list: true},
+	"nodeAttrs": {list: true},
+	"ssh":       {list: true},
+	"groups":    {prefix: "group:"},
+	"hosts":     {},
+	"postures":  {prefix: "posture:"},
+	"tagOwners": {prefix: "tag:"},
+}
+
+var (
+	placeholder = regexp.MustCompile(`\$\{([^}]*)\}`)
+	paramName   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// RegisterRoutes wires up the /templates endpoints.
+//
+//	GET    /templates                  => list templates
+//	GET    /templates/:name            => get one template
+//	POST   /templates                  => create a template
+//	PUT    /templates                  => replace a template by name
+//	DELETE /templates                  => delete a template by name
+//	POST   /templates/:name/instantiate => create the template's resources
+func RegisterRoutes(r *gin.Engine, state *common.State) {
+	t := r.Group("/templates")
+	{
+		t.GET("", func(c *gin.Context) {
+			listTemplates(c, state)
+		})
+		t.GET("/:name", func(c *gin.Context) {
+			getTemplate(c, state)
+		})
+		t.POST("", func(c *gin.Context) {
+			createTemplate(c, state)
+		})
+		t.PUT("", func(c *gin.Context) {
+			updateTemplate(c, state)
+		})
+		t.DELETE("", func(c *gin.Context) {
+			deleteTemplate(c, state)
+		})
+		t.POST("/:name/instantiate", func(c *gin.Context) {
+			instantiateTemplate(c, state)
+		})
+	}
+	common.RegisterPolicyRoute(http.MethodPost, "/templates/:name/instantiate")
+}
+
+// listTemplates => GET /templates
+func listTemplates(c *gin.Context, state *common.State) {
+	list, err := getTemplatesFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse templates"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// getTemplate => GET /templates/:name
+func getTemplate(c *gin.Context, state *common.State) {
+	list, err := getTemplatesFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse templates"})
+		return
+	}
+	i := indexOf(list, c.Param("name"))
+	if i < 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Template not found"})
+		return
+	}
+	c.JSON(http.StatusOK, list[i])
+}
+
+// createTemplate => POST /templates
+func createTemplate(c *gin.Context, state *common.State) {
+	var t Template
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := checkTemplate(t); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	list, err := getTemplatesFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse templates"})
+		return
+	}
+	if indexOf(list, t.Name) >= 0 {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Template already exists"})
+		return
+	}
+
+	t.EntryMeta = common.NewRequestMeta(c)
+	list = append(list, t)
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), stateKey, list); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save template"})
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
+
+// updateTemplate => PUT /templates
+func updateTemplate(c *gin.Context, state *common.State) {
+	var t Template
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := checkTemplate(t); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	list, err := getTemplatesFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse templates"})
+		return
+	}
+	i := indexOf(list, t.Name)
+	if i < 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Template not found"})
+		return
+	}
+
+	if err := state.CheckManaged(c, list[i].EntryMeta); err != nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Template is " + err.Error()})
+		return
+	}
+
+	t.EntryMeta = list[i].EntryMeta.Touched(common.Actor(c))
+	list[i] = t
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), stateKey, list); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to update template"})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// deleteTemplate => DELETE /templates
+func deleteTemplate(c *gin.Context, state *common.State) {
+	var req DeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing 'name' field"})
+		return
+	}
+
+	list, err := getTemplatesFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse templates"})
+		return
+	}
+	i := indexOf(list, req.Name)
+	if i < 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Template not found"})
+		return
+	}
+	if err := state.CheckManaged(c, list[i].EntryMeta); err != nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Template is " + err.Error()})
+		return
+	}
+
+	list = append(list[:i], list[i+1:]...)
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), stateKey, list); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save changes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted"})
+}
+
+// instantiateTemplate => POST /templates/:name/instantiate
+//
+// The caller needs write access to every section the template creates
+// resources in, not just templates:write. Every resource is created in a
+// single state write, so either all of them exist afterwards or none do. Entries whose key already exists with a
+// different value, or that would make the policy invalid, fail the whole
+// request.
+func instantiateTemplate(c *gin.Context, state *common.State) {
+	var req InstantiateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	list, err := getTemplatesFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse templates"})
+		return
+	}
+	i := indexOf(list, c.Param("name"))
+	if i < 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Template not found"})
+		return
+	}
+	t := list[i]
+
+	values, err := resolveParams(t, req.Params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	rendered, _ := render(t.Body, values).(map[string]interface{})
+	for name := range rendered {
+		if state.SectionDisabled(name) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Section %q belongs to a disabled module", name)})
+			return
+		}
+	}
+	// The template's resources are the caller's to create, as if posted to
+	// their modules
+	if resource, denied := common.UnauthorizedSection(c, http.MethodPost, rendered); denied {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: fmt.Sprintf("Instantiating this template needs the %s:write scope", resource)})
+		return
+	}
+
+	defaults, err := state.RequestDefaults(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	current := state.Snapshot()
+	updates, created, err := merge(current, rendered, common.NewRequestMeta(c), defaults)
+	if err != nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Only fail on problems the template introduces, not ones already there
+	proposed := make(map[string]interface{}, len(current)+len(updates))
+	for k, v := range current {
+		proposed[k] = v
+	}
+	for k, v := range updates {
+		proposed[k] = v
+	}
+	if issues := newErrors(validate.State(current), validate.State(proposed)); len(issues) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Template would make the policy invalid", "issues": issues})
+		return
+	}
+
+	resp := InstantiateResponse{Template: t.Name, DryRun: req.DryRun, Created: created, Rendered: rendered}
+	if req.DryRun {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	if err := state.UpdateKeysAndSaveContext(c.Request.Context(), updates); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save template resources"})
+		return
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+// checkTemplate validates a template's parameters and sections, and that
+// the body only references declared parameters.
+func checkTemplate(t Template) error {
+	if strings.ContainsAny(t.Name, "/ ") {
+		return fmt.Errorf("Invalid name %q: must not contain '/' or spaces", t.Name)
+	}
+	declared := make(map[string]bool, len(t.Parameters))
+	for _, p := range t.Parameters {
+		if !paramName.MatchString(p.Name) {
+			return fmt.Errorf("Invalid parameter name %q", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("Duplicate parameter %q", p.Name)
+		}
+		declared[p.Name] = true
+	}
+	if len(t.Body) == 0 {
+		return fmt.Errorf("Template body is empty")
+	}
+	for name, v := range t.Body {
+		sec, ok := sections[name]
+		if !ok {
+			return fmt.Errorf("Unsupported section %q in template body", name)
+		}
+		if _, isList := v.([]interface{}); sec.list && !isList {
+			return fmt.Errorf("Section %q must be a list", name)
+		}
+		if _, isMap := v.(map[string]interface{}); !sec.list && !isMap {
+			return fmt.Errorf("Section %q must be an object", name)
+		}
+	}
+	var undeclared []string
+	walkStrings(t.Body, func(s string) {
+		for _, m := range placeholder.FindAllStringSubmatch(s, -1) {
+			if !declared[m[1]] {
+				undeclared = append(undeclared, m[1])
+			}
+		}
+	})
+	if len(undeclared) > 0 {
+		sort.Strings(undeclared)
+		return fmt.Errorf("Template references undeclared parameters: %s", strings.Join(slices.Compact(undeclared), ", "))
+	}
+	return nil
+}
+
+// resolveParams fills in defaults and rejects missing or unknown values.
+func resolveParams(t Template, given map[string]string) (map[string]string, error) {
+	values := make(map[string]string, len(t.Parameters))
+	var missing []string
+	for _, p := range t.Parameters {
+		switch v, ok := given[p.Name]; {
+		case ok:
+			values[p.Name] = v
+		case p.Default != nil:
+			values[p.Name] = *p.Default
+		default:
+			missing = append(missing, p.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("Missing parameters: %s", strings.Join(missing, ", "))
+	}
+	for name := range given {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("Unknown parameter %q", name)
+		}
+	}
+	return values, nil
+}
+
+// render returns a copy of v with ${name} replaced in every string,
+// including object keys.
+func render(v interface{}, values map[string]string) interface{} {
+	switch val := v.(type) {
+	case string:
+		return placeholder.ReplaceAllStringFunc(val, func(m string) string {
+			return values[m[2:len(m)-1]]
+		})
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = render(item, values)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[render(k, values).(string)] = render(item, values)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func walkStrings(v interface{}, fn func(string)) {
+	switch val := v.(type) {
+	case string:
+		fn(val)
+	case []interface{}:
+		for _, item := range val {
+			walkStrings(item, fn)
+		}
+	case map[string]interface{}:
+		for k, item := range val {
+			fn(k)
+			walkStrings(item, fn)
+		}
+	}
+}
+
+// merge adds the rendered sections to the current state, returning the
+// state keys to write and what was created, stamped with meta (and, where
+// the section has them, defaults). Map entries that already exist with the
+// same value are left alone; with a different value they conflict.
+func merge(current, rendered map[string]interface{}, meta common.EntryMeta, defaults common.EntryDefaults) (map[string]interface{}, map[string][]string, error) {
+	updates := make(map[string]interface{})
+	created := make(map[string][]string)
+
+	for _, name := range sortedKeys(rendered) {
+		sec := sections[name]
+		if sec.list {
+			var entries []interface{}
+			if err := roundTrip(current[name], &entries); err != nil {
+				return nil, nil, fmt.Errorf("Failed to parse %s", name)
+			}
+			items, _ := rendered[name].([]interface{})
+			for _, item := range items {
+				entry, ok := normalize(item).(map[string]interface{})
+				if !ok {
+					return nil, nil, fmt.Errorf("Entries of %s must be objects", name)
+				}
+				id := uuid.NewString()
+				entry["id"] = id
+				stamp(entry, meta)
+				if slices.Contains(common.DefaultedSections, name) {
+					defaults.Apply(entry)
+				}
+				entries = append(entries, entry)
+				created[name] = append(created[name], id)
+			}
+			updates[name] = entries
+			continue
+		}
+
+		m := map[string]interface{}{}
+		if err := roundTrip(current[name], &m); err != nil {
+			return nil, nil, fmt.Errorf("Failed to parse %s", name)
+		}
+		entriesMeta := map[string]common.EntryMeta{}
+		if err := roundTrip(current[common.SectionMetaKey(name)], &entriesMeta); err != nil {
+			return nil, nil, fmt.Errorf("Failed to parse %s", name)
+		}
+		items, _ := rendered[name].(map[string]interface{})
+		for _, key := range sortedKeys(items) {
+			value := normalize(items[key])
+			full := key
+			if !strings.HasPrefix(full, sec.prefix) {
+				full = sec.prefix + full
+			}
+			if existing, ok := m[full]; ok {
+				if reflect.DeepEqual(normalize(existing), value) {
+					continue
+				}
+				return nil, nil, fmt.Errorf("%s %q already exists with a different value", name, full)
+			}
+			m[full] = value
+			entriesMeta[strings.TrimPrefix(full, sec.prefix)] = meta
+			created[name] = append(created[name], full)
+		}
+		updates[name] = m
+		updates[common.SectionMetaKey(name)] = entriesMeta
+	}
+	return updates, created, nil
+}
+
+// stamp sets EntryMeta's fields on a decoded list entry.
+func stamp(entry map[string]interface{}, meta common.EntryMeta) {
+	var fields map[string]interface{}
+	if roundTrip(meta, &fields) == nil {
+		for k, v := range fields {
+			entry[k] = v
+		}
+	}
+}
+
+// newErrors returns the errors in after that aren't in before.
+func newErrors(before, after validate.Report) []validate.Issue {
+	seen := make(map[string]bool, len(before.Issues))
+	for _, i := range before.Issues {
+		seen[i.String()] = true
+	}
+	var out []validate.Issue
+	for _, i := range after.Issues {
+		if i.Severity == validate.SeverityError && !seen[i.String()] {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// getTemplatesFromState => read state.Data["_templates"] => []Template
+func getTemplatesFromState(state *common.State) ([]Template, error) {
+	list := []Template{}
+	if err := roundTrip(state.GetValue(stateKey), &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func indexOf(list []Template, name string) int {
+	for i := range list {
+		if list[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// roundTrip decodes in into out through JSON. A nil in leaves out as is.
+func roundTrip(in, out interface{}) error {
+	if in == nil {
+		return nil
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+func normalize(v interface{}) interface{} {
+	var out interface{}
+	if err := roundTrip(v, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
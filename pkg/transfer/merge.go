@@ -0,0 +1,92 @@
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+
+	"github.com/lbrlabs/tacl/pkg/acl/settings"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"github.com/lbrlabs/tacl/pkg/sync"
+)
+
+// MergeActor attributes the changes Merge pulls into state.
+const MergeActor = "tacl-drift-merge"
+
+// Merge returns the Merge func of a sync.DriftPolicy. It imports each
+// drifted section of the live policy through handler, as POST
+// /<resource>/import, so the change gets the usual ownership checks,
+// validation and audit. Settings are top-level keys of the policy, so one
+// of them drifting imports them all. It fails for a section no enabled
+// module manages.
+func Merge(handler http.Handler) func(ctx context.Context, d *sync.Drift) error {
+	return func(ctx context.Context, d *sync.Drift) error {
+		var live map[string]json.RawMessage
+		if err := json.Unmarshal(d.Policy, &live); err != nil {
+			return fmt.Errorf("the tailnet policy is not a JSON object: %w", err)
+		}
+
+		pulled := make(map[string]bool)
+		for _, k := range d.Sections {
+			if _, ok := settings.Known(k); ok {
+				pulled["settings"] = true
+				continue
+			}
+			if _, ok := policyfile.Sections[k]; !ok {
+				return fmt.Errorf("%q changed on the tailnet, but no module manages it", k)
+			}
+			pulled[k] = true
+		}
+		sections := make([]string, 0, len(pulled))
+		for section := range pulled {
+			sections = append(sections, section)
+		}
+		sort.Strings(sections)
+
+		for _, section := range sections {
+			body := make(map[string]json.RawMessage)
+			switch {
+			case section == "settings":
+				for k, v := range live {
+					if _, ok := settings.Known(k); ok {
+						body[k] = v
+					}
+				}
+			case live[section] != nil:
+				body[section] = live[section]
+			case policyfile.Sections[section].Kind == policyfile.KindList:
+				body[section] = json.RawMessage("[]")
+			default:
+				body[section] = json.RawMessage("{}")
+			}
+			if err := pull(ctx, handler, section, body); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// pull imports the policy file body into section through handler.
+func pull(ctx context.Context, handler http.Handler, section string, body map[string]json.RawMessage) error {
+	resource, _ := common.ResourceForSection(section)
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	path := "/" + resource + "/import"
+	req, err := common.NewInternalRequest(ctx, http.MethodPost, path, b, common.Identity{NodeName: MergeActor})
+	if err != nil {
+		return err
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code >= 300 {
+		return fmt.Errorf("POST %s: %d %s", path, rec.Code, rec.Body.String())
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package transfer
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"github.com/lbrlabs/tacl/pkg/validate"
+)
+
+// RegisterStateRoutes wires up PUT /state, which replaces the policy
+// sections of the state with a posted document: a policy file, or the
+// state as GET /state returns it. It's imported like POST /import, so
+// entries without an id get the same stable ids as with `tacl import`,
+// and ones the state already has keep theirs. Internal keys (those
+// starting with "_") are ignored.
+func RegisterStateRoutes(r *gin.Engine, state *common.State) {
+	r.PUT("/state", func(c *gin.Context) {
+		replaceState(c, state)
+	})
+	common.RegisterPolicyRoute(http.MethodPut, "/state")
+}
+
+// replaceState => PUT /state
+func replaceState(c *gin.Context, state *common.State) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read body"})
+		return
+	}
+	data, err := policyfile.Import(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	current := state.Snapshot()
+	updates, resp, ok := replacePolicy(c, state, current, data, "The document", http.StatusBadRequest)
+	if !ok {
+		return
+	}
+
+	// Only fail on problems the document introduces, not ones already there
+	proposed := make(map[string]interface{}, len(current)+len(updates))
+	for k, v := range current {
+		proposed[k] = v
+	}
+	for k, v := range updates {
+		proposed[k] = v
+	}
+	if issues := newErrors(validate.State(current), validate.State(proposed)); len(issues) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The document would make the policy invalid", "issues": issues})
+		return
+	}
+
+	if err := state.UpdateKeysAndSaveContext(c.Request.Context(), updates); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save the new state"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
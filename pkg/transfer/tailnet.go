@@ -0,0 +1,162 @@
+package transfer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"github.com/lbrlabs/tacl/pkg/sync"
+)
+
+// TailnetImportResponse is the body of a successful POST /import or PUT
+// /state.
+type TailnetImportResponse struct {
+	Sections []ImportResponse `json:"sections"`
+	// Removed are the sections the imported policy doesn't have, which the
+	// import emptied.
+	Removed []string `json:"removed,omitempty"`
+}
+
+// RegisterTailnetRoutes wires up POST /import, which replaces the policy
+// sections of the state with the policy currently applied to the tailnet.
+// Entries get the same stable ids as with `tacl import`, and ones the
+// state already has keep theirs. Without Tailscale API credentials it
+// gets 503, and 502 if the policy can't be fetched.
+func RegisterTailnetRoutes(r *gin.Engine, state *common.State, httpClient *http.Client, tailnetName string) {
+	r.POST("/import", func(c *gin.Context) {
+		importTailnet(c, state, httpClient, tailnetName)
+	})
+	common.RegisterPolicyRoute(http.MethodPost, "/import")
+}
+
+// importTailnet => POST /import
+func importTailnet(c *gin.Context, state *common.State, httpClient *http.Client, tailnetName string) {
+	if httpClient == nil || tailnetName == "" {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "No Tailscale API credentials or tailnet configured"})
+		return
+	}
+	raw, err := sync.FetchRemote(c.Request.Context(), httpClient, tailnetName)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Failed to fetch the tailnet policy: " + err.Error()})
+		return
+	}
+	data, err := policyfile.Import(raw)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Failed to parse the tailnet policy: " + err.Error()})
+		return
+	}
+
+	updates, resp, ok := replacePolicy(c, state, state.Snapshot(), data, "The tailnet policy", http.StatusBadGateway)
+	if !ok {
+		return
+	}
+	if err := state.UpdateKeysAndSaveContext(c.Request.Context(), updates); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save the imported policy"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// replacePolicy works out the state keys that replace the policy sections
+// of current with data, as POST /import and PUT /state do. Each section of
+// data is imported like POST /<resource>/import, and the managed sections
+// data doesn't have are emptied. The caller needs write access to every
+// section either way. A section that isn't shaped like its kind
+// is answered with badShape, blaming source. If it fails, the request has
+// been answered and ok is false.
+func replacePolicy(c *gin.Context, state *common.State, current, data map[string]interface{}, source string, badShape int) (updates map[string]interface{}, resp TailnetImportResponse, ok bool) {
+	defaults, err := state.RequestDefaults(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return nil, resp, false
+	}
+	updates = make(map[string]interface{})
+	resp = TailnetImportResponse{Sections: []ImportResponse{}}
+
+	sections := make([]string, 0, len(data))
+	for section := range data {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		if state.SectionDisabled(section) || strings.HasPrefix(section, "_") {
+			continue
+		}
+		value := data[section]
+		if info, ok := policyfile.Sections[section]; ok {
+			if !shaped(info.Kind, value) {
+				c.JSON(badShape, ErrorResponse{Error: fmt.Sprintf("%s's %s has an unexpected shape", source, section)})
+				return nil, resp, false
+			}
+			stamped, err := stamp(c, state, current, section, value, defaults)
+			if err != nil {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+				return nil, resp, false
+			}
+			for k, v := range stamped {
+				updates[k] = v
+			}
+		} else {
+			updates[section] = value
+		}
+		resp.Sections = append(resp.Sections, ImportResponse{Section: section, Entries: count(updates[section])})
+	}
+
+	// Empty the managed sections the tailnet doesn't have, with the same
+	// ownership checks as importing an empty section
+	managed := make([]string, 0, len(policyfile.Sections))
+	for section := range policyfile.Sections {
+		managed = append(managed, section)
+	}
+	sort.Strings(managed)
+	for _, section := range managed {
+		if _, ok := data[section]; ok || current[section] == nil || state.SectionDisabled(section) {
+			continue
+		}
+		var empty interface{}
+		switch policyfile.Sections[section].Kind {
+		case policyfile.KindList:
+			empty = []interface{}{}
+		case policyfile.KindMap:
+			empty = map[string]interface{}{}
+		}
+		stamped, err := stamp(c, state, current, section, empty, defaults)
+		if err != nil {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+			return nil, resp, false
+		}
+		for k, v := range stamped {
+			updates[k] = v
+		}
+		if count(updates[section]) > 0 {
+			// Only disabled or expired entries are left
+			resp.Sections = append(resp.Sections, ImportResponse{Section: section, Entries: count(updates[section])})
+			continue
+		}
+		resp.Removed = append(resp.Removed, section)
+	}
+
+	// Each section is the caller's to replace, as if imported into its module
+	if resource, denied := common.UnauthorizedSection(c, http.MethodPost, updates); denied {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: fmt.Sprintf("Replacing the %s section needs the %s:write scope", resource, resource)})
+		return nil, resp, false
+	}
+	return updates, resp, true
+}
+
+// shaped reports whether value fits a section of the given kind.
+func shaped(kind string, value interface{}) bool {
+	switch kind {
+	case policyfile.KindList:
+		_, ok := value.([]interface{})
+		return ok
+	case policyfile.KindMap:
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return true
+}
@@ -0,0 +1,265 @@
+// Package transfer exports and imports single policy sections, in the shape
+// they take in a Tailscale policy file, so one section can be moved between
+// environments without touching the rest of the policy. It also imports
+// the whole policy currently applied to the tailnet.
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/lbrlabs/tacl/pkg/validate"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ImportResponse is the body of a successful POST /<resource>/import.
+type ImportResponse struct {
+	Section string `json:"section"`
+	// Entries is how many entries the section holds after the import.
+	Entries int `json:"entries"`
+}
+
+// RegisterRoutes wires up export and import for the module mounted at
+// resource (e.g. "groups"):
+//
+//	GET  /<resource>/export => the section as a policy file (?format=json|hujson)
+//	POST /<resource>/import => replace the section with the one in a policy file
+func RegisterRoutes(r *gin.Engine, state *common.State, resource string) {
+	section, ok := common.SectionForResource(resource)
+	if !ok {
+		return
+	}
+	r.GET("/"+resource+"/export", func(c *gin.Context) {
+		exportSection(c, state, section)
+	})
+	r.POST("/"+resource+"/import", func(c *gin.Context) {
+		importSection(c, state, section)
+	})
+}
+
+func exportSection(c *gin.Context, state *common.State, section string) {
+	format := c.DefaultQuery("format", policyfile.FormatJSON)
+	if format != policyfile.FormatJSON && format != policyfile.FormatHuJSON {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "format must be json or hujson"})
+		return
+	}
+	out, err := policyfile.ExportSection(state.Snapshot(), section, format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export " + section})
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", out)
+}
+
+func importSection(c *gin.Context, state *common.State, section string) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read body"})
+		return
+	}
+	value, err := policyfile.ImportSection(body, section)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	defaults, err := state.RequestDefaults(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	current := state.Snapshot()
+	updates, err := stamp(c, state, current, section, value, defaults)
+	if err != nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Only fail on problems the import introduces, not ones already there
+	proposed := make(map[string]interface{}, len(current)+len(updates))
+	for k, v := range current {
+		proposed[k] = v
+	}
+	for k, v := range updates {
+		proposed[k] = v
+	}
+	if issues := newErrors(validate.State(current), validate.State(proposed)); len(issues) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Import would make the policy invalid", "issues": issues})
+		return
+	}
+
+	if err := state.UpdateKeysAndSaveContext(c.Request.Context(), updates); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save " + section})
+		return
+	}
+	c.JSON(http.StatusOK, ImportResponse{Section: section, Entries: count(updates[section])})
+}
+
+// stamp returns the state keys to write for importing value into section,
+// with entry metadata. List entries equal to one already there (ignoring
+// TACL's own fields) are replaced by it, keeping its id and metadata; the
+// rest are new, and get defaults where the section has labels. Disabled
+// and expired entries aren't in policy files, so they're kept. Map entries
+// keep their metadata unless their value changes. It fails if an entry the
+// import changes or removes is owned by another source.
+func stamp(c *gin.Context, state *common.State, current map[string]interface{}, section string, value interface{}, defaults common.EntryDefaults) (map[string]interface{}, error) {
+	info := policyfile.Sections[section]
+	updates := map[string]interface{}{section: value}
+
+	switch info.Kind {
+	case policyfile.KindList:
+		var existing []map[string]interface{}
+		if err := roundTrip(current[section], &existing); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s", section)
+		}
+		var meta map[string]interface{}
+		if err := roundTrip(common.NewRequestMeta(c), &meta); err != nil {
+			return nil, err
+		}
+
+		unchanged := make(map[string][]int)
+		for i, e := range existing {
+			k := entryKey(e)
+			unchanged[k] = append(unchanged[k], i)
+		}
+		kept := make([]bool, len(existing))
+		list := value.([]interface{})
+		for i, item := range list {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Entries of %s must be objects", section)
+			}
+			k := entryKey(entry)
+			if same := unchanged[k]; len(same) > 0 {
+				list[i], kept[same[0]] = existing[same[0]], true
+				unchanged[k] = same[1:]
+				continue
+			}
+			for k, v := range meta {
+				entry[k] = v
+			}
+			if slices.Contains(common.DefaultedSections, section) {
+				defaults.Apply(entry)
+			}
+		}
+
+		now := time.Now()
+		for i, e := range existing {
+			if kept[i] {
+				continue
+			}
+			if common.InactiveEntry(e, now) {
+				list = append(list, e)
+				continue
+			}
+			var m common.EntryMeta
+			if err := roundTrip(e, &m); err != nil {
+				return nil, fmt.Errorf("Failed to parse %s", section)
+			}
+			if err := state.CheckManaged(c, m); err != nil {
+				return nil, fmt.Errorf("An entry of %s is %s", section, err.Error())
+			}
+		}
+		updates[section] = list
+
+	case policyfile.KindMap:
+		before := map[string]interface{}{}
+		if err := roundTrip(current[section], &before); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s", section)
+		}
+		after := value.(map[string]interface{})
+		oldMeta := common.LoadSectionMeta(state, section)
+		newMeta := make(map[string]common.EntryMeta, len(after))
+		for key, old := range before {
+			if key == "defaultSourcePosture" {
+				continue
+			}
+			name := strings.TrimPrefix(key, info.Prefix)
+			v, kept := after[key]
+			if kept && reflect.DeepEqual(old, v) {
+				if m, ok := oldMeta[name]; ok {
+					newMeta[name] = m
+				}
+				continue
+			}
+			if err := state.CheckManaged(c, oldMeta[name]); err != nil {
+				return nil, fmt.Errorf("%s %q is %s", section, key, err.Error())
+			}
+			if kept {
+				newMeta[name] = oldMeta[name].Touched(common.Actor(c))
+			}
+		}
+		for key := range after {
+			if key == "defaultSourcePosture" {
+				continue
+			}
+			if _, ok := before[key]; !ok {
+				newMeta[strings.TrimPrefix(key, info.Prefix)] = common.NewRequestMeta(c)
+			}
+		}
+		updates[common.SectionMetaKey(section)] = newMeta
+	}
+	return updates, nil
+}
+
+// newErrors returns the errors in after that aren't in before.
+func newErrors(before, after validate.Report) []validate.Issue {
+	seen := make(map[string]bool, len(before.Issues))
+	for _, i := range before.Issues {
+		seen[i.String()] = true
+	}
+	var out []validate.Issue
+	for _, i := range after.Issues {
+		if i.Severity == validate.SeverityError && !seen[i.String()] {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// entryKey identifies a list entry by what's pushed for it, without its id.
+func entryKey(entry map[string]interface{}) string {
+	bare := make(map[string]interface{}, len(entry))
+	for k, v := range entry {
+		bare[k] = v
+	}
+	delete(bare, "id")
+	sync.StripEntry(bare)
+	b, _ := json.Marshal(bare)
+	return string(b)
+}
+
+func count(v interface{}) int {
+	switch t := v.(type) {
+	case []interface{}:
+		return len(t)
+	case map[string]interface{}:
+		return len(t)
+	}
+	return 0
+}
+
+func roundTrip(in, out interface{}) error {
+	if in == nil {
+		return nil
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
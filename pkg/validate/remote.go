@@ -0,0 +1,54 @@
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/sync"
+)
+
+// Remote sends the policy TACL would push for data to Tailscale's validate
+// endpoint, which also runs the ACL tests, and returns what it rejected as
+// issues under "tailscale". An error means Tailscale couldn't be asked.
+func Remote(ctx context.Context, httpClient *http.Client, tailnetName string, data map[string]interface{}) ([]Issue, error) {
+	policy, err := sync.PolicyJSON(&common.State{Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("building policy: %w", err)
+	}
+	err = sync.ValidateRemote(ctx, httpClient, tailnetName, policy)
+
+	var verr *sync.ValidationError
+	switch {
+	case err == nil:
+		return nil, nil
+	case errors.As(err, &verr):
+		return remoteIssues(verr), nil
+	default:
+		return nil, fmt.Errorf("remote validation: %w", err)
+	}
+}
+
+// testFailure is how Tailscale details a failing ACL test.
+type testFailure struct {
+	User   string   `json:"user"`
+	Errors []string `json:"errors"`
+}
+
+func remoteIssues(verr *sync.ValidationError) []Issue {
+	issues := []Issue{{Severity: SeverityError, Path: "tailscale", Message: verr.Message}}
+	for _, d := range verr.Data {
+		var f testFailure
+		if json.Unmarshal(d, &f) != nil || f.User == "" || len(f.Errors) == 0 {
+			issues = append(issues, Issue{Severity: SeverityError, Path: "tailscale", Message: string(d)})
+			continue
+		}
+		for _, e := range f.Errors {
+			issues = append(issues, Issue{Severity: SeverityError, Path: "tailscale.tests." + f.User, Message: e})
+		}
+	}
+	return issues
+}
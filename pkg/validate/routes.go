@@ -0,0 +1,156 @@
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"github.com/tailscale/hujson"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Request is the body of POST /validate: either a whole document, checked
+// on its own, or changes to the current state. The body may be HuJSON, and
+// may be a policy file on its own.
+//
+// Example JSON: { "changes": { "hosts": { "db": "10.0.0.5" } }, "remote": true }
+type Request struct {
+	// Policy is a Tailscale policy file or a TACL state, as a JSON object
+	// or as a string of JSON or HuJSON.
+	Policy json.RawMessage `json:"policy,omitempty"`
+	// Changes replace top-level sections of the current state; a null
+	// section is removed.
+	Changes map[string]json.RawMessage `json:"changes,omitempty"`
+	// Remote also runs Tailscale's validate API, including the ACL tests,
+	// on the resulting policy.
+	Remote bool `json:"remote,omitempty"`
+}
+
+// Response is the result of POST /validate.
+type Response struct {
+	// Valid is set if there are no errors, local or remote.
+	Valid    bool    `json:"valid"`
+	Errors   int     `json:"errors"`
+	Warnings int     `json:"warnings"`
+	Issues   []Issue `json:"issues"`
+	// Introduced, for changes, are the local errors the current state
+	// doesn't already have: the ones --validate-writes=reject would refuse
+	// them for.
+	Introduced []Issue `json:"introduced,omitempty"`
+}
+
+// RegisterRoutes wires up POST /validate, which checks a policy without
+// saving or syncing it. httpClient and tailnetName are for "remote"; a
+// request asking for it gets 503 without them, and 502 if Tailscale can't
+// be reached.
+func RegisterRoutes(r *gin.Engine, state *common.State, httpClient *http.Client, tailnetName string) {
+	r.POST("/validate", func(c *gin.Context) {
+		validateRequest(c, state, httpClient, tailnetName)
+	})
+}
+
+// validateRequest => POST /validate
+func validateRequest(c *gin.Context, state *common.State, httpClient *http.Client, tailnetName string) {
+	req, err := readRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if (len(req.Policy) == 0) == (req.Changes == nil) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Exactly one of 'policy' or 'changes' is required"})
+		return
+	}
+	if req.Remote && (httpClient == nil || tailnetName == "") {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "No Tailscale API credentials or tailnet configured"})
+		return
+	}
+
+	var data map[string]interface{}
+	var before *Report
+	if req.Changes != nil {
+		data = state.Snapshot()
+		current := State(data)
+		before = &current
+		for k, raw := range req.Changes {
+			var v interface{}
+			if err := json.Unmarshal(raw, &v); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid section " + k + ": " + err.Error()})
+				return
+			}
+			if v == nil {
+				delete(data, k)
+			} else {
+				data[k] = v
+			}
+		}
+	} else {
+		doc := []byte(req.Policy)
+		var text string
+		if json.Unmarshal(req.Policy, &text) == nil {
+			doc = []byte(text)
+		}
+		if data, err = policyfile.Import(doc); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	report := State(data)
+	resp := Response{}
+	if before != nil {
+		resp.Introduced = Introduced(*before, report)
+	}
+	if req.Remote {
+		issues, err := Remote(c.Request.Context(), httpClient, tailnetName, data)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, ErrorResponse{Error: err.Error()})
+			return
+		}
+		report.Issues = append(report.Issues, issues...)
+	}
+	resp.Valid = report.OK()
+	resp.Errors, resp.Warnings = report.Errors(), report.Warnings()
+	resp.Issues = report.Issues
+	if resp.Issues == nil {
+		resp.Issues = []Issue{}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// readRequest parses the body of POST /validate, which may be HuJSON, so
+// a policy can be pasted in with its comments and trailing commas. A body
+// without any of Request's fields is taken to be the policy itself, so a
+// policy file can be posted as it is.
+func readRequest(c *gin.Context) (Request, error) {
+	var req Request
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return req, errors.New("Failed to read body")
+	}
+	std, err := hujson.Standardize(body)
+	if err != nil {
+		return req, fmt.Errorf("parsing body: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(std, &fields); err != nil {
+		return req, fmt.Errorf("body must be a JSON object: %w", err)
+	}
+	_, hasPolicy := fields["policy"]
+	_, hasChanges := fields["changes"]
+	_, hasRemote := fields["remote"]
+	if len(fields) > 0 && !hasPolicy && !hasChanges && !hasRemote {
+		req.Policy = std
+		return req, nil
+	}
+	err = json.Unmarshal(std, &req)
+	return req, err
+}
@@ -0,0 +1,80 @@
+package validate
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+	"go.uber.org/zap"
+)
+
+// Save check modes.
+const (
+	ModeWarn   = "warn"   // invalid changes are logged and saved
+	ModeReject = "reject" // invalid changes are rejected with 422
+)
+
+// RejectedResponse is returned with 422 for a change that would make the
+// policy invalid.
+type RejectedResponse struct {
+	Error string `json:"error"`
+	// Issues are the errors the change would have introduced.
+	Issues []Issue `json:"issues"`
+}
+
+// Introduced returns the errors in after that aren't in before. Issues are
+// matched by message rather than path, so entries that only moved (e.g.
+// after a deletion earlier in the list) aren't counted as new.
+func Introduced(before, after Report) []Issue {
+	seen := make(map[string]int)
+	for _, i := range before.Issues {
+		if i.Severity == SeverityError {
+			seen[i.Message]++
+		}
+	}
+	var out []Issue
+	for _, i := range after.Issues {
+		if i.Severity != SeverityError {
+			continue
+		}
+		if seen[i.Message] > 0 {
+			seen[i.Message]--
+			continue
+		}
+		out = append(out, i)
+	}
+	return out
+}
+
+// SaveCheck returns a common.State SaveCheck that validates the whole
+// state a change would leave. Only errors the change introduces count, so
+// a state that's already invalid can still be fixed one change at a time.
+// In ModeReject such a change fails with a *common.Rejection (422); in
+// ModeWarn it's logged and saved anyway.
+func SaveCheck(mode string, logger *zap.Logger) (func(before, after map[string]interface{}) error, error) {
+	if mode != ModeWarn && mode != ModeReject {
+		return nil, fmt.Errorf("unknown mode %q (want %s or %s)", mode, ModeWarn, ModeReject)
+	}
+	return func(before, after map[string]interface{}) error {
+		issues := Introduced(State(before), State(after))
+		if len(issues) == 0 {
+			return nil
+		}
+		if mode == ModeWarn {
+			for _, i := range issues {
+				logger.Warn("Saving a change that fails validation",
+					zap.String("path", i.Path), zap.String("issue", i.Message))
+			}
+			return nil
+		}
+		msg := fmt.Sprintf("change would make the policy invalid: %s: %s", issues[0].Path, issues[0].Message)
+		if len(issues) > 1 {
+			msg += fmt.Sprintf(" (and %d more)", len(issues)-1)
+		}
+		return &common.Rejection{
+			Status: http.StatusUnprocessableEntity,
+			Body:   RejectedResponse{Error: msg, Issues: issues},
+			Reason: "failed validation: " + issues[0].Path + ": " + issues[0].Message,
+		}
+	}, nil
+}
@@ -0,0 +1,475 @@
+// Package validate checks a TACL state (or Tailscale policy) document
+// locally, without talking to Tailscale; Remote and POST /validate can
+// also ask Tailscale's validate API.
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/acl/settings"
+	"github.com/lbrlabs/tacl/pkg/acl/ssh"
+	"github.com/lbrlabs/tacl/pkg/appcap"
+)
+
+// Severities.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Issue is a single validation finding. Path points at the offending value,
+// e.g. "acls[2].dst[0]".
+type Issue struct {
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Path, i.Message)
+}
+
+// Report collects issues.
+type Report struct {
+	Issues []Issue `json:"issues"`
+}
+
+// Errors returns the number of error-severity issues.
+func (r Report) Errors() int {
+	n := 0
+	for _, i := range r.Issues {
+		if i.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+// Warnings returns the number of warning-severity issues.
+func (r Report) Warnings() int {
+	return len(r.Issues) - r.Errors()
+}
+
+// OK reports whether there are no errors.
+func (r Report) OK() bool { return r.Errors() == 0 }
+
+func (r *Report) errorf(path, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Severity: SeverityError, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) warnf(path, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Severity: SeverityWarning, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// knownSections are top-level keys TACL manages or passes through.
+var knownSections = map[string]bool{
+	"acls": true, "aclTests": true, "autoApprovers": true, "derpMap": true,
+	"grants": true, "groups": true, "hosts": true, "nodeAttrs": true,
+	"postures": true, "settings": true, "ssh": true, "sshTests": true,
+	"tagOwners": true, "tests": true, "ipsets": true,
+	"disableIPv4": true, "OneCGNATRoute": true, "randomizeClientPort": true,
+}
+
+// State validates a whole state document. Top-level keys starting with "_"
+// are TACL-internal and skipped.
+func State(data map[string]interface{}) Report {
+	var r Report
+	v := &validator{report: &r}
+	v.load(data)
+
+	for _, k := range sortedKeys(data) {
+		if !strings.HasPrefix(k, "_") && !knownSections[k] {
+			r.warnf(k, "unknown top-level key")
+		}
+	}
+
+	v.groups()
+	v.tagOwners()
+	v.hosts()
+	v.postures()
+	v.acls()
+	v.ssh()
+	v.grants()
+	v.appCaps()
+	v.settings()
+	return r
+}
+
+// validator carries decoded sections so rules can cross-reference them.
+type validator struct {
+	report *Report
+
+	groupsMap    map[string][]string
+	tagOwnersMap map[string][]string
+	hostsMap     map[string]string
+	posturesMap  map[string][]string
+	aclList      []aclEntry
+	sshList      []sshEntry
+	grantList    []grantEntry
+	nodeAttrList []appEntry
+	settingsCfg  *settings.Settings
+}
+
+// appEntry is the part of a grant or node attribute naming app
+// capabilities.
+type appEntry struct {
+	App map[string]interface{} `json:"app"`
+}
+
+type grantEntry struct {
+	appEntry
+	Src        []string `json:"src"`
+	Dst        []string `json:"dst"`
+	IP         []string `json:"ip"`
+	Via        []string `json:"via"`
+	SrcPosture []string `json:"srcPosture"`
+}
+
+type aclEntry struct {
+	Action     string   `json:"action"`
+	Src        []string `json:"src"`
+	Dst        []string `json:"dst"`
+	Proto      string   `json:"proto"`
+	SrcPosture []string `json:"srcPosture"`
+}
+
+type sshEntry struct {
+	Action      string   `json:"action"`
+	Src         []string `json:"src"`
+	Dst         []string `json:"dst"`
+	Users       []string `json:"users"`
+	CheckPeriod string   `json:"checkPeriod"`
+	AcceptEnv   []string `json:"acceptEnv"`
+}
+
+func (v *validator) load(data map[string]interface{}) {
+	decode := func(key string, out interface{}) {
+		raw, ok := data[key]
+		if !ok || raw == nil {
+			return
+		}
+		b, err := json.Marshal(raw)
+		if err == nil {
+			err = json.Unmarshal(b, out)
+		}
+		if err != nil {
+			v.report.errorf(key, "unexpected shape: %v", err)
+		}
+	}
+	decode("groups", &v.groupsMap)
+	decode("tagOwners", &v.tagOwnersMap)
+	decode("hosts", &v.hostsMap)
+	decode("postures", &v.posturesMap)
+	decode("acls", &v.aclList)
+	decode("ssh", &v.sshList)
+	decode("grants", &v.grantList)
+	decode("nodeAttrs", &v.nodeAttrList)
+	decode("settings", &v.settingsCfg)
+}
+
+func (v *validator) groups() {
+	for _, name := range sortedKeys(v.groupsMap) {
+		path := "groups." + name
+		if !strings.HasPrefix(name, "group:") {
+			v.report.errorf(path, "group names must start with 'group:'")
+		}
+		for i, m := range v.groupsMap[name] {
+			mp := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case strings.TrimSpace(m) == "":
+				v.report.errorf(mp, "empty group member")
+			case strings.HasPrefix(m, "group:"):
+				v.report.errorf(mp, "groups cannot contain other groups")
+			}
+		}
+	}
+}
+
+// appCaps checks the app capabilities of grants and node attributes
+// against their known schemas. Unknown Tailscale capabilities are only
+// warned about in grants, since Tailscale adds new ones; node attributes
+// only take app connectors.
+func (v *validator) appCaps() {
+	check := func(section string, list []appEntry) {
+		for i, e := range list {
+			for _, name := range sortedKeys(e.App) {
+				path := fmt.Sprintf("%s[%d].app.%s", section, i, name)
+				err := appcap.Check(section, name, e.App[name])
+				switch {
+				case err == nil:
+				case errors.Is(err, appcap.ErrUnknown) && section == appcap.SectionGrants:
+					v.report.warnf(path, "%v, passed through to Tailscale unchecked", err)
+				default:
+					v.report.errorf(path, "%v", err)
+				}
+			}
+		}
+	}
+	grantApps := make([]appEntry, len(v.grantList))
+	for i, g := range v.grantList {
+		grantApps[i] = g.appEntry
+	}
+	check(appcap.SectionGrants, grantApps)
+	check(appcap.SectionNodeAttrs, v.nodeAttrList)
+}
+
+// settings warns about settings outside settings.Schema, which Tailscale
+// may or may not accept.
+func (v *validator) settings() {
+	if v.settingsCfg == nil {
+		return
+	}
+	for _, k := range sortedKeys(v.settingsCfg.Extra) {
+		if err := settings.CheckExtra(k); err != nil {
+			v.report.errorf("settings."+k, "%v", err)
+			continue
+		}
+		v.report.warnf("settings."+k, "unknown setting, passed through to Tailscale unchecked")
+	}
+}
+
+func (v *validator) tagOwners() {
+	for _, tag := range sortedKeys(v.tagOwnersMap) {
+		path := "tagOwners." + tag
+		if !strings.HasPrefix(tag, "tag:") {
+			v.report.errorf(path, "tag names must start with 'tag:'")
+		}
+		for i, o := range v.tagOwnersMap[tag] {
+			v.checkPrincipal(fmt.Sprintf("%s[%d]", path, i), o)
+		}
+	}
+}
+
+func (v *validator) hosts() {
+	for _, name := range sortedKeys(v.hostsMap) {
+		addr := v.hostsMap[name]
+		if _, err := netip.ParseAddr(addr); err == nil {
+			continue
+		}
+		if _, err := netip.ParsePrefix(addr); err == nil {
+			continue
+		}
+		v.report.errorf("hosts."+name, "%q is not an IP address or CIDR", addr)
+	}
+}
+
+func (v *validator) postures() {
+	for _, name := range sortedKeys(v.posturesMap) {
+		if name == "defaultSourcePosture" {
+			continue
+		}
+		if !strings.HasPrefix(name, "posture:") {
+			v.report.errorf("postures."+name, "posture names must start with 'posture:'")
+		}
+		if len(v.posturesMap[name]) == 0 {
+			v.report.warnf("postures."+name, "posture has no rules")
+		}
+	}
+}
+
+func (v *validator) acls() {
+	for i, a := range v.aclList {
+		path := fmt.Sprintf("acls[%d]", i)
+		if a.Action != "accept" {
+			v.report.errorf(path+".action", "action must be 'accept', got %q", a.Action)
+		}
+		if len(a.Src) == 0 {
+			v.report.errorf(path+".src", "at least one source is required")
+		}
+		if len(a.Dst) == 0 {
+			v.report.errorf(path+".dst", "at least one destination is required")
+		}
+		for j, s := range a.Src {
+			v.checkPrincipal(fmt.Sprintf("%s.src[%d]", path, j), s)
+		}
+		for j, d := range a.Dst {
+			dp := fmt.Sprintf("%s.dst[%d]", path, j)
+			host, ports, ok := splitHostPorts(d)
+			if !ok {
+				v.report.errorf(dp, "destination %q must be host:ports", d)
+				continue
+			}
+			if err := checkPorts(ports); err != nil {
+				v.report.errorf(dp, "%v", err)
+			}
+			if host == "autogroup:danger-all" {
+				v.report.errorf(dp, "autogroup:danger-all can only be used as a source")
+			}
+			v.checkPrincipal(dp, host)
+		}
+		for j, p := range a.SrcPosture {
+			v.checkPosture(fmt.Sprintf("%s.srcPosture[%d]", path, j), p)
+		}
+	}
+}
+
+func (v *validator) ssh() {
+	for i, s := range v.sshList {
+		path := fmt.Sprintf("ssh[%d]", i)
+		if s.Action != "accept" && s.Action != "check" {
+			v.report.errorf(path+".action", "action must be 'accept' or 'check', got %q", s.Action)
+		}
+		if s.CheckPeriod != "" {
+			if s.Action != "check" {
+				v.report.warnf(path+".checkPeriod", "checkPeriod only applies to 'check' rules")
+			}
+			if _, err := time.ParseDuration(s.CheckPeriod); err != nil && s.CheckPeriod != "always" {
+				v.report.errorf(path+".checkPeriod", "invalid duration %q", s.CheckPeriod)
+			}
+		}
+		if len(s.Src) == 0 {
+			v.report.errorf(path+".src", "at least one source is required")
+		}
+		if len(s.Dst) == 0 {
+			v.report.errorf(path+".dst", "at least one destination is required")
+		}
+		if len(s.Users) == 0 {
+			v.report.errorf(path+".users", "at least one user is required")
+		}
+		for j, p := range s.Src {
+			v.checkPrincipal(fmt.Sprintf("%s.src[%d]", path, j), p)
+		}
+		for j, p := range s.Dst {
+			v.checkPrincipal(fmt.Sprintf("%s.dst[%d]", path, j), p)
+		}
+		for j, u := range s.Users {
+			if err := ssh.CheckUser(u); err != nil {
+				v.report.errorf(fmt.Sprintf("%s.users[%d]", path, j), "%v", err)
+			}
+		}
+		if ssh.LogsInAsRoot(s.Users) {
+			v.report.warnf(path+".users", "rule allows SSH as root; prefer %s or named users", ssh.NonRoot)
+		}
+		if r := ssh.Redundant(s.Users); len(r) > 0 {
+			v.report.warnf(path+".users", "%s already covers %s", ssh.NonRoot, strings.Join(r, ", "))
+		}
+		for j, e := range s.AcceptEnv {
+			if err := ssh.CheckAcceptEnv(e); err != nil {
+				v.report.errorf(fmt.Sprintf("%s.acceptEnv[%d]", path, j), "%v", err)
+			}
+		}
+	}
+}
+
+func (v *validator) grants() {
+	for i, g := range v.grantList {
+		path := fmt.Sprintf("grants[%d]", i)
+		if len(g.Src) == 0 {
+			v.report.errorf(path+".src", "at least one source is required")
+		}
+		if len(g.Dst) == 0 {
+			v.report.errorf(path+".dst", "at least one destination is required")
+		}
+		if len(g.IP) == 0 && len(g.App) == 0 {
+			v.report.errorf(path, "at least one of ip or app is required")
+		}
+		for j, s := range g.Src {
+			v.checkPrincipal(fmt.Sprintf("%s.src[%d]", path, j), s)
+		}
+		for j, d := range g.Dst {
+			dp := fmt.Sprintf("%s.dst[%d]", path, j)
+			if d == "autogroup:danger-all" {
+				v.report.errorf(dp, "autogroup:danger-all can only be used as a source")
+			}
+			v.checkPrincipal(dp, d)
+		}
+		for j, t := range g.Via {
+			vp := fmt.Sprintf("%s.via[%d]", path, j)
+			if !strings.HasPrefix(t, "tag:") {
+				v.report.errorf(vp, "via must name tags, got %q", t)
+				continue
+			}
+			v.checkPrincipal(vp, t)
+		}
+		for j, p := range g.SrcPosture {
+			v.checkPosture(fmt.Sprintf("%s.srcPosture[%d]", path, j), p)
+		}
+	}
+}
+
+// autogroups are the autogroups Tailscale accepts in rules and tagOwners.
+// autogroup:nonroot is an SSH user, checked by ssh.CheckUser instead.
+var autogroups = map[string]bool{
+	"autogroup:admin": true, "autogroup:auditor": true, "autogroup:billing-admin": true,
+	"autogroup:danger-all": true, "autogroup:internet": true, "autogroup:it-admin": true,
+	"autogroup:member": true, "autogroup:network-admin": true, "autogroup:owner": true,
+	"autogroup:self": true, "autogroup:shared": true, "autogroup:tagged": true,
+}
+
+// checkPrincipal flags references to groups, tags and autogroups that don't exist.
+func (v *validator) checkPrincipal(path, p string) {
+	switch {
+	case strings.HasPrefix(p, "autogroup:"):
+		if !autogroups[p] {
+			v.report.errorf(path, "%q is not a known autogroup", p)
+		}
+	case strings.HasPrefix(p, "group:"):
+		if _, ok := v.groupsMap[p]; !ok {
+			v.report.errorf(path, "group %q is not defined", p)
+		}
+	case strings.HasPrefix(p, "tag:"):
+		if _, ok := v.tagOwnersMap[p]; !ok {
+			v.report.warnf(path, "tag %q has no tagOwners entry", p)
+		}
+	}
+}
+
+func (v *validator) checkPosture(path, p string) {
+	if strings.HasPrefix(p, "posture:") {
+		if _, ok := v.posturesMap[p]; !ok {
+			v.report.errorf(path, "posture %q is not defined", p)
+		}
+	}
+}
+
+// splitHostPorts splits "host:ports", allowing IPv6 hosts like "[::1]:22".
+func splitHostPorts(dst string) (host, ports string, ok bool) {
+	i := strings.LastIndex(dst, ":")
+	if i <= 0 || i == len(dst)-1 {
+		return "", "", false
+	}
+	return strings.Trim(dst[:i], "[]"), dst[i+1:], true
+}
+
+// checkPorts accepts "*", or comma-separated ports and ranges like "80,443,8000-8100".
+func checkPorts(ports string) error {
+	if ports == "*" {
+		return nil
+	}
+	for _, part := range strings.Split(ports, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		if err := checkPort(lo); err != nil {
+			return err
+		}
+		if isRange {
+			if err := checkPort(hi); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkPort(p string) error {
+	n, err := strconv.Atoi(p)
+	if err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q", p)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
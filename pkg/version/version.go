@@ -0,0 +1,84 @@
+// Package version describes the running build: what was stamped in at link
+// time, what the Go toolchain recorded, and which modules and features the
+// server was started with.
+package version
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Info is the body of GET /version.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	// Modified is set for builds from a checkout with uncommitted changes.
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+	// Modules are the resource modules that are enabled, e.g. "acls".
+	Modules []string `json:"modules"`
+	// Features are the optional behaviors turned on, e.g. "sync".
+	Features []string `json:"features"`
+}
+
+// Get describes this binary. commit and date are the values stamped in with
+// -ldflags; when they're empty, the VCS information Go records is used.
+func Get(version, commit, date string) Info {
+	info := Info{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Modules:   []string{},
+		Features:  []string{},
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// Fields returns info as log fields, for the startup banner.
+func (i Info) Fields() []zap.Field {
+	return []zap.Field{
+		zap.String("version", i.Version),
+		zap.String("commit", i.Commit),
+		zap.String("buildDate", i.BuildDate),
+		zap.Bool("modified", i.Modified),
+		zap.String("goVersion", i.GoVersion),
+		zap.String("platform", i.Platform),
+		zap.Strings("modules", i.Modules),
+		zap.Strings("features", i.Features),
+	}
+}
+
+// RegisterRoutes wires up GET /version.
+//
+//	GET /version => Info
+func RegisterRoutes(r *gin.Engine, info Info) {
+	r.GET("/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, info)
+	})
+}
@@ -0,0 +1,274 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	gosync "sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lbrlabs/tacl/pkg/audit"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/diff"
+	"github.com/lbrlabs/tacl/pkg/secrets"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// Delivery tuning.
+const (
+	queueSize      = 1000
+	workers        = 4
+	maxAttempts    = 5
+	maxDeadLetters = 500
+)
+
+// Payload is the JSON body POSTed to subscribers.
+type Payload struct {
+	ID       string            `json:"id"`
+	Type     string            `json:"type"`
+	Time     time.Time         `json:"time"`
+	Actor    string            `json:"actor,omitempty"`
+	Resource string            `json:"resource,omitempty"`
+	Path     string            `json:"path,omitempty"`
+	Diff     *diff.SectionDiff `json:"diff,omitempty"`
+	Sync     *sync.Result      `json:"sync,omitempty"`
+}
+
+// DeadLetter is a delivery that failed every attempt.
+type DeadLetter struct {
+	Payload   Payload   `json:"payload"`
+	WebhookID string    `json:"webhookId"`
+	URL       string    `json:"url"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError"`
+	FailedAt  time.Time `json:"failedAt"`
+}
+
+type delivery struct {
+	sub     Subscription
+	payload Payload
+}
+
+// Dispatcher delivers change and sync events to subscriptions. It is an
+// audit.Sink, so every recorded mutation is a candidate event.
+type Dispatcher struct {
+	state  *common.State
+	client *http.Client
+	queue  chan delivery
+	logger *zap.Logger
+
+	// pending counts deliveries not yet delivered or dead-lettered
+	pending gosync.WaitGroup
+
+	// held are dead letters not saved yet because writes were blocked. It's
+	// guarded by the state's mutation lock.
+	held []DeadLetter
+}
+
+// NewDispatcher starts the delivery workers.
+func NewDispatcher(state *common.State, logger *zap.Logger) *Dispatcher {
+	d := &Dispatcher{
+		state:  state,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan delivery, queueSize),
+		logger: logger,
+	}
+	for i := 0; i < workers; i++ {
+		go d.run()
+	}
+	return d
+}
+
+// Write turns a successful mutation of a policy section into a
+// "<resource>.created|updated|deleted" event.
+func (d *Dispatcher) Write(e audit.Event) error {
+	if e.Outcome != audit.OutcomeSuccess {
+		return nil
+	}
+	if _, ok := common.SectionForResource(e.Resource); !ok {
+		return nil
+	}
+	verb := "updated"
+	switch e.Method {
+	case http.MethodPost:
+		verb = "created"
+	case http.MethodDelete:
+		verb = "deleted"
+	}
+	d.Publish(Payload{
+		Type:     e.Resource + "." + verb,
+		Time:     e.Time,
+		Actor:    e.Actor,
+		Resource: e.Resource,
+		Path:     e.Path,
+		Diff:     e.Diff,
+	})
+	return nil
+}
+
+// SyncResult publishes "sync.succeeded" or "sync.failed". Pass it to sync.Syncer.Subscribe.
+func (d *Dispatcher) SyncResult(r sync.Result) {
+	t := "sync.succeeded"
+	if !r.OK() {
+		t = "sync.failed"
+	}
+	d.Publish(Payload{Type: t, Time: r.Time, Sync: &r})
+}
+
+// Publish queues p for every subscription whose filters match its type.
+func (d *Dispatcher) Publish(p Payload) {
+	subs, err := getSubscriptionsFromState(d.state)
+	if err != nil {
+		d.logger.Error("Failed to parse webhooks", zap.Error(err))
+		return
+	}
+	if p.Time.IsZero() {
+		p.Time = time.Now().UTC()
+	}
+	for _, s := range subs {
+		if !s.Matches(p.Type) {
+			continue
+		}
+		p.ID = uuid.NewString()
+		d.pending.Add(1)
+		select {
+		case d.queue <- delivery{sub: s, payload: p}:
+		default:
+			// Publish may run while a request holds the mutation lock
+			go func(dl delivery) {
+				defer d.pending.Done()
+				d.deadLetter(dl, 0, fmt.Errorf("delivery queue full"))
+			}(delivery{sub: s, payload: p})
+		}
+	}
+}
+
+func (d *Dispatcher) run() {
+	for dl := range d.queue {
+		d.deliver(dl)
+		d.pending.Done()
+	}
+}
+
+func (d *Dispatcher) deliver(dl delivery) {
+	body, err := json.Marshal(dl.payload)
+	if err != nil {
+		return
+	}
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = d.post(dl, body); err == nil {
+			return
+		}
+		if attempt < maxAttempts {
+			time.Sleep(time.Duration(1<<(attempt-1)) * time.Second)
+		}
+	}
+	d.deadLetter(dl, maxAttempts, err)
+}
+
+// Close waits until queued deliveries have been delivered or dead-lettered,
+// or ctx is done. Dead letters take the mutation lock, so don't hold it.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook deliveries still pending: %w", ctx.Err())
+	}
+}
+
+// Sign returns the X-Tacl-Signature value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of the body keyed with the subscription secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) post(dl delivery, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, dl.sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tacl-Event", dl.payload.Type)
+	req.Header.Set("X-Tacl-Delivery", dl.payload.ID)
+	if dl.sub.Secret != "" {
+		secret, err := secrets.Resolve(req.Context(), dl.sub.Secret)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Tacl-Signature", Sign(secret, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// deadLetter records a failed delivery, keeping the most recent maxDeadLetters.
+// While the server is a standby, read-only or degraded, it mustn't write the
+// state, so dead letters are held in memory and saved with the next one
+// after that.
+func (d *Dispatcher) deadLetter(dl delivery, attempts int, cause error) {
+	d.logger.Error("Webhook delivery failed",
+		zap.String("webhook", dl.sub.ID),
+		zap.String("event", dl.payload.Type),
+		zap.Int("attempts", attempts),
+		zap.Error(cause),
+	)
+
+	d.state.LockMutations()
+	defer d.state.UnlockMutations()
+
+	d.held = lastDeadLetters(append(d.held, DeadLetter{
+		Payload:   dl.payload,
+		WebhookID: dl.sub.ID,
+		URL:       dl.sub.URL,
+		Attempts:  attempts,
+		LastError: cause.Error(),
+		FailedAt:  time.Now().UTC(),
+	}))
+	if d.state.IsStandby() || d.state.IsReadOnly() || d.state.IsDegraded() {
+		d.logger.Warn("Holding dead letter in memory while writes are blocked", zap.Int("held", len(d.held)))
+		return
+	}
+
+	letters, err := getDeadLettersFromState(d.state)
+	if err != nil {
+		d.logger.Error("Failed to parse dead letters", zap.Error(err))
+		return
+	}
+	if err := d.state.UpdateKeyAndSave(deadLettersKey, lastDeadLetters(append(letters, d.held...))); err != nil {
+		d.logger.Error("Failed to save dead letter", zap.Error(err))
+		return
+	}
+	d.held = nil
+}
+
+// lastDeadLetters trims letters to the most recent maxDeadLetters.
+func lastDeadLetters(letters []DeadLetter) []DeadLetter {
+	if len(letters) > maxDeadLetters {
+		letters = letters[len(letters)-maxDeadLetters:]
+	}
+	return letters
+}
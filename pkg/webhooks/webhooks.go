@@ -0,0 +1,364 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/secrets"
+)
+
+// Keys in state. The leading underscore keeps them out of the synced policy.
+const (
+	subscriptionsKey = "_webhooks"
+	deadLettersKey   = "_webhookDeadLetters"
+)
+
+// ErrorResponse is used for consistent error output.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Subscription is a registered webhook receiver.
+//
+// Events filters which event types are delivered, e.g. "acls.created",
+// "acls.*" or "sync.failed". An empty list receives everything.
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Matches reports whether the subscription wants events of type t.
+func (s Subscription) Matches(t string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, f := range s.Events {
+		if f == "*" || f == t {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(f, ".*"); ok && strings.HasPrefix(t, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// redacted hides the signing secret in API responses. Secret store
+// references aren't secret, so they're shown.
+func (s Subscription) redacted() Subscription {
+	if s.Secret != "" && !secrets.IsRef(s.Secret) {
+		s.Secret = "********"
+	}
+	return s
+}
+
+func init() {
+	common.RegisterRedactor(subscriptionsKey, redactSubscriptions)
+}
+
+// redactSubscriptions hides the signing secrets of the subscriptions
+// stored under subscriptionsKey.
+func redactSubscriptions(raw interface{}) interface{} {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var subs []Subscription
+	if err := json.Unmarshal(b, &subs); err != nil {
+		return nil
+	}
+	out := make([]Subscription, 0, len(subs))
+	for _, s := range subs {
+		out = append(out, s.redacted())
+	}
+	return out
+}
+
+// subscriptionRequest is the JSON body for POST and PUT /webhooks.
+type subscriptionRequest struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url" binding:"required"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// secretRefPrefixes are the secret references subscriptions may use, set
+// with AllowSecretRefs.
+var secretRefPrefixes []string
+
+// AllowSecretRefs lets subscriptions take a vault:// or awssm:// reference
+// that starts with one of prefixes as their secret, e.g.
+// "vault://secret/data/tacl-webhooks/". References are resolved with the
+// server's own credentials, so without this API callers can only set
+// literal secrets. Call it once, before serving.
+func AllowSecretRefs(prefixes []string) {
+	secretRefPrefixes = nil
+	for _, p := range prefixes {
+		if p = strings.TrimSpace(p); p != "" {
+			secretRefPrefixes = append(secretRefPrefixes, p)
+		}
+	}
+}
+
+// checkSecret accepts a literal secret or a vault:// or awssm:// reference
+// under one of the allowed prefixes that resolves. File references are
+// refused, since API callers mustn't point signing at files on the server.
+func checkSecret(ctx context.Context, secret string) error {
+	if !secrets.IsRef(secret) {
+		return nil
+	}
+	if strings.HasPrefix(secret, secrets.SchemeFile) {
+		return fmt.Errorf("secret can't be a file:// reference")
+	}
+	allowed := false
+	for _, p := range secretRefPrefixes {
+		if strings.HasPrefix(secret, p) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("secret reference isn't under an allowed prefix (see --webhook-secret-refs)")
+	}
+	if _, err := secrets.Resolve(ctx, secret); err != nil {
+		return fmt.Errorf("secret reference can't be resolved: %v", err)
+	}
+	return nil
+}
+
+// deleteRequest is the JSON body for DELETE /webhooks.
+type deleteRequest struct {
+	ID string `json:"id"`
+}
+
+// RegisterRoutes wires up the /webhooks endpoints.
+//
+//	GET    /webhooks             => list subscriptions (secrets redacted)
+//	GET    /webhooks/deadletters => deliveries that exhausted their retries
+//	GET    /webhooks/:id         => get one subscription
+//	POST   /webhooks             => create a subscription
+//	PUT    /webhooks             => update a subscription by id
+//	DELETE /webhooks             => delete a subscription by id
+func RegisterRoutes(r *gin.Engine, state *common.State) {
+	w := r.Group("/webhooks")
+	{
+		w.GET("", func(c *gin.Context) {
+			listSubscriptions(c, state)
+		})
+		w.GET("/deadletters", func(c *gin.Context) {
+			listDeadLetters(c, state)
+		})
+		w.GET("/:id", func(c *gin.Context) {
+			getSubscription(c, state)
+		})
+		w.POST("", func(c *gin.Context) {
+			createSubscription(c, state)
+		})
+		w.PUT("", func(c *gin.Context) {
+			updateSubscription(c, state)
+		})
+		w.DELETE("", func(c *gin.Context) {
+			deleteSubscription(c, state)
+		})
+	}
+}
+
+// listSubscriptions => GET /webhooks
+func listSubscriptions(c *gin.Context, state *common.State) {
+	subs, err := getSubscriptionsFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse webhooks"})
+		return
+	}
+	out := make([]Subscription, 0, len(subs))
+	for _, s := range subs {
+		out = append(out, s.redacted())
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// getSubscription => GET /webhooks/:id
+func getSubscription(c *gin.Context, state *common.State) {
+	subs, err := getSubscriptionsFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse webhooks"})
+		return
+	}
+	for _, s := range subs {
+		if s.ID == c.Param("id") {
+			c.JSON(http.StatusOK, s.redacted())
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, ErrorResponse{Error: "Webhook not found"})
+}
+
+// createSubscription => POST /webhooks
+func createSubscription(c *gin.Context, state *common.State) {
+	var req subscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !validURL(req.URL) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "url must be an absolute http(s) URL"})
+		return
+	}
+	if err := checkSecret(c.Request.Context(), req.Secret); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	subs, err := getSubscriptionsFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse webhooks"})
+		return
+	}
+	s := Subscription{
+		ID:        uuid.NewString(),
+		URL:       req.URL,
+		Secret:    req.Secret,
+		Events:    req.Events,
+		CreatedBy: common.Actor(c),
+		CreatedAt: time.Now().UTC(),
+	}
+	subs = append(subs, s)
+	if err := state.UpdateKeyAndSaveContext(c.Request.Context(), subscriptionsKey, subs); err != nil {
+		common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to save webhook"})
+		return
+	}
+	c.JSON(http.StatusCreated, s.redacted())
+}
+
+// updateSubscription => PUT /webhooks. An empty secret keeps the existing one.
+func updateSubscription(c *gin.Context, state *common.State) {
+	var req subscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.ID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing webhook ID"})
+		return
+	}
+	if !validURL(req.URL) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "url must be an absolute http(s) URL"})
+		return
+	}
+	if err := checkSecret(c.Request.Context(), req.Secret); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	subs, err := getSubscriptionsFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse webhooks"})
+		return
+	}
+	for i := range subs {
+		if subs[i].ID != req.ID {
+			continue
+		}
+		subs[i].URL = req.URL
+		subs[i].Events = req.Events
+		if req.Secret != "" {
+			subs[i].Secret = req.Secret
+		}
+		if err := state.UpdateKeyAndSaveContext(c.Request.Context(), subscriptionsKey, subs); err != nil {
+			common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to update webhook"})
+			return
+		}
+		c.JSON(http.StatusOK, subs[i].redacted())
+		return
+	}
+	c.JSON(http.StatusNotFound, ErrorResponse{Error: "Webhook not found"})
+}
+
+// deleteSubscription => DELETE /webhooks
+func deleteSubscription(c *gin.Context, state *common.State) {
+	var req deleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.ID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing or invalid webhook ID"})
+		return
+	}
+
+	subs, err := getSubscriptionsFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse webhooks"})
+		return
+	}
+	for i := range subs {
+		if subs[i].ID != req.ID {
+			continue
+		}
+		subs = append(subs[:i], subs[i+1:]...)
+		if err := state.UpdateKeyAndSaveContext(c.Request.Context(), subscriptionsKey, subs); err != nil {
+			common.RespondSaveError(c, err, ErrorResponse{Error: "Failed to delete webhook"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+		return
+	}
+	c.JSON(http.StatusNotFound, ErrorResponse{Error: "Webhook not found"})
+}
+
+// listDeadLetters => GET /webhooks/deadletters
+func listDeadLetters(c *gin.Context, state *common.State) {
+	letters, err := getDeadLettersFromState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to parse dead letters"})
+		return
+	}
+	c.JSON(http.StatusOK, letters)
+}
+
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// getSubscriptionsFromState => read state.Data["_webhooks"] => []Subscription
+func getSubscriptionsFromState(state *common.State) ([]Subscription, error) {
+	raw := state.GetValue(subscriptionsKey)
+	if raw == nil {
+		return []Subscription{}, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var subs []Subscription
+	if err := json.Unmarshal(b, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// getDeadLettersFromState => read state.Data["_webhookDeadLetters"] => []DeadLetter
+func getDeadLettersFromState(state *common.State) ([]DeadLetter, error) {
+	raw := state.GetValue(deadLettersKey)
+	if raw == nil {
+		return []DeadLetter{}, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var letters []DeadLetter
+	if err := json.Unmarshal(b, &letters); err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/bundle"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"github.com/lbrlabs/tacl/pkg/sync"
+)
+
+// ExportCmd => tacl export [--out policy.hujson]
+type ExportCmd struct {
+	Out    string `help:"Write the policy here instead of stdout" short:"O"`
+	Format string `help:"Policy file format, or terraform for provider resources and import blocks, terraform-imports for terraform import commands, or bundle for a signed state bundle" enum:"json,hujson,terraform,terraform-imports,bundle" default:"hujson"`
+
+	SignKey    string `help:"With --format bundle, the Ed25519 private key (PEM) to sign it with" type:"path" env:"TACL_BUNDLE_SIGN_KEY"`
+	Passphrase string `help:"With --format bundle, encrypt it with this passphrase" env:"TACL_BUNDLE_PASSPHRASE" secret:"true"`
+}
+
+func (e *ExportCmd) Run(cli *CLI) error {
+	logger := common.InitializeLogger(cli.Debug)
+	defer logger.Sync()
+
+	state, err := openStorage(*cli, logger)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	state.LoadFromStorage()
+
+	var out []byte
+	switch e.Format {
+	case "bundle":
+		out, err = e.bundle(state)
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+	case "terraform":
+		out, _ = policyfile.Terraform(state.Data)
+	case "terraform-imports":
+		_, imports := policyfile.Terraform(state.Data)
+		out = policyfile.TerraformImportCommands(imports)
+	default:
+		out, err = policyfile.Export(state.Data, e.Format)
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+	}
+	if e.Out == "" {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	// Bundles hold the whole state, webhook secrets included, so keep the
+	// file to its owner, even if it already existed
+	if err := os.WriteFile(e.Out, out, 0o600); err != nil {
+		return err
+	}
+	return os.Chmod(e.Out, 0o600)
+}
+
+// bundle seals the whole state, metadata included, into a signed bundle.
+func (e *ExportCmd) bundle(state *common.State) ([]byte, error) {
+	if e.SignKey == "" {
+		return nil, fmt.Errorf("--format bundle needs --sign-key")
+	}
+	pemKey, err := os.ReadFile(e.SignKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := bundle.ParsePrivateKey(pemKey)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", e.SignKey, err)
+	}
+	var buf bytes.Buffer
+	if err := state.WriteJSON(&buf); err != nil {
+		return nil, err
+	}
+	return bundle.Seal(buf.Bytes(), Version, key, e.Passphrase)
+}
+
+// ImportCmd => tacl import policy.hujson | tacl import --from-tailnet
+type ImportCmd struct {
+	File   string `arg:"" optional:"" help:"Tailscale policy file, JSON or HuJSON ('-' for stdin)"`
+	Force  bool   `help:"Do not prompt for confirmation, overwrite immediately."`
+	Format string `help:"Policy dialect of the file, or bundle for a signed state bundle" enum:"tailscale,headscale,bundle" default:"tailscale"`
+	Domain string `help:"With --format headscale, the domain appended to Headscale user names (alice => alice@DOMAIN)"`
+
+	TrustedKeys string `help:"With --format bundle, a PEM file of Ed25519 public keys one of which must have signed it" type:"path" env:"TACL_BUNDLE_TRUSTED_KEYS"`
+	Passphrase  string `help:"With --format bundle, the passphrase it was encrypted with" env:"TACL_BUNDLE_PASSPHRASE" secret:"true"`
+
+	FromTailnet  bool          `help:"Import the policy currently applied to the tailnet instead of a file"`
+	ClientID     string        `help:"Tailscale OAuth client ID, for --from-tailnet" env:"TACL_CLIENT_ID"`
+	ClientSecret string        `help:"Tailscale OAuth client secret, for --from-tailnet" env:"TACL_CLIENT_SECRET" secret:"true"`
+	TailnetName  string        `help:"Tailscale tailnet name, for --from-tailnet" env:"TACL_TAILNET"`
+	Timeout      time.Duration `help:"Timeout for fetching the tailnet policy" default:"30s"`
+}
+
+func (i *ImportCmd) Run(cli *CLI) error {
+	logger := common.InitializeLogger(cli.Debug)
+	defer logger.Sync()
+
+	if (i.File == "") == !i.FromTailnet {
+		return fmt.Errorf("import: give either a FILE or --from-tailnet")
+	}
+	source := i.File
+	var raw []byte
+	var err error
+	if i.FromTailnet {
+		if i.Format != "tailscale" {
+			return fmt.Errorf("import: --from-tailnet only reads the tailscale format")
+		}
+		source = "the policy of tailnet " + i.TailnetName
+		raw, err = i.fetchTailnet()
+	} else {
+		raw, err = readInput(i.File)
+	}
+	if err != nil {
+		return err
+	}
+	var data map[string]interface{}
+	if i.Format == "bundle" {
+		data, err = i.openBundle(raw)
+	} else if i.Format == "headscale" {
+		var warnings []string
+		data, warnings, err = policyfile.ImportHeadscale(raw, i.Domain)
+		for _, w := range warnings {
+			fmt.Fprintln(os.Stderr, "warning:", w)
+		}
+	} else {
+		data, err = policyfile.Import(raw)
+	}
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+
+	state, err := openStorage(*cli, logger)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	if !i.Force {
+		fmt.Printf("This will overwrite the TACL state at %s with %s. Proceed? (y/N): ", cli.Storage, source)
+		var answer string
+		_, _ = fmt.Scanln(&answer)
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Println("Cancelled import.")
+			return nil
+		}
+	}
+
+	jBytes, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal new state: %w", err)
+	}
+	if err := state.SaveBytesToStorage(jBytes); err != nil {
+		return fmt.Errorf("failed to save new state: %w", err)
+	}
+
+	fmt.Println("Policy has been imported.")
+	return nil
+}
+
+// fetchTailnet returns the policy currently applied to the tailnet.
+func (i *ImportCmd) fetchTailnet() ([]byte, error) {
+	if i.ClientID == "" || i.ClientSecret == "" || i.TailnetName == "" {
+		return nil, fmt.Errorf("--from-tailnet needs --client-id, --client-secret and --tailnet-name")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), i.Timeout)
+	defer cancel()
+	httpClient := sync.NewClient(sync.DefaultClientOptions, i.ClientID, i.ClientSecret)
+	raw, err := sync.FetchRemote(ctx, httpClient, i.TailnetName)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the tailnet policy: %w", err)
+	}
+	return raw, nil
+}
+
+// openBundle verifies a bundle and returns the state in it.
+func (i *ImportCmd) openBundle(raw []byte) (map[string]interface{}, error) {
+	if i.TrustedKeys == "" {
+		return nil, fmt.Errorf("--format bundle needs --trusted-keys")
+	}
+	pemKeys, err := os.ReadFile(i.TrustedKeys)
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := bundle.ParsePublicKeys(pemKeys)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", i.TrustedKeys, err)
+	}
+	m, stateJSON, err := bundle.Open(raw, trusted, i.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(stateJSON, &data); err != nil {
+		return nil, fmt.Errorf("bundle state: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Verified bundle signed by key %s, written by TACL %s at %s (sha256 %s)\n",
+		m.KeyID, m.Version, m.CreatedAt.Format(time.RFC3339), m.SHA256)
+	return data, nil
+}
+
+// BundleKeygenCmd => tacl bundle-keygen --out signing
+type BundleKeygenCmd struct {
+	Out string `help:"Write the keys to OUT.key (private) and OUT.pub (public)" default:"tacl-bundle"`
+}
+
+func (k *BundleKeygenCmd) Run() error {
+	priv, pub, err := bundle.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(k.Out+".key", priv, 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(k.Out+".pub", pub, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s.key and %s.pub\n", k.Out, k.Out)
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/lbrlabs/tacl/pkg/validate"
+	"go.uber.org/zap"
+	"tailscale.com/client/tailscale"
+)
+
+// Exit codes for tacl push, so pipelines can tell a bad policy from a flaky push.
+const (
+	pushExitInvalid  = 1 // local validation failed
+	pushExitRejected = 2 // Tailscale rejected the policy
+	pushExitFailed   = 3 // anything else: empty state, network, auth
+)
+
+// PushCmd => tacl push
+type PushCmd struct {
+	ClientID     string `help:"Tailscale OAuth client ID" env:"TACL_CLIENT_ID" required:"true"`
+	ClientSecret string `help:"Tailscale OAuth client secret" env:"TACL_CLIENT_SECRET" required:"true" secret:"true"`
+	TailnetName  string `help:"Your Tailscale tailnet name (e.g. 'mycorp.com')" env:"TACL_TAILNET" required:"true"`
+
+	Strict bool `help:"Treat validation warnings as errors"`
+	DryRun bool `help:"Validate and print the policy that would be pushed, without pushing it"`
+}
+
+// pushError carries the exit code for a failed push.
+type pushError struct {
+	code int
+	err  error
+}
+
+func (e *pushError) Error() string { return e.err.Error() }
+
+func (p *PushCmd) Run(cli *CLI) error {
+	logger := common.InitializeLogger(cli.Debug)
+	defer logger.Sync()
+
+	state, err := openStorage(*cli, logger)
+	if err != nil {
+		return &pushError{pushExitFailed, fmt.Errorf("push: %w", err)}
+	}
+	state.LoadFromStorage()
+
+	report := validate.State(state.Data)
+	for _, i := range report.Issues {
+		fmt.Fprintln(os.Stderr, i)
+	}
+	if !report.OK() || (p.Strict && report.Warnings() > 0) {
+		return &pushError{pushExitInvalid, fmt.Errorf("push: validation failed with %d error(s), %d warning(s)", report.Errors(), report.Warnings())}
+	}
+
+	if p.DryRun {
+		out, err := policyfile.Export(state.Data, policyfile.FormatJSON)
+		if err != nil {
+			return &pushError{pushExitFailed, err}
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	adminClient := tailscale.NewClient("-", nil)
+	adminClient.HTTPClient = sync.NewClient(sync.DefaultClientOptions, p.ClientID, p.ClientSecret)
+
+	if err := sync.New(state).Push(context.Background(), adminClient, p.TailnetName); err != nil {
+		var apiErr *sync.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest {
+			return &pushError{pushExitRejected, fmt.Errorf("push: Tailscale rejected the policy: %s", apiErr.Body)}
+		}
+		return &pushError{pushExitFailed, fmt.Errorf("push: %w", err)}
+	}
+	logger.Info("Push complete", zap.String("tailnet", p.TailnetName))
+	return nil
+}
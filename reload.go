@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	gosync "sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/lbrlabs/tacl/pkg/alerting"
+	"github.com/lbrlabs/tacl/pkg/cap"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/config"
+	"github.com/lbrlabs/tacl/pkg/secrets"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// reloadableFields are the ServeCmd fields a SIGHUP applies. Changes to any
+// other flag are logged as needing a restart.
+var reloadableFields = map[string]bool{
+	"ClientID":          true,
+	"ClientSecret":      true,
+	"ReadOnly":          true,
+	"AllowIdentities":   true,
+	"DenyIdentities":    true,
+	"AlertAfter":        true,
+	"AlertSlackWebhook": true,
+	"AlertPagerDutyKey": true,
+	"AlertWebhook":      true,
+	"ReloadState":       true,
+}
+
+// oauthTransport is the admin API transport. Its credentials can be swapped
+// while requests are in flight.
+type oauthTransport struct {
+	base http.RoundTripper // pooled connections, kept across rotations
+	opts sync.ClientOptions
+	rt   atomic.Value // http.RoundTripper
+}
+
+func newOAuthTransport(opts sync.ClientOptions, clientID, clientSecret string) *oauthTransport {
+	t := &oauthTransport{base: sync.NewTransport(opts), opts: opts}
+	t.Set(clientID, clientSecret)
+	return t
+}
+
+// Set switches to new OAuth client credentials; new requests fetch a fresh token.
+func (t *oauthTransport) Set(clientID, clientSecret string) {
+	t.rt.Store(sync.OAuthTransport(t.base, t.opts, clientID, clientSecret))
+}
+
+func (t *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.rt.Load().(http.RoundTripper).RoundTrip(req)
+}
+
+// apiClientOptions returns the admin API client limits configured by serve.
+func apiClientOptions(serve *ServeCmd) sync.ClientOptions {
+	opts := sync.DefaultClientOptions
+	opts.ConnectTimeout = serve.APIConnectTimeout
+	opts.RequestTimeout = serve.APITimeout
+	opts.MaxConnsPerHost = serve.APIMaxConns
+	return opts
+}
+
+// buildNotifiers returns the sync alert notifiers configured by serve.
+func buildNotifiers(serve *ServeCmd) []alerting.Notifier {
+	var notifiers []alerting.Notifier
+	if serve.AlertSlackWebhook != "" {
+		notifiers = append(notifiers, alerting.Slack{WebhookURL: serve.AlertSlackWebhook})
+	}
+	if serve.AlertPagerDutyKey != "" {
+		notifiers = append(notifiers, alerting.PagerDuty{RoutingKey: serve.AlertPagerDutyKey})
+	}
+	if serve.AlertWebhook != "" {
+		notifiers = append(notifiers, alerting.Webhook{URL: serve.AlertWebhook})
+	}
+	return notifiers
+}
+
+// reloader applies a fresh parse of flags, env and config file on SIGHUP,
+// without touching the tsnet node or the listeners.
+type reloader struct {
+	cli       CLI
+	state     *common.State
+	access    *cap.AccessList
+	alerts    *alerting.Manager
+	transport *oauthTransport // nil without OAuth credentials
+	logger    *zap.Logger
+
+	mu gosync.Mutex // serializes reloads and secret refreshes
+}
+
+// watch reloads on every SIGHUP until the process exits. With refresh > 0
+// secret references are also fetched again that often.
+func (rl *reloader) watch(refresh time.Duration) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := rl.reload(); err != nil {
+				rl.logger.Error("Reload failed; keeping the current configuration", zap.Error(err))
+			}
+		}
+	}()
+	if refresh <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(refresh) {
+			if err := rl.refreshSecrets(); err != nil {
+				rl.logger.Error("Refreshing secrets failed; keeping the current ones", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// parse re-reads flags, env and the config file and resolves secret
+// references. It reports whether there were any.
+func (rl *reloader) parse() (CLI, bool, error) {
+	var next CLI
+	parser, err := kong.New(&next,
+		kong.Name("tacl"),
+		kong.Configuration(config.Loader, configPaths()...),
+	)
+	if err != nil {
+		return next, false, err
+	}
+	if _, err := parser.Parse(os.Args[1:]); err != nil {
+		return next, false, err
+	}
+	refs, err := secrets.ResolveFields(context.Background(), &next.Serve)
+	return next, refs, err
+}
+
+func (rl *reloader) reload() error {
+	next, _, err := rl.parse()
+	if err != nil {
+		return err
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.apply(next, true)
+}
+
+// refreshSecrets fetches secret references again and applies the ones that
+// changed. Other settings still need a SIGHUP.
+func (rl *reloader) refreshSecrets() error {
+	next, refs, err := rl.parse()
+	if err != nil || !refs {
+		return err
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	updated := rl.cli
+	pv, nv := reflect.ValueOf(&updated.Serve).Elem(), reflect.ValueOf(next.Serve)
+	for i := 0; i < pv.NumField(); i++ {
+		if pv.Type().Field(i).Tag.Get("secret") == "true" {
+			pv.Field(i).Set(nv.Field(i))
+		}
+	}
+	if reflect.DeepEqual(updated.Serve, rl.cli.Serve) {
+		return nil
+	}
+	rl.logger.Info("A secret changed in the secret store; applying it")
+	return rl.apply(updated, false)
+}
+
+// apply switches the running server to next. State is re-read only for a
+// SIGHUP.
+func (rl *reloader) apply(next CLI, signaled bool) error {
+	prev, serve := &rl.cli.Serve, &next.Serve
+
+	if len(restartNeeded(rl.cli, next)) > 0 {
+		rl.logger.Warn("Some changed settings only apply after a restart",
+			zap.Strings("settings", restartNeeded(rl.cli, next)))
+	}
+
+	if serve.ClientID != prev.ClientID || serve.ClientSecret != prev.ClientSecret {
+		if rl.transport == nil {
+			rl.logger.Warn("OAuth credentials were not set at startup; a restart is needed to enable sync")
+		} else {
+			rl.transport.Set(serve.ClientID, serve.ClientSecret)
+			rl.logger.Info("Rotated OAuth credentials")
+		}
+	}
+	// Only follow the flag when it changed, so a toggle via /readonly survives reloads
+	if serve.ReadOnly != prev.ReadOnly {
+		rl.state.SetReadOnly(serve.ReadOnly)
+	}
+	rl.access.Set(cap.ParseList(serve.AllowIdentities), cap.ParseList(serve.DenyIdentities))
+	rl.alerts.Configure(buildNotifiers(serve), serve.AlertAfter)
+
+	if serve.ReloadState && signaled {
+		rl.state.LockMutations()
+		err := rl.state.Reload(context.Background())
+		rl.state.UnlockMutations()
+		if err != nil {
+			return fmt.Errorf("reloading state: %w", err)
+		}
+		rl.logger.Info("Reloaded state from storage", zap.String("storage", rl.state.Storage))
+	}
+
+	rl.cli = next
+	rl.logger.Info("Reloaded configuration")
+	return nil
+}
+
+// restartNeeded lists the flags that differ between two parses but can't be
+// applied to a running server.
+func restartNeeded(prev, next CLI) []string {
+	var changed []string
+	if prev.Storage != next.Storage || prev.S3Endpoint != next.S3Endpoint || prev.S3Region != next.S3Region {
+		changed = append(changed, "Storage")
+	}
+	if prev.Debug != next.Debug {
+		changed = append(changed, "Debug")
+	}
+	if prev.DisableModules != next.DisableModules {
+		changed = append(changed, "DisableModules")
+	}
+	pv, nv := reflect.ValueOf(prev.Serve), reflect.ValueOf(next.Serve)
+	for i := 0; i < pv.NumField(); i++ {
+		name := pv.Type().Field(i).Name
+		if reloadableFields[name] {
+			continue
+		}
+		if !reflect.DeepEqual(pv.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/audit"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// shutdown stops accepting requests, waits for in-flight ones, optionally
+// pushes once more, drains buffered audit and webhook deliveries, and finally
+// takes the mutation lock so no storage write is in progress when the
+// deferred tsnet close runs. It never releases the lock.
+func shutdown(servers []*http.Server, state *common.State, auditLog *audit.Log, finalSync func(context.Context) error, timeout time.Duration, logger *zap.Logger) {
+	logger.Info("Shutting down", zap.Duration("timeout", timeout))
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		// Shutdown waits for handlers, and so for any write they are making
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Warn("Requests still in flight at shutdown timeout", zap.Error(err))
+		}
+	}
+
+	if finalSync != nil {
+		if err := finalSync(ctx); err != nil && !errors.Is(err, sync.ErrEmptyState) {
+			logger.Error("Final sync failed", zap.Error(err))
+		}
+	}
+
+	if err := auditLog.Close(ctx); err != nil {
+		logger.Warn("Audit and webhook deliveries not drained", zap.Error(err))
+	}
+
+	// Background writers (e.g. webhook dead letters) also take this lock
+	locked := make(chan struct{})
+	go func() {
+		state.LockMutations()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-ctx.Done():
+		logger.Warn("A state write is still in progress at shutdown timeout")
+	}
+
+	// With a write queue, saves may not have reached storage yet
+	if err := state.FlushWrites(ctx); err != nil {
+		logger.Error("Queued state writes not flushed", zap.Error(err), zap.Any("writes", state.WriteStatus()))
+	}
+	logger.Info("Shutdown complete")
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/validate"
+	"go.uber.org/zap"
+)
+
+// validateOnStart logs a validation report for the loaded state before
+// anything can serve or sync it. With strict set, validation errors stop
+// the process instead, so a bad state file is never pushed on the first sync.
+func validateOnStart(state *common.State, strict bool, logger *zap.Logger) {
+	report := validate.State(state.Snapshot())
+	for _, i := range report.Issues {
+		fields := []zap.Field{zap.String("path", i.Path), zap.String("issue", i.Message)}
+		if i.Severity == validate.SeverityError {
+			logger.Error("Invalid policy in loaded state", fields...)
+		} else {
+			logger.Warn("Policy warning in loaded state", fields...)
+		}
+	}
+
+	counts := []zap.Field{zap.Int("errors", report.Errors()), zap.Int("warnings", report.Warnings())}
+	switch {
+	case report.OK():
+		logger.Info("Validated loaded state", counts...)
+	case strict:
+		logger.Fatal("Refusing to start with an invalid policy (--strict-start)", counts...)
+	default:
+		logger.Warn("Loaded state failed validation; serving and syncing it anyway (use --strict-start to refuse)", counts...)
+	}
+}
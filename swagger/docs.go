@@ -25,7 +25,7 @@ const docTemplate = `{
     "paths": {
         "/acls": {
             "get": {
-                "description": "Returns the entire list of ExtendedACLEntry objects.",
+                "description": "Returns the entire list of ExtendedACLEntry objects, optionally paginated.",
                 "consumes": [
                     "application/json"
                 ],
@@ -36,6 +36,20 @@ const docTemplate = `{
                     "ACLs"
                 ],
                 "summary": "List all ACL entries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of entries to return",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "List of ACL entries",
@@ -46,6 +60,12 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/acls.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to parse ACLs",
                         "schema": {
@@ -55,7 +75,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Updates the ACL fields for an entry identified by its UUID.",
+                "description": "Updates the ACL fields for an entry identified by its UUID. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -91,7 +111,19 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "ACL entry not found",
+                        "description": "ACL entry not found with that ID",
+                        "schema": {
+                            "$ref": "#/definitions/acls.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "ACL entry is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/acls.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "ACL entry has changed since it was read",
                         "schema": {
                             "$ref": "#/definitions/acls.ErrorResponse"
                         }
@@ -141,7 +173,7 @@ const docTemplate = `{
                         }
                     },
                     "500": {
-                        "description": "Failed to save new ACL entry",
+                        "description": "Failed to save ACL entry",
                         "schema": {
                             "$ref": "#/definitions/acls.ErrorResponse"
                         }
@@ -149,7 +181,7 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Deletes an ACL entry by specifying its ID in the request body.",
+                "description": "Deletes an ACL entry by specifying its ID in the request body. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -193,6 +225,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/acls.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "ACL entry is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/acls.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "ACL entry has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/acls.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to delete ACL entry",
                         "schema": {
@@ -202,6 +246,96 @@ const docTemplate = `{
                 }
             }
         },
+        "/acls/_delete": {
+            "post": {
+                "description": "Lists the ACL entries matching every given filter and, with \"confirm\": true, deletes them in one write.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ACLs"
+                ],
+                "summary": "Delete ACLs matching a filter",
+                "parameters": [
+                    {
+                        "description": "Filter",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/resource.FilteredDeleteRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/resource.BulkDeleteResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or invalid filter",
+                        "schema": {
+                            "$ref": "#/definitions/acls.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to delete ACLs",
+                        "schema": {
+                            "$ref": "#/definitions/acls.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/acls/by-slug/{slug}": {
+            "get": {
+                "description": "Retrieves a single ACL by its slug, the unique name chosen for it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ACLs"
+                ],
+                "summary": "Get one ACL by slug",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ACL entry slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/acls.ExtendedACLEntry"
+                        }
+                    },
+                    "404": {
+                        "description": "ACL entry not found with that slug",
+                        "schema": {
+                            "$ref": "#/definitions/acls.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to parse ACLs",
+                        "schema": {
+                            "$ref": "#/definitions/acls.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/acls/{id}": {
             "get": {
                 "description": "Retrieves a single ACL entry by its stable UUID.",
@@ -232,7 +366,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "ACL entry not found",
+                        "description": "ACL entry not found with that ID",
                         "schema": {
                             "$ref": "#/definitions/acls.ErrorResponse"
                         }
@@ -248,7 +382,7 @@ const docTemplate = `{
         },
         "/acltests": {
             "get": {
-                "description": "Returns all ExtendedACLTest items from storage.",
+                "description": "Returns all ExtendedACLTest items from storage, optionally paginated.",
                 "consumes": [
                     "application/json"
                 ],
@@ -259,6 +393,20 @@ const docTemplate = `{
                     "ACLTests"
                 ],
                 "summary": "List all ACL tests",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of entries to return",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "List of ACL test items",
@@ -269,6 +417,12 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/acltests.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to parse ACLTests",
                         "schema": {
@@ -278,7 +432,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Updates an existing ACL test by ID with new ACLTest fields.",
+                "description": "Updates an existing ACL test by ID with new ACLTest fields. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -319,6 +473,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/acltests.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "ACLTest is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/acltests.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "ACLTest has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/acltests.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to update ACLTest",
                         "schema": {
@@ -372,7 +538,7 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Deletes an ACLTest by specifying its ID in the request body.",
+                "description": "Deletes an ACLTest by specifying its ID in the request body. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -416,6 +582,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/acltests.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "ACLTest is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/acltests.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "ACLTest has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/acltests.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to delete ACLTest",
                         "schema": {
@@ -425,6 +603,50 @@ const docTemplate = `{
                 }
             }
         },
+        "/acltests/by-slug/{slug}": {
+            "get": {
+                "description": "Retrieves a single ACL test by its slug, the unique name chosen for it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ACLTests"
+                ],
+                "summary": "Get one ACL test by slug",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ACLTest slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/acltests.ExtendedACLTest"
+                        }
+                    },
+                    "404": {
+                        "description": "ACLTest not found with that slug",
+                        "schema": {
+                            "$ref": "#/definitions/acltests.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to parse ACLTests",
+                        "schema": {
+                            "$ref": "#/definitions/acltests.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/acltests/{id}": {
             "get": {
                 "description": "Retrieves an ACL test item by its stable UUID.",
@@ -498,7 +720,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Updates an existing auto-approvers struct. If none exists, returns 404.",
+                "description": "Updates an existing auto-approvers struct. If none exists, returns 404. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -539,6 +761,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/autoapprovers.ErrorResponse"
                         }
                     },
+                    "412": {
+                        "description": "autoApprovers has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/autoapprovers.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to update autoApprovers",
                         "schema": {
@@ -598,7 +826,7 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Removes the autoApprovers from state. If none exists, returns 404.",
+                "description": "Removes the autoApprovers from state. If none exists, returns 404. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -625,6 +853,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/autoapprovers.ErrorResponse"
                         }
                     },
+                    "412": {
+                        "description": "autoApprovers has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/autoapprovers.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to delete autoApprovers",
                         "schema": {
@@ -663,7 +897,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Updates the DERPMap if it exists, or returns 404 if not found.",
+                "description": "Updates the DERPMap if it exists, or returns 404 if not found. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -704,6 +938,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/derpmap.ErrorResponse"
                         }
                     },
+                    "412": {
+                        "description": "DERPMap has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/derpmap.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to update DERPMap",
                         "schema": {
@@ -763,7 +1003,7 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Removes the DERPMap from state. Returns 404 if not found.",
+                "description": "Removes the DERPMap from state. Returns 404 if not found. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -790,6 +1030,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/derpmap.ErrorResponse"
                         }
                     },
+                    "412": {
+                        "description": "DERPMap has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/derpmap.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to delete DERPMap",
                         "schema": {
@@ -799,9 +1045,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/hosts": {
+        "/grants": {
             "get": {
-                "description": "Returns an array of Host objects. The final data is a map in storage, converted back to an array.",
+                "description": "Returns the entire list of ExtendedGrant objects, optionally paginated.",
                 "consumes": [
                     "application/json"
                 ],
@@ -809,29 +1055,49 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Hosts"
+                    "Grants"
+                ],
+                "summary": "List all grants",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of entries to return",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
                 ],
-                "summary": "List all hosts",
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "List of grants",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/hosts.Host"
+                                "$ref": "#/definitions/grants.ExtendedGrant"
                             }
                         }
                     },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    },
                     "500": {
-                        "description": "Failed to parse hosts",
+                        "description": "Failed to parse grants",
                         "schema": {
-                            "$ref": "#/definitions/hosts.ErrorResponse"
+                            "$ref": "#/definitions/grants.ErrorResponse"
                         }
                     }
                 }
             },
             "put": {
-                "description": "Updates the IP for a host by matching the 'name'. Returns 404 if not found.",
+                "description": "Updates the fields of a grant identified by its UUID. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -839,17 +1105,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Hosts"
+                    "Grants"
                 ],
-                "summary": "Update an existing host",
+                "summary": "Update an existing grant",
                 "parameters": [
                     {
-                        "description": "Updated host info",
-                        "name": "host",
+                        "description": "Update grant request",
+                        "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/hosts.Host"
+                            "$ref": "#/definitions/grants.updateRequest"
                         }
                     }
                 ],
@@ -857,31 +1123,43 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/hosts.Host"
+                            "$ref": "#/definitions/grants.ExtendedGrant"
                         }
                     },
                     "400": {
-                        "description": "Bad request or missing fields",
+                        "description": "Missing or invalid request data",
                         "schema": {
-                            "$ref": "#/definitions/hosts.ErrorResponse"
+                            "$ref": "#/definitions/grants.ErrorResponse"
                         }
                     },
                     "404": {
-                        "description": "Host not found",
+                        "description": "Grant not found with that ID",
                         "schema": {
-                            "$ref": "#/definitions/hosts.ErrorResponse"
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Grant is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Grant has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to update host",
+                        "description": "Failed to update grant",
                         "schema": {
-                            "$ref": "#/definitions/hosts.ErrorResponse"
+                            "$ref": "#/definitions/grants.ErrorResponse"
                         }
                     }
                 }
             },
             "post": {
-                "description": "Creates a host mapping from name to IP. Returns 409 if the hostname already exists.",
+                "description": "Creates a new grant by generating a new UUID and storing the provided fields. Either ` + "`" + `ip` + "`" + ` or ` + "`" + `app` + "`" + ` (or both) must be set.",
                 "consumes": [
                     "application/json"
                 ],
@@ -889,17 +1167,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Hosts"
+                    "Grants"
                 ],
-                "summary": "Create a new host",
+                "summary": "Create a new grant",
                 "parameters": [
                     {
-                        "description": "Host to create",
-                        "name": "host",
+                        "description": "Grant fields",
+                        "name": "grant",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/hosts.Host"
+                            "$ref": "#/definitions/grants.Grant"
                         }
                     }
                 ],
@@ -907,31 +1185,25 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/hosts.Host"
+                            "$ref": "#/definitions/grants.ExtendedGrant"
                         }
                     },
                     "400": {
-                        "description": "Bad request or missing fields",
-                        "schema": {
-                            "$ref": "#/definitions/hosts.ErrorResponse"
-                        }
-                    },
-                    "409": {
-                        "description": "Host already exists",
+                        "description": "Bad request",
                         "schema": {
-                            "$ref": "#/definitions/hosts.ErrorResponse"
+                            "$ref": "#/definitions/grants.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to parse or save hosts",
+                        "description": "Failed to save grant",
                         "schema": {
-                            "$ref": "#/definitions/hosts.ErrorResponse"
+                            "$ref": "#/definitions/grants.ErrorResponse"
                         }
                     }
                 }
             },
             "delete": {
-                "description": "Deletes a host by name, based on JSON input { \"name\": \"...\" }.",
+                "description": "Deletes a grant by specifying its ID in the request body. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -939,23 +1211,23 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Hosts"
+                    "Grants"
                 ],
-                "summary": "Delete a host",
+                "summary": "Delete a grant",
                 "parameters": [
                     {
-                        "description": "Delete host request",
+                        "description": "Delete grant request",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/hosts.DeleteHostRequest"
+                            "$ref": "#/definitions/grants.deleteRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Host deleted",
+                        "description": "Grant deleted",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -964,9 +1236,237 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Missing name",
+                        "description": "Missing or invalid ID",
                         "schema": {
-                            "$ref": "#/definitions/hosts.ErrorResponse"
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Grant not found with that ID",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Grant is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Grant has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to delete grant",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/grants/_delete": {
+            "post": {
+                "description": "Lists the grants matching every given filter and, with \"confirm\": true, deletes them in one write.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Grants"
+                ],
+                "summary": "Delete grants matching a filter",
+                "parameters": [
+                    {
+                        "description": "Filter",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/resource.FilteredDeleteRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/resource.BulkDeleteResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or invalid filter",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to delete grants",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/grants/by-slug/{slug}": {
+            "get": {
+                "description": "Retrieves a single grant by its slug, the unique name chosen for it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Grants"
+                ],
+                "summary": "Get one grant by slug",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Grant slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ExtendedGrant"
+                        }
+                    },
+                    "404": {
+                        "description": "Grant not found with that slug",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to parse grants",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/grants/{id}": {
+            "get": {
+                "description": "Retrieves a single grant by its stable UUID.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Grants"
+                ],
+                "summary": "Get one grant by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Grant ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ExtendedGrant"
+                        }
+                    },
+                    "404": {
+                        "description": "Grant not found with that ID",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to parse grants",
+                        "schema": {
+                            "$ref": "#/definitions/grants.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/hosts": {
+            "get": {
+                "description": "Returns an array of Host objects. The final data is a map in storage, converted back to an array.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hosts"
+                ],
+                "summary": "List all hosts",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/hosts.Host"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to parse hosts",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Updates the IP for a host by matching the 'name'. Returns 404 if not found. Honors If-Match.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hosts"
+                ],
+                "summary": "Update an existing host",
+                "parameters": [
+                    {
+                        "description": "Updated host info",
+                        "name": "host",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/hosts.Host"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.Host"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request or missing fields",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
                         }
                     },
                     "404": {
@@ -975,6 +1475,133 @@ const docTemplate = `{
                             "$ref": "#/definitions/hosts.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "Host is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Host has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to update host",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a host mapping from name to IP. Returns 409 if the hostname already exists.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hosts"
+                ],
+                "summary": "Create a new host",
+                "parameters": [
+                    {
+                        "description": "Host to create",
+                        "name": "host",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/hosts.Host"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.Host"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request or missing fields",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Host already exists",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to parse or save hosts",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a host by name, based on JSON input { \"name\": \"...\" }. Honors If-Match.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hosts"
+                ],
+                "summary": "Delete a host",
+                "parameters": [
+                    {
+                        "description": "Delete host request",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/hosts.DeleteHostRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Host deleted",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Missing name",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Host not found",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Host is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Host has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/hosts.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to save changes",
                         "schema": {
@@ -1030,7 +1657,7 @@ const docTemplate = `{
         },
         "/nodeattrs": {
             "get": {
-                "description": "Returns the entire list of ExtendedNodeAttrGrant objects from state.",
+                "description": "Returns the entire list of ExtendedNodeAttrGrant objects from state, optionally paginated.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1041,6 +1668,20 @@ const docTemplate = `{
                     "NodeAttrs"
                 ],
                 "summary": "List all node attribute grants",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of entries to return",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -1051,6 +1692,12 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to parse node attributes",
                         "schema": {
@@ -1060,7 +1707,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Updates a grant by ID. If ` + "`" + `app` + "`" + ` is set, ` + "`" + `target` + "`" + ` is forced to [\"*\"].",
+                "description": "Updates a grant by ID. If ` + "`" + `app` + "`" + ` is set, ` + "`" + `target` + "`" + ` is forced to [\"*\"]. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1086,31 +1733,154 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/nodeattrs.ExtendedNodeAttrGrantDoc"
+                            "$ref": "#/definitions/nodeattrs.ExtendedNodeAttrGrantDoc"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid JSON or missing fields",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Node attribute not found with that ID",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Node attribute is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Node attribute has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to parse or update node attribute",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a new ExtendedNodeAttrGrant with either ` + "`" + `attr` + "`" + ` or ` + "`" + `app` + "`" + `. If ` + "`" + `app` + "`" + ` is set, ` + "`" + `target` + "`" + ` is forced to [\"*\"].",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "NodeAttrs"
+                ],
+                "summary": "Create a new node attribute grant",
+                "parameters": [
+                    {
+                        "description": "NodeAttrGrant input",
+                        "name": "grant",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.NodeAttrGrantInputDoc"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ExtendedNodeAttrGrantDoc"
+                        }
+                    },
+                    "400": {
+                        "description": "Either 'attr' or 'app' must be set, but not both, or 'app' is invalid",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to parse node attributes or save new grant",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes by specifying its ID in the request body. Honors If-Match.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "NodeAttrs"
+                ],
+                "summary": "Delete a node attribute grant",
+                "parameters": [
+                    {
+                        "description": "Delete NodeAttr request",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.deleteNodeAttrRequestDoc"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Node attribute deleted",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Node attribute not found with that ID",
+                        "schema": {
+                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
                         }
                     },
-                    "400": {
-                        "description": "Invalid JSON or missing fields",
+                    "409": {
+                        "description": "Node attribute is managed by another source",
                         "schema": {
                             "$ref": "#/definitions/nodeattrs.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "NodeAttr not found",
+                    "412": {
+                        "description": "Node attribute has changed since it was read",
                         "schema": {
                             "$ref": "#/definitions/nodeattrs.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to parse or update node attribute",
+                        "description": "Failed to delete node attribute",
                         "schema": {
                             "$ref": "#/definitions/nodeattrs.ErrorResponse"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/nodeattrs/_delete": {
             "post": {
-                "description": "Creates a new ExtendedNodeAttrGrant with either ` + "`" + `attr` + "`" + ` or ` + "`" + `app` + "`" + `. If ` + "`" + `app` + "`" + ` is set, ` + "`" + `target` + "`" + ` is forced to [\"*\"].",
+                "description": "Lists the grants matching every given filter (usually \"target\") and, with \"confirm\": true, deletes them in one write.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1120,41 +1890,43 @@ const docTemplate = `{
                 "tags": [
                     "NodeAttrs"
                 ],
-                "summary": "Create a new node attribute grant",
+                "summary": "Delete node attribute grants matching a filter",
                 "parameters": [
                     {
-                        "description": "NodeAttrGrant input",
-                        "name": "grant",
+                        "description": "Filter",
+                        "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/nodeattrs.NodeAttrGrantInputDoc"
+                            "$ref": "#/definitions/resource.FilteredDeleteRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/nodeattrs.ExtendedNodeAttrGrantDoc"
+                            "$ref": "#/definitions/resource.BulkDeleteResponse"
                         }
                     },
                     "400": {
-                        "description": "Either 'attr' or 'app' must be set, but not both",
+                        "description": "Missing or invalid filter",
                         "schema": {
                             "$ref": "#/definitions/nodeattrs.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to parse node attributes or save new grant",
+                        "description": "Failed to delete node attributes",
                         "schema": {
                             "$ref": "#/definitions/nodeattrs.ErrorResponse"
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Deletes by specifying its ID in the request body.",
+            }
+        },
+        "/nodeattrs/by-slug/{slug}": {
+            "get": {
+                "description": "Retrieves a single node attribute grant by its slug, the unique name chosen for it.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1164,42 +1936,31 @@ const docTemplate = `{
                 "tags": [
                     "NodeAttrs"
                 ],
-                "summary": "Delete a node attribute grant",
+                "summary": "Get one node attribute grant by slug",
                 "parameters": [
                     {
-                        "description": "Delete NodeAttr request",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/nodeattrs.deleteNodeAttrRequestDoc"
-                        }
+                        "type": "string",
+                        "description": "Node attribute slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Node attribute deleted",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
-                        }
-                    },
-                    "400": {
-                        "description": "Missing or invalid ID",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/nodeattrs.ErrorResponse"
+                            "$ref": "#/definitions/nodeattrs.ExtendedNodeAttrGrantDoc"
                         }
                     },
                     "404": {
-                        "description": "NodeAttr not found with that id",
+                        "description": "Node attribute not found with that slug",
                         "schema": {
                             "$ref": "#/definitions/nodeattrs.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Failed to delete node attribute",
+                        "description": "Failed to parse node attributes",
                         "schema": {
                             "$ref": "#/definitions/nodeattrs.ErrorResponse"
                         }
@@ -1237,7 +1998,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "No nodeattr found with that id",
+                        "description": "Node attribute not found with that ID",
                         "schema": {
                             "$ref": "#/definitions/nodeattrs.ErrorResponse"
                         }
@@ -1280,7 +2041,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Updates the posture by matching on its name. Returns 404 if not found.",
+                "description": "Updates the posture by matching on its name. Returns 404 if not found. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1321,6 +2082,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/postures.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "Posture is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/postures.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Posture has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/postures.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to update posture",
                         "schema": {
@@ -1380,7 +2153,7 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Deletes a named posture by JSON body. Expects { \"name\": \"\u003cpostureName\u003e\" }.",
+                "description": "Deletes a named posture by JSON body. Expects { \"name\": \"\u003cpostureName\u003e\" }. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1424,6 +2197,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/postures.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "Posture is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/postures.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Posture has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/postures.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to save changes",
                         "schema": {
@@ -1468,7 +2253,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Overwrites the default posture with the given array of rules.",
+                "description": "Overwrites the default posture with the given array of rules. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1509,6 +2294,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/postures.ErrorResponse"
                         }
                     },
+                    "412": {
+                        "description": "Default posture has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/postures.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to set default posture",
                         "schema": {
@@ -1518,7 +2309,7 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Removes any default posture rules by setting them to nil.",
+                "description": "Removes any default posture rules by setting them to nil. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1539,6 +2330,12 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "412": {
+                        "description": "Default posture has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/postures.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to delete default posture",
                         "schema": {
@@ -1621,7 +2418,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Updates the current settings. Returns 404 if none exist.",
+                "description": "Updates the current settings. Returns 404 if none exist. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1651,7 +2448,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid JSON body",
+                        "description": "Invalid JSON body or setting name",
                         "schema": {
                             "$ref": "#/definitions/settings.ErrorResponse"
                         }
@@ -1662,6 +2459,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/settings.ErrorResponse"
                         }
                     },
+                    "412": {
+                        "description": "Settings has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/settings.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to update settings",
                         "schema": {
@@ -1701,7 +2504,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid JSON body",
+                        "description": "Invalid JSON body or setting name",
                         "schema": {
                             "$ref": "#/definitions/settings.ErrorResponse"
                         }
@@ -1721,7 +2524,7 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Removes the current settings if present; returns 404 if none exist.",
+                "description": "Removes the current settings if present; returns 404 if none exist. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1748,6 +2551,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/settings.ErrorResponse"
                         }
                     },
+                    "412": {
+                        "description": "Settings has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/settings.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to delete settings",
                         "schema": {
@@ -1759,7 +2568,7 @@ const docTemplate = `{
         },
         "/ssh": {
             "get": {
-                "description": "Returns the entire slice of ExtendedSSHEntry from state.",
+                "description": "Returns the entire slice of ExtendedSSHEntry from state, optionally paginated.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1770,6 +2579,20 @@ const docTemplate = `{
                     "SSH"
                 ],
                 "summary": "List all SSH rules",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of entries to return",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of entries to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "List of SSH rules",
@@ -1780,6 +2603,12 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "400": {
+                        "description": "Invalid pagination parameters",
+                        "schema": {
+                            "$ref": "#/definitions/ssh.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to parse SSH rules",
                         "schema": {
@@ -1789,7 +2618,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "User must provide JSON like { \"id\":\"\u003cuuid\u003e\", \"rule\": {...} } to replace the rule with matching ID.",
+                "description": "User must provide JSON like { \"id\":\"\u003cuuid\u003e\", \"rule\": {...} } to replace the rule with matching ID. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1830,6 +2659,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/ssh.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "SSH rule is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/ssh.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "SSH rule has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/ssh.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to parse or update SSH rule",
                         "schema": {
@@ -1869,7 +2710,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid JSON or fields",
+                        "description": "Invalid JSON or fields, e.g. an invalid user or acceptEnv pattern, or root without --ssh-allow-root",
                         "schema": {
                             "$ref": "#/definitions/ssh.ErrorResponse"
                         }
@@ -1883,7 +2724,7 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "User must provide JSON like { \"id\":\"\u003cuuid\u003e\" } to remove the rule with matching ID.",
+                "description": "User must provide JSON like { \"id\":\"\u003cuuid\u003e\" } to remove the rule with matching ID. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1927,6 +2768,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/ssh.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "SSH rule is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/ssh.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "SSH rule has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/ssh.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to delete SSH rule",
                         "schema": {
@@ -1936,6 +2789,96 @@ const docTemplate = `{
                 }
             }
         },
+        "/ssh/_delete": {
+            "post": {
+                "description": "Lists the SSH rules matching every given filter and, with \"confirm\": true, deletes them in one write.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "SSH"
+                ],
+                "summary": "Delete SSH rules matching a filter",
+                "parameters": [
+                    {
+                        "description": "Filter",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/resource.FilteredDeleteRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/resource.BulkDeleteResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or invalid filter",
+                        "schema": {
+                            "$ref": "#/definitions/ssh.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to delete SSH rules",
+                        "schema": {
+                            "$ref": "#/definitions/ssh.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ssh/by-slug/{slug}": {
+            "get": {
+                "description": "Retrieves a single SSH rule by its slug, the unique name chosen for it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "SSH"
+                ],
+                "summary": "Get one SSH rule by slug",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "SSH rule slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/ssh.ExtendedSSHEntry"
+                        }
+                    },
+                    "404": {
+                        "description": "SSH rule not found with that slug",
+                        "schema": {
+                            "$ref": "#/definitions/ssh.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to parse SSH rules",
+                        "schema": {
+                            "$ref": "#/definitions/ssh.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/ssh/{id}": {
             "get": {
                 "description": "Retrieves a single ExtendedSSHEntry by its stable UUID.",
@@ -2012,7 +2955,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Updates the TagOwner with a matching name. Expects JSON: { \"name\": \"...\", \"owners\": [...] }.",
+                "description": "Updates the TagOwner with a matching name. Expects JSON: { \"name\": \"...\", \"owners\": [...] }. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -2053,6 +2996,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/tagowners.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "TagOwner is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/tagowners.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "TagOwner has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/tagowners.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to parse or save changes",
                         "schema": {
@@ -2158,7 +3113,7 @@ const docTemplate = `{
         },
         "/tagowners": {
             "delete": {
-                "description": "Expects JSON: { \"name\": \"webserver\" } to remove the matching TagOwner.",
+                "description": "Expects JSON: { \"name\": \"webserver\" } to remove the matching TagOwner. Honors If-Match.",
                 "consumes": [
                     "application/json"
                 ],
@@ -2202,6 +3157,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/tagowners.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "TagOwner is managed by another source",
+                        "schema": {
+                            "$ref": "#/definitions/tagowners.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "TagOwner has changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/tagowners.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Failed to save changes",
                         "schema": {
@@ -2221,6 +3188,14 @@ const docTemplate = `{
                     "description": "Action specifies the rule action (e.g. \"accept\" or \"deny\").",
                     "type": "string"
                 },
+                "description": {
+                    "description": "Description says what the entry is for, e.g. \"on-call access to\nproduction databases\".",
+                    "type": "string"
+                },
+                "disabled": {
+                    "description": "Disabled keeps the entry in TACL but out of the policy.",
+                    "type": "boolean"
+                },
                 "dst": {
                     "description": "Destination is a list of CIDRs or tags that match the traffic destination.",
                     "type": "array",
@@ -2228,10 +3203,25 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "expiresAt": {
+                    "description": "ExpiresAt is when the entry stops applying. Expired entries are left\nout of the policy and then removed (or disabled) by the reaper.",
+                    "type": "string"
+                },
+                "labels": {
+                    "$ref": "#/definitions/common.Labels"
+                },
+                "priority": {
+                    "description": "Priority sorts the entry among the others of its section, lowest\nfirst. Entries of the same priority are ordered by ID.",
+                    "type": "integer"
+                },
                 "proto": {
                     "description": "Protocol (proto) can specify \"tcp\", \"udp\", etc.",
                     "type": "string"
                 },
+                "slug": {
+                    "description": "Slug is e.g. \"web-to-db\".",
+                    "type": "string"
+                },
                 "src": {
                     "description": "Source is a list of CIDRs or tags that match the traffic source.",
                     "type": "array",
@@ -2264,6 +3254,20 @@ const docTemplate = `{
                     "description": "Action specifies the rule action (e.g. \"accept\" or \"deny\").",
                     "type": "string"
                 },
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
+                "description": {
+                    "description": "Description says what the entry is for, e.g. \"on-call access to\nproduction databases\".",
+                    "type": "string"
+                },
+                "disabled": {
+                    "description": "Disabled keeps the entry in TACL but out of the policy.",
+                    "type": "boolean"
+                },
                 "dst": {
                     "description": "Destination is a list of CIDRs or tags that match the traffic destination.",
                     "type": "array",
@@ -2271,14 +3275,33 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "expiresAt": {
+                    "description": "ExpiresAt is when the entry stops applying. Expired entries are left\nout of the policy and then removed (or disabled) by the reaper.",
+                    "type": "string"
+                },
                 "id": {
                     "description": "stable UUID",
                     "type": "string"
                 },
+                "labels": {
+                    "$ref": "#/definitions/common.Labels"
+                },
+                "managedBy": {
+                    "description": "ManagedBy is the source that owns the entry, e.g. \"terraform\" or\n\"manual\" (see ManagedByHeader).",
+                    "type": "string"
+                },
+                "priority": {
+                    "description": "Priority sorts the entry among the others of its section, lowest\nfirst. Entries of the same priority are ordered by ID.",
+                    "type": "integer"
+                },
                 "proto": {
                     "description": "Protocol (proto) can specify \"tcp\", \"udp\", etc.",
                     "type": "string"
                 },
+                "slug": {
+                    "description": "Slug is e.g. \"web-to-db\".",
+                    "type": "string"
+                },
                 "src": {
                     "description": "Source is a list of CIDRs or tags that match the traffic source.",
                     "type": "array",
@@ -2292,6 +3315,12 @@ const docTemplate = `{
                     "items": {
                         "type": "string"
                     }
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "updatedBy": {
+                    "type": "string"
                 }
             }
         },
@@ -2332,10 +3361,17 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "labels": {
+                    "$ref": "#/definitions/common.Labels"
+                },
                 "proto": {
                     "description": "Proto indicates the protocol (tcp, udp, etc.).",
                     "type": "string"
                 },
+                "slug": {
+                    "description": "Slug is e.g. \"web-to-db\".",
+                    "type": "string"
+                },
                 "src": {
                     "description": "Source is a string describing the traffic source (e.g., IP or user).",
                     "type": "string"
@@ -2361,6 +3397,12 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
                 "deny": {
                     "description": "Deny is a list of rules or addresses to be denied.",
                     "type": "array",
@@ -2371,13 +3413,30 @@ const docTemplate = `{
                 "id": {
                     "type": "string"
                 },
+                "labels": {
+                    "$ref": "#/definitions/common.Labels"
+                },
+                "managedBy": {
+                    "description": "ManagedBy is the source that owns the entry, e.g. \"terraform\" or\n\"manual\" (see ManagedByHeader).",
+                    "type": "string"
+                },
                 "proto": {
                     "description": "Proto indicates the protocol (tcp, udp, etc.).",
                     "type": "string"
                 },
+                "slug": {
+                    "description": "Slug is e.g. \"web-to-db\".",
+                    "type": "string"
+                },
                 "src": {
                     "description": "Source is a string describing the traffic source (e.g., IP or user).",
                     "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "updatedBy": {
+                    "type": "string"
                 }
             }
         },
@@ -2428,6 +3487,12 @@ const docTemplate = `{
                 }
             }
         },
+        "common.Labels": {
+            "type": "object",
+            "additionalProperties": {
+                "type": "string"
+            }
+        },
         "derpmap.ACLDERPMapDoc": {
             "type": "object",
             "properties": {
@@ -2490,6 +3555,189 @@ const docTemplate = `{
                 }
             }
         },
+        "grants.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "grants.ExtendedGrant": {
+            "description": "ExtendedGrant wraps a Grant with a unique ID for local storage.",
+            "type": "object",
+            "properties": {
+                "app": {
+                    "description": "App maps app capability names to the capability values granted.",
+                    "type": "object"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
+                "description": {
+                    "description": "Description says what the entry is for, e.g. \"on-call access to\nproduction databases\".",
+                    "type": "string"
+                },
+                "disabled": {
+                    "description": "Disabled keeps the entry in TACL but out of the policy.",
+                    "type": "boolean"
+                },
+                "dst": {
+                    "description": "Destination is a list of tags, hosts, CIDRs or autogroups the grant gives access to.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "expiresAt": {
+                    "description": "ExpiresAt is when the entry stops applying. Expired entries are left\nout of the policy and then removed (or disabled) by the reaper.",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "stable UUID",
+                    "type": "string"
+                },
+                "ip": {
+                    "description": "IP lists the network-layer access, e.g. \"*\", \"443\" or \"tcp:80-90\".",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "labels": {
+                    "$ref": "#/definitions/common.Labels"
+                },
+                "managedBy": {
+                    "description": "ManagedBy is the source that owns the entry, e.g. \"terraform\" or\n\"manual\" (see ManagedByHeader).",
+                    "type": "string"
+                },
+                "priority": {
+                    "description": "Priority sorts the entry among the others of its section, lowest\nfirst. Entries of the same priority are ordered by ID.",
+                    "type": "integer"
+                },
+                "slug": {
+                    "description": "Slug is e.g. \"web-to-db\".",
+                    "type": "string"
+                },
+                "src": {
+                    "description": "Source is a list of users, groups, tags, hosts or CIDRs the grant applies to.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "srcPosture": {
+                    "description": "SourcePosture lists the postures sources must satisfy.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "updatedBy": {
+                    "type": "string"
+                },
+                "via": {
+                    "description": "Via routes the access through these tags, e.g. subnet routers or exit nodes.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "grants.Grant": {
+            "description": "Grant gives sources access to destinations at the network layer (ip), the application layer (app), or both.",
+            "type": "object",
+            "properties": {
+                "app": {
+                    "description": "App maps app capability names to the capability values granted.",
+                    "type": "object"
+                },
+                "description": {
+                    "description": "Description says what the entry is for, e.g. \"on-call access to\nproduction databases\".",
+                    "type": "string"
+                },
+                "disabled": {
+                    "description": "Disabled keeps the entry in TACL but out of the policy.",
+                    "type": "boolean"
+                },
+                "dst": {
+                    "description": "Destination is a list of tags, hosts, CIDRs or autogroups the grant gives access to.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "expiresAt": {
+                    "description": "ExpiresAt is when the entry stops applying. Expired entries are left\nout of the policy and then removed (or disabled) by the reaper.",
+                    "type": "string"
+                },
+                "ip": {
+                    "description": "IP lists the network-layer access, e.g. \"*\", \"443\" or \"tcp:80-90\".",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "labels": {
+                    "$ref": "#/definitions/common.Labels"
+                },
+                "priority": {
+                    "description": "Priority sorts the entry among the others of its section, lowest\nfirst. Entries of the same priority are ordered by ID.",
+                    "type": "integer"
+                },
+                "slug": {
+                    "description": "Slug is e.g. \"web-to-db\".",
+                    "type": "string"
+                },
+                "src": {
+                    "description": "Source is a list of users, groups, tags, hosts or CIDRs the grant applies to.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "srcPosture": {
+                    "description": "SourcePosture lists the postures sources must satisfy.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "via": {
+                    "description": "Via routes the access through these tags, e.g. subnet routers or exit nodes.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "grants.deleteRequest": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                }
+            }
+        },
+        "grants.updateRequest": {
+            "type": "object",
+            "properties": {
+                "grant": {
+                    "$ref": "#/definitions/grants.Grant"
+                },
+                "id": {
+                    "type": "string"
+                }
+            }
+        },
         "hosts.DeleteHostRequest": {
             "type": "object",
             "properties": {
@@ -2514,13 +3762,29 @@ const docTemplate = `{
                 "name"
             ],
             "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
                 "ip": {
                     "description": "IP is the IP or CIDR address associated with this hostname.",
                     "type": "string"
                 },
+                "managedBy": {
+                    "description": "ManagedBy is the source that owns the entry, e.g. \"terraform\" or\n\"manual\" (see ManagedByHeader).",
+                    "type": "string"
+                },
                 "name": {
                     "description": "Name is the hostname identifier.",
                     "type": "string"
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "updatedBy": {
+                    "type": "string"
                 }
             }
         },
@@ -2572,16 +3836,44 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
                 "id": {
                     "description": "ID is the local stable UUID.",
                     "type": "string"
                 },
+                "labels": {
+                    "description": "Labels are TACL-only key/value pairs for filtering.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/common.Labels"
+                        }
+                    ]
+                },
+                "managedBy": {
+                    "description": "ManagedBy is the source that owns the entry, e.g. \"terraform\" or\n\"manual\" (see ManagedByHeader).",
+                    "type": "string"
+                },
+                "slug": {
+                    "description": "Slug names the grant in URLs, Terraform IDs and audit output.",
+                    "type": "string"
+                },
                 "target": {
                     "description": "Target is the list of node targets for the attribute grant.",
                     "type": "array",
                     "items": {
                         "type": "string"
                     }
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "updatedBy": {
+                    "type": "string"
                 }
             }
         },
@@ -2608,6 +3900,18 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "labels": {
+                    "description": "Labels are TACL-only key/value pairs for filtering.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/common.Labels"
+                        }
+                    ]
+                },
+                "slug": {
+                    "description": "Slug names the grant in URLs, Terraform IDs and audit output.",
+                    "type": "string"
+                },
                 "target": {
                     "description": "Target is a list of node targets (could be [\"*\"] if using app).",
                     "type": "array",
@@ -2670,6 +3974,16 @@ const docTemplate = `{
                 "name"
             ],
             "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
+                "managedBy": {
+                    "description": "ManagedBy is the source that owns the entry, e.g. \"terraform\" or\n\"manual\" (see ManagedByHeader).",
+                    "type": "string"
+                },
                 "name": {
                     "description": "Name is the unique name of this posture.",
                     "type": "string"
@@ -2680,6 +3994,12 @@ const docTemplate = `{
                     "items": {
                         "type": "string"
                     }
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "updatedBy": {
+                    "type": "string"
                 }
             }
         },
@@ -2700,6 +4020,50 @@ const docTemplate = `{
                 }
             }
         },
+        "resource.BulkDeleteResponse": {
+            "type": "object",
+            "properties": {
+                "deleted": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "dryRun": {
+                    "type": "boolean"
+                },
+                "entries": {
+                    "type": "array",
+                    "items": {}
+                }
+            }
+        },
+        "resource.FilteredDeleteRequest": {
+            "type": "object",
+            "properties": {
+                "confirm": {
+                    "type": "boolean"
+                },
+                "createdBefore": {
+                    "type": "string"
+                },
+                "dst": {
+                    "type": "string"
+                },
+                "label": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "src": {
+                    "type": "string"
+                },
+                "target": {
+                    "type": "string"
+                }
+            }
+        },
         "settings.ErrorResponse": {
             "type": "object",
             "properties": {
@@ -2731,7 +4095,7 @@ const docTemplate = `{
             "type": "object",
             "properties": {
                 "acceptEnv": {
-                    "description": "AcceptEnv is a list of environment variables allowed to pass through the SSH session.",
+                    "description": "AcceptEnv is a list of environment variables allowed to pass through the SSH session.\nEntries are variable names, optionally with \"*\" and \"?\" wildcards.",
                     "type": "array",
                     "items": {
                         "type": "string"
@@ -2745,6 +4109,14 @@ const docTemplate = `{
                     "description": "CheckPeriod is only meaningful if Action == \"check\" (e.g. \"12h\", \"30m\").",
                     "type": "string"
                 },
+                "description": {
+                    "description": "Description says what the entry is for, e.g. \"on-call access to\nproduction databases\".",
+                    "type": "string"
+                },
+                "disabled": {
+                    "description": "Disabled keeps the entry in TACL but out of the policy.",
+                    "type": "boolean"
+                },
                 "dst": {
                     "description": "Dst is a list of destination tags or CIDRs for this SSH rule.",
                     "type": "array",
@@ -2752,6 +4124,21 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "expiresAt": {
+                    "description": "ExpiresAt is when the entry stops applying. Expired entries are left\nout of the policy and then removed (or disabled) by the reaper.",
+                    "type": "string"
+                },
+                "labels": {
+                    "$ref": "#/definitions/common.Labels"
+                },
+                "priority": {
+                    "description": "Priority sorts the entry among the others of its section, lowest\nfirst. Entries of the same priority are ordered by ID.",
+                    "type": "integer"
+                },
+                "slug": {
+                    "description": "Slug is e.g. \"web-to-db\".",
+                    "type": "string"
+                },
                 "src": {
                     "description": "Src is a list of source tags or CIDRs allowed by this SSH rule.",
                     "type": "array",
@@ -2789,7 +4176,7 @@ const docTemplate = `{
             "type": "object",
             "properties": {
                 "acceptEnv": {
-                    "description": "AcceptEnv is a list of environment variables allowed to pass through the SSH session.",
+                    "description": "AcceptEnv is a list of environment variables allowed to pass through the SSH session.\nEntries are variable names, optionally with \"*\" and \"?\" wildcards.",
                     "type": "array",
                     "items": {
                         "type": "string"
@@ -2803,6 +4190,20 @@ const docTemplate = `{
                     "description": "CheckPeriod is only meaningful if Action == \"check\" (e.g. \"12h\", \"30m\").",
                     "type": "string"
                 },
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
+                "description": {
+                    "description": "Description says what the entry is for, e.g. \"on-call access to\nproduction databases\".",
+                    "type": "string"
+                },
+                "disabled": {
+                    "description": "Disabled keeps the entry in TACL but out of the policy.",
+                    "type": "boolean"
+                },
                 "dst": {
                     "description": "Dst is a list of destination tags or CIDRs for this SSH rule.",
                     "type": "array",
@@ -2810,10 +4211,29 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "expiresAt": {
+                    "description": "ExpiresAt is when the entry stops applying. Expired entries are left\nout of the policy and then removed (or disabled) by the reaper.",
+                    "type": "string"
+                },
                 "id": {
                     "description": "ID is a stable UUID for each SSH rule.",
                     "type": "string"
                 },
+                "labels": {
+                    "$ref": "#/definitions/common.Labels"
+                },
+                "managedBy": {
+                    "description": "ManagedBy is the source that owns the entry, e.g. \"terraform\" or\n\"manual\" (see ManagedByHeader).",
+                    "type": "string"
+                },
+                "priority": {
+                    "description": "Priority sorts the entry among the others of its section, lowest\nfirst. Entries of the same priority are ordered by ID.",
+                    "type": "integer"
+                },
+                "slug": {
+                    "description": "Slug is e.g. \"web-to-db\".",
+                    "type": "string"
+                },
                 "src": {
                     "description": "Src is a list of source tags or CIDRs allowed by this SSH rule.",
                     "type": "array",
@@ -2821,6 +4241,12 @@ const docTemplate = `{
                         "type": "string"
                     }
                 },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "updatedBy": {
+                    "type": "string"
+                },
                 "users": {
                     "description": "Users is a list of SSH users permitted by this rule.",
                     "type": "array",
@@ -2856,6 +4282,16 @@ const docTemplate = `{
                 "name"
             ],
             "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
+                "managedBy": {
+                    "description": "ManagedBy is the source that owns the entry, e.g. \"terraform\" or\n\"manual\" (see ManagedByHeader).",
+                    "type": "string"
+                },
                 "name": {
                     "description": "Name is the name of the tag (e.g. \"webserver\").",
                     "type": "string"
@@ -2866,6 +4302,12 @@ const docTemplate = `{
                     "items": {
                         "type": "string"
                     }
+                },
+                "updatedAt": {
+                    "type": "string"
+                },
+                "updatedBy": {
+                    "type": "string"
                 }
             }
         },
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/eval"
+	"github.com/lbrlabs/tacl/pkg/sync"
+)
+
+// TestCmd => tacl test state.json
+type TestCmd struct {
+	File   string `arg:"" help:"State or policy file whose aclTests and sshTests to run ('-' for stdin)"`
+	Output string `help:"Output format" short:"o" enum:"text,json,junit" default:"text"`
+
+	Local  bool `help:"Run the tests with the built-in evaluator" default:"true" negatable:""`
+	Remote bool `help:"Also run the tests through Tailscale's validate API"`
+
+	ClientID     string        `help:"Tailscale OAuth client ID, for --remote" env:"TACL_CLIENT_ID"`
+	ClientSecret string        `help:"Tailscale OAuth client secret, for --remote" env:"TACL_CLIENT_SECRET" secret:"true"`
+	TailnetName  string        `help:"Tailscale tailnet name, for --remote" env:"TACL_TAILNET"`
+	Timeout      time.Duration `help:"Timeout for the remote run" default:"30s"`
+}
+
+// errTestsFailed makes the command exit non-zero after the results are printed.
+var errTestsFailed = errors.New("tests failed")
+
+func (t *TestCmd) Run() error {
+	raw, err := readInput(t.File)
+	if err != nil {
+		return err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("%s is not a JSON object: %w", t.File, err)
+	}
+
+	var results []eval.Result
+	if t.Local {
+		policy, err := eval.FromState(data)
+		if err != nil {
+			return fmt.Errorf("decoding policy: %w", err)
+		}
+		results = append(results, policy.RunTests()...)
+	}
+	if t.Remote {
+		remote, err := t.runRemote(data)
+		if err != nil {
+			return err
+		}
+		results = append(results, remote...)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Outcome == eval.OutcomeFail {
+			failed++
+		}
+	}
+
+	switch t.Output {
+	case "junit":
+		err = eval.WriteJUnit(os.Stdout, results)
+	case "json":
+		err = printJSON(os.Stdout, results)
+	default:
+		for _, r := range results {
+			line := fmt.Sprintf("%-7s %s: %s", r.Outcome, r.Suite, r.Name)
+			if r.Message != "" {
+				line += " (" + r.Message + ")"
+			}
+			fmt.Println(line)
+		}
+		fmt.Printf("%d assertion(s), %d failed\n", len(results), failed)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errTestsFailed
+	}
+	return nil
+}
+
+// runRemote validates the policy TACL would push, which makes Tailscale run
+// its tests, and turns any complaints into failed results.
+func (t *TestCmd) runRemote(data map[string]interface{}) ([]eval.Result, error) {
+	if t.ClientID == "" || t.ClientSecret == "" || t.TailnetName == "" {
+		return nil, fmt.Errorf("--remote needs --client-id, --client-secret and --tailnet-name")
+	}
+	policy, err := sync.PolicyJSON(&common.State{Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("building policy: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+	httpClient := sync.NewClient(sync.DefaultClientOptions, t.ClientID, t.ClientSecret)
+	err = sync.ValidateRemote(ctx, httpClient, t.TailnetName, policy)
+
+	var verr *sync.ValidationError
+	switch {
+	case err == nil:
+		return []eval.Result{{Suite: "tailscale", Name: "validate", Outcome: eval.OutcomePass}}, nil
+	case errors.As(err, &verr):
+		out := []eval.Result{{Suite: "tailscale", Name: "validate", Outcome: eval.OutcomeFail, Message: verr.Message}}
+		for i, d := range verr.Data {
+			out = append(out, eval.Result{
+				Suite:   "tailscale",
+				Name:    fmt.Sprintf("detail %d", i+1),
+				Outcome: eval.OutcomeFail,
+				Message: string(d),
+			})
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("remote tests: %w", err)
+	}
+}
@@ -0,0 +1,181 @@
+// Command bench measures TACL's hot paths against a large synthetic policy:
+// building the synced policy, rendering /state and exports, saving, and
+// request latency on the rule endpoints.
+//
+//	go run ./tools/bench -acls 10000 -derp-regions 200
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lbrlabs/tacl/pkg/acl/acls"
+	"github.com/lbrlabs/tacl/pkg/common"
+	"github.com/lbrlabs/tacl/pkg/policyfile"
+	"github.com/lbrlabs/tacl/pkg/sync"
+)
+
+func main() {
+	numACLs := flag.Int("acls", 10000, "number of ACL entries")
+	numRegions := flag.Int("derp-regions", 200, "number of DERP regions (5 nodes each)")
+	iterations := flag.Int("n", 20, "iterations per whole-document measurement")
+	requests := flag.Int("requests", 2000, "requests per endpoint measurement")
+	flag.Parse()
+
+	dir, err := os.MkdirTemp("", "tacl-bench-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(dir)
+
+	state := &common.State{
+		Data:    syntheticState(*numACLs, *numRegions),
+		Storage: "file://" + filepath.Join(dir, "state.json"),
+	}
+	ids := aclIDs(state)
+	fmt.Printf("state: %d ACLs, %d DERP regions, %d bytes\n\n", *numACLs, *numRegions, len(state.ToJSON()))
+
+	measure("sync policy build", *iterations, func() {
+		_, _ = sync.PolicyJSON(state)
+	})
+	measure("policy size", *iterations, func() {
+		_, _ = sync.MeasurePolicy(state, 0)
+	})
+	measure("GET /state encode", *iterations, func() {
+		_ = state.WriteJSON(io.Discard)
+	})
+	measure("export (hujson)", *iterations, func() {
+		_, _ = policyfile.Export(state.Snapshot(), policyfile.FormatHuJSON)
+	})
+	measure("save (whole file)", *iterations, func() {
+		_ = state.UpdateKeyAndSave("acls", state.GetValue("acls"))
+	})
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(common.SerializeMutations(state))
+	acls.RegisterRoutes(r, state)
+
+	fmt.Println()
+	latency(r, "GET /acls/:id", *requests, func(i int) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/acls/"+ids[i%len(ids)], nil)
+	})
+	latency(r, "GET /acls?limit=100", *requests, func(i int) *http.Request {
+		return httptest.NewRequest(http.MethodGet, fmt.Sprintf("/acls?limit=100&offset=%d", (i*100)%len(ids)), nil)
+	})
+	latency(r, "GET /acls", *requests/20, func(int) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/acls", nil)
+	})
+	latency(r, "PUT /acls", *requests/20, func(i int) *http.Request {
+		body := fmt.Sprintf(`{"id":%q,"entry":{"action":"accept","src":["group:g%d"],"dst":["tag:t%d:443"]}}`, ids[i%len(ids)], i, i)
+		return httptest.NewRequest(http.MethodPut, "/acls", strings.NewReader(body))
+	})
+}
+
+// measure runs fn n times and prints the mean and worst duration.
+func measure(name string, n int, fn func()) {
+	var total, worst time.Duration
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		fn()
+		d := time.Since(start)
+		total += d
+		if d > worst {
+			worst = d
+		}
+	}
+	fmt.Printf("%-22s mean %10s  max %10s\n", name, (total / time.Duration(n)).Round(time.Microsecond), worst.Round(time.Microsecond))
+}
+
+// latency serves n requests and prints p50/p99.
+func latency(h http.Handler, name string, n int, req func(i int) *http.Request) {
+	if n < 1 {
+		n = 1
+	}
+	durations := make([]time.Duration, n)
+	for i := range durations {
+		w := httptest.NewRecorder()
+		start := time.Now()
+		h.ServeHTTP(w, req(i))
+		durations[i] = time.Since(start)
+		if w.Code >= 400 {
+			fmt.Fprintf(os.Stderr, "%s: unexpected status %d: %s\n", name, w.Code, w.Body.String())
+			os.Exit(1)
+		}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	p := func(q float64) time.Duration { return durations[int(float64(n-1)*q)].Round(time.Microsecond) }
+	fmt.Printf("%-22s p50 %10s  p99 %10s  (n=%d)\n", name, p(0.50), p(0.99), n)
+}
+
+func syntheticState(numACLs, numRegions int) map[string]interface{} {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	aclList := make([]interface{}, numACLs)
+	for i := range aclList {
+		aclList[i] = map[string]interface{}{
+			"id":        uuid.NewString(),
+			"action":    "accept",
+			"src":       []interface{}{fmt.Sprintf("group:g%d", i%500), fmt.Sprintf("10.%d.%d.0/24", i/256%256, i%256)},
+			"dst":       []interface{}{fmt.Sprintf("tag:t%d:443", i%200), fmt.Sprintf("tag:t%d:22", (i+1)%200)},
+			"createdBy": "bench@example.com",
+			"createdAt": now,
+		}
+	}
+
+	groups := make(map[string]interface{}, 500)
+	for i := 0; i < 500; i++ {
+		groups[fmt.Sprintf("group:g%d", i)] = []interface{}{fmt.Sprintf("user%d@example.com", i), fmt.Sprintf("user%d@example.com", i+1)}
+	}
+	tagOwners := make(map[string]interface{}, 200)
+	for i := 0; i < 200; i++ {
+		tagOwners[fmt.Sprintf("tag:t%d", i)] = []interface{}{"autogroup:admin"}
+	}
+
+	regions := make(map[string]interface{}, numRegions)
+	for r := 0; r < numRegions; r++ {
+		nodes := make([]interface{}, 5)
+		for n := range nodes {
+			nodes[n] = map[string]interface{}{
+				"name":     fmt.Sprintf("%d%c", 900+r, 'a'+n),
+				"regionID": 900 + r,
+				"hostName": fmt.Sprintf("derp%d-%d.example.com", r, n),
+				"ipv4":     fmt.Sprintf("203.0.%d.%d", r%256, n+1),
+			}
+		}
+		regions[fmt.Sprint(900+r)] = map[string]interface{}{
+			"regionID":   900 + r,
+			"regionCode": fmt.Sprintf("r%d", r),
+			"regionName": fmt.Sprintf("Region %d", r),
+			"nodes":      nodes,
+		}
+	}
+
+	return map[string]interface{}{
+		"acls":      aclList,
+		"groups":    groups,
+		"tagOwners": tagOwners,
+		"derpMap":   map[string]interface{}{"omitDefaultRegions": false, "regions": regions},
+	}
+}
+
+func aclIDs(state *common.State) []string {
+	list, _ := state.GetValue("acls").([]interface{})
+	ids := make([]string, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			ids = append(ids, m["id"].(string))
+		}
+	}
+	return ids
+}
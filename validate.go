@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lbrlabs/tacl/pkg/sync"
+	"github.com/lbrlabs/tacl/pkg/validate"
+)
+
+// ValidateCmd => tacl validate state.json
+type ValidateCmd struct {
+	File   string `arg:"" help:"State file to check ('-' for stdin)"`
+	Strict bool   `help:"Treat warnings as errors"`
+	Output string `help:"Output format" short:"o" enum:"text,json" default:"text"`
+
+	Remote       bool          `help:"Also run Tailscale's validate API (including ACL tests) on the generated policy"`
+	ClientID     string        `help:"Tailscale OAuth client ID, for --remote" env:"TACL_CLIENT_ID"`
+	ClientSecret string        `help:"Tailscale OAuth client secret, for --remote" env:"TACL_CLIENT_SECRET" secret:"true"`
+	TailnetName  string        `help:"Tailscale tailnet name, for --remote" env:"TACL_TAILNET"`
+	Timeout      time.Duration `help:"Timeout for the remote validation" default:"30s"`
+}
+
+// errValidationFailed makes the command exit non-zero after the report is printed.
+var errValidationFailed = errors.New("validation failed")
+
+func (v *ValidateCmd) Run() error {
+	raw, err := readInput(v.File)
+	if err != nil {
+		return err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("%s is not a JSON object: %w", v.File, err)
+	}
+
+	report := validate.State(data)
+
+	if v.Remote {
+		if err := v.validateRemote(data, &report); err != nil {
+			return err
+		}
+	}
+
+	if v.Output == "json" {
+		if err := printJSON(os.Stdout, report); err != nil {
+			return err
+		}
+	} else {
+		for _, i := range report.Issues {
+			fmt.Println(i)
+		}
+		fmt.Printf("%d error(s), %d warning(s)\n", report.Errors(), report.Warnings())
+	}
+
+	if !report.OK() || (v.Strict && report.Warnings() > 0) {
+		return errValidationFailed
+	}
+	return nil
+}
+
+// validateRemote sends the policy TACL would push to Tailscale's validate
+// endpoint and adds its verdict to the report.
+func (v *ValidateCmd) validateRemote(data map[string]interface{}, report *validate.Report) error {
+	if v.ClientID == "" || v.ClientSecret == "" || v.TailnetName == "" {
+		return fmt.Errorf("--remote needs --client-id, --client-secret and --tailnet-name")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), v.Timeout)
+	defer cancel()
+	httpClient := sync.NewClient(sync.DefaultClientOptions, v.ClientID, v.ClientSecret)
+	issues, err := validate.Remote(ctx, httpClient, v.TailnetName, data)
+	if err != nil {
+		return err
+	}
+	report.Issues = append(report.Issues, issues...)
+	return nil
+}